@@ -0,0 +1,506 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/acp"
+	"github.com/ThatCatDev/tanrenai/client/internal/agent"
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/internal/transcript"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+var acpCmd = &cobra.Command{
+	Use:   "acp",
+	Short: "Serve the Agent Client Protocol on stdin/stdout for editors",
+	Long: `Run tanrenai as an agent for editors that speak the Agent Client Protocol
+(JSON-RPC over stdio), such as Zed or Neovim front-ends, instead of the TUI.
+
+Each editor session gets its own conversation and tool registry, like an
+agent-mode chat. Tools that only read run straight away; the editor is asked
+before any other tool runs, and "always allow" lasts for the session. Logs
+go to stderr; stdout carries only protocol messages.
+
+The agent works in the directory of the first session the editor opens.
+
+  Zed settings.json:
+  "agent_servers": {
+    "tanrenai": {"command": "tanrenai", "args": ["acp", "--model", "qwen3-8b"]}
+  }`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		model, _ := cmd.Flags().GetString("model")
+		if model == "" {
+			return fmt.Errorf("specify a model with --model")
+		}
+		systemPrompt, _ := cmd.Flags().GetString("system")
+		if systemFile, _ := cmd.Flags().GetString("system-file"); systemFile != "" {
+			data, err := os.ReadFile(systemFile)
+			if err != nil {
+				return fmt.Errorf("failed to read system file: %w", err)
+			}
+			systemPrompt = string(data)
+		}
+		toolOpts, err := toolFlags(cmd)
+		if err != nil {
+			return err
+		}
+		sampling, err := samplingFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		client := backendClient(cmd)
+		router, err := newRouter(client)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Loading model %s...\n", model)
+		ctxSize, toolFormat, err := loadModel(ctx, cmd, os.Stderr, router, model)
+		if err != nil {
+			return err
+		}
+		estimator := chatctx.NewTokenEstimator()
+		calibrateEstimator(router, model, estimator)
+
+		memoryEnabled, _ := cmd.Flags().GetBool("memory")
+		if memoryEnabled {
+			if _, err := client.MemoryCount(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: memory not available: %v\n", err)
+				memoryEnabled = false
+			}
+		}
+
+		responseBudget, _ := cmd.Flags().GetInt("response-budget")
+		maxIterations, _ := cmd.Flags().GetInt("max-iterations")
+		contextFiles, _ := cmd.Flags().GetStringSlice("context-file")
+		logDir, _ := cmd.Flags().GetString("log-dir")
+		tlog, err := openTranscript(os.Stderr, logDir, model, true)
+		if err != nil {
+			return err
+		}
+		defer tlog.Close()
+
+		a := &acpAgent{
+			cmd:            cmd,
+			remotes:        router.Remotes,
+			model:          model,
+			summaryModel:   summaryModelFlag(cmd, os.Stderr, router, model),
+			toolFormat:     toolFormat,
+			ctxSize:        ctxSize,
+			responseBudget: responseBudget,
+			maxIterations:  maxIterations,
+			contextFiles:   contextFiles,
+			estimator:      estimator,
+			systemPrompt:   systemPrompt,
+			memoryEnabled:  memoryEnabled,
+			toolOpts:       toolOpts,
+			sampling:       sampling,
+			tlog:           tlog,
+			sessions:       make(map[string]*acpSession),
+		}
+		a.conn = acp.NewConn(os.Stdin, os.Stdout, a.handle)
+		fmt.Fprintln(os.Stderr, "Serving the Agent Client Protocol on stdio")
+		if err := a.conn.Serve(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	},
+}
+
+// acpAgent answers an editor's ACP requests, keeping a conversation per
+// session.
+type acpAgent struct {
+	cmd            *cobra.Command
+	conn           *acp.Conn
+	remotes        map[string]apiclient.Remote
+	model          string
+	summaryModel   string // "" = the chat model
+	toolFormat     string
+	ctxSize        int
+	responseBudget int
+	maxIterations  int
+	contextFiles   []string
+	estimator      *chatctx.TokenEstimator
+	systemPrompt   string
+	memoryEnabled  bool
+	toolOpts       toolOptions
+	sampling       *samplingSettings
+	tlog           *transcript.Logger
+
+	mu       sync.Mutex
+	dir      string // the working directory, set by the first session
+	sessions map[string]*acpSession
+}
+
+// acpSession is one editor session: a conversation with its own context
+// manager, tool registry and prompt cache slot.
+type acpSession struct {
+	id        string
+	mgr       *chatctx.Manager
+	registry  *tools.Registry
+	summarize chatctx.CompletionFunc
+	streamFn  agent.StreamingCompletionFunc
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // of the running prompt, nil when idle
+	allowed map[string]bool    // tools the user allowed for the rest of the session
+}
+
+func (a *acpAgent) handle(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case acp.MethodInitialize:
+		return acp.InitializeResponse{
+			ProtocolVersion: acp.ProtocolVersion,
+			AgentCapabilities: acp.AgentCapabilities{
+				PromptCapabilities: acp.PromptCapabilities{Image: true, EmbeddedContext: true},
+			},
+			AuthMethods: []acp.AuthMethod{},
+		}, nil
+	case acp.MethodAuthenticate:
+		return struct{}{}, nil
+	case acp.MethodSessionNew:
+		var req acp.NewSessionRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		return a.newSession(req)
+	case acp.MethodSessionPrompt:
+		var req acp.PromptRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		return a.prompt(ctx, req)
+	case acp.MethodSessionCancel:
+		var req acp.CancelNotification
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		if sess := a.session(req.SessionID); sess != nil {
+			sess.mu.Lock()
+			if sess.cancel != nil {
+				sess.cancel()
+			}
+			sess.mu.Unlock()
+		}
+		return nil, nil
+	}
+	return nil, &acp.Error{Code: acp.CodeMethodNotFound, Message: "method not found: " + method}
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &acp.Error{Code: acp.CodeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func (a *acpAgent) session(id string) *acpSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessions[id]
+}
+
+// newSession sets up a conversation in req.Cwd. Tools resolve paths
+// against the process's directory, so every session must share the first
+// one's.
+func (a *acpAgent) newSession(req acp.NewSessionRequest) (*acp.NewSessionResponse, error) {
+	dir := filepath.Clean(req.Cwd)
+	if !filepath.IsAbs(dir) {
+		return nil, &acp.Error{Code: acp.CodeInvalidParams, Message: "cwd must be an absolute path"}
+	}
+
+	a.mu.Lock()
+	switch {
+	case a.dir == "":
+		if err := os.Chdir(dir); err != nil {
+			a.mu.Unlock()
+			return nil, &acp.Error{Code: acp.CodeInvalidParams, Message: err.Error()}
+		}
+		a.dir = dir
+	case a.dir != dir:
+		a.mu.Unlock()
+		return nil, &acp.Error{Code: acp.CodeInvalidParams,
+			Message: fmt.Sprintf("this agent works in %s; start another one for %s", a.dir, dir)}
+	}
+	a.mu.Unlock()
+
+	id := newCacheID()
+	client := backendClient(a.cmd)
+	client.SetSession(id)
+	router := &apiclient.Router{Server: client, Remotes: a.remotes}
+
+	mgr := chatctx.NewManager(chatctx.Config{
+		CtxSize:           a.ctxSize,
+		ResponseBudget:    a.responseBudget,
+		StructuredSummary: true,
+	}, a.estimator)
+	for _, path := range a.contextFiles {
+		if err := loadContextFile(os.Stderr, mgr, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load context file %s: %v\n", path, err)
+		}
+	}
+	enableEnvironment(a.cmd, mgr)
+	loadInstructions(os.Stderr, mgr)
+	setSystemPrompt(mgr, a.systemPrompt, true, a.memoryEnabled)
+	mgr.SetSummaryProgress(func(messages, tokens int) {
+		fmt.Fprintf(os.Stderr, "Session %s: summarizing %d messages (%s tokens)\n", id, messages, formatTokenCount(tokens))
+	})
+
+	completeFn, streamFn := completionFuncs(router, a.tlog, func() string { return a.model }, id, a.sampling)
+	registry := agentRegistry(client, mgr, streamFn, a.toolOpts, a.memoryEnabled)
+	mgr.SetToolsBudget(toolsBudget(router, a.model, a.toolFormat, registry, a.estimator))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions[id] = &acpSession{
+		id:        id,
+		mgr:       mgr,
+		registry:  registry,
+		summarize: summaryCompletion(router, a.tlog, a.summaryModel, id, completeFn),
+		streamFn:  streamFn,
+		allowed:   make(map[string]bool),
+	}
+	fmt.Fprintf(os.Stderr, "Session %s started in %s\n", id, dir)
+	return &acp.NewSessionResponse{SessionID: id}, nil
+}
+
+// prompt runs one agent turn, streaming its reply and tool calls to the
+// editor as session/update notifications.
+func (a *acpAgent) prompt(ctx context.Context, req acp.PromptRequest) (*acp.PromptResponse, error) {
+	sess := a.session(req.SessionID)
+	if sess == nil {
+		return nil, &acp.Error{Code: acp.CodeInvalidParams, Message: "unknown session " + req.SessionID}
+	}
+	msg := promptMessage(req.Prompt)
+	if strings.TrimSpace(msg.Content) == "" && len(msg.Images) == 0 {
+		return nil, &acp.Error{Code: acp.CodeInvalidParams, Message: "prompt is empty"}
+	}
+
+	turnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess.mu.Lock()
+	if sess.cancel != nil {
+		sess.mu.Unlock()
+		return nil, &acp.Error{Code: acp.CodeInvalidRequest, Message: "a prompt is already running in this session"}
+	}
+	sess.cancel = cancel
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		sess.cancel = nil
+		sess.mu.Unlock()
+	}()
+
+	update := func(u acp.SessionUpdate) {
+		a.conn.Notify(acp.MethodSessionUpdate, acp.SessionNotification{SessionID: sess.id, Update: u})
+	}
+	chunk := func(kind, text string) {
+		update(acp.SessionUpdate{SessionUpdate: kind, Content: acp.TextBlock(text)})
+	}
+
+	sess.mgr.RefreshEnvironment()
+	sess.mgr.Append(msg)
+	if sess.mgr.NeedsSummary() {
+		_ = sess.mgr.Summarize(turnCtx, sess.summarize)
+	}
+	msgs := sess.mgr.Messages()
+
+	cfg := agent.StreamingConfig{
+		Config: agent.Config{
+			MaxIterations:  a.maxIterations,
+			Tools:          sess.registry,
+			MaxTokens:      sess.mgr.PromptBudget(),
+			TokenEstimator: sess.mgr.Estimator(),
+			Compact: func(ctx context.Context, msgs []api.Message, start int) ([]api.Message, error) {
+				return sess.mgr.CompactTurn(ctx, sess.summarize, msgs, start)
+			},
+			RouteTools:  a.toolOpts.route,
+			ApproveTool: func(ctx context.Context, call api.ToolCall) bool { return a.approve(ctx, sess, call) },
+			Hooks: agent.Hooks{
+				OnToolCall: func(call api.ToolCall) {
+					a.tlog.ToolCall(call)
+					update(acpToolCall(call))
+				},
+				OnToolResult: func(call api.ToolCall, result string) {
+					a.tlog.ToolResult(call, result)
+					update(acp.SessionUpdate{
+						SessionUpdate: acp.UpdateToolCallUpdate,
+						ToolCallID:    call.ID,
+						Status:        acp.ToolCompleted,
+						Content:       []acp.ToolCallContent{{Type: "content", Content: acp.TextBlock(result)}},
+					})
+				},
+				OnRetry: func(attempt, maxAttempts int, err error) {
+					chunk(acp.UpdateAgentMessageChunk, fmt.Sprintf("\n[%v; retrying (%d/%d)]\n", err, attempt, maxAttempts))
+				},
+			},
+			Retry: agent.DefaultRetry,
+		},
+		OnContentDelta:   func(delta string) { chunk(acp.UpdateAgentMessageChunk, delta) },
+		OnReasoningDelta: func(delta string) { chunk(acp.UpdateAgentThoughtChunk, delta) },
+	}
+
+	result, err := agent.RunStreaming(turnCtx, sess.streamFn, msgs, cfg)
+	sess.mgr.AppendMany(result.NewMessages(len(msgs)))
+	fmt.Fprintf(os.Stderr, "Session %s: %s: %s\n", sess.id, result.StopReason, runSummary(result))
+
+	switch result.StopReason {
+	case agent.StopCompleted:
+		return &acp.PromptResponse{StopReason: acp.StopEndTurn}, nil
+	case agent.StopCancelled:
+		return &acp.PromptResponse{StopReason: acp.StopCancelled}, nil
+	case agent.StopMaxIterations:
+		return &acp.PromptResponse{StopReason: acp.StopMaxTurnRequests}, nil
+	case agent.StopStuck:
+		chunk(acp.UpdateAgentMessageChunk, "\n[stopped: the same tool calls kept failing]\n")
+		return &acp.PromptResponse{StopReason: acp.StopEndTurn}, nil
+	}
+	if api.IsCode(err, api.CodeContextExceeded) {
+		return &acp.PromptResponse{StopReason: acp.StopMaxTokens}, nil
+	}
+	return nil, &acp.Error{Code: acp.CodeInternalError, Message: describeTurnError(err)}
+}
+
+// acpReadOnlyTools run without asking the editor for permission.
+var acpReadOnlyTools = map[string]bool{
+	"file_read": true, "list_dir": true, "grep_search": true, "find_files": true, "code_symbols": true,
+	"git_status": true, "git_diff": true, "git_log": true, "git_blame": true,
+	"process_status": true, "process_logs": true, "memory_search": true,
+}
+
+// approve asks the editor whether call may run, unless the tool only
+// reads or the user has allowed it for the session.
+func (a *acpAgent) approve(ctx context.Context, sess *acpSession, call api.ToolCall) bool {
+	name := call.Function.Name
+	sess.mu.Lock()
+	allowed := acpReadOnlyTools[name] || sess.allowed[name]
+	sess.mu.Unlock()
+	if allowed {
+		return true
+	}
+
+	var resp acp.RequestPermissionResponse
+	err := a.conn.Call(ctx, acp.MethodRequestPermission, acp.RequestPermissionRequest{
+		SessionID: sess.id,
+		ToolCall:  acpToolCall(call),
+		Options: []acp.PermissionOption{
+			{OptionID: acp.PermitAllowOnce, Name: "Allow", Kind: acp.PermitAllowOnce},
+			{OptionID: acp.PermitAllowAlways, Name: "Always allow " + name, Kind: acp.PermitAllowAlways},
+			{OptionID: acp.PermitRejectOnce, Name: "Reject", Kind: acp.PermitRejectOnce},
+		},
+	}, &resp)
+	if err != nil || resp.Outcome.Outcome != "selected" {
+		return false
+	}
+	switch resp.Outcome.OptionID {
+	case acp.PermitAllowAlways:
+		sess.mu.Lock()
+		sess.allowed[name] = true
+		sess.mu.Unlock()
+		return true
+	case acp.PermitAllowOnce:
+		return true
+	}
+	return false
+}
+
+// acpToolCall describes a new tool call to the editor.
+func acpToolCall(call api.ToolCall) acp.SessionUpdate {
+	u := acp.SessionUpdate{
+		SessionUpdate: acp.UpdateToolCall,
+		ToolCallID:    call.ID,
+		Title:         call.Function.Name,
+		Kind:          acpToolKind(call.Function.Name),
+		Status:        acp.ToolPending,
+	}
+	if json.Valid([]byte(call.Function.Arguments)) {
+		u.RawInput = json.RawMessage(call.Function.Arguments)
+	}
+	if path := extractFilePath(call); path != "" {
+		u.Title += " " + path
+		if abs, err := filepath.Abs(path); err == nil {
+			u.Locations = []acp.Location{{Path: abs}}
+		}
+	}
+	return u
+}
+
+// acpToolKind picks the ACP kind, which editors show as an icon, for a
+// tool.
+func acpToolKind(name string) string {
+	switch name {
+	case "file_read", "list_dir", "code_symbols", "git_status", "git_diff", "git_log", "git_blame", "process_status", "process_logs":
+		return acp.KindRead
+	case "file_write", "patch_file", "multi_edit", "apply_unified_diff":
+		return acp.KindEdit
+	case "grep_search", "find_files", "memory_search", "web_search":
+		return acp.KindSearch
+	case "shell_exec", "shell_session", "process_start", "process_stop", "git_commit", "db_query":
+		return acp.KindExecute
+	case "http_request":
+		return acp.KindFetch
+	case "spawn_agent":
+		return acp.KindThink
+	case "memory_forget":
+		return acp.KindDelete
+	}
+	return acp.KindOther
+}
+
+// promptMessage turns an ACP prompt into a user message: text as is,
+// embedded files as fenced blocks, linked files by path and images as
+// data URIs.
+func promptMessage(blocks []acp.ContentBlock) api.Message {
+	msg := api.Message{Role: "user"}
+	var parts []string
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			parts = append(parts, b.Text)
+		case "resource":
+			if b.Resource != nil && b.Resource.Text != "" {
+				parts = append(parts, fmt.Sprintf("%s:\n```\n%s\n```", filePath(b.Resource.URI), b.Resource.Text))
+			}
+		case "resource_link":
+			parts = append(parts, "File: "+filePath(b.URI))
+		case "image":
+			if b.Data != "" {
+				msg.Images = append(msg.Images, "data:"+b.MimeType+";base64,"+b.Data)
+			}
+		}
+	}
+	msg.Content = strings.Join(parts, "\n\n")
+	return msg
+}
+
+// filePath strips the file:// scheme from a resource URI.
+func filePath(uri string) string {
+	if path, ok := strings.CutPrefix(uri, "file://"); ok {
+		return path
+	}
+	return uri
+}
+
+func init() {
+	acpCmd.Flags().String("model", "", "model the agent uses")
+	acpCmd.RegisterFlagCompletionFunc("model", completeModels)
+	addRunFlags(acpCmd)
+	rootCmd.AddCommand(acpCmd)
+}
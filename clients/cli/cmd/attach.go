@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxImageBytes caps the size of an image attached with /attach.
+const maxImageBytes = 20 << 20
+
+// imageAttachment is an image attached to the next prompt with /attach.
+type imageAttachment struct {
+	name string // file name, for display
+	size int64
+	url  string // data URI sent to the model
+}
+
+// readImage reads an image file into a data URI.
+func readImage(path string) (*imageAttachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageBytes {
+		return nil, fmt.Errorf("%s is %s; images are limited to %s", path, formatBytes(info.Size()), formatBytes(maxImageBytes))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		return nil, fmt.Errorf("%s is not an image (%s)", path, mime)
+	}
+	return &imageAttachment{
+		name: filepath.Base(path),
+		size: int64(len(data)),
+		url:  "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
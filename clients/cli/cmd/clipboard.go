@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// copyToClipboard puts text on the system clipboard using the platform's
+// clipboard tool. Over SSH, or when no tool is installed, it falls back to
+// osc52, which asks the terminal to set its clipboard. It returns the method
+// that was used.
+func copyToClipboard(text string, osc52 func([]byte)) (string, error) {
+	if os.Getenv("SSH_TTY") == "" && os.Getenv("SSH_CONNECTION") == "" {
+		for _, args := range clipboardCommands() {
+			if _, err := exec.LookPath(args[0]); err != nil {
+				continue
+			}
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdin = strings.NewReader(text)
+			if err := cmd.Run(); err == nil {
+				return args[0], nil
+			}
+		}
+	}
+	if osc52 != nil {
+		osc52([]byte(text))
+		return "OSC 52", nil
+	}
+	return "", errors.New("no clipboard tool found")
+}
+
+// clipboardCommands lists the clipboard tools to try, most specific first.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-copy"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+	return cmds
+}
+
+// lastCodeBlock returns the body of the most recent fenced code block in an
+// assistant message.
+func lastCodeBlock(history []api.Message) (string, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role != "assistant" {
+			continue
+		}
+		var (
+			block []string
+			last  string
+			found bool
+			open  bool
+		)
+		for _, line := range strings.Split(history[i].Content, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				if open {
+					last, found = strings.Join(block, "\n"), true
+				}
+				open = !open
+				block = block[:0]
+				continue
+			}
+			if open {
+				block = append(block, line)
+			}
+		}
+		if found {
+			return last, true
+		}
+	}
+	return "", false
+}
+
+// tagPattern matches tview style/region tags and their escaped form ("[x[]").
+var tagPattern = regexp.MustCompile(`\[([a-zA-Z0-9_,;: \-\."#]*)\[\]|\[[a-zA-Z0-9_,;: \-\."#]*\]`)
+
+// plainChatText strips tview tags from a chat line, restoring escaped
+// brackets, so copied text matches what is on screen.
+func plainChatText(line string) string {
+	return tagPattern.ReplaceAllStringFunc(line, func(m string) string {
+		switch {
+		case m == "[]":
+			return m
+		case strings.HasSuffix(m, "[]"):
+			return m[:len(m)-2] + "]"
+		}
+		return ""
+	})
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxCompletions caps the path entries shown in the completion popup.
+const maxCompletions = 20
+
+// completer proposes completions for the argument typed after a command.
+// Each returned entry replaces the whole argument.
+type completer interface {
+	complete(arg string) []string
+}
+
+// pathCompleter completes filesystem paths relative to the working
+// directory. A leading ~/ is resolved against the home directory.
+type pathCompleter struct{}
+
+func (pathCompleter) complete(arg string) []string {
+	dir, prefix := filepath.Split(arg)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if rest, ok := strings.CutPrefix(readDir, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		readDir = filepath.Join(home, rest)
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		out = append(out, dir+name)
+		if len(out) == maxCompletions {
+			break
+		}
+	}
+	return out
+}
+
+// themeCompleter completes built-in and custom theme names.
+type themeCompleter struct{}
+
+func (themeCompleter) complete(arg string) []string {
+	var out []string
+	for _, name := range availableThemes() {
+		if strings.HasPrefix(name, arg) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// slashCommand describes a TUI command for /help and input completion.
+type slashCommand struct {
+	name      string
+	args      string // argument hint, e.g. "<path>"
+	desc      string
+	completer completer // completes the argument; nil if none
+}
+
+// usage returns the command with its argument hint.
+func (c slashCommand) usage() string {
+	if c.args == "" {
+		return c.name
+	}
+	return c.name + " " + c.args
+}
+
+// insertText is what selecting the command inserts into the input field.
+func (c slashCommand) insertText() string {
+	if c.args == "" {
+		return c.name
+	}
+	return c.name + " "
+}
+
+// slashCommands lists the TUI commands. Adding an entry here is enough for
+// it to show up in /help and in the completion popup.
+var slashCommands = []slashCommand{
+	{name: "/clear", desc: "Clear conversation history"},
+	{name: "/compact", args: "[N%] [tools] [--dry-run]", desc: "Summarize to free context (N% free; tools: tool results only; --dry-run previews)"},
+	{name: "/plan", args: "[request]", desc: "Toggle plan mode, or plan a single request"},
+	{name: "/init", desc: "Have the agent write TANRENAI.md for this project"},
+	{name: "/tokens", desc: "Show token budget"},
+	{name: "/stats", desc: "Show session tokens, time and the tools that took longest"},
+	{name: "/pin", args: "[n]", desc: "Pin the n-th most recent reply (default: last)"},
+	{name: "/pin list", desc: "Show pinned messages"},
+	{name: "/unpin", args: "<n>", desc: "Unpin a message"},
+	{name: "/context add", args: "<path>", desc: "Load file into context", completer: pathCompleter{}},
+	{name: "/context list", desc: "Show loaded files"},
+	{name: "/context clear", desc: "Remove all context files"},
+	{name: "/model list", desc: "List available models"},
+	{name: "/model use", args: "<name>", desc: "Load a model and switch to it"},
+	{name: "/speak", desc: "Record speech into the input (also Ctrl+T)"},
+	{name: "/think", desc: "Show or hide the model's reasoning"},
+	{name: "/set", args: "[name value]", desc: "Show or set sampling parameters", completer: samplingCompleter{}},
+	{name: "/profile", args: "[name]", desc: "List profiles, or switch to one"},
+	{name: "/theme", args: "[name]", desc: "Show or switch the color theme", completer: themeCompleter{}},
+	{name: "/copy-last", desc: "Copy the last code block from a reply"},
+	{name: "/attach", args: "<image>", desc: "Send an image with the next message", completer: pathCompleter{}},
+	{name: "/open", args: "<path[:line]>", desc: "Show a file in the viewer", completer: pathCompleter{}},
+	{name: "/memory", desc: "List recent memories"},
+	{name: "/memory search", args: "<q>", desc: "Search memories"},
+	{name: "/memory forget", args: "<id>", desc: "Delete a memory"},
+	{name: "/memory export", args: "<f>", desc: "Back up memories to JSONL", completer: pathCompleter{}},
+	{name: "/memory import", args: "<f>", desc: "Restore memories from JSONL", completer: pathCompleter{}},
+	{name: "/memory remember", args: "<fact>", desc: "Save a fact that never goes stale"},
+	{name: "/memory importance", args: "<id> <n>", desc: "Set importance (0-1)"},
+	{name: "/memory rate", args: "<id> <up|down|clear>", desc: "Rate a memory for fine-tuning"},
+	{name: "/memory compact", desc: "Merge near-duplicate memories"},
+	{name: "/memory clear", desc: "Clear all memories"},
+	{name: "/finetune dataset stats", args: "[filters]", desc: "Summarize the dataset memory would give"},
+	{name: "/finetune dataset show", args: "[n] [filters]", desc: "Preview the dataset's memories"},
+	{name: "/finetune prepare", args: "<model> [--tools] [filters | --pairs file]", desc: "Create a training run from memory, agent trajectories or preference pairs"},
+	{name: "/finetune train", args: "<run-id> [--epochs n --lr r --rank n ...]", desc: "Start training a prepared run"},
+	{name: "/finetune status", args: "<run-id> [--follow]", desc: "Show a run's progress, or watch it live"},
+	{name: "/finetune deploy", args: "<run-id> [--name model] [--checks file]", desc: "Release a run as model@vN with smoke tests"},
+	{name: "/finetune import", args: "<run-id> <file> [--format f]", desc: "Add an external dataset to a run"},
+	{name: "/finetune list", desc: "List training runs and their disk usage"},
+	{name: "/finetune gc", args: "[--keep n] [--max-gb size] [--dry-run]", desc: "Remove old runs, checkpoints and merged models"},
+	{name: "/pull", args: "<repo-or-url>", desc: "Download a model in the background"},
+	{name: "/quit", desc: "Exit (also /exit)"},
+}
+
+// completeInput returns completion entries for the input text: matching
+// commands (shown with their argument hints) while the command is being
+// typed, then the command's completer once its argument has started.
+func completeInput(text string) []string {
+	if !strings.HasPrefix(text, "/") {
+		return nil
+	}
+	var out []string
+	for _, c := range slashCommands {
+		if arg, ok := strings.CutPrefix(text, c.name+" "); ok && c.completer != nil {
+			for _, s := range c.completer.complete(arg) {
+				out = append(out, c.name+" "+s)
+			}
+			continue
+		}
+		if strings.HasPrefix(c.name, text) && c.insertText() != text {
+			out = append(out, c.usage())
+		}
+	}
+	return out
+}
+
+// completionText maps a selected completion entry to the text to put in the
+// input field, dropping argument hints. tview strips bracketed hints such as
+// "[n]" as style tags before handing the entry back, so a bare command name
+// is matched too.
+func completionText(entry string) string {
+	for _, c := range slashCommands {
+		if entry == c.usage() || strings.TrimSpace(entry) == c.name {
+			return c.insertText()
+		}
+	}
+	return entry
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Print a shell completion script",
+	Long: `Print a script that gives the shell tab completion for tanrenai's commands
+and flags. Model names are completed from the backend's downloaded models
+(and providers.toml), profiles from the config files.
+
+  bash:        source <(tanrenai completion bash)
+               or write it to /etc/bash_completion.d/tanrenai
+  zsh:         tanrenai completion zsh > "${fpath[1]}/_tanrenai"
+  fish:        tanrenai completion fish > ~/.config/fish/completions/tanrenai.fish
+  powershell:  tanrenai completion powershell | Out-String | Invoke-Expression`,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, out := cmd.Root(), cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(out, true)
+		case "zsh":
+			return root.GenZshCompletion(out)
+		case "fish":
+			return root.GenFishCompletion(out, true)
+		case "powershell":
+			return root.GenPowerShellCompletionWithDesc(out)
+		}
+		return fmt.Errorf("unsupported shell %q: use bash, zsh, fish or powershell", args[0])
+	},
+}
+
+// completionTimeout bounds the backend call behind a completion, so a
+// backend that is down does not hang the shell.
+const completionTimeout = 2 * time.Second
+
+// completeModels completes model names: the backend's downloaded models
+// and their aliases, and the remote models in providers.toml.
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := localModelNames(cmd)
+	if remotes, err := loadRemotes(); err == nil {
+		for alias := range remotes {
+			names = append(names, alias)
+		}
+	}
+	return matching(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// firstArg completes only a command's first argument with complete.
+func firstArg(complete cobra.CompletionFunc) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
+
+// completeLocalModels completes the file names of downloaded models, for
+// commands that do not accept aliases.
+func completeLocalModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	resp, err := localModels(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, m := range resp.Models {
+		if !slices.Contains(args, m.Name) {
+			names = append(names, m.Name)
+		}
+	}
+	return matching(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func localModelNames(cmd *cobra.Command) []string {
+	resp, err := localModels(cmd)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, m := range resp.Models {
+		names = append(names, m.Name)
+		if m.Metadata != nil {
+			names = append(names, m.Metadata.Aliases...)
+		}
+	}
+	return names
+}
+
+// localModels asks the backend for its models. Completion skips the
+// PersistentPreRunE that applies the config files, so they are applied
+// here for --server-url.
+func localModels(cmd *cobra.Command) (*api.LocalModelsResponse, error) {
+	_ = applyConfig(cmd)
+	opts := apiclient.DefaultOptions()
+	opts.Retries = -1
+	ctx := apiclient.WithTimeout(context.Background(), completionTimeout)
+	return apiclient.NewWithOptions(serverURL, opts).LocalModels(ctx)
+}
+
+// completeProfiles completes --profile with the profiles the config files
+// define.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	layers, err := loadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, layer := range layers {
+		for name := range layer.profiles {
+			names = append(names, name)
+		}
+	}
+	return matching(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// matching returns the sorted, distinct names starting with prefix.
+func matching(names []string, prefix string) []string {
+	var out []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.yaml.in/yaml/v3"
+)
+
+// projectConfigName is the per-project config file, looked up from the
+// current directory upwards.
+const projectConfigName = ".tanrenai.yaml"
+
+// userConfigPath returns $XDG_CONFIG_HOME/tanrenai/config.yaml, by default
+// ~/.config/tanrenai/config.yaml, or "" if the home directory is unknown.
+func userConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "tanrenai", "config.yaml")
+}
+
+// userOnlyKeys are settings a project file may not make, since a cloned
+// repository could otherwise send prompts elsewhere or widen what the
+// agent may do.
+var userOnlyKeys = map[string]bool{
+	"server-url":      true,
+	"allow-git-write": true,
+	"http-allow-host": true,
+	"shell-policy":    true,
+}
+
+// configLayer is one config file: keys are flag names, values what the
+// flag would be given on the command line. Profiles are named sets of
+// settings chosen with --profile, or the profile key:
+//
+//	agent: true
+//	ctx-size: 16384
+//	tool-timeout: 2m
+//	http-allow-host: [api.example.com]
+//	profile: coding
+//	profiles:
+//	  coding:
+//	    model: qwen2.5-coder-7b
+//	    memory: true
+//	  chat:
+//	    model: llama-3.2-1b
+//	    agent: false
+type configLayer struct {
+	path     string
+	project  bool
+	values   map[string]any
+	profiles map[string]map[string]any
+}
+
+// loadConfig reads the user config file and the nearest .tanrenai.yaml,
+// in that order, skipping files that do not exist.
+func loadConfig() ([]configLayer, error) {
+	var paths []string
+	if path := userConfigPath(); path != "" {
+		paths = append(paths, path)
+	}
+	if path := findProjectConfig(); path != "" {
+		paths = append(paths, path)
+	}
+
+	var layers []configLayer
+	for _, path := range paths {
+		layer := configLayer{path: path, project: filepath.Base(path) == projectConfigName}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, &layer.values); err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if raw, ok := layer.values["profiles"]; ok {
+			delete(layer.values, "profiles")
+			tables, ok := raw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: profiles must map names to settings, e.g. profiles: {coding: {model: qwen2.5-coder-7b}}", path)
+			}
+			layer.profiles = make(map[string]map[string]any, len(tables))
+			for name, table := range tables {
+				settings, ok := table.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s: profile %q must be a mapping of settings", path, name)
+				}
+				layer.profiles[name] = settings
+			}
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// findProjectConfig returns the .tanrenai.yaml in the current directory or
+// the closest parent, or "".
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configSetting is the effective value of one config key and where it
+// came from.
+type configSetting struct {
+	value   any
+	source  string
+	profile bool // set by the profile rather than a file's top level
+}
+
+// effectiveConfig merges layers, later ones winning, then the settings of
+// the profile (named by profile, or else by the files' profile key), and
+// checks each key against the flags of root and its subcommands.
+func effectiveConfig(layers []configLayer, root *cobra.Command, profile string) (map[string]configSetting, error) {
+	known := allFlags(root)
+	check := func(layer configLayer, key string) error {
+		if !known[key] {
+			return fmt.Errorf("%s: unknown setting %q (settings are the command-line flag names)", layer.path, key)
+		}
+		if layer.project && userOnlyKeys[key] {
+			return fmt.Errorf("%s: %q can only be set in %s or on the command line", layer.path, key, userConfigPath())
+		}
+		return nil
+	}
+
+	settings := make(map[string]configSetting)
+	for _, layer := range layers {
+		for key, value := range layer.values {
+			if err := check(layer, key); err != nil {
+				return nil, err
+			}
+			settings[key] = configSetting{value: value, source: layer.path}
+		}
+	}
+
+	if profile == "" {
+		if s, ok := settings["profile"]; ok {
+			profile = configString(s.value)
+		}
+	}
+	if profile == "" {
+		return settings, nil
+	}
+	found := false
+	for _, layer := range layers {
+		values, ok := layer.profiles[profile]
+		if !ok {
+			continue
+		}
+		found = true
+		for key, value := range values {
+			if key == "profile" {
+				return nil, fmt.Errorf("%s: profile %q cannot select another profile", layer.path, profile)
+			}
+			if err := check(layer, key); err != nil {
+				return nil, err
+			}
+			settings[key] = configSetting{value: value, source: fmt.Sprintf("profile %s in %s", profile, layer.path), profile: true}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(profileNames(layers), ", "))
+	}
+	return settings, nil
+}
+
+// profileNames returns the profiles the layers define, sorted.
+func profileNames(layers []configLayer) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, layer := range layers {
+		for name := range layer.profiles {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func allFlags(cmd *cobra.Command) map[string]bool {
+	known := make(map[string]bool)
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		c.LocalFlags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		c.PersistentFlags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(cmd)
+	delete(known, "help")
+	return known
+}
+
+// applyConfig sets cmd's flags that were not given on the command line
+// from the config files, so the precedence is flags, then the profile,
+// then the project file, then the user file, then the flag defaults.
+func applyConfig(cmd *cobra.Command) error {
+	layers, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	profile, _ := cmd.Flags().GetString("profile")
+	settings, err := effectiveConfig(layers, cmd.Root(), profile)
+	if err != nil {
+		return err
+	}
+	var applyErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		s, ok := settings[f.Name]
+		if !ok || f.Changed || applyErr != nil {
+			return
+		}
+		if err := setFlag(f, s.value); err != nil {
+			applyErr = fmt.Errorf("%s: %s: %w", s.source, f.Name, err)
+		}
+	})
+	return applyErr
+}
+
+// setFlag gives f a YAML value: a list for slice flags, anything else in
+// its command-line form.
+func setFlag(f *pflag.Flag, value any) error {
+	if list, ok := value.([]any); ok {
+		slice, ok := f.Value.(pflag.SliceValue)
+		if !ok {
+			return fmt.Errorf("takes a single value, not a list")
+		}
+		return slice.Replace(configStrings(list))
+	}
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.Replace([]string{configString(value)})
+	}
+	return f.Value.Set(configString(value))
+}
+
+func configStrings(list []any) []string {
+	items := make([]string, len(list))
+	for i, v := range list {
+		items[i] = configString(v)
+	}
+	return items
+}
+
+func configString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config [command]",
+	Short: "Show the effective settings for a command (default run)",
+	Long: `Show the settings a command would use and where each comes from.
+
+Settings are read from ~/.config/tanrenai/config.yaml (or
+$XDG_CONFIG_HOME/tanrenai/config.yaml) and then from the nearest
+.tanrenai.yaml in the current directory or its parents. Keys are flag names
+(ctx-size: 16384, agent: true, http-allow-host: [api.example.com]).
+Flags given on the command line override both files, and the project file
+overrides the user file. server-url, allow-git-write, http-allow-host and
+shell-policy can only be set in the user file.
+
+The profiles key maps names to bundles of settings (model, agent, system
+prompt, tool policies, context sizes), selected with --profile <name> or by
+a profile key in either file. A profile's settings override both files, but
+not flags given on the command line.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := "run"
+		if len(args) == 1 {
+			name = args[0]
+		}
+		target, _, err := cmd.Root().Find([]string{name})
+		if err != nil || target == cmd.Root() {
+			return fmt.Errorf("unknown command %q", name)
+		}
+
+		layers, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		profile, _ := cmd.Flags().GetString("profile")
+		settings, err := effectiveConfig(layers, cmd.Root(), profile)
+		if err != nil {
+			return err
+		}
+		if len(layers) == 0 {
+			fmt.Println("# No config files; showing defaults.")
+		}
+		for _, layer := range layers {
+			fmt.Printf("# Reading %s\n", layer.path)
+		}
+		if names := profileNames(layers); len(names) > 0 {
+			fmt.Printf("# Profiles: %s\n", strings.Join(names, ", "))
+		}
+
+		var flags []*pflag.Flag
+		seen := map[string]bool{"help": true}
+		collect := func(f *pflag.Flag) {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				flags = append(flags, f)
+			}
+		}
+		target.Flags().VisitAll(collect)
+		target.InheritedFlags().VisitAll(collect)
+		sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+		for _, f := range flags {
+			value, source := f.DefValue, "default"
+			if s, ok := settings[f.Name]; ok {
+				value, source = configDisplay(s.value), s.source
+			}
+			fmt.Printf("%-20s = %-24s # %s\n", f.Name, value, source)
+		}
+		return nil
+	},
+}
+
+// configDisplay renders a config value the way the flag would show it.
+func configDisplay(v any) string {
+	if list, ok := v.([]any); ok {
+		return "[" + strings.Join(configStrings(list), ",") + "]"
+	}
+	return configString(v)
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// loadDatabases reads the named connections for db_query from
+// ~/.tanrenai/databases.toml, one table per database:
+//
+//	[app]
+//	dsn = "postgres://readonly@localhost/app"
+//
+// A missing file means no connections.
+func loadDatabases() (map[string]string, error) {
+	dir := configDir()
+	if dir == "" {
+		return nil, nil
+	}
+	path := filepath.Join(dir, "databases.toml")
+	var file map[string]struct {
+		DSN string `toml:"dsn"`
+	}
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	databases := make(map[string]string, len(file))
+	for name, db := range file {
+		if db.DSN == "" {
+			return nil, fmt.Errorf("%s: database %q has no dsn", path, name)
+		}
+		databases[name] = db.DSN
+	}
+	return databases, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate documentation for tanrenai's commands",
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man [dir]",
+	Short: "Write a man page for every command",
+	Long: `Write a man page for every command to dir (default ./man): tanrenai.1,
+tanrenai-run.1, tanrenai-models-list.1 and so on. Install them with, e.g.:
+
+  tanrenai docs man /usr/local/share/man/man1`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "man"
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		root := cmd.Root()
+		root.DisableAutoGenTag = true // keep the pages the same from run to run
+		header := &doc.GenManHeader{
+			Title:   "TANRENAI",
+			Section: "1",
+			Source:  "tanrenai " + Version,
+			Manual:  "Tanrenai Manual",
+		}
+		if err := doc.GenManTree(root, header, dir); err != nil {
+			return fmt.Errorf("failed to write man pages: %w", err)
+		}
+		fmt.Printf("Wrote man pages to %s\n", dir)
+		return nil
+	},
+}
+
+func init() {
+	docsCmd.AddCommand(docsManCmd)
+	rootCmd.AddCommand(docsCmd)
+}
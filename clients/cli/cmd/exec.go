@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/agent"
+	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/reasoning"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <task>",
+	Short: "Run a single turn without the TUI and print the answer",
+	Long: `Run a single turn without the TUI, for scripts and CI.
+
+Progress (iterations, tool calls and their results) is written to stderr and
+only the final answer to stdout. Input piped to stdin is attached to the task
+as a fenced block.
+
+Exit codes:
+  0    the agent answered
+  1    the model could not be loaded, a request failed, or there was no answer
+  2    the agent reached --max-iterations
+  3    the agent got stuck repeating failing tool calls
+  130  interrupted
+
+  tanrenai exec --model qwen3-8b --agent "fix the failing test"
+  cat error.log | tanrenai exec --model qwen3-8b "explain this"`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task := args[0]
+		model, _ := cmd.Flags().GetString("model")
+		systemPrompt, _ := cmd.Flags().GetString("system")
+		systemFile, _ := cmd.Flags().GetString("system-file")
+		agentMode, _ := cmd.Flags().GetBool("agent")
+		ctxSize, _ := cmd.Flags().GetInt("ctx-size")
+		responseBudget, _ := cmd.Flags().GetInt("response-budget")
+		contextFiles, _ := cmd.Flags().GetStringSlice("context-file")
+		memoryEnabled, _ := cmd.Flags().GetBool("memory")
+		maxIterations, _ := cmd.Flags().GetInt("max-iterations")
+		toolOpts, err := toolFlags(cmd)
+		if err != nil {
+			return err
+		}
+		logDir, _ := cmd.Flags().GetString("log-dir")
+
+		if model == "" {
+			return fmt.Errorf("specify a model with --model")
+		}
+		sampling, err := samplingFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(task) == "" {
+			return fmt.Errorf("task is empty")
+		}
+
+		piped, err := readPipedStdin()
+		if err != nil {
+			return err
+		}
+		if piped != nil {
+			task = piped.attach(task)
+			fmt.Fprintln(os.Stderr, piped.summary())
+		}
+
+		if systemFile != "" {
+			data, err := os.ReadFile(systemFile)
+			if err != nil {
+				return fmt.Errorf("failed to read system file: %w", err)
+			}
+			systemPrompt = string(data)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		client := backendClient(cmd)
+		router, err := newRouter(client)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Loading model %s...\n", model)
+		var toolFormat string
+		if ctxSize, toolFormat, err = loadModel(ctx, cmd, os.Stderr, router, model); err != nil {
+			return err
+		}
+
+		estimator := chatctx.NewTokenEstimator()
+		calibrateEstimator(router, model, estimator)
+
+		mgr := chatctx.NewManager(chatctx.Config{
+			CtxSize:        ctxSize,
+			ResponseBudget: responseBudget,
+		}, estimator)
+
+		for _, path := range contextFiles {
+			if err := loadContextFile(os.Stderr, mgr, path); err != nil {
+				return fmt.Errorf("failed to load context file %s: %w", path, err)
+			}
+		}
+		enableEnvironment(cmd, mgr)
+		loadInstructions(os.Stderr, mgr)
+
+		if memoryEnabled && agentMode {
+			if _, err := client.MemoryCount(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: memory not available: %v\n", err)
+				memoryEnabled = false
+			}
+		}
+
+		setSystemPrompt(mgr, systemPrompt, agentMode, memoryEnabled)
+
+		tlog, err := openTranscript(os.Stderr, logDir, model, agentMode)
+		if err != nil {
+			return err
+		}
+		defer tlog.Close()
+
+		cacheID := newCacheID()
+		router.Server.SetSession(cacheID)
+		completeFn, streamFn := completionFuncs(router, tlog, func() string { return model }, cacheID, sampling)
+		summarizeFn := summaryCompletion(router, tlog, summaryModelFlag(cmd, os.Stderr, router, model), cacheID, completeFn)
+
+		mgr.SetSummaryProgress(func(messages, tokens int) {
+			fmt.Fprintf(os.Stderr, "-- summarizing %d messages (%s tokens) --\n", messages, formatTokenCount(tokens))
+		})
+		mgr.Append(api.Message{Role: "user", Content: task})
+		if !agentMode {
+			return execChat(ctx, streamFn, mgr.Messages(), os.Stdout)
+		}
+
+		registry := agentRegistry(client, mgr, streamFn, toolOpts, memoryEnabled)
+		mgr.SetToolsBudget(toolsBudget(router, model, toolFormat, registry, estimator))
+		cfg := agent.StreamingConfig{
+			Config: agent.Config{
+				MaxIterations:  maxIterations,
+				Tools:          registry,
+				MaxTokens:      mgr.PromptBudget(),
+				TokenEstimator: mgr.Estimator(),
+				Compact: func(ctx context.Context, msgs []api.Message, start int) ([]api.Message, error) {
+					fmt.Fprintln(os.Stderr, "-- compacting turn --")
+					return mgr.CompactTurn(ctx, summarizeFn, msgs, start)
+				},
+				RouteTools: toolOpts.route,
+				Hooks: agent.Hooks{
+					OnToolsRouted: func(names []string) {
+						fmt.Fprintf(os.Stderr, "-- tools: %s --\n", strings.Join(names, ", "))
+					},
+					OnToolCall: func(call api.ToolCall) {
+						tlog.ToolCall(call)
+						fmt.Fprintf(os.Stderr, "  > %s %s\n", call.Function.Name, oneLine(call.Function.Arguments, 200))
+					},
+					OnToolResult: func(call api.ToolCall, result string) {
+						tlog.ToolResult(call, result)
+						fmt.Fprintf(os.Stderr, "    %s\n", oneLine(result, 120))
+					},
+					OnRetry: func(attempt, maxAttempts int, err error) {
+						fmt.Fprintf(os.Stderr, "  %v; retrying (%d/%d)\n", err, attempt, maxAttempts)
+					},
+				},
+				Retry: agent.DefaultRetry,
+			},
+			OnIterationStart: func(iteration, _ int, _ []api.Message, _ *api.Usage) {
+				fmt.Fprintf(os.Stderr, "-- iteration %d --\n", iteration)
+			},
+		}
+
+		msgs := mgr.Messages()
+		result, err := agent.RunStreaming(ctx, streamFn, msgs, cfg)
+		fmt.Fprintf(os.Stderr, "-- %s: %s; %s --\n", result.StopReason, runSummary(result), turnStats(result))
+		if err != nil {
+			return &exitCodeError{code: stopExitCode(result.StopReason), err: err}
+		}
+		answer := finalAnswer(result.NewMessages(len(msgs)))
+		if answer == "" {
+			return errors.New("agent finished without an answer")
+		}
+		fmt.Fprintln(os.Stdout, answer)
+		return nil
+	},
+}
+
+// execChat streams a plain chat completion to w.
+func execChat(ctx context.Context, streamFn agent.StreamingCompletionFunc, msgs []api.Message, w io.Writer) error {
+	events, err := streamFn(ctx, &api.ChatCompletionRequest{Messages: msgs, Stream: true})
+	if err != nil {
+		return err
+	}
+	// Reasoning is left out: the output is the reply alone.
+	var splitter reasoning.Splitter
+	wrote := false
+	for ev := range events {
+		if ev.Err != nil {
+			return ev.Err
+		}
+		if ev.Done {
+			break
+		}
+		if ev.Chunk == nil {
+			continue
+		}
+		for _, choice := range ev.Chunk.Choices {
+			if text, _ := splitter.Split(choice.Delta.Content); text != "" {
+				fmt.Fprint(w, text)
+				wrote = true
+			}
+		}
+	}
+	if text, _ := splitter.Flush(); text != "" {
+		fmt.Fprint(w, text)
+		wrote = true
+	}
+	if !wrote {
+		return errors.New("model returned an empty response")
+	}
+	fmt.Fprintln(w)
+	return ctx.Err()
+}
+
+// finalAnswer returns the last assistant reply among the messages an agent
+// turn added.
+func finalAnswer(msgs []api.Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "assistant" && strings.TrimSpace(msgs[i].Content) != "" {
+			return strings.TrimSpace(msgs[i].Content)
+		}
+	}
+	return ""
+}
+
+// stopExitCode is the exit code exec uses for an agent run that failed
+// with reason.
+func stopExitCode(reason agent.StopReason) int {
+	switch reason {
+	case agent.StopMaxIterations:
+		return 2
+	case agent.StopStuck:
+		return 3
+	case agent.StopCancelled:
+		return 130
+	}
+	return 1
+}
+
+// runSummary describes an agent run in one line, e.g. "3 iterations, 5 tool
+// calls (1 failed), 2.4k tokens, 12.3s".
+func runSummary(res *agent.RunResult) string {
+	parts := []string{fmt.Sprintf("%d iteration%s", res.Iterations, plural(res.Iterations))}
+	if res.ToolCalls > 0 {
+		calls := fmt.Sprintf("%d tool call%s", res.ToolCalls, plural(res.ToolCalls))
+		if res.ToolErrors > 0 {
+			calls += fmt.Sprintf(" (%d failed)", res.ToolErrors)
+		}
+		parts = append(parts, calls)
+	}
+	if res.Compactions > 0 {
+		parts = append(parts, fmt.Sprintf("%d compaction%s", res.Compactions, plural(res.Compactions)))
+	}
+	if res.Usage.TotalTokens > 0 {
+		parts = append(parts, formatTokenCount(res.Usage.TotalTokens)+" tokens")
+	}
+	parts = append(parts, res.Duration.Round(100*time.Millisecond).String())
+	return strings.Join(parts, ", ")
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// oneLine collapses whitespace in s and truncates it to max bytes.
+func oneLine(s string, max int) string {
+	return truncate(strings.Join(strings.Fields(s), " "), max)
+}
+
+func init() {
+	execCmd.Flags().String("model", "", "model to run the task with")
+	execCmd.RegisterFlagCompletionFunc("model", completeModels)
+	addRunFlags(execCmd)
+	rootCmd.AddCommand(execCmd)
+}
@@ -0,0 +1,725 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// datasetFilterUsage lists the options parseDatasetFilter accepts.
+const datasetFilterUsage = `Filters:
+  --min-len <n>         Drop replies shorter than n characters
+  --no-errors           Drop replies that look like errors or refusals
+  --since <date>        Only memories from this date (YYYY-MM-DD or RFC 3339)
+  --until <date>        Only memories up to this date
+  --dedupe              Keep one of identical turns
+  --rating <any|up>     Keep thumbs-down memories too, or only thumbs-up ones
+  --max <n>             Keep the n newest samples`
+
+// runConfigUsage lists the options parseRunConfig accepts. The defaults
+// suit a 7B-class model; small models want more epochs and a higher
+// learning rate, large ones a smaller batch and cutoff to fit in memory.
+const runConfigUsage = `Hyperparameters (prepare and train; unset ones keep the GPU server's defaults):
+  --epochs <n>          Passes over the dataset (1-50, default 3)
+  --lr <rate>           Learning rate (1e-7 to 1e-2, default 2e-4)
+  --rank <n>            LoRA rank (1-256, default 16)
+  --alpha <n>           LoRA alpha (1-512, default 32; usually 1-2x rank)
+  --batch <n>           Batch size (1-64, default 2)
+  --cutoff <n>          Cutoff length in tokens (128-32768, default 2048)
+  --beta <b>            DPO beta (0.01-1, default 0.1)`
+
+// runConfigRanges are the values parseRunConfig accepts for each option,
+// and the config field it sets.
+var runConfigRanges = map[string]struct {
+	field    string
+	min, max float64
+	integer  bool
+}{
+	"--epochs": {"epochs", 1, 50, true},
+	"--lr":     {"learning_rate", 1e-7, 1e-2, false},
+	"--rank":   {"lora_rank", 1, 256, true},
+	"--alpha":  {"lora_alpha", 1, 512, true},
+	"--batch":  {"batch_size", 1, 64, true},
+	"--cutoff": {"max_seq_length", 128, 32768, true},
+	"--beta":   {"dpo_beta", 0.01, 1, false},
+}
+
+// parseRunConfig reads the hyperparameter options in args, checking their
+// ranges, and returns them as a partial run config (nil when there are
+// none) and the remaining arguments.
+func parseRunConfig(args []string) (json.RawMessage, []string, error) {
+	cfg := make(map[string]any)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		r, ok := runConfigRanges[args[i]]
+		if !ok {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, nil, fmt.Errorf("%s needs a value", args[i])
+		}
+		v, err := strconv.ParseFloat(args[i+1], 64)
+		if err != nil || v < r.min || v > r.max || (r.integer && v != float64(int(v))) {
+			kind := "a number"
+			if r.integer {
+				kind = "a whole number"
+			}
+			return nil, nil, fmt.Errorf("%s must be %s from %g to %g", args[i], kind, r.min, r.max)
+		}
+		if r.integer {
+			cfg[r.field] = int(v)
+		} else {
+			cfg[r.field] = v
+		}
+		i++
+	}
+	if len(cfg) == 0 {
+		return nil, rest, nil
+	}
+	data, err := json.Marshal(cfg)
+	return data, rest, err
+}
+
+// parseDatasetFilter reads the filter options in args and returns the
+// filter and the remaining arguments. Without --rating, thumbs-down
+// memories are dropped.
+func parseDatasetFilter(args []string) (api.DatasetFilter, []string, error) {
+	var f api.DatasetFilter
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		switch arg {
+		case "--no-errors":
+			f.ExcludeErrors = true
+		case "--dedupe":
+			f.Dedupe = true
+		case "--min-len", "--max":
+			v, err := value()
+			if err != nil {
+				return f, nil, err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return f, nil, fmt.Errorf("%s must be a non-negative number", arg)
+			}
+			if arg == "--min-len" {
+				f.MinAssistantLen = n
+			} else {
+				f.MaxSamples = n
+			}
+		case "--since", "--until":
+			v, err := value()
+			if err != nil {
+				return f, nil, err
+			}
+			t, err := parseFilterDate(v, arg == "--until")
+			if err != nil {
+				return f, nil, err
+			}
+			if arg == "--since" {
+				f.Since = &t
+			} else {
+				f.Until = &t
+			}
+		case "--rating":
+			v, err := value()
+			if err != nil {
+				return f, nil, err
+			}
+			switch v {
+			case "any":
+				f.MinRating = -1
+			case "up":
+				f.MinRating = 1
+			default:
+				return f, nil, fmt.Errorf("--rating must be any or up")
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return f, nil, fmt.Errorf("unknown option %s", arg)
+			}
+			rest = append(rest, arg)
+		}
+	}
+	return f, rest, nil
+}
+
+// parseFilterDate parses an RFC 3339 time or a local date. A date given as
+// the end of a range covers the whole day.
+func parseFilterDate(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC 3339", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// handleFinetuneCommand runs /finetune dataset stats|show, prepare, train,
+// status, deploy and import.
+func handleFinetuneCommand(w io.Writer, input string, client *apiclient.Client) {
+	usage := func() {
+		fmt.Fprintln(w, "Usage:")
+		fmt.Fprintln(w, "  /finetune dataset stats [filters]        - Summarize the dataset memory would give")
+		fmt.Fprintln(w, "  /finetune dataset show [n] [filters]     - Show its newest n memories (default 10)")
+		fmt.Fprintln(w, "  /finetune prepare <base-model> [filters] - Create a training run from it")
+		fmt.Fprintln(w, "  /finetune prepare <base-model> --pairs <file>")
+		fmt.Fprintln(w, "                                           - Create a DPO run from preference pairs (JSONL)")
+		fmt.Fprintln(w, "  /finetune prepare <base-model> --tools [filters]")
+		fmt.Fprintln(w, "                                           - Train tool calling on recorded agent trajectories")
+		fmt.Fprintln(w, "                                             (--record-trajectories); --since, --until, --max apply")
+		fmt.Fprintln(w, "  /finetune train <run-id>                 - Start training a prepared run")
+		fmt.Fprintln(w, "  /finetune status <run-id> [--follow]     - Show a run's progress, or watch it live")
+		fmt.Fprintln(w, "  /finetune deploy <run-id> [--name <model>] [--checks <file>]")
+		fmt.Fprintln(w, "                                           - Merge a trained run into <model>@vN, load it and")
+		fmt.Fprintln(w, "                                             smoke-test it, rolling back if it fails")
+		fmt.Fprintln(w, "  /finetune import <run-id> <file> [--format openai|sharegpt]")
+		fmt.Fprintln(w, "                                           - Add an OpenAI-messages or ShareGPT dataset to a run")
+		fmt.Fprintln(w, "  /finetune list                           - List the training runs and the disk they use")
+		fmt.Fprintln(w, "  /finetune gc [--keep <n>] [--max-gb <size>] [--dry-run]")
+		fmt.Fprintln(w, "                                           - Remove old runs, their checkpoints and merged models,")
+		fmt.Fprintln(w, "                                             keeping the newest n and live models (default: the")
+		fmt.Fprintln(w, "                                             server's retention policy)")
+		fmt.Fprintln(w, datasetFilterUsage)
+		fmt.Fprintln(w, runConfigUsage)
+	}
+	args := strings.Fields(input)[1:]
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	switch {
+	case args[0] == "dataset" && len(args) > 1 && (args[1] == "stats" || args[1] == "show"):
+		filter, rest, err := parseDatasetFilter(args[2:])
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		req := api.DatasetRequest{DatasetFilter: filter}
+		if args[1] == "show" {
+			req.Preview = 10
+			if len(rest) > 0 {
+				if req.Preview, err = strconv.Atoi(rest[0]); err != nil || req.Preview <= 0 {
+					fmt.Fprintln(w, "The number of memories to show must be a positive number.")
+					return
+				}
+			}
+		}
+		resp, err := client.FinetuneDataset(context.Background(), req)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		printDatasetStats(w, resp.Stats)
+		for _, e := range resp.Preview {
+			rating := ""
+			switch {
+			case e.Rating > 0:
+				rating = " [+]"
+			case e.Rating < 0:
+				rating = " [-]"
+			}
+			fmt.Fprintf(w, "\n[%s] %s%s\n", e.ID[:8], e.Timestamp.Format("2006-01-02 15:04"), rating)
+			fmt.Fprintf(w, "  User:      %s\n", truncate(strings.Join(strings.Fields(e.UserMsg), " "), 200))
+			fmt.Fprintf(w, "  Assistant: %s\n", truncate(strings.Join(strings.Fields(e.AssistMsg), " "), 200))
+		}
+
+	case args[0] == "prepare":
+		cfg, rest, err := parseRunConfig(args[1:])
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		req := api.FinetunePrepareRequest{Config: cfg}
+		if i := slices.Index(rest, "--tools"); i >= 0 {
+			req.Mode = api.DatasetModeTools
+			rest = slices.Delete(rest, i, i+1)
+		}
+		if len(rest) == 3 && rest[1] == "--pairs" && req.Mode == "" {
+			if req.Pairs, err = readPreferencePairs(rest[2]); err != nil {
+				fmt.Fprintf(w, "Error: %v\n", err)
+				return
+			}
+			req.BaseModel = rest[0]
+		} else {
+			filter, rest, err := parseDatasetFilter(rest)
+			if err != nil {
+				fmt.Fprintf(w, "Error: %v\n", err)
+				return
+			}
+			if len(rest) != 1 {
+				fmt.Fprintln(w, "Usage: /finetune prepare <base-model> [--tools] [filters | --pairs <file>] [hyperparameters]")
+				return
+			}
+			req.BaseModel, req.Filter = rest[0], &filter
+		}
+		run, err := client.FinetunePrepare(context.Background(), req)
+		if err != nil {
+			fmt.Fprintf(w, "Error preparing run: %v\n", err)
+			return
+		}
+		switch {
+		case len(req.Pairs) > 0:
+			fmt.Fprintf(w, "Prepared DPO run %s: %d pairs for %s\n", run.ID, run.Metrics.SamplesUsed, run.BaseModel)
+		case req.Mode == api.DatasetModeTools:
+			fmt.Fprintf(w, "Prepared run %s: %d agent trajectories of %s\n", run.ID, run.Metrics.SamplesUsed, run.BaseModel)
+		default:
+			fmt.Fprintf(w, "Prepared run %s: %d samples of %s\n", run.ID, run.Metrics.SamplesUsed, run.BaseModel)
+		}
+
+	case args[0] == "status":
+		runID, follow := parseFollow(input)
+		if runID == "" {
+			fmt.Fprintln(w, "Usage: /finetune status <run-id> [--follow]")
+			return
+		}
+		if follow {
+			followTraining(w, client, runID)
+			return
+		}
+		run, err := client.FinetuneStatus(context.Background(), runID)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		printFinetuneRun(w, run)
+
+	case args[0] == "deploy":
+		req := api.FinetuneReleaseRequest{}
+		var rest []string
+		for i := 1; i < len(args); i++ {
+			switch {
+			case args[i] == "--name" && i+1 < len(args):
+				i++
+				req.Name = args[i]
+			case args[i] == "--checks" && i+1 < len(args):
+				i++
+				checks, err := readSmokeChecks(args[i])
+				if err != nil {
+					fmt.Fprintf(w, "Error: %v\n", err)
+					return
+				}
+				req.Checks = checks
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		if len(rest) != 1 {
+			fmt.Fprintln(w, "Usage: /finetune deploy <run-id> [--name <model>] [--checks <file>]")
+			return
+		}
+		req.RunID = rest[0]
+		fmt.Fprintln(w, "Merging, loading and checking the new model; this can take a while...")
+		run, err := client.FinetuneRelease(context.Background(), req)
+		if err != nil {
+			fmt.Fprintf(w, "Error deploying run: %v\n", err)
+			return
+		}
+		printRelease(w, run.Release)
+
+	case args[0] == "train":
+		cfg, rest, err := parseRunConfig(args[1:])
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		if len(rest) != 1 {
+			fmt.Fprintln(w, "Usage: /finetune train <run-id> [hyperparameters]")
+			return
+		}
+		if err := client.FinetuneTrain(context.Background(), api.FinetuneTrainRequest{RunID: rest[0], Config: cfg}); err != nil {
+			fmt.Fprintf(w, "Error starting training: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "Training run %s\n", rest[0])
+
+	case args[0] == "import":
+		var format string
+		var rest []string
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--format" && i+1 < len(args) {
+				i++
+				format = args[i]
+				continue
+			}
+			rest = append(rest, args[i])
+		}
+		if len(rest) != 2 {
+			fmt.Fprintln(w, "Usage: /finetune import <run-id> <file> [--format openai|sharegpt]")
+			return
+		}
+		data, err := os.ReadFile(rest[1])
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		resp, err := client.FinetuneImport(context.Background(), api.FinetuneImportRequest{
+			RunID:   rest[0],
+			Content: string(data),
+			Name:    filepath.Base(rest[1]),
+			Format:  format,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "Error importing dataset: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "Imported %d samples into run %s as %s", resp.Imported, rest[0], resp.Source)
+		if resp.Skipped > 0 {
+			fmt.Fprintf(w, " (%d skipped)", resp.Skipped)
+		}
+		fmt.Fprintln(w)
+
+	case args[0] == "list":
+		runs, err := client.FinetuneRuns(context.Background())
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		printFinetuneRuns(w, runs)
+
+	case args[0] == "gc":
+		req, err := parseGCRequest(args[1:])
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			fmt.Fprintln(w, "Usage: /finetune gc [--keep <n>] [--max-gb <size>] [--dry-run]")
+			return
+		}
+		resp, err := client.FinetuneGC(context.Background(), req)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return
+		}
+		printGCResult(w, resp)
+
+	default:
+		usage()
+	}
+}
+
+// readPreferencePairs reads a JSONL file of api.PreferencePair, one per
+// line, recording the file and line as each pair's source.
+func readPreferencePairs(path string) ([]api.PreferencePair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []api.PreferencePair
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var p api.PreferencePair
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		if p.Source == "" {
+			p.Source, p.Ref = "import:"+filepath.Base(path), fmt.Sprintf("line %d", i+1)
+		}
+		pairs = append(pairs, p)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no preference pairs in %s", path)
+	}
+	return pairs, nil
+}
+
+// parseFollow returns the run named by /finetune status <run-id>
+// [--follow], or "" for other input, and whether to follow it.
+func parseFollow(input string) (string, bool) {
+	var runID string
+	follow := false
+	fields := strings.Fields(input)
+	if len(fields) < 3 || fields[0] != "/finetune" || fields[1] != "status" {
+		return "", false
+	}
+	for _, f := range fields[2:] {
+		switch {
+		case f == "--follow" || f == "-f":
+			follow = true
+		case runID == "":
+			runID = f
+		default:
+			return "", false
+		}
+	}
+	return runID, follow
+}
+
+// followTraining shows a run's progress on one line, redrawn as it trains,
+// until it stops or the user presses Ctrl-C.
+func followTraining(w io.Writer, client *apiclient.Client, runID string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var losses []api.LossPoint
+	width := 0
+	last, err := client.FinetuneFollow(ctx, runID, func(p api.FinetuneProgress) {
+		losses = append(losses, p.Losses...)
+		line := trainingProgressLine(p, losses, 30)
+		// Pad over the rest of a longer previous line.
+		fmt.Fprintf(w, "\r%-*s", width, line)
+		width = max(width, len([]rune(line)))
+	})
+	if width > 0 {
+		fmt.Fprintln(w)
+	}
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintln(w, "Stopped following; the run keeps training.")
+	case err != nil:
+		fmt.Fprintf(w, "Error: %v\n", err)
+	default:
+		fmt.Fprintln(w, trainingOutcome(last))
+	}
+}
+
+// parseGCRequest reads the retention options of /finetune gc.
+func parseGCRequest(args []string) (api.FinetuneGCRequest, error) {
+	var req api.FinetuneGCRequest
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--dry-run":
+			req.DryRun = true
+		case args[i] == "--keep" && i+1 < len(args):
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return req, fmt.Errorf("--keep must be a positive number, got %q", args[i])
+			}
+			req.KeepLast = n
+		case args[i] == "--max-gb" && i+1 < len(args):
+			i++
+			gb, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || gb <= 0 {
+				return req, fmt.Errorf("--max-gb must be a positive size, got %q", args[i])
+			}
+			req.MaxBytes = int64(gb * (1 << 30))
+		default:
+			return req, fmt.Errorf("unknown option %q", args[i])
+		}
+	}
+	return req, nil
+}
+
+// printFinetuneRuns writes the training runs with their disk usage for
+// /finetune list.
+func printFinetuneRuns(w io.Writer, runs []api.FinetuneRun) {
+	if len(runs) == 0 {
+		fmt.Fprintln(w, "No training runs.")
+		return
+	}
+	var total int64
+	for _, run := range runs {
+		total += run.DiskBytes
+		model := run.BaseModel
+		if run.Release != nil {
+			model = run.Release.Alias
+			if run.Release.Live {
+				model += " (live)"
+			}
+		}
+		fmt.Fprintf(w, "  %-14s %-9s %s  %9s  %s\n", run.ID, run.Status, run.CreatedAt.Local().Format("2006-01-02 15:04"), formatBytes(run.DiskBytes), model)
+	}
+	fmt.Fprintf(w, "%d run%s, %s on disk\n", len(runs), plural(len(runs)), formatBytes(total))
+}
+
+// printGCResult writes what /finetune gc removed.
+func printGCResult(w io.Writer, res *api.FinetuneGCResponse) {
+	verb := "Removed"
+	if res.DryRun {
+		verb = "Would remove"
+	}
+	if len(res.Removed) == 0 {
+		fmt.Fprintf(w, "Nothing to remove: %d run%s use %s.\n", res.Kept, plural(res.Kept), formatBytes(res.Used))
+	} else {
+		for _, r := range res.Removed {
+			fmt.Fprintf(w, "  %-14s %-9s %9s  (%s)\n", r.ID, r.Status, formatBytes(r.DiskBytes), strings.ReplaceAll(r.Reason, "_", " "))
+		}
+		fmt.Fprintf(w, "%s %d run%s, freeing %s; %d run%s use %s.\n", verb, len(res.Removed), plural(len(res.Removed)),
+			formatBytes(res.Freed), res.Kept, plural(res.Kept), formatBytes(res.Used))
+	}
+	if res.OverQuota {
+		fmt.Fprintln(w, "Still over the disk quota: the remaining runs are training or their models are in use.")
+	}
+}
+
+// printFinetuneRun writes the state of a training run for /finetune status.
+func printFinetuneRun(w io.Writer, run *api.FinetuneRun) {
+	m := run.Metrics
+	fmt.Fprintf(w, "Run %s (%s): %s\n", run.ID, run.BaseModel, run.Status)
+	if m.MaxSteps > 0 {
+		fmt.Fprintf(w, "  Step:     %d/%d (%d%%)\n", m.Step, m.MaxSteps, int(m.Progress*100))
+	}
+	if m.TrainLoss > 0 {
+		fmt.Fprintf(w, "  Loss:     %.4f\n", m.TrainLoss)
+	}
+	if len(m.LossHistory) > 1 {
+		fmt.Fprintf(w, "  Curve:    %s\n", lossSparkline(m.LossHistory, 40))
+	}
+	if m.Duration != "" {
+		fmt.Fprintf(w, "  Elapsed:  %s\n", m.Duration)
+	}
+	if m.SamplesUsed > 0 {
+		fmt.Fprintf(w, "  Samples:  %d\n", m.SamplesUsed)
+	}
+	if run.Error != "" {
+		fmt.Fprintf(w, "  Error:    %s\n", run.Error)
+	}
+}
+
+// trainingProgressLine renders a followed run's progress in one line, e.g.
+// "[██████░░░░] 60% step 180/300 loss 0.912 ▇▅▄▃▃▂ ETA 2m10s".
+func trainingProgressLine(p api.FinetuneProgress, losses []api.LossPoint, barWidth int) string {
+	if p.Status == api.FinetunePending {
+		return "waiting for training to start"
+	}
+	filled := min(max(int(p.Progress*float64(barWidth)), 0), barWidth)
+	line := fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), int(p.Progress*100))
+	if p.MaxSteps > 0 {
+		line += fmt.Sprintf(" step %d/%d", p.Step, p.MaxSteps)
+	}
+	if p.Loss > 0 {
+		line += fmt.Sprintf(" loss %.3f", p.Loss)
+	}
+	if len(losses) > 1 {
+		line += " " + lossSparkline(losses, 12)
+	}
+	if p.ETA > 0 {
+		line += " ETA " + (time.Duration(p.ETA * float64(time.Second))).Round(time.Second).String()
+	}
+	return line
+}
+
+// sparkLevels are the bars of lossSparkline, lowest first.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// lossSparkline draws the last width points of a loss curve, scaled
+// between their lowest and highest loss.
+func lossSparkline(points []api.LossPoint, width int) string {
+	if len(points) > width {
+		points = points[len(points)-width:]
+	}
+	lo, hi := points[0].Loss, points[0].Loss
+	for _, pt := range points {
+		lo, hi = min(lo, pt.Loss), max(hi, pt.Loss)
+	}
+	var b strings.Builder
+	for _, pt := range points {
+		level := 0
+		if hi > lo {
+			level = int((pt.Loss - lo) / (hi - lo) * float64(len(sparkLevels)-1))
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// trainingOutcome describes how a followed run ended.
+func trainingOutcome(p *api.FinetuneProgress) string {
+	switch p.Status {
+	case api.FinetuneFailed:
+		return fmt.Sprintf("Training failed: %s", p.Error)
+	case api.FinetunePending, api.FinetuneTraining:
+		return fmt.Sprintf("Run %s is %s.", p.RunID, p.Status)
+	}
+	out := fmt.Sprintf("Training finished in %s", (time.Duration(p.Elapsed * float64(time.Second))).Round(time.Second))
+	if p.Loss > 0 {
+		out += fmt.Sprintf(", loss %.4f", p.Loss)
+	}
+	return out + "."
+}
+
+// readSmokeChecks reads the checks for /finetune deploy: a JSON array of
+// {"prompt", "expected"}.
+func readSmokeChecks(path string) ([]api.SmokeCheck, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var checks []api.SmokeCheck
+	if err := json.Unmarshal(data, &checks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return checks, nil
+}
+
+// printRelease writes the outcome of /finetune deploy.
+func printRelease(w io.Writer, rel *api.FinetuneRelease) {
+	if rel == nil {
+		fmt.Fprintln(w, "The server did not report a release.")
+		return
+	}
+	for _, c := range rel.Checks {
+		mark := "pass"
+		if !c.Passed {
+			mark = "FAIL"
+		}
+		fmt.Fprintf(w, "  [%s] %s\n         %s\n", mark, truncate(c.Prompt, 80), truncate(strings.Join(strings.Fields(c.Answer), " "), 160))
+	}
+	switch {
+	case rel.Live:
+		fmt.Fprintf(w, "%s is live as %s (%s).", rel.Alias, rel.Family, rel.Model)
+		if rel.Previous != "" {
+			fmt.Fprintf(w, " Previous version: %s.", rel.Previous)
+		}
+		fmt.Fprintf(w, " Use /model use %s to chat with it.\n", rel.Family)
+	case rel.RolledBack:
+		fmt.Fprintf(w, "Deploy of %s failed: %s\n", rel.Alias, rel.Error)
+		if rel.Previous != "" {
+			fmt.Fprintf(w, "Rolled back: %s is %s again.\n", rel.Family, rel.Previous)
+		} else {
+			fmt.Fprintf(w, "Rolled back: %s is unset again.\n", rel.Family)
+		}
+	default:
+		fmt.Fprintf(w, "%s: %s\n", rel.Alias, rel.Error)
+	}
+}
+
+// printDatasetStats writes the summary of /finetune dataset.
+func printDatasetStats(w io.Writer, s api.DatasetStats) {
+	fmt.Fprintf(w, "Dataset: %d of %d memories\n", s.Samples, s.Memories)
+	if s.Samples > 0 {
+		if s.Oldest != nil && s.Newest != nil {
+			fmt.Fprintf(w, "  Dates:     %s to %s\n", s.Oldest.Format("2006-01-02"), s.Newest.Format("2006-01-02"))
+		}
+		fmt.Fprintf(w, "  Avg chars: %d user, %d assistant\n", s.AvgUserChars, s.AvgAssistantChars)
+		fmt.Fprintf(w, "  Rated:     %d up, %d down\n", s.RatedUp, s.RatedDown)
+	}
+	if len(s.Dropped) > 0 {
+		var parts []string
+		for _, r := range []struct{ reason, label string }{
+			{"short", "too short"}, {"error", "error-like"}, {"date", "out of range"},
+			{"duplicate", "duplicates"}, {"rating", "rated down"}, {"max_samples", "over --max"},
+		} {
+			if n := s.Dropped[r.reason]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", n, r.label))
+			}
+		}
+		fmt.Fprintf(w, "  Dropped:   %s\n", strings.Join(parts, ", "))
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxInputHistory caps how many submitted prompts are kept on disk.
+const maxInputHistory = 1000
+
+// inputHistory holds previously submitted prompts, persisted one per line to
+// ~/.tanrenai/history so they can be recalled across sessions.
+type inputHistory struct {
+	path    string
+	entries []string // oldest first
+	pos     int      // index being browsed; len(entries) when not browsing
+	draft   string   // text that was in the input before browsing started
+}
+
+func inputHistoryPath() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
+
+// loadInputHistory reads the history file. A missing or unreadable file
+// yields an empty history; persistence is best-effort.
+func loadInputHistory(path string) *inputHistory {
+	h := &inputHistory{path: path}
+	if path != "" {
+		if f, err := os.Open(path); err == nil {
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				if line := scanner.Text(); line != "" {
+					h.entries = append(h.entries, line)
+				}
+			}
+			f.Close()
+		}
+		if len(h.entries) > maxInputHistory {
+			h.entries = h.entries[len(h.entries)-maxInputHistory:]
+			h.rewrite()
+		}
+	}
+	h.pos = len(h.entries)
+	return h
+}
+
+// add records a submitted prompt and resets browsing. Consecutive duplicates
+// are stored once.
+func (h *inputHistory) add(text string) {
+	defer h.reset()
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", " ")
+	if text == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == text) {
+		return
+	}
+	h.entries = append(h.entries, text)
+	if len(h.entries) > maxInputHistory {
+		h.entries = h.entries[len(h.entries)-maxInputHistory:]
+		h.rewrite()
+		return
+	}
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(text + "\n")
+}
+
+// rewrite replaces the history file with the in-memory entries.
+func (h *inputHistory) rewrite() {
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600); err != nil {
+		return
+	}
+	os.Rename(tmp, h.path)
+}
+
+// reset stops browsing so the next prev starts from the newest entry.
+func (h *inputHistory) reset() {
+	h.pos = len(h.entries)
+	h.draft = ""
+}
+
+// prev returns the entry before the one being browsed. current is saved as
+// the draft when browsing starts so next can restore it.
+func (h *inputHistory) prev(current string) (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	if h.pos == len(h.entries) {
+		h.draft = current
+	}
+	h.pos--
+	return h.entries[h.pos], true
+}
+
+// next returns the entry after the one being browsed, or the saved draft
+// once browsing moves past the newest entry.
+func (h *inputHistory) next() (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.entries) {
+		return h.draft, true
+	}
+	return h.entries[h.pos], true
+}
+
+// search returns the skip-th most recent distinct entry that fuzzily matches
+// query (its characters appear in order, case-insensitively).
+func (h *inputHistory) search(query string, skip int) (string, bool) {
+	query = strings.ToLower(query)
+	seen := make(map[string]bool)
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		if seen[e] || !fuzzyMatch(query, strings.ToLower(e)) {
+			continue
+		}
+		seen[e] = true
+		if skip == 0 {
+			return e, true
+		}
+		skip--
+	}
+	return "", false
+}
+
+func fuzzyMatch(query, s string) bool {
+	for _, r := range query {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
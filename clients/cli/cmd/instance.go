@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+var instanceCmd = &cobra.Command{
+	Use:   "instance",
+	Short: "Manage the backend's GPU instance",
+}
+
+var instanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the GPU instance is running and when it auto-stops",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, err := apiclient.New(serverURL).InstanceStatus(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get instance status: %w", err)
+		}
+		printInstanceStatus(status)
+		return nil
+	},
+}
+
+var instanceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the GPU instance and wait until it serves requests",
+	Long: `Start the GPU instance and wait until it serves requests. Unlike a chat
+request, this starts the instance even when the backend's GPU budget is
+used up.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := apiclient.New(serverURL).InstanceStart(cmd.Context()); err != nil {
+			return fmt.Errorf("failed to start instance: %w", err)
+		}
+		fmt.Println("GPU instance is running.")
+		return nil
+	},
+}
+
+var instanceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the GPU instance",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := apiclient.New(serverURL).InstanceStop(cmd.Context()); err != nil {
+			return fmt.Errorf("failed to stop instance: %w", err)
+		}
+		fmt.Println("GPU instance stopped.")
+		return nil
+	},
+}
+
+var instanceAutostopCmd = &cobra.Command{
+	Use:   "autostop",
+	Short: "Set how long the GPU instance may be idle before it is stopped",
+	Long: `Set how long the GPU instance may go without chat completions before the
+backend stops it, e.g. "tanrenai instance autostop --after 30m". Connected
+clients are warned a few minutes before. An instance training a fine-tune
+is never idle.
+
+The setting lasts until the backend restarts; its --idle-timeout flag sets
+the one it starts with. Without flags, the current setting is shown.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := apiclient.New(serverURL)
+		after, _ := cmd.Flags().GetString("after")
+		if off, _ := cmd.Flags().GetBool("off"); off {
+			after = "0"
+		}
+		if after == "" {
+			status, err := client.InstanceStatus(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to get instance status: %w", err)
+			}
+			printInstanceStatus(status)
+			return nil
+		}
+		if d, err := time.ParseDuration(after); err != nil || d < 0 {
+			return fmt.Errorf("invalid --after %q: want a duration such as 30m", after)
+		}
+
+		status, err := client.InstanceAutostop(cmd.Context(), after)
+		if err != nil {
+			return fmt.Errorf("failed to set auto-stop: %w", err)
+		}
+		if status.AutoStopAfter == "" {
+			fmt.Println("Auto-stop is off.")
+		} else {
+			fmt.Printf("The GPU instance stops after %s idle.\n", formatAutoStop(status.AutoStopAfter))
+		}
+		return nil
+	},
+}
+
+var instanceCostsCmd = &cobra.Command{
+	Use:   "costs",
+	Short: "Show what the GPU instance has cost per day and against its budget",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		costs, err := apiclient.New(serverURL).InstanceCosts(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get instance costs: %w", err)
+		}
+		if costs.Provider == "local" {
+			fmt.Println("The backend uses a local GPU server, which is not billed.")
+			return nil
+		}
+
+		state := "stopped"
+		if costs.Running {
+			state = "running"
+		}
+		fmt.Printf("Price:      $%.3f/hr (%s)\n", costs.RatePerHour, state)
+		fmt.Printf("Today:      %s\n", formatSpend(costs.Today, costs.DailyBudget))
+		fmt.Printf("This week:  %s\n", formatSpend(costs.Week, costs.WeeklyBudget))
+		if len(costs.Days) == 0 {
+			return nil
+		}
+		fmt.Printf("\n  %-10s %7s %9s\n", "DATE", "HOURS", "COST")
+		for _, d := range costs.Days {
+			fmt.Printf("  %-10s %7.1f %9s\n", d.Date, d.Hours, fmt.Sprintf("$%.2f", d.Dollars))
+		}
+		return nil
+	},
+}
+
+// formatSpend renders spend against budget, e.g. "$4.20 of $10.00 (42%)".
+func formatSpend(spent, budget float64) string {
+	if budget <= 0 {
+		return fmt.Sprintf("$%.2f", spent)
+	}
+	return fmt.Sprintf("$%.2f of $%.2f (%.0f%%)", spent, budget, 100*spent/budget)
+}
+
+func printInstanceStatus(status *api.InstanceStatus) {
+	fmt.Printf("Status:     %s\n", status.Status)
+	if status.GPUURL != "" {
+		fmt.Printf("GPU URL:    %s\n", status.GPUURL)
+	}
+	if t := status.Tunnel; t != nil {
+		switch {
+		case t.Connected && t.Since != nil:
+			fmt.Printf("Tunnel:     %s -> %s via %s, up since %s\n", t.Local, t.Remote, t.Endpoint, t.Since.Local().Format("15:04"))
+		case t.LastError != "":
+			fmt.Printf("Tunnel:     down (%s)\n", t.LastError)
+		default:
+			fmt.Println("Tunnel:     not connected yet")
+		}
+	}
+	if status.IdleSince != nil && status.Status == "running" {
+		fmt.Printf("Idle for:   %s\n", time.Since(*status.IdleSince).Round(time.Second))
+	}
+	switch {
+	case status.AutoStopAfter == "":
+		fmt.Println("Auto-stop:  off")
+	case status.StopAt != nil:
+		fmt.Printf("Auto-stop:  after %s idle (at %s)\n", formatAutoStop(status.AutoStopAfter), status.StopAt.Local().Format("15:04"))
+	default:
+		fmt.Printf("Auto-stop:  after %s idle\n", formatAutoStop(status.AutoStopAfter))
+	}
+}
+
+// formatAutoStop drops the zero units of a duration string, e.g. "30m0s"
+// becomes "30m" and "1h0m0s" "1h".
+func formatAutoStop(s string) string {
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func init() {
+	instanceAutostopCmd.Flags().String("after", "", "idle time before the instance is stopped, e.g. 30m or 2h")
+	instanceAutostopCmd.Flags().Bool("off", false, "never stop the instance when idle")
+	instanceCmd.AddCommand(instanceStatusCmd, instanceStartCmd, instanceStopCmd, instanceAutostopCmd, instanceCostsCmd)
+	rootCmd.AddCommand(instanceCmd)
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
@@ -22,10 +24,17 @@ var listCmd = &cobra.Command{
 			return nil
 		}
 
-		fmt.Printf("%-40s %10s\n", "NAME", "OWNER")
-		fmt.Println("─────────────────────────────────────────────────────")
+		fmt.Printf("%-40s %-20s %8s %10s\n", "NAME", "ALIASES", "CTX", "OWNER")
+		fmt.Println("───────────────────────────────────────────────────────────────────────────────────")
 		for _, m := range resp.Data {
-			fmt.Printf("%-40s %10s\n", m.ID, m.OwnedBy)
+			aliases, ctx := "", "-"
+			if meta := m.Metadata; meta != nil {
+				aliases = strings.Join(meta.Aliases, ",")
+				if meta.CtxSize > 0 {
+					ctx = strconv.Itoa(meta.CtxSize)
+				}
+			}
+			fmt.Printf("%-40s %-20s %8s %10s\n", m.ID, aliases, ctx, m.OwnedBy)
 		}
 
 		return nil
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var memoryCmd = &cobra.Command{
+	Use:   "memory",
+	Short: "Manage stored memories",
+}
+
+var memoryExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export all memories, including embeddings, to a JSONL file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := exportMemories(cmd.Context(), apiclient.New(serverURL), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to export memories: %w", err)
+		}
+		fmt.Printf("Exported %d memories to %s\n", n, args[0])
+		return nil
+	},
+}
+
+var memoryImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import memories from a JSONL file written by export",
+	Long: `Import memories from a JSONL file written by "tanrenai memory export".
+
+Entries keep their IDs, so importing the same file twice replaces rather than
+duplicates them. Stored embeddings are reused; records without one are
+embedded on import.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := importMemories(cmd.Context(), apiclient.New(serverURL), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to import memories: %w", err)
+		}
+		fmt.Printf("Imported %d memories from %s\n", n, args[0])
+		return nil
+	},
+}
+
+// exportMemories writes the export to a temp file next to path and renames
+// it into place, so a failed export never clobbers an earlier backup.
+func exportMemories(ctx context.Context, client *apiclient.Client, path string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := client.MemoryExport(ctx, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func importMemories(ctx context.Context, client *apiclient.Client, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return client.MemoryImport(ctx, f)
+}
+
+func init() {
+	memoryCmd.AddCommand(memoryExportCmd)
+	memoryCmd.AddCommand(memoryImportCmd)
+	rootCmd.AddCommand(memoryCmd)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/spf13/cobra"
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Manage downloaded models",
+}
+
+var modelsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List downloaded models with their size and quantization",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := apiclient.New(serverURL).LocalModels(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list models: %w", err)
+		}
+
+		if len(resp.Models) == 0 {
+			fmt.Println("No models downloaded.")
+			return nil
+		}
+
+		fmt.Printf("  %-40s %10s %6s %-8s %8s  %s\n", "NAME", "SIZE", "PARAMS", "QUANT", "CTX", "MODIFIED")
+		for _, m := range resp.Models {
+			marker := "  "
+			if m.Loaded {
+				marker = "* "
+			}
+			ctx := "-"
+			if m.ContextLength > 0 {
+				ctx = strconv.Itoa(m.ContextLength)
+			}
+			fmt.Printf("%s%-40s %10s %6s %-8s %8s  %s\n", marker, m.Name, formatBytes(m.Size),
+				orDash(m.SizeLabel), orDash(m.Quant), ctx, time.Unix(m.ModifiedAt, 0).Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var modelsInspectCmd = &cobra.Command{
+	Use:               "inspect <name>",
+	Short:             "Show a model's metadata, context length and chat template",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: firstArg(completeLocalModels),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := apiclient.New(serverURL).InspectModel(cmd.Context(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to inspect model: %w", err)
+		}
+
+		fmt.Printf("Name:           %s\n", m.Name)
+		fmt.Printf("Size:           %s\n", formatBytes(m.Size))
+		fmt.Printf("Loaded:         %t\n", m.Loaded)
+		if m.Error != "" {
+			fmt.Printf("GGUF metadata:  unreadable (%s)\n", m.Error)
+			return nil
+		}
+		fmt.Printf("Architecture:   %s\n", orDash(m.Architecture))
+		fmt.Printf("Parameters:     %s\n", orDash(m.SizeLabel))
+		fmt.Printf("Quantization:   %s\n", orDash(m.Quant))
+		fmt.Printf("Context length: %d\n", m.ContextLength)
+		if meta := m.Metadata; meta != nil {
+			if len(meta.Aliases) > 0 {
+				fmt.Printf("Aliases:        %s\n", strings.Join(meta.Aliases, ", "))
+			}
+			if meta.CtxSize > 0 {
+				fmt.Printf("Loaded with:    %d tokens of context\n", meta.CtxSize)
+			}
+			if meta.ChatTemplate != "" {
+				fmt.Printf("Template used:  %s (from models.json)\n", meta.ChatTemplate)
+			}
+			if meta.MMProj != "" {
+				fmt.Printf("Projector:      %s (accepts images)\n", meta.MMProj)
+			}
+		}
+		if m.ChatTemplate == "" {
+			fmt.Println("Chat template:  none embedded")
+		} else {
+			fmt.Printf("Chat template:\n%s\n", m.ChatTemplate)
+		}
+		return nil
+	},
+}
+
+var modelsRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "Delete downloaded models",
+	Long: `Delete downloaded models. Names must match the file name exactly (the
+.gguf extension is optional); aliases and partial names are not accepted.
+The loaded model cannot be deleted.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeLocalModels,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := apiclient.New(serverURL)
+		for _, name := range args {
+			if err := client.DeleteModel(cmd.Context(), name); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", name, err)
+			}
+			fmt.Printf("Deleted %s\n", name)
+		}
+		return nil
+	},
+}
+
+var modelsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete interrupted downloads",
+	Long: `Delete interrupted downloads, which otherwise stay in the models directory
+so that pulling again can resume them. Downloads written to in the last
+minute are kept, as they may still be running.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := apiclient.New(serverURL).PrunePartialDownloads(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to prune downloads: %w", err)
+		}
+
+		if len(resp.Partials) == 0 {
+			fmt.Println("No partial downloads to remove.")
+			return nil
+		}
+		var total int64
+		for _, p := range resp.Partials {
+			fmt.Printf("Removed %s (%s)\n", p.Name, formatBytes(p.Size))
+			total += p.Size
+		}
+		fmt.Printf("Freed %s\n", formatBytes(total))
+		return nil
+	},
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	modelsCmd.AddCommand(modelsListCmd, modelsInspectCmd, modelsRmCmd, modelsPruneCmd)
+	rootCmd.AddCommand(modelsCmd)
+}
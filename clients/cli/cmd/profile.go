@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// switchProfile applies a config profile mid-session, or lists the
+// profiles when name is empty. The model, system prompt, sampling
+// parameters and theme change at once; settings fixed at startup, such as
+// agent mode or the context size, are listed for a restart.
+func (t *tuiApp) switchProfile(name string) {
+	layers, err := loadConfig()
+	if err != nil {
+		t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+		t.addLine("")
+		return
+	}
+	if name == "" {
+		names := profileNames(layers)
+		if len(names) == 0 {
+			t.addLine("[gray::-]  No profiles. Define them under profiles: in ~/.config/tanrenai/config.yaml.[-:-:-]")
+		} else {
+			t.addLine(fmt.Sprintf("[gray::-]  Profiles: %s (/profile <name> to switch)[-:-:-]", strings.Join(names, ", ")))
+		}
+		t.addLine("")
+		return
+	}
+	if t.processing || t.switchingModel {
+		t.addLine("[gray::-]  Wait for the current turn or model switch to finish before switching profiles.[-:-:-]")
+		t.addLine("")
+		return
+	}
+	settings, err := effectiveConfig(layers, rootCmd, name)
+	if err != nil {
+		t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+		t.addLine("")
+		return
+	}
+
+	var applied, restart []string
+	keys := make([]string, 0, len(settings))
+	for key, s := range settings {
+		if s.profile {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := settings[key].value
+		switch key {
+		case "system", "system-file":
+			prompt := configString(value)
+			if key == "system-file" {
+				data, err := os.ReadFile(prompt)
+				if err != nil {
+					t.addLine(fmt.Sprintf("[gray::-]  Failed to read system file: %s[-:-:-]", tview.Escape(err.Error())))
+					continue
+				}
+				prompt = string(data)
+			}
+			setSystemPrompt(t.mgr, prompt, t.agentMode, t.memoryEnabled)
+		case "set":
+			assignments := []string{configString(value)}
+			if list, ok := value.([]any); ok {
+				assignments = configStrings(list)
+			}
+			if err := t.sampling.setAll(assignments); err != nil {
+				t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+				continue
+			}
+		case "theme":
+			th, err := loadTheme(configString(value))
+			if err != nil {
+				t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+				continue
+			}
+			t.setTheme(th)
+		case "model":
+			// Loaded below, once the rest is in place.
+		default:
+			restart = append(restart, key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+
+	if len(applied) > 0 {
+		t.addLine(fmt.Sprintf("[gray::-]  Profile %s: applied %s.[-:-:-]", tview.Escape(name), strings.Join(applied, ", ")))
+	}
+	if len(restart) > 0 {
+		t.addLine(fmt.Sprintf("[gray::-]  %s take effect on restart: tanrenai run --profile %s[-:-:-]", strings.Join(restart, ", "), tview.Escape(name)))
+	}
+	if s, ok := settings["model"]; ok && s.profile && configString(s.value) != t.currentModel() {
+		model := configString(s.value)
+		t.switchingModel = true
+		t.addLine(fmt.Sprintf("[gray::-]  Loading %s...[-:-:-]", tview.Escape(model)))
+		go t.switchModel(model)
+		return
+	}
+	t.addLine("")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+)
+
+// defaultKeyEnv is the variable each provider's API key is read from when
+// an alias does not name one.
+var defaultKeyEnv = map[string]string{
+	apiclient.ProviderOpenAI:     "OPENAI_API_KEY",
+	apiclient.ProviderOpenRouter: "OPENROUTER_API_KEY",
+	apiclient.ProviderAnthropic:  "ANTHROPIC_API_KEY",
+}
+
+// loadRemotes reads the model aliases served by cloud providers from
+// ~/.tanrenai/providers.toml, one table per alias:
+//
+//	[claude]
+//	provider = "anthropic"
+//	model = "claude-sonnet-4-5"
+//	ctx_size = 200000
+//
+//	[local-vllm]
+//	provider = "openai"
+//	base_url = "http://gpu-box:8000/v1"
+//	model = "Qwen/Qwen2.5-Coder-32B-Instruct"
+//
+// The API key is api_key, or else read from api_key_env, which defaults to
+// the provider's usual variable (OPENAI_API_KEY and so on). An alias with
+// its own base_url and neither sends no key. A missing file means no
+// aliases.
+func loadRemotes() (map[string]apiclient.Remote, error) {
+	dir := configDir()
+	if dir == "" {
+		return nil, nil
+	}
+	path := filepath.Join(dir, "providers.toml")
+	var file map[string]struct {
+		Provider  string `toml:"provider"`
+		Model     string `toml:"model"`
+		BaseURL   string `toml:"base_url"`
+		APIKey    string `toml:"api_key"`
+		APIKeyEnv string `toml:"api_key_env"`
+		CtxSize   int    `toml:"ctx_size"`
+	}
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	remotes := make(map[string]apiclient.Remote, len(file))
+	for alias, m := range file {
+		if m.Model == "" {
+			return nil, fmt.Errorf("%s: model %q has no model", path, alias)
+		}
+		keyEnv := m.APIKeyEnv
+		if keyEnv == "" && m.BaseURL == "" {
+			keyEnv = defaultKeyEnv[m.Provider]
+		}
+		key := m.APIKey
+		if key == "" && keyEnv != "" {
+			key = os.Getenv(keyEnv)
+		}
+		provider, err := apiclient.NewProvider(m.Provider, m.BaseURL, key, keyEnv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: model %q: %w", path, alias, err)
+		}
+		remotes[alias] = apiclient.Remote{Provider: provider, Name: m.Provider, Model: m.Model, CtxSize: m.CtxSize}
+	}
+	return remotes, nil
+}
+
+// newRouter returns a router that sends requests for the providers.toml
+// aliases to their providers and the rest to client's server.
+func newRouter(client *apiclient.Client) (*apiclient.Router, error) {
+	remotes, err := loadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	return &apiclient.Router{Server: client, Remotes: remotes}, nil
+}
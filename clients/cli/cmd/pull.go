@@ -1,67 +1,75 @@
 package cmd
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 	"github.com/spf13/cobra"
 )
 
 var pullCmd = &cobra.Command{
-	Use:   "pull <url>",
+	Use:   "pull <hf-repo-or-url>",
 	Short: "Download a GGUF model via the backend",
-	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		url := args[0]
+	Long: `Download a GGUF model on the GPU server.
 
-		body, _ := json.Marshal(map[string]string{"url": url})
-		resp, err := http.Post(serverURL+"/api/pull", "application/json", bytes.NewReader(body))
-		if err != nil {
-			return fmt.Errorf("failed to pull model: %w", err)
+The argument is either a direct URL or a HuggingFace reference of the form
+<owner>/<repo>/<file>.gguf. Interrupted downloads resume where they left off
+when pulled again, and files are verified against the HuggingFace SHA256.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if partial, _ := cmd.Flags().GetBool("partial"); partial {
+			return cobra.NoArgs(cmd, args)
 		}
-		defer resp.Body.Close()
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := apiclient.New(serverURL)
 
-		if resp.StatusCode != http.StatusOK {
-			respBody, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		if partial, _ := cmd.Flags().GetBool("partial"); partial {
+			return listPartialDownloads(cmd, client)
 		}
 
-		// Read SSE progress events
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if !strings.HasPrefix(line, "data: ") {
-				continue
-			}
-			data := line[len("data: "):]
-
-			var evt map[string]any
-			if err := json.Unmarshal([]byte(data), &evt); err != nil {
-				continue
-			}
-
-			switch evt["status"] {
+		result, err := client.PullModel(cmd.Context(), args[0], func(evt api.PullProgress) {
+			switch evt.Status {
+			case "resolving":
+				fmt.Print("Resolving...")
 			case "downloading":
-				percent := int(evt["percent"].(float64))
-				downloaded := int64(evt["downloaded"].(float64))
-				total := int64(evt["total"].(float64))
-				printProgress(percent, downloaded, total)
-			case "downloaded":
-				fmt.Printf("\rDownloaded: %s\n", evt["path"])
-			case "error":
-				return fmt.Errorf("download failed: %s", evt["error"])
+				printProgress(evt.Percent, evt.Downloaded, evt.Total)
 			}
+		})
+		if err != nil {
+			fmt.Println()
+			return fmt.Errorf("failed to pull model: %w", err)
 		}
 
-		return scanner.Err()
+		fmt.Printf("\rDownloaded: %s\n", result.Path)
+		if result.SHA256 != "" {
+			fmt.Printf("Verified sha256 %s\n", result.SHA256)
+		}
+		return nil
 	},
 }
 
+func listPartialDownloads(cmd *cobra.Command, client *apiclient.Client) error {
+	resp, err := client.PartialDownloads(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to list partial downloads: %w", err)
+	}
+
+	if len(resp.Partials) == 0 {
+		fmt.Println("No partial downloads.")
+		return nil
+	}
+
+	fmt.Printf("%-50s %12s  %s\n", "NAME", "DOWNLOADED", "LAST WRITE")
+	for _, p := range resp.Partials {
+		fmt.Printf("%-50s %12s  %s\n", p.Name, formatBytes(p.Size), time.Unix(p.ModifiedAt, 0).Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
 func printProgress(percent int, downloaded, total int64) {
 	const barWidth = 30
 	filled := barWidth * percent / 100
@@ -85,5 +93,6 @@ func formatBytes(b int64) string {
 }
 
 func init() {
+	pullCmd.Flags().Bool("partial", false, "List interrupted downloads instead of pulling")
 	rootCmd.AddCommand(pullCmd)
 }
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
@@ -13,14 +15,54 @@ var rootCmd = &cobra.Command{
 	Use:   "tanrenai",
 	Short: "Tanrenai — AI assistant client",
 	Long:  "Tanrenai (鍛錬AI) client — connects to the tanrenai backend for LLM inference, memory, and tool use.",
+	// Settings from the config files fill in flags not given on the
+	// command line.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := applyConfig(cmd)
+		if err != nil {
+			cmd.SilenceUsage = true // a config file problem, not a usage one
+		}
+		return err
+	},
 }
 
 func Execute() error {
 	return rootCmd.Execute()
 }
 
+// exitCodeError carries the process exit code for err.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// ExitCode returns the exit code for an error returned by Execute: the one
+// a command chose for it, or 1.
+func ExitCode(err error) int {
+	var coded *exitCodeError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return 1
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&serverURL, "server-url", "http://127.0.0.1:8080", "backend server URL")
+	rootCmd.PersistentFlags().String("profile", "", "settings profile from the config files (see tanrenai config)")
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+}
+
+// configDir returns ~/.tanrenai, where the client keeps prompt history and
+// custom themes, or "" if the home directory is unknown.
+func configDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".tanrenai")
 }
 
 func exitError(msg string, args ...any) {
@@ -2,15 +2,21 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ThatCatDev/tanrenai/client/internal/agent"
 	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
 	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
 	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/internal/transcript"
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -22,18 +28,35 @@ Important rules:
 2. Call tools directly — do not narrate what you plan to do. Just do it.
 3. Use multiple tool calls in one response when possible.
 4. Complete multi-step tasks automatically without stopping for confirmation.
-5. Only use shell_exec when no other tool fits. Prefer file_read, list_dir, grep_search, find_files.
+5. Only use shell_exec when no other tool fits. Prefer file_read, list_dir, grep_search, find_files, and git_status, git_diff, git_log and git_blame for repository history and changes. Use code_symbols to outline a large source file before reading it, and http_request rather than curl to call an API. When commands depend on an earlier cd, export or virtualenv activation, run them with shell_session, which keeps that state between calls. Start servers and watchers with process_start rather than shell_exec, which would block until it times out.
 6. Use "." for the current directory. Never use placeholder names.
 7. If a tool call fails, try different arguments. Never repeat an identical failing call.
-8. To edit existing files, use patch_file. Only use file_write for creating new files or when you need to rewrite the entire file. Always use file_read first to understand what you're changing.
-9. After making changes, verify your work by building or running tests with shell_exec.`
+8. To edit existing files, use patch_file, or multi_edit for several related changes that must land together; apply_unified_diff accepts a unified diff if you prefer that format. Only use file_write for creating new files or when you need to rewrite the entire file. Always use file_read first to understand what you're changing.
+9. After making changes, verify your work: run the tests with run_tests, or build with shell_exec.
+10. For broad investigations that split into independent parts, use spawn_agent to research them in parallel.`
+
+// memoryToolsPrompt is appended to the agent prompt when memory tools are
+// registered.
+const memoryToolsPrompt = `
+11. When you learn a durable fact worth keeping across sessions (a decision, a convention, where something lives, a user preference), save it with memory_store. Check memory_search before asking the user something they may have told you before, and use memory_forget to remove memories that turn out to be wrong.`
+
+// initPrompt is the request /init sends: survey the repository and write
+// the project instructions that later sessions load.
+const initPrompt = `Survey this repository and write a TANRENAI.md file in the current directory with instructions for an assistant working on it. Look at the README, the build and dependency files, the directory layout and a few representative source and test files first. Cover what the project is, the exact commands to build, test and lint it, how the code is organized, and the conventions to follow (naming, error handling, where tests go, anything unusual). Keep it short and specific to this repository, and leave out generic advice. If TANRENAI.md already exists, read it and improve it rather than starting over.`
 
 var runCmd = &cobra.Command{
-	Use:   "run <model>",
-	Short: "Load a model and start an interactive chat",
-	Args:  cobra.ExactArgs(1),
+	Use:               "run [model]",
+	Short:             "Load a model and start an interactive chat",
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: firstArg(completeModels),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		model := args[0]
+		model, _ := cmd.Flags().GetString("model")
+		if len(args) == 1 {
+			model = args[0]
+		}
+		if model == "" {
+			return fmt.Errorf("specify a model, as an argument or with --model or a profile")
+		}
 		systemPrompt, _ := cmd.Flags().GetString("system")
 		systemFile, _ := cmd.Flags().GetString("system-file")
 		agentMode, _ := cmd.Flags().GetBool("agent")
@@ -42,6 +65,17 @@ var runCmd = &cobra.Command{
 		contextFiles, _ := cmd.Flags().GetStringSlice("context-file")
 		memoryEnabled, _ := cmd.Flags().GetBool("memory")
 		maxIterations, _ := cmd.Flags().GetInt("max-iterations")
+		toolOpts, err := toolFlags(cmd)
+		if err != nil {
+			return err
+		}
+		themeName, _ := cmd.Flags().GetString("theme")
+		logDir, _ := cmd.Flags().GetString("log-dir")
+		sessionID, _ := cmd.Flags().GetString("session")
+		memoryScope, _ := cmd.Flags().GetString("memory-scope")
+		if err := checkMemoryScope(memoryScope, sessionID); err != nil {
+			return err
+		}
 
 		if systemFile != "" {
 			data, err := os.ReadFile(systemFile)
@@ -51,32 +85,44 @@ var runCmd = &cobra.Command{
 			systemPrompt = string(data)
 		}
 
-		client := apiclient.New(serverURL)
+		th, err := loadTheme(themeName)
+		if err != nil {
+			return err
+		}
+		sampling, err := samplingFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		client := backendClient(cmd)
+		router, err := newRouter(client)
+		if err != nil {
+			return err
+		}
 
 		fmt.Printf("Loading model %s...\n", model)
-		if err := client.LoadModel(cmd.Context(), model); err != nil {
-			return fmt.Errorf("failed to load model (is the backend running?): %w", err)
+		var toolFormat string
+		if ctxSize, toolFormat, err = loadModel(cmd.Context(), cmd, os.Stdout, router, model); err != nil {
+			return err
 		}
 
 		estimator := chatctx.NewTokenEstimator()
-		calibrateEstimator(client, estimator)
-
-		toolsBudget := 0
-		if agentMode {
-			toolsBudget = 4000
-		}
+		calibrateEstimator(router, model, estimator)
 
 		mgr := chatctx.NewManager(chatctx.Config{
 			CtxSize:        ctxSize,
 			ResponseBudget: responseBudget,
-			ToolsBudget:    toolsBudget,
+			// Agent sessions edit files and run commands worth tracking.
+			StructuredSummary: agentMode,
 		}, estimator)
 
 		for _, path := range contextFiles {
-			if err := loadContextFile(mgr, path); err != nil {
+			if err := loadContextFile(os.Stdout, mgr, path); err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to load context file %s: %v\n", path, err)
 			}
 		}
+		enableEnvironment(cmd, mgr)
+		loadInstructions(os.Stdout, mgr)
 
 		if memoryEnabled && agentMode {
 			count, err := client.MemoryCount(cmd.Context())
@@ -88,7 +134,18 @@ var runCmd = &cobra.Command{
 			}
 		}
 
-		return startTUI(client, model, systemPrompt, mgr, agentMode, memoryEnabled, maxIterations)
+		var session *sessionLink
+		if sessionID != "" {
+			if session, err = attachSession(cmd.Context(), os.Stdout, client, mgr, sessionID, model, memoryScope); err != nil {
+				return err
+			}
+		}
+
+		summary, err := summaryFlags(cmd, router, model)
+		if err != nil {
+			return err
+		}
+		return startTUI(router, model, summary, toolFormat, systemPrompt, mgr, agentMode, memoryEnabled, maxIterations, toolOpts, th, logDir, session, sampling)
 	},
 }
 
@@ -105,6 +162,17 @@ var chatCmd = &cobra.Command{
 		contextFiles, _ := cmd.Flags().GetStringSlice("context-file")
 		memoryEnabled, _ := cmd.Flags().GetBool("memory")
 		maxIterations, _ := cmd.Flags().GetInt("max-iterations")
+		toolOpts, err := toolFlags(cmd)
+		if err != nil {
+			return err
+		}
+		themeName, _ := cmd.Flags().GetString("theme")
+		logDir, _ := cmd.Flags().GetString("log-dir")
+		sessionID, _ := cmd.Flags().GetString("session")
+		memoryScope, _ := cmd.Flags().GetString("memory-scope")
+		if err := checkMemoryScope(memoryScope, sessionID); err != nil {
+			return err
+		}
 
 		if model == "" {
 			return fmt.Errorf("specify a model with --model")
@@ -118,27 +186,52 @@ var chatCmd = &cobra.Command{
 			systemPrompt = string(data)
 		}
 
-		client := apiclient.New(serverURL)
-
-		estimator := chatctx.NewTokenEstimator()
-		calibrateEstimator(client, estimator)
+		th, err := loadTheme(themeName)
+		if err != nil {
+			return err
+		}
+		sampling, err := samplingFlags(cmd)
+		if err != nil {
+			return err
+		}
 
-		toolsBudget := 0
-		if agentMode {
-			toolsBudget = 4000
+		client := backendClient(cmd)
+		router, err := newRouter(client)
+		if err != nil {
+			return err
+		}
+		var toolFormat string
+		if remote, ok := router.Remote(model); ok {
+			if remote.CtxSize > 0 && !cmd.Flags().Changed("ctx-size") {
+				ctxSize = remote.CtxSize
+			}
+		} else if info := loadedModelInfo(cmd.Context(), client, model); info != nil {
+			if info.CtxSize > 0 && !cmd.Flags().Changed("ctx-size") {
+				ctxSize = info.CtxSize
+			}
+			toolFormat = info.ToolFormat
+			if agentMode && !slices.Contains(info.Features, api.FeatureTools) {
+				fmt.Fprintf(os.Stderr, "Warning: %s's chat template does not describe tools; agent mode may not work\n", model)
+			}
 		}
 
+		estimator := chatctx.NewTokenEstimator()
+		calibrateEstimator(router, model, estimator)
+
 		mgr := chatctx.NewManager(chatctx.Config{
 			CtxSize:        ctxSize,
 			ResponseBudget: responseBudget,
-			ToolsBudget:    toolsBudget,
+			// Agent sessions edit files and run commands worth tracking.
+			StructuredSummary: agentMode,
 		}, estimator)
 
 		for _, path := range contextFiles {
-			if err := loadContextFile(mgr, path); err != nil {
+			if err := loadContextFile(os.Stdout, mgr, path); err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: failed to load context file %s: %v\n", path, err)
 			}
 		}
+		enableEnvironment(cmd, mgr)
+		loadInstructions(os.Stdout, mgr)
 
 		if memoryEnabled && agentMode {
 			count, err := client.MemoryCount(cmd.Context())
@@ -150,13 +243,86 @@ var chatCmd = &cobra.Command{
 			}
 		}
 
-		return startTUI(client, model, systemPrompt, mgr, agentMode, memoryEnabled, maxIterations)
+		var session *sessionLink
+		if sessionID != "" {
+			if session, err = attachSession(cmd.Context(), os.Stdout, client, mgr, sessionID, model, memoryScope); err != nil {
+				return err
+			}
+		}
+
+		summary, err := summaryFlags(cmd, router, model)
+		if err != nil {
+			return err
+		}
+		return startTUI(router, model, summary, toolFormat, systemPrompt, mgr, agentMode, memoryEnabled, maxIterations, toolOpts, th, logDir, session, sampling)
 	},
 }
 
-func startTUI(client *apiclient.Client, model, systemPrompt string, mgr *chatctx.Manager, agentMode, memoryEnabled bool, maxIterations int) error {
+// startTUI runs the TUI. toolFormat is the loaded model's tool-calling
+// format, "" if unknown; agent mode reserves what its tools prompt takes.
+func startTUI(router *apiclient.Router, model string, summary summaryOptions, toolFormat, systemPrompt string, mgr *chatctx.Manager, agentMode, memoryEnabled bool, maxIterations int, toolOpts toolOptions, th theme, logDir string, session *sessionLink, sampling *samplingSettings) error {
+	setSystemPrompt(mgr, systemPrompt, agentMode, memoryEnabled)
+
+	tlog, err := openTranscript(os.Stdout, logDir, model, agentMode)
+	if err != nil {
+		return err
+	}
+	defer tlog.Close()
+
+	piped, err := readPipedStdin()
+	if err != nil {
+		return err
+	}
+	if piped != nil {
+		fmt.Println(piped.summary() + " It will be attached to your first message.")
+	}
+
+	// The closures read the model from the TUI so /model use takes effect
+	// on the next request.
+	var t *tuiApp
+	cacheID := newCacheID()
+	if session != nil {
+		cacheID = session.id
+	}
+	router.Server.SetSession(cacheID)
+	completeFn, streamFn := completionFuncs(router, tlog, func() string { return t.currentModel() }, cacheID, sampling)
+
+	var registry *tools.Registry
+	if agentMode {
+		registry = agentRegistry(router.Server, mgr, streamFn, toolOpts, memoryEnabled)
+		mgr.SetToolsBudget(toolsBudget(router, model, toolFormat, registry, mgr.Estimator()))
+	}
+
+	t = newTuiApp(router.Server, model, mgr, registry, memoryEnabled, maxIterations, agentMode, completeFn, streamFn, th, tlog)
+	t.piped = piped
+	t.sampling = sampling
+	t.summarizeFn = summaryCompletion(router, tlog, summary.model, cacheID, completeFn)
+	t.summarizeAt = summary.at
+	mgr.SetSummaryProgress(t.showSummaryProgress)
+	t.routeTools = toolOpts.route
+	if toolOpts.record {
+		if agentMode && memoryEnabled {
+			t.recordTrajectories = true
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning: --record-trajectories needs --agent and a backend with memory; not recording")
+		}
+	}
+	t.router = router
+	if session != nil {
+		t.session = session
+		t.showHistory()
+	}
+	return t.run()
+}
+
+// setSystemPrompt installs the system prompt. In agent mode the user's
+// prompt is appended to the built-in tool-use instructions.
+func setSystemPrompt(mgr *chatctx.Manager, systemPrompt string, agentMode, memoryEnabled bool) {
 	if agentMode {
 		agentSystem := defaultAgentSystemPrompt
+		if memoryEnabled {
+			agentSystem += memoryToolsPrompt
+		}
 		if systemPrompt != "" {
 			agentSystem += "\n\n" + systemPrompt
 		}
@@ -164,42 +330,237 @@ func startTUI(client *apiclient.Client, model, systemPrompt string, mgr *chatctx
 	} else if systemPrompt != "" {
 		mgr.SetSystemPrompt(systemPrompt)
 	}
+}
 
-	var registry *tools.Registry
-	if agentMode {
-		registry = tools.DefaultRegistry()
+// openTranscript starts the --log-dir transcript and reports its path to w.
+// With no log dir it returns a nil logger, which discards everything.
+func openTranscript(w io.Writer, logDir, model string, agentMode bool) (*transcript.Logger, error) {
+	if logDir == "" {
+		return nil, nil
 	}
+	tlog, err := transcript.Open(logDir)
+	if err != nil {
+		return nil, err
+	}
+	tlog.Session(model, agentMode)
+	fmt.Fprintf(w, "Writing transcript to %s\n", tlog.Path())
+	return tlog, nil
+}
 
+// completionFuncs returns the blocking and streaming completion functions.
+// Requests go to the model returned by model(), get the sampling settings
+// they leave unset and are recorded in tlog. Requests without a session
+// carry cacheID, so the GPU server keeps the conversation's prompt in one
+// cache slot.
+func completionFuncs(client apiclient.Completer, tlog *transcript.Logger, model func() string, cacheID string, sampling *samplingSettings) (agent.CompletionFunc, agent.StreamingCompletionFunc) {
 	completeFn := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
-		req.Model = model
-		return client.ChatCompletion(ctx, req)
+		req.Model = model()
+		sampling.apply(req)
+		if req.SessionID == "" {
+			req.SessionID = cacheID
+		}
+		start := time.Now()
+		id := tlog.Request(req)
+		resp, err := client.ChatCompletion(ctx, req)
+		tlog.Response(id, resp, err, start)
+		return resp, err
 	}
 
 	streamFn := func(ctx context.Context, req *api.ChatCompletionRequest) (<-chan apiclient.StreamEvent, error) {
-		req.Model = model
-		return client.StreamCompletion(ctx, req)
+		req.Model = model()
+		sampling.apply(req)
+		if req.SessionID == "" {
+			req.SessionID = cacheID
+		}
+		start := time.Now()
+		id := tlog.Request(req)
+		events, err := client.StreamCompletion(ctx, req)
+		if err != nil {
+			tlog.Response(id, nil, err, start)
+			return nil, err
+		}
+		return tlog.Stream(id, events, start), nil
 	}
+	return completeFn, streamFn
+}
 
-	t := newTuiApp(client, model, mgr, registry, memoryEnabled, maxIterations, agentMode, completeFn, streamFn)
-	return t.run()
+// summaryOptions choose how the TUI summarizes the conversation.
+type summaryOptions struct {
+	model string  // --summary-model; "" = the chat model
+	at    float64 // --summarize-at; 0 = only when the history no longer fits
+}
+
+// summaryFlags reads the TUI's summary options.
+func summaryFlags(cmd *cobra.Command, router *apiclient.Router, model string) (summaryOptions, error) {
+	opts := summaryOptions{model: summaryModelFlag(cmd, os.Stderr, router, model)}
+	opts.at, _ = cmd.Flags().GetFloat64("summarize-at")
+	if opts.at < 0 || opts.at > 1 {
+		return opts, fmt.Errorf("--summarize-at must be between 0 and 1, got %g", opts.at)
+	}
+	return opts, nil
+}
+
+// summaryCompletion returns the completion function that summarizes the
+// conversation. With a summary model it sends the summaries there, through
+// the router like the chat itself, without the --set sampling tuned for the
+// chat model; otherwise it is completeFn.
+func summaryCompletion(router *apiclient.Router, tlog *transcript.Logger, summaryModel, cacheID string, completeFn agent.CompletionFunc) chatctx.CompletionFunc {
+	if summaryModel == "" {
+		return chatctx.CompletionFunc(completeFn)
+	}
+	summarize, _ := completionFuncs(router, tlog, func() string { return summaryModel }, cacheID, nil)
+	return chatctx.CompletionFunc(summarize)
+}
+
+// summaryModelFlag returns --summary-model. The GPU server holds one model
+// at a time, so when both models are local and differ it warns on w that
+// every summary swaps the chat model out and back.
+func summaryModelFlag(cmd *cobra.Command, w io.Writer, router *apiclient.Router, model string) string {
+	summaryModel, _ := cmd.Flags().GetString("summary-model")
+	if summaryModel == "" || summaryModel == model {
+		return summaryModel
+	}
+	_, summaryRemote := router.Remote(summaryModel)
+	_, chatRemote := router.Remote(model)
+	if !summaryRemote && !chatRemote {
+		fmt.Fprintf(w, "Warning: %s and %s both run on the GPU server, which holds one model at a time; each summary will swap models\n", summaryModel, model)
+	}
+	return summaryModel
+}
+
+// newCacheID returns a random ID for a conversation's prompt cache slot.
+func newCacheID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// toolOptions are the tool settings from the command line and
+// ~/.tanrenai.
+type toolOptions struct {
+	timeout   time.Duration      // default per-call limit (0 = none)
+	readFirst bool               // refuse edits to files not read this turn
+	gitWrite  bool               // register git_commit
+	httpHosts []string           // hosts http_request may call besides localhost
+	databases map[string]string  // db_query connection names to DSNs
+	shell     *tools.ShellPolicy // nil = the shell tools run anything
+	compact   bool               // send shortened tool schemas
+	route     bool               // let the model pick each turn's tools first
+	record    bool               // save agent trajectories for fine-tuning
 }
 
-func calibrateEstimator(client *apiclient.Client, estimator *chatctx.TokenEstimator) {
+// toolFlags reads the tool options. An unreadable databases.toml is
+// reported and otherwise ignored; a bad shell policy is an error, since
+// running without it would be less safe than the user asked for.
+func toolFlags(cmd *cobra.Command) (toolOptions, error) {
+	var opts toolOptions
+	opts.timeout, _ = cmd.Flags().GetDuration("tool-timeout")
+	opts.readFirst, _ = cmd.Flags().GetBool("read-before-write")
+	opts.gitWrite, _ = cmd.Flags().GetBool("allow-git-write")
+	opts.httpHosts, _ = cmd.Flags().GetStringSlice("http-allow-host")
+	opts.compact, _ = cmd.Flags().GetBool("compact-tools")
+	opts.route, _ = cmd.Flags().GetBool("route-tools")
+	opts.record, _ = cmd.Flags().GetBool("record-trajectories")
+	databases, err := loadDatabases()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	opts.databases = databases
+
+	policyPath, _ := cmd.Flags().GetString("shell-policy")
+	opts.shell, err = loadShellPolicy(policyPath)
+	if err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// agentRegistry returns the tools available to the agent.
+func agentRegistry(client *apiclient.Client, mgr *chatctx.Manager, streamFn agent.StreamingCompletionFunc, opts toolOptions, memoryEnabled bool) *tools.Registry {
+	registry := tools.DefaultRegistry()
+	registry.SetTimeout(opts.timeout)
+	registry.SetRequireReadBeforeWrite(opts.readFirst)
+	registry.SetCompact(opts.compact)
+	registry.Register(&tools.HTTPRequestTool{AllowedHosts: opts.httpHosts})
+	registry.Register(&tools.DBQueryTool{Connections: opts.databases})
+	if opts.shell != nil {
+		registry.Replace(&tools.ShellExecTool{Policy: opts.shell})
+		registry.Replace(&tools.ShellSessionTool{Policy: opts.shell})
+		registry.Replace(&tools.ProcessStartTool{Policy: opts.shell})
+	}
+	if opts.gitWrite {
+		registry.Register(&tools.GitCommitTool{})
+	}
+	registry.Register(&agent.SpawnAgentTool{
+		Complete:       streamFn,
+		Tools:          registry,
+		TokenEstimator: mgr.Estimator(),
+	})
+	registry.SetToolTimeout("spawn_agent", agent.SpawnAgentTimeout)
+	if memoryEnabled {
+		tools.RegisterMemoryTools(registry, client)
+	}
+	return registry
+}
+
+// enableEnvironment gives mgr an environment message for the current
+// directory, unless --no-env is set.
+func enableEnvironment(cmd *cobra.Command, mgr *chatctx.Manager) {
+	if off, _ := cmd.Flags().GetBool("no-env"); off {
+		return
+	}
+	if wd, err := os.Getwd(); err == nil {
+		mgr.EnableEnvironment(wd)
+	}
+}
+
+// loadInstructions pins the TANRENAI.md files in the current directory and
+// its parents, reporting each to w.
+func loadInstructions(w io.Writer, mgr *chatctx.Manager) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for _, path := range mgr.LoadInstructions(wd) {
+		fmt.Fprintf(w, "Loaded project instructions: %s\n", path)
+	}
+}
+
+// calibrateEstimator fits the estimator to model's tokenizer. Remote
+// models keep the default ratio, since their APIs do not tokenize.
+func calibrateEstimator(router *apiclient.Router, model string, estimator *chatctx.TokenEstimator) {
+	if _, ok := router.Remote(model); ok {
+		return
+	}
 	tokenizeFn := func(text string) (int, error) {
-		return client.Tokenize(context.Background(), text)
+		return router.Server.Tokenize(context.Background(), text)
 	}
 	if err := estimator.Calibrate(tokenizeFn); err != nil {
 		fmt.Fprintf(os.Stderr, "Note: token estimation using default ratio (calibration unavailable)\n")
 	}
 }
 
-func loadContextFile(mgr *chatctx.Manager, path string) error {
+// toolsBudget measures the tokens registry's tool definitions take in the
+// prompt of model, rendered in its tool-calling format. The server's
+// tokenizer counts them; remote models, or a failed count, use the
+// estimator.
+func toolsBudget(router *apiclient.Router, model, toolFormat string, registry *tools.Registry, estimator *chatctx.TokenEstimator) int {
+	prompt := chatctx.ToolsPrompt(toolFormat, registry.APITools())
+	if _, ok := router.Remote(model); !ok {
+		if n, err := router.Server.Tokenize(context.Background(), prompt); err == nil {
+			return n
+		}
+	}
+	return estimator.Estimate(prompt)
+}
+
+func loadContextFile(w io.Writer, mgr *chatctx.Manager, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 	mgr.AddContextFile(path, string(data))
-	fmt.Printf("Loaded context file: %s (%d bytes)\n", path, len(data))
+	fmt.Fprintf(w, "Loaded context file: %s (%d bytes)\n", path, len(data))
 	return nil
 }
 
@@ -207,7 +568,7 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 	switch {
 	case input == "/clear":
 		mgr.Clear()
-		fmt.Fprintln(w, "History cleared. System prompt and context files preserved.")
+		fmt.Fprintln(w, "History cleared. System prompt, context files and pins preserved.")
 		return true
 
 	case input == "/tokens":
@@ -221,6 +582,59 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 		fmt.Fprintf(w, "  Available:      %d\n", budget.Available)
 		return true
 
+	case input == "/pin" || strings.HasPrefix(input, "/pin "):
+		arg := strings.TrimSpace(strings.TrimPrefix(input, "/pin"))
+		if arg == "list" {
+			pinned := mgr.Pinned()
+			if len(pinned) == 0 {
+				fmt.Fprintln(w, "No pinned messages.")
+				return true
+			}
+			fmt.Fprintln(w, "Pinned messages:")
+			for i, p := range pinned {
+				fmt.Fprintf(w, "  %d. [%s] %s\n", i+1, p.Role, truncate(p.Content, 80))
+			}
+			return true
+		}
+		n := 1
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n < 1 {
+				fmt.Fprintln(w, "Usage: /pin [n] (pin the n-th most recent assistant reply) | /pin list")
+				return true
+			}
+		}
+		history := mgr.History()
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Role != "assistant" || history[i].Content == "" || len(history[i].ToolCalls) > 0 {
+				continue
+			}
+			if n--; n > 0 {
+				continue
+			}
+			if err := mgr.Pin(i); err != nil {
+				fmt.Fprintf(w, "Error: %v\n", err)
+			} else {
+				fmt.Fprintf(w, "Pinned: %s\n", truncate(history[i].Content, 80))
+			}
+			return true
+		}
+		fmt.Fprintln(w, "No matching assistant reply to pin.")
+		return true
+
+	case strings.HasPrefix(input, "/unpin "):
+		n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(input, "/unpin ")))
+		if err != nil {
+			fmt.Fprintln(w, "Usage: /unpin <n> (see /pin list)")
+			return true
+		}
+		if err := mgr.Unpin(n - 1); err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "Unpinned message %d.\n", n)
+		}
+		return true
+
 	case input == "/context list":
 		files := mgr.ContextFiles()
 		if len(files) == 0 {
@@ -231,6 +645,9 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 				fmt.Fprintf(w, "  - %s\n", f)
 			}
 		}
+		for _, f := range mgr.Instructions() {
+			fmt.Fprintf(w, "Project instructions: %s\n", f)
+		}
 		return true
 
 	case input == "/context clear":
@@ -245,7 +662,7 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 			fmt.Fprintln(w, "Usage: /context add <file-path>")
 			return true
 		}
-		if err := loadContextFile(mgr, path); err != nil {
+		if err := loadContextFile(w, mgr, path); err != nil {
 			fmt.Fprintf(w, "Error: %v\n", err)
 		}
 		return true
@@ -288,8 +705,8 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 		}
 		fmt.Fprintf(w, "Search results (%d):\n", len(resp.Results))
 		for _, r := range resp.Results {
-			fmt.Fprintf(w, "  [%s] score=%.3f (sem=%.3f kw=%.3f) %s\n",
-				r.Entry.ID[:8], r.CombinedScore, r.SemanticScore, r.KeywordScore,
+			fmt.Fprintf(w, "  [%s] score=%.3f (sem=%.3f kw=%.3f rec=%.2f) %s\n",
+				r.Entry.ID[:8], r.CombinedScore, r.SemanticScore, r.KeywordScore, r.RecencyScore,
 				truncate(r.Entry.UserMsg, 70))
 		}
 		return true
@@ -323,6 +740,143 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 		fmt.Fprintf(w, "No memory found with prefix %q\n", idPrefix)
 		return true
 
+	case input == "/memory export", strings.HasPrefix(input, "/memory export "),
+		input == "/memory import", strings.HasPrefix(input, "/memory import "):
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		verb := strings.Fields(input)[1]
+		path := strings.TrimSpace(strings.TrimPrefix(input, "/memory "+verb))
+		if path == "" {
+			fmt.Fprintf(w, "Usage: /memory %s <file>\n", verb)
+			return true
+		}
+		if verb == "export" {
+			n, err := exportMemories(context.Background(), client, path)
+			if err != nil {
+				fmt.Fprintf(w, "Error exporting memories: %v\n", err)
+			} else {
+				fmt.Fprintf(w, "Exported %d memories to %s\n", n, path)
+			}
+			return true
+		}
+		n, err := importMemories(context.Background(), client, path)
+		if err != nil {
+			fmt.Fprintf(w, "Error importing memories: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "Imported %d memories from %s\n", n, path)
+		}
+		return true
+
+	case strings.HasPrefix(input, "/memory remember "):
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		fact := strings.TrimSpace(strings.TrimPrefix(input, "/memory remember "))
+		if fact == "" {
+			fmt.Fprintln(w, "Usage: /memory remember <fact>")
+			return true
+		}
+		if _, err := client.MemoryStore(context.Background(), tools.MemoryFactPrefix+fact, fact, 1); err != nil {
+			fmt.Fprintf(w, "Error saving memory: %v\n", err)
+		} else {
+			fmt.Fprintln(w, "Remembered.")
+		}
+		return true
+
+	case strings.HasPrefix(input, "/memory importance "):
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		args := strings.Fields(strings.TrimPrefix(input, "/memory importance "))
+		if len(args) != 2 {
+			fmt.Fprintln(w, "Usage: /memory importance <id-prefix> <0-1>")
+			return true
+		}
+		importance, err := strconv.ParseFloat(args[1], 32)
+		if err != nil || importance < 0 || importance > 1 {
+			fmt.Fprintln(w, "Importance must be a number between 0 and 1.")
+			return true
+		}
+		resp, err := client.MemoryList(context.Background(), 0)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return true
+		}
+		for _, e := range resp.Entries {
+			if strings.HasPrefix(e.ID, args[0]) {
+				if err := client.MemorySetImportance(context.Background(), e.ID, float32(importance)); err != nil {
+					fmt.Fprintf(w, "Error updating memory: %v\n", err)
+				} else {
+					fmt.Fprintf(w, "Set importance of %s to %.2f\n", e.ID[:8], importance)
+				}
+				return true
+			}
+		}
+		fmt.Fprintf(w, "No memory found with prefix %q\n", args[0])
+		return true
+
+	case strings.HasPrefix(input, "/memory rate "):
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		args := strings.Fields(strings.TrimPrefix(input, "/memory rate "))
+		ratings := map[string]int{"up": 1, "down": -1, "clear": 0}
+		rating, ok := 0, len(args) == 2
+		if ok {
+			rating, ok = ratings[args[1]]
+		}
+		if !ok {
+			fmt.Fprintln(w, "Usage: /memory rate <id-prefix> <up|down|clear>")
+			return true
+		}
+		resp, err := client.MemoryList(context.Background(), 0)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return true
+		}
+		for _, e := range resp.Entries {
+			if strings.HasPrefix(e.ID, args[0]) {
+				if err := client.MemorySetRating(context.Background(), e.ID, rating); err != nil {
+					fmt.Fprintf(w, "Error updating memory: %v\n", err)
+				} else {
+					fmt.Fprintf(w, "Rated %s %s\n", e.ID[:8], args[1])
+				}
+				return true
+			}
+		}
+		fmt.Fprintf(w, "No memory found with prefix %q\n", args[0])
+		return true
+
+	case input == "/finetune" || strings.HasPrefix(input, "/finetune "):
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		handleFinetuneCommand(w, input, client)
+		return true
+
+	case input == "/memory compact":
+		if !memoryEnabled {
+			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
+			return true
+		}
+		resp, err := client.MemoryCompact(context.Background(), 0)
+		if err != nil {
+			fmt.Fprintf(w, "Error compacting memories: %v\n", err)
+			return true
+		}
+		if resp.Clusters == 0 {
+			fmt.Fprintln(w, "No near-duplicate memories found.")
+		} else {
+			fmt.Fprintf(w, "Merged %d memories into %d (%d clusters).\n", resp.Removed, resp.Created, resp.Clusters)
+		}
+		return true
+
 	case input == "/memory clear":
 		if !memoryEnabled {
 			fmt.Fprintln(w, "Memory is not enabled. Use --memory flag to enable.")
@@ -338,15 +892,32 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 	case input == "/help":
 		fmt.Fprintln(w, "Commands:")
 		fmt.Fprintln(w, "  /clear                        - Clear conversation history")
-		fmt.Fprintln(w, "  /compact                      - Summarize conversation to free context")
+		fmt.Fprintln(w, "  /compact [N%] [tools]         - Summarize to free context, or N% of it; tools collapses tool results only")
 		fmt.Fprintln(w, "  /tokens                       - Show token budget breakdown")
+		fmt.Fprintln(w, "  /pin [n]                      - Pin the n-th most recent reply (default: last)")
+		fmt.Fprintln(w, "  /pin list                     - Show pinned messages")
+		fmt.Fprintln(w, "  /unpin <n>                    - Unpin a message")
 		fmt.Fprintln(w, "  /context add <path>           - Load file into context")
 		fmt.Fprintln(w, "  /context list                 - Show loaded context files")
 		fmt.Fprintln(w, "  /context clear                - Remove all context files")
 		fmt.Fprintln(w, "  /memory                       - List recent memories")
 		fmt.Fprintln(w, "  /memory search <q>            - Search memories")
 		fmt.Fprintln(w, "  /memory forget <id>           - Delete a memory by ID prefix")
+		fmt.Fprintln(w, "  /memory export <file>         - Back up memories to a JSONL file")
+		fmt.Fprintln(w, "  /memory import <file>         - Restore memories from a JSONL file")
+		fmt.Fprintln(w, "  /memory remember <fact>       - Save a fact that never goes stale")
+		fmt.Fprintln(w, "  /memory importance <id> <n>   - Set a memory's importance (0-1)")
+		fmt.Fprintln(w, "  /memory rate <id> <up|down>   - Rate a memory for fine-tuning")
+		fmt.Fprintln(w, "  /memory compact               - Merge near-duplicate memories")
 		fmt.Fprintln(w, "  /memory clear                 - Clear all memories")
+		fmt.Fprintln(w, "  /finetune dataset stats|show  - Inspect the dataset memory would give")
+		fmt.Fprintln(w, "  /finetune prepare <model>     - Create a training run from memory")
+		fmt.Fprintln(w, "  /finetune train <run-id>      - Start training a prepared run")
+		fmt.Fprintln(w, "  /finetune status <run> [-f]   - Show a run's progress; -f follows it live")
+		fmt.Fprintln(w, "  /finetune deploy <run>        - Merge, load and smoke-test a run as a new version")
+		fmt.Fprintln(w, "  /finetune import <run> <file> - Add a JSONL/ShareGPT dataset to a run")
+		fmt.Fprintln(w, "  /finetune list                - List training runs and their disk usage")
+		fmt.Fprintln(w, "  /finetune gc [--keep n]       - Remove old runs to free disk space")
 		fmt.Fprintln(w, "  /quit, /exit                  - Exit")
 		return true
 	}
@@ -354,6 +925,58 @@ func handleREPLCommand(w io.Writer, input string, mgr *chatctx.Manager, client *
 	return false
 }
 
+// loadModel loads model, which may be an alias, and returns the context
+// size to use with it: --ctx-size when given, otherwise the size the server
+// loaded the model with. Remote models need no loading and use the
+// ctx_size from providers.toml.
+func loadModel(ctx context.Context, cmd *cobra.Command, out io.Writer, router *apiclient.Router, model string) (int, string, error) {
+	ctxSize, _ := cmd.Flags().GetInt("ctx-size")
+	if remote, ok := router.Remote(model); ok {
+		fmt.Fprintf(out, "%s is %s on %s\n", model, remote.Model, remote.Name)
+		if !cmd.Flags().Changed("ctx-size") && remote.CtxSize > 0 {
+			ctxSize = remote.CtxSize
+		}
+		return ctxSize, "", nil
+	}
+	loaded, err := router.Server.LoadModel(ctx, model)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to load model (is the backend running?): %w", err)
+	}
+	if loaded.Name != "" && loaded.Name != model {
+		fmt.Fprintf(out, "%s is %s\n", model, loaded.Name)
+	}
+	if !cmd.Flags().Changed("ctx-size") && loaded.CtxSize > 0 {
+		ctxSize = loaded.CtxSize
+	}
+	return ctxSize, loaded.ToolFormat, nil
+}
+
+// backendClient returns a client for the backend that gives up on a
+// stream after --stream-stall of silence.
+func backendClient(cmd *cobra.Command) *apiclient.Client {
+	opts := apiclient.DefaultOptions()
+	opts.StreamStall, _ = cmd.Flags().GetDuration("stream-stall")
+	if opts.StreamStall == 0 {
+		opts.StreamStall = -1
+	}
+	return apiclient.NewWithOptions(serverURL, opts)
+}
+
+// loadedModelInfo returns what the backend reports about model when its
+// GPU server has it loaded, or was running it before unloading it when
+// idle; nil when the server has another model, is not running or cannot
+// tell.
+func loadedModelInfo(ctx context.Context, client *apiclient.Client, model string) *api.ServerInfo {
+	info, err := client.ServerInfo(apiclient.WithTimeout(ctx, 10*time.Second))
+	if err != nil || info.Model == "" {
+		return nil
+	}
+	if strings.TrimSuffix(strings.TrimSuffix(model, ".gguf"), ":latest") != strings.TrimSuffix(info.Model, ":latest") {
+		return nil
+	}
+	return info
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -365,19 +988,54 @@ func addRunFlags(cmd *cobra.Command) {
 	cmd.Flags().String("system", "", "system prompt")
 	cmd.Flags().String("system-file", "", "read system prompt from file")
 	cmd.Flags().Bool("agent", false, "enable agent mode with tool calling")
-	cmd.Flags().Int("ctx-size", 4096, "context window size in tokens")
+	cmd.Flags().Int("ctx-size", 4096, "context window size in tokens (run, exec and chat use the size the server runs the model with unless set)")
 	cmd.Flags().Int("response-budget", 512, "tokens reserved for model response")
+	cmd.Flags().Duration("stream-stall", apiclient.DefaultOptions().StreamStall, "give up on a streaming response after this long without data, keepalives included (0 = never)")
 	cmd.Flags().StringSlice("context-file", nil, "files to load into context")
 	cmd.Flags().Bool("memory", false, "enable memory/RAG")
+	cmd.Flags().Bool("no-env", false, "leave out the system message giving the working directory, platform, git branch and date")
 	cmd.Flags().Int("max-iterations", 200, "maximum agent tool-call iterations per turn (0 = unlimited)")
+	cmd.Flags().Duration("tool-timeout", tools.DefaultToolTimeout, "default time limit for a single tool call (0 = none)")
+	cmd.Flags().Bool("read-before-write", false, "refuse agent edits to files it has not read with file_read during the turn")
+	cmd.Flags().Bool("compact-tools", false, "send tool definitions with one-sentence descriptions and no examples, to save context")
+	cmd.Flags().Bool("route-tools", false, "start each agent turn by asking the model which tools the task needs, and offer only those")
+	cmd.Flags().Bool("record-trajectories", false, "with --memory, save each agent turn's tool calls and results on the backend for /finetune prepare --tools")
+	cmd.Flags().Bool("allow-git-write", false, "let the agent commit with the git_commit tool (git tools are read-only otherwise)")
+	cmd.Flags().String("shell-policy", "", "TOML file of shell_exec allow/deny rules (default ~/.tanrenai/shell.toml if it exists)")
+	cmd.Flags().StringSlice("http-allow-host", nil, "hosts the http_request tool may call besides localhost (e.g. api.example.com, *.internal, or * for any)")
+	cmd.Flags().String("log-dir", "", "write a JSONL transcript of requests, responses and tool calls to this directory")
+	cmd.Flags().StringArray("set", nil, "sampling parameter as name=value, e.g. temperature=0.2 (repeatable; see /set)")
+	cmd.Flags().String("summary-model", "", "model that summarizes the conversation when it outgrows the context window, e.g. a small remote model (default the chat model)")
+	cmd.RegisterFlagCompletionFunc("summary-model", completeModels)
 }
 
-var _ = time.Now
+// samplingFlags returns the sampling settings given with --set.
+func samplingFlags(cmd *cobra.Command) (*samplingSettings, error) {
+	assignments, _ := cmd.Flags().GetStringArray("set")
+	sampling := &samplingSettings{}
+	if err := sampling.setAll(assignments); err != nil {
+		return nil, err
+	}
+	return sampling, nil
+}
+
+// addTUIFlags registers the flags that only apply to the interactive TUI.
+func addTUIFlags(cmd *cobra.Command) {
+	cmd.Flags().String("theme", defaultThemeName, "TUI color theme: dark, light, solarized, or a custom theme in ~/.tanrenai/themes")
+	cmd.Flags().String("session", "", "keep the conversation in a backend session: an ID to resume, or \"new\"")
+	cmd.Flags().String("memory-scope", "", "with --session, which memories the session searches: global or session (its own)")
+	cmd.Flags().Float64("summarize-at", 0.8, "agent mode: once the history fills this share of the space left for it, summarize it down to half that in the background after the turn (0 = only when it no longer fits)")
+}
 
 func init() {
+	runCmd.Flags().String("model", "", "model to load when none is given as an argument")
+	runCmd.RegisterFlagCompletionFunc("model", completeModels)
 	addRunFlags(runCmd)
+	addTUIFlags(runCmd)
 	chatCmd.Flags().String("model", "", "model to chat with")
+	chatCmd.RegisterFlagCompletionFunc("model", completeModels)
 	addRunFlags(chatCmd)
+	addTUIFlags(chatCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(chatCmd)
 }
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// samplingParams lists the parameters /set and --set accept.
+var samplingParams = []string{"temperature", "top_p", "top_k", "min_p", "repeat_penalty", "seed", "stop", "logit_bias"}
+
+// samplingSettings are sampling parameters set for a session with /set or
+// --set. They fill in requests that leave them unset; parameters set
+// nowhere use the model's defaults.
+type samplingSettings struct {
+	mu            sync.Mutex
+	temperature   *float64
+	topP          *float64
+	topK          *int
+	minP          *float64
+	repeatPenalty *float64
+	seed          *int
+	stop          []string
+	logitBias     map[string]float64
+}
+
+// set parses value for the named parameter. "default" unsets it. Stop
+// sequences are separated by commas, logit biases are comma-separated
+// token:bias pairs such as "15043:-100,29871:2".
+func (s *samplingSettings) set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset := value == "default"
+	float := func(dst **float64) error {
+		if reset {
+			*dst = nil
+			return nil
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number", name)
+		}
+		*dst = &v
+		return nil
+	}
+	integer := func(dst **int) error {
+		if reset {
+			*dst = nil
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", name)
+		}
+		*dst = &v
+		return nil
+	}
+
+	switch name {
+	case "temperature":
+		return float(&s.temperature)
+	case "top_p":
+		return float(&s.topP)
+	case "top_k":
+		return integer(&s.topK)
+	case "min_p":
+		return float(&s.minP)
+	case "repeat_penalty":
+		return float(&s.repeatPenalty)
+	case "seed":
+		return integer(&s.seed)
+	case "stop":
+		s.stop = nil
+		if !reset {
+			s.stop = strings.Split(value, ",")
+		}
+		return nil
+	case "logit_bias":
+		s.logitBias = nil
+		if reset {
+			return nil
+		}
+		bias := make(map[string]float64)
+		for _, pair := range strings.Split(value, ",") {
+			token, b, ok := strings.Cut(pair, ":")
+			v, err := strconv.ParseFloat(b, 64)
+			if _, idErr := strconv.Atoi(token); !ok || err != nil || idErr != nil {
+				return fmt.Errorf("logit_bias wants token:bias pairs, e.g. 15043:-100")
+			}
+			bias[token] = v
+		}
+		s.logitBias = bias
+		return nil
+	}
+	return fmt.Errorf("unknown parameter %q (available: %s)", name, strings.Join(samplingParams, ", "))
+}
+
+// setAll applies "name=value" assignments, as given to --set.
+func (s *samplingSettings) setAll(assignments []string) error {
+	for _, a := range assignments {
+		name, value, ok := strings.Cut(a, "=")
+		if !ok {
+			return fmt.Errorf("--set %s: want name=value", a)
+		}
+		if err := s.set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply fills in the parameters req leaves unset.
+func (s *samplingSettings) apply(req *api.ChatCompletionRequest) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Temperature == nil {
+		req.Temperature = s.temperature
+	}
+	if req.TopP == nil {
+		req.TopP = s.topP
+	}
+	if req.TopK == nil {
+		req.TopK = s.topK
+	}
+	if req.MinP == nil {
+		req.MinP = s.minP
+	}
+	if req.RepeatPenalty == nil {
+		req.RepeatPenalty = s.repeatPenalty
+	}
+	if req.Seed == nil {
+		req.Seed = s.seed
+	}
+	if req.Stop == nil {
+		req.Stop = slices.Clone(s.stop)
+	}
+	if req.LogitBias == nil {
+		req.LogitBias = maps.Clone(s.logitBias)
+	}
+}
+
+// describe lists every parameter with its value, or "model default".
+func (s *samplingSettings) describe() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := map[string]string{}
+	float := func(name string, v *float64) {
+		if v != nil {
+			values[name] = strconv.FormatFloat(*v, 'g', -1, 64)
+		}
+	}
+	integer := func(name string, v *int) {
+		if v != nil {
+			values[name] = strconv.Itoa(*v)
+		}
+	}
+	float("temperature", s.temperature)
+	float("top_p", s.topP)
+	integer("top_k", s.topK)
+	float("min_p", s.minP)
+	float("repeat_penalty", s.repeatPenalty)
+	integer("seed", s.seed)
+	if s.stop != nil {
+		values["stop"] = strconv.Quote(strings.Join(s.stop, ","))
+	}
+	if s.logitBias != nil {
+		var pairs []string
+		for _, token := range slices.Sorted(maps.Keys(s.logitBias)) {
+			pairs = append(pairs, token+":"+strconv.FormatFloat(s.logitBias[token], 'g', -1, 64))
+		}
+		values["logit_bias"] = strings.Join(pairs, ",")
+	}
+
+	lines := make([]string, 0, len(samplingParams))
+	for _, name := range samplingParams {
+		v, ok := values[name]
+		if !ok {
+			v = "model default"
+		}
+		lines = append(lines, fmt.Sprintf("%-15s %s", name, v))
+	}
+	return lines
+}
+
+// samplingCompleter completes the parameter names of /set.
+type samplingCompleter struct{}
+
+func (samplingCompleter) complete(arg string) []string {
+	var out []string
+	for _, name := range samplingParams {
+		if strings.HasPrefix(name, arg) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
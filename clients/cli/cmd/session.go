@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// sessionLink keeps a chat's history in a backend session (--session), so
+// another client can attach to the same conversation and continue it.
+type sessionLink struct {
+	client *apiclient.Client
+	id     string
+
+	mu      sync.Mutex
+	synced  int // history messages the backend has
+	summary string
+	state   chatctx.SessionState
+}
+
+// attachSession loads session id into mgr, or creates a new session for
+// model when id is "new", and reports which to w. A memoryScope other than
+// "" becomes the session's memory scope.
+func attachSession(ctx context.Context, w io.Writer, client *apiclient.Client, mgr *chatctx.Manager, id, model, memoryScope string) (*sessionLink, error) {
+	var sess *api.Session
+	var err error
+	if id == "new" {
+		sess, err = client.CreateSession(ctx, api.SessionCreateRequest{Model: model, Settings: api.SessionSettings{MemoryScope: memoryScope}})
+		if err != nil {
+			return nil, fmt.Errorf("create session: %w", err)
+		}
+		fmt.Fprintf(w, "Created session %s\n", sess.ID)
+	} else {
+		sess, err = client.GetSession(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("load session: %w", err)
+		}
+		fmt.Fprintf(w, "Attached to session %s (%d messages)\n", sess.ID, len(sess.Messages))
+		if memoryScope != "" && memoryScope != sess.Settings.MemoryScope {
+			settings := sess.Settings
+			settings.MemoryScope = memoryScope
+			if sess, err = client.UpdateSession(ctx, sess.ID, api.SessionUpdateRequest{Settings: &settings}); err != nil {
+				return nil, fmt.Errorf("set memory scope: %w", err)
+			}
+		}
+	}
+	if sess.Settings.MemoryScope == api.MemoryScopeSession {
+		fmt.Fprintln(w, "Memory search is limited to this session's memories.")
+	}
+
+	state := chatctx.SessionState{
+		Files:     sess.State.Files,
+		Commands:  sess.State.Commands,
+		Decisions: sess.State.Decisions,
+		TODOs:     sess.State.TODOs,
+	}
+	mgr.AppendMany(sess.Messages)
+	mgr.SetSummary(sess.Summary)
+	mgr.SetState(state)
+
+	return &sessionLink{
+		client:  client,
+		id:      sess.ID,
+		synced:  len(sess.Messages),
+		summary: sess.Summary,
+		state:   state,
+	}, nil
+}
+
+// push sends the history added since the last push, and the summary and
+// state if they changed. The append fails with a CodeConflict error when
+// another client has added messages in the meantime.
+func (l *sessionLink) push(ctx context.Context, history []api.Message, summary string, state chatctx.SessionState) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(history) > l.synced {
+		n, err := l.client.AppendSessionMessages(ctx, l.id, history[l.synced:], l.synced)
+		if err != nil {
+			return err
+		}
+		l.synced = n
+	}
+
+	if summary == l.summary && stateEqual(state, l.state) {
+		return nil
+	}
+	apiState := api.SessionState{
+		Files:     state.Files,
+		Commands:  state.Commands,
+		Decisions: state.Decisions,
+		TODOs:     state.TODOs,
+	}
+	if _, err := l.client.UpdateSession(ctx, l.id, api.SessionUpdateRequest{Summary: &summary, State: &apiState}); err != nil {
+		return err
+	}
+	l.summary = summary
+	l.state = state
+	return nil
+}
+
+// checkMemoryScope validates --memory-scope, which only applies to a
+// backend session.
+func checkMemoryScope(scope, sessionID string) error {
+	switch scope {
+	case "":
+		return nil
+	case api.MemoryScopeGlobal, api.MemoryScopeSession:
+		if sessionID == "" {
+			return fmt.Errorf("--memory-scope needs --session")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid --memory-scope %q: want %s or %s", scope, api.MemoryScopeGlobal, api.MemoryScopeSession)
+}
+
+func stateEqual(a, b chatctx.SessionState) bool {
+	return slices.Equal(a.Files, b.Files) && slices.Equal(a.Commands, b.Commands) &&
+		slices.Equal(a.Decisions, b.Decisions) && slices.Equal(a.TODOs, b.TODOs)
+}
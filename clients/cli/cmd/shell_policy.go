@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+)
+
+// loadShellPolicy reads the shell_exec policy from path, or from
+// ~/.tanrenai/shell.toml when path is empty, in which case a missing file
+// means no policy:
+//
+//	allow = ['^go (build|test|vet)\b', '^git (status|diff|log)\b']
+//	deny = ['\bsudo\b', '\brm\s+-rf\s+/']
+//	deny_by_default = true
+//	max_output = 32768
+//	confine = true
+//
+// Confined commands run in, and may only name paths under, the current
+// directory.
+func loadShellPolicy(path string) (*tools.ShellPolicy, error) {
+	explicit := path != ""
+	if !explicit {
+		dir := configDir()
+		if dir == "" {
+			return nil, nil
+		}
+		path = filepath.Join(dir, "shell.toml")
+	}
+
+	var cfg tools.ShellPolicyConfig
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read shell policy %s: %w", path, err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := tools.NewShellPolicy(cfg, wd)
+	if err != nil {
+		return nil, fmt.Errorf("shell policy %s: %w", path, err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// recordCommands are the recorders tried in order. Each writes 16 kHz mono
+// 16-bit WAV, what whisper.cpp expects, to the file named last, and
+// finishes the file when interrupted.
+var recordCommands = [][]string{
+	{"arecord", "-q", "-f", "S16_LE", "-c", "1", "-r", "16000"}, // ALSA, Linux
+	{"rec", "-q", "-c", "1", "-r", "16000", "-b", "16"},         // SoX, macOS and Linux
+}
+
+// wavHeaderBytes is the size of a WAV header; a file no longer than this
+// holds no audio.
+const wavHeaderBytes = 44
+
+// recorder records from the microphone with an external tool.
+type recorder struct {
+	cmd *exec.Cmd
+	dir string
+}
+
+// startRecording starts the first recorder found on PATH.
+func startRecording() (*recorder, error) {
+	for _, args := range recordCommands {
+		bin, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+		dir, err := os.MkdirTemp("", "tanrenai-speak-")
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(bin, append(args[1:], filepath.Join(dir, "speech.wav"))...)
+		if err := cmd.Start(); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		return &recorder{cmd: cmd, dir: dir}, nil
+	}
+	return nil, errors.New("no audio recorder found; install arecord (alsa-utils) or rec (sox)")
+}
+
+// stop ends the recording and returns the WAV data.
+func (r *recorder) stop() ([]byte, error) {
+	defer os.RemoveAll(r.dir)
+	r.cmd.Process.Signal(os.Interrupt)
+	r.cmd.Wait() // recorders exit non-zero when interrupted
+	data, err := os.ReadFile(filepath.Join(r.dir, "speech.wav"))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= wavHeaderBytes {
+		return nil, errors.New("nothing was recorded")
+	}
+	return data, nil
+}
+
+// cancel ends the recording and discards it.
+func (r *recorder) cancel() {
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	os.RemoveAll(r.dir)
+}
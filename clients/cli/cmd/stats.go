@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/agent"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+	"github.com/rivo/tview"
+)
+
+// sessionStats adds up the agent turns of a TUI session for /stats.
+type sessionStats struct {
+	turns      int
+	iterations int
+	usage      api.Usage
+	wall       time.Duration // whole turns, including waiting on the user
+	model      time.Duration // waiting for completions
+	toolCalls  int
+	toolErrors int
+	tools      map[string]*toolStats
+}
+
+// toolStats is the calls and run time of one tool.
+type toolStats struct {
+	calls int
+	time  time.Duration
+}
+
+func newSessionStats() *sessionStats {
+	return &sessionStats{tools: make(map[string]*toolStats)}
+}
+
+// add counts an agent turn.
+func (s *sessionStats) add(res *agent.RunResult) {
+	s.turns++
+	s.iterations += res.Iterations
+	s.usage.PromptTokens += res.Usage.PromptTokens
+	s.usage.CompletionTokens += res.Usage.CompletionTokens
+	s.usage.TotalTokens += res.Usage.TotalTokens
+	s.wall += res.Duration
+	s.model += res.ModelTime
+	s.toolCalls += res.ToolCalls
+	s.toolErrors += res.ToolErrors
+	for name, n := range res.ToolCounts {
+		ts := s.tools[name]
+		if ts == nil {
+			ts = &toolStats{}
+			s.tools[name] = ts
+		}
+		ts.calls += n
+		ts.time += res.ToolTime[name]
+	}
+}
+
+// tokensPerSecond is the generation speed over model time, or "" when the
+// backend reported no usage.
+func tokensPerSecond(tokens int, d time.Duration) string {
+	if tokens <= 0 || d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f tok/s", float64(tokens)/d.Seconds())
+}
+
+// byTime returns the tool names of times, slowest first.
+func byTime(times map[string]time.Duration) []string {
+	names := make([]string, 0, len(times))
+	for name := range times {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if times[names[i]] != times[names[j]] {
+			return times[names[i]] > times[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// turnStats describes where an agent turn's time went in one line, e.g.
+// "model 8.1s (42.0 tok/s), tools 3.2s (shell_exec 2.9s, file_read 0.3s)".
+func turnStats(res *agent.RunResult) string {
+	model := "model " + res.ModelTime.Round(100*time.Millisecond).String()
+	if tps := tokensPerSecond(res.Usage.CompletionTokens, res.ModelTime); tps != "" {
+		model += " (" + tps + ")"
+	}
+	if res.ToolCalls == 0 {
+		return model
+	}
+	var total time.Duration
+	for _, d := range res.ToolTime {
+		total += d
+	}
+	names := byTime(res.ToolTime)
+	if len(names) > 3 {
+		names = names[:3]
+	}
+	top := make([]string, len(names))
+	for i, name := range names {
+		top[i] = name + " " + res.ToolTime[name].Round(100*time.Millisecond).String()
+	}
+	return fmt.Sprintf("%s, tools %s (%s)", model, total.Round(100*time.Millisecond), strings.Join(top, ", "))
+}
+
+// lines renders the session totals for /stats, with the tools slowest
+// first.
+func (s *sessionStats) lines() []string {
+	if s.turns == 0 {
+		return []string{"[gray::-]  No agent turns yet.[-:-:-]"}
+	}
+	out := []string{
+		fmt.Sprintf("[gray::-]  %d turn%s, %d iteration%s, %s wall time[-:-:-]",
+			s.turns, plural(s.turns), s.iterations, plural(s.iterations), s.wall.Round(100*time.Millisecond)),
+		fmt.Sprintf("[gray::-]  Tokens: %s in, %s out[-:-:-]",
+			formatTokenCount(s.usage.PromptTokens), formatTokenCount(s.usage.CompletionTokens)),
+	}
+	model := "  Model: " + s.model.Round(100*time.Millisecond).String()
+	if tps := tokensPerSecond(s.usage.CompletionTokens, s.model); tps != "" {
+		model += ", " + tps
+	}
+	out = append(out, "[gray::-]"+model+"[-:-:-]")
+	if s.toolCalls == 0 {
+		return out
+	}
+
+	times := make(map[string]time.Duration, len(s.tools))
+	var total time.Duration
+	for name, ts := range s.tools {
+		times[name] = ts.time
+		total += ts.time
+	}
+	calls := fmt.Sprintf("%d call%s", s.toolCalls, plural(s.toolCalls))
+	if s.toolErrors > 0 {
+		calls += fmt.Sprintf(", %d failed", s.toolErrors)
+	}
+	out = append(out, fmt.Sprintf("[gray::-]  Tools: %s, %s total[-:-:-]", calls, total.Round(100*time.Millisecond)))
+	for _, name := range byTime(times) {
+		ts := s.tools[name]
+		share := 0
+		if total > 0 {
+			share = int(ts.time * 100 / total)
+		}
+		out = append(out, fmt.Sprintf("[gray::-]    %-16s %s (%d%%), %d call%s, avg %s[-:-:-]",
+			tview.Escape(name), ts.time.Round(100*time.Millisecond), share, ts.calls, plural(ts.calls),
+			(ts.time/time.Duration(ts.calls)).Round(10*time.Millisecond)))
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStdinBytes caps how much piped input is attached to a prompt.
+const maxStdinBytes = 64 * 1024
+
+// pipedInput is text read from a redirected stdin.
+type pipedInput struct {
+	text  string
+	total int64 // bytes read, including any beyond maxStdinBytes
+}
+
+// readPipedStdin reads stdin when it is a pipe or file rather than a
+// terminal. It returns nil if stdin is a terminal or empty.
+func readPipedStdin() (*pipedInput, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return nil, nil
+	}
+	return readPiped(os.Stdin, maxStdinBytes)
+}
+
+func readPiped(r io.Reader, limit int) (*pipedInput, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	// Drain the rest so the notice can say how much was dropped.
+	rest, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	if rest > 0 {
+		// Don't split a multi-byte character at the cut.
+		for i := 0; i < utf8.UTFMax-1 && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, nil
+	}
+	return &pipedInput{text: string(data), total: int64(len(data)) + rest}, nil
+}
+
+func (p *pipedInput) truncated() bool {
+	return p.total > int64(len(p.text))
+}
+
+// summary describes the input for the user.
+func (p *pipedInput) summary() string {
+	if p.truncated() {
+		return fmt.Sprintf("Read %d bytes from stdin; only the first %d are attached.", p.total, len(p.text))
+	}
+	return fmt.Sprintf("Read %d bytes from stdin.", p.total)
+}
+
+// attach appends the input to prompt as a fenced block, noting when it was
+// cut short.
+func (p *pipedInput) attach(prompt string) string {
+	fence := codeFence(p.text)
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\n")
+	b.WriteString(fence + "\n")
+	b.WriteString(strings.TrimRight(p.text, "\n"))
+	b.WriteString("\n" + fence)
+	if p.truncated() {
+		fmt.Fprintf(&b, "\n\n[Input truncated: showing the first %d of %d bytes.]", len(p.text), p.total)
+	}
+	return b.String()
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in s,
+// so the block cannot be closed early by its own content.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	chromastyles "github.com/alecthomas/chroma/v2/styles"
+	glamourstyles "github.com/charmbracelet/glamour/styles"
+	"github.com/gdamore/tcell/v2"
+)
+
+// theme is a named TUI palette. Colors are tview color names ("blue",
+// "darkgray"), hex values ("#268bd2") or "-" for the terminal default.
+type theme struct {
+	Name string `toml:"-"`
+	// Base names a built-in theme that a custom theme starts from.
+	Base string `toml:"base"`
+
+	Text         string `toml:"text"`
+	User         string `toml:"user"`
+	Assistant    string `toml:"assistant"`
+	Muted        string `toml:"muted"`
+	Accent       string `toml:"accent"`
+	Error        string `toml:"error"`
+	Divider      string `toml:"divider"`
+	DividerFocus string `toml:"divider_focus"`
+	// CodeStyle is the chroma style used by the file viewer.
+	CodeStyle string `toml:"code_style"`
+	// MarkdownStyle is the glamour style used for assistant replies.
+	MarkdownStyle string `toml:"markdown_style"`
+
+	replacer *strings.Replacer
+}
+
+var builtinThemes = map[string]theme{
+	"dark": {
+		Text:          "white",
+		User:          "blue",
+		Assistant:     "purple",
+		Muted:         "gray",
+		Accent:        "yellow",
+		Error:         "red",
+		Divider:       "darkgray",
+		DividerFocus:  "blue",
+		CodeStyle:     "monokai",
+		MarkdownStyle: "dark",
+	},
+	"light": {
+		Text:          "-",
+		User:          "navy",
+		Assistant:     "purple",
+		Muted:         "#6c6c6c",
+		Accent:        "#af5f00",
+		Error:         "maroon",
+		Divider:       "silver",
+		DividerFocus:  "navy",
+		CodeStyle:     "github",
+		MarkdownStyle: "light",
+	},
+	"solarized": {
+		Text:          "#93a1a1",
+		User:          "#268bd2",
+		Assistant:     "#6c71c4",
+		Muted:         "#657b83",
+		Accent:        "#b58900",
+		Error:         "#dc322f",
+		Divider:       "#586e75",
+		DividerFocus:  "#268bd2",
+		CodeStyle:     "solarized-dark",
+		MarkdownStyle: "dark",
+	},
+}
+
+// defaultThemeName is used when --theme is not given.
+const defaultThemeName = "dark"
+
+func themesDir() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "themes")
+}
+
+// loadTheme returns a built-in theme or ~/.tanrenai/themes/<name>.toml.
+// Custom themes start from their base (dark by default), so they only need
+// to set the colors they change.
+func loadTheme(name string) (theme, error) {
+	if name == "" {
+		name = defaultThemeName
+	}
+	if th, ok := builtinThemes[name]; ok {
+		th.Name = name
+		return th.compile(), nil
+	}
+
+	path := filepath.Join(themesDir(), name+".toml")
+	var meta struct {
+		Base string `toml:"base"`
+	}
+	if _, err := toml.DecodeFile(path, &meta); err != nil {
+		if os.IsNotExist(err) {
+			return theme{}, fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(availableThemes(), ", "))
+		}
+		return theme{}, fmt.Errorf("read theme %s: %w", path, err)
+	}
+	if meta.Base == "" {
+		meta.Base = defaultThemeName
+	}
+	th, ok := builtinThemes[meta.Base]
+	if !ok {
+		return theme{}, fmt.Errorf("theme %s: unknown base theme %q", path, meta.Base)
+	}
+	if _, err := toml.DecodeFile(path, &th); err != nil {
+		return theme{}, fmt.Errorf("read theme %s: %w", path, err)
+	}
+	th.Name = name
+	if err := th.validate(); err != nil {
+		return theme{}, fmt.Errorf("theme %s: %w", path, err)
+	}
+	return th.compile(), nil
+}
+
+// availableThemes lists built-in and custom theme names.
+func availableThemes() []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	if entries, err := os.ReadDir(themesDir()); err == nil {
+		for _, e := range entries {
+			if name, ok := strings.CutSuffix(e.Name(), ".toml"); ok && !e.IsDir() {
+				if _, builtin := builtinThemes[name]; !builtin {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (th theme) validate() error {
+	colors := map[string]string{
+		"text": th.Text, "user": th.User, "assistant": th.Assistant, "muted": th.Muted,
+		"accent": th.Accent, "error": th.Error, "divider": th.Divider, "divider_focus": th.DividerFocus,
+	}
+	for key, c := range colors {
+		if c == "-" {
+			continue
+		}
+		if _, ok := tcell.ColorNames[strings.ToLower(c)]; ok {
+			continue
+		}
+		if strings.HasPrefix(c, "#") && tcell.GetColor(c) != tcell.ColorDefault {
+			continue
+		}
+		return fmt.Errorf("%s: unknown color %q", key, c)
+	}
+	if _, ok := chromastyles.Registry[th.CodeStyle]; !ok {
+		return fmt.Errorf("code_style: unknown chroma style %q", th.CodeStyle)
+	}
+	if _, ok := glamourstyles.DefaultStyles[th.MarkdownStyle]; !ok {
+		return fmt.Errorf("markdown_style: unknown glamour style %q", th.MarkdownStyle)
+	}
+	return nil
+}
+
+// compile prepares the tag replacer. Chat lines are written with the dark
+// theme's tags (e.g. "[gray::-]" for muted text) and recolored by apply when
+// displayed, so switching themes also recolors existing output.
+func (th theme) compile() theme {
+	th.replacer = strings.NewReplacer(
+		"[gray::-]", "["+th.Muted+"::-]",
+		"[blue::b]", "["+th.User+"::b]",
+		"[purple::b]", "["+th.Assistant+"::b]",
+		"[yellow::b]", "["+th.Accent+"::b]",
+		"[red::-]", "["+th.Error+"::-]",
+		"[white]", "["+th.Text+"]",
+	)
+	return th
+}
+
+// apply recolors tview-tagged text for this theme.
+func (th theme) apply(s string) string {
+	if th.replacer == nil {
+		return s
+	}
+	return th.replacer.Replace(s)
+}
+
+func (th theme) dividerColor(focused bool) tcell.Color {
+	if focused {
+		return tcell.GetColor(th.DividerFocus)
+	}
+	return tcell.GetColor(th.Divider)
+}
@@ -4,9 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,7 +30,9 @@ import (
 	"github.com/ThatCatDev/tanrenai/client/internal/agent"
 	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
 	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/reasoning"
 	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/internal/transcript"
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
 
@@ -50,21 +60,50 @@ type tuiApp struct {
 	fileHeader *tview.TextView // 1-line file path + hints
 	fileView   *tview.TextView // scrollable syntax-highlighted content
 
+	fileContent   string   // raw text of the open file
+	fileLines     []string // highlighted, tagged lines of the open file
+	fileLine      int      // highlighted line (1-based), 0 for none
+	fileSearch    string   // last / query in the file viewer
+	fileMatches   []int    // lines (1-based) matching fileSearch
+	fileMatchIdx  int      // current entry in fileMatches
+	fileSearching bool     // the input field is collecting a / query
+
 	inputField *tview.InputField
 	statusBar  *tview.TextView
 	statusText string
 
+	// Prompt history (Up/Down recall, Ctrl+R search)
+	history     *inputHistory
+	searching   bool   // Ctrl+R search in progress
+	searchQuery string // input text when the search started
+	searchSkip  int    // how many older matches Ctrl+R has skipped
+	completing  bool   // the completion popup is open
+
+	// Chat selection (v or mouse drag, y to copy)
+	screen     tcell.Screen
+	selecting  bool
+	selAnchor  int  // logical line where the selection started
+	selCursor  int  // logical line at the moving end of the selection
+	selPending bool // entered with v and not moved yet; a typed key goes to the input
+	dragAnchor int  // logical line under the last left mouse press, -1 if none
+
 	mu            sync.Mutex
 	lines         []string
 	toolResults   map[int]string       // line index -> full tool result
 	toolCallLines map[int]api.ToolCall // line index -> original tool call
-	expanded      bool                 // Tab toggles full tool output
+	callResults   map[int]int          // tool call line index -> its result line index
+	callLineByID  map[string]int       // tool call ID -> tool call line index
+	expanded      map[int]bool         // result line index -> show the full tool output
+	reasoning     map[int]bool         // lines whose toolResults entry is model reasoning
+	showReasoning bool                 // /think: show reasoning expanded
 	filePath      string               // "" = no file viewer open
 	focus         focusTarget
 	processing    bool
 	ctrlCPending  bool
 	streaming     strings.Builder
 	turnCancel    context.CancelFunc
+	summarizing   bool   // a background summary owns the manager; see summarizeInBackground
+	pendingInput  string // entered during a background summary, sent when it ends
 
 	// Progress tracking
 	iterStartTime    time.Time
@@ -73,12 +112,36 @@ type tuiApp struct {
 	currentIterOutput int         // output chars accumulated this iteration
 	lastInputTokens  int         // input tokens for status bar display
 	lastOutputTokens int         // output tokens for status bar display
+	usageExact       bool        // last in/out counts came from the backend, not estimates
+	lastRun          string      // summary of the last agent turn for the status bar
+	stats            *sessionStats // agent turns so far, for /stats
 	estimatedDur     time.Duration
 	progressTicker   *time.Ticker
 	progressStop     chan struct{}
+	pullStatus       string // download bar for a background /pull, "" when idle
+	trainStatus      string // progress of a run followed with /finetune status --follow, "" when idle
+	costStatus       string // price and spend of a running remote GPU instance, "" otherwise
+	voiceStatus      string // /speak recording or transcription, "" when idle
+	recorder         *recorder
+
+	// Context gauge, recomputed by updateContextGauge whenever history changes
+	ctxGauge      string // tagged "ctx NN% (used/total)", "" if the window size is unknown
+	summaryWarned bool   // the context-full warning was shown and still applies
+
+	// Plan mode
+	planMode  bool      // /plan toggle: every agent turn plans first
+	planOnce  bool      // plan only the next turn (/plan <request>)
+	planReply chan bool // non-nil while waiting for the user to approve a plan
+
+	routeTools  bool    // pick each turn's tools with a routing step (--route-tools)
+	summarizeAt float64 // history fill that starts a background summary after a turn (--summarize-at; 0 = off)
+	// recordTrajectories saves agent turns with tool calls on the backend
+	// (--record-trajectories).
+	recordTrajectories bool
 
 	// Dependencies (immutable after construction)
 	client        *apiclient.Client
+	router        *apiclient.Router // sends remote model aliases to their providers
 	modelName     string
 	mgr           *chatctx.Manager
 	registry      *tools.Registry
@@ -87,6 +150,17 @@ type tuiApp struct {
 	agentMode     bool
 	completeFn    agent.CompletionFunc
 	streamFn      agent.StreamingCompletionFunc
+	summarizeFn   chatctx.CompletionFunc // completeFn unless --summary-model is set
+
+	theme theme // /theme can switch it at runtime
+
+	transcript *transcript.Logger // nil unless --log-dir is set
+	piped      *pipedInput        // redirected stdin, attached to the first prompt
+	images     []*imageAttachment // /attach images, sent with the next prompt
+	session    *sessionLink       // nil unless --session is set
+	sampling   *samplingSettings  // /set and --set; read by the completion funcs
+
+	switchingModel bool // a /model use load is in flight
 }
 
 func newTuiApp(
@@ -99,11 +173,20 @@ func newTuiApp(
 	agentMode bool,
 	completeFn agent.CompletionFunc,
 	streamFn agent.StreamingCompletionFunc,
+	th theme,
+	tlog *transcript.Logger,
 ) *tuiApp {
 	t := &tuiApp{
 		toolResults:   make(map[int]string),
 		toolCallLines: make(map[int]api.ToolCall),
+		callResults:   make(map[int]int),
+		callLineByID:  make(map[string]int),
+		stats:         newSessionStats(),
+		expanded:      make(map[int]bool),
+		reasoning:     make(map[int]bool),
 		focus:         focusChat,
+		dragAnchor:    -1,
+		history:       loadInputHistory(inputHistoryPath()),
 		client:        client,
 		modelName:     modelName,
 		mgr:           mgr,
@@ -113,6 +196,8 @@ func newTuiApp(
 		agentMode:     agentMode,
 		completeFn:    completeFn,
 		streamFn:      streamFn,
+		theme:         th,
+		transcript:    tlog,
 	}
 
 	t.app = tview.NewApplication()
@@ -122,6 +207,7 @@ func newTuiApp(
 		SetDynamicColors(true).
 		SetScrollable(true).
 		SetWordWrap(true).
+		SetRegions(true).
 		SetChangedFunc(func() { t.app.Draw() })
 	t.chatView.SetBorder(false)
 
@@ -133,10 +219,17 @@ func newTuiApp(
 
 	// Input field
 	t.inputField = tview.NewInputField().
-		SetLabel("[blue::b] > [-:-:-]").
+		SetLabel(t.theme.apply(inputLabel)).
 		SetLabelWidth(4).
 		SetFieldBackgroundColor(tcell.ColorDefault)
 	t.inputField.SetBorder(false)
+	t.inputField.SetAutocompleteUseTags(false)
+	t.inputField.SetAutocompleteFunc(func(text string) []string {
+		entries := completeInput(text)
+		t.completing = len(entries) > 0
+		return entries
+	})
+	t.inputField.SetAutocompletedFunc(t.applyCompletion)
 
 	// Build layout
 	t.chatArea = tview.NewFlex().SetDirection(tview.FlexColumn)
@@ -145,9 +238,9 @@ func newTuiApp(
 	t.rootFlex = tview.NewFlex().SetDirection(tview.FlexRow)
 	t.rootFlex.AddItem(t.chatArea, 0, 1, false)
 	t.rootFlex.AddItem(t.statusBar, 1, 0, false)
-	t.rootFlex.AddItem(newHDivider(), 1, 0, false)
+	t.rootFlex.AddItem(t.newHDivider(), 1, 0, false)
 	t.rootFlex.AddItem(t.inputField, 1, 0, true)
-	t.rootFlex.AddItem(newHDivider(), 1, 0, false)
+	t.rootFlex.AddItem(t.newHDivider(), 1, 0, false)
 
 	t.setupInputCapture()
 	t.setupMouseCapture()
@@ -155,11 +248,14 @@ func newTuiApp(
 	return t
 }
 
+// inputLabel is the prompt shown in front of the input field.
+const inputLabel = "[blue::b] > [-:-:-]"
+
 // newHDivider creates a 1-row box that draws a horizontal line.
-func newHDivider() *tview.Box {
+func (t *tuiApp) newHDivider() *tview.Box {
 	box := tview.NewBox()
 	box.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
-		style := tcell.StyleDefault.Foreground(tcell.ColorDarkGray)
+		style := tcell.StyleDefault.Foreground(t.theme.dividerColor(false))
 		for cx := x; cx < x+width; cx++ {
 			screen.SetContent(cx, y, tcell.RuneHLine, nil, style)
 		}
@@ -169,14 +265,10 @@ func newHDivider() *tview.Box {
 }
 
 // newVDivider creates a 1-col box that draws a vertical line.
-func newVDivider(focused bool) *tview.Box {
+func (t *tuiApp) newVDivider(focused bool) *tview.Box {
 	box := tview.NewBox()
 	box.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
-		color := tcell.ColorDarkGray
-		if focused {
-			color = tcell.ColorBlue
-		}
-		style := tcell.StyleDefault.Foreground(color)
+		style := tcell.StyleDefault.Foreground(t.theme.dividerColor(focused))
 		for cy := y; cy < y+height; cy++ {
 			screen.SetContent(x, cy, tcell.RuneVLine, nil, style)
 		}
@@ -186,7 +278,23 @@ func newVDivider(focused bool) *tview.Box {
 }
 
 func (t *tuiApp) run() error {
-	return t.app.SetRoot(t.rootFlex, true).EnableMouse(true).Run()
+	// Keep a handle on the screen so copies can fall back to OSC 52.
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("create screen: %w", err)
+	}
+	t.screen = screen
+	t.updateContextGauge()
+	t.updateStatusBar()
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go t.watchInstance(watchCtx)
+	go t.watchCosts(watchCtx)
+	err = t.app.SetScreen(screen).SetRoot(t.rootFlex, true).EnableMouse(true).Run()
+	if t.recorder != nil {
+		t.recorder.cancel()
+	}
+	return err
 }
 
 // ── Input Capture ──────────────────────────────────────────────────────
@@ -196,6 +304,38 @@ func (t *tuiApp) setupInputCapture() {
 		if event.Key() != tcell.KeyCtrlC {
 			t.ctrlCPending = false
 		}
+		if t.selecting {
+			return t.handleSelectionKey(event)
+		}
+		// While the completion popup is open it owns navigation and Tab.
+		if t.completing {
+			switch event.Key() {
+			case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn, tcell.KeyTab:
+				return event
+			case tcell.KeyEscape:
+				t.completing = false
+				return event
+			}
+		}
+		if t.fileSearching {
+			switch event.Key() {
+			case tcell.KeyEnter:
+				query := t.inputField.GetText()
+				t.endFileSearchInput()
+				t.searchFile(query)
+				return nil
+			case tcell.KeyEscape:
+				t.endFileSearchInput()
+				return nil
+			}
+			return event
+		}
+		if t.searching && event.Key() != tcell.KeyCtrlR {
+			t.endHistorySearch(event.Key() == tcell.KeyEscape)
+			if event.Key() == tcell.KeyEscape {
+				return nil
+			}
+		}
 
 		switch event.Key() {
 		case tcell.KeyCtrlC:
@@ -221,6 +361,14 @@ func (t *tuiApp) setupInputCapture() {
 			return nil
 
 		case tcell.KeyEscape:
+			if t.recorder != nil {
+				t.cancelRecording()
+				return nil
+			}
+			if t.fileSearch != "" {
+				t.clearFileSearch()
+				return nil
+			}
 			if t.filePath != "" {
 				t.closeFileViewer()
 				return nil
@@ -236,16 +384,54 @@ func (t *tuiApp) setupInputCapture() {
 				t.rebuildFileViewer()
 				return nil
 			}
-			t.expanded = !t.expanded
-			t.refreshChatView()
+			t.toggleLatestToolResult()
 			return nil
 
 		case tcell.KeyUp:
-			t.scrollFocusedPane(-1)
+			if t.filePath != "" && t.focus == focusFileViewer {
+				t.scrollFocusedPane(-1)
+			} else if text, ok := t.history.prev(t.inputField.GetText()); ok {
+				t.inputField.SetText(text)
+			}
 			return nil
 		case tcell.KeyDown:
-			t.scrollFocusedPane(1)
+			if t.filePath != "" && t.focus == focusFileViewer {
+				t.scrollFocusedPane(1)
+			} else if text, ok := t.history.next(); ok {
+				t.inputField.SetText(text)
+			}
+			return nil
+		case tcell.KeyCtrlR:
+			t.searchHistory()
 			return nil
+		case tcell.KeyCtrlT:
+			t.toggleRecording()
+			return nil
+
+		case tcell.KeyRune:
+			if t.filePath != "" && t.focus == focusFileViewer && t.inputField.GetText() == "" {
+				switch r := event.Rune(); {
+				case r == '/':
+					t.fileSearching = true
+					t.inputField.SetLabel(t.theme.apply("[yellow::b] / [-:-:-]"))
+					return nil
+				case (r == 'n' || r == 'N') && len(t.fileMatches) > 0:
+					step := 1
+					if r == 'N' {
+						step = -1
+					}
+					t.fileMatchIdx = (t.fileMatchIdx + step + len(t.fileMatches)) % len(t.fileMatches)
+					t.showFileLine(t.fileMatches[t.fileMatchIdx])
+					return nil
+				case r == 'e' && t.fileLines != nil:
+					t.editOpenFile()
+					return nil
+				}
+			}
+			if event.Rune() == 'v' && t.inputField.GetText() == "" && t.planReply == nil && len(t.lines) > 0 {
+				t.startSelection()
+				return nil
+			}
 		case tcell.KeyPgUp:
 			t.scrollFocusedPane(-10)
 			return nil
@@ -254,14 +440,27 @@ func (t *tuiApp) setupInputCapture() {
 			return nil
 
 		case tcell.KeyEnter:
-			if t.processing {
+			if t.planReply != nil {
+				t.answerPlan(strings.TrimSpace(t.inputField.GetText()))
+				t.clearInput()
 				return nil
 			}
 			text := strings.TrimSpace(t.inputField.GetText())
+			if t.processing {
+				if t.summarizing && t.pendingInput == "" && text != "" {
+					t.clearInput()
+					t.history.add(text)
+					t.pendingInput = text
+					t.addLine("[gray::-]  Sending when the summary finishes; Ctrl+C cancels it.[-:-:-]")
+					t.refreshChatView()
+				}
+				return nil
+			}
 			if text == "" {
 				return nil
 			}
-			t.inputField.SetText("")
+			t.clearInput()
+			t.history.add(text)
 			t.handleEnter(text)
 			return nil
 		}
@@ -270,6 +469,80 @@ func (t *tuiApp) setupInputCapture() {
 	})
 }
 
+// setTheme switches the palette. Chat lines are recolored on the next
+// refresh; replies already rendered as markdown keep their original colors.
+func (t *tuiApp) setTheme(th theme) {
+	t.theme = th
+	if t.searching {
+		t.inputField.SetLabel(t.theme.apply("[yellow::b]^R [-:-:-]"))
+	} else {
+		t.inputField.SetLabel(t.theme.apply(inputLabel))
+	}
+	t.updateStatusBar()
+	if t.filePath != "" {
+		go t.loadFileViewer(t.filePath, t.fileLine)
+	}
+}
+
+// clearInput empties the input field and closes the completion popup.
+func (t *tuiApp) clearInput() {
+	t.inputField.SetText("")
+	t.inputField.Autocomplete()
+}
+
+// applyCompletion handles a selection from the completion popup. Browsing
+// the list leaves the input alone; Tab or a click inserts the entry and
+// keeps the popup open while there is more to complete (a directory or a
+// command argument).
+func (t *tuiApp) applyCompletion(entry string, index, source int) bool {
+	if source == tview.AutocompletedNavigate {
+		return false
+	}
+	text := completionText(entry)
+	t.inputField.SetText(text)
+	if strings.HasSuffix(text, "/") || strings.HasSuffix(text, " ") {
+		return false
+	}
+	t.completing = false
+	return true
+}
+
+// searchHistory fuzzily matches the input text against prompt history.
+// Repeated Ctrl+R steps to older matches.
+func (t *tuiApp) searchHistory() {
+	if !t.searching {
+		t.searching = true
+		t.searchQuery = t.inputField.GetText()
+		t.searchSkip = 0
+		t.inputField.SetLabel(t.theme.apply("[yellow::b]^R [-:-:-]"))
+	} else {
+		t.searchSkip++
+	}
+	match, ok := t.history.search(t.searchQuery, t.searchSkip)
+	if !ok && t.searchSkip > 0 {
+		t.searchSkip--
+		return
+	}
+	if !ok {
+		t.endHistorySearch(true)
+		t.addLine(fmt.Sprintf("[gray::-]  No history match for %q.[-:-:-]", tview.Escape(t.searchQuery)))
+		t.refreshChatView()
+		return
+	}
+	t.inputField.SetText(match)
+}
+
+// endHistorySearch leaves Ctrl+R mode, keeping the match unless restore is
+// set, in which case the original query text is put back.
+func (t *tuiApp) endHistorySearch(restore bool) {
+	t.searching = false
+	t.inputField.SetLabel(t.theme.apply(inputLabel))
+	if restore {
+		t.inputField.SetText(t.searchQuery)
+	}
+	t.history.reset()
+}
+
 func (t *tuiApp) scrollFocusedPane(delta int) {
 	var tv *tview.TextView
 	if t.filePath != "" && t.focus == focusFileViewer {
@@ -326,22 +599,54 @@ func (t *tuiApp) setupMouseCapture() {
 				return nil, 0
 			}
 
+		case tview.MouseLeftDown:
+			t.dragAnchor = t.chatLineAt(mx, my)
+
+		case tview.MouseMove:
+			if t.dragAnchor < 0 || event.Buttons()&tcell.Button1 == 0 {
+				break
+			}
+			if line := t.chatLineAt(mx, my); line >= 0 && (line != t.dragAnchor || t.selecting) {
+				t.selecting = true
+				t.selPending = false
+				t.selAnchor = t.dragAnchor
+				t.selCursor = line
+				t.refreshChatView()
+				t.updateStatusBar()
+				return nil, 0
+			}
+
+		case tview.MouseLeftUp:
+			t.dragAnchor = -1
+
 		case tview.MouseLeftClick:
 			// Check if click is in chat area for tool call click-to-open
 			cx, cy, cw, ch := t.chatView.GetRect()
 			if mx >= cx && mx < cx+cw && my >= cy && my < cy+ch {
 				row, _ := t.chatView.GetScrollOffset()
-				displayLine := row + (my - cy)
-				logicalLine := t.displayLineToLogicalLine(displayLine)
+				logicalLine, text := t.chatRowAt(row + (my - cy))
 				if logicalLine >= 0 {
 					if call, ok := t.toolCallLines[logicalLine]; ok {
 						path := extractFilePath(call)
 						if path != "" {
 							t.focus = focusFileViewer
-							go t.loadFileViewer(path)
+							go t.loadFileViewer(path, 0)
+							return nil, 0
+						}
+					}
+					// A collapsed result expands first; after that its
+					// path:line references (e.g. grep hits) open the file.
+					_, isResult := t.toolResults[logicalLine]
+					if !isResult || t.expanded[logicalLine] {
+						if path, line, ok := parseFileRef(text); ok {
+							t.focus = focusFileViewer
+							go t.loadFileViewer(path, line)
 							return nil, 0
 						}
 					}
+					if t.toggleToolResult(logicalLine) {
+						return nil, 0
+					}
 				}
 				t.focus = focusChat
 			}
@@ -367,12 +672,34 @@ func (t *tuiApp) handleEnter(text string) {
 		return
 	}
 
-	if t.handleSlashCommand(text) {
+	display := text
+	if task, ok := strings.CutPrefix(text, "/plan "); ok && t.agentMode && strings.TrimSpace(task) != "" {
+		text = strings.TrimSpace(task)
+		display = text
+		t.planOnce = true
+	} else if text == "/init" && t.agentMode {
+		text = initPrompt
+	} else if t.handleSlashCommand(text) {
+		if !t.summarizing {
+			t.warnIfContextFull()
+			t.updateContextGauge()
+		}
 		t.refreshChatView()
 		return
 	}
 
-	t.addLine(fmt.Sprintf(" [blue::b]>>>[white] %s", tview.Escape(text)))
+	t.addLine(fmt.Sprintf(" [blue::b]>>>[white] %s", tview.Escape(display)))
+	if t.piped != nil {
+		t.addLine("[gray::-]  " + tview.Escape(t.piped.summary()) + "[-:-:-]")
+		text = t.piped.attach(text)
+		t.piped = nil
+	}
+	var images []string
+	for _, img := range t.images {
+		t.addLine(fmt.Sprintf("[gray::-]  + %s[-:-:-]", tview.Escape(img.name)))
+		images = append(images, img.url)
+	}
+	t.images = nil
 	t.addLine("")
 	t.refreshChatView()
 
@@ -382,6 +709,7 @@ func (t *tuiApp) handleEnter(text string) {
 	t.currentIterOutput = 0
 	t.lastInputTokens = 0
 	t.lastOutputTokens = 0
+	t.usageExact = false
 	t.startProgressTicker()
 	t.iterStartTime = time.Now()
 	t.estimatedDur = 0
@@ -389,9 +717,9 @@ func (t *tuiApp) handleEnter(text string) {
 	t.streaming.Reset()
 
 	if t.agentMode {
-		go t.startAgentTurn(text)
+		go t.startAgentTurn(text, images)
 	} else {
-		go t.startChatTurn(text)
+		go t.startChatTurn(text, images)
 	}
 }
 
@@ -401,82 +729,378 @@ func (t *tuiApp) handleSlashCommand(input string) bool {
 	switch {
 	case input == "/clear":
 		t.mgr.Clear()
+		if t.session != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  Detached from session %s; it keeps its history.[-:-:-]", t.session.id))
+			t.session = nil
+		}
 		t.lines = nil
 		t.toolResults = make(map[int]string)
 		t.toolCallLines = make(map[int]api.ToolCall)
+		t.callResults = make(map[int]int)
+		t.callLineByID = make(map[string]int)
+		t.expanded = make(map[int]bool)
+		t.reasoning = make(map[int]bool)
 		t.closeFileViewer()
 		t.addLine("[gray::-]  History cleared.[-:-:-]")
 		t.addLine("")
 		return true
 
-	case input == "/compact":
+	case input == "/compact" || strings.HasPrefix(input, "/compact "):
 		if !t.agentMode {
 			t.addLine("[gray::-]  /compact is only available in agent mode.[-:-:-]")
 			t.addLine("")
 			return true
 		}
-		if t.mgr.NeedsSummary() {
-			t.addLine("[gray::-]  [compacting...][-:-:-]")
-			if err := t.mgr.Summarize(context.Background(), chatctx.CompletionFunc(t.completeFn)); err != nil {
-				t.addLine(fmt.Sprintf("[gray::-]  Compact failed: %v[-:-:-]", err))
+		opts, err := parseCompactArgs(strings.TrimPrefix(input, "/compact"))
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  %v[-:-:-]", err))
+			t.addLine("")
+			return true
+		}
+		if opts.DryRun || opts.ToolsOnly {
+			report, err := t.mgr.Compact(context.Background(), t.summarizeFn, opts)
+			t.showCompactReport(opts, report, err)
+			return true
+		}
+		var report chatctx.CompactReport
+		t.summarizeInBackground(func(ctx context.Context) (err error) {
+			report, err = t.mgr.Compact(ctx, t.summarizeFn, opts)
+			return err
+		}, func(err error) {
+			t.showCompactReport(opts, report, err)
+		})
+		return true
+
+	case input == "/pull" || strings.HasPrefix(input, "/pull "):
+		ref := strings.TrimSpace(strings.TrimPrefix(input, "/pull"))
+		switch {
+		case ref == "":
+			t.addLine("[gray::-]  Usage: /pull <owner>/<repo>/<file>.gguf | <url>[-:-:-]")
+		case t.pullStatus != "":
+			t.addLine("[gray::-]  A download is already in progress.[-:-:-]")
+		default:
+			t.pullStatus = "pull: resolving"
+			t.updateStatusBar()
+			go t.startPull(ref)
+		}
+		t.addLine("")
+		return true
+
+	case input == "/theme" || strings.HasPrefix(input, "/theme "):
+		name := strings.TrimSpace(strings.TrimPrefix(input, "/theme"))
+		if name == "" {
+			t.addLine(fmt.Sprintf("[gray::-]  Theme: %s (available: %s)[-:-:-]", t.theme.Name, strings.Join(availableThemes(), ", ")))
+			t.addLine("")
+			return true
+		}
+		th, err := loadTheme(name)
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+			t.addLine("")
+			return true
+		}
+		t.setTheme(th)
+		t.addLine(fmt.Sprintf("[gray::-]  Theme set to %s.[-:-:-]", th.Name))
+		t.addLine("")
+		return true
+
+	case input == "/stats":
+		for _, line := range t.stats.lines() {
+			t.addLine(line)
+		}
+		t.addLine("")
+		return true
+
+	case input == "/profile" || strings.HasPrefix(input, "/profile "):
+		t.switchProfile(strings.TrimSpace(strings.TrimPrefix(input, "/profile")))
+		return true
+
+	case input == "/speak":
+		t.toggleRecording()
+		return true
+
+	case input == "/think":
+		t.showReasoning = !t.showReasoning
+		for line := range t.reasoning {
+			if t.showReasoning {
+				t.expanded[line] = true
+			} else {
+				delete(t.expanded, line)
+			}
+		}
+		if t.showReasoning {
+			t.addLine("[gray::-]  Showing the model's reasoning.[-:-:-]")
+		} else {
+			t.addLine("[gray::-]  Hiding the model's reasoning.[-:-:-]")
+		}
+		t.addLine("")
+		return true
+
+	case input == "/set" || strings.HasPrefix(input, "/set "):
+		args := strings.Fields(strings.TrimPrefix(input, "/set"))
+		switch len(args) {
+		case 0:
+			t.addLine("[gray::-]  Sampling parameters (/set <name> default restores one):[-:-:-]")
+			for _, line := range t.sampling.describe() {
+				t.addLine(fmt.Sprintf("[gray::-]    %s[-:-:-]", tview.Escape(line)))
+			}
+		case 2:
+			if err := t.sampling.set(args[0], args[1]); err != nil {
+				t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
 			} else {
-				budget := t.mgr.Budget()
-				t.addLine(fmt.Sprintf("[gray::-]  Compacted. %d tokens free (%d%%)[-:-:-]",
-					budget.Available, budget.Available*100/budget.Total))
+				t.addLine(fmt.Sprintf("[gray::-]  %s set to %s.[-:-:-]", args[0], tview.Escape(args[1])))
+			}
+		default:
+			t.addLine("[gray::-]  Usage: /set <name> <value|default>, e.g. /set temperature 0.2[-:-:-]")
+		}
+		t.addLine("")
+		return true
+
+	case input == "/model" || input == "/model list":
+		t.addLine("[gray::-]  Listing models...[-:-:-]")
+		go t.listModels()
+		return true
+
+	case strings.HasPrefix(input, "/model use"):
+		name := strings.TrimSpace(strings.TrimPrefix(input, "/model use"))
+		switch {
+		case name == "":
+			t.addLine("[gray::-]  Usage: /model use <name> (see /model list)[-:-:-]")
+			t.addLine("")
+		case t.switchingModel:
+			t.addLine("[gray::-]  A model switch is already in progress.[-:-:-]")
+			t.addLine("")
+		case t.processing:
+			t.addLine("[gray::-]  Wait for the current turn to finish before switching models.[-:-:-]")
+			t.addLine("")
+		default:
+			t.switchingModel = true
+			t.addLine(fmt.Sprintf("[gray::-]  Loading %s...[-:-:-]", tview.Escape(name)))
+			go t.switchModel(name)
+		}
+		return true
+
+	case input == "/copy-last":
+		code, ok := lastCodeBlock(t.mgr.History())
+		if !ok {
+			t.addLine("[gray::-]  No code block in the assistant's replies.[-:-:-]")
+			t.addLine("")
+			return true
+		}
+		t.copyText(code, "the last code block")
+		return true
+
+	case input == "/attach" || strings.HasPrefix(input, "/attach "):
+		path := strings.TrimSpace(strings.TrimPrefix(input, "/attach"))
+		switch {
+		case path == "" && len(t.images) == 0:
+			t.addLine("[gray::-]  Usage: /attach <image> (needs a model with an mmproj); /attach clear drops attached images[-:-:-]")
+		case path == "":
+			t.addLine("[gray::-]  Attached to your next message:[-:-:-]")
+			for _, img := range t.images {
+				t.addLine(fmt.Sprintf("[gray::-]    %s (%s)[-:-:-]", tview.Escape(img.name), formatBytes(img.size)))
+			}
+		case path == "clear":
+			t.images = nil
+			t.addLine("[gray::-]  Attachments dropped.[-:-:-]")
+		default:
+			img, err := readImage(path)
+			if err != nil {
+				t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+				break
 			}
+			t.images = append(t.images, img)
+			t.addLine(fmt.Sprintf("[gray::-]  Attached %s (%s); it goes with your next message.[-:-:-]", tview.Escape(img.name), formatBytes(img.size)))
+		}
+		t.addLine("")
+		return true
+
+	case input == "/open" || strings.HasPrefix(input, "/open "):
+		path := strings.TrimSpace(strings.TrimPrefix(input, "/open"))
+		if path == "" {
+			t.addLine("[gray::-]  Usage: /open <path>[-:-:-]")
+			t.addLine("")
+			return true
+		}
+		line := 0
+		if p, l, ok := parseFileRef(path); ok {
+			path, line = p, l
+		}
+		go t.loadFileViewer(path, line)
+		return true
+
+	case input == "/init":
+		// In agent mode handleEnter sends initPrompt instead.
+		t.addLine("[gray::-]  /init is only available in agent mode.[-:-:-]")
+		t.addLine("")
+		return true
+
+	case input == "/plan" || strings.HasPrefix(input, "/plan "):
+		if !t.agentMode {
+			t.addLine("[gray::-]  /plan is only available in agent mode.[-:-:-]")
 		} else {
-			t.addLine("[gray::-]  Nothing to compact.[-:-:-]")
+			t.planMode = !t.planMode
+			if t.planMode {
+				t.addLine("[gray::-]  Plan mode on: the agent explores read-only and asks before changing anything.[-:-:-]")
+			} else {
+				t.addLine("[gray::-]  Plan mode off.[-:-:-]")
+			}
 		}
 		t.addLine("")
 		return true
 
 	case input == "/help":
 		t.addLine("[gray::-]  Commands:[-:-:-]")
-		t.addLine("[gray::-]    /clear              Clear conversation history[-:-:-]")
-		t.addLine("[gray::-]    /compact            Summarize to free context[-:-:-]")
-		t.addLine("[gray::-]    /tokens             Show token budget[-:-:-]")
-		t.addLine("[gray::-]    /context add <path> Load file into context[-:-:-]")
-		t.addLine("[gray::-]    /context list       Show loaded files[-:-:-]")
-		t.addLine("[gray::-]    /context clear      Remove all context files[-:-:-]")
-		t.addLine("[gray::-]    /memory             List recent memories[-:-:-]")
-		t.addLine("[gray::-]    /memory search <q>  Search memories[-:-:-]")
-		t.addLine("[gray::-]    /memory forget <id> Delete a memory[-:-:-]")
-		t.addLine("[gray::-]    /memory clear       Clear all memories[-:-:-]")
-		t.addLine("[gray::-]    /quit, /exit        Exit[-:-:-]")
+		for _, c := range slashCommands {
+			t.addLine(fmt.Sprintf("[gray::-]    %-19s %s[-:-:-]", tview.Escape(c.usage()), c.desc))
+		}
+		t.addLine("[gray::-]  Keys:[-:-:-]")
+		t.addLine("[gray::-]    Up/Down             Recall previous prompts[-:-:-]")
+		t.addLine("[gray::-]    Tab                 Complete the selected /command or path[-:-:-]")
+		t.addLine("[gray::-]                        (otherwise: expand/collapse the latest tool result)[-:-:-]")
+		t.addLine("[gray::-]    click a tool line   Expand/collapse its result (Enter in selection mode)[-:-:-]")
+		t.addLine("[gray::-]    click path:line     Open the file viewer at that line[-:-:-]")
+		t.addLine("[gray::-]    / , n/N             Search the file viewer (when focused), next/prev match[-:-:-]")
+		t.addLine("[gray::-]    e                   Edit the viewed file in $EDITOR (when focused)[-:-:-]")
+		t.addLine("[gray::-]    Ctrl+R              Fuzzy search prompt history (again for older)[-:-:-]")
+		t.addLine("[gray::-]    Ctrl+T              Record speech, again to transcribe it (Esc cancels)[-:-:-]")
+		t.addLine("[gray::-]    PgUp/PgDn, mouse    Scroll the chat[-:-:-]")
+		t.addLine("[gray::-]    v, mouse drag       Select chat lines (j/k extend, y copy, Esc cancel)[-:-:-]")
 		t.addLine("")
 		return true
 	}
 
-	var buf strings.Builder
-	if handleREPLCommand(&buf, input, t.mgr, t.client, t.memoryEnabled) {
-		for _, line := range strings.Split(buf.String(), "\n") {
-			if line != "" {
-				t.addLine("[gray::-]  " + tview.Escape(line) + "[-:-:-]")
-			}
+	// Following a training run lasts as long as the run; show it in the
+	// status bar like a download and keep the chat usable.
+	if runID, follow := parseFollow(input); follow && runID != "" && t.memoryEnabled {
+		if t.trainStatus != "" {
+			t.addLine("[gray::-]  Already following a training run.[-:-:-]")
+		} else {
+			t.addLine(fmt.Sprintf("[gray::-]  Following run %s in the status bar.[-:-:-]", tview.Escape(runID)))
+			t.trainStatus = "train: connecting"
+			t.updateStatusBar()
+			go t.followTraining(runID)
 		}
 		t.addLine("")
 		return true
 	}
 
+	// Compaction runs the model over every duplicate cluster, which can take
+	// a while; keep the UI responsive and report when it finishes.
+	if input == "/memory compact" && t.memoryEnabled {
+		t.addLine("[gray::-]  Compacting memories...[-:-:-]")
+		go func() {
+			var buf strings.Builder
+			handleREPLCommand(&buf, input, t.mgr, t.client, t.memoryEnabled)
+			t.app.QueueUpdateDraw(func() {
+				t.addCommandOutput(buf.String())
+				t.refreshChatView()
+			})
+		}()
+		return true
+	}
+
+	var buf strings.Builder
+	if handleREPLCommand(&buf, input, t.mgr, t.client, t.memoryEnabled) {
+		t.addCommandOutput(buf.String())
+		return true
+	}
+
 	return false
 }
 
+// showCompactReport describes what /compact condensed, or would have.
+func (t *tuiApp) showCompactReport(opts chatctx.CompactOptions, report chatctx.CompactReport, err error) {
+	total := t.mgr.Budget().Total
+	switch {
+	case errors.Is(err, context.Canceled):
+		t.addLine("[gray::-]  Compact cancelled.[-:-:-]")
+	case err != nil:
+		t.addLine(fmt.Sprintf("[gray::-]  Compact failed: %v[-:-:-]", err))
+	case report.Messages == 0:
+		t.addLine("[gray::-]  Nothing to compact.[-:-:-]")
+	default:
+		what := fmt.Sprintf("%d messages (%d tokens)", report.Messages, report.Tokens)
+		if opts.ToolsOnly {
+			what = fmt.Sprintf("%d tool results (%d tokens)", report.Messages, report.Tokens)
+		}
+		free := fmt.Sprintf("%d → %d tokens free (%d%%)", report.FreeBefore, report.FreeAfter, report.FreeAfter*100/max(total, 1))
+		switch {
+		case opts.DryRun && opts.ToolsOnly:
+			t.addLine(fmt.Sprintf("[gray::-]  Would collapse %s: %s.[-:-:-]", what, free))
+		case opts.DryRun:
+			t.addLine(fmt.Sprintf("[gray::-]  Would summarize %s: %s, less the new summary.[-:-:-]", what, free))
+		case opts.ToolsOnly:
+			t.addLine(fmt.Sprintf("[gray::-]  Collapsed %s: %s.[-:-:-]", what, free))
+		default:
+			t.addLine(fmt.Sprintf("[gray::-]  Summarized %s: %s.[-:-:-]", what, free))
+		}
+	}
+	t.updateContextGauge()
+	t.addLine("")
+}
+
+// addCommandOutput shows the plain-text output of a REPL command.
+func (t *tuiApp) addCommandOutput(out string) {
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			t.addLine("[gray::-]  " + tview.Escape(line) + "[-:-:-]")
+		}
+	}
+	t.addLine("")
+}
+
+// answerPlan resolves a pending plan approval from the user's input.
+func (t *tuiApp) answerPlan(answer string) {
+	approved := strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+	if approved {
+		t.addLine("[gray::-]  Plan approved.[-:-:-]")
+		t.statusText = "Executing plan..."
+	} else {
+		t.addLine("[gray::-]  Plan discarded.[-:-:-]")
+	}
+	t.planReply <- approved
+	t.planReply = nil
+	t.updateStatusBar()
+	t.refreshChatView()
+}
+
+// refreshContextFiles reloads pinned context files that changed on disk,
+// typically because the agent edited them during the previous turn, and
+// loads project instructions written since (e.g. by /init).
+func (t *tuiApp) refreshContextFiles() {
+	for _, path := range t.mgr.RefreshContextFiles() {
+		t.addLine(fmt.Sprintf("[gray::-]  Reloaded context file %s[-:-:-]", tview.Escape(path)))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		for _, path := range t.mgr.LoadInstructions(wd) {
+			t.addLine(fmt.Sprintf("[gray::-]  Loaded project instructions %s[-:-:-]", tview.Escape(path)))
+		}
+	}
+}
+
 // ── Chat Turn (non-agent, streaming) ────────────────────────────────────
 
-func (t *tuiApp) startChatTurn(input string) {
-	t.mgr.Append(api.Message{Role: "user", Content: input})
+func (t *tuiApp) startChatTurn(input string, images []string) {
+	t.refreshContextFiles()
+	t.mgr.RefreshEnvironment()
+	t.mgr.Append(api.Message{Role: "user", Content: input, Images: images})
 	windowedMsgs := t.mgr.Messages()
 
 	// Estimate input tokens
 	inputTokens := t.mgr.Estimator().EstimateMessages(windowedMsgs)
 	t.currentIterTokens = inputTokens
 	t.lastInputTokens = inputTokens
+	t.usageExact = false
 	t.currentIterOutput = 0
 	t.estimatedDur = t.predictDuration(inputTokens)
-	t.app.QueueUpdateDraw(func() { t.updateStatusBar() })
+	t.app.QueueUpdateDraw(func() {
+		t.updateContextGauge()
+		t.updateStatusBar()
+	})
 
 	req := &api.ChatCompletionRequest{
-		Model:    t.modelName,
+		Model:    t.currentModel(),
 		Messages: windowedMsgs,
 		Stream:   true,
 	}
@@ -486,7 +1110,7 @@ func (t *tuiApp) startChatTurn(input string) {
 	t.turnCancel = turnCancel
 	t.mu.Unlock()
 
-	events, err := t.client.StreamCompletion(turnCtx, req)
+	events, err := t.streamFn(turnCtx, req)
 	if err != nil {
 		turnCancel()
 		t.mu.Lock()
@@ -498,7 +1122,21 @@ func (t *tuiApp) startChatTurn(input string) {
 		return
 	}
 
-	var full strings.Builder
+	var full, thought strings.Builder
+	var splitter reasoning.Splitter
+	var usage *api.Usage
+	// showThought adds the reasoning gathered so far above the reply.
+	showThought := func() {
+		if thought.Len() == 0 {
+			return
+		}
+		text := thought.String()
+		thought.Reset()
+		t.app.QueueUpdateDraw(func() {
+			t.addReasoning(text)
+			t.refreshChatView()
+		})
+	}
 	for ev := range events {
 		if ev.Err != nil {
 			turnCancel()
@@ -514,21 +1152,44 @@ func (t *tuiApp) startChatTurn(input string) {
 		if ev.Done {
 			break
 		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
+		if ev.Status != nil {
+			status := *ev.Status
+			t.app.QueueUpdateDraw(func() { t.showStreamStatus(status) })
+		}
 		if ev.Chunk == nil {
 			continue
 		}
 		for _, choice := range ev.Chunk.Choices {
-			if choice.Delta.Content != "" {
-				full.WriteString(choice.Delta.Content)
-				t.currentIterOutput += len(choice.Delta.Content)
+			text, thinking := splitter.Split(choice.Delta.Content)
+			if thinking += choice.Delta.ReasoningContent; thinking != "" {
+				if thought.Len() == 0 {
+					t.app.QueueUpdateDraw(func() {
+						t.statusText = "Thinking..."
+						t.updateStatusBar()
+					})
+				}
+				thought.WriteString(thinking)
+				t.currentIterOutput += len(thinking)
+			}
+			if text != "" {
+				showThought()
+				full.WriteString(text)
+				t.currentIterOutput += len(text)
 				t.app.QueueUpdateDraw(func() {
-					t.streaming.WriteString(choice.Delta.Content)
+					t.streaming.WriteString(text)
 					t.updateStreamingLine()
 					t.refreshChatView()
 				})
 			}
 		}
 	}
+	text, thinking := splitter.Flush()
+	thought.WriteString(thinking)
+	showThought()
+	full.WriteString(text)
 	turnCancel()
 	t.mu.Lock()
 	t.turnCancel = nil
@@ -536,52 +1197,63 @@ func (t *tuiApp) startChatTurn(input string) {
 
 	content := full.String()
 	t.app.QueueUpdateDraw(func() {
+		if usage != nil {
+			t.applyUsage(*usage)
+		}
 		t.handleStreamDone(content, nil)
 	})
 }
 
+// describeTurnError explains why a turn failed, with a hint for the error
+// kinds the user can do something about.
+func describeTurnError(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled) || api.IsCode(err, api.CodeCancelled):
+		return "[interrupted]"
+	case api.IsCode(err, api.CodeContextExceeded):
+		return fmt.Sprintf("Error: %v (the conversation no longer fits the model's context; try /compact or /clear)", err)
+	case api.IsCode(err, api.CodeModelNotLoaded):
+		return fmt.Sprintf("Error: %v (load one with /model use <name>)", err)
+	case api.IsCode(err, api.CodeGPUUnavailable):
+		return fmt.Sprintf("Error: %v (the GPU server is not running)", err)
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
 func (t *tuiApp) handleStreamDone(content string, err error) {
+	t.lastRun = ""
 	t.recordIterationEnd()
 	t.stopProgressTicker()
 	t.processing = false
 	t.statusText = ""
 
 	if err != nil {
-		if strings.Contains(err.Error(), "context canceled") {
-			t.addLine("[gray::-]  [interrupted][-:-:-]")
-		} else {
-			t.addLine(fmt.Sprintf("[gray::-]  Error: %v[-:-:-]", err))
-		}
+		t.addLine("[gray::-]  " + describeTurnError(err) + "[-:-:-]")
 	}
 
 	if content != "" {
 		t.mgr.Append(api.Message{Role: "assistant", Content: content})
 
 		// Replace raw streaming lines with rendered markdown
-		streamStart := len(t.lines)
-		for i := len(t.lines) - 1; i >= 0; i-- {
-			if strings.Contains(t.lines[i], ">>>") {
-				streamStart = i + 2
-				break
-			}
-		}
-		if streamStart > len(t.lines) {
-			streamStart = len(t.lines)
-		}
 		rendered := fmt.Sprintf(" [purple::b] * [-:-:-]%s", t.renderMarkdown(content))
-		t.lines = append(t.lines[:streamStart], strings.Split(rendered, "\n")...)
+		t.lines = append(t.lines[:t.streamStart()], strings.Split(rendered, "\n")...)
 	}
 
 	t.streaming.Reset()
+	t.syncSession()
 	t.addLine("")
+	t.warnIfContextFull()
+	t.updateContextGauge()
 	t.refreshChatView()
 	t.updateStatusBar()
 }
 
 // ── Agent Turn ──────────────────────────────────────────────────────────
 
-func (t *tuiApp) startAgentTurn(input string) {
-	t.mgr.Append(api.Message{Role: "user", Content: input})
+func (t *tuiApp) startAgentTurn(input string, images []string) {
+	t.refreshContextFiles()
+	t.mgr.RefreshEnvironment()
+	t.mgr.Append(api.Message{Role: "user", Content: input, Images: images})
 
 	if t.memoryEnabled {
 		results, err := t.client.MemorySearch(context.Background(), input, 3)
@@ -600,21 +1272,39 @@ func (t *tuiApp) startAgentTurn(input string) {
 		}
 	}
 
-	if t.mgr.NeedsSummary() {
-		_ = t.mgr.Summarize(context.Background(), chatctx.CompletionFunc(t.completeFn))
-	}
-
-	windowedMsgs := t.mgr.Messages()
-
+	// Ctrl+C cancels a summary as well as the turn.
 	turnCtx, turnCancel := context.WithCancel(context.Background())
 	t.mu.Lock()
 	t.turnCancel = turnCancel
 	t.mu.Unlock()
 
+	if t.mgr.NeedsSummary() {
+		_ = t.mgr.Summarize(turnCtx, t.summarizeFn)
+	}
+
+	windowedMsgs := t.mgr.Messages()
+	// The agent loop works on windowedMsgs, so the manager is not touched
+	// again until handleTurnDone.
+	t.app.QueueUpdateDraw(func() {
+		t.updateContextGauge()
+		t.updateStatusBar()
+	})
+
 	toolCount := 0
-	var contentBuf strings.Builder
+	var contentBuf, reasoningBuf strings.Builder
 
+	flushReasoning := func() {
+		if reasoningBuf.Len() > 0 {
+			text := reasoningBuf.String()
+			reasoningBuf.Reset()
+			t.app.QueueUpdateDraw(func() {
+				t.addReasoning(text)
+				t.refreshChatView()
+			})
+		}
+	}
 	flushContent := func() {
+		flushReasoning()
 		if contentBuf.Len() > 0 {
 			text := contentBuf.String()
 			contentBuf.Reset()
@@ -631,14 +1321,56 @@ func (t *tuiApp) startAgentTurn(input string) {
 		}
 	}
 
+	planFirst := t.planMode || t.planOnce
+	t.planOnce = false
+
 	cfg := agent.StreamingConfig{
 		Config: agent.Config{
-			MaxIterations: t.maxIterations,
-			Tools:         t.registry,
+			MaxIterations:  t.maxIterations,
+			Tools:          t.registry,
+			MaxTokens:      t.mgr.PromptBudget(),
+			TokenEstimator: t.mgr.Estimator(),
+			Compact: func(ctx context.Context, msgs []api.Message, start int) ([]api.Message, error) {
+				t.app.QueueUpdateDraw(func() {
+					t.statusText = "Compacting turn..."
+					t.updateStatusBar()
+				})
+				return t.mgr.CompactTurn(ctx, t.summarizeFn, msgs, start)
+			},
+			PlanFirst:  planFirst,
+			RouteTools: t.routeTools,
+			ConfirmPlan: func(plan string) bool {
+				flushContent()
+				reply := make(chan bool, 1)
+				t.app.QueueUpdateDraw(func() {
+					if strings.TrimSpace(plan) == "" {
+						t.addLine("[gray::-]  The agent did not produce a plan.[-:-:-]")
+					}
+					t.addLine("[yellow::b]  Proceed with this plan? [y/N][-:-:-]")
+					t.planReply = reply
+					t.statusText = "Awaiting plan approval"
+					t.updateStatusBar()
+					t.refreshChatView()
+				})
+				select {
+				case ok := <-reply:
+					return ok
+				case <-turnCtx.Done():
+					return false
+				}
+			},
 			Hooks: agent.Hooks{
-				OnToolCall: func(call api.ToolCall) {
-					flushContent()
-					toolCount++
+				OnToolsRouted: func(names []string) {
+					line := "[gray::-]  Tools: " + tview.Escape(strings.Join(names, ", ")) + "[-:-:-]"
+					t.app.QueueUpdateDraw(func() {
+						t.addLine(line)
+						t.refreshChatView()
+					})
+				},
+				OnToolCall: func(call api.ToolCall) {
+					t.transcript.ToolCall(call)
+					flushContent()
+					toolCount++
 					t.currentIterOutput += len(call.Function.Name) + len(call.Function.Arguments)
 					display := fmt.Sprintf("%d tools | %s", toolCount, call.Function.Name)
 					name := call.Function.Name
@@ -646,6 +1378,7 @@ func (t *tuiApp) startAgentTurn(input string) {
 						t.statusText = display
 						t.updateStatusBar()
 						idx := len(t.lines)
+						t.callLineByID[call.ID] = idx
 						if name == "file_read" || name == "file_write" || name == "patch_file" {
 							path := extractFilePath(call)
 							label := "[gray::-]    > " + tview.Escape(display) + " [-:-:-][#00afff::u]" + tview.Escape(path) + "[::U][-:-:-]"
@@ -658,6 +1391,7 @@ func (t *tuiApp) startAgentTurn(input string) {
 					})
 				},
 				OnToolResult: func(call api.ToolCall, result string) {
+					t.transcript.ToolResult(call, result)
 					t.app.QueueUpdateDraw(func() {
 						preview := strings.TrimSpace(result)
 						preview = strings.Join(strings.Fields(preview), " ")
@@ -667,15 +1401,31 @@ func (t *tuiApp) startAgentTurn(input string) {
 						idx := len(t.lines)
 						t.addLine("[gray::-]      " + tview.Escape(preview) + "[-:-:-]")
 						t.toolResults[idx] = result
+						if callLine, ok := t.callLineByID[call.ID]; ok {
+							t.callResults[callLine] = idx
+						}
 						t.refreshChatView()
 					})
 				},
 				OnAssistantMessage: func(content string) {
 					// Content already flushed via OnContentDelta; ignore.
 				},
+				OnRetry: func(attempt, maxAttempts int, err error) {
+					// The retry streams the reply again from the start.
+					contentBuf.Reset()
+					reasoningBuf.Reset()
+					status := fmt.Sprintf("retrying (%d/%d)…", attempt, maxAttempts)
+					t.app.QueueUpdateDraw(func() {
+						t.statusText = status
+						t.updateStatusBar()
+						t.addLine("[gray::-]  " + tview.Escape(fmt.Sprintf("%v; %s", err, status)) + "[-:-:-]")
+						t.refreshChatView()
+					})
+				},
 			},
+			Retry: agent.DefaultRetry,
 		},
-		OnIterationStart: func(iteration, maxIter int, messages []api.Message) {
+		OnIterationStart: func(iteration, maxIter int, messages []api.Message, _ *api.Usage) {
 			flushContent()
 			t.app.QueueUpdateDraw(func() {
 				// Record previous iteration duration
@@ -685,6 +1435,7 @@ func (t *tuiApp) startAgentTurn(input string) {
 				inputTokens := t.mgr.Estimator().EstimateMessages(messages)
 				t.currentIterTokens = inputTokens
 				t.lastInputTokens = inputTokens
+				t.usageExact = false
 				t.currentIterOutput = 0
 
 				// Start timing this iteration
@@ -710,9 +1461,26 @@ func (t *tuiApp) startAgentTurn(input string) {
 			})
 		},
 		OnContentDelta: func(delta string) {
+			flushReasoning()
 			t.currentIterOutput += len(delta)
 			contentBuf.WriteString(delta)
 		},
+		OnReasoningDelta: func(delta string) {
+			if contentBuf.Len() > 0 {
+				flushContent()
+			}
+			t.currentIterOutput += len(delta)
+			reasoningBuf.WriteString(delta)
+		},
+		OnStatus: func(status api.StreamStatus) {
+			t.app.QueueUpdateDraw(func() { t.showStreamStatus(status) })
+		},
+		OnUsage: func(usage api.Usage) {
+			t.app.QueueUpdateDraw(func() {
+				t.applyUsage(usage)
+				t.updateStatusBar()
+			})
+		},
 	}
 
 	result, err := agent.RunStreaming(turnCtx, t.streamFn, windowedMsgs, cfg)
@@ -727,22 +1495,20 @@ func (t *tuiApp) startAgentTurn(input string) {
 	})
 }
 
-func (t *tuiApp) handleTurnDone(result, windowedMsgs []api.Message, err error) {
+func (t *tuiApp) handleTurnDone(result *agent.RunResult, windowedMsgs []api.Message, err error) {
+	t.planReply = nil
 	t.recordIterationEnd()
 	t.stopProgressTicker()
 	t.processing = false
 	t.statusText = ""
 
 	if err != nil {
-		if strings.Contains(err.Error(), "context canceled") {
-			t.addLine("[gray::-]  [interrupted][-:-:-]")
-		} else {
-			t.addLine(fmt.Sprintf("[gray::-]  Error: %v[-:-:-]", err))
-		}
+		t.addLine("[gray::-]  " + describeTurnError(err) + "[-:-:-]")
 	}
 
-	if len(result) > len(windowedMsgs) {
-		newMsgs := result[len(windowedMsgs):]
+	t.lastRun = runSummary(result)
+	t.stats.add(result)
+	if newMsgs := result.NewMessages(len(windowedMsgs)); len(newMsgs) > 0 {
 		t.mgr.AppendMany(newMsgs)
 
 		var finalContent string
@@ -782,15 +1548,187 @@ func (t *tuiApp) handleTurnDone(result, windowedMsgs []api.Message, err error) {
 			if assistContent != "" && userInput != "" {
 				client := t.client
 				go func() {
-					_, _ = client.MemoryStore(context.Background(), userInput, assistContent)
+					_, _ = client.MemoryStore(context.Background(), userInput, assistContent, 0)
 				}()
 			}
 		}
 	}
 
+	if t.recordTrajectories && err == nil {
+		t.recordTrajectory(windowedMsgs, result.NewMessages(len(windowedMsgs)))
+	}
+	t.addLine("[gray::-]  " + tview.Escape(t.lastRun+"; "+turnStats(result)) + "[-:-:-]")
+	t.syncSession()
 	t.addLine("")
+	t.warnIfContextFull()
+	t.updateContextGauge()
 	t.refreshChatView()
 	t.updateStatusBar()
+	if err == nil {
+		t.summarizeAhead()
+	}
+}
+
+// ── Background Summary ──────────────────────────────────────────────────
+
+// summarizeAhead starts a background summary once the history fills
+// --summarize-at of the space left for it, condensing it to half that so
+// the next turns need not wait for one.
+func (t *tuiApp) summarizeAhead() {
+	if t.summarizeAt <= 0 || t.mgr.HistoryFill() < t.summarizeAt {
+		return
+	}
+	var report chatctx.CompactReport
+	t.summarizeInBackground(func(ctx context.Context) (err error) {
+		report, err = t.mgr.Compact(ctx, t.summarizeFn, chatctx.CompactOptions{Fill: t.summarizeAt / 2})
+		return err
+	}, func(err error) {
+		switch {
+		case errors.Is(err, context.Canceled):
+			t.addLine("[gray::-]  Summary cancelled; older messages will be summarized when they no longer fit.[-:-:-]")
+		case err != nil:
+			t.addLine("[gray::-]  Background summary failed: " + tview.Escape(err.Error()) + "[-:-:-]")
+		case report.Messages == 0:
+			return
+		default:
+			t.addLine(fmt.Sprintf("[gray::-]  Summarized %d older messages (%s tokens) between turns.[-:-:-]",
+				report.Messages, formatTokenCount(report.Tokens)))
+		}
+		t.addLine("")
+	})
+}
+
+// summarizeInBackground runs summarize, which condenses the manager's
+// history, off the UI goroutine. Until it ends the TUI is busy as during a
+// turn: Ctrl+C cancels it, and a message entered meanwhile is held and sent
+// afterwards. done reports the outcome on the UI goroutine.
+func (t *tuiApp) summarizeInBackground(summarize func(ctx context.Context) error, done func(err error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.turnCancel = cancel
+	t.mu.Unlock()
+	t.processing = true
+	t.summarizing = true
+	t.statusText = "Summarizing..."
+	t.lastInputTokens = 0
+	t.startProgressTicker()
+	t.iterStartTime = time.Now()
+	t.estimatedDur = 0
+	t.updateStatusBar()
+
+	go func() {
+		err := summarize(ctx)
+		cancel()
+		t.mu.Lock()
+		t.turnCancel = nil
+		t.mu.Unlock()
+
+		t.app.QueueUpdateDraw(func() {
+			t.stopProgressTicker()
+			t.processing = false
+			t.summarizing = false
+			t.statusText = ""
+			done(err)
+			if err == nil {
+				t.syncSession()
+			}
+			t.updateContextGauge()
+			t.refreshChatView()
+			t.updateStatusBar()
+			if text := t.pendingInput; text != "" {
+				t.pendingInput = ""
+				t.handleEnter(text)
+			}
+		})
+	}()
+}
+
+// showSummaryProgress puts a summary request in the status bar. The manager
+// calls it from whichever goroutine is summarizing.
+func (t *tuiApp) showSummaryProgress(messages, tokens int) {
+	t.app.QueueUpdateDraw(func() {
+		t.statusText = fmt.Sprintf("Summarizing %d messages (%s tokens)...", messages, formatTokenCount(tokens))
+		t.updateStatusBar()
+	})
+}
+
+// recordTrajectory sends a turn that called tools to the backend in the
+// background, from the user's message through the tool calls and results
+// to the reply, with the tools the model was offered. Turns without tool
+// calls are left to memory.
+func (t *tuiApp) recordTrajectory(windowedMsgs, newMsgs []api.Message) {
+	if !slices.ContainsFunc(newMsgs, func(m api.Message) bool { return len(m.ToolCalls) > 0 }) {
+		return
+	}
+	user := len(windowedMsgs) - 1
+	for user >= 0 && windowedMsgs[user].Role != "user" {
+		user--
+	}
+	if user < 0 {
+		return
+	}
+	req := api.TrajectoryRequest{
+		Model:    t.currentModel(),
+		Tools:    t.registry.APITools(),
+		Messages: append([]api.Message{windowedMsgs[user]}, newMsgs...),
+	}
+	if t.session != nil {
+		req.SessionID = t.session.id
+	}
+	client := t.client
+	go func() {
+		_, _ = client.StoreTrajectory(context.Background(), req)
+	}()
+}
+
+// syncSession pushes the turn to the attached session in the background.
+// If another client has moved the session on, this one detaches rather than
+// interleave two conversations.
+func (t *tuiApp) syncSession() {
+	link := t.session
+	if link == nil {
+		return
+	}
+	history, summary, state := t.mgr.History(), t.mgr.Summary(), t.mgr.State()
+	go func() {
+		err := link.push(context.Background(), history, summary, state)
+		if err == nil {
+			return
+		}
+		t.app.QueueUpdateDraw(func() {
+			if api.IsCode(err, api.CodeConflict) {
+				t.addLine(fmt.Sprintf("[yellow::b]  Session %s was changed by another client.[-:-:-][gray::-] Detached; restart with --session %s to continue from its history.[-:-:-]", link.id, link.id))
+				if t.session == link {
+					t.session = nil
+				}
+			} else {
+				t.addLine("[gray::-]  Session sync failed: " + tview.Escape(err.Error()) + "[-:-:-]")
+			}
+			t.addLine("")
+			t.refreshChatView()
+		})
+	}()
+}
+
+// showHistory renders the user and assistant messages of a resumed session.
+func (t *tuiApp) showHistory() {
+	for _, msg := range t.mgr.History() {
+		switch {
+		case msg.Role == "user":
+			t.addLine(fmt.Sprintf(" [blue::b]>>>[white] %s", tview.Escape(msg.Content)))
+			if n := len(msg.Images); n > 0 {
+				t.addLine(fmt.Sprintf("[gray::-]  + %d image(s)[-:-:-]", n))
+			}
+			t.addLine("")
+		case msg.Role == "assistant" && msg.Content != "":
+			rendered := fmt.Sprintf(" [purple::b] * [-:-:-]%s", t.renderMarkdown(msg.Content))
+			for _, line := range strings.Split(rendered, "\n") {
+				t.addLine(line)
+			}
+			t.addLine("")
+		}
+	}
+	t.refreshChatView()
 }
 
 // ── Content Management ──────────────────────────────────────────────────
@@ -799,71 +1737,673 @@ func (t *tuiApp) addLine(line string) {
 	t.lines = append(t.lines, line)
 }
 
+// streamStart returns the line where the streamed reply starts: after the
+// last user prefix, its blank line and any reasoning shown above the reply.
+func (t *tuiApp) streamStart() int {
+	start := len(t.lines)
+	for i := len(t.lines) - 1; i >= 0; i-- {
+		if strings.Contains(t.lines[i], ">>>") {
+			start = i + 2
+			break
+		}
+	}
+	for start < len(t.lines) && t.reasoning[start] {
+		start++
+	}
+	return min(start, len(t.lines))
+}
+
+// addReasoning adds a collapsed line holding the model's reasoning, which
+// expands like a tool result. /think shows reasoning expanded.
+func (t *tuiApp) addReasoning(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	idx := len(t.lines)
+	t.addLine(fmt.Sprintf("[gray::-]    thought for %d words (/think to show)[-:-:-]", len(strings.Fields(text))))
+	t.toolResults[idx] = text
+	t.reasoning[idx] = true
+	if t.showReasoning {
+		t.expanded[idx] = true
+	}
+}
+
 func (t *tuiApp) updateStreamingLine() {
 	content := t.streaming.String()
 	formatted := fmt.Sprintf(" [purple::b] * [-:-:-]%s", tview.Escape(content))
 	contentLines := strings.Split(formatted, "\n")
 
 	// Find where streaming started (after last user prefix + blank)
-	streamStart := len(t.lines)
-	for i := len(t.lines) - 1; i >= 0; i-- {
-		if strings.Contains(t.lines[i], ">>>") {
-			streamStart = i + 2
-			break
+	t.lines = append(t.lines[:t.streamStart()], contentLines...)
+}
+
+func (t *tuiApp) refreshChatView() {
+	lo, hi := t.selectionRange()
+	var built []string
+	for i, line := range t.lines {
+		start := len(built)
+		if full, ok := t.toolResults[i]; ok && t.expanded[i] {
+			for _, fline := range strings.Split(strings.TrimRight(full, "\n"), "\n") {
+				built = append(built, "[gray::-]      "+tview.Escape(fline)+"[-:-:-]")
+			}
+		} else {
+			built = append(built, line)
+		}
+		if i == lo {
+			built[start] = `["sel"]` + built[start]
+		}
+		if i == hi {
+			built[len(built)-1] += `[""]`
 		}
 	}
-	if streamStart > len(t.lines) {
-		streamStart = len(t.lines)
+
+	// While selecting, keep the view where the user is looking.
+	row, col := t.chatView.GetScrollOffset()
+	t.chatView.SetText(t.theme.apply(strings.Join(built, "\n")))
+	if t.selecting {
+		t.chatView.Highlight("sel")
+		t.chatView.ScrollTo(row, col)
+	} else {
+		t.chatView.Highlight()
+		t.chatView.ScrollToEnd()
 	}
+}
+
+// ── Models ──────────────────────────────────────────────────────────────
 
-	t.lines = append(t.lines[:streamStart], contentLines...)
+// currentModel returns the model requests are sent to; /model use changes
+// it while agent goroutines may be reading it.
+func (t *tuiApp) currentModel() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.modelName
 }
 
-func (t *tuiApp) refreshChatView() {
-	var content string
-	if !t.expanded || len(t.toolResults) == 0 {
-		content = strings.Join(t.lines, "\n")
-	} else {
-		var built []string
-		for i, line := range t.lines {
-			if full, ok := t.toolResults[i]; ok {
-				for _, fline := range strings.Split(strings.TrimRight(full, "\n"), "\n") {
-					built = append(built, "[gray::-]      "+tview.Escape(fline)+"[-:-:-]")
+func (t *tuiApp) listModels() {
+	resp, err := t.client.ListModels(context.Background())
+	active := t.currentModel()
+	var remotes []string
+	for alias := range t.router.Remotes {
+		remotes = append(remotes, alias)
+	}
+	sort.Strings(remotes)
+	t.app.QueueUpdateDraw(func() {
+		marker := func(name string) string {
+			if name == active {
+				return "* "
+			}
+			return "  "
+		}
+		switch {
+		case err != nil:
+			t.addLine(fmt.Sprintf("[gray::-]  Failed to list models: %s[-:-:-]", tview.Escape(err.Error())))
+		case len(resp.Data) == 0 && len(remotes) == 0:
+			t.addLine("[gray::-]  No models available.[-:-:-]")
+		default:
+			for _, m := range resp.Data {
+				t.addLine(fmt.Sprintf("[gray::-]  %s%s[-:-:-]", marker(m.ID), tview.Escape(m.ID)))
+			}
+		}
+		for _, alias := range remotes {
+			remote := t.router.Remotes[alias]
+			t.addLine(fmt.Sprintf("[gray::-]  %s%s (%s on %s)[-:-:-]", marker(alias), tview.Escape(alias), tview.Escape(remote.Model), remote.Name))
+		}
+		t.addLine("")
+		t.refreshChatView()
+	})
+}
+
+// switchModel loads name on the backend, recalibrates the token estimator
+// for its tokenizer and makes it the target of subsequent requests. Remote
+// models need no loading and keep the default token ratio.
+func (t *tuiApp) switchModel(name string) {
+	ctx := context.Background()
+	_, remote := t.router.Remote(name)
+	var err error
+	var toolFormat string
+	if !remote {
+		var loaded *api.LoadModelResponse
+		if loaded, err = t.client.LoadModel(ctx, name); err == nil {
+			toolFormat = loaded.ToolFormat
+		}
+	}
+	var calErr error
+	if err == nil {
+		t.mu.Lock()
+		t.modelName = name
+		t.mu.Unlock()
+		estimator := t.mgr.Estimator()
+		estimator.Reset()
+		if !remote {
+			calErr = estimator.Calibrate(func(text string) (int, error) {
+				return t.client.Tokenize(ctx, text)
+			})
+		}
+		if t.registry != nil {
+			t.mgr.SetToolsBudget(toolsBudget(t.router, name, toolFormat, t.registry, estimator))
+		}
+	}
+	t.app.QueueUpdateDraw(func() {
+		t.switchingModel = false
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  Failed to load %s: %s[-:-:-]", tview.Escape(name), tview.Escape(err.Error())))
+		} else {
+			// Timings from the previous model would skew progress estimates.
+			t.iterHistory = nil
+			t.lastInputTokens, t.lastOutputTokens = 0, 0
+			t.addLine(fmt.Sprintf("[gray::-]  Now using %s.[-:-:-]", tview.Escape(name)))
+			if calErr != nil {
+				t.addLine("[gray::-]  Token estimates use the default ratio (calibration unavailable).[-:-:-]")
+			}
+		}
+		t.addLine("")
+		t.updateContextGauge()
+		t.refreshChatView()
+		t.updateStatusBar()
+	})
+}
+
+// ── Voice Input ─────────────────────────────────────────────────────────
+
+// toggleRecording starts recording speech, or stops and transcribes it into
+// the input field, where it can be edited before sending.
+func (t *tuiApp) toggleRecording() {
+	if t.recorder == nil {
+		rec, err := startRecording()
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  %s[-:-:-]", tview.Escape(err.Error())))
+			t.addLine("")
+			t.refreshChatView()
+			return
+		}
+		t.recorder = rec
+		t.voiceStatus = "● recording (Ctrl+T to stop, Esc to cancel)"
+		t.updateStatusBar()
+		return
+	}
+
+	rec := t.recorder
+	t.recorder = nil
+	t.voiceStatus = "transcribing..."
+	t.updateStatusBar()
+	go func() {
+		audio, err := rec.stop()
+		var text string
+		if err == nil {
+			text, err = t.client.Transcribe(context.Background(), audio, "speech.wav", "")
+		}
+		t.app.QueueUpdateDraw(func() {
+			t.voiceStatus = ""
+			t.updateStatusBar()
+			switch {
+			case err != nil:
+				t.addLine(fmt.Sprintf("[gray::-]  Transcription failed: %s[-:-:-]", tview.Escape(err.Error())))
+				t.addLine("")
+				t.refreshChatView()
+			case text != "":
+				input := t.inputField.GetText()
+				if input != "" && !strings.HasSuffix(input, " ") {
+					input += " "
 				}
+				t.inputField.SetText(input + text)
+			}
+		})
+	}()
+}
+
+// cancelRecording stops recording and discards the audio.
+func (t *tuiApp) cancelRecording() {
+	t.recorder.cancel()
+	t.recorder = nil
+	t.voiceStatus = ""
+	t.updateStatusBar()
+}
+
+// ── Tool Results ────────────────────────────────────────────────────────
+
+// toolResultLine returns the result line for a tool call or result line.
+func (t *tuiApp) toolResultLine(line int) (int, bool) {
+	if _, ok := t.toolResults[line]; ok {
+		return line, true
+	}
+	r, ok := t.callResults[line]
+	return r, ok
+}
+
+// toggleToolResult expands or collapses the tool result belonging to line,
+// keeping the chat scrolled where it is. It reports whether line belongs to
+// a tool call.
+func (t *tuiApp) toggleToolResult(line int) bool {
+	r, ok := t.toolResultLine(line)
+	if !ok {
+		return false
+	}
+	if t.expanded[r] {
+		delete(t.expanded, r)
+	} else {
+		t.expanded[r] = true
+	}
+	row, col := t.chatView.GetScrollOffset()
+	t.refreshChatView()
+	t.chatView.ScrollTo(row, col)
+	return true
+}
+
+// toggleLatestToolResult expands or collapses the most recent tool result.
+func (t *tuiApp) toggleLatestToolResult() {
+	latest := -1
+	for line := range t.toolResults {
+		if !t.reasoning[line] {
+			latest = max(latest, line)
+		}
+	}
+	if latest >= 0 {
+		t.toggleToolResult(latest)
+	}
+}
+
+// ── Selection ───────────────────────────────────────────────────────────
+
+// selectionRange returns the selected logical lines, or -1, -1 when nothing
+// is selected.
+func (t *tuiApp) selectionRange() (int, int) {
+	if !t.selecting {
+		return -1, -1
+	}
+	return min(t.selAnchor, t.selCursor), max(t.selAnchor, t.selCursor)
+}
+
+// startSelection enters keyboard selection mode on the last non-empty line.
+func (t *tuiApp) startSelection() {
+	last := len(t.lines) - 1
+	for last > 0 && strings.TrimSpace(plainChatText(t.lines[last])) == "" {
+		last--
+	}
+	t.selecting = true
+	t.selPending = true
+	t.selAnchor, t.selCursor = last, last
+	t.refreshChatView()
+	t.scrollToChatLine(last)
+	t.updateStatusBar()
+}
+
+func (t *tuiApp) endSelection() {
+	t.selecting = false
+	t.selPending = false
+	t.refreshChatView()
+	t.updateStatusBar()
+}
+
+// handleSelectionKey handles keys while selecting: j/k or arrows extend the
+// selection, y or Enter copies it, Esc/v/q cancel. Any other key leaves
+// selection mode and reaches the input as usual.
+func (t *tuiApp) handleSelectionKey(event *tcell.EventKey) *tcell.EventKey {
+	move := 0
+	switch event.Key() {
+	case tcell.KeyUp:
+		move = -1
+	case tcell.KeyDown:
+		move = 1
+	case tcell.KeyPgUp:
+		move = -10
+	case tcell.KeyPgDn:
+		move = 10
+	case tcell.KeyEnter:
+		if !t.toggleToolResult(t.selCursor) {
+			t.copySelection()
+		}
+		return nil
+	case tcell.KeyEscape:
+		t.endSelection()
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'k':
+			move = -1
+		case 'j':
+			move = 1
+		case 'y':
+			t.copySelection()
+			return nil
+		case 'v', 'q':
+			t.endSelection()
+			return nil
+		}
+	}
+
+	if move != 0 {
+		t.selPending = false
+		t.selCursor = max(0, min(len(t.lines)-1, t.selCursor+move))
+		t.refreshChatView()
+		t.scrollToChatLine(t.selCursor)
+		return nil
+	}
+
+	// Not a selection key: the v was probably the start of a prompt.
+	pending := t.selPending
+	t.endSelection()
+	if pending && event.Key() == tcell.KeyRune {
+		t.inputField.SetText("v")
+	}
+	return event
+}
+
+// copySelection copies the selected lines as plain text and leaves
+// selection mode.
+func (t *tuiApp) copySelection() {
+	lo, hi := t.selectionRange()
+	var lines []string
+	for i := lo; i <= hi && i < len(t.lines); i++ {
+		if full, ok := t.toolResults[i]; ok && t.expanded[i] {
+			lines = append(lines, strings.TrimRight(full, "\n"))
+		} else {
+			lines = append(lines, plainChatText(t.lines[i]))
+		}
+	}
+	t.endSelection()
+	t.copyText(strings.Join(lines, "\n"), fmt.Sprintf("%d line(s)", hi-lo+1))
+}
+
+// copyText puts text on the clipboard in the background and reports the
+// outcome in the chat.
+func (t *tuiApp) copyText(text, what string) {
+	var osc52 func([]byte)
+	if t.screen != nil {
+		osc52 = t.screen.SetClipboard
+	}
+	go func() {
+		method, err := copyToClipboard(text, osc52)
+		t.app.QueueUpdateDraw(func() {
+			if err != nil {
+				t.addLine(fmt.Sprintf("[gray::-]  Copy failed: %v[-:-:-]", err))
 			} else {
-				built = append(built, line)
+				t.addLine(fmt.Sprintf("[gray::-]  Copied %s to the clipboard (%s).[-:-:-]", what, method))
 			}
+			t.addLine("")
+			t.refreshChatView()
+		})
+	}()
+}
+
+// chatLineAt returns the logical chat line under screen position x, y, or
+// -1 if the position is outside the chat view.
+func (t *tuiApp) chatLineAt(x, y int) int {
+	cx, cy, cw, ch := t.chatView.GetRect()
+	if x < cx || x >= cx+cw || y < cy || y >= cy+ch {
+		return -1
+	}
+	row, _ := t.chatView.GetScrollOffset()
+	line, _ := t.chatRowAt(row + (y - cy))
+	return line
+}
+
+// scrollToChatLine scrolls the chat view just enough to show a logical line.
+func (t *tuiApp) scrollToChatLine(line int) {
+	_, _, _, height := t.chatView.GetRect()
+	first, last := t.logicalLineToDisplayRows(line)
+	row, col := t.chatView.GetScrollOffset()
+	switch {
+	case first < row:
+		t.chatView.ScrollTo(first, col)
+	case height > 0 && last >= row+height:
+		t.chatView.ScrollTo(last-height+1, col)
+	}
+}
+
+// startPull downloads a model while the chat stays usable, reporting
+// progress in the status bar.
+func (t *tuiApp) startPull(ref string) {
+	result, err := t.client.PullModel(context.Background(), ref, func(evt api.PullProgress) {
+		if evt.Status != "downloading" {
+			return
+		}
+		bar := "pull " + formatBytes(evt.Downloaded)
+		if evt.Total > 0 {
+			const barWidth = 20
+			filled := barWidth * evt.Percent / 100
+			bar = fmt.Sprintf("pull [%s%s] %d%% %s / %s",
+				strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled),
+				evt.Percent, formatBytes(evt.Downloaded), formatBytes(evt.Total))
+		}
+		t.app.QueueUpdateDraw(func() {
+			t.pullStatus = bar
+			t.updateStatusBar()
+		})
+	})
+
+	t.app.QueueUpdateDraw(func() {
+		t.pullStatus = ""
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  Pull failed: %s[-:-:-]", tview.Escape(err.Error())))
+		} else {
+			t.addLine(fmt.Sprintf("[gray::-]  Downloaded %s[-:-:-]", tview.Escape(result.Path)))
+		}
+		t.addLine("")
+		t.refreshChatView()
+		t.updateStatusBar()
+	})
+}
+
+// followTraining shows a training run's progress in the status bar until
+// it stops training, then reports how it ended.
+func (t *tuiApp) followTraining(runID string) {
+	var losses []api.LossPoint
+	last, err := t.client.FinetuneFollow(context.Background(), runID, func(p api.FinetuneProgress) {
+		losses = append(losses, p.Losses...)
+		line := "train " + trainingProgressLine(p, losses, 15)
+		t.app.QueueUpdateDraw(func() {
+			t.trainStatus = line
+			t.updateStatusBar()
+		})
+	})
+
+	t.app.QueueUpdateDraw(func() {
+		t.trainStatus = ""
+		if err != nil {
+			t.addLine(fmt.Sprintf("[gray::-]  Following run %s failed: %s[-:-:-]", tview.Escape(runID), tview.Escape(err.Error())))
+		} else {
+			t.addLine(fmt.Sprintf("[gray::-]  %s %s[-:-:-]", tview.Escape(runID+":"), tview.Escape(trainingOutcome(last))))
+		}
+		t.addLine("")
+		t.refreshChatView()
+		t.updateStatusBar()
+	})
+}
+
+// instanceRetry is how long watchInstance waits before reopening a
+// dropped event stream, e.g. while the backend restarts.
+const instanceRetry = 30 * time.Second
+
+// watchInstance shows the backend's warnings that the idle GPU instance
+// is about to be stopped, and that it was, until ctx is cancelled. A
+// backend without the event stream is left alone.
+func (t *tuiApp) watchInstance(ctx context.Context) {
+	for {
+		err := t.client.InstanceEvents(ctx, func(e api.InstanceEvent) {
+			line := instanceEventLine(e)
+			if line == "" {
+				return
+			}
+			t.app.QueueUpdateDraw(func() {
+				t.addLine("[yellow::b]  " + tview.Escape(line) + "[-:-:-]")
+				t.addLine("")
+				t.refreshChatView()
+			})
+		})
+		var apiErr *api.Error
+		if ctx.Err() != nil || errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(instanceRetry):
+		}
+	}
+}
+
+// instanceEventLine describes an instance event for the chat, or returns
+// "" for events the TUI does not show.
+func instanceEventLine(e api.InstanceEvent) string {
+	switch e.Type {
+	case api.InstanceIdleWarning:
+		line := "The GPU instance is idle and will be stopped"
+		if e.StopAt != nil {
+			line += " at " + e.StopAt.Local().Format("15:04")
+		}
+		return line + "; send a message to keep it running."
+	case api.InstanceStopped:
+		line := "The GPU instance was stopped"
+		if e.Idle != "" {
+			line += " after " + formatAutoStop(e.Idle) + " idle"
+		}
+		return line + "; the next message starts it again."
+	case api.InstanceBudgetWarning:
+		return fmt.Sprintf("GPU spend this %s is $%.2f, %.0f%% of the $%.2f budget.", e.Period, e.Spent, 100*e.Spent/e.Budget, e.Budget)
+	case api.InstanceBudgetReached:
+		return fmt.Sprintf("GPU spend this %s is $%.2f, past the $%.2f budget: once stopped, the instance is not started for chats again (use `tanrenai instance start`).", e.Period, e.Spent, e.Budget)
+	}
+	return ""
+}
+
+// costPoll is how often watchCosts refreshes the GPU spend.
+const costPoll = time.Minute
+
+// watchCosts shows the price and today's spend of a running remote GPU
+// instance in the status bar until ctx is cancelled. A backend with a
+// local GPU, or without the endpoint, is left alone.
+func (t *tuiApp) watchCosts(ctx context.Context) {
+	ticker := time.NewTicker(costPoll)
+	defer ticker.Stop()
+	for {
+		costs, err := t.client.InstanceCosts(apiclient.WithTimeout(ctx, 15*time.Second))
+		var apiErr *api.Error
+		if ctx.Err() != nil || errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound || err == nil && costs.Provider == "local" {
+			return
+		}
+		status := ""
+		if err == nil && costs.Running && costs.RatePerHour > 0 {
+			status = fmt.Sprintf("GPU $%.2f/hr, $%.2f today", costs.RatePerHour, costs.Today)
+			if costs.DailyBudget > 0 {
+				status += fmt.Sprintf(" of $%.2f", costs.DailyBudget)
+			}
+		}
+		t.app.QueueUpdateDraw(func() {
+			t.costStatus = status
+			t.updateStatusBar()
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		content = strings.Join(built, "\n")
 	}
-	t.chatView.SetText(content)
-	t.chatView.ScrollToEnd()
 }
 
 func (t *tuiApp) updateStatusBar() {
+	t.renderStatusBar()
+	text := t.statusBar.GetText(false)
+	if t.pullStatus != "" {
+		text += " [gray::-]| " + tview.Escape(t.pullStatus) + "[-:-:-]"
+	}
+	if t.trainStatus != "" {
+		text += " [gray::-]| " + tview.Escape(t.trainStatus) + "[-:-:-]"
+	}
+	if t.costStatus != "" {
+		text += " [gray::-]| " + tview.Escape(t.costStatus) + "[-:-:-]"
+	}
+	if t.voiceStatus != "" {
+		text += " [red::b]| " + tview.Escape(t.voiceStatus) + "[-:-:-]"
+	}
+	t.statusBar.SetText(t.theme.apply(text))
+}
+
+func (t *tuiApp) renderStatusBar() {
+	if t.selecting {
+		t.statusBar.SetText(" [yellow::b]SELECT[-:-:-] [gray::-]j/k extend | y copy | Enter expand tool result | Esc cancel[-:-:-]")
+		return
+	}
+	gauge := ""
+	if t.ctxGauge != "" {
+		gauge = " [gray::-]|[-:-:-] " + t.ctxGauge
+	}
 	if t.processing && t.statusText != "" {
 		tokenInfo := ""
 		if t.lastInputTokens > 0 {
-			tokenInfo = " | ~" + formatTokenCount(t.lastInputTokens) + " in"
+			tokenInfo = " | " + t.tokenPrefix() + formatTokenCount(t.lastInputTokens) + " in"
 		}
 		bar := ""
 		if !t.iterStartTime.IsZero() {
 			elapsed := time.Since(t.iterStartTime)
 			bar = " " + renderProgressBar(elapsed, t.estimatedDur)
 		}
-		t.statusBar.SetText(" [gray::-]" + tview.Escape(t.statusText+tokenInfo) + "[-:-:-] " + bar)
-	} else if t.lastInputTokens > 0 || t.lastOutputTokens > 0 {
+		t.statusBar.SetText(" [gray::-]" + tview.Escape(t.statusText+tokenInfo) + "[-:-:-]" + gauge + " " + bar)
+	} else {
 		parts := []string{}
 		if t.lastInputTokens > 0 {
-			parts = append(parts, "~"+formatTokenCount(t.lastInputTokens)+" in")
+			parts = append(parts, t.tokenPrefix()+formatTokenCount(t.lastInputTokens)+" in")
 		}
 		if t.lastOutputTokens > 0 {
-			parts = append(parts, "~"+formatTokenCount(t.lastOutputTokens)+" out")
+			parts = append(parts, t.tokenPrefix()+formatTokenCount(t.lastOutputTokens)+" out")
+		}
+		if t.lastRun != "" {
+			parts = append(parts, t.lastRun)
+		}
+		usage := ""
+		if len(parts) > 0 {
+			usage = " [gray::-]| " + tview.Escape(strings.Join(parts, " / ")) + "[-:-:-]"
 		}
-		t.statusBar.SetText(" [gray::-]" + strings.Join(parts, " / ") + "[-:-:-]")
+		t.statusBar.SetText(" [gray::-]" + tview.Escape(t.currentModel()) + "[-:-:-]" + gauge + usage)
+	}
+}
+
+// updateContextGauge recomputes the status bar's context gauge from the
+// manager's budget, the same figure the REPL shows as its [NN%] prompt
+// prefix. It must not run while a turn goroutine may be changing the
+// manager.
+func (t *tuiApp) updateContextGauge() {
+	budget := t.mgr.Budget()
+	if budget.Total <= 0 {
+		t.ctxGauge = ""
+		return
+	}
+	used := budget.Total - budget.Available
+	pct := used * 100 / budget.Total
+	color := "[gray::-]"
+	switch {
+	case pct >= 85:
+		color = "[red::-]"
+	case pct >= 60:
+		color = "[yellow::b]"
+	}
+	t.ctxGauge = fmt.Sprintf("%sctx %d%% (%s/%s)[-:-:-]", color, pct,
+		formatTokenCount(used), formatTokenCount(budget.Total))
+}
+
+// warnIfContextFull adds a chat line the first time history stops fitting
+// in the window, i.e. when it will be summarized (agent mode) or older
+// messages are dropped (chat mode). The warning re-arms once it fits again.
+func (t *tuiApp) warnIfContextFull() {
+	if !t.mgr.NeedsSummary() {
+		t.summaryWarned = false
+		return
+	}
+	if t.summaryWarned {
+		return
+	}
+	t.summaryWarned = true
+	budget := t.mgr.Budget()
+	pct := 100
+	if budget.Total > 0 {
+		pct = (budget.Total - budget.Available) * 100 / budget.Total
+	}
+	if t.agentMode {
+		t.addLine(fmt.Sprintf("[yellow::b]  Context is %d%% full.[-:-:-][gray::-] Older messages will be summarized on the next turn; /compact does it now.[-:-:-]", pct))
 	} else {
-		t.statusBar.SetText("")
+		t.addLine(fmt.Sprintf("[yellow::b]  Context is %d%% full.[-:-:-][gray::-] Older messages no longer fit and are dropped from the window.[-:-:-]", pct))
 	}
+	t.addLine("")
 }
 
 func (t *tuiApp) startProgressTicker() {
@@ -898,6 +2438,17 @@ func (t *tuiApp) stopProgressTicker() {
 	t.iterStartTime = time.Time{}
 }
 
+// showStreamStatus shows why a completion has not started yet. The
+// iteration is not timed, as loading the model would skew the estimates.
+func (t *tuiApp) showStreamStatus(status api.StreamStatus) {
+	if status.Status != api.StreamStatusWarmingUp {
+		return
+	}
+	t.statusText = "Warming up " + status.Model + "..."
+	t.iterStartTime = time.Time{}
+	t.updateStatusBar()
+}
+
 func (t *tuiApp) recordIterationEnd() {
 	if !t.iterStartTime.IsZero() && t.currentIterTokens > 0 {
 		t.iterHistory = append(t.iterHistory, iterRecord{
@@ -905,11 +2456,30 @@ func (t *tuiApp) recordIterationEnd() {
 			duration:    time.Since(t.iterStartTime),
 		})
 	}
-	if t.currentIterOutput > 0 {
+	if t.currentIterOutput > 0 && !t.usageExact {
 		t.lastOutputTokens = t.currentIterOutput / 4 // rough char→token
 	}
 }
 
+// applyUsage replaces the estimated token counts for the current iteration
+// with the exact figures reported by llama-server.
+func (t *tuiApp) applyUsage(u api.Usage) {
+	if u.PromptTokens > 0 {
+		t.currentIterTokens = u.PromptTokens
+		t.lastInputTokens = u.PromptTokens
+	}
+	t.lastOutputTokens = u.CompletionTokens
+	t.usageExact = true
+}
+
+// tokenPrefix marks token counts as approximate unless the backend reported them.
+func (t *tuiApp) tokenPrefix() string {
+	if t.usageExact {
+		return ""
+	}
+	return "~"
+}
+
 func (t *tuiApp) predictDuration(inputTokens int) time.Duration {
 	n := len(t.iterHistory)
 	if n == 0 {
@@ -986,12 +2556,14 @@ func renderProgressBar(elapsed, estimated time.Duration) string {
 
 // ── File Viewer ─────────────────────────────────────────────────────────
 
-func (t *tuiApp) loadFileViewer(path string) {
+// loadFileViewer opens path in the file viewer, scrolled to and
+// highlighting line (1-based) when line > 0.
+func (t *tuiApp) loadFileViewer(path string, line int) {
 	const maxSize = 64 * 1024
 	data, err := os.ReadFile(path)
 	if err != nil {
 		t.app.QueueUpdateDraw(func() {
-			t.openFileViewerContent(path, "", err)
+			t.openFileViewerContent(path, "", 0, err)
 		})
 		return
 	}
@@ -1000,36 +2572,42 @@ func (t *tuiApp) loadFileViewer(path string) {
 		content = content[:maxSize] + "\n... (truncated at 64KB)"
 	}
 	t.app.QueueUpdateDraw(func() {
-		t.openFileViewerContent(path, content, nil)
+		t.openFileViewerContent(path, content, line, nil)
 	})
 }
 
-func (t *tuiApp) openFileViewerContent(path, content string, err error) {
+func (t *tuiApp) openFileViewerContent(path, content string, line int, err error) {
 	t.filePath = path
 	t.focus = focusFileViewer
+	t.fileContent = content
+	t.fileLines = nil
+	t.fileLine = 0
+	t.fileSearch = ""
+	t.fileMatches = nil
 
 	// Create file header
 	t.fileHeader = tview.NewTextView().
 		SetDynamicColors(true).
 		SetScrollable(false)
 	t.fileHeader.SetBorder(false)
-	t.fileHeader.SetText(fmt.Sprintf("[blue::b]%s[-:-:-] [gray::-]Esc close | Tab focus[-:-:-]",
-		tview.Escape(path)))
 
 	// Create file view
 	t.fileView = tview.NewTextView().
 		SetDynamicColors(true).
+		SetRegions(true).
 		SetScrollable(true).
 		SetWordWrap(false)
 	t.fileView.SetBorder(false)
 
 	if err != nil {
 		t.fileView.SetText(fmt.Sprintf("[red::-]Error: %v[-:-:-]", err))
+		t.updateFileHeader()
 	} else {
-		highlighted := highlightContent(path, content)
+		highlighted := highlightContent(path, content, t.theme.CodeStyle)
 		numbered := addLineNumbers(highlighted)
 		// Convert ANSI to tview color tags
-		t.fileView.SetText(tview.TranslateANSI(numbered))
+		t.fileLines = strings.Split(tview.TranslateANSI(numbered), "\n")
+		t.showFileLine(line)
 	}
 
 	// Build file panel (header + file content)
@@ -1040,7 +2618,7 @@ func (t *tuiApp) openFileViewerContent(path, content string, err error) {
 	// Rebuild chatArea with split
 	t.chatArea.Clear()
 	t.chatArea.AddItem(t.chatView, 0, 1, false)
-	t.chatArea.AddItem(newVDivider(t.focus == focusFileViewer), 1, 0, false)
+	t.chatArea.AddItem(t.newVDivider(t.focus == focusFileViewer), 1, 0, false)
 	t.chatArea.AddItem(t.filePanel, 0, 1, false)
 }
 
@@ -1051,7 +2629,7 @@ func (t *tuiApp) rebuildFileViewer() {
 	// Rebuild chatArea to update divider focus color
 	t.chatArea.Clear()
 	t.chatArea.AddItem(t.chatView, 0, 1, false)
-	t.chatArea.AddItem(newVDivider(t.focus == focusFileViewer), 1, 0, false)
+	t.chatArea.AddItem(t.newVDivider(t.focus == focusFileViewer), 1, 0, false)
 	t.chatArea.AddItem(t.filePanel, 0, 1, false)
 }
 
@@ -1061,14 +2639,156 @@ func (t *tuiApp) closeFileViewer() {
 	t.filePanel = nil
 	t.fileHeader = nil
 	t.fileView = nil
+	t.fileContent = ""
+	t.fileLines = nil
+	t.fileSearch = ""
+	t.fileMatches = nil
 
 	t.chatArea.Clear()
 	t.chatArea.AddItem(t.chatView, 0, 1, false)
 }
 
+// showFileLine highlights line (1-based) in the file viewer and scrolls it
+// into the upper third of the view. Line 0 clears the highlight and shows
+// the top of the file.
+func (t *tuiApp) showFileLine(line int) {
+	if t.fileView == nil {
+		return
+	}
+	if line < 0 || line > len(t.fileLines) {
+		line = 0
+	}
+	t.fileLine = line
+
+	lines := t.fileLines
+	if line > 0 {
+		lines = append([]string(nil), t.fileLines...)
+		lines[line-1] = `["line"]` + lines[line-1] + `[""]`
+	}
+	t.fileView.SetText(strings.Join(lines, "\n"))
+	if line > 0 {
+		t.fileView.Highlight("line")
+		_, _, _, height := t.fileView.GetRect()
+		t.fileView.ScrollTo(max(0, line-1-height/3), 0)
+	} else {
+		t.fileView.Highlight()
+		t.fileView.ScrollToBeginning()
+	}
+	t.updateFileHeader()
+}
+
+func (t *tuiApp) updateFileHeader() {
+	if t.fileHeader == nil {
+		return
+	}
+	title := tview.Escape(t.filePath)
+	if t.fileLine > 0 {
+		title += fmt.Sprintf(":%d", t.fileLine)
+	}
+	hints := "Esc close | Tab focus | / search | e edit"
+	switch {
+	case t.fileSearch != "" && len(t.fileMatches) == 0:
+		hints = fmt.Sprintf("no match for %q | Esc clear", t.fileSearch)
+	case t.fileSearch != "":
+		hints = fmt.Sprintf("match %d/%d | n/N next/prev | Esc clear", t.fileMatchIdx+1, len(t.fileMatches))
+	}
+	t.fileHeader.SetText(t.theme.apply(fmt.Sprintf("[blue::b]%s[-:-:-] [gray::-]%s[-:-:-]", title, tview.Escape(hints))))
+}
+
+// searchFile finds the lines of the open file containing query (case
+// sensitive only if query has upper-case letters) and jumps to the first
+// match at or below the current scroll position.
+func (t *tuiApp) searchFile(query string) {
+	if query == "" || t.fileView == nil {
+		return
+	}
+	t.fileSearch = query
+	t.fileMatches = nil
+	t.fileMatchIdx = 0
+
+	fold := strings.ToLower(query) == query
+	for i, line := range strings.Split(t.fileContent, "\n") {
+		if fold {
+			line = strings.ToLower(line)
+		}
+		if strings.Contains(line, query) {
+			t.fileMatches = append(t.fileMatches, i+1)
+		}
+	}
+	if len(t.fileMatches) == 0 {
+		t.updateFileHeader()
+		return
+	}
+
+	row, _ := t.fileView.GetScrollOffset()
+	for i, line := range t.fileMatches {
+		if line-1 >= row {
+			t.fileMatchIdx = i
+			break
+		}
+	}
+	t.showFileLine(t.fileMatches[t.fileMatchIdx])
+}
+
+// editOpenFile suspends the TUI to edit the viewed file in $VISUAL or
+// $EDITOR at the highlighted (or top visible) line, then reloads the viewer
+// and any context copy of the file.
+func (t *tuiApp) editOpenFile() {
+	if t.processing {
+		t.addLine("[gray::-]  Wait for the current turn to finish before editing.[-:-:-]")
+		t.addLine("")
+		t.refreshChatView()
+		return
+	}
+	path, line := t.filePath, t.fileLine
+	if line == 0 {
+		row, _ := t.fileView.GetScrollOffset()
+		line = row + 1
+	}
+
+	var runErr error
+	t.app.Suspend(func() {
+		cmd := editorCommand(path, line)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		runErr = cmd.Run()
+	})
+	if runErr != nil {
+		t.addLine(fmt.Sprintf("[gray::-]  Editor failed: %s[-:-:-]", tview.Escape(runErr.Error())))
+	}
+
+	t.refreshContextFiles()
+	abs, _ := filepath.Abs(path)
+	inContext := slices.ContainsFunc(t.mgr.ContextFiles(), func(p string) bool {
+		pa, _ := filepath.Abs(p)
+		return pa == abs
+	})
+	if !inContext {
+		t.addLine(fmt.Sprintf("[gray::-]  Use /context add %s to give the model the edited file.[-:-:-]", tview.Escape(path)))
+	}
+	t.addLine("")
+	t.refreshChatView()
+	go t.loadFileViewer(path, t.fileLine)
+}
+
+// clearFileSearch drops the current search, keeping the view where it is.
+func (t *tuiApp) clearFileSearch() {
+	t.fileSearch = ""
+	t.fileMatches = nil
+	t.updateFileHeader()
+}
+
+func (t *tuiApp) endFileSearchInput() {
+	t.fileSearching = false
+	t.inputField.SetLabel(t.theme.apply(inputLabel))
+	t.clearInput()
+}
+
 // ── Display Line Mapping ────────────────────────────────────────────────
 
-func (t *tuiApp) displayLineToLogicalLine(displayLine int) int {
+// chatRowAt returns the logical line shown at a display row of the chat
+// view and the plain text of that row's source line (for expanded tool
+// results, the individual output line). It returns -1 past the end.
+func (t *tuiApp) chatRowAt(displayLine int) (int, string) {
 	_, _, cw, _ := t.chatView.GetRect()
 	if cw <= 0 {
 		cw = 80
@@ -1076,13 +2796,13 @@ func (t *tuiApp) displayLineToLogicalLine(displayLine int) int {
 
 	cur := 0
 	for i, line := range t.lines {
-		if t.expanded && len(t.toolResults) > 0 {
+		if t.expanded[i] {
 			if full, ok := t.toolResults[i]; ok {
 				for _, fline := range strings.Split(strings.TrimRight(full, "\n"), "\n") {
 					escaped := "[gray::-]      " + tview.Escape(fline) + "[-:-:-]"
 					rows := wrappedLineRows(escaped, cw)
 					if displayLine < cur+rows {
-						return i
+						return i, fline
 					}
 					cur += rows
 				}
@@ -1091,11 +2811,37 @@ func (t *tuiApp) displayLineToLogicalLine(displayLine int) int {
 		}
 		rows := wrappedLineRows(line, cw)
 		if displayLine < cur+rows {
-			return i
+			return i, plainChatText(line)
 		}
 		cur += rows
 	}
-	return -1
+	return -1, ""
+}
+
+// logicalLineToDisplayRows returns the first and last display rows of a
+// logical line; it is the inverse of chatRowAt.
+func (t *tuiApp) logicalLineToDisplayRows(logical int) (int, int) {
+	_, _, cw, _ := t.chatView.GetRect()
+	if cw <= 0 {
+		cw = 80
+	}
+
+	cur := 0
+	for i, line := range t.lines {
+		rows := 0
+		if full, ok := t.toolResults[i]; ok && t.expanded[i] {
+			for _, fline := range strings.Split(strings.TrimRight(full, "\n"), "\n") {
+				rows += wrappedLineRows("[gray::-]      "+tview.Escape(fline)+"[-:-:-]", cw)
+			}
+		} else {
+			rows = wrappedLineRows(line, cw)
+		}
+		if i == logical {
+			return cur, cur + rows - 1
+		}
+		cur += rows
+	}
+	return cur, cur
 }
 
 // wrappedLineRows estimates how many display rows a logical line occupies
@@ -1110,7 +2856,7 @@ func wrappedLineRows(taggedLine string, viewWidth int) int {
 
 // ── Syntax Highlighting ─────────────────────────────────────────────────
 
-func highlightContent(path, content string) string {
+func highlightContent(path, content, styleName string) string {
 	lexer := lexers.Match(path)
 	if lexer == nil {
 		lexer = lexers.Analyse(content)
@@ -1120,7 +2866,7 @@ func highlightContent(path, content string) string {
 	}
 	lexer = chroma.Coalesce(lexer)
 
-	style := styles.Get("monokai")
+	style := styles.Get(styleName)
 	formatter := formatters.Get("terminal256")
 	if formatter == nil {
 		return content
@@ -1228,7 +2974,7 @@ func stripANSIUnderline(s string) string {
 
 func (t *tuiApp) renderMarkdown(content string) string {
 	r, err := glamour.NewTermRenderer(
-		glamour.WithStandardStyle("dark"),
+		glamour.WithStandardStyle(t.theme.MarkdownStyle),
 		glamour.WithWordWrap(0),
 	)
 	if err != nil {
@@ -1245,6 +2991,76 @@ func (t *tuiApp) renderMarkdown(content string) string {
 
 // ── Helpers ─────────────────────────────────────────────────────────────
 
+// parseCompactArgs reads the options of /compact: a share of the window to
+// free ("50%"), "tools" to collapse only tool results, and --dry-run.
+func parseCompactArgs(args string) (chatctx.CompactOptions, error) {
+	var opts chatctx.CompactOptions
+	for _, arg := range strings.Fields(args) {
+		switch {
+		case arg == "--dry-run":
+			opts.DryRun = true
+		case arg == "tools":
+			opts.ToolsOnly = true
+		case strings.HasSuffix(arg, "%"):
+			pct, err := strconv.Atoi(strings.TrimSuffix(arg, "%"))
+			if err != nil || pct < 1 || pct > 95 {
+				return opts, fmt.Errorf("free space must be between 1%% and 95%%, got %q", arg)
+			}
+			opts.Free = float64(pct) / 100
+		default:
+			return opts, fmt.Errorf("usage: /compact [N%%] [tools] [--dry-run]")
+		}
+	}
+	return opts, nil
+}
+
+// fileRefPattern matches path:line references such as grep hits
+// ("cmd/run.go:42: ...") and compiler errors ("main.go:12:5: ...").
+var fileRefPattern = regexp.MustCompile(`([\w./~-]+):(\d+)`)
+
+// parseFileRef returns the first path:line reference in text that names an
+// existing file.
+func parseFileRef(text string) (string, int, bool) {
+	for _, m := range fileRefPattern.FindAllStringSubmatch(text, -1) {
+		line, err := strconv.Atoi(m[2])
+		if err != nil || line < 1 {
+			continue
+		}
+		if info, err := os.Stat(m[1]); err == nil && !info.IsDir() {
+			return m[1], line, true
+		}
+	}
+	return "", 0, false
+}
+
+// editorCommand builds the command that opens path at line in the user's
+// editor. Editors with a known syntax for it start at the line.
+func editorCommand(path string, line int) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	fields := strings.Fields(editor)
+	args := fields[1:]
+	switch strings.TrimSuffix(filepath.Base(fields[0]), ".exe") {
+	case "vi", "vim", "nvim", "nano", "emacs", "emacsclient", "micro", "hx", "kak", "mg":
+		args = append(args, fmt.Sprintf("+%d", line), path)
+	case "code", "code-insiders", "codium":
+		args = append(args, "--goto", fmt.Sprintf("%s:%d", path, line))
+	case "subl", "zed":
+		args = append(args, fmt.Sprintf("%s:%d", path, line))
+	default:
+		args = append(args, path)
+	}
+	return exec.Command(fields[0], args...)
+}
+
 func extractFilePath(call api.ToolCall) string {
 	var args struct {
 		Path string `json:"path"`
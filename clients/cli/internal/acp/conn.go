@@ -0,0 +1,258 @@
+// Package acp speaks the Agent Client Protocol: JSON-RPC 2.0 over stdio,
+// one message per line, through which editors such as Zed and Neovim drive
+// an agent. Conn carries the messages; protocol.go has the ACP methods and
+// types tanrenai uses.
+package acp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is a JSON-RPC error. Handlers return one to choose the code; any
+// other error is reported as CodeInternalError.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Handler answers a request or notification from the other side. The
+// result of a notification is discarded.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+// message is any JSON-RPC message: a request has an ID and a method, a
+// notification only a method, a response an ID and a result or error.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// Conn is a JSON-RPC connection over a pair of streams. Incoming requests
+// are handled concurrently, so a notification such as session/cancel is
+// seen while a long request runs.
+type Conn struct {
+	r       *bufio.Reader
+	handler Handler
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *message
+}
+
+// NewConn returns a connection reading from r and writing to w. Serve must
+// be called for anything to be received.
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	return &Conn{
+		r:       bufio.NewReaderSize(r, 1<<20),
+		w:       w,
+		handler: handler,
+		pending: make(map[string]chan *message),
+	}
+}
+
+// Serve reads messages until r ends or ctx is cancelled, handing requests
+// and notifications to the handler and responses to the Call waiting for
+// them. It waits for running handlers before returning; their context is
+// cancelled when it stops reading.
+func (c *Conn) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var handlers sync.WaitGroup
+	defer func() {
+		cancel()
+		handlers.Wait()
+		c.failPending()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			line, err := c.r.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case line = <-lines:
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			if len(bytes.TrimSpace(line)) > 0 {
+				c.send(&message{ID: rawNull(), Error: &Error{Code: CodeParseError, Message: "invalid JSON: " + err.Error()}})
+			}
+			continue
+		}
+		switch {
+		case msg.Method != "":
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				c.handle(ctx, &msg)
+			}()
+		case msg.ID != nil:
+			c.deliver(&msg)
+		default:
+			c.send(&message{ID: rawNull(), Error: &Error{Code: CodeInvalidRequest, Message: "message has neither a method nor an id"}})
+		}
+	}
+}
+
+func (c *Conn) handle(ctx context.Context, msg *message) {
+	result, err := c.handler(ctx, msg.Method, msg.Params)
+	if msg.ID == nil {
+		return // a notification gets no response
+	}
+	resp := &message{ID: msg.ID}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			resp.Error = &Error{Code: CodeInternalError, Message: "encode result: " + merr.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	c.send(resp)
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.send(&message{Method: method, Params: data})
+}
+
+// Call sends a request and decodes its result into result, which may be
+// nil. It returns the other side's *Error if it answers with one.
+func (c *Conn) Call(ctx context.Context, method string, params, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	key := strconv.FormatInt(c.nextID, 10)
+	reply := make(chan *message, 1)
+	c.pending[key] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+	}()
+
+	id := json.RawMessage(key)
+	if err := c.send(&message{ID: &id, Method: method, Params: data}); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case resp, ok := <-reply:
+		if !ok {
+			return errors.New("connection closed")
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+func (c *Conn) deliver(msg *message) {
+	c.mu.Lock()
+	reply, ok := c.pending[string(*msg.ID)]
+	c.mu.Unlock()
+	if ok {
+		select {
+		case reply <- msg:
+		default: // a duplicate response
+		}
+	}
+}
+
+// failPending ends the Calls still waiting once nothing more can arrive.
+func (c *Conn) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, reply := range c.pending {
+		close(reply)
+		delete(c.pending, key)
+	}
+}
+
+func (c *Conn) send(msg *message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+func rawNull() *json.RawMessage {
+	null := json.RawMessage("null")
+	return &null
+}
@@ -0,0 +1,131 @@
+package acp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// peer is the client side of a Conn under test, exchanging raw lines.
+type peer struct {
+	in  *io.PipeWriter
+	out *bufio.Scanner
+}
+
+func newPeer(t *testing.T, handler Handler) (*Conn, *peer, func()) {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	conn := NewConn(inR, outW, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.Serve(ctx)
+		outW.Close()
+	}()
+	return conn, &peer{in: inW, out: bufio.NewScanner(outR)}, func() {
+		inW.Close()
+		cancel()
+		<-done
+	}
+}
+
+func (p *peer) send(t *testing.T, line string) {
+	t.Helper()
+	if _, err := io.WriteString(p.in, line+"\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *peer) read(t *testing.T) message {
+	t.Helper()
+	if !p.out.Scan() {
+		t.Fatalf("connection closed: %v", p.out.Err())
+	}
+	var msg message
+	if err := json.Unmarshal(p.out.Bytes(), &msg); err != nil {
+		t.Fatalf("bad message %q: %v", p.out.Text(), err)
+	}
+	return msg
+}
+
+func TestRequestsGetResponses(t *testing.T) {
+	_, p, stop := newPeer(t, func(_ context.Context, method string, params json.RawMessage) (any, error) {
+		if method != "echo" {
+			return nil, &Error{Code: CodeMethodNotFound, Message: "no " + method}
+		}
+		return params, nil
+	})
+	defer stop()
+
+	p.send(t, `{"jsonrpc":"2.0","id":1,"method":"echo","params":{"a":1}}`)
+	if msg := p.read(t); string(*msg.ID) != "1" || string(msg.Result) != `{"a":1}` {
+		t.Errorf("response = id %s result %s, want id 1 result {\"a\":1}", *msg.ID, msg.Result)
+	}
+
+	p.send(t, `{"jsonrpc":"2.0","id":"x","method":"other"}`)
+	if msg := p.read(t); msg.Error == nil || msg.Error.Code != CodeMethodNotFound {
+		t.Errorf("error = %+v, want CodeMethodNotFound", msg.Error)
+	}
+
+	p.send(t, `not json`)
+	if msg := p.read(t); msg.Error == nil || msg.Error.Code != CodeParseError {
+		t.Errorf("error = %+v, want CodeParseError", msg.Error)
+	}
+}
+
+func TestCallWhileHandlingARequest(t *testing.T) {
+	var conn *Conn
+	conn, p, stop := newPeer(t, func(ctx context.Context, method string, _ json.RawMessage) (any, error) {
+		var answer struct{ Allow bool }
+		if err := conn.Call(ctx, "ask", map[string]string{"q": "may I?"}, &answer); err != nil {
+			return nil, err
+		}
+		conn.Notify("progress", map[string]bool{"allowed": answer.Allow})
+		return answer.Allow, nil
+	})
+	defer stop()
+
+	p.send(t, `{"jsonrpc":"2.0","id":7,"method":"work"}`)
+	ask := p.read(t)
+	if ask.Method != "ask" || ask.ID == nil {
+		t.Fatalf("got %+v, want an ask request", ask)
+	}
+	p.send(t, `{"jsonrpc":"2.0","id":`+string(*ask.ID)+`,"result":{"Allow":true}}`)
+
+	if msg := p.read(t); msg.Method != "progress" || msg.ID != nil {
+		t.Errorf("got %+v, want a progress notification", msg)
+	}
+	if msg := p.read(t); string(*msg.ID) != "7" || string(msg.Result) != "true" {
+		t.Errorf("response = %+v, want id 7 result true", msg)
+	}
+}
+
+func TestServeCancelsHandlersWhenInputEnds(t *testing.T) {
+	started := make(chan struct{})
+	inR, inW := io.Pipe()
+	conn := NewConn(inR, io.Discard, func(ctx context.Context, _ string, _ json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	done := make(chan error, 1)
+	go func() { done <- conn.Serve(context.Background()) }()
+
+	io.Copy(inW, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"slow"}`+"\n"))
+	<-started
+	inW.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve = %v, want nil at end of input", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+}
@@ -0,0 +1,212 @@
+package acp
+
+import "encoding/json"
+
+// ProtocolVersion is the ACP version implemented here.
+const ProtocolVersion = 1
+
+// Methods the client calls on the agent.
+const (
+	MethodInitialize    = "initialize"
+	MethodAuthenticate  = "authenticate"
+	MethodSessionNew    = "session/new"
+	MethodSessionPrompt = "session/prompt"
+	MethodSessionCancel = "session/cancel" // a notification
+)
+
+// Methods the agent calls on the client.
+const (
+	MethodSessionUpdate     = "session/update" // a notification
+	MethodRequestPermission = "session/request_permission"
+)
+
+// InitializeRequest is the params of initialize.
+type InitializeRequest struct {
+	ProtocolVersion    int             `json:"protocolVersion"`
+	ClientCapabilities json.RawMessage `json:"clientCapabilities,omitempty"`
+}
+
+// InitializeResponse is the result of initialize.
+type InitializeResponse struct {
+	ProtocolVersion   int               `json:"protocolVersion"`
+	AgentCapabilities AgentCapabilities `json:"agentCapabilities"`
+	AuthMethods       []AuthMethod      `json:"authMethods"`
+}
+
+// AgentCapabilities tells the client what the agent supports.
+type AgentCapabilities struct {
+	LoadSession        bool               `json:"loadSession"`
+	PromptCapabilities PromptCapabilities `json:"promptCapabilities"`
+}
+
+// PromptCapabilities lists the content blocks a prompt may hold besides
+// text and resource links.
+type PromptCapabilities struct {
+	Image           bool `json:"image"`
+	Audio           bool `json:"audio"`
+	EmbeddedContext bool `json:"embeddedContext"`
+}
+
+// AuthMethod is a way to authenticate; tanrenai offers none.
+type AuthMethod struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// NewSessionRequest is the params of session/new.
+type NewSessionRequest struct {
+	Cwd        string            `json:"cwd"`
+	MCPServers []json.RawMessage `json:"mcpServers,omitempty"`
+}
+
+// NewSessionResponse is the result of session/new.
+type NewSessionResponse struct {
+	SessionID string `json:"sessionId"`
+}
+
+// PromptRequest is the params of session/prompt: one user turn.
+type PromptRequest struct {
+	SessionID string         `json:"sessionId"`
+	Prompt    []ContentBlock `json:"prompt"`
+}
+
+// Stop reasons of a PromptResponse.
+const (
+	StopEndTurn         = "end_turn"
+	StopMaxTokens       = "max_tokens"
+	StopMaxTurnRequests = "max_turn_requests"
+	StopRefusal         = "refusal"
+	StopCancelled       = "cancelled"
+)
+
+// PromptResponse is the result of session/prompt, sent when the turn ends.
+type PromptResponse struct {
+	StopReason string `json:"stopReason"`
+}
+
+// CancelNotification is the params of session/cancel.
+type CancelNotification struct {
+	SessionID string `json:"sessionId"`
+}
+
+// ContentBlock is a piece of a prompt or of agent output: "text",
+// "image" (base64 Data), "resource_link" (URI and Name) or "resource" (an
+// embedded file).
+type ContentBlock struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	URI      string            `json:"uri,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+}
+
+// TextBlock returns a text content block.
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: "text", Text: text}
+}
+
+// EmbeddedResource is the file contents carried by a "resource" block.
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// SessionNotification is the params of session/update.
+type SessionNotification struct {
+	SessionID string        `json:"sessionId"`
+	Update    SessionUpdate `json:"update"`
+}
+
+// Kinds of SessionUpdate.
+const (
+	UpdateAgentMessageChunk = "agent_message_chunk"
+	UpdateAgentThoughtChunk = "agent_thought_chunk"
+	UpdateToolCall          = "tool_call"
+	UpdateToolCallUpdate    = "tool_call_update"
+)
+
+// Tool call statuses.
+const (
+	ToolPending    = "pending"
+	ToolInProgress = "in_progress"
+	ToolCompleted  = "completed"
+	ToolFailed     = "failed"
+)
+
+// Tool kinds, which pick the icon an editor shows for a call.
+const (
+	KindRead    = "read"
+	KindEdit    = "edit"
+	KindDelete  = "delete"
+	KindSearch  = "search"
+	KindExecute = "execute"
+	KindFetch   = "fetch"
+	KindThink   = "think"
+	KindOther   = "other"
+)
+
+// SessionUpdate is one update to a session: a chunk of the reply or of
+// reasoning (Content is a ContentBlock), a new tool call or a change to
+// one (Content is a list of ToolCallContent).
+type SessionUpdate struct {
+	SessionUpdate string          `json:"sessionUpdate"`
+	Content       any             `json:"content,omitempty"`
+	ToolCallID    string          `json:"toolCallId,omitempty"`
+	Title         string          `json:"title,omitempty"`
+	Kind          string          `json:"kind,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	Locations     []Location      `json:"locations,omitempty"`
+	RawInput      json.RawMessage `json:"rawInput,omitempty"`
+	RawOutput     any             `json:"rawOutput,omitempty"`
+}
+
+// ToolCallContent is what a tool call produced, shown with it.
+type ToolCallContent struct {
+	Type    string       `json:"type"` // "content"
+	Content ContentBlock `json:"content"`
+}
+
+// Location is a file a tool call touches, so the editor can follow it.
+type Location struct {
+	Path string `json:"path"`
+	Line int    `json:"line,omitempty"`
+}
+
+// RequestPermissionRequest is the params of session/request_permission.
+type RequestPermissionRequest struct {
+	SessionID string             `json:"sessionId"`
+	ToolCall  SessionUpdate      `json:"toolCall"`
+	Options   []PermissionOption `json:"options"`
+}
+
+// Permission option kinds.
+const (
+	PermitAllowOnce    = "allow_once"
+	PermitAllowAlways  = "allow_always"
+	PermitRejectOnce   = "reject_once"
+	PermitRejectAlways = "reject_always"
+)
+
+// PermissionOption is a choice offered to the user.
+type PermissionOption struct {
+	OptionID string `json:"optionId"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+}
+
+// RequestPermissionResponse is the result of session/request_permission.
+type RequestPermissionResponse struct {
+	Outcome PermissionOutcome `json:"outcome"`
+}
+
+// PermissionOutcome is the user's answer: Outcome "selected" with the
+// chosen OptionID, or "cancelled" when the turn was cancelled.
+type PermissionOutcome struct {
+	Outcome  string `json:"outcome"`
+	OptionID string `json:"optionId,omitempty"`
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
 	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/reasoning"
 	"github.com/ThatCatDev/tanrenai/client/internal/tools"
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
@@ -19,6 +21,14 @@ type Hooks struct {
 	OnAssistantMessage func(content string)
 	OnToolCall         func(call api.ToolCall)
 	OnToolResult       func(call api.ToolCall, result string)
+	// OnRetry is called before a failed completion is retried, with the
+	// retry number (from 1), the number allowed and the error. Streamed
+	// output of the failed attempt should be discarded: the retry starts the
+	// reply over.
+	OnRetry func(attempt, maxAttempts int, err error)
+	// OnToolsRouted receives the tools the routing step chose (see
+	// Config.RouteTools).
+	OnToolsRouted func(names []string)
 }
 
 // Config configures the agent loop.
@@ -26,9 +36,49 @@ type Config struct {
 	MaxIterations     int
 	Tools             *tools.Registry
 	Hooks             Hooks
-	MaxTokens         int                    // 0 = no limit (backward compatible)
-	MaxResponseTokens int                    // max tokens per generation (0 = default 4096)
+	MaxTokens         int                     // 0 = no limit (backward compatible)
+	MaxResponseTokens int                     // max tokens per generation (0 = default 4096)
 	TokenEstimator    *chatctx.TokenEstimator // nil = no estimation
+	// Compact shrinks the messages when their estimate exceeds MaxTokens
+	// mid-turn, typically by summarizing the run's earlier tool exchanges
+	// (chatctx.Manager.CompactTurn). start is the index of the first message
+	// the run added. When nil, or if it fails or does not shrink them
+	// enough, old tool results are truncated instead.
+	Compact func(ctx context.Context, messages []api.Message, start int) ([]api.Message, error)
+	// ToolTimeouts overrides the registry's timeout for individual tools,
+	// keyed by tool name. A zero duration disables the timeout for that tool.
+	ToolTimeouts map[string]time.Duration
+	// ApproveTool is asked before each tool call runs; a call it refuses
+	// is answered with an error result telling the model the user declined
+	// it. nil approves every call.
+	ApproveTool func(ctx context.Context, call api.ToolCall) bool
+	// Retry configures retries of completion requests that fail in a way
+	// that looks transient. The zero value never retries.
+	Retry RetryPolicy
+	// MaxNudges caps how many replies per run are sent back with a nudge
+	// to use tools (0 = default 3, negative = never nudge).
+	MaxNudges int
+	// MaxRepeatedErrors is how many times an identical tool call may fail
+	// before the model is told to stop retrying it; failing again after
+	// that stops the run as stuck (0 = default 3).
+	MaxRepeatedErrors int
+	// NeedsNudge reports whether a reply that calls no tools is guessing or
+	// announcing work it has not done, and should be sent back with a nudge.
+	// nil means LooksLikeContinuation, whose phrase lists are English.
+	NeedsNudge func(content string) bool
+
+	// PlanFirst runs a read-only planning phase before the main loop. The
+	// model explores with tools.ReadOnlyToolNames and writes a plan, which is
+	// passed to ConfirmPlan; the full registry is only used once it returns
+	// true. A nil ConfirmPlan approves every plan.
+	PlanFirst   bool
+	ConfirmPlan func(plan string) bool
+
+	// RouteTools runs a routing step before the main loop: the model sees
+	// the task and a one-line summary of each tool and names the ones it
+	// needs, and only those and tools.ReadOnlyToolNames are sent with each
+	// iteration. A failed routing step keeps the full set.
+	RouteTools bool
 }
 
 // StreamingCompletionFunc returns a channel of stream events instead of blocking.
@@ -37,40 +87,109 @@ type StreamingCompletionFunc func(ctx context.Context, req *api.ChatCompletionRe
 // StreamingConfig extends Config with streaming hooks.
 type StreamingConfig struct {
 	Config
-	OnIterationStart func(iteration, maxIterations int, messages []api.Message)
+	// OnIterationStart receives the usage reported for the previous
+	// iteration, or nil on the first iteration or when the backend sent none.
+	OnIterationStart func(iteration, maxIterations int, messages []api.Message, lastUsage *api.Usage)
 	OnThinking       func()
 	OnThinkingDone   func()
 	OnContentDelta   func(delta string)
+	// OnReasoningDelta receives the model's <think> reasoning, which is kept
+	// out of OnContentDelta and out of the returned messages.
+	OnReasoningDelta func(delta string)
+	// OnStatus is called when the stream reports why it is waiting, e.g.
+	// while the model warms up.
+	OnStatus func(status api.StreamStatus)
+	// OnUsage is called after each completion whose stream reported usage.
+	OnUsage func(usage api.Usage)
 }
 
 const (
-	maxConsecutiveErrors     = 3
+	defaultMaxRepeatedErrors = 3
 	defaultMaxResponseTokens = 4096
-	maxNudges                = 3
+	defaultMaxNudges         = 3
 )
 
+// executeTool runs a tool call through the registry once cfg.ApproveTool
+// allows it, applying any timeout override from cfg. Cancelling ctx aborts
+// the call immediately.
+func executeTool(ctx context.Context, cfg *Config, tc api.ToolCall) (*tools.ToolResult, error) {
+	name := tc.Function.Name
+	if cfg.ApproveTool != nil && !cfg.ApproveTool(ctx, tc) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return tools.ErrorResult("Not run: the user declined this tool call. Do not retry it; ask the user how to proceed or take another approach."), nil
+	}
+	timeout, ok := cfg.ToolTimeouts[name]
+	if !ok {
+		timeout = cfg.Tools.Timeout(name)
+	}
+	return cfg.Tools.Execute(ctx, name, tc.Function.Arguments, timeout)
+}
+
 func toolCallKey(tc api.ToolCall) string {
 	return tc.Function.Name + ":" + tc.Function.Arguments
 }
 
 // Run executes the agentic loop: send messages to the LLM, execute any tool
 // calls it makes, feed results back, and repeat until the model stops calling
-// tools or the iteration limit is reached.
-func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, cfg Config) ([]api.Message, error) {
+// tools or the iteration limit is reached. The result is never nil; on error
+// it holds the history up to the failure.
+func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, cfg Config) (*RunResult, error) {
+	res := newRunResult()
+	start := len(messages)
+	if tools.ReadTrackerFrom(ctx) == nil {
+		// One tracker per run; the planning phase and sub-agents share it.
+		ctx = tools.WithReadTracker(ctx, tools.NewReadTracker())
+	}
+	if tools.ProcessTableFrom(ctx) == nil {
+		// Background processes last as long as the run that started them.
+		procs := tools.NewProcessTable()
+		ctx = tools.WithProcessTable(ctx, procs)
+		defer procs.StopAll()
+	}
+	if cfg.PlanFirst {
+		plan, proceed, err := runPlanPhase(messages, cfg, func(msgs []api.Message, planCfg Config) (*RunResult, error) {
+			return Run(ctx, complete, msgs, planCfg)
+		})
+		res.merge(plan)
+		messages = plan.Messages
+		if err != nil {
+			return res.finish(ctx, messages, plan.StopReason, err)
+		}
+		if !proceed {
+			return res.finish(ctx, messages, StopPlanRejected, nil)
+		}
+		cfg.PlanFirst = false
+	}
+	route(ctx, &cfg, res, messages, complete)
 	if cfg.MaxIterations <= 0 {
 		cfg.MaxIterations = 1<<31 - 1
 	}
 	if cfg.MaxResponseTokens <= 0 {
 		cfg.MaxResponseTokens = defaultMaxResponseTokens
 	}
+	if cfg.MaxNudges == 0 {
+		cfg.MaxNudges = defaultMaxNudges
+	}
+	if cfg.MaxRepeatedErrors <= 0 {
+		cfg.MaxRepeatedErrors = defaultMaxRepeatedErrors
+	}
+	if cfg.NeedsNudge == nil {
+		cfg.NeedsNudge = LooksLikeContinuation
+	}
 
 	apiTools := cfg.Tools.APITools()
 	errorCounts := make(map[string]int)
 	nudgeCount := 0
 
 	for i := 0; i < cfg.MaxIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return res.finish(ctx, messages, StopCancelled, err)
+		}
+		res.Iterations++
 		if cfg.MaxTokens > 0 && cfg.TokenEstimator != nil {
-			messages = truncateToolResults(messages, cfg.MaxTokens, cfg.TokenEstimator)
+			messages = fitTokens(ctx, &cfg, res, messages, start)
 		}
 
 		maxTokens := cfg.MaxResponseTokens
@@ -81,16 +200,23 @@ func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, c
 			MaxTokens: &maxTokens,
 		}
 
-		resp, err := complete(ctx, req)
+		requested := time.Now()
+		resp, err := withRetry(ctx, &cfg, res, func() (*api.ChatCompletionResponse, error) {
+			return complete(ctx, req)
+		})
+		res.ModelTime += time.Since(requested)
 		if err != nil {
-			return messages, fmt.Errorf("completion request failed: %w", err)
+			return res.finish(ctx, messages, StopError, fmt.Errorf("completion request failed: %w", err))
 		}
+		res.addUsage(resp.Usage)
 
 		if len(resp.Choices) == 0 {
-			return messages, fmt.Errorf("empty response from model")
+			return res.finish(ctx, messages, StopError, fmt.Errorf("empty response from model"))
 		}
 
 		choice := resp.Choices[0]
+		choice.Message.Content, _ = reasoning.Split(choice.Message.Content)
+		choice.Message.ReasoningContent = ""
 		stripNarration(&choice.Message)
 		messages = append(messages, choice.Message)
 
@@ -103,39 +229,42 @@ func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, c
 		}
 
 		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) == 0 {
-			if nudgeCount < maxNudges && looksLikeContinuation(choice.Message.Content) {
+			if nudgeCount < cfg.MaxNudges && cfg.NeedsNudge(choice.Message.Content) {
 				nudgeCount++
+				res.Nudges++
 				messages = append(messages, api.Message{
 					Role:    "user",
 					Content: "Do not guess or speculate. Use your tools to gather the actual information, then answer.",
 				})
 				continue
 			}
-			return messages, nil
+			return res.finish(ctx, messages, StopCompleted, nil)
 		}
 
 		stuck := true
-		for _, tc := range choice.Message.ToolCalls {
+		for j, tc := range choice.Message.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
+				return res.finish(ctx, messages, StopCancelled, err)
+			}
 			if cfg.Hooks.OnToolCall != nil {
 				cfg.Hooks.OnToolCall(tc)
 			}
 
-			tool := cfg.Tools.Get(tc.Function.Name)
-			var result *tools.ToolResult
-			if tool == nil {
-				result = tools.ErrorResult(fmt.Sprintf("unknown tool: %s", tc.Function.Name))
-			} else {
-				var execErr error
-				result, execErr = tool.Execute(ctx, tc.Function.Arguments)
-				if execErr != nil {
-					return messages, fmt.Errorf("tool %q execution error: %w", tc.Function.Name, execErr)
+			started := time.Now()
+			result, execErr := executeTool(ctx, &cfg, tc)
+			res.addToolCall(tc.Function.Name, execErr != nil || result.IsError, time.Since(started))
+			if execErr != nil {
+				if ctx.Err() != nil {
+					messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
 				}
+				return res.finish(ctx, messages, StopError, fmt.Errorf("tool %q execution error: %w", tc.Function.Name, execErr))
 			}
 
 			key := toolCallKey(tc)
 			if result.IsError {
 				errorCounts[key]++
-				if errorCounts[key] >= maxConsecutiveErrors {
+				if errorCounts[key] >= cfg.MaxRepeatedErrors {
 					result.Output += "\n\nYou have repeated this exact failing call multiple times. Do NOT retry it. Either try different arguments or respond to the user explaining what went wrong."
 				}
 			} else {
@@ -157,7 +286,7 @@ func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, c
 
 		allRepeats := true
 		for _, tc := range choice.Message.ToolCalls {
-			if errorCounts[toolCallKey(tc)] < maxConsecutiveErrors {
+			if errorCounts[toolCallKey(tc)] < cfg.MaxRepeatedErrors {
 				allRepeats = false
 				break
 			}
@@ -165,40 +294,91 @@ func Run(ctx context.Context, complete CompletionFunc, messages []api.Message, c
 		if stuck && allRepeats {
 			anyOverLimit := false
 			for _, tc := range choice.Message.ToolCalls {
-				if errorCounts[toolCallKey(tc)] > maxConsecutiveErrors {
+				if errorCounts[toolCallKey(tc)] > cfg.MaxRepeatedErrors {
 					anyOverLimit = true
 					break
 				}
 			}
 			if anyOverLimit {
-				return messages, fmt.Errorf("agent stuck: repeated identical failing tool calls")
+				return res.finish(ctx, messages, StopStuck, fmt.Errorf("agent stuck: repeated identical failing tool calls"))
 			}
 		}
 	}
 
-	return messages, fmt.Errorf("agent loop reached maximum iterations (%d)", cfg.MaxIterations)
+	return res.finish(ctx, messages, StopMaxIterations, fmt.Errorf("agent loop reached maximum iterations (%d)", cfg.MaxIterations))
 }
 
-// RunStreaming executes the agentic loop with streaming.
-func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, messages []api.Message, cfg StreamingConfig) ([]api.Message, error) {
+// RunStreaming executes the agentic loop with streaming. Like Run, it always
+// returns a result.
+func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, messages []api.Message, cfg StreamingConfig) (*RunResult, error) {
+	res := newRunResult()
+	start := len(messages)
+	if tools.ReadTrackerFrom(ctx) == nil {
+		// One tracker per run; the planning phase and sub-agents share it.
+		ctx = tools.WithReadTracker(ctx, tools.NewReadTracker())
+	}
+	if tools.ProcessTableFrom(ctx) == nil {
+		// Background processes last as long as the run that started them.
+		procs := tools.NewProcessTable()
+		ctx = tools.WithProcessTable(ctx, procs)
+		defer procs.StopAll()
+	}
+	if cfg.PlanFirst {
+		plan, proceed, err := runPlanPhase(messages, cfg.Config, func(msgs []api.Message, planCfg Config) (*RunResult, error) {
+			streamCfg := cfg
+			streamCfg.Config = planCfg
+			return RunStreaming(ctx, complete, msgs, streamCfg)
+		})
+		res.merge(plan)
+		messages = plan.Messages
+		if err != nil {
+			return res.finish(ctx, messages, plan.StopReason, err)
+		}
+		if !proceed {
+			return res.finish(ctx, messages, StopPlanRejected, nil)
+		}
+		cfg.PlanFirst = false
+	}
+	route(ctx, &cfg.Config, res, messages, func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		req.Stream = true
+		events, err := complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return apiclient.AccumulateResponse(events)
+	})
 	if cfg.MaxIterations <= 0 {
 		cfg.MaxIterations = 1<<31 - 1
 	}
 	if cfg.MaxResponseTokens <= 0 {
 		cfg.MaxResponseTokens = defaultMaxResponseTokens
 	}
+	if cfg.MaxNudges == 0 {
+		cfg.MaxNudges = defaultMaxNudges
+	}
+	if cfg.MaxRepeatedErrors <= 0 {
+		cfg.MaxRepeatedErrors = defaultMaxRepeatedErrors
+	}
+	if cfg.NeedsNudge == nil {
+		cfg.NeedsNudge = LooksLikeContinuation
+	}
 
 	apiTools := cfg.Tools.APITools()
 	errorCounts := make(map[string]int)
 	nudgeCount := 0
+	var lastUsage *api.Usage
 
 	for i := 0; i < cfg.MaxIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return res.finish(ctx, messages, StopCancelled, err)
+		}
+		res.Iterations++
 		if cfg.OnIterationStart != nil {
-			cfg.OnIterationStart(i+1, cfg.MaxIterations, messages)
+			cfg.OnIterationStart(i+1, cfg.MaxIterations, messages, lastUsage)
 		}
 
 		if cfg.MaxTokens > 0 && cfg.TokenEstimator != nil {
-			messages = truncateToolResults(messages, cfg.MaxTokens, cfg.TokenEstimator)
+			messages = fitTokens(ctx, &cfg.Config, res, messages, start)
 		}
 
 		maxTokens := cfg.MaxResponseTokens
@@ -209,29 +389,46 @@ func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, message
 			MaxTokens: &maxTokens,
 		}
 
-		if cfg.OnThinking != nil {
-			cfg.OnThinking()
-		}
-
-		events, err := complete(ctx, req)
-		if err != nil {
-			if cfg.OnThinkingDone != nil {
-				cfg.OnThinkingDone()
+		requested := time.Now()
+		resp, err := withRetry(ctx, &cfg.Config, res, func() (*api.ChatCompletionResponse, error) {
+			if cfg.OnThinking != nil {
+				cfg.OnThinking()
 			}
-			return messages, fmt.Errorf("completion request failed: %w", err)
+			events, err := complete(ctx, req)
+			if err != nil {
+				if cfg.OnThinkingDone != nil {
+					cfg.OnThinkingDone()
+				}
+				return nil, fmt.Errorf("completion request failed: %w", err)
+			}
+			resp, err := accumulateWithCallbacks(events, &cfg)
+			if err == nil {
+				// A cancelled stream ends early without an error event.
+				err = ctx.Err()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("stream accumulation failed: %w", err)
+			}
+			return resp, nil
+		})
+		res.ModelTime += time.Since(requested)
+		if err != nil {
+			return res.finish(ctx, messages, StopError, err)
 		}
 
-		resp, err := accumulateWithCallbacks(events, &cfg)
-		if err != nil {
-			return messages, fmt.Errorf("stream accumulation failed: %w", err)
+		lastUsage = resp.Usage
+		res.addUsage(resp.Usage)
+		if resp.Usage != nil && cfg.OnUsage != nil {
+			cfg.OnUsage(*resp.Usage)
 		}
 
 		if len(resp.Choices) == 0 {
-			return messages, fmt.Errorf("empty response from model")
+			return res.finish(ctx, messages, StopError, fmt.Errorf("empty response from model"))
 		}
 
 		choice := resp.Choices[0]
 		stripNarration(&choice.Message)
+		choice.Message.ReasoningContent = "" // never sent back to the model
 		messages = append(messages, choice.Message)
 
 		if choice.FinishReason == "length" && len(choice.Message.ToolCalls) == 0 {
@@ -242,8 +439,9 @@ func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, message
 		}
 
 		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) == 0 {
-			if nudgeCount < maxNudges && looksLikeContinuation(choice.Message.Content) {
+			if nudgeCount < cfg.MaxNudges && cfg.NeedsNudge(choice.Message.Content) {
 				nudgeCount++
+				res.Nudges++
 				if cfg.OnContentDelta != nil {
 					cfg.OnContentDelta("\n[continuing...]\n")
 				}
@@ -253,31 +451,33 @@ func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, message
 				})
 				continue
 			}
-			return messages, nil
+			return res.finish(ctx, messages, StopCompleted, nil)
 		}
 
 		stuck := true
-		for _, tc := range choice.Message.ToolCalls {
+		for j, tc := range choice.Message.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
+				return res.finish(ctx, messages, StopCancelled, err)
+			}
 			if cfg.Hooks.OnToolCall != nil {
 				cfg.Hooks.OnToolCall(tc)
 			}
 
-			tool := cfg.Tools.Get(tc.Function.Name)
-			var result *tools.ToolResult
-			if tool == nil {
-				result = tools.ErrorResult(fmt.Sprintf("unknown tool: %s", tc.Function.Name))
-			} else {
-				var execErr error
-				result, execErr = tool.Execute(ctx, tc.Function.Arguments)
-				if execErr != nil {
-					return messages, fmt.Errorf("tool %q execution error: %w", tc.Function.Name, execErr)
+			started := time.Now()
+			result, execErr := executeTool(ctx, &cfg.Config, tc)
+			res.addToolCall(tc.Function.Name, execErr != nil || result.IsError, time.Since(started))
+			if execErr != nil {
+				if ctx.Err() != nil {
+					messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
 				}
+				return res.finish(ctx, messages, StopError, fmt.Errorf("tool %q execution error: %w", tc.Function.Name, execErr))
 			}
 
 			key := toolCallKey(tc)
 			if result.IsError {
 				errorCounts[key]++
-				if errorCounts[key] >= maxConsecutiveErrors {
+				if errorCounts[key] >= cfg.MaxRepeatedErrors {
 					result.Output += "\n\nYou have repeated this exact failing call multiple times. Do NOT retry it. Either try different arguments or respond to the user explaining what went wrong."
 				}
 			} else {
@@ -299,7 +499,7 @@ func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, message
 
 		allRepeats := true
 		for _, tc := range choice.Message.ToolCalls {
-			if errorCounts[toolCallKey(tc)] < maxConsecutiveErrors {
+			if errorCounts[toolCallKey(tc)] < cfg.MaxRepeatedErrors {
 				allRepeats = false
 				break
 			}
@@ -307,31 +507,34 @@ func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, message
 		if stuck && allRepeats {
 			anyOverLimit := false
 			for _, tc := range choice.Message.ToolCalls {
-				if errorCounts[toolCallKey(tc)] > maxConsecutiveErrors {
+				if errorCounts[toolCallKey(tc)] > cfg.MaxRepeatedErrors {
 					anyOverLimit = true
 					break
 				}
 			}
 			if anyOverLimit {
-				return messages, fmt.Errorf("agent stuck: repeated identical failing tool calls")
+				return res.finish(ctx, messages, StopStuck, fmt.Errorf("agent stuck: repeated identical failing tool calls"))
 			}
 		}
 	}
 
-	return messages, fmt.Errorf("agent loop reached maximum iterations (%d)", cfg.MaxIterations)
+	return res.finish(ctx, messages, StopMaxIterations, fmt.Errorf("agent loop reached maximum iterations (%d)", cfg.MaxIterations))
 }
 
 func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *StreamingConfig) (*api.ChatCompletionResponse, error) {
 	var (
-		content       strings.Builder
-		role          string
-		model         string
-		id            string
-		finishReason  string
-		toolCalls     []api.ToolCall
-		toolArgBuf    = make(map[int]*strings.Builder)
-		gotContent    bool
-		thinkingDone  bool
+		content      strings.Builder
+		thought      strings.Builder
+		splitter     reasoning.Splitter
+		role         string
+		model        string
+		id           string
+		finishReason string
+		toolCalls    []api.ToolCall
+		toolArgBuf   = make(map[int]*strings.Builder)
+		gotContent   bool
+		thinkingDone bool
+		usage        *api.Usage
 	)
 
 	for ev := range events {
@@ -344,6 +547,12 @@ func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *Streaming
 		if ev.Done {
 			break
 		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
+		if ev.Status != nil && cfg.OnStatus != nil {
+			cfg.OnStatus(*ev.Status)
+		}
 		if ev.Chunk == nil {
 			continue
 		}
@@ -362,15 +571,23 @@ func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *Streaming
 			if choice.FinishReason != nil {
 				finishReason = *choice.FinishReason
 			}
-			if choice.Delta.Content != "" {
+			text, thinking := splitter.Split(choice.Delta.Content)
+			thinking = choice.Delta.ReasoningContent + thinking
+			if thinking != "" {
+				thought.WriteString(thinking)
+				if cfg.OnReasoningDelta != nil {
+					cfg.OnReasoningDelta(thinking)
+				}
+			}
+			if text != "" {
 				if !thinkingDone && cfg.OnThinkingDone != nil {
 					cfg.OnThinkingDone()
 					thinkingDone = true
 				}
 				gotContent = true
-				content.WriteString(choice.Delta.Content)
+				content.WriteString(text)
 				if cfg.OnContentDelta != nil {
-					cfg.OnContentDelta(choice.Delta.Content)
+					cfg.OnContentDelta(text)
 				}
 			}
 
@@ -399,9 +616,20 @@ func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *Streaming
 		}
 	}
 
+	text, thinking := splitter.Flush()
+	thought.WriteString(thinking)
+	if thinking != "" && cfg.OnReasoningDelta != nil {
+		cfg.OnReasoningDelta(thinking)
+	}
 	if !thinkingDone && cfg.OnThinkingDone != nil {
 		cfg.OnThinkingDone()
 	}
+	if text != "" {
+		content.WriteString(text)
+		if cfg.OnContentDelta != nil {
+			cfg.OnContentDelta(text)
+		}
+	}
 	_ = gotContent
 
 	for idx, buf := range toolArgBuf {
@@ -415,8 +643,9 @@ func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *Streaming
 	}
 
 	msg := api.Message{
-		Role:    role,
-		Content: content.String(),
+		Role:             role,
+		Content:          content.String(),
+		ReasoningContent: thought.String(),
 	}
 	if len(toolCalls) > 0 {
 		msg.ToolCalls = toolCalls
@@ -440,10 +669,14 @@ func accumulateWithCallbacks(events <-chan apiclient.StreamEvent, cfg *Streaming
 				FinishReason: finishReason,
 			},
 		},
+		Usage: usage,
 	}, nil
 }
 
-func looksLikeContinuation(text string) bool {
+// LooksLikeContinuation is the default Config.NeedsNudge. It matches
+// English phrases announcing further work ("let me", "next,") and replies
+// hedged with two or more speculation words ("probably", "might be").
+func LooksLikeContinuation(text string) bool {
 	lower := strings.ToLower(text)
 
 	intentPrefixes := []string{
@@ -479,6 +712,22 @@ func stripNarration(msg *api.Message) {
 	}
 }
 
+// fitTokens brings messages within cfg.MaxTokens, compacting the run's
+// earlier tool exchanges with cfg.Compact first and truncating tool results
+// if that is not enough.
+func fitTokens(ctx context.Context, cfg *Config, res *RunResult, messages []api.Message, start int) []api.Message {
+	if cfg.TokenEstimator.EstimateMessages(messages) <= cfg.MaxTokens {
+		return messages
+	}
+	if cfg.Compact != nil {
+		if compacted, err := cfg.Compact(ctx, messages, start); err == nil && len(compacted) < len(messages) {
+			messages = compacted
+			res.Compactions++
+		}
+	}
+	return truncateToolResults(messages, cfg.MaxTokens, cfg.TokenEstimator)
+}
+
 func truncateToolResults(messages []api.Message, maxTokens int, estimator *chatctx.TokenEstimator) []api.Message {
 	total := estimator.EstimateMessages(messages)
 	if total <= maxTokens {
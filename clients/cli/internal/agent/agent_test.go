@@ -0,0 +1,408 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// echoTool succeeds unless its arguments are {"fail":true}.
+type echoTool struct{}
+
+func (echoTool) Name() string                { return "echo" }
+func (echoTool) Description() string         { return "echo" }
+func (echoTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (echoTool) Execute(_ context.Context, args string) (*tools.ToolResult, error) {
+	if args == `{"fail":true}` {
+		return tools.ErrorResult("failed"), nil
+	}
+	return &tools.ToolResult{Output: "ok"}, nil
+}
+
+// scripted returns a CompletionFunc that replies with msgs in turn, each
+// reporting 10 tokens of usage, then repeats the last one.
+func scripted(msgs ...api.Message) CompletionFunc {
+	i := 0
+	return func(context.Context, *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		msg := msgs[min(i, len(msgs)-1)]
+		i++
+		finish := "stop"
+		if len(msg.ToolCalls) > 0 {
+			finish = "tool_calls"
+		}
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{Message: msg, FinishReason: finish}},
+			Usage:   &api.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10},
+		}, nil
+	}
+}
+
+func echoCall(args string) api.Message {
+	return api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{
+		ID:       "call",
+		Type:     "function",
+		Function: api.ToolCallFunction{Name: "echo", Arguments: args},
+	}}}
+}
+
+func testConfig() Config {
+	reg := tools.NewRegistry()
+	reg.Register(echoTool{})
+	return Config{MaxIterations: 5, Tools: reg}
+}
+
+func TestRunResultCompleted(t *testing.T) {
+	complete := scripted(
+		echoCall(`{}`),
+		echoCall(`{"fail":true}`),
+		api.Message{Role: "assistant", Content: "done"},
+	)
+	history := []api.Message{{Role: "user", Content: "go"}}
+
+	res, err := Run(context.Background(), complete, history, testConfig())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.StopReason != StopCompleted {
+		t.Errorf("StopReason = %q, want %q", res.StopReason, StopCompleted)
+	}
+	if res.Iterations != 3 {
+		t.Errorf("Iterations = %d, want 3", res.Iterations)
+	}
+	if res.ToolCalls != 2 || res.ToolErrors != 1 || res.ToolCounts["echo"] != 2 {
+		t.Errorf("tool stats = %d calls, %d errors, %v; want 2, 1, map[echo:2]", res.ToolCalls, res.ToolErrors, res.ToolCounts)
+	}
+	if res.Usage.TotalTokens != 30 {
+		t.Errorf("Usage.TotalTokens = %d, want 30", res.Usage.TotalTokens)
+	}
+	if _, timed := res.ToolTime["echo"]; !timed || res.ModelTime > res.Duration {
+		t.Errorf("ToolTime = %v, ModelTime = %v of %v", res.ToolTime, res.ModelTime, res.Duration)
+	}
+	added := res.NewMessages(len(history))
+	if len(added) != 5 || added[len(added)-1].Content != "done" {
+		t.Errorf("NewMessages = %+v, want 5 messages ending with the answer", added)
+	}
+}
+
+func TestRunResultMaxIterations(t *testing.T) {
+	res, err := Run(context.Background(), scripted(echoCall(`{}`)), nil, testConfig())
+	if err == nil {
+		t.Fatal("Run succeeded, want an error")
+	}
+	if res.StopReason != StopMaxIterations || res.Iterations != 5 {
+		t.Errorf("result = %q after %d iterations, want %q after 5", res.StopReason, res.Iterations, StopMaxIterations)
+	}
+}
+
+func TestRunResultStuck(t *testing.T) {
+	res, err := Run(context.Background(), scripted(echoCall(`{"fail":true}`)), nil, testConfig())
+	if err == nil {
+		t.Fatal("Run succeeded, want an error")
+	}
+	if res.StopReason != StopStuck {
+		t.Errorf("StopReason = %q, want %q", res.StopReason, StopStuck)
+	}
+}
+
+func TestRunResultCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	complete := func(ctx context.Context, _ *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		return nil, ctx.Err()
+	}
+	res, err := Run(ctx, complete, nil, testConfig())
+	if err == nil {
+		t.Fatal("Run succeeded, want an error")
+	}
+	if res.StopReason != StopCancelled {
+		t.Errorf("StopReason = %q, want %q", res.StopReason, StopCancelled)
+	}
+}
+
+func TestRunResultNudges(t *testing.T) {
+	complete := scripted(
+		api.Message{Role: "assistant", Content: "Let me check the files."},
+		api.Message{Role: "assistant", Content: "done"},
+	)
+	res, err := Run(context.Background(), complete, nil, testConfig())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Nudges != 1 {
+		t.Errorf("Nudges = %d, want 1", res.Nudges)
+	}
+}
+
+// cancelTool cancels the run it is called from.
+type cancelTool struct{ cancel context.CancelFunc }
+
+func (cancelTool) Name() string                { return "cancel" }
+func (cancelTool) Description() string         { return "cancel" }
+func (cancelTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (c cancelTool) Execute(context.Context, string) (*tools.ToolResult, error) {
+	c.cancel()
+	return &tools.ToolResult{Output: "ok"}, nil
+}
+
+func TestRunStopsBetweenToolCalls(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := testConfig()
+	cfg.Tools.Register(cancelTool{cancel: cancel})
+
+	calls := 0
+	complete := func(context.Context, *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		calls++
+		msg := api.Message{Role: "assistant", ToolCalls: []api.ToolCall{
+			{ID: "a", Type: "function", Function: api.ToolCallFunction{Name: "cancel", Arguments: "{}"}},
+			{ID: "b", Type: "function", Function: api.ToolCallFunction{Name: "echo", Arguments: "{}"}},
+		}}
+		return &api.ChatCompletionResponse{Choices: []api.Choice{{Message: msg, FinishReason: "tool_calls"}}}, nil
+	}
+
+	res, err := Run(ctx, complete, nil, cfg)
+	if !errors.Is(err, ErrCancelled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want ErrCancelled wrapping context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Errorf("completions = %d, want 1", calls)
+	}
+	if res.ToolCounts["echo"] != 0 {
+		t.Error("echo ran after the run was cancelled")
+	}
+	// Every tool call is answered, the skipped one with a placeholder.
+	last := res.Messages[len(res.Messages)-1]
+	if len(res.Messages) != 3 || last.ToolCallID != "b" {
+		t.Errorf("messages = %+v, want the assistant turn and two tool results", res.Messages)
+	}
+}
+
+func TestRunRetriesTransientFailures(t *testing.T) {
+	failures := []error{io.ErrUnexpectedEOF, api.NewError(http.StatusBadGateway, api.CodeGPUError, "bad gateway")}
+	answer := scripted(api.Message{Role: "assistant", Content: "done"})
+	complete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		if len(failures) > 0 {
+			err := failures[0]
+			failures = failures[1:]
+			return nil, err
+		}
+		return answer(ctx, req)
+	}
+	cfg := testConfig()
+	cfg.Retry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	var retries []int
+	cfg.Hooks.OnRetry = func(attempt, maxAttempts int, _ error) {
+		retries = append(retries, attempt)
+	}
+
+	res, err := Run(context.Background(), complete, nil, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Retries != 2 || len(retries) != 2 || retries[1] != 2 {
+		t.Errorf("Retries = %d, OnRetry attempts = %v; want 2 and [1 2]", res.Retries, retries)
+	}
+}
+
+func TestRunDoesNotRetryPermanentFailures(t *testing.T) {
+	calls := 0
+	complete := func(context.Context, *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		calls++
+		return nil, api.NewError(http.StatusBadRequest, api.CodeContextExceeded, "too long")
+	}
+	cfg := testConfig()
+	cfg.Retry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	res, err := Run(context.Background(), complete, nil, cfg)
+	if !api.IsCode(err, api.CodeContextExceeded) {
+		t.Fatalf("err = %v, want the context_exceeded error", err)
+	}
+	if calls != 1 || res.StopReason != StopError {
+		t.Errorf("calls = %d, StopReason = %q; want 1 and %q", calls, res.StopReason, StopError)
+	}
+}
+
+func TestRunNudgeConfig(t *testing.T) {
+	reply := api.Message{Role: "assistant", Content: "Voy a revisar los archivos."}
+	done := api.Message{Role: "assistant", Content: "listo"}
+
+	cfg := testConfig()
+	cfg.NeedsNudge = func(content string) bool { return strings.HasPrefix(content, "Voy a") }
+	res, err := Run(context.Background(), scripted(reply, done), nil, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Nudges != 1 {
+		t.Errorf("custom NeedsNudge: Nudges = %d, want 1", res.Nudges)
+	}
+
+	cfg.MaxNudges = -1
+	res, err = Run(context.Background(), scripted(reply, done), nil, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Nudges != 0 || res.Iterations != 1 {
+		t.Errorf("MaxNudges < 0: %d nudges in %d iterations, want 0 in 1", res.Nudges, res.Iterations)
+	}
+}
+
+func TestRunMaxRepeatedErrors(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxIterations = 10
+	cfg.MaxRepeatedErrors = 1
+	res, err := Run(context.Background(), scripted(echoCall(`{"fail":true}`)), nil, cfg)
+	if err == nil || res.StopReason != StopStuck {
+		t.Fatalf("err = %v, StopReason = %q; want %q", err, res.StopReason, StopStuck)
+	}
+	if res.Iterations != 2 {
+		t.Errorf("stuck after %d iterations, want 2", res.Iterations)
+	}
+}
+
+// bigTool returns a long output.
+type bigTool struct{}
+
+func (bigTool) Name() string                { return "big" }
+func (bigTool) Description() string         { return "big" }
+func (bigTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (bigTool) Execute(context.Context, string) (*tools.ToolResult, error) {
+	return &tools.ToolResult{Output: strings.Repeat("line of output\n", 100)}, nil
+}
+
+func TestRunCompactsWhenOverBudget(t *testing.T) {
+	history := []api.Message{{Role: "user", Content: "go"}}
+	cfg := testConfig()
+	cfg.Tools.Register(bigTool{})
+	cfg.MaxTokens = 200
+	cfg.TokenEstimator = chatctx.NewTokenEstimator()
+	var starts []int
+	cfg.Compact = func(_ context.Context, msgs []api.Message, start int) ([]api.Message, error) {
+		starts = append(starts, start)
+		return append(msgs[:start:start], api.Message{Role: "system", Content: "[Earlier in this turn] read it"}), nil
+	}
+
+	bigCall := api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{
+		ID: "call", Type: "function", Function: api.ToolCallFunction{Name: "big", Arguments: "{}"},
+	}}}
+	res, err := Run(context.Background(), scripted(bigCall, api.Message{Role: "assistant", Content: "done"}), history, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Compactions != 1 || len(starts) != 1 || starts[0] != len(history) {
+		t.Errorf("Compactions = %d, starts = %v; want one compaction from %d", res.Compactions, starts, len(history))
+	}
+	if got := res.NewMessages(len(history)); len(got) != 2 || got[0].Role != "system" {
+		t.Errorf("messages after compaction = %+v, want the summary and the answer", got)
+	}
+}
+
+func TestRunStopsBackgroundProcesses(t *testing.T) {
+	cfg := testConfig()
+	cfg.Tools.Register(&tools.ProcessStartTool{})
+	cfg.Tools.Register(&tools.ProcessStatusTool{})
+	start := api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{
+		ID:       "call",
+		Type:     "function",
+		Function: api.ToolCallFunction{Name: "process_start", Arguments: `{"command":"exec sleep 60","wait_seconds":1}`},
+	}}}
+
+	// The run makes its own table; the spy hands it out for inspection.
+	var table *tools.ProcessTable
+	cfg.Tools.Register(tableSpy{&table})
+	spy := api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{ID: "spy", Type: "function", Function: api.ToolCallFunction{Name: "spy", Arguments: "{}"}}}}
+
+	if _, err := Run(context.Background(), scripted(start, spy, api.Message{Role: "assistant", Content: "done"}), nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+	status, _ := cfg.Tools.Execute(tools.WithProcessTable(context.Background(), table), "process_status", "{}", 0)
+	if !strings.HasPrefix(status.Output, "1\texited (signal: terminated)") {
+		t.Errorf("status after the run = %q", status.Output)
+	}
+}
+
+// tableSpy records the process table of the run it is called in.
+type tableSpy struct{ table **tools.ProcessTable }
+
+func (tableSpy) Name() string                { return "spy" }
+func (tableSpy) Description() string         { return "spy" }
+func (tableSpy) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (s tableSpy) Execute(ctx context.Context, _ string) (*tools.ToolResult, error) {
+	*s.table = tools.ProcessTableFrom(ctx)
+	return &tools.ToolResult{Output: "ok"}, nil
+}
+
+// namedTool is a tool that does nothing, registered under a given name.
+type namedTool string
+
+func (n namedTool) Name() string                { return string(n) }
+func (n namedTool) Description() string         { return "Does " + string(n) + ". More detail." }
+func (n namedTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (n namedTool) Execute(context.Context, string) (*tools.ToolResult, error) {
+	return &tools.ToolResult{Output: "ok"}, nil
+}
+
+func TestRunRouteTools(t *testing.T) {
+	reg := tools.NewRegistry()
+	for _, name := range []string{"file_read", "shell_exec", "web_search", "db_query"} {
+		reg.Register(namedTool(name))
+	}
+	var sent [][]api.Tool
+	var routePrompt string
+	complete := func(_ context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		if req.Tools == nil {
+			routePrompt = req.Messages[1].Content
+			return &api.ChatCompletionResponse{Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "shell_exec, made_up"}}}}, nil
+		}
+		sent = append(sent, req.Tools)
+		return &api.ChatCompletionResponse{Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "done"}}}}, nil
+	}
+
+	var routed []string
+	cfg := Config{MaxIterations: 5, Tools: reg, RouteTools: true, Hooks: Hooks{OnToolsRouted: func(names []string) { routed = names }}}
+	if _, err := Run(context.Background(), complete, []api.Message{{Role: "user", Content: "run the tests"}}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(routePrompt, "run the tests") || !strings.Contains(routePrompt, "- web_search: Does web_search.\n") {
+		t.Errorf("routing prompt = %q", routePrompt)
+	}
+	if strings.Join(routed, ",") != "file_read,shell_exec" {
+		t.Errorf("routed = %v", routed)
+	}
+	if len(sent) != 1 || len(sent[0]) != 2 {
+		t.Errorf("tools sent = %+v", sent)
+	}
+}
+
+func TestRunDeclinedToolCalls(t *testing.T) {
+	cfg := testConfig()
+	var asked []string
+	cfg.ApproveTool = func(_ context.Context, call api.ToolCall) bool {
+		asked = append(asked, call.Function.Arguments)
+		return call.Function.Arguments != `{"deny":true}`
+	}
+	complete := scripted(
+		echoCall(`{"deny":true}`),
+		echoCall(`{}`),
+		api.Message{Role: "assistant", Content: "done"},
+	)
+
+	res, err := Run(context.Background(), complete, nil, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(asked) != 2 {
+		t.Errorf("asked about %v, want both calls", asked)
+	}
+	if res.ToolErrors != 1 || !strings.Contains(res.Messages[1].Content, "declined") {
+		t.Errorf("ToolErrors = %d, first result %q; want the declined call to fail", res.ToolErrors, res.Messages[1].Content)
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// planPrompt is appended as a user message when the planning phase starts.
+const planPrompt = `Before changing anything, plan the work. Use only the read-only tools available to you (file_read, list_dir, grep_search, find_files) to understand the code. Do not attempt to modify files or run commands.
+
+When you are ready, reply with the plan in exactly this format and stop:
+
+## Goal
+<one sentence describing the outcome>
+
+## Steps
+1. <concrete step>
+2. <concrete step>
+
+## Files
+- <path>: <what changes and why>`
+
+// planApprovedPrompt tells the model to carry out the plan it just wrote.
+const planApprovedPrompt = "The plan is approved. Carry it out now; you have the full tool set available."
+
+// runPlanPhase runs run with the read-only tool subset and the planning
+// prompt, then asks cfg.ConfirmPlan whether to go ahead. It returns the
+// planning run, whose Messages hold the updated history, and whether
+// execution should continue.
+func runPlanPhase(messages []api.Message, cfg Config, run func([]api.Message, Config) (*RunResult, error)) (*RunResult, bool, error) {
+	planCfg := cfg
+	planCfg.PlanFirst = false
+	planCfg.Tools = cfg.Tools.Subset(tools.ReadOnlyToolNames...)
+
+	messages = append(messages, api.Message{Role: "user", Content: planPrompt})
+	res, err := run(messages, planCfg)
+	if err != nil {
+		return res, false, err
+	}
+
+	plan := lastAssistantContent(res.Messages)
+	if cfg.ConfirmPlan != nil && !cfg.ConfirmPlan(plan) {
+		return res, false, nil
+	}
+
+	res.Messages = append(res.Messages, api.Message{Role: "user", Content: planApprovedPrompt})
+	return res, true, nil
+}
+
+func lastAssistantContent(messages []api.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && strings.TrimSpace(messages[i].Content) != "" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// StopReason says why an agent run ended.
+type StopReason string
+
+const (
+	StopCompleted     StopReason = "completed"      // the model answered without calling tools
+	StopMaxIterations StopReason = "max_iterations" // cfg.MaxIterations was reached
+	StopStuck         StopReason = "stuck"          // the model kept repeating the same failing tool calls
+	StopCancelled     StopReason = "cancelled"      // the context was cancelled
+	StopPlanRejected  StopReason = "plan_rejected"  // ConfirmPlan turned the plan down
+	StopError         StopReason = "error"          // a completion or tool call failed
+)
+
+// ErrCancelled is returned when a run stops because its context was
+// cancelled. It wraps the underlying error, so errors.Is(err,
+// context.Canceled) still holds.
+var ErrCancelled = errors.New("agent run cancelled")
+
+// RunResult is the outcome of an agent run. Run and RunStreaming return one
+// even when they fail, so callers can report how far the run got.
+type RunResult struct {
+	// Messages is the history passed in followed by everything the run
+	// added.
+	Messages   []api.Message
+	Iterations int // completions requested, including the planning phase
+	ToolCalls  int
+	ToolErrors int            // tool calls whose result was an error
+	ToolCounts map[string]int // calls per tool name
+	// ToolTime is the time spent running each tool, by name, and ModelTime
+	// the time spent waiting for completions, retries included.
+	ToolTime  map[string]time.Duration
+	ModelTime time.Duration
+	// Usage sums the token usage of every completion that reported it.
+	Usage      api.Usage
+	Duration   time.Duration
+	StopReason StopReason
+	Nudges     int // times the model was told to use its tools instead of guessing
+	Retries    int // failed completions that were retried
+	// Compactions counts the times the run's earlier tool exchanges were
+	// summarized to fit MaxTokens.
+	Compactions int
+
+	started time.Time
+}
+
+func newRunResult() *RunResult {
+	return &RunResult{ToolCounts: make(map[string]int), ToolTime: make(map[string]time.Duration), started: time.Now()}
+}
+
+// NewMessages returns the messages the run added to the history it was
+// given, which was n messages long.
+func (r *RunResult) NewMessages(n int) []api.Message {
+	if r == nil || len(r.Messages) <= n {
+		return nil
+	}
+	return r.Messages[n:]
+}
+
+func (r *RunResult) addUsage(u *api.Usage) {
+	if u == nil {
+		return
+	}
+	r.Usage.PromptTokens += u.PromptTokens
+	r.Usage.CompletionTokens += u.CompletionTokens
+	r.Usage.TotalTokens += u.TotalTokens
+}
+
+func (r *RunResult) addToolCall(name string, isError bool, elapsed time.Duration) {
+	r.ToolCalls++
+	r.ToolCounts[name]++
+	r.ToolTime[name] += elapsed
+	if isError {
+		r.ToolErrors++
+	}
+}
+
+// merge adds the counters of a nested run, the planning phase, to r.
+func (r *RunResult) merge(o *RunResult) {
+	r.Iterations += o.Iterations
+	r.ToolCalls += o.ToolCalls
+	r.ToolErrors += o.ToolErrors
+	for name, n := range o.ToolCounts {
+		r.ToolCounts[name] += n
+	}
+	for name, d := range o.ToolTime {
+		r.ToolTime[name] += d
+	}
+	r.ModelTime += o.ModelTime
+	r.addUsage(&o.Usage)
+	r.Nudges += o.Nudges
+	r.Retries += o.Retries
+	r.Compactions += o.Compactions
+}
+
+// finish records how the run ended and returns r with err. A failure after
+// ctx was cancelled counts as a cancellation whatever the reason given, and
+// its error is wrapped in ErrCancelled.
+func (r *RunResult) finish(ctx context.Context, messages []api.Message, reason StopReason, err error) (*RunResult, error) {
+	if err != nil && ctx.Err() != nil {
+		reason = StopCancelled
+		if !errors.Is(err, ErrCancelled) {
+			err = fmt.Errorf("%w: %w", ErrCancelled, err)
+		}
+	}
+	r.Messages = messages
+	r.StopReason = reason
+	r.Duration = time.Since(r.started)
+	return r, err
+}
+
+// cancelledToolResults answers the tool calls a cancelled run never made, so
+// the history stays valid to send again.
+func cancelledToolResults(calls []api.ToolCall) []api.Message {
+	msgs := make([]api.Message, len(calls))
+	for i, tc := range calls {
+		msgs[i] = api.Message{
+			Role:       "tool",
+			Content:    "Not run: the user cancelled the request.",
+			ToolCallID: tc.ID,
+			Name:       tc.Function.Name,
+		}
+	}
+	return msgs
+}
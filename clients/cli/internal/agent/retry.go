@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// RetryPolicy configures how a failed completion request is retried. The
+// zero value never retries.
+type RetryPolicy struct {
+	Attempts   int           // retries after the first failure
+	Backoff    time.Duration // delay before the first retry, doubled for each one after
+	MaxBackoff time.Duration // upper bound on the delay (0 = none)
+	// Retryable reports whether err is worth retrying. nil means
+	// IsRetryable.
+	Retryable func(err error) bool
+}
+
+// DefaultRetry retries transient failures three times over about seven
+// seconds.
+var DefaultRetry = RetryPolicy{Attempts: 3, Backoff: time.Second, MaxBackoff: 4 * time.Second}
+
+// IsRetryable reports whether err looks transient: a connection dropped or
+// refused mid-request, or a 502, 503 or 504 from the backend or the GPU
+// server behind it.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return apiErr.Code == api.CodeGPUError
+	}
+	return false
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// delay returns how long to wait before retry n, counting from 0.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.Backoff << n
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// withRetry calls attempt until it succeeds, fails in a way cfg.Retry does
+// not retry, or runs out of retries, calling cfg.Hooks.OnRetry before each
+// retry. It gives up early, returning the last error, if ctx is cancelled.
+func withRetry[T any](ctx context.Context, cfg *Config, res *RunResult, attempt func() (T, error)) (T, error) {
+	for n := 0; ; n++ {
+		v, err := attempt()
+		if err == nil || n >= cfg.Retry.Attempts || ctx.Err() != nil || !cfg.Retry.retryable(err) {
+			return v, err
+		}
+		res.Retries++
+		if cfg.Hooks.OnRetry != nil {
+			cfg.Hooks.OnRetry(n+1, cfg.Retry.Attempts, err)
+		}
+		select {
+		case <-time.After(cfg.Retry.delay(n)):
+		case <-ctx.Done():
+			return v, err
+		}
+	}
+}
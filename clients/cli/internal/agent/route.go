@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// routePrompt asks the model which tools a task needs.
+const routePrompt = `You are choosing the tools a coding agent gets for a task. Reply with the names of the tools it will need, separated by commas, and nothing else. Leave out tools that are clearly irrelevant; when unsure, include the tool.`
+
+// routeMaxTokens bounds the routing reply, a short list of names.
+const routeMaxTokens = 200
+
+// routeTools asks the model which of registry's tools the task needs: the
+// last user message other than the planning prompts. It returns the
+// registry narrowed to those and tools.ReadOnlyToolNames, which any task
+// may need, or registry itself when the reply names no tool.
+func routeTools(ctx context.Context, complete CompletionFunc, messages []api.Message, registry *tools.Registry) (*tools.Registry, *api.Usage, error) {
+	task := ""
+	for i := len(messages) - 1; i >= 0; i-- {
+		if m := messages[i]; m.Role == "user" && m.Content != planPrompt && m.Content != planApprovedPrompt {
+			task = messages[i].Content
+			break
+		}
+	}
+
+	var list strings.Builder
+	defs := registry.APITools()
+	for _, t := range defs {
+		fmt.Fprintf(&list, "- %s: %s\n", t.Function.Name, tools.ShortDescription(t.Function.Description))
+	}
+	maxTokens := routeMaxTokens
+	resp, err := complete(ctx, &api.ChatCompletionRequest{
+		Messages: []api.Message{
+			{Role: "system", Content: routePrompt},
+			{Role: "user", Content: "Task:\n" + task + "\n\nTools:\n" + list.String()},
+		},
+		MaxTokens: &maxTokens,
+	})
+	if err != nil {
+		return registry, nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return registry, resp.Usage, fmt.Errorf("empty response from model")
+	}
+
+	named := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(resp.Choices[0].Message.Content, func(r rune) bool {
+		return r != '_' && (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	}) {
+		named[word] = true
+	}
+	var keep []string
+	for _, t := range defs {
+		if named[t.Function.Name] {
+			keep = append(keep, t.Function.Name)
+		}
+	}
+	if len(keep) == 0 {
+		return registry, resp.Usage, nil
+	}
+	return registry.Subset(append(keep, tools.ReadOnlyToolNames...)...), resp.Usage, nil
+}
+
+// route narrows cfg.Tools for the run when cfg.RouteTools is set. A failed
+// routing step keeps the full set rather than failing the run.
+func route(ctx context.Context, cfg *Config, res *RunResult, messages []api.Message, complete CompletionFunc) {
+	if !cfg.RouteTools {
+		return
+	}
+	routed, usage, err := routeTools(ctx, complete, messages, cfg.Tools)
+	res.addUsage(usage)
+	if err != nil {
+		return
+	}
+	cfg.Tools = routed
+	if cfg.Hooks.OnToolsRouted != nil {
+		cfg.Hooks.OnToolsRouted(routed.Names())
+	}
+}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/internal/chatctx"
+	"github.com/ThatCatDev/tanrenai/client/internal/tools"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+const (
+	// SpawnAgentTimeout is the registry timeout to give spawn_agent; sub-agents
+	// run whole agent loops and need far longer than a single tool call.
+	SpawnAgentTimeout = 10 * time.Minute
+
+	defaultSubAgentIterations = 30
+	defaultSubAgentBudget     = 16000
+	maxParallelSubAgents      = 4
+)
+
+const subAgentSystemPrompt = `You are a sub-agent working on one focused task delegated by another agent.
+Use your tools to gather facts; do not guess. You cannot ask questions, so make reasonable assumptions and state them.
+When done, reply with a concise, factual report of what you found: file paths, line numbers, names, and conclusions. Your final message is returned verbatim to the delegating agent.`
+
+// errBudgetExhausted stops a sub-agent that has spent its token budget.
+var errBudgetExhausted = errors.New("token budget exhausted")
+
+// SpawnAgentTool runs nested agent loops for self-contained subtasks. Each
+// sub-agent starts from a fresh history, sees only the tools it is granted
+// (read-only by default, never spawn_agent itself) and stops once its token
+// budget is spent. Several tasks in one call run concurrently.
+type SpawnAgentTool struct {
+	Complete       StreamingCompletionFunc
+	Tools          *tools.Registry // parent registry the sub-agent tools are drawn from
+	TokenEstimator *chatctx.TokenEstimator
+	MaxIterations  int // per sub-agent (0 = 30)
+	TokenBudget    int // default budget per sub-agent in tokens (0 = 16000)
+}
+
+type spawnAgentArgs struct {
+	Task        string   `json:"task"`
+	Tasks       []string `json:"tasks"`
+	Tools       []string `json:"tools"`
+	TokenBudget int      `json:"token_budget"`
+}
+
+func (t *SpawnAgentTool) Name() string { return "spawn_agent" }
+
+func (t *SpawnAgentTool) Description() string {
+	return "Delegate a self-contained investigation to a sub-agent with its own fresh context, e.g. \"find every caller of Manager.Summarize and describe how each uses the result\". Pass several tasks to run them in parallel. Each sub-agent returns a written report; it cannot see this conversation, so describe the task completely."
+}
+
+func (t *SpawnAgentTool) Parameters() json.RawMessage {
+	return tools.Schema{
+		Type: "object",
+		Properties: map[string]tools.SchemaProperty{
+			"task":         {Type: "string", Description: "Task for a single sub-agent"},
+			"tasks":        {Type: "array", Description: "Independent tasks to run in parallel, one sub-agent each", Items: &tools.SchemaProperty{Type: "string"}},
+			"tools":        {Type: "array", Description: "Tool names the sub-agents may use (default: file_read, list_dir, grep_search, find_files)", Items: &tools.SchemaProperty{Type: "string"}},
+			"token_budget": {Type: "integer", Description: "Token budget per sub-agent (default: 16000)"},
+		},
+	}.MustMarshal()
+}
+
+func (t *SpawnAgentTool) Execute(ctx context.Context, arguments string) (*tools.ToolResult, error) {
+	var args spawnAgentArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return tools.ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+
+	tasks := args.Tasks
+	if strings.TrimSpace(args.Task) != "" {
+		tasks = append([]string{args.Task}, tasks...)
+	}
+	if len(tasks) == 0 {
+		return tools.ErrorResult("task or tasks is required"), nil
+	}
+	if len(tasks) > maxParallelSubAgents {
+		return tools.ErrorResult(fmt.Sprintf("at most %d tasks per call", maxParallelSubAgents)), nil
+	}
+
+	names := args.Tools
+	if len(names) == 0 {
+		names = tools.ReadOnlyToolNames
+	}
+	var allowed []string
+	for _, n := range names {
+		if n == t.Name() {
+			continue // no recursive spawning
+		}
+		if t.Tools.Get(n) == nil {
+			return tools.ErrorResult(fmt.Sprintf("unknown tool: %s", n)), nil
+		}
+		allowed = append(allowed, n)
+	}
+	subTools := t.Tools.Subset(allowed...)
+
+	budget := args.TokenBudget
+	if budget <= 0 {
+		budget = t.TokenBudget
+	}
+	if budget <= 0 {
+		budget = defaultSubAgentBudget
+	}
+
+	reports := make([]string, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = t.runSubAgent(ctx, task, subTools, budget)
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if len(reports) == 1 {
+		return &tools.ToolResult{Output: reports[0]}, nil
+	}
+	var b strings.Builder
+	for i, r := range reports {
+		fmt.Fprintf(&b, "## Sub-agent %d: %s\n\n%s\n\n", i+1, tasks[i], r)
+	}
+	return &tools.ToolResult{Output: strings.TrimSpace(b.String())}, nil
+}
+
+// subAgentSession returns a random prompt cache session ID.
+func subAgentSession() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "sub-" + hex.EncodeToString(b)
+}
+
+// runSubAgent runs one nested agent loop and returns its report.
+func (t *SpawnAgentTool) runSubAgent(ctx context.Context, task string, subTools *tools.Registry, budget int) string {
+	subCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	maxIter := t.MaxIterations
+	if maxIter <= 0 {
+		maxIter = defaultSubAgentIterations
+	}
+
+	spent := 0
+	charge := func(n int) {
+		spent += n
+		if spent >= budget {
+			cancel(errBudgetExhausted)
+		}
+	}
+
+	cfg := StreamingConfig{
+		Config: Config{
+			MaxIterations:  maxIter,
+			Tools:          subTools,
+			MaxTokens:      budget,
+			TokenEstimator: t.TokenEstimator,
+			Retry:          DefaultRetry,
+		},
+		OnIterationStart: func(iteration, _ int, messages []api.Message, lastUsage *api.Usage) {
+			if iteration == 1 {
+				return
+			}
+			if lastUsage != nil {
+				charge(lastUsage.TotalTokens)
+			} else if t.TokenEstimator != nil {
+				charge(t.TokenEstimator.EstimateMessages(messages))
+			}
+		},
+	}
+
+	messages := []api.Message{
+		{Role: "system", Content: subAgentSystemPrompt},
+		{Role: "user", Content: task},
+	}
+	// A sub-agent's prompt shares nothing with its parent's, so it gets its
+	// own prompt cache session rather than evicting the parent's.
+	session := subAgentSession()
+	complete := func(ctx context.Context, req *api.ChatCompletionRequest) (<-chan apiclient.StreamEvent, error) {
+		req.SessionID = session
+		return t.Complete(ctx, req)
+	}
+	result, err := RunStreaming(subCtx, complete, messages, cfg)
+	report := lastAssistantContent(result.Messages)
+
+	switch {
+	case errors.Is(context.Cause(subCtx), errBudgetExhausted):
+		if report == "" {
+			report = "(no findings before the budget ran out)"
+		}
+		return report + fmt.Sprintf("\n\n[sub-agent stopped: token budget of %d exhausted]", budget)
+	case err != nil:
+		if report == "" {
+			return fmt.Sprintf("[sub-agent failed: %v]", err)
+		}
+		return report + fmt.Sprintf("\n\n[sub-agent failed: %v]", err)
+	case report == "":
+		return "[sub-agent returned no report]"
+	}
+	return report
+}
@@ -0,0 +1,378 @@
+package apiclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// anthropicVersion is the Messages API version requests are written for.
+const anthropicVersion = "2023-06-01"
+
+// anthropicMaxTokens is the response limit for requests that set none,
+// since the Messages API requires one.
+const anthropicMaxTokens = 8192
+
+// Anthropic sends chat completions to Anthropic's Messages API, translating
+// requests and responses to and from the OpenAI format the rest of the
+// client uses.
+type Anthropic struct {
+	BaseURL string
+	APIKey  string
+	KeyEnv  string // where APIKey came from, for the error when it is unset
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]string  `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+func (a *Anthropic) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+	wire := toAnthropic(req)
+	resp, err := a.post(ctx, wire)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return fromAnthropic(&result), nil
+}
+
+func (a *Anthropic) StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error) {
+	wire := toAnthropic(req)
+	wire.Stream = true
+	resp, err := a.post(ctx, wire)
+	if err != nil {
+		return nil, err
+	}
+	return wrapStreamWithCleanup(parseAnthropicStream(resp.Body), resp.Body), nil
+}
+
+func (a *Anthropic) post(ctx context.Context, req *anthropicRequest) (*http.Response, error) {
+	if a.APIKey == "" {
+		return nil, missingKey(a.KeyEnv)
+	}
+	return postJSON(ctx, a.BaseURL+"/v1/messages", map[string]string{
+		"x-api-key":         a.APIKey,
+		"anthropic-version": anthropicVersion,
+	}, req)
+}
+
+// toAnthropic translates an OpenAI-style request. System messages become
+// the system prompt, tool results become tool_result blocks in a user
+// message, and consecutive messages with the same role are merged, since
+// the Messages API wants user and assistant turns to alternate.
+func toAnthropic(req *api.ChatCompletionRequest) *anthropicRequest {
+	out := &anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     anthropicMaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		TopK:          req.TopK,
+		StopSequences: req.Stop,
+	}
+	if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	}
+
+	var system []string
+	for _, m := range req.Messages {
+		var role string
+		var blocks []anthropicBlock
+		switch m.Role {
+		case "system":
+			system = append(system, m.Content)
+			continue
+		case "tool":
+			role = "user"
+			blocks = []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}}
+		case "assistant":
+			role = "assistant"
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+		default:
+			role = "user"
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, url := range m.Images {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: imageSource(url)})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, t := range req.Tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+	}
+	out.ToolChoice = anthropicToolChoice(req.ToolChoice)
+	return out
+}
+
+// anthropicToolChoice translates an OpenAI tool_choice: "auto", "none",
+// "required", or a named function.
+func anthropicToolChoice(choice any) map[string]string {
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "auto", "none":
+			return map[string]string{"type": c}
+		case "required":
+			return map[string]string{"type": "any"}
+		}
+	case map[string]any:
+		if fn, ok := c["function"].(map[string]any); ok {
+			if name, ok := fn["name"].(string); ok {
+				return map[string]string{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
+
+// imageSource turns an image URL or data URI into an image block source.
+func imageSource(url string) *anthropicSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok {
+			return &anthropicSource{Type: "base64", MediaType: strings.TrimSuffix(meta, ";base64"), Data: data}
+		}
+	}
+	return &anthropicSource{Type: "url", URL: url}
+}
+
+// fromAnthropic translates a Messages API response.
+func fromAnthropic(resp *anthropicResponse) *api.ChatCompletionResponse {
+	msg := api.Message{Role: "assistant"}
+	var text, thinking []string
+	for _, b := range resp.Content {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "thinking":
+			thinking = append(thinking, b.Thinking)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, api.ToolCall{
+				ID:       b.ID,
+				Type:     "function",
+				Function: api.ToolCallFunction{Name: b.Name, Arguments: string(b.Input)},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "")
+	msg.ReasoningContent = strings.Join(thinking, "")
+	return &api.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Model:   resp.Model,
+		Choices: []api.Choice{{Message: msg, FinishReason: finishReason(resp.StopReason)}},
+		Usage: &api.Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}
+}
+
+// finishReason maps a Messages API stop reason to OpenAI's finish reason.
+func finishReason(stop string) string {
+	switch stop {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// anthropicEvent is the data of a Messages API stream event; which fields
+// are set depends on its type.
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+// parseAnthropicStream reads a Messages API stream and sends it on as
+// OpenAI-style chunks. Tool calls are numbered in the order their blocks
+// start, and token usage comes with the finish reason.
+func parseAnthropicStream(r io.Reader) <-chan StreamEvent {
+	ch := make(chan StreamEvent)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+		var id, model string
+		var inputTokens int
+		toolIndex := map[int]int{} // content block index -> tool call index
+		chunk := func(delta api.MessageDelta, finish *string) *api.ChatCompletionChunk {
+			return &api.ChatCompletionChunk{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Model:   model,
+				Choices: []api.ChunkChoice{{Delta: delta, FinishReason: finish}},
+			}
+		}
+
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var ev anthropicEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				ch <- StreamEvent{Err: err}
+				return
+			}
+
+			switch ev.Type {
+			case "error":
+				ch <- StreamEvent{Err: api.DecodeError(0, []byte(data))}
+				return
+			case "message_start":
+				id, model = ev.Message.ID, ev.Message.Model
+				inputTokens = ev.Message.Usage.InputTokens
+				ch <- StreamEvent{Chunk: chunk(api.MessageDelta{Role: "assistant"}, nil)}
+			case "content_block_start":
+				if ev.ContentBlock.Type != "tool_use" {
+					continue
+				}
+				n := len(toolIndex)
+				toolIndex[ev.Index] = n
+				ch <- StreamEvent{Chunk: chunk(api.MessageDelta{ToolCalls: []api.ToolCallDelta{{
+					Index:    n,
+					ID:       ev.ContentBlock.ID,
+					Type:     "function",
+					Function: &api.ToolCallFunction{Name: ev.ContentBlock.Name},
+				}}}, nil)}
+			case "content_block_delta":
+				var delta api.MessageDelta
+				switch ev.Delta.Type {
+				case "text_delta":
+					delta.Content = ev.Delta.Text
+				case "thinking_delta":
+					delta.ReasoningContent = ev.Delta.Thinking
+				case "input_json_delta":
+					delta.ToolCalls = []api.ToolCallDelta{{
+						Index:    toolIndex[ev.Index],
+						Function: &api.ToolCallFunction{Arguments: ev.Delta.PartialJSON},
+					}}
+				default:
+					continue
+				}
+				ch <- StreamEvent{Chunk: chunk(delta, nil)}
+			case "message_delta":
+				reason := finishReason(ev.Delta.StopReason)
+				usage := &api.Usage{
+					PromptTokens:     inputTokens,
+					CompletionTokens: ev.Usage.OutputTokens,
+					TotalTokens:      inputTokens + ev.Usage.OutputTokens,
+				}
+				c := chunk(api.MessageDelta{}, &reason)
+				c.Usage = usage
+				ch <- StreamEvent{Chunk: c, Usage: usage}
+			case "message_stop":
+				ch <- StreamEvent{Done: true}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			ch <- StreamEvent{Err: err}
+		}
+	}()
+	return ch
+}
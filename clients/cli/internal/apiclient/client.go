@@ -1,12 +1,17 @@
 package apiclient
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
@@ -15,21 +20,43 @@ import (
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	opts       Options
+	breaker    *breaker
+	session    atomic.Value // string sent in api.SessionHeader
 }
 
-// New creates a new Client for the given backend URL.
+// New creates a new Client for the given backend URL with DefaultOptions.
 func New(baseURL string) *Client {
+	return NewWithOptions(baseURL, DefaultOptions())
+}
+
+// NewWithOptions creates a new Client for the given backend URL.
+func NewWithOptions(baseURL string, opts Options) *Client {
+	opts = opts.withDefaults()
 	return &Client{
 		baseURL:    baseURL,
-		httpClient: &http.Client{},
+		httpClient: &http.Client{Transport: newTransport(opts)},
+		opts:       opts,
+		breaker:    &breaker{threshold: opts.BreakerThreshold, cooldown: opts.BreakerCooldown},
 	}
 }
 
+// SetSession sends id in api.SessionHeader with every request from now on,
+// so the backend keeps this client's prompt cache slot and memories apart
+// from other clients' and applies the session's settings if it stores it.
+func (c *Client) SetSession(id string) {
+	c.session.Store(id)
+}
+
 // --- Completions (proxied through backend to GPU) ---
 
 // StreamCompletion sends a streaming chat completion request and returns a channel of events.
+// Token usage is requested for the final chunk unless the caller set StreamOptions.
 func (c *Client) StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error) {
 	req.Stream = true
+	if req.StreamOptions == nil {
+		req.StreamOptions = &api.StreamOptions{IncludeUsage: true}
+	}
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -41,7 +68,7 @@ func (c *Client) StreamCompletion(ctx context.Context, req *api.ChatCompletionRe
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, true)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -49,7 +76,7 @@ func (c *Client) StreamCompletion(ctx context.Context, req *api.ChatCompletionRe
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	events := ParseSSEStream(resp.Body)
@@ -70,7 +97,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequ
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -78,7 +105,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequ
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	var result api.ChatCompletionResponse
@@ -102,9 +129,10 @@ func (c *Client) MemorySearch(ctx context.Context, query string, limit int) (*ap
 	return &result, nil
 }
 
-// MemoryStore stores a conversation turn in memory.
-func (c *Client) MemoryStore(ctx context.Context, userMsg, assistMsg string) (string, error) {
-	req := api.MemoryStoreRequest{UserMsg: userMsg, AssistMsg: assistMsg}
+// MemoryStore stores a conversation turn in memory. importance is in [0, 1];
+// 0 lets the memory decay normally with age.
+func (c *Client) MemoryStore(ctx context.Context, userMsg, assistMsg string, importance float32) (string, error) {
+	req := api.MemoryStoreRequest{UserMsg: userMsg, AssistMsg: assistMsg, Importance: importance}
 	body, _ := json.Marshal(req)
 
 	var result api.MemoryStoreResponse
@@ -114,6 +142,17 @@ func (c *Client) MemoryStore(ctx context.Context, userMsg, assistMsg string) (st
 	return result.ID, nil
 }
 
+// StoreTrajectory records an agent turn with its tool calls and results
+// for tool-calling fine-tunes.
+func (c *Client) StoreTrajectory(ctx context.Context, req api.TrajectoryRequest) (string, error) {
+	body, _ := json.Marshal(req)
+	var result api.TrajectoryResponse
+	if err := c.postJSON(ctx, "/v1/memory/trajectories", body, &result); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
 // MemoryList lists recent memory entries.
 func (c *Client) MemoryList(ctx context.Context, limit int) (*api.MemoryListResponse, error) {
 	url := fmt.Sprintf("%s/v1/memory/list?limit=%d", c.baseURL, limit)
@@ -124,6 +163,19 @@ func (c *Client) MemoryList(ctx context.Context, limit int) (*api.MemoryListResp
 	return &result, nil
 }
 
+// MemorySetImportance changes the importance of a memory entry.
+func (c *Client) MemorySetImportance(ctx context.Context, id string, importance float32) error {
+	body, _ := json.Marshal(api.MemoryImportanceRequest{Importance: importance})
+	return c.postJSON(ctx, "/v1/memory/"+id+"/importance", body, nil)
+}
+
+// MemorySetRating rates a memory for fine-tuning: 1 thumbs up, -1 thumbs
+// down, 0 clears the rating.
+func (c *Client) MemorySetRating(ctx context.Context, id string, rating int) error {
+	body, _ := json.Marshal(api.MemoryRatingRequest{Rating: rating})
+	return c.postJSON(ctx, "/v1/memory/"+id+"/rating", body, nil)
+}
+
 // MemoryDelete deletes a memory entry by ID.
 func (c *Client) MemoryDelete(ctx context.Context, id string) error {
 	url := fmt.Sprintf("%s/v1/memory/%s", c.baseURL, id)
@@ -131,14 +183,14 @@ func (c *Client) MemoryDelete(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 	return nil
 }
@@ -150,14 +202,14 @@ func (c *Client) MemoryClear(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 	return nil
 }
@@ -172,12 +224,263 @@ func (c *Client) MemoryCount(ctx context.Context) (int, error) {
 	return result.Count, nil
 }
 
+// MemoryCompact merges near-duplicate memories on the backend. A threshold
+// of 0 uses the server's configured similarity.
+func (c *Client) MemoryCompact(ctx context.Context, threshold float32) (*api.MemoryCompactResponse, error) {
+	body, _ := json.Marshal(api.MemoryCompactRequest{Threshold: threshold})
+
+	var result api.MemoryCompactResponse
+	if err := c.postJSON(ctx, "/v1/memory/compact", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MemoryExport streams every memory, including embeddings, to w as JSONL and
+// returns the number of records written.
+func (c *Client) MemoryExport(ctx context.Context, w io.Writer) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1/memory/export", nil)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.do(httpReq, true)
+	if err != nil {
+		return 0, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Records carry a full embedding vector, which can exceed the default
+	// 64KB token limit.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return count, fmt.Errorf("write export: %w", err)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("read export: %w", err)
+	}
+	return count, nil
+}
+
+// MemoryImport uploads JSONL memory records, as written by MemoryExport, and
+// returns the number imported.
+func (c *Client) MemoryImport(ctx context.Context, r io.Reader) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/memory/import", r)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := c.do(httpReq, true)
+	if err != nil {
+		return 0, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	var result api.MemoryImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Imported, nil
+}
+
+// --- Fine-tuning (datasets built by backend, the rest proxied to GPU) ---
+
+// FinetuneDataset returns the statistics of the dataset req's filter
+// builds from memory, with up to req.Preview of its memories.
+func (c *Client) FinetuneDataset(ctx context.Context, req api.DatasetRequest) (*api.DatasetResponse, error) {
+	body, _ := json.Marshal(req)
+	var result api.DatasetResponse
+	if err := c.postJSON(ctx, "/v1/finetune/dataset", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FinetunePrepare creates a pending training run.
+func (c *Client) FinetunePrepare(ctx context.Context, req api.FinetunePrepareRequest) (*api.FinetuneRun, error) {
+	body, _ := json.Marshal(req)
+	var result api.FinetuneRun
+	if err := c.postJSON(ctx, "/v1/finetune/prepare", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FinetuneTrain starts training a prepared run.
+func (c *Client) FinetuneTrain(ctx context.Context, req api.FinetuneTrainRequest) error {
+	body, _ := json.Marshal(req)
+	return c.postJSON(ctx, "/v1/finetune/train", body, nil)
+}
+
+// FinetuneStatus returns a training run, with live metrics while it trains.
+func (c *Client) FinetuneStatus(ctx context.Context, runID string) (*api.FinetuneRun, error) {
+	var result api.FinetuneRun
+	if err := c.getJSON(ctx, c.baseURL+"/v1/finetune/status/"+url.PathEscape(runID), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FinetuneRuns lists the training runs, newest first, with their disk
+// usage.
+func (c *Client) FinetuneRuns(ctx context.Context) ([]api.FinetuneRun, error) {
+	var result struct {
+		Runs []api.FinetuneRun `json:"runs"`
+	}
+	if err := c.getJSON(ctx, c.baseURL+"/v1/finetune/runs", &result); err != nil {
+		return nil, err
+	}
+	return result.Runs, nil
+}
+
+// FinetuneGC removes the training runs a retention policy does not keep.
+func (c *Client) FinetuneGC(ctx context.Context, req api.FinetuneGCRequest) (*api.FinetuneGCResponse, error) {
+	body, _ := json.Marshal(req)
+	var result api.FinetuneGCResponse
+	if err := c.postJSON(ctx, "/v1/finetune/gc", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FinetuneFollow streams a run's progress to fn until it stops training,
+// returning the last event.
+func (c *Client) FinetuneFollow(ctx context.Context, runID string, fn func(api.FinetuneProgress)) (*api.FinetuneProgress, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1/finetune/events/"+url.PathEscape(runID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.do(httpReq, true)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	var last *api.FinetuneProgress
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var evt api.FinetuneProgress
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			continue
+		}
+		if evt.Error != "" && evt.Status == "" {
+			return last, fmt.Errorf("follow run: %s", evt.Error)
+		}
+		if fn != nil {
+			fn(evt)
+		}
+		last = &evt
+	}
+	if err := scanner.Err(); err != nil {
+		return last, fmt.Errorf("read progress: %w", err)
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no progress received")
+	}
+	return last, nil
+}
+
+// FinetuneRelease makes a trained run the live version of a model family.
+func (c *Client) FinetuneRelease(ctx context.Context, req api.FinetuneReleaseRequest) (*api.FinetuneRun, error) {
+	body, _ := json.Marshal(req)
+	var result api.FinetuneRun
+	if err := c.postJSON(ctx, "/v1/finetune/release", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FinetuneImport adds an external dataset to a pending training run.
+func (c *Client) FinetuneImport(ctx context.Context, req api.FinetuneImportRequest) (*api.FinetuneImportResponse, error) {
+	body, _ := json.Marshal(req)
+	var result api.FinetuneImportResponse
+	if err := c.postJSON(ctx, "/v1/finetune/import", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// --- Audio (proxied through backend to GPU) ---
+
+// Transcribe converts speech to text with the GPU server's whisper model.
+// filename only tells the server the audio format, e.g. "speech.wav";
+// language may be "" to let whisper detect it.
+func (c *Client) Transcribe(ctx context.Context, audio []byte, filename, language string) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	part.Write(audio)
+	if language != "" {
+		mw.WriteField("language", language)
+	}
+	mw.Close()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/audio/transcriptions", &body)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := c.do(httpReq, false)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	var result api.TranscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return result.Text, nil
+}
+
 // --- Models (proxied through backend to GPU) ---
 
-// LoadModel loads a model by name on the GPU server.
-func (c *Client) LoadModel(ctx context.Context, model string) error {
+// LoadModel loads a model by name or alias on the GPU server and reports
+// what it resolved to and the context size it was loaded with.
+func (c *Client) LoadModel(ctx context.Context, model string) (*api.LoadModelResponse, error) {
 	body, _ := json.Marshal(map[string]string{"model": model})
-	return c.postJSON(ctx, "/api/load", body, nil)
+	var result api.LoadModelResponse
+	if err := c.postJSON(ctx, "/api/load", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 // ListModels returns available models from the GPU server.
@@ -190,6 +493,101 @@ func (c *Client) ListModels(ctx context.Context) (*api.ModelListResponse, error)
 	return &result, nil
 }
 
+// PullModel downloads a model on the GPU server. ref is a direct URL or an
+// "<owner>/<repo>/<file>.gguf" HuggingFace reference. progress, if non-nil,
+// receives every event; the final "downloaded" event is also returned.
+func (c *Client) PullModel(ctx context.Context, ref string, progress func(api.PullProgress)) (*api.PullProgress, error) {
+	body, _ := json.Marshal(map[string]string{"url": ref})
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(httpReq, true)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var evt api.PullProgress
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			continue
+		}
+		if progress != nil {
+			progress(evt)
+		}
+
+		switch evt.Status {
+		case "downloaded":
+			return &evt, nil
+		case "error":
+			return nil, fmt.Errorf("download failed: %s", evt.Error)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read progress: %w", err)
+	}
+	return nil, fmt.Errorf("download interrupted; pull again to resume")
+}
+
+// PartialDownloads lists interrupted downloads that can be resumed.
+func (c *Client) PartialDownloads(ctx context.Context) (*api.PartialDownloadsResponse, error) {
+	var result api.PartialDownloadsResponse
+	url := fmt.Sprintf("%s/api/pull/partial", c.baseURL)
+	if err := c.getJSON(ctx, url, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PrunePartialDownloads removes interrupted downloads and returns them.
+// Downloads written to in the last minute are kept.
+func (c *Client) PrunePartialDownloads(ctx context.Context) (*api.PartialDownloadsResponse, error) {
+	var result api.PartialDownloadsResponse
+	if err := c.sendJSON(ctx, http.MethodDelete, "/api/pull/partial", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// LocalModels lists the downloaded model files with their GGUF metadata.
+func (c *Client) LocalModels(ctx context.Context) (*api.LocalModelsResponse, error) {
+	var result api.LocalModelsResponse
+	if err := c.getJSON(ctx, c.baseURL+"/api/models", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// InspectModel describes one model file, named directly or by alias,
+// including its embedded chat template.
+func (c *Client) InspectModel(ctx context.Context, name string) (*api.LocalModel, error) {
+	var result api.LocalModel
+	if err := c.getJSON(ctx, c.baseURL+"/api/models/"+url.PathEscape(name), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteModel deletes the model file with exactly this name.
+func (c *Client) DeleteModel(ctx context.Context, name string) error {
+	return c.sendJSON(ctx, http.MethodDelete, "/api/models/"+url.PathEscape(name), nil, nil)
+}
+
 // --- Tokenize (proxied through backend to GPU) ---
 
 // Tokenize returns the token count for the given text.
@@ -205,14 +603,15 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("tokenize returned %d", resp.StatusCode)
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	var result struct {
@@ -224,7 +623,7 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 	return len(result.Tokens), nil
 }
 
-// --- Instance management (backend manages vast.ai) ---
+// --- Instance management (backend manages the GPU instance) ---
 
 // InstanceStatus returns the GPU instance status.
 func (c *Client) InstanceStatus(ctx context.Context) (*api.InstanceStatus, error) {
@@ -236,6 +635,16 @@ func (c *Client) InstanceStatus(ctx context.Context) (*api.InstanceStatus, error
 	return &result, nil
 }
 
+// ServerInfo returns the model the backend's GPU server has loaded, the
+// context size it runs with and the features the backend offers.
+func (c *Client) ServerInfo(ctx context.Context) (*api.ServerInfo, error) {
+	var result api.ServerInfo
+	if err := c.getJSON(ctx, c.baseURL+"/api/info", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // InstanceStart starts the GPU instance.
 func (c *Client) InstanceStart(ctx context.Context) error {
 	return c.postJSON(ctx, "/api/instance/start", nil, nil)
@@ -246,21 +655,145 @@ func (c *Client) InstanceStop(ctx context.Context) error {
 	return c.postJSON(ctx, "/api/instance/stop", nil, nil)
 }
 
+// InstanceCosts returns the GPU instance's price and spend.
+func (c *Client) InstanceCosts(ctx context.Context) (*api.InstanceCosts, error) {
+	var result api.InstanceCosts
+	if err := c.getJSON(ctx, c.baseURL+"/api/instance/costs", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// InstanceAutostop sets how long the GPU instance may be idle before the
+// backend stops it, e.g. "30m", or turns auto-stop off with "0".
+func (c *Client) InstanceAutostop(ctx context.Context, after string) (*api.InstanceStatus, error) {
+	body, _ := json.Marshal(api.InstanceAutostopRequest{After: after})
+	var result api.InstanceStatus
+	if err := c.postJSON(ctx, "/api/instance/autostop", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// InstanceEvents streams the GPU instance's idle warnings and stops to fn
+// until ctx is cancelled or the stream ends.
+func (c *Client) InstanceEvents(ctx context.Context, fn func(api.InstanceEvent)) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/instance/events", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.do(httpReq, true)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return api.DecodeError(resp.StatusCode, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var evt api.InstanceEvent
+		if json.Unmarshal([]byte(data), &evt) == nil {
+			fn(evt)
+		}
+	}
+	return scanner.Err()
+}
+
+// --- Sessions (handled by backend) ---
+
+// CreateSession creates a chat session on the backend.
+func (c *Client) CreateSession(ctx context.Context, req api.SessionCreateRequest) (*api.Session, error) {
+	body, _ := json.Marshal(req)
+
+	var result api.Session
+	if err := c.postJSON(ctx, "/v1/sessions", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListSessions lists the backend's chat sessions, most recently updated first.
+func (c *Client) ListSessions(ctx context.Context) (*api.SessionListResponse, error) {
+	var result api.SessionListResponse
+	if err := c.getJSON(ctx, c.baseURL+"/v1/sessions", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSession returns a chat session with its full history.
+func (c *Client) GetSession(ctx context.Context, id string) (*api.Session, error) {
+	var result api.Session
+	if err := c.getJSON(ctx, c.baseURL+"/v1/sessions/"+id, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateSession changes the fields of a session that are set in req.
+func (c *Client) UpdateSession(ctx context.Context, id string, req api.SessionUpdateRequest) (*api.Session, error) {
+	body, _ := json.Marshal(req)
+
+	var result api.Session
+	if err := c.sendJSON(ctx, http.MethodPatch, "/v1/sessions/"+id, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AppendSessionMessages adds messages to a session and returns its new
+// message count. If expectedCount is not negative, the backend refuses the
+// append with a CodeConflict error unless the session has exactly that
+// many messages.
+func (c *Client) AppendSessionMessages(ctx context.Context, id string, msgs []api.Message, expectedCount int) (int, error) {
+	req := api.SessionAppendRequest{Messages: msgs}
+	if expectedCount >= 0 {
+		req.ExpectedCount = &expectedCount
+	}
+	body, _ := json.Marshal(req)
+
+	var result api.SessionAppendResponse
+	if err := c.postJSON(ctx, "/v1/sessions/"+id+"/messages", body, &result); err != nil {
+		return 0, err
+	}
+	return result.MessageCount, nil
+}
+
+// DeleteSession deletes a chat session.
+func (c *Client) DeleteSession(ctx context.Context, id string) error {
+	return c.sendJSON(ctx, http.MethodDelete, "/v1/sessions/"+id, nil, nil)
+}
+
 // --- Internal helpers ---
 
 func (c *Client) postJSON(ctx context.Context, path string, body []byte, result any) error {
+	return c.sendJSON(ctx, http.MethodPost, path, body, result)
+}
+
+// sendJSON sends body to path with the given method and decodes the
+// response into result, if not nil.
+func (c *Client) sendJSON(ctx context.Context, method, path string, body []byte, result any) error {
 	var reader io.Reader
 	if body != nil {
 		reader = bytes.NewReader(body)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, reader)
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -268,7 +801,7 @@ func (c *Client) postJSON(ctx context.Context, path string, body []byte, result
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	if result != nil {
@@ -285,7 +818,7 @@ func (c *Client) getJSON(ctx context.Context, url string, result any) error {
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq, false)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -293,7 +826,7 @@ func (c *Client) getJSON(ctx context.Context, url string, result any) error {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	if result != nil {
@@ -0,0 +1,72 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// OpenAI sends chat completions to an OpenAI-compatible API, such as
+// OpenAI's own or OpenRouter's.
+type OpenAI struct {
+	BaseURL string // up to and including /v1
+	APIKey  string // sent as a bearer token; "" sends none
+	KeyEnv  string // where APIKey came from, for the error when it is unset
+}
+
+func (o *OpenAI) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+	wire := o.request(req)
+	wire.Stream = false
+	resp, err := o.post(ctx, wire)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result api.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+func (o *OpenAI) StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error) {
+	wire := o.request(req)
+	wire.Stream = true
+	if wire.StreamOptions == nil {
+		wire.StreamOptions = &api.StreamOptions{IncludeUsage: true}
+	}
+	resp, err := o.post(ctx, wire)
+	if err != nil {
+		return nil, err
+	}
+	return wrapStreamWithCleanup(ParseSSEStream(resp.Body), resp.Body), nil
+}
+
+// request returns a copy of req without the fields only llama-server
+// understands, which cloud APIs reject, and without reasoning from earlier
+// turns.
+func (o *OpenAI) request(req *api.ChatCompletionRequest) *api.ChatCompletionRequest {
+	out := *req
+	out.TopK, out.MinP, out.RepeatPenalty = nil, nil, nil
+	out.SessionID = ""
+	out.Messages = make([]api.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		m.ReasoningContent = ""
+		out.Messages[i] = m
+	}
+	return &out
+}
+
+func (o *OpenAI) post(ctx context.Context, req *api.ChatCompletionRequest) (*http.Response, error) {
+	if o.APIKey == "" && o.KeyEnv != "" {
+		return nil, missingKey(o.KeyEnv)
+	}
+	headers := map[string]string{}
+	if o.APIKey != "" {
+		headers["Authorization"] = "Bearer " + o.APIKey
+	}
+	return postJSON(ctx, o.BaseURL+"/chat/completions", headers, req)
+}
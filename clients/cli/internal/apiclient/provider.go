@@ -0,0 +1,130 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// Completer sends chat completions. *Client sends them to the tanrenai
+// server; *OpenAI and *Anthropic send them to cloud APIs.
+type Completer interface {
+	ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error)
+	StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error)
+}
+
+// Provider names accepted by NewProvider.
+const (
+	ProviderOpenAI     = "openai"
+	ProviderOpenRouter = "openrouter"
+	ProviderAnthropic  = "anthropic"
+)
+
+// NewProvider returns the Completer for a cloud provider. baseURL "" means
+// the provider's public API; "openai" with another baseURL talks to any
+// OpenAI-compatible server. keyEnv names the variable apiKey came from, for
+// the error when it is unset.
+func NewProvider(name, baseURL, apiKey, keyEnv string) (Completer, error) {
+	switch name {
+	case ProviderOpenAI:
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return &OpenAI{BaseURL: baseURL, APIKey: apiKey, KeyEnv: keyEnv}, nil
+	case ProviderOpenRouter:
+		if baseURL == "" {
+			baseURL = "https://openrouter.ai/api/v1"
+		}
+		return &OpenAI{BaseURL: baseURL, APIKey: apiKey, KeyEnv: keyEnv}, nil
+	case ProviderAnthropic:
+		if baseURL == "" {
+			baseURL = "https://api.anthropic.com"
+		}
+		return &Anthropic{BaseURL: baseURL, APIKey: apiKey, KeyEnv: keyEnv}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q (use %s, %s or %s)", name, ProviderOpenAI, ProviderOpenRouter, ProviderAnthropic)
+}
+
+// Remote is a model alias served by a cloud provider.
+type Remote struct {
+	Provider Completer
+	Name     string // the provider's name, for display
+	Model    string // the provider's model ID
+	CtxSize  int    // context window; 0 = unknown
+}
+
+// Router sends requests for remote model aliases to their providers and
+// the rest to the tanrenai server, so callers need not care where a model
+// runs.
+type Router struct {
+	Server  *Client
+	Remotes map[string]Remote
+}
+
+// Remote returns the remote model an alias names, if it is one.
+func (r *Router) Remote(model string) (Remote, bool) {
+	remote, ok := r.Remotes[model]
+	return remote, ok
+}
+
+// route returns where req goes, with the model swapped for the provider's
+// ID when it is remote. req itself is left alone so callers may log it.
+func (r *Router) route(req *api.ChatCompletionRequest) (Completer, *api.ChatCompletionRequest) {
+	remote, ok := r.Remotes[req.Model]
+	if !ok {
+		return r.Server, req
+	}
+	out := *req
+	out.Model = remote.Model
+	return remote.Provider, &out
+}
+
+func (r *Router) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+	c, req := r.route(req)
+	return c.ChatCompletion(ctx, req)
+}
+
+func (r *Router) StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error) {
+	c, req := r.route(req)
+	return c.StreamCompletion(ctx, req)
+}
+
+// postJSON sends body to url with the given headers and returns the
+// response if its status is 200; otherwise the decoded error.
+func postJSON(ctx context.Context, url string, headers map[string]string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, api.DecodeError(resp.StatusCode, respBody)
+	}
+	return resp, nil
+}
+
+// missingKey is the error for a provider whose API key is not set.
+func missingKey(keyEnv string) error {
+	if keyEnv == "" {
+		return api.NewError(http.StatusUnauthorized, api.CodeInvalidRequest, "no API key configured")
+	}
+	return api.NewError(http.StatusUnauthorized, api.CodeInvalidRequest, keyEnv+" is not set")
+}
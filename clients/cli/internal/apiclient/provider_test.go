@@ -0,0 +1,166 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+func TestRouterSendsRemoteModelsToTheirProvider(t *testing.T) {
+	var got map[string]any
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"from the cloud"},"finish_reason":"stop"}]}`)
+	}))
+	defer cloud.Close()
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"from the server"},"finish_reason":"stop"}]}`)
+	}))
+	defer local.Close()
+
+	provider, err := NewProvider(ProviderOpenAI, cloud.URL+"/v1", "sk-test", "OPENAI_API_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := &Router{
+		Server:  New(local.URL),
+		Remotes: map[string]Remote{"gpt": {Provider: provider, Model: "gpt-4o-mini"}},
+	}
+
+	topK := 40
+	req := &api.ChatCompletionRequest{
+		Model:     "gpt",
+		Messages:  []api.Message{{Role: "assistant", Content: "hi", ReasoningContent: "thinking"}},
+		TopK:      &topK,
+		SessionID: "abc",
+	}
+	resp, err := router.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "from the cloud" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+	if got["model"] != "gpt-4o-mini" || got["top_k"] != nil || got["session_id"] != nil {
+		t.Errorf("request = %v", got)
+	}
+	if msg := got["messages"].([]any)[0].(map[string]any); msg["reasoning_content"] != nil {
+		t.Errorf("reasoning was sent: %v", msg)
+	}
+	if req.Model != "gpt" || req.TopK == nil {
+		t.Errorf("caller's request was changed: %+v", req)
+	}
+
+	resp, err = router.ChatCompletion(context.Background(), &api.ChatCompletionRequest{Model: "qwen"})
+	if err != nil || resp.Choices[0].Message.Content != "from the server" {
+		t.Errorf("local model: resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestMissingAPIKey(t *testing.T) {
+	provider, _ := NewProvider(ProviderAnthropic, "", "", "ANTHROPIC_API_KEY")
+	_, err := provider.ChatCompletion(context.Background(), &api.ChatCompletionRequest{})
+	if err == nil || err.Error() != "ANTHROPIC_API_KEY is not set" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestToAnthropic(t *testing.T) {
+	req := toAnthropic(&api.ChatCompletionRequest{
+		Model: "claude",
+		Messages: []api.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "What is in main.go?", Images: []string{"data:image/png;base64,AAAA"}},
+			{Role: "assistant", ToolCalls: []api.ToolCall{
+				{ID: "t1", Function: api.ToolCallFunction{Name: "file_read", Arguments: `{"path":"main.go"}`}},
+				{ID: "t2", Function: api.ToolCallFunction{Name: "list_dir", Arguments: ``}},
+			}},
+			{Role: "tool", ToolCallID: "t1", Content: "package main"},
+			{Role: "tool", ToolCallID: "t2", Content: "main.go"},
+			{Role: "user", Content: "Thanks"},
+		},
+		Tools:      []api.Tool{{Type: "function", Function: api.ToolFunction{Name: "file_read", Parameters: json.RawMessage(`{"type":"object"}`)}}},
+		ToolChoice: "required",
+	})
+
+	if req.System != "Be brief." || req.MaxTokens != anthropicMaxTokens {
+		t.Errorf("system = %q, max tokens = %d", req.System, req.MaxTokens)
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("want user, assistant, user; got %+v", req.Messages)
+	}
+	if b := req.Messages[0].Content[1]; b.Type != "image" || b.Source.Type != "base64" || b.Source.MediaType != "image/png" || b.Source.Data != "AAAA" {
+		t.Errorf("image block = %+v", b)
+	}
+	if b := req.Messages[1].Content[1]; b.Type != "tool_use" || string(b.Input) != "{}" {
+		t.Errorf("tool call without arguments = %+v", b)
+	}
+	// Both tool results and the next user message share one user turn.
+	last := req.Messages[2].Content
+	if len(last) != 3 || last[0].ToolUseID != "t1" || last[1].ToolUseID != "t2" || last[2].Text != "Thanks" {
+		t.Errorf("last turn = %+v", last)
+	}
+	if req.ToolChoice["type"] != "any" || string(req.Tools[0].InputSchema) != `{"type":"object"}` {
+		t.Errorf("tools = %+v, choice = %v", req.Tools, req.ToolChoice)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":12}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me look."}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"file_read"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"main.go\"}"}}`,
+		`{"type":"ping"}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "key" || r.URL.Path != "/v1/messages" {
+			t.Errorf("request to %s with key %q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			t.Errorf("request is not streaming: %s", body)
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", e)
+		}
+	}))
+	defer server.Close()
+
+	a := &Anthropic{BaseURL: server.URL, APIKey: "key"}
+	stream, err := a.StreamCompletion(context.Background(), &api.ChatCompletionRequest{Model: "claude"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := AccumulateResponse(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != "Let me look." || choice.FinishReason != "tool_calls" {
+		t.Errorf("choice = %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", choice.Message.ToolCalls)
+	}
+	if tc := choice.Message.ToolCalls[0]; tc.ID != "toolu_1" || tc.Function.Name != "file_read" || tc.Function.Arguments != `{"path":"main.go"}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 20 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
@@ -6,31 +6,63 @@ import (
 	"io"
 	"strings"
 
+	"github.com/ThatCatDev/tanrenai/client/internal/reasoning"
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
 
 // StreamEvent represents a parsed SSE event from the backend.
 type StreamEvent struct {
-	Chunk *api.ChatCompletionChunk
-	Done  bool
-	Err   error
+	Chunk  *api.ChatCompletionChunk
+	Usage  *api.Usage        // token usage, reported by the backend on the final chunk
+	Status *api.StreamStatus // set for "status" events, e.g. while the model warms up
+	Done   bool
+	Err    error
 }
 
 // ParseSSEStream reads an SSE stream and sends parsed events to a channel.
-// The channel is closed when the stream ends or an error occurs.
+// The channel is closed when the stream ends or an error occurs. "status"
+// events are passed on; other named events (such as the backend's "queue"
+// position updates) and comments (its keepalives) are skipped.
 func ParseSSEStream(r io.Reader) <-chan StreamEvent {
 	ch := make(chan StreamEvent)
 	go func() {
 		defer close(ch)
 		scanner := bufio.NewScanner(r)
 
+		event := ""
 		for scanner.Scan() {
 			line := scanner.Text()
+			if line == "" {
+				event = ""
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				continue // a comment, such as the backend's keepalives
+			}
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+				continue
+			}
 			if !strings.HasPrefix(line, "data: ") {
 				continue
 			}
 			data := strings.TrimPrefix(line, "data: ")
 
+			switch event {
+			case "":
+			case "error":
+				ch <- StreamEvent{Err: api.DecodeError(0, []byte(data))}
+				return
+			case "status":
+				var status api.StreamStatus
+				if json.Unmarshal([]byte(data), &status) == nil {
+					ch <- StreamEvent{Status: &status}
+				}
+				continue
+			default:
+				continue
+			}
+
 			if data == "[DONE]" {
 				ch <- StreamEvent{Done: true}
 				return
@@ -41,7 +73,7 @@ func ParseSSEStream(r io.Reader) <-chan StreamEvent {
 				ch <- StreamEvent{Err: err}
 				return
 			}
-			ch <- StreamEvent{Chunk: &chunk}
+			ch <- StreamEvent{Chunk: &chunk, Usage: chunk.Usage}
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -55,12 +87,15 @@ func ParseSSEStream(r io.Reader) <-chan StreamEvent {
 func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse, error) {
 	var (
 		content      strings.Builder
+		thought      strings.Builder
+		splitter     reasoning.Splitter
 		role         string
 		model        string
 		id           string
 		finishReason string
 		toolCalls    []api.ToolCall
 		toolArgBuf   = make(map[int]*strings.Builder)
+		usage        *api.Usage
 	)
 
 	for ev := range events {
@@ -70,6 +105,9 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 		if ev.Done {
 			break
 		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
 		if ev.Chunk == nil {
 			continue
 		}
@@ -88,9 +126,9 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 			if choice.FinishReason != nil {
 				finishReason = *choice.FinishReason
 			}
-			if choice.Delta.Content != "" {
-				content.WriteString(choice.Delta.Content)
-			}
+			text, thinking := splitter.Split(choice.Delta.Content)
+			content.WriteString(text)
+			thought.WriteString(choice.Delta.ReasoningContent + thinking)
 
 			for _, tcd := range choice.Delta.ToolCalls {
 				for len(toolCalls) <= tcd.Index {
@@ -117,6 +155,10 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 		}
 	}
 
+	text, thinking := splitter.Flush()
+	content.WriteString(text)
+	thought.WriteString(thinking)
+
 	// Finalize accumulated tool call arguments
 	for idx, buf := range toolArgBuf {
 		if idx < len(toolCalls) {
@@ -129,8 +171,9 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 	}
 
 	msg := api.Message{
-		Role:    role,
-		Content: content.String(),
+		Role:             role,
+		Content:          content.String(),
+		ReasoningContent: thought.String(),
 	}
 	if len(toolCalls) > 0 {
 		msg.ToolCalls = toolCalls
@@ -154,5 +197,6 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 				FinishReason: finishReason,
 			},
 		},
+		Usage: usage,
 	}, nil
 }
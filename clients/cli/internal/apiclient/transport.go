@@ -0,0 +1,362 @@
+package apiclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// Options tunes how a Client talks to the backend. The zero value of a
+// field keeps its DefaultOptions value, except where noted.
+type Options struct {
+	// Timeout bounds each call that is not a stream, including reading
+	// its response; 0 leaves calls unbounded, since a chat completion may
+	// wait minutes for the GPU instance to start. WithTimeout overrides
+	// it for one call.
+	Timeout time.Duration
+	// Retries is how many more times an idempotent request (GET, PUT,
+	// DELETE) is sent after a connection error or a 429, 502, 503 or 504.
+	// POSTs are never retried. Negative turns retries off.
+	Retries int
+	// RetryBackoff is the wait before the first retry; each retry doubles
+	// it, up to MaxRetryBackoff, with jitter.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// DialTimeout bounds connecting to the backend.
+	DialTimeout time.Duration
+	// MaxIdleConns is how many idle keep-alive connections to the backend
+	// are kept for reuse, and IdleConnTimeout how long they are kept.
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+
+	// BreakerThreshold is how many calls in a row must fail, by connection
+	// error or a 5xx, for the client to fail fast with ErrCircuitOpen for
+	// BreakerCooldown; then one call is let through to try again. 0 turns
+	// the breaker off.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// StreamStall is how long an SSE stream may send nothing, not even a
+	// keepalive comment, before reading it fails with ErrStreamStalled.
+	// The backend sends a keepalive every 15 seconds. Negative turns the
+	// check off.
+	StreamStall time.Duration
+
+	// DisableGzip sends request bodies uncompressed. Otherwise those of at
+	// least 1 KB, such as agent iterations resending the conversation, are
+	// gzipped. Responses are gzipped by the backend whenever it can.
+	DisableGzip bool
+}
+
+// DefaultOptions returns the options New uses.
+func DefaultOptions() Options {
+	return Options{
+		Retries:         2,
+		RetryBackoff:    250 * time.Millisecond,
+		MaxRetryBackoff: 5 * time.Second,
+		DialTimeout:     10 * time.Second,
+		MaxIdleConns:    8,
+		IdleConnTimeout: 90 * time.Second,
+		BreakerCooldown: 30 * time.Second,
+		StreamStall:     90 * time.Second,
+	}
+}
+
+// withDefaults fills the zero fields of o from DefaultOptions.
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+	if o.Retries == 0 {
+		o.Retries = d.Retries
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = d.RetryBackoff
+	}
+	if o.MaxRetryBackoff <= 0 {
+		o.MaxRetryBackoff = d.MaxRetryBackoff
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = d.DialTimeout
+	}
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = d.MaxIdleConns
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = d.IdleConnTimeout
+	}
+	if o.BreakerCooldown <= 0 {
+		o.BreakerCooldown = d.BreakerCooldown
+	}
+	if o.StreamStall == 0 {
+		o.StreamStall = d.StreamStall
+	}
+	return o
+}
+
+func newTransport(o Options) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.MaxIdleConns = o.MaxIdleConns
+	t.MaxIdleConnsPerHost = o.MaxIdleConns
+	t.IdleConnTimeout = o.IdleConnTimeout
+	return t
+}
+
+// ErrCircuitOpen is returned, wrapped, while the circuit breaker holds
+// calls back after repeated failures.
+var ErrCircuitOpen = errors.New("backend unavailable: too many failed requests, not retrying yet")
+
+type timeoutKey struct{}
+
+// WithTimeout returns a context under which a Client call is bounded by d
+// instead of Options.Timeout, streams included; 0 leaves it unbounded.
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// do sends req and returns its response, applying the call timeout,
+// retries and circuit breaker. A stream is only bounded by WithTimeout.
+// The timeout lasts until the response body is closed.
+func (c *Client) do(req *http.Request, stream bool) (*http.Response, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	if id, _ := c.session.Load().(string); id != "" && req.Header.Get(api.SessionHeader) == "" {
+		req.Header.Set(api.SessionHeader, id)
+	}
+
+	if !c.opts.DisableGzip {
+		if err := gzipBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	parent := req.Context()
+	timeout := c.opts.Timeout
+	if stream {
+		timeout = 0
+	}
+	if d, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+
+	retries := 0
+	if idempotent(req) {
+		retries = max(c.opts.Retries, 0)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		// A call the caller gave up on says nothing about the backend.
+		failed := err != nil && parent.Err() == nil || err == nil && resp.StatusCode >= 500
+		if attempt == retries || !retryable(resp, err) || req.Context().Err() != nil {
+			c.breaker.record(failed)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			if stream && c.opts.StreamStall > 0 && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				resp.Body = newStallReader(resp.Body, c.opts.StreamStall)
+			}
+			return resp, nil
+		}
+
+		wait := c.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			c.breaker.record(failed)
+			cancel()
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("replay request body: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// gzipMin is the smallest request body worth compressing.
+const gzipMin = 1024
+
+// gzipBody compresses req's body when its length is known and at least
+// gzipMin, keeping it replayable for retries.
+func gzipBody(req *http.Request) error {
+	if req.Body == nil || req.GetBody == nil || req.ContentLength < gzipMin || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if _, err := io.Copy(zw, req.Body); err != nil {
+		return fmt.Errorf("compress request body: %w", err)
+	}
+	zw.Close()
+	req.Body.Close()
+
+	data := buf.Bytes()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Encoding", "gzip")
+	return nil
+}
+
+// idempotent reports whether req may be sent again: its method has no
+// extra effect when repeated and its body can be replayed.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// retryable reports whether a failed attempt is worth repeating: a
+// connection error, or the backend or a proxy saying to try later.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before retry attempt+1: the response's
+// Retry-After in seconds if it has one, else RetryBackoff doubled per
+// attempt, jittered to between half and all of it, up to MaxRetryBackoff.
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, c.opts.MaxRetryBackoff)
+		}
+	}
+	d := min(c.opts.RetryBackoff<<attempt, c.opts.MaxRetryBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// ErrStreamStalled is returned, wrapped, by reads from a stream that has
+// sent nothing for Options.StreamStall.
+var ErrStreamStalled = errors.New("stream stalled")
+
+// stallReader closes a stream that sends nothing for window, failing the
+// blocked read with ErrStreamStalled.
+type stallReader struct {
+	io.ReadCloser
+	window  time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newStallReader(body io.ReadCloser, window time.Duration) *stallReader {
+	r := &stallReader{ReadCloser: body, window: window}
+	r.timer = time.AfterFunc(window, func() {
+		r.stalled.Store(true)
+		body.Close()
+	})
+	return r
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.window)
+	}
+	if err != nil && r.stalled.Load() {
+		return n, fmt.Errorf("%w: nothing received from the backend for %s", ErrStreamStalled, r.window)
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	return r.ReadCloser.Close()
+}
+
+// cancelOnClose ends a call's timeout context when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// breaker fails calls fast after threshold failures in a row, letting one
+// through per cooldown to find out whether the backend is back.
+type breaker struct {
+	threshold int // 0: never opens
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // a call is testing whether the backend is back
+}
+
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,202 @@
+package apiclient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+func TestIdempotentRequestsAreRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"count":7}`)
+	}))
+	defer srv.Close()
+
+	client := NewWithOptions(srv.URL, Options{RetryBackoff: time.Millisecond})
+	count, err := client.MemoryCount(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 7 || calls.Load() != 3 {
+		t.Errorf("count = %d after %d calls, want 7 after 3", count, calls.Load())
+	}
+}
+
+func TestPostsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client := NewWithOptions(srv.URL, Options{RetryBackoff: time.Millisecond})
+	if err := client.InstanceStart(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST sent %d times, want 1", calls.Load())
+	}
+}
+
+func TestWithTimeoutBoundsACall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL)
+	start := time.Now()
+	_, err := client.MemoryCount(WithTimeout(context.Background(), 50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("call took %s", elapsed)
+	}
+}
+
+func TestBreakerOpensAfterRepeatedFailures(t *testing.T) {
+	var calls atomic.Int32
+	healthy := atomic.Bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"count":1}`)
+	}))
+	defer srv.Close()
+
+	client := NewWithOptions(srv.URL, Options{Retries: -1, BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond})
+	ctx := context.Background()
+	for range 2 {
+		if _, err := client.MemoryCount(ctx); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("err = %v, want the server's error", err)
+		}
+	}
+	if _, err := client.MemoryCount(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server saw %d calls while the breaker was open, want 2", calls.Load())
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.MemoryCount(ctx); err != nil {
+		t.Fatalf("call after cooldown: %v", err)
+	}
+	if _, err := client.MemoryCount(ctx); err != nil {
+		t.Fatalf("breaker did not close: %v", err)
+	}
+}
+
+func TestLargeBodiesAreGzipped(t *testing.T) {
+	query := strings.Repeat("the same conversation again ", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Content-Encoding = %q, want gzip", r.Header.Get("Content-Encoding"))
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req struct{ Query string }
+		if err := json.NewDecoder(zr).Decode(&req); err != nil || req.Query != query {
+			t.Errorf("decoded query %q, %v", req.Query, err)
+		}
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		fmt.Fprint(zw, `{"results":[{"semantic_score":0.9}]}`)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	resp, err := New(srv.URL).MemorySearch(context.Background(), query, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 {
+		t.Errorf("results = %+v, want one", resp.Results)
+	}
+}
+
+func TestSilentStreamStalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		// Keepalives hold the stream open past the stall window.
+		for range 5 {
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+			time.Sleep(40 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n")
+		flusher.Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := NewWithOptions(srv.URL, Options{StreamStall: 100 * time.Millisecond})
+	events, err := client.StreamCompletion(context.Background(), &api.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content string
+	var streamErr error
+	for ev := range events {
+		if ev.Chunk != nil {
+			content += ev.Chunk.Choices[0].Delta.Content
+		}
+		if ev.Err != nil {
+			streamErr = ev.Err
+		}
+	}
+	if content != "hi" {
+		t.Errorf("content = %q, want the chunk sent after the keepalives", content)
+	}
+	if !errors.Is(streamErr, ErrStreamStalled) {
+		t.Errorf("err = %v, want ErrStreamStalled", streamErr)
+	}
+}
+
+func TestSessionHeaderIsSent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(api.SessionHeader); got != "abc" {
+			t.Errorf("%s = %q, want abc", api.SessionHeader, got)
+		}
+		fmt.Fprint(w, `{"count":0}`)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL)
+	client.SetSession("abc")
+	if _, err := client.MemoryCount(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
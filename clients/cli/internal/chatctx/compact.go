@@ -0,0 +1,154 @@
+package chatctx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// collapsedToolTokens is roughly what a tool result is cut to when
+// collapsed.
+const collapsedToolTokens = 60
+
+// collapsedPrefix marks a collapsed tool result, so it is not collapsed
+// again.
+const collapsedPrefix = "[collapsed by /compact"
+
+// CompactOptions choose what Compact condenses.
+type CompactOptions struct {
+	// Free is the share of the window (0-1) to leave free. With 0, a
+	// summary condenses only what no longer fits, as Summarize does, and
+	// ToolsOnly collapses every tool result before the latest user message.
+	Free float64
+	// Fill, when set, replaces Free: the history is condensed until it
+	// takes at most this share (0-1) of the space left for it, the measure
+	// HistoryFill reports.
+	Fill float64
+	// ToolsOnly collapses tool results in place, oldest first, instead of
+	// summarizing messages, so user and assistant text stays verbatim and
+	// no model call is made.
+	ToolsOnly bool
+	// DryRun works out what would be condensed without calling the model
+	// or changing the history.
+	DryRun bool
+}
+
+// CompactReport describes what Compact condensed, or would condense.
+type CompactReport struct {
+	Messages   int // history messages summarized, or tool results collapsed
+	Tokens     int // their tokens before
+	FreeBefore int // Budget().Available before
+	// FreeAfter is Budget().Available afterwards. For a dry run of a
+	// summary it assumes the new summary is no larger than the current
+	// one.
+	FreeAfter int
+}
+
+// Compact condenses the history as opts asks and reports the outcome.
+// Messages from the latest user message on are never condensed, so the
+// exchange in progress stays intact.
+func (m *Manager) Compact(ctx context.Context, complete CompletionFunc, opts CompactOptions) (CompactReport, error) {
+	report := CompactReport{FreeBefore: m.Budget().Available}
+	target := m.historyAvailable() - int(opts.Free*float64(m.cfg.CtxSize))
+	if opts.Fill > 0 {
+		target = int(opts.Fill * float64(m.historyAvailable()))
+	}
+	latest := m.latestUserIndex()
+
+	if opts.ToolsOnly {
+		collapsed := m.History()
+		used := m.estimator.EstimateMessages(collapsed)
+		for i := 0; i < latest && ((opts.Free == 0 && opts.Fill == 0) || used > target); i++ {
+			msg := collapsed[i]
+			before := m.estimator.EstimateMessages([]api.Message{msg})
+			if msg.Role != "tool" || strings.HasPrefix(msg.Content, collapsedPrefix) || before <= 2*collapsedToolTokens {
+				continue
+			}
+			msg.Content = fmt.Sprintf("%s; was %d tokens]\n%s", collapsedPrefix, before,
+				m.truncateToTokens(msg.Content, collapsedToolTokens))
+			collapsed[i] = msg
+			used -= before - m.estimator.EstimateMessages([]api.Message{msg})
+			report.Messages++
+			report.Tokens += before
+		}
+		original := m.history
+		m.history = collapsed
+		report.FreeAfter = m.Budget().Available
+		if opts.DryRun {
+			m.history = original
+		}
+		return report, nil
+	}
+
+	// Keep the newest messages that fit the target, without starting the
+	// kept history on tool results cut off from their call.
+	cutoff := len(m.history)
+	used := 0
+	for i := len(m.history) - 1; i >= 0; i-- {
+		used += m.estimator.EstimateMessages([]api.Message{m.history[i]})
+		if used > target {
+			break
+		}
+		cutoff = i
+	}
+	for cutoff < len(m.history) && m.history[cutoff].Role == "tool" {
+		cutoff++
+	}
+	cutoff = min(cutoff, latest)
+	if cutoff <= 0 {
+		report.FreeAfter = report.FreeBefore
+		return report, nil
+	}
+	report.Messages = cutoff
+	report.Tokens = m.estimator.EstimateMessages(m.history[:cutoff])
+
+	if opts.DryRun {
+		original := m.history
+		m.history = m.history[cutoff:]
+		report.FreeAfter = m.Budget().Available
+		m.history = original
+		return report, nil
+	}
+	if err := m.summarizeHistory(ctx, complete, cutoff); err != nil {
+		return report, err
+	}
+	report.FreeAfter = m.Budget().Available
+	return report, nil
+}
+
+// HistoryFill returns the share of the space left for the history that it
+// takes up. Past 1 it no longer fits, and Summarize would condense it.
+func (m *Manager) HistoryFill() float64 {
+	available := m.historyAvailable()
+	if available <= 0 {
+		return 1
+	}
+	return float64(m.estimator.EstimateMessages(m.history)) / float64(available)
+}
+
+// historyAvailable returns the tokens the history may use: the window less
+// the system messages, memories, summary and the response and tool
+// budgets.
+func (m *Manager) historyAvailable() int {
+	available := m.cfg.CtxSize - m.estimator.EstimateMessages(m.buildSystemMessages()) - m.cfg.ResponseBudget - m.cfg.ToolsBudget
+	if len(m.memories) > 0 {
+		available -= m.estimator.EstimateMessages(m.memories)
+	}
+	if summaryMsgs := m.summaryMessages(); len(summaryMsgs) > 0 {
+		available -= m.estimator.EstimateMessages(summaryMsgs)
+	}
+	return available
+}
+
+// latestUserIndex returns the index of the latest user message in the
+// history, or its length if there is none.
+func (m *Manager) latestUserIndex() int {
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if m.history[i].Role == "user" {
+			return i
+		}
+	}
+	return len(m.history)
+}
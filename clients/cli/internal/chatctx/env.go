@@ -0,0 +1,55 @@
+package chatctx
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// describeEnvironment returns the environment system message for dir: the
+// facts a model would otherwise spend its first tool calls finding out.
+func describeEnvironment(dir string, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("<env>\n")
+	fmt.Fprintf(&b, "Working directory: %s\n", dir)
+	fmt.Fprintf(&b, "Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Git: %s\n", gitState(dir))
+	fmt.Fprintf(&b, "Today's date: %s\n", now.Format("2006-01-02 (Monday)"))
+	b.WriteString("</env>")
+	return b.String()
+}
+
+// gitState describes the repository dir is in: its branch, or the commit
+// when detached, and how many files have uncommitted changes.
+func gitState(dir string) string {
+	branch, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "not a repository"
+	}
+	if branch == "HEAD" {
+		commit, _ := gitOutput(dir, "rev-parse", "--short", "HEAD")
+		branch = "detached at " + commit
+	} else {
+		branch = "branch " + branch
+	}
+
+	status, err := gitOutput(dir, "status", "--porcelain")
+	switch {
+	case err != nil:
+		return branch
+	case status == "":
+		return branch + ", clean"
+	}
+	n := strings.Count(status, "\n") + 1
+	if n == 1 {
+		return branch + ", 1 file with uncommitted changes"
+	}
+	return fmt.Sprintf("%s, %d files with uncommitted changes", branch, n)
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,68 @@
+package chatctx
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// InstructionsFile is the name of the file holding a project's
+// instructions for the assistant: build commands, layout, conventions.
+const InstructionsFile = "TANRENAI.md"
+
+// findInstructions returns the InstructionsFile paths in dir and its
+// parents, outermost first, so a subproject's file comes after (and can
+// refine) the repository's.
+func findInstructions(dir string) []string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for {
+		path := filepath.Join(dir, InstructionsFile)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	slices.Reverse(paths)
+	return paths
+}
+
+// LoadInstructions pins the InstructionsFile files in dir and its parents
+// that are not loaded yet, and returns their paths. Each is kept to a
+// quarter of the prompt budget. Changes to loaded ones are picked up by
+// RefreshContextFiles.
+func (m *Manager) LoadInstructions(dir string) []string {
+	var loaded []string
+	for _, path := range findInstructions(dir) {
+		if slices.Contains(m.Instructions(), path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		m.instructions = append(m.instructions, newContextFile(path, string(data)))
+		loaded = append(loaded, path)
+	}
+	// Keep the outermost-first order when a file turns up mid-session.
+	slices.SortStableFunc(m.instructions, func(a, b contextFile) int {
+		return len(filepath.Dir(a.Path)) - len(filepath.Dir(b.Path))
+	})
+	return loaded
+}
+
+// Instructions returns the paths of the loaded project instructions.
+func (m *Manager) Instructions() []string {
+	paths := make([]string, len(m.instructions))
+	for i, cf := range m.instructions {
+		paths[i] = cf.Path
+	}
+	return paths
+}
@@ -1,7 +1,12 @@
 package chatctx
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
@@ -11,6 +16,11 @@ type Config struct {
 	CtxSize        int // total context window in tokens (default 4096)
 	ResponseBudget int // tokens reserved for model output (default 512)
 	ToolsBudget    int // tokens reserved for tool definitions in the prompt (0 = none)
+
+	// StructuredSummary makes Summarize keep files touched, commands run,
+	// decisions and open TODOs as separate pinned sections instead of
+	// folding everything into one prose summary.
+	StructuredSummary bool
 }
 
 // BudgetInfo contains token budget breakdown information.
@@ -25,23 +35,35 @@ type BudgetInfo struct {
 	TotalHistory int // total number of history messages (including evicted)
 }
 
-// contextFile represents a loaded context file.
+// contextFile represents a loaded context file. ModTime, Size and Hash
+// record the on-disk version the content came from so edits made after
+// loading can be detected.
 type contextFile struct {
 	Path    string
 	Content string
+	ModTime time.Time
+	Size    int64
+	Hash    [sha256.Size]byte
 }
 
 // Manager manages windowed message history with token budget tracking.
-// System messages and context files are pinned (never evicted).
+// System messages, context files and pinned messages are never evicted.
 // History messages are windowed: oldest messages are dropped when the budget is exceeded.
 type Manager struct {
 	cfg          Config
 	estimator    *TokenEstimator
 	systemPrompt string
 	contextFiles []contextFile
+	instructions []contextFile // TANRENAI.md files, outermost first
 	history      []api.Message // user/assistant/tool messages
+	pinned       []api.Message // history messages pinned like system messages
 	summary      string        // condensed summary of evicted messages
+	state        SessionState  // structured state from summarized messages
 	memories     []api.Message // injected memory messages from RAG
+	envDir       string        // directory the environment message describes; "" = none
+	env          string        // environment message, rebuilt by RefreshEnvironment
+
+	summaryProgress func(messages, tokens int) // see SetSummaryProgress
 }
 
 // Estimator returns the token estimator used by this manager.
@@ -66,9 +88,72 @@ func (m *Manager) SetSystemPrompt(prompt string) {
 	m.systemPrompt = prompt
 }
 
-// AddContextFile loads a file into the pinned context.
+// EnableEnvironment adds a system message after the system prompt giving
+// the platform, dir, its git branch and state, and today's date, so the
+// model need not run pwd, uname, git status and date to find out.
+func (m *Manager) EnableEnvironment(dir string) {
+	m.envDir = dir
+	m.RefreshEnvironment()
+}
+
+// RefreshEnvironment rebuilds the environment message, if enabled. Call it
+// at the start of each turn, since the previous one may have switched
+// branches or changed files.
+func (m *Manager) RefreshEnvironment() {
+	if m.envDir != "" {
+		m.env = describeEnvironment(m.envDir, time.Now())
+	}
+}
+
+// AddContextFile loads a file into the pinned context. Adding a path that is
+// already loaded replaces its content.
 func (m *Manager) AddContextFile(path, content string) {
-	m.contextFiles = append(m.contextFiles, contextFile{Path: path, Content: content})
+	cf := newContextFile(path, content)
+	for i := range m.contextFiles {
+		if m.contextFiles[i].Path == path {
+			m.contextFiles[i] = cf
+			return
+		}
+	}
+	m.contextFiles = append(m.contextFiles, cf)
+}
+
+func newContextFile(path, content string) contextFile {
+	cf := contextFile{Path: path, Content: content, Hash: sha256.Sum256([]byte(content))}
+	if info, err := os.Stat(path); err == nil {
+		cf.ModTime, cf.Size = info.ModTime(), info.Size()
+	}
+	return cf
+}
+
+// RefreshContextFiles reloads context files and project instructions that
+// changed on disk since they were loaded, e.g. after the agent edited them,
+// and returns their paths. The mtime and size are checked first so
+// unchanged files are not re-read; files that can no longer be read keep
+// their last content.
+func (m *Manager) RefreshContextFiles() []string {
+	return append(refreshFiles(m.instructions), refreshFiles(m.contextFiles)...)
+}
+
+func refreshFiles(files []contextFile) []string {
+	var reloaded []string
+	for i := range files {
+		cf := &files[i]
+		info, err := os.Stat(cf.Path)
+		if err != nil || (info.ModTime().Equal(cf.ModTime) && info.Size() == cf.Size) {
+			continue
+		}
+		data, err := os.ReadFile(cf.Path)
+		if err != nil {
+			continue
+		}
+		cf.ModTime, cf.Size = info.ModTime(), info.Size()
+		if hash := sha256.Sum256(data); hash != cf.Hash {
+			cf.Content, cf.Hash = string(data), hash
+			reloaded = append(reloaded, cf.Path)
+		}
+	}
+	return reloaded
 }
 
 // ClearContextFiles removes all context files.
@@ -95,14 +180,18 @@ func (m *Manager) ClearMemories() {
 	m.memories = nil
 }
 
-// Append adds a single message to history.
+// Append adds a single message to history. Reasoning is dropped: models
+// only see their replies on later turns.
 func (m *Manager) Append(msg api.Message) {
+	msg.ReasoningContent = ""
 	m.history = append(m.history, msg)
 }
 
 // AppendMany adds multiple messages to history.
 func (m *Manager) AppendMany(msgs []api.Message) {
-	m.history = append(m.history, msgs...)
+	for _, msg := range msgs {
+		m.Append(msg)
+	}
 }
 
 // Messages returns the windowed message list suitable for sending to the LLM.
@@ -133,18 +222,12 @@ func (m *Manager) Messages() []api.Message {
 	}
 
 	// Reserve space for summary if present
-	var summaryMsg *api.Message
-	if m.summary != "" {
-		sm := api.Message{
-			Role:    "system",
-			Content: fmt.Sprintf("[Conversation summary] %s", m.summary),
-		}
-		summaryTokens := m.estimator.EstimateMessages([]api.Message{sm})
-		available -= summaryTokens
+	summaryMsgs := m.summaryMessages()
+	if len(summaryMsgs) > 0 {
+		available -= m.estimator.EstimateMessages(summaryMsgs)
 		if available < 0 {
 			available = 0
 		}
-		summaryMsg = &sm
 	}
 
 	// Walk history backwards to find the cutoff
@@ -159,13 +242,11 @@ func (m *Manager) Messages() []api.Message {
 		cutoff = i
 	}
 
-	// Build result: [system] + [memories] + [summary?] + [windowed history]
-	result := make([]api.Message, 0, len(systemMsgs)+len(m.memories)+1+len(m.history)-cutoff)
+	// Build result: [system] + [memories] + [summary sections] + [windowed history]
+	result := make([]api.Message, 0, len(systemMsgs)+len(m.memories)+len(summaryMsgs)+len(m.history)-cutoff)
 	result = append(result, systemMsgs...)
 	result = append(result, m.memories...)
-	if summaryMsg != nil {
-		result = append(result, *summaryMsg)
-	}
+	result = append(result, summaryMsgs...)
 	result = append(result, m.history[cutoff:]...)
 
 	return result
@@ -178,17 +259,47 @@ func (m *Manager) buildSystemMessages() []api.Message {
 	if m.systemPrompt != "" {
 		msgs = append(msgs, api.Message{Role: "system", Content: m.systemPrompt})
 	}
+	if m.env != "" {
+		msgs = append(msgs, api.Message{Role: "system", Content: m.env})
+	}
+	for _, cf := range m.instructions {
+		msgs = append(msgs, api.Message{
+			Role:    "system",
+			Content: fmt.Sprintf("[Project instructions: %s]\n%s", cf.Path, m.truncateToTokens(cf.Content, m.PromptBudget()/4)),
+		})
+	}
+
+	budgets := m.contextFileBudgets()
+	for i, cf := range m.contextFiles {
+		msgs = append(msgs, api.Message{
+			Role:    "system",
+			Content: fmt.Sprintf("[File: %s]\n%s", cf.Path, m.truncateToTokens(cf.Content, budgets[i])),
+		})
+	}
 
-	for _, cf := range m.contextFiles {
+	for _, p := range m.pinned {
 		msgs = append(msgs, api.Message{
 			Role:    "system",
-			Content: fmt.Sprintf("[File: %s]\n%s", cf.Path, cf.Content),
+			Content: fmt.Sprintf("[Pinned %s message]\n%s", p.Role, p.Content),
 		})
 	}
 
 	return msgs
 }
 
+// summaryMessages returns the pinned summary messages: the prose summary
+// followed by any structured state sections.
+func (m *Manager) summaryMessages() []api.Message {
+	var msgs []api.Message
+	if m.summary != "" {
+		msgs = append(msgs, api.Message{
+			Role:    "system",
+			Content: fmt.Sprintf("[Conversation summary] %s", m.summary),
+		})
+	}
+	return append(msgs, m.state.messages()...)
+}
+
 // NeedsSummary returns true if the history has messages that won't fit in the window
 // and could benefit from summarization.
 func (m *Manager) NeedsSummary() bool {
@@ -200,22 +311,55 @@ func (m *Manager) NeedsSummary() bool {
 		available -= m.estimator.EstimateMessages(m.memories)
 	}
 
-	if m.summary != "" {
-		sm := api.Message{
-			Role:    "system",
-			Content: fmt.Sprintf("[Conversation summary] %s", m.summary),
-		}
-		available -= m.estimator.EstimateMessages([]api.Message{sm})
+	if summaryMsgs := m.summaryMessages(); len(summaryMsgs) > 0 {
+		available -= m.estimator.EstimateMessages(summaryMsgs)
 	}
 
 	totalHistory := m.estimator.EstimateMessages(m.history)
 	return totalHistory > available && len(m.history) > 0
 }
 
-// Clear resets history and summary, keeping system prompt and context files.
+// Pin moves history[index] into the pinned set, where it is sent as a system
+// message on every request and is never evicted or summarized. Only user
+// and assistant messages without tool calls can be pinned.
+func (m *Manager) Pin(index int) error {
+	if index < 0 || index >= len(m.history) {
+		return fmt.Errorf("no history message at index %d", index)
+	}
+	msg := m.history[index]
+	if (msg.Role != "user" && msg.Role != "assistant") || len(msg.ToolCalls) > 0 || msg.Content == "" {
+		return fmt.Errorf("only user and assistant text messages can be pinned")
+	}
+	m.pinned = append(m.pinned, msg)
+	m.history = append(m.history[:index], m.history[index+1:]...)
+	return nil
+}
+
+// Unpin releases pinned message index. It goes back to the start of the
+// history, so it is the first to be evicted once the window fills up.
+func (m *Manager) Unpin(index int) error {
+	if index < 0 || index >= len(m.pinned) {
+		return fmt.Errorf("no pinned message at index %d", index)
+	}
+	msg := m.pinned[index]
+	m.pinned = append(m.pinned[:index], m.pinned[index+1:]...)
+	m.history = append([]api.Message{msg}, m.history...)
+	return nil
+}
+
+// Pinned returns a copy of the pinned messages.
+func (m *Manager) Pinned() []api.Message {
+	out := make([]api.Message, len(m.pinned))
+	copy(out, m.pinned)
+	return out
+}
+
+// Clear resets history and summary, keeping system prompt, context files
+// and pinned messages.
 func (m *Manager) Clear() {
 	m.history = nil
 	m.summary = ""
+	m.state = SessionState{}
 }
 
 // Budget returns the current token budget breakdown.
@@ -232,22 +376,16 @@ func (m *Manager) Budget() BudgetInfo {
 	}
 
 	summaryTokens := 0
-	if m.summary != "" {
-		sm := api.Message{
-			Role:    "system",
-			Content: fmt.Sprintf("[Conversation summary] %s", m.summary),
-		}
-		summaryTokens = m.estimator.EstimateMessages([]api.Message{sm})
+	summaryMsgs := m.summaryMessages()
+	if len(summaryMsgs) > 0 {
+		summaryTokens = m.estimator.EstimateMessages(summaryMsgs)
 		available -= summaryTokens
 	}
 
 	// Count tokens in the windowed history
 	msgs := m.Messages()
 	// History messages are everything after system + memories + summary messages
-	historyStart := len(systemMsgs) + len(m.memories)
-	if m.summary != "" {
-		historyStart++
-	}
+	historyStart := len(systemMsgs) + len(m.memories) + len(summaryMsgs)
 	historyMsgs := msgs[historyStart:]
 	historyTokens := m.estimator.EstimateMessages(historyMsgs)
 
@@ -271,6 +409,18 @@ func (m *Manager) Budget() BudgetInfo {
 	}
 }
 
+// PromptBudget returns the tokens a prompt's messages may use: the window
+// less the response and tool budgets.
+func (m *Manager) PromptBudget() int {
+	return m.cfg.CtxSize - m.cfg.ResponseBudget - m.cfg.ToolsBudget
+}
+
+// SetToolsBudget sets the tokens reserved for tool definitions, e.g. once
+// the tools prompt of the loaded model has been measured.
+func (m *Manager) SetToolsBudget(tokens int) {
+	m.cfg.ToolsBudget = tokens
+}
+
 // SetSummary sets the conversation summary directly (used by Summarize).
 func (m *Manager) SetSummary(summary string) {
 	m.summary = summary
@@ -281,9 +431,73 @@ func (m *Manager) Summary() string {
 	return m.summary
 }
 
+// State returns the structured state kept by structured summarization.
+func (m *Manager) State() SessionState {
+	return m.state
+}
+
+// SetState replaces the structured state, e.g. when resuming a session.
+func (m *Manager) SetState(state SessionState) {
+	m.state = state
+}
+
 // History returns a copy of the full history (including evicted messages).
 func (m *Manager) History() []api.Message {
 	out := make([]api.Message, len(m.history))
 	copy(out, m.history)
 	return out
 }
+
+// contextFileBudgets splits the context file allowance, half of the window
+// left after the response and tool budgets, across the loaded files. Files
+// smaller than an even share give their slack to the larger ones, so only
+// the files that are actually too big get truncated.
+func (m *Manager) contextFileBudgets() []int {
+	budgets := make([]int, len(m.contextFiles))
+	remaining := (m.cfg.CtxSize - m.cfg.ResponseBudget - m.cfg.ToolsBudget) / 2
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	order := make([]int, len(m.contextFiles))
+	for i := range order {
+		order[i] = i
+	}
+	sizes := make([]int, len(m.contextFiles))
+	for i, cf := range m.contextFiles {
+		sizes[i] = m.estimator.Estimate(cf.Content)
+	}
+	sort.Slice(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		budgets[i] = min(sizes[i], share)
+		remaining -= budgets[i]
+	}
+	return budgets
+}
+
+// truncateToTokens shortens content to roughly maxTokens, keeping the head
+// and tail (where package clauses, imports and recent additions usually
+// are) and cutting at line boundaries.
+func (m *Manager) truncateToTokens(content string, maxTokens int) string {
+	tokens := m.estimator.Estimate(content)
+	if tokens <= maxTokens {
+		return content
+	}
+	// Scale by content's own mix of prose, code and CJK text.
+	maxChars := len(content) * maxTokens / tokens
+	if maxChars >= len(content) {
+		return content
+	}
+	head := content[:maxChars*2/3]
+	tail := content[len(content)-maxChars/3:]
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i+1]
+	}
+	if i := strings.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	omitted := strings.Count(content[len(head):len(content)-len(tail)], "\n")
+	return fmt.Sprintf("%s[... %d lines omitted to fit the context budget ...]\n%s", head, omitted, tail)
+}
@@ -2,9 +2,14 @@ package chatctx
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
@@ -286,6 +291,18 @@ func TestAppendMany(t *testing.T) {
 	}
 }
 
+func TestAppendDropsReasoning(t *testing.T) {
+	mgr := newTestManager(4096)
+	mgr.Append(api.Message{Role: "assistant", Content: "4", ReasoningContent: "2+2 is 4"})
+	mgr.AppendMany([]api.Message{{Role: "assistant", Content: "5", ReasoningContent: "2+3 is 5"}})
+
+	for _, msg := range mgr.Messages() {
+		if msg.ReasoningContent != "" {
+			t.Errorf("reasoning %q kept in context", msg.ReasoningContent)
+		}
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	mgr := NewManager(Config{}, NewTokenEstimator())
 	if mgr.cfg.CtxSize != 4096 {
@@ -356,3 +373,503 @@ func TestSummarizeEmptyResponse(t *testing.T) {
 		t.Error("expected error from empty summarization response")
 	}
 }
+
+func TestStructuredSummarization(t *testing.T) {
+	mgr := NewManager(Config{CtxSize: 400, ResponseBudget: 100, StructuredSummary: true}, NewTokenEstimator())
+	mgr.SetSystemPrompt("sys")
+
+	mgr.Append(api.Message{Role: "user", Content: "fix the build"})
+	mgr.Append(api.Message{Role: "assistant", ToolCalls: []api.ToolCall{
+		{ID: "1", Type: "function", Function: api.ToolCallFunction{Name: "patch_file", Arguments: `{"path":"main.go","old_string":"a","new_string":"b"}`}},
+		{ID: "2", Type: "function", Function: api.ToolCallFunction{Name: "shell_exec", Arguments: `{"command":"go build ./..."}`}},
+		{ID: "3", Type: "function", Function: api.ToolCallFunction{Name: "file_write", Arguments: `{"path":"nope.go","content":"x"}`}},
+	}})
+	mgr.Append(api.Message{Role: "tool", ToolCallID: "1", Name: "patch_file", Content: "Replaced 1 characters with 1 characters in main.go"})
+	mgr.Append(api.Message{Role: "tool", ToolCallID: "2", Name: "shell_exec", Content: "command failed: exit status 1\n\nundefined: foo"})
+	mgr.Append(api.Message{Role: "tool", ToolCallID: "3", Name: "file_write", Content: "permission denied"})
+	for i := 0; i < 20; i++ {
+		mgr.Append(api.Message{Role: "user", Content: fmt.Sprintf("Message %d with padding text here", i)})
+		mgr.Append(api.Message{Role: "assistant", Content: fmt.Sprintf("Response %d with padding text here", i)})
+	}
+
+	var prompt string
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		prompt = req.Messages[0].Content
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{
+				{Message: api.Message{Role: "assistant", Content: "SUMMARY:\nFixing the build.\nDECISIONS:\n- keep the old API\nTODO:\n- define foo\n"}},
+			},
+		}, nil
+	}
+
+	if err := mgr.Summarize(context.Background(), mockComplete); err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if prompt != structuredSummarizationPrompt {
+		t.Error("expected the structured summarization prompt")
+	}
+	if mgr.Summary() != "Fixing the build." {
+		t.Errorf("summary = %q", mgr.Summary())
+	}
+
+	state := mgr.State()
+	if len(state.Files) != 1 || state.Files[0] != "main.go (patched)" {
+		t.Errorf("files = %v, want only the successful patch", state.Files)
+	}
+	if len(state.Commands) != 1 || !strings.Contains(state.Commands[0], "failed (exit status 1)") {
+		t.Errorf("commands = %v", state.Commands)
+	}
+	if len(state.Decisions) != 1 || len(state.TODOs) != 1 || state.TODOs[0] != "define foo" {
+		t.Errorf("decisions = %v, todos = %v", state.Decisions, state.TODOs)
+	}
+
+	var sections []string
+	for _, msg := range mgr.Messages() {
+		if strings.HasPrefix(msg.Content, "[") && msg.Role == "system" {
+			sections = append(sections, strings.SplitN(msg.Content, "]", 2)[0]+"]")
+		}
+	}
+	want := []string{"[Conversation summary]", "[Files touched]", "[Commands run]", "[Decisions]", "[Open TODOs]"}
+	if strings.Join(sections, ",") != strings.Join(want, ",") {
+		t.Errorf("pinned sections = %v, want %v", sections, want)
+	}
+}
+
+func TestParseStructuredSummaryFallback(t *testing.T) {
+	if _, _, _, ok := parseStructuredSummary("just some prose"); ok {
+		t.Error("expected ok=false for a reply without sections")
+	}
+
+	summary, decisions, todos, ok := parseStructuredSummary("## Summary\nDid things.\n## Decisions\n- none\n## TODO\n* write tests")
+	if !ok || summary != "Did things." || len(decisions) != 0 || len(todos) != 1 || todos[0] != "write tests" {
+		t.Errorf("got %q %v %v %v", summary, decisions, todos, ok)
+	}
+}
+
+func TestRefreshContextFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("version one"), 0644)
+
+	mgr := newTestManager(4096)
+	mgr.AddContextFile(path, "version one")
+
+	if reloaded := mgr.RefreshContextFiles(); len(reloaded) != 0 {
+		t.Errorf("unchanged file reloaded: %v", reloaded)
+	}
+
+	os.WriteFile(path, []byte("version two, longer"), 0644)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+
+	reloaded := mgr.RefreshContextFiles()
+	if len(reloaded) != 1 || reloaded[0] != path {
+		t.Fatalf("reloaded = %v, want [%s]", reloaded, path)
+	}
+	if msgs := mgr.Messages(); !strings.Contains(msgs[0].Content, "version two") {
+		t.Errorf("context file not updated: %q", msgs[0].Content)
+	}
+}
+
+func TestAddContextFileReplacesSamePath(t *testing.T) {
+	mgr := newTestManager(4096)
+	mgr.AddContextFile("a.txt", "old")
+	mgr.AddContextFile("a.txt", "new")
+
+	if files := mgr.ContextFiles(); len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v", files)
+	}
+	if msgs := mgr.Messages(); !strings.Contains(msgs[0].Content, "new") {
+		t.Errorf("expected replaced content, got %q", msgs[0].Content)
+	}
+}
+
+func TestContextFileTruncatedToBudget(t *testing.T) {
+	mgr := newTestManager(1000)
+
+	var b strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&b, "line %d of a long file\n", i)
+	}
+	mgr.AddContextFile("big.txt", b.String())
+	mgr.AddContextFile("small.txt", "tiny")
+
+	msgs := mgr.Messages()
+	big := msgs[0].Content
+	if !strings.Contains(big, "lines omitted") {
+		t.Fatal("expected big file to be truncated")
+	}
+	if !strings.Contains(big, "line 0 of") || !strings.Contains(big, "line 499 of") {
+		t.Error("truncation should keep the head and tail")
+	}
+	if msgs[1].Content != "[File: small.txt]\ntiny" {
+		t.Errorf("small file should be intact, got %q", msgs[1].Content)
+	}
+	// Files get half of the 900 tokens left after the response budget, plus
+	// a little for the headers and the omission marker.
+	if got := mgr.Estimator().EstimateMessages(msgs[:2]); got > 450+40 {
+		t.Errorf("context files use %d tokens, want about 450 or less", got)
+	}
+}
+
+func TestPinSurvivesWindowingAndSummary(t *testing.T) {
+	mgr := newTestManager(300)
+	mgr.SetSystemPrompt("sys")
+	mgr.Append(api.Message{Role: "user", Content: "which database?"})
+	mgr.Append(api.Message{Role: "assistant", Content: "Decision: use postgres"})
+	if err := mgr.Pin(1); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		mgr.Append(api.Message{Role: "user", Content: fmt.Sprintf("Message %d with padding text here", i)})
+		mgr.Append(api.Message{Role: "assistant", Content: fmt.Sprintf("Response %d with padding text here", i)})
+	}
+
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "Summary."}}},
+		}, nil
+	}
+	if err := mgr.Summarize(context.Background(), mockComplete); err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+
+	msgs := mgr.Messages()
+	if msgs[1].Role != "system" || !strings.Contains(msgs[1].Content, "Decision: use postgres") {
+		t.Errorf("pinned message should follow the system prompt, got %+v", msgs[1])
+	}
+	for _, h := range mgr.History() {
+		if h.Content == "Decision: use postgres" {
+			t.Error("pinned message should not remain in history")
+		}
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	mgr := newTestManager(4096)
+	mgr.Append(api.Message{Role: "user", Content: "hello"})
+	mgr.Append(api.Message{Role: "assistant", Content: "important"})
+	if err := mgr.Pin(1); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+
+	mgr.Clear()
+	if len(mgr.Pinned()) != 1 {
+		t.Fatal("Clear should keep pinned messages")
+	}
+
+	if err := mgr.Unpin(0); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if len(mgr.Pinned()) != 0 {
+		t.Error("expected no pinned messages")
+	}
+	if h := mgr.History(); len(h) != 1 || h[0].Content != "important" {
+		t.Errorf("unpinned message should return to history, got %v", h)
+	}
+	if err := mgr.Unpin(0); err == nil {
+		t.Error("expected error unpinning a missing index")
+	}
+}
+
+func TestPinRejectsToolMessages(t *testing.T) {
+	mgr := newTestManager(4096)
+	mgr.Append(api.Message{Role: "assistant", ToolCalls: []api.ToolCall{
+		{ID: "1", Type: "function", Function: api.ToolCallFunction{Name: "file_read", Arguments: `{"path":"a"}`}},
+	}})
+	mgr.Append(api.Message{Role: "tool", ToolCallID: "1", Content: "data"})
+
+	for i := 0; i < 3; i++ {
+		if err := mgr.Pin(i); err == nil {
+			t.Errorf("expected Pin(%d) to fail", i)
+		}
+	}
+	if len(mgr.History()) != 2 {
+		t.Error("history should be unchanged after rejected pins")
+	}
+}
+
+func TestCompactTurn(t *testing.T) {
+	mgr := newTestManager(4096)
+	call := func(id string) api.Message {
+		return api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{ID: id, Function: api.ToolCallFunction{Name: "file_read", Arguments: `{"path":"` + id + `.go"}`}}}}
+	}
+	messages := []api.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "fix the bug"},
+		call("a"),
+		{Role: "tool", ToolCallID: "a", Name: "file_read", Content: strings.Repeat("a.go contents ", 100)},
+		call("b"),
+		{Role: "tool", ToolCallID: "b", Name: "file_read", Content: "b.go contents"},
+	}
+
+	var prompt string
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "Read a.go; the bug is on line 3."}}},
+		}, nil
+	}
+
+	out, err := mgr.CompactTurn(context.Background(), mockComplete, messages, 2)
+	if err != nil {
+		t.Fatalf("CompactTurn failed: %v", err)
+	}
+	if !strings.Contains(prompt, "call file_read") || !strings.Contains(prompt, "a.go contents") {
+		t.Errorf("summarization prompt missing the first exchange:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "b.go contents") {
+		t.Error("summarization prompt included the latest exchange")
+	}
+	if len(out) != 5 {
+		t.Fatalf("got %d messages, want 5: %+v", len(out), out)
+	}
+	if out[1].Content != "fix the bug" || out[2].Content != "[Earlier in this turn] Read a.go; the bug is on line 3." {
+		t.Errorf("unexpected head of compacted turn: %+v", out[:3])
+	}
+	if out[3].ToolCalls[0].ID != "b" || out[4].ToolCallID != "b" {
+		t.Errorf("latest exchange not kept: %+v", out[3:])
+	}
+}
+
+func TestCompactTurnNothingToSummarize(t *testing.T) {
+	mgr := newTestManager(4096)
+	messages := []api.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+	}
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		t.Fatal("unexpected summarization request")
+		return nil, nil
+	}
+	out, err := mgr.CompactTurn(context.Background(), mockComplete, messages, 1)
+	if err != nil || len(out) != 2 {
+		t.Errorf("CompactTurn = %d messages, %v; want the 2 messages back", len(out), err)
+	}
+}
+
+func TestCompactToFreeRatio(t *testing.T) {
+	mgr := newTestManager(2000)
+	for i := 0; i < 20; i++ {
+		mgr.Append(api.Message{Role: "user", Content: fmt.Sprintf("Message %d %s", i, strings.Repeat("padding ", 5))})
+		mgr.Append(api.Message{Role: "assistant", Content: fmt.Sprintf("Response %d %s", i, strings.Repeat("padding ", 5))})
+	}
+	if mgr.NeedsSummary() {
+		t.Fatal("history should fit before compacting")
+	}
+	summarized := 0
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		summarized++
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "Earlier messages."}}},
+		}, nil
+	}
+
+	preview, err := mgr.Compact(context.Background(), mockComplete, CompactOptions{Free: 0.7, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summarized != 0 || len(mgr.History()) != 40 {
+		t.Fatal("dry run changed the history or called the model")
+	}
+	if preview.Messages == 0 || preview.FreeAfter < 1400 || preview.FreeBefore >= 1400 {
+		t.Fatalf("dry run = %+v, want messages to summarize and 70%% of 2000 tokens free", preview)
+	}
+
+	report, err := mgr.Compact(context.Background(), mockComplete, CompactOptions{Free: 0.7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summarized != 1 || report.Messages != preview.Messages {
+		t.Errorf("summarized %d times, %d messages; want once, %d", summarized, report.Messages, preview.Messages)
+	}
+	if got := len(mgr.History()); got != 40-report.Messages {
+		t.Errorf("history has %d messages, want %d", got, 40-report.Messages)
+	}
+	if mgr.History()[len(mgr.History())-2].Content != "Message 19 "+strings.Repeat("padding ", 5) {
+		t.Error("the latest exchange was not kept")
+	}
+}
+
+func TestCompactToFillWithProgress(t *testing.T) {
+	mgr := newTestManager(2000)
+	for i := 0; i < 20; i++ {
+		mgr.Append(api.Message{Role: "user", Content: fmt.Sprintf("Message %d %s", i, strings.Repeat("padding ", 5))})
+		mgr.Append(api.Message{Role: "assistant", Content: fmt.Sprintf("Response %d %s", i, strings.Repeat("padding ", 5))})
+	}
+	if fill := mgr.HistoryFill(); fill < 0.3 || fill > 1 {
+		t.Fatalf("HistoryFill = %.2f, want the history to fit in its space, taking over 30%% of it", fill)
+	}
+	var progress []int
+	mgr.SetSummaryProgress(func(messages, tokens int) {
+		progress = append(progress, messages)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		return nil, ctx.Err()
+	}
+	if _, err := mgr.Compact(ctx, cancelled, CompactOptions{Fill: 0.15}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(mgr.History()) != 40 || mgr.Summary() != "" {
+		t.Fatal("a cancelled summary changed the history")
+	}
+
+	mockComplete := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: "Earlier messages."}}},
+		}, nil
+	}
+	report, err := mgr.Compact(context.Background(), mockComplete, CompactOptions{Fill: 0.15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new summary takes some of the history's space, so allow a margin.
+	if fill := mgr.HistoryFill(); fill > 0.2 {
+		t.Errorf("HistoryFill = %.2f after compacting, want about 0.15", fill)
+	}
+	if len(progress) != 2 || progress[1] != report.Messages {
+		t.Errorf("progress = %v, want two reports, the last of %d messages", progress, report.Messages)
+	}
+}
+
+func TestCompactToolsOnly(t *testing.T) {
+	mgr := newTestManager(8000)
+	big := strings.Repeat("line of tool output\n", 100)
+	mgr.AppendMany([]api.Message{
+		{Role: "user", Content: "read a.go"},
+		{Role: "assistant", ToolCalls: []api.ToolCall{{ID: "a", Function: api.ToolCallFunction{Name: "file_read"}}}},
+		{Role: "tool", ToolCallID: "a", Name: "file_read", Content: big},
+		{Role: "assistant", Content: "a.go has the bug."},
+		{Role: "user", Content: "now read b.go"},
+		{Role: "assistant", ToolCalls: []api.ToolCall{{ID: "b", Function: api.ToolCallFunction{Name: "file_read"}}}},
+		{Role: "tool", ToolCallID: "b", Name: "file_read", Content: big},
+	})
+	noModel := func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+		t.Fatal("collapsing tool results should not call the model")
+		return nil, nil
+	}
+
+	preview, err := mgr.Compact(context.Background(), noModel, CompactOptions{ToolsOnly: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mgr.History()[2].Content != big {
+		t.Fatal("dry run changed the history")
+	}
+
+	report, err := mgr.Compact(context.Background(), noModel, CompactOptions{ToolsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != preview || report.Messages != 1 || report.FreeAfter <= report.FreeBefore {
+		t.Errorf("report = %+v, dry run = %+v; want one result collapsed and more free space", report, preview)
+	}
+	history := mgr.History()
+	if !strings.HasPrefix(history[2].Content, collapsedPrefix) || history[2].ToolCallID != "a" {
+		t.Errorf("older tool result not collapsed: %q", history[2].Content[:40])
+	}
+	if history[6].Content != big {
+		t.Error("the latest exchange's tool result was collapsed")
+	}
+	if history[0].Content != "read a.go" || history[3].Content != "a.go has the bug." {
+		t.Error("user and assistant text changed")
+	}
+
+	again, _ := mgr.Compact(context.Background(), noModel, CompactOptions{ToolsOnly: true})
+	if again.Messages != 0 {
+		t.Errorf("collapsed %d results again, want 0", again.Messages)
+	}
+}
+
+func TestEnvironmentMessage(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	if got := gitState(dir); got != "not a repository" {
+		t.Errorf("outside a repository: %q", got)
+	}
+	git("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	if got := gitState(dir); got != "branch main, clean" {
+		t.Errorf("clean: %q", got)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+	if got := gitState(dir); got != "branch main, 2 files with uncommitted changes" {
+		t.Errorf("dirty: %q", got)
+	}
+
+	mgr := newTestManager(10000)
+	mgr.SetSystemPrompt("You are helpful.")
+	mgr.Append(api.Message{Role: "user", Content: "Hello"})
+	if msgs := mgr.Messages(); len(msgs) != 2 {
+		t.Fatalf("environment message without EnableEnvironment: %+v", msgs)
+	}
+
+	mgr.EnableEnvironment(dir)
+	env := mgr.Messages()[1]
+	for _, want := range []string{"<env>\n", "Working directory: " + dir + "\n", "Git: branch main, 2 files", "Today's date: " + time.Now().Format("2006-01-02")} {
+		if !strings.Contains(env.Content, want) {
+			t.Errorf("environment message missing %q:\n%s", want, env.Content)
+		}
+	}
+
+	// The message is rebuilt on refresh, not on every Messages call.
+	git("checkout", "-q", "-b", "feature")
+	if !strings.Contains(mgr.Messages()[1].Content, "Git: branch main,") {
+		t.Error("environment changed before RefreshEnvironment")
+	}
+	mgr.RefreshEnvironment()
+	if !strings.Contains(mgr.Messages()[1].Content, "Git: branch feature,") {
+		t.Errorf("after refresh:\n%s", mgr.Messages()[1].Content)
+	}
+}
+
+func TestLoadInstructions(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "svc", "api")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(root, InstructionsFile), []byte("Run make test."), 0644)
+
+	mgr := newTestManager(10000)
+	mgr.SetSystemPrompt("You are helpful.")
+	if got := mgr.LoadInstructions(sub); len(got) != 1 || got[0] != filepath.Join(root, InstructionsFile) {
+		t.Fatalf("loaded %v", got)
+	}
+	if got := mgr.LoadInstructions(sub); len(got) != 0 {
+		t.Errorf("loaded again: %v", got)
+	}
+
+	// A file written later, e.g. by /init, is found on the next call and
+	// goes after the outer one.
+	os.WriteFile(filepath.Join(root, "svc", InstructionsFile), []byte("Services use chi."), 0644)
+	if got := mgr.LoadInstructions(sub); len(got) != 1 {
+		t.Fatalf("loaded %v", got)
+	}
+	msgs := mgr.Messages()
+	if len(msgs) != 3 || !strings.HasSuffix(msgs[1].Content, "]\nRun make test.") || !strings.HasSuffix(msgs[2].Content, "]\nServices use chi.") {
+		t.Fatalf("messages = %+v", msgs)
+	}
+
+	// Instructions survive /clear and /context clear, and are reloaded
+	// when edited.
+	mgr.Clear()
+	mgr.ClearContextFiles()
+	os.WriteFile(filepath.Join(root, InstructionsFile), []byte("Run go test ./..."), 0644)
+	if got := mgr.RefreshContextFiles(); len(got) != 1 {
+		t.Errorf("reloaded %v", got)
+	}
+	if msgs := mgr.Messages(); !strings.HasSuffix(msgs[1].Content, "]\nRun go test ./...") {
+		t.Errorf("after edit: %q", msgs[1].Content)
+	}
+}
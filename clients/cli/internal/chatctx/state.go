@@ -0,0 +1,246 @@
+package chatctx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// Caps on how much tracked state is pinned, so a very long session cannot
+// grow its pinned sections without bound.
+const (
+	maxTrackedFiles    = 40
+	maxTrackedCommands = 15
+)
+
+// SessionState is the actionable state carried across structured
+// summarization rounds. Each non-empty section is pinned as its own system
+// message next to the prose summary.
+type SessionState struct {
+	Files     []string // files written or patched, with the last action
+	Commands  []string // shell commands run, with their outcome
+	Decisions []string
+	TODOs     []string
+}
+
+func (s SessionState) empty() bool {
+	return len(s.Files) == 0 && len(s.Commands) == 0 && len(s.Decisions) == 0 && len(s.TODOs) == 0
+}
+
+// messages renders the non-empty sections as pinned system messages.
+func (s SessionState) messages() []api.Message {
+	var msgs []api.Message
+	add := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		msgs = append(msgs, api.Message{
+			Role:    "system",
+			Content: fmt.Sprintf("[%s]\n%s", title, bulletList(items)),
+		})
+	}
+	add("Files touched", s.Files)
+	add("Commands run", s.Commands)
+	add("Decisions", s.Decisions)
+	add("Open TODOs", s.TODOs)
+	return msgs
+}
+
+// recordToolActivity adds the file edits and shell commands found in msgs.
+// This is read straight from the tool calls rather than left to the model,
+// so it stays exact no matter how the summary is worded.
+func (s *SessionState) recordToolActivity(msgs []api.Message) {
+	results := make(map[string]string)
+	for _, msg := range msgs {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+
+	for _, msg := range msgs {
+		for _, tc := range msg.ToolCalls {
+			var args struct {
+				Path    string `json:"path"`
+				Command string `json:"command"`
+				Diff    string `json:"diff"`
+				Edits   []struct {
+					Path string `json:"path"`
+				} `json:"edits"`
+			}
+			if json.Unmarshal([]byte(tc.Function.Arguments), &args) != nil {
+				continue
+			}
+			result, hasResult := results[tc.ID]
+			switch tc.Function.Name {
+			case "file_write", "patch_file":
+				if args.Path == "" || !editSucceeded(result) {
+					continue
+				}
+				verb := "written"
+				if tc.Function.Name == "patch_file" {
+					verb = "patched"
+				}
+				s.touchFile(args.Path, verb)
+			case "multi_edit":
+				if !editSucceeded(result) {
+					continue
+				}
+				for _, e := range args.Edits {
+					if e.Path != "" {
+						s.touchFile(e.Path, "patched")
+					}
+				}
+			case "apply_unified_diff":
+				if !editSucceeded(result) {
+					continue
+				}
+				for _, f := range diffFiles(args.Diff) {
+					s.touchFile(f[0], f[1])
+				}
+			case "run_tests":
+				if !hasResult {
+					continue
+				}
+				// The first line is the command and its counts.
+				line, _, _ := strings.Cut(result, "\n")
+				s.Commands = append(s.Commands, "run_tests → "+line)
+			case "shell_exec", "shell_session":
+				if args.Command == "" {
+					continue
+				}
+				outcome := "no result"
+				if hasResult {
+					outcome = commandOutcome(result)
+				}
+				s.Commands = append(s.Commands, fmt.Sprintf("`%s` → %s", args.Command, outcome))
+			}
+		}
+	}
+
+	if len(s.Files) > maxTrackedFiles {
+		s.Files = s.Files[len(s.Files)-maxTrackedFiles:]
+	}
+	if len(s.Commands) > maxTrackedCommands {
+		s.Commands = s.Commands[len(s.Commands)-maxTrackedCommands:]
+	}
+}
+
+// touchFile records path, moving it to the end if it was already listed so
+// the most recently edited files survive the cap.
+func (s *SessionState) touchFile(path, verb string) {
+	for i, f := range s.Files {
+		if strings.HasPrefix(f, path+" (") {
+			s.Files = append(s.Files[:i], s.Files[i+1:]...)
+			break
+		}
+	}
+	s.Files = append(s.Files, fmt.Sprintf("%s (%s)", path, verb))
+}
+
+// diffFiles returns the files a unified diff changes, each with the verb
+// touchFile records: "patched", "created" or "deleted".
+func diffFiles(diff string) [][2]string {
+	var files [][2]string
+	lines := strings.Split(diff, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") || !strings.HasPrefix(lines[i+1], "+++ ") {
+			continue
+		}
+		oldPath, newPath := diffPath(lines[i][4:]), diffPath(lines[i+1][4:])
+		switch {
+		case newPath == "" && oldPath != "":
+			files = append(files, [2]string{oldPath, "deleted"})
+		case oldPath == "" && newPath != "":
+			files = append(files, [2]string{newPath, "created"})
+		case newPath != "":
+			files = append(files, [2]string{newPath, "patched"})
+		}
+		i++
+	}
+	return files
+}
+
+// diffPath strips a diff header path of its timestamp and a/ or b/ prefix;
+// /dev/null becomes "".
+func diffPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// editSucceeded reports whether a file_write, patch_file, multi_edit or
+// apply_unified_diff result is the tool's success message. Tool messages do not carry the
+// error flag, so this matches the wording in internal/tools.
+func editSucceeded(result string) bool {
+	return strings.HasPrefix(result, "Successfully wrote ") || strings.HasPrefix(result, "Replaced ") ||
+		strings.HasPrefix(result, "Applied ")
+}
+
+// commandOutcome condenses a shell_exec or shell_session result into "ok"
+// or the reason it failed.
+func commandOutcome(result string) string {
+	switch {
+	case strings.HasPrefix(result, "command timed out"):
+		return "timed out"
+	case strings.HasPrefix(result, "shell_exec refused by policy: "), strings.HasPrefix(result, "shell_session refused by policy: "):
+		return "refused by policy"
+	case strings.HasPrefix(result, "command failed: "):
+		line, _, _ := strings.Cut(strings.TrimPrefix(result, "command failed: "), "\n")
+		return "failed (" + line + ")"
+	}
+	return "ok"
+}
+
+const structuredSummarizationPrompt = `Summarize the following conversation for an assistant that will continue the work. Reply with exactly these three sections and nothing else:
+
+SUMMARY:
+A few sentences on what was done and what the current goal is.
+DECISIONS:
+- one decision per line, with the reason if it was stated
+TODO:
+- one piece of still-open work per line
+
+Carry over decisions and TODOs from the previous state unless they were reversed or completed. Write "- none" for an empty section. File edits and commands are tracked separately; do not list them.`
+
+// parseStructuredSummary splits a reply to structuredSummarizationPrompt into
+// its sections. ok is false when no section headers were found.
+func parseStructuredSummary(text string) (summary string, decisions, todos []string, ok bool) {
+	var section string
+	var prose []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		header := strings.ToUpper(strings.Trim(trimmed, "#*: "))
+		switch header {
+		case "SUMMARY", "DECISIONS", "TODO", "TODOS":
+			section, ok = header, true
+			continue
+		}
+		if trimmed == "" {
+			continue
+		}
+
+		switch section {
+		case "SUMMARY":
+			prose = append(prose, trimmed)
+		case "DECISIONS", "TODO", "TODOS":
+			item := strings.TrimSpace(strings.TrimLeft(trimmed, "-*• "))
+			if item == "" || strings.EqualFold(item, "none") {
+				continue
+			}
+			if section == "DECISIONS" {
+				decisions = append(decisions, item)
+			} else {
+				todos = append(todos, item)
+			}
+		}
+	}
+	return strings.Join(prose, " "), decisions, todos, ok
+}
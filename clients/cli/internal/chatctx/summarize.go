@@ -3,13 +3,23 @@ package chatctx
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/ThatCatDev/tanrenai/client/internal/reasoning"
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
 
 // CompletionFunc sends a chat completion request and returns the response.
 type CompletionFunc func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error)
 
+const turnSummarizationPrompt = `Summarize the tool calls and results below, which an assistant made while working on the user's request. They will be replaced by your summary so the work can continue in a limited context window. Preserve:
+- What each step was trying to find out or change
+- Facts learned: file paths, names, values, relevant code and command output
+- Changes made to files and commands run, with their outcomes
+- Errors hit and whether they were resolved
+
+Write it as notes for the assistant to continue from. Do not carry on with the task yourself.`
+
 const summarizationPrompt = `Summarize the following conversation concisely. Preserve:
 - Key facts and decisions made
 - File paths and code references mentioned
@@ -19,6 +29,22 @@ const summarizationPrompt = `Summarize the following conversation concisely. Pre
 
 Be concise but thorough. This summary will replace the original messages to save context space.`
 
+// SetSummaryProgress sets a function called as each summary request is
+// sent, with the number of messages being summarized and their tokens, so
+// callers can show what they are waiting for. A summary is cancelled with
+// the context passed to Summarize, Compact or CompactTurn, which then leave
+// the history as it was.
+func (m *Manager) SetSummaryProgress(fn func(messages, tokens int)) {
+	m.summaryProgress = fn
+}
+
+// reportSummary passes a summary request's size to the progress function.
+func (m *Manager) reportSummary(messages, tokens int) {
+	if m.summaryProgress != nil {
+		m.summaryProgress(messages, tokens)
+	}
+}
+
 // Summarize condenses older messages that won't fit in the context window.
 // It calls the LLM to generate a summary, then stores it in the Manager.
 // The summary replaces evicted messages when Messages() builds the window.
@@ -32,12 +58,8 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 	systemTokens := m.estimator.EstimateMessages(systemMsgs)
 	available := m.cfg.CtxSize - systemTokens - m.cfg.ResponseBudget
 
-	if m.summary != "" {
-		sm := api.Message{
-			Role:    "system",
-			Content: fmt.Sprintf("[Conversation summary] %s", m.summary),
-		}
-		available -= m.estimator.EstimateMessages([]api.Message{sm})
+	if summaryMsgs := m.summaryMessages(); len(summaryMsgs) > 0 {
+		available -= m.estimator.EstimateMessages(summaryMsgs)
 	}
 
 	// Find cutoff: walk backwards
@@ -55,7 +77,12 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 	if cutoff == 0 {
 		return nil // nothing to summarize
 	}
+	return m.summarizeHistory(ctx, complete, cutoff)
+}
 
+// summarizeHistory replaces history[:cutoff] with a summary, folded into
+// the existing one.
+func (m *Manager) summarizeHistory(ctx context.Context, complete CompletionFunc, cutoff int) error {
 	// Collect messages to summarize (the ones that would be evicted)
 	toSummarize := m.history[:cutoff]
 
@@ -78,8 +105,12 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 	}
 
 	// Build the summarization request
+	prompt := summarizationPrompt
+	if m.cfg.StructuredSummary {
+		prompt = structuredSummarizationPrompt
+	}
 	summaryMsgs := []api.Message{
-		{Role: "system", Content: summarizationPrompt},
+		{Role: "system", Content: prompt},
 	}
 
 	// Include existing summary if present
@@ -89,20 +120,18 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 			Content: fmt.Sprintf("Previous summary:\n%s", m.summary),
 		})
 	}
-
-	// Add the messages to summarize as a user message
-	var msgText string
-	for _, msg := range toSummarize {
-		msgText += fmt.Sprintf("[%s", msg.Role)
-		if msg.Name != "" {
-			msgText += fmt.Sprintf("/%s", msg.Name)
-		}
-		msgText += fmt.Sprintf("] %s\n", msg.Content)
+	if m.cfg.StructuredSummary && (len(m.state.Decisions) > 0 || len(m.state.TODOs) > 0) {
+		summaryMsgs = append(summaryMsgs, api.Message{
+			Role: "user",
+			Content: fmt.Sprintf("Previous decisions:\n%s\n\nPrevious open TODOs:\n%s",
+				bulletList(m.state.Decisions), bulletList(m.state.TODOs)),
+		})
 	}
 
+	// Add the messages to summarize as a user message
 	summaryMsgs = append(summaryMsgs, api.Message{
 		Role:    "user",
-		Content: fmt.Sprintf("Conversation to summarize:\n%s", msgText),
+		Content: fmt.Sprintf("Conversation to summarize:\n%s", transcriptText(toSummarize)),
 	})
 
 	req := &api.ChatCompletionRequest{
@@ -110,6 +139,7 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 		Stream:   false,
 	}
 
+	m.reportSummary(len(toSummarize), summarizeTokens)
 	resp, err := complete(ctx, req)
 	if err != nil {
 		return fmt.Errorf("summarization failed: %w", err)
@@ -119,10 +149,87 @@ func (m *Manager) Summarize(ctx context.Context, complete CompletionFunc) error
 		return fmt.Errorf("empty summarization response")
 	}
 
-	m.summary = resp.Choices[0].Message.Content
+	content, _ := reasoning.Split(resp.Choices[0].Message.Content)
+	m.summary = content
+	if m.cfg.StructuredSummary {
+		// The evicted messages were cut at startIdx when capping the
+		// summarization input, but tool activity is cheap to extract from
+		// all of them.
+		m.state.recordToolActivity(m.history[:cutoff])
+		if summary, decisions, todos, ok := parseStructuredSummary(content); ok {
+			m.summary = summary
+			m.state.Decisions = decisions
+			m.state.TODOs = todos
+		}
+	}
 
 	// Remove the summarized messages from history
 	m.history = m.history[cutoff:]
 
 	return nil
 }
+
+// CompactTurn shrinks an agent turn whose messages no longer fit the
+// window. The turn's messages from start up to its latest assistant message
+// are summarized into one system message; the messages before start and the
+// latest exchange are kept as they are, so tool calls stay paired with their
+// results. It returns messages unchanged if there is nothing before the
+// latest exchange to summarize. The manager itself is not modified.
+func (m *Manager) CompactTurn(ctx context.Context, complete CompletionFunc, messages []api.Message, start int) ([]api.Message, error) {
+	latest := -1
+	for i := len(messages) - 1; i > start; i-- {
+		if messages[i].Role == "assistant" {
+			latest = i
+			break
+		}
+	}
+	if latest < 0 {
+		return messages, nil
+	}
+
+	req := &api.ChatCompletionRequest{
+		Messages: []api.Message{
+			{Role: "system", Content: turnSummarizationPrompt},
+			{Role: "user", Content: "Work to summarize:\n" + m.truncateToTokens(transcriptText(messages[start:latest]), m.cfg.CtxSize/2)},
+		},
+	}
+	m.reportSummary(latest-start, m.estimator.EstimateMessages(messages[start:latest]))
+	resp, err := complete(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("turn summarization failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("empty turn summarization response")
+	}
+	summary, _ := reasoning.Split(resp.Choices[0].Message.Content)
+
+	out := make([]api.Message, 0, start+1+len(messages)-latest)
+	out = append(out, messages[:start]...)
+	out = append(out, api.Message{Role: "system", Content: "[Earlier in this turn] " + strings.TrimSpace(summary)})
+	return append(out, messages[latest:]...), nil
+}
+
+// transcriptText renders messages as "[role/name] content" lines for a
+// summarization prompt.
+func transcriptText(msgs []api.Message) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		b.WriteString("[" + msg.Role)
+		if msg.Name != "" {
+			b.WriteString("/" + msg.Name)
+		}
+		b.WriteString("] ")
+		for _, tc := range msg.ToolCalls {
+			b.WriteString(fmt.Sprintf("call %s(%s) ", tc.Function.Name, tc.Function.Arguments))
+		}
+		b.WriteString(msg.Content + "\n")
+	}
+	return b.String()
+}
+
+func bulletList(items []string) string {
+	if len(items) == 0 {
+		return "- none"
+	}
+	return "- " + strings.Join(items, "\n- ")
+}
@@ -4,13 +4,36 @@ import (
 	"encoding/json"
 	"math"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
 
+// textClass is a kind of text that tokenizes at its own rate.
+type textClass int
+
 const (
-	defaultCharsPerToken = 3.5
-	calibrationSample    = "The quick brown fox jumps over the lazy dog. " +
+	classProse textClass = iota
+	classCode
+	classCJK
+	textClasses
+)
+
+// defaultCharsPerToken is the bytes per token of each class until the
+// estimator is calibrated. Symbols and long identifiers split code into more
+// tokens than prose, and a CJK character, three bytes of UTF-8, is often a
+// token or more on its own.
+var defaultCharsPerToken = [textClasses]float64{
+	classProse: 3.5,
+	classCode:  3.0,
+	classCJK:   2.0,
+}
+
+// calibrationSamples are tokenized to fit each class's ratio. Every byte of
+// a sample is classified as its own class.
+var calibrationSamples = [textClasses]string{
+	classProse: "The quick brown fox jumps over the lazy dog. " +
 		"Pack my box with five dozen liquor jugs. " +
 		"How vexingly quick daft zebras jump! " +
 		"The five boxing wizards jump quickly. " +
@@ -19,50 +42,145 @@ const (
 		"The jay, pig, fox, zebra and my wolves quack! " +
 		"Amazingly few discotheques provide jukeboxes. " +
 		"Heavy boxes perform quick waltzes and jigs. " +
-		"Jackdaws love my big sphinx of quartz."
-	roleOverheadTokens = 4 // per-message overhead for role, separators, etc.
+		"Jackdaws love my big sphinx of quartz.",
+	classCode: "func (s *Store) Lookup(ctx context.Context, key string) (*Entry, error) {\n" +
+		"\ts.mu.RLock()\n" +
+		"\tdefer s.mu.RUnlock()\n" +
+		"\tentry, ok := s.entries[strings.ToLower(key)]\n" +
+		"\tif !ok || entry.ExpiresAt.Before(time.Now()) {\n" +
+		"\t\treturn nil, fmt.Errorf(\"lookup %q: %w\", key, ErrNotFound)\n" +
+		"\t}\n" +
+		"\tfor _, hook := range s.onLookup {\n" +
+		"\t\thook(ctx, entry)\n" +
+		"\t}\n" +
+		"\treturn entry, nil\n" +
+		"}\n" +
+		`{"name": "file_read", "arguments": {"path": "internal/chatctx/tokens.go", "max_lines": 200}}`,
+	classCJK: "我们今天讨论一下这个项目的上下文窗口管理。" +
+		"当对话太长时，较早的消息会被总结，以便为新的内容留出空间。" +
+		"日本語の文章も同じように数えます：トークンの数は文字の数に近いです。",
+}
+
+const (
+	roleOverheadTokens = 4   // per-message overhead for role, separators, etc.
+	imageTokens        = 768 // rough cost of an image; it varies with the model and resolution
 )
 
-// TokenEstimator estimates token counts using a calibrated chars-per-token ratio.
-// It defaults to a conservative ratio and can be calibrated against a real tokenizer.
+// TokenEstimator estimates token counts from calibrated chars-per-token
+// ratios, one each for prose, code and CJK text. It defaults to
+// conservative ratios and can be calibrated against a real tokenizer.
 type TokenEstimator struct {
-	charsPerToken float64
+	charsPerToken [textClasses]float64
 	calibrated    bool
 }
 
-// NewTokenEstimator creates a TokenEstimator with the default ratio.
+// NewTokenEstimator creates a TokenEstimator with the default ratios.
 func NewTokenEstimator() *TokenEstimator {
 	return &TokenEstimator{
 		charsPerToken: defaultCharsPerToken,
 	}
 }
 
-// Calibrate sends a sample string to the provided tokenize function and
-// adjusts the chars-per-token ratio accordingly. If calibration fails,
-// the estimator keeps using the default ratio.
+// Calibrate sends a prose, a code and a CJK sample to the provided tokenize
+// function and adjusts each class's ratio accordingly. If calibration
+// fails, the estimator keeps using the default ratios; a sample counted as
+// no tokens keeps its class's default.
 func (e *TokenEstimator) Calibrate(tokenizeFn func(string) (int, error)) error {
-	tokenCount, err := tokenizeFn(calibrationSample)
-	if err != nil {
-		return err
+	ratios := defaultCharsPerToken
+	var counts [textClasses]int
+	for class, sample := range calibrationSamples {
+		tokenCount, err := tokenizeFn(sample)
+		if err != nil {
+			return err
+		}
+		if tokenCount > 0 {
+			ratios[class] = float64(len(sample)) / float64(tokenCount)
+		}
+		counts[class] = tokenCount
 	}
-	if tokenCount > 0 {
-		e.charsPerToken = float64(len(calibrationSample)) / float64(tokenCount)
+	if counts[classProse] > 0 {
+		e.charsPerToken = ratios
 		e.calibrated = true
 	}
 	return nil
 }
 
+// Reset drops any calibration and goes back to the default ratios, e.g.
+// after switching to a model with a different tokenizer.
+func (e *TokenEstimator) Reset() {
+	e.charsPerToken = defaultCharsPerToken
+	e.calibrated = false
+}
+
 // Calibrated returns whether the estimator has been calibrated against a real tokenizer.
 func (e *TokenEstimator) Calibrated() bool {
 	return e.calibrated
 }
 
-// Estimate returns the estimated token count for the given text.
+// Estimate returns the estimated token count for the given text, counting
+// its prose, code and CJK parts at their own ratios.
 func (e *TokenEstimator) Estimate(text string) int {
 	if text == "" {
 		return 0
 	}
-	return int(math.Ceil(float64(len(text)) / e.charsPerToken))
+	tokens := 0.0
+	for class, n := range classify(text) {
+		tokens += float64(n) / e.charsPerToken[class]
+	}
+	return int(math.Ceil(tokens))
+}
+
+// classify counts text's bytes by class. CJK characters are counted one by
+// one; the rest of each line is code or prose as a whole.
+func classify(text string) [textClasses]int {
+	var counts [textClasses]int
+	for line := range strings.Lines(text) {
+		cjk := 0
+		for _, r := range line {
+			if isCJK(r) {
+				cjk += utf8.RuneLen(r)
+			}
+		}
+		counts[classCJK] += cjk
+		if codeLine(line) {
+			counts[classCode] += len(line) - cjk
+		} else {
+			counts[classProse] += len(line) - cjk
+		}
+	}
+	return counts
+}
+
+// codeLine reports whether a line looks like code: indented, or dense with
+// brackets, operators, quotes and camelCase or snake_case identifiers,
+// which prose rarely has.
+func codeLine(line string) bool {
+	if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ") {
+		return true
+	}
+	symbols, letters := 0, 0
+	prev := ' '
+	for _, r := range line {
+		switch {
+		case strings.ContainsRune("{}[]()<>;=_*&|\\/$#`\"", r):
+			symbols++
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			symbols++
+			letters++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			letters++
+		}
+		prev = r
+	}
+	return symbols > 0 && symbols*8 >= letters
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character or
+// CJK punctuation.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x30ff) || // CJK punctuation and kana, with marks like ー
+		(r >= 0xff00 && r <= 0xffef) // fullwidth forms
 }
 
 // EstimateMessages returns the estimated total tokens for a slice of messages.
@@ -72,6 +190,7 @@ func (e *TokenEstimator) EstimateMessages(msgs []api.Message) int {
 	for _, msg := range msgs {
 		total += roleOverheadTokens
 		total += e.Estimate(msg.Content)
+		total += len(msg.Images) * imageTokens
 
 		// Account for tool call structure
 		for _, tc := range msg.ToolCalls {
@@ -74,6 +74,19 @@ func TestEstimateMessageWithToolCalls(t *testing.T) {
 	}
 }
 
+func TestEstimateMessageWithImages(t *testing.T) {
+	e := NewTokenEstimator()
+
+	text := api.Message{Role: "user", Content: "What does this screenshot show?"}
+	withImages := text
+	withImages.Images = []string{"data:image/png;base64,AAAA", "data:image/png;base64,BBBB"}
+
+	got := e.EstimateMessages([]api.Message{withImages}) - e.EstimateMessages([]api.Message{text})
+	if got != 2*imageTokens {
+		t.Errorf("two images added %d tokens, want %d", got, 2*imageTokens)
+	}
+}
+
 func TestEstimateToolResponse(t *testing.T) {
 	e := NewTokenEstimator()
 
@@ -107,10 +120,84 @@ func TestCalibrateSuccess(t *testing.T) {
 		t.Error("expected Calibrated() to return true after successful calibration")
 	}
 
-	// After calibration, ratio should be len(calibrationSample)/100
-	expectedRatio := float64(len(calibrationSample)) / 100.0
-	if e.charsPerToken != expectedRatio {
-		t.Errorf("charsPerToken = %f, want %f", e.charsPerToken, expectedRatio)
+	// After calibration, ratio should be len(calibrationSamples[classProse])/100
+	expectedRatio := float64(len(calibrationSamples[classProse])) / 100.0
+	if e.charsPerToken[classProse] != expectedRatio {
+		t.Errorf("charsPerToken = %f, want %f", e.charsPerToken[classProse], expectedRatio)
+	}
+}
+
+func TestCalibrateClasses(t *testing.T) {
+	e := NewTokenEstimator()
+	tokens := map[string]int{
+		calibrationSamples[classProse]: 100,
+		calibrationSamples[classCode]:  150,
+		calibrationSamples[classCJK]:   90,
+	}
+	if err := e.Calibrate(func(text string) (int, error) { return tokens[text], nil }); err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	for class, sample := range calibrationSamples {
+		if want := float64(len(sample)) / float64(tokens[sample]); e.charsPerToken[class] != want {
+			t.Errorf("class %d: charsPerToken = %f, want %f", class, e.charsPerToken[class], want)
+		}
+		if got := e.Estimate(sample); got != tokens[sample] {
+			t.Errorf("class %d: Estimate(sample) = %d, want %d", class, got, tokens[sample])
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for class, sample := range calibrationSamples {
+		counts := classify(sample)
+		if counts[class] != len(sample) {
+			t.Errorf("calibration sample %d classified as %v, want all %d bytes in its class", class, counts, len(sample))
+		}
+	}
+
+	tests := []struct {
+		text string
+		want [textClasses]int
+	}{
+		{"Summarize the older messages (but keep the latest).", [textClasses]int{classProse: 51}},
+		{"if err := mgr.Summarize(ctx, fn); err != nil {", [textClasses]int{classCode: 46}},
+		{"\treturn summary", [textClasses]int{classCode: 15}},
+		{"estimatedCharsPerToken", [textClasses]int{classCode: 22}},
+		{"上下文 window", [textClasses]int{classProse: 7, classCJK: 9}},
+		{"Some prose.\n\tcode()\n", [textClasses]int{classProse: 12, classCode: 8}},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.text); got != tt.want {
+			t.Errorf("classify(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateCJKAndCode(t *testing.T) {
+	e := NewTokenEstimator()
+
+	// 上下文窗口 is 5 characters, 15 bytes: ceil(15/2.0) = 8
+	if got := e.Estimate("上下文窗口"); got != 8 {
+		t.Errorf("Estimate(CJK) = %d, want 8", got)
+	}
+	// 29 bytes of code: ceil(29/3.0) = 10, where prose would be 9
+	if got := e.Estimate("x := strings.TrimSpace(line);"); got != 10 {
+		t.Errorf("Estimate(code) = %d, want 10", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	e := NewTokenEstimator()
+	if err := e.Calibrate(func(string) (int, error) { return 100, nil }); err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+
+	e.Reset()
+	if e.Calibrated() {
+		t.Error("expected Calibrated() to return false after Reset")
+	}
+	if e.charsPerToken[classProse] != defaultCharsPerToken[classProse] {
+		t.Errorf("charsPerToken = %f, want default %f", e.charsPerToken[classProse], defaultCharsPerToken[classProse])
 	}
 }
 
@@ -132,8 +219,8 @@ func TestCalibrateFallback(t *testing.T) {
 	}
 
 	// Should still use default ratio
-	if e.charsPerToken != defaultCharsPerToken {
-		t.Errorf("charsPerToken = %f, want default %f", e.charsPerToken, defaultCharsPerToken)
+	if e.charsPerToken[classProse] != defaultCharsPerToken[classProse] {
+		t.Errorf("charsPerToken = %f, want default %f", e.charsPerToken[classProse], defaultCharsPerToken[classProse])
 	}
 
 	// Should still work for estimation
@@ -159,8 +246,8 @@ func TestCalibrateZeroTokens(t *testing.T) {
 	if e.Calibrated() {
 		t.Error("should not calibrate with zero tokens")
 	}
-	if e.charsPerToken != defaultCharsPerToken {
-		t.Errorf("charsPerToken should remain default, got %f", e.charsPerToken)
+	if e.charsPerToken[classProse] != defaultCharsPerToken[classProse] {
+		t.Errorf("charsPerToken should remain default, got %f", e.charsPerToken[classProse])
 	}
 }
 
@@ -0,0 +1,63 @@
+package chatctx
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// Tool-calling formats a loaded model can report (api.LoadModelResponse.ToolFormat).
+const (
+	ToolFormatHermes  = "hermes"
+	ToolFormatQwen    = "qwen"
+	ToolFormatLlama3  = "llama3"
+	ToolFormatMistral = "mistral"
+)
+
+// ToolsPrompt renders tool definitions the way the chat template of format
+// puts them in the prompt, so their cost can be measured with the model's
+// tokenizer. Unknown formats, and "" for models whose format is not
+// known, render as Hermes, llama-server's fallback.
+func ToolsPrompt(format string, tools []api.Tool) string {
+	var b strings.Builder
+	switch format {
+	case ToolFormatMistral:
+		data, _ := json.Marshal(tools)
+		b.WriteString("[AVAILABLE_TOOLS]")
+		b.Write(data)
+		b.WriteString("[/AVAILABLE_TOOLS]")
+	case ToolFormatLlama3:
+		b.WriteString("<|start_header_id|>user<|end_header_id|>\n\n")
+		b.WriteString("Given the following functions, please respond with a JSON for a function call with its proper arguments that best answers the given prompt.\n\n")
+		b.WriteString(`Respond in the format {"name": function name, "parameters": dictionary of argument name and its value}.Do not use variables.` + "\n\n")
+		for _, t := range tools {
+			data, _ := json.MarshalIndent(t, "", "    ")
+			b.Write(data)
+			b.WriteString("\n\n")
+		}
+	case ToolFormatQwen:
+		b.WriteString("\n\n# Tools\n\nYou may call one or more functions to assist with the user query.\n\n")
+		b.WriteString("You are provided with function signatures within <tools></tools> XML tags:\n<tools>")
+		for _, t := range tools {
+			data, _ := json.Marshal(t)
+			b.WriteString("\n")
+			b.Write(data)
+		}
+		b.WriteString("\n</tools>\n\nFor each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags:\n")
+		b.WriteString("<tool_call>\n{\"name\": <function-name>, \"arguments\": <args-json-object>}\n</tool_call>")
+	default:
+		b.WriteString("You are a function calling AI model. You are provided with function signatures within <tools></tools> XML tags. ")
+		b.WriteString("You may call one or more functions to assist with the user query. Don't make assumptions about what values to plug into functions. ")
+		b.WriteString("Here are the available tools: <tools>")
+		for _, t := range tools {
+			data, _ := json.Marshal(t.Function)
+			b.Write(data)
+		}
+		b.WriteString("</tools>Use the following pydantic model json schema for each tool call you will make: ")
+		b.WriteString(`{"properties": {"name": {"title": "Name", "type": "string"}, "arguments": {"title": "Arguments", "type": "object"}}, "required": ["name", "arguments"], "title": "FunctionCall", "type": "object"}`)
+		b.WriteString("\nFor each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags as follows:\n")
+		b.WriteString("<tool_call>\n{\"name\": <function-name>, \"arguments\": <args-dict>}\n</tool_call>")
+	}
+	return b.String()
+}
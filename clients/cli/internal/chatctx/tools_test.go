@@ -0,0 +1,45 @@
+package chatctx
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+func TestToolsPrompt(t *testing.T) {
+	tools := []api.Tool{{
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        "file_read",
+			Description: "Read a file",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}}}`),
+		},
+	}}
+
+	for _, format := range []string{ToolFormatHermes, ToolFormatQwen, ToolFormatLlama3, ToolFormatMistral, ""} {
+		prompt := ToolsPrompt(format, tools)
+		if !strings.Contains(prompt, `"file_read"`) || !strings.Contains(prompt, "Read a file") {
+			t.Errorf("%q: tool missing from %q", format, prompt)
+		}
+	}
+
+	mistral := ToolsPrompt(ToolFormatMistral, tools)
+	body := strings.TrimSuffix(strings.TrimPrefix(mistral, "[AVAILABLE_TOOLS]"), "[/AVAILABLE_TOOLS]")
+	var decoded []api.Tool
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil || len(decoded) != 1 {
+		t.Errorf("mistral tools are not a JSON array: %q", mistral)
+	}
+	if !strings.Contains(ToolsPrompt(ToolFormatQwen, tools), "# Tools") {
+		t.Error("qwen prompt lacks its # Tools section")
+	}
+}
+
+func TestSetToolsBudget(t *testing.T) {
+	m := NewManager(Config{CtxSize: 8192, ResponseBudget: 512}, NewTokenEstimator())
+	m.SetToolsBudget(1200)
+	if got := m.PromptBudget(); got != 8192-512-1200 {
+		t.Errorf("PromptBudget = %d", got)
+	}
+}
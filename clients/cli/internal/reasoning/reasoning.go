@@ -0,0 +1,95 @@
+// Package reasoning separates the thinking of R1-style models, emitted
+// between <think> and </think>, from their answers.
+package reasoning
+
+import "strings"
+
+const (
+	openTag  = "<think>"
+	closeTag = "</think>"
+)
+
+// Splitter separates reasoning from answer text in streamed content. A tag
+// split across deltas is held back until the next delta shows whether it
+// is one.
+type Splitter struct {
+	thinking   bool
+	afterThink bool   // trim the whitespace that follows </think>
+	held       string // possible start of a tag
+}
+
+// Split takes the next content delta and returns its answer and reasoning
+// parts.
+func (s *Splitter) Split(delta string) (content, reasoning string) {
+	var c, r strings.Builder
+	buf := s.held + delta
+	s.held = ""
+	for buf != "" {
+		tag := openTag
+		if s.thinking {
+			tag = closeTag
+		}
+		i := strings.Index(buf, tag)
+		text := buf
+		if i >= 0 {
+			text, buf = buf[:i], buf[i+len(tag):]
+		} else {
+			n := partialTagLen(buf, tag)
+			text, s.held = buf[:len(buf)-n], buf[len(buf)-n:]
+			buf = ""
+		}
+		s.emit(text, &c, &r)
+		if i >= 0 {
+			s.thinking = !s.thinking
+			s.afterThink = !s.thinking
+		}
+	}
+	return c.String(), r.String()
+}
+
+// Flush returns text held back at the end of the stream.
+func (s *Splitter) Flush() (content, reasoning string) {
+	var c, r strings.Builder
+	s.emit(s.held, &c, &r)
+	s.held = ""
+	return c.String(), r.String()
+}
+
+// Thinking reports whether the stream is inside a reasoning block.
+func (s *Splitter) Thinking() bool {
+	return s.thinking
+}
+
+func (s *Splitter) emit(text string, content, reasoning *strings.Builder) {
+	if s.thinking {
+		reasoning.WriteString(text)
+		return
+	}
+	if s.afterThink {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return
+		}
+		s.afterThink = false
+	}
+	content.WriteString(text)
+}
+
+// partialTagLen returns the length of the longest suffix of s that is a
+// proper prefix of tag.
+func partialTagLen(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// Split separates the reasoning from a complete message.
+func Split(text string) (content, reasoning string) {
+	var s Splitter
+	c, r := s.Split(text)
+	fc, fr := s.Flush()
+	return c + fc, r + fr
+}
@@ -0,0 +1,38 @@
+package reasoning
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in, content, reasoning string
+	}{
+		{"plain answer", "plain answer", ""},
+		{"<think>hmm, 2+2</think>\n\n4", "4", "hmm, 2+2"},
+		{"<think>unfinished", "", "unfinished"},
+		{"a <b> c", "a <b> c", ""},
+		{"x < y", "x < y", ""},
+	}
+	for _, tt := range tests {
+		content, reasoning := Split(tt.in)
+		if content != tt.content || reasoning != tt.reasoning {
+			t.Errorf("Split(%q) = %q, %q; want %q, %q", tt.in, content, reasoning, tt.content, tt.reasoning)
+		}
+	}
+}
+
+func TestSplitterTagAcrossDeltas(t *testing.T) {
+	var s Splitter
+	var content, reasoning string
+	for _, delta := range []string{"<th", "ink>let me", " see</", "think", ">", "\n", "Done", " <"} {
+		c, r := s.Split(delta)
+		content += c
+		reasoning += r
+	}
+	if content != "Done " || reasoning != "let me see" {
+		t.Errorf("before flush: content %q, reasoning %q", content, reasoning)
+	}
+	c, r := s.Flush()
+	if content+c != "Done <" || r != "" {
+		t.Errorf("after flush: content %q, reasoning %q", content+c, r)
+	}
+}
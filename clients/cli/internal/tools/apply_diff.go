@@ -0,0 +1,459 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDiffFuzz is how many context lines a hunk may lose at each end and
+// still apply, like patch's default fuzz factor.
+const maxDiffFuzz = 2
+
+// ApplyDiffTool applies a unified diff to one or more files. Hunks are
+// located by their content rather than trusted line numbers, tolerating
+// whitespace differences and a little stale context, and nothing is
+// written unless every hunk applies.
+type ApplyDiffTool struct{}
+
+type applyDiffArgs struct {
+	Diff string `json:"diff"`
+}
+
+func (t *ApplyDiffTool) Name() string { return "apply_unified_diff" }
+
+func (t *ApplyDiffTool) Description() string {
+	return "Apply a unified diff (as produced by `diff -u` or `git diff`) covering one or more files. Each file starts with --- and +++ header lines (use /dev/null to create or delete a file), followed by @@ hunks of context (' '), removed ('-') and added ('+') lines. Line numbers may be approximate; hunks are matched by content. If any hunk does not apply, no file is changed. Use file_read first to see the current content."
+}
+
+func (t *ApplyDiffTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"diff": {Type: "string", Description: "The unified diff to apply"},
+		},
+		Required: []string{"diff"},
+	}.MustMarshal()
+}
+
+func (t *ApplyDiffTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+	var args applyDiffArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if strings.TrimSpace(args.Diff) == "" {
+		return ErrorResult("diff is required"), nil
+	}
+
+	patches, err := parseUnifiedDiff(args.Diff)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid diff: %v", err)), nil
+	}
+
+	// Work out every file's new content before touching any of them.
+	var changes []*fileChange
+	var report []string
+	for _, p := range patches {
+		change, notes, err := p.prepare()
+		if err != nil {
+			return ErrorResult(err.Error() + "\n\nNo files were changed."), nil
+		}
+		changes = append(changes, change)
+		report = append(report, notes...)
+	}
+
+	for i, c := range changes {
+		if err := c.apply(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				changes[j].revert()
+			}
+			return ErrorResult(fmt.Sprintf("failed to update %s: %v. Files already updated were restored; no files were changed.", c.target(), err)), nil
+		}
+	}
+	return &ToolResult{Output: "Applied diff:\n" + strings.Join(report, "\n")}, nil
+}
+
+// filePatch is the part of a diff for one file. oldPath is empty when the
+// file is created and newPath when it is deleted.
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []diffHunk
+}
+
+type diffHunk struct {
+	oldStart int // 1-based line from the @@ header; 0 if it had none
+	lines    []diffLine
+	noEOL    bool // the new side ends without a newline
+}
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parseUnifiedDiff splits diff into per-file patches. Hunk line counts are
+// ignored, since models often get them wrong; a hunk runs until the next
+// hunk or file header.
+func parseUnifiedDiff(diff string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	var patches []*filePatch
+	var cur *filePatch
+	var hunk *diffHunk
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			cur = &filePatch{oldPath: diffPath(line[4:]), newPath: diffPath(lines[i+1][4:])}
+			patches = append(patches, cur)
+			hunk = nil
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, errors.New("hunk before the first --- / +++ file header")
+			}
+			h := diffHunk{}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				h.oldStart, _ = strconv.Atoi(m[1])
+			}
+			cur.hunks = append(cur.hunks, h)
+			hunk = &cur.hunks[len(cur.hunks)-1]
+		case hunk == nil:
+			// "diff --git", "index" and other lines outside hunks.
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" refers to the line before it.
+			if n := len(hunk.lines); n > 0 && hunk.lines[n-1].op != '-' {
+				hunk.noEOL = true
+			}
+		case line == "":
+			// A blank context line whose leading space was stripped, unless
+			// it ends the diff.
+			if i < len(lines)-1 {
+				hunk.lines = append(hunk.lines, diffLine{' ', ""})
+			}
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			hunk.lines = append(hunk.lines, diffLine{line[0], line[1:]})
+		default:
+			hunk = nil
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, errors.New("no --- / +++ file headers found")
+	}
+	for _, p := range patches {
+		if p.oldPath == "" && p.newPath == "" {
+			return nil, errors.New("a file header names /dev/null on both sides")
+		}
+		if len(p.hunks) == 0 && p.newPath != "" {
+			return nil, fmt.Errorf("no hunks for %s", p.newPath)
+		}
+	}
+	return patches, nil
+}
+
+// diffPath returns the path in a --- or +++ header, without a trailing
+// timestamp or git's a/ and b/ prefixes, or "" for /dev/null.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		if _, err := os.Stat(s); err != nil {
+			s = s[2:]
+		}
+	}
+	return s
+}
+
+// fileChange is a prepared change to one file, with what is needed to
+// undo it.
+type fileChange struct {
+	oldPath, newPath string
+	content          []byte
+	mode             os.FileMode
+	original         []byte // nil if oldPath did not exist
+	applied          bool
+}
+
+func (c *fileChange) target() string {
+	if c.newPath != "" {
+		return c.newPath
+	}
+	return c.oldPath
+}
+
+func (c *fileChange) apply() error {
+	if c.newPath != "" {
+		if err := os.MkdirAll(filepath.Dir(c.newPath), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(c.newPath, c.content, c.mode); err != nil {
+			return err
+		}
+	}
+	if c.oldPath != "" && c.oldPath != c.newPath {
+		if err := os.Remove(c.oldPath); err != nil {
+			if c.newPath != "" {
+				os.Remove(c.newPath)
+			}
+			return err
+		}
+	}
+	c.applied = true
+	return nil
+}
+
+func (c *fileChange) revert() {
+	if !c.applied {
+		return
+	}
+	if c.newPath != "" && c.newPath != c.oldPath {
+		os.Remove(c.newPath)
+	}
+	if c.oldPath != "" {
+		writeFileAtomic(c.oldPath, c.original, c.mode)
+	}
+}
+
+// prepare reads the file and applies the hunks in memory, returning the
+// change and a line per file (and per fuzzy hunk) for the report.
+func (p *filePatch) prepare() (*fileChange, []string, error) {
+	c := &fileChange{oldPath: p.oldPath, newPath: p.newPath, mode: 0644}
+
+	if p.oldPath == "" {
+		if _, err := os.Stat(p.newPath); err == nil {
+			return nil, nil, fmt.Errorf("%s: the diff creates it, but it already exists", p.newPath)
+		}
+		var lines []string
+		noEOL := false
+		for _, h := range p.hunks {
+			for _, l := range h.lines {
+				if l.op != '-' {
+					lines = append(lines, l.text)
+				}
+			}
+			noEOL = h.noEOL
+		}
+		c.content = []byte(joinLines(lines, "\n", !noEOL))
+		return c, []string{fmt.Sprintf("%s: created", p.newPath)}, nil
+	}
+
+	info, err := os.Stat(p.oldPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%s: file not found", p.oldPath)
+		}
+		return nil, nil, fmt.Errorf("%s: %v", p.oldPath, err)
+	}
+	data, err := os.ReadFile(p.oldPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: failed to read file: %v", p.oldPath, err)
+	}
+	c.original = data
+	c.mode = info.Mode().Perm()
+	if p.newPath == "" {
+		return c, []string{fmt.Sprintf("%s: deleted", p.oldPath)}, nil
+	}
+
+	text := string(data)
+	eol := "\n"
+	if strings.Contains(text, "\r\n") {
+		eol = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	trailingEOL := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+
+	lines, notes, err := applyHunks(lines, p.hunks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", p.oldPath, err)
+	}
+	if last := p.hunks[len(p.hunks)-1]; last.noEOL {
+		trailingEOL = false
+	}
+	c.content = []byte(joinLines(lines, eol, trailingEOL))
+
+	summary := fmt.Sprintf("%s: %d hunks applied", p.newPath, len(p.hunks))
+	if p.newPath != p.oldPath {
+		summary += fmt.Sprintf(" (renamed from %s)", p.oldPath)
+	}
+	for _, n := range notes {
+		summary += "\n  " + n
+	}
+	return c, []string{summary}, nil
+}
+
+func joinLines(lines []string, eol string, trailing bool) string {
+	s := strings.Join(lines, eol)
+	if trailing && len(lines) > 0 {
+		s += eol
+	}
+	return s
+}
+
+// applyHunks applies hunks in order to lines. Each hunk is placed where its
+// old side matches, nearest the line its header gives (shifted by the
+// earlier hunks), first exactly, then ignoring trailing whitespace, then
+// ignoring all leading and trailing whitespace, then with up to
+// maxDiffFuzz context lines dropped from each end. Inexact placements are
+// described in notes.
+func applyHunks(lines []string, hunks []diffHunk) ([]string, []string, error) {
+	var notes []string
+	delta, from := 0, 0
+	for i, h := range hunks {
+		expected := max(h.oldStart-1+delta, from)
+		if h.oldStart == 0 {
+			expected = from
+		}
+
+		pos, old, repl, how := placeHunk(lines, h.lines, from, expected)
+		if pos < 0 {
+			return nil, nil, fmt.Errorf("hunk %d does not match the file; these lines were not found:\n%s", i+1, oldSide(h.lines))
+		}
+		if how != "" || (h.oldStart > 0 && pos != expected) {
+			note := fmt.Sprintf("hunk %d applied at line %d", i+1, pos+1)
+			if h.oldStart > 0 && pos != expected {
+				note += fmt.Sprintf(" (header said %d)", expected+1)
+			}
+			if how != "" {
+				note += " " + how
+			}
+			notes = append(notes, note)
+		}
+
+		// Matched lines keep the file's text for context; only '-' and '+'
+		// lines change it.
+		var out []string
+		k := pos
+		for _, l := range repl {
+			switch l.op {
+			case ' ':
+				out = append(out, lines[k])
+				k++
+			case '-':
+				k++
+			case '+':
+				out = append(out, l.text)
+			}
+		}
+		lines = append(lines[:pos:pos], append(out, lines[pos+len(old):]...)...)
+		delta += len(out) - len(old)
+		from = pos + len(out)
+	}
+	return lines, notes, nil
+}
+
+var lineMatchers = []struct {
+	how   string
+	equal func(a, b string) bool
+}{
+	{"", func(a, b string) bool { return a == b }},
+	{"ignoring trailing whitespace", func(a, b string) bool {
+		return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+	}},
+	{"ignoring indentation", func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) }},
+}
+
+// placeHunk finds where hunk lines apply at or after from, returning the
+// position, the old-side lines matched, the hunk lines actually used (after
+// any fuzz) and how inexact the match was; pos is -1 if it does not apply.
+func placeHunk(lines []string, hunk []diffLine, from, expected int) (pos int, old []string, used []diffLine, how string) {
+	for fuzz := 0; fuzz <= maxDiffFuzz; fuzz++ {
+		trimmed, ok := trimContext(hunk, fuzz)
+		if !ok {
+			break
+		}
+		old := oldLines(trimmed)
+		if len(old) == 0 {
+			// Pure insertion with no context: trust the header.
+			return min(expected, len(lines)), nil, trimmed, ""
+		}
+		for _, m := range lineMatchers {
+			if p := nearestMatch(lines, old, from, expected, m.equal); p >= 0 {
+				how := m.how
+				if fuzz > 0 {
+					how = strings.TrimSpace(fmt.Sprintf("%s with fuzz %d", how, fuzz))
+				}
+				return p, old, trimmed, how
+			}
+		}
+	}
+	return -1, nil, nil, ""
+}
+
+// trimContext drops up to fuzz context lines from each end of hunk. It
+// reports false if it cannot drop that many.
+func trimContext(hunk []diffLine, fuzz int) ([]diffLine, bool) {
+	start, end := 0, len(hunk)
+	for n := 0; n < fuzz; n++ {
+		trimmed := false
+		if start < end && hunk[start].op == ' ' {
+			start++
+			trimmed = true
+		}
+		if end > start && hunk[end-1].op == ' ' {
+			end--
+			trimmed = true
+		}
+		if !trimmed {
+			return nil, false
+		}
+	}
+	return hunk[start:end], true
+}
+
+func oldLines(hunk []diffLine) []string {
+	var old []string
+	for _, l := range hunk {
+		if l.op != '+' {
+			old = append(old, l.text)
+		}
+	}
+	return old
+}
+
+func oldSide(hunk []diffLine) string {
+	return strings.Join(oldLines(hunk), "\n")
+}
+
+// nearestMatch returns the position at or after from where want matches
+// lines, closest to expected, or -1.
+func nearestMatch(lines, want []string, from, expected int, equal func(a, b string) bool) int {
+	best := -1
+	for p := from; p+len(want) <= len(lines); p++ {
+		match := true
+		for j, w := range want {
+			if !equal(lines[p+j], w) {
+				match = false
+				break
+			}
+		}
+		if match && (best < 0 || abs(p-expected) < abs(best-expected)) {
+			best = p
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
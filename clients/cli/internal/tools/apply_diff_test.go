@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func applyDiff(t *testing.T, diff string) *ToolResult {
+	t.Helper()
+	data, err := json.Marshal(applyDiffArgs{Diff: diff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := (&ApplyDiffTool{}).Execute(context.Background(), string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestApplyDiffMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	os.WriteFile(a, []byte("package a\n\nfunc One() {}\n\nfunc Two() {}\n\nfunc Three() {}\n"), 0644)
+	os.WriteFile(b, []byte("package b\n\nvar x = a.One()\n"), 0600)
+
+	// The line numbers are off, as they often are in model-written diffs.
+	result := applyDiff(t, "--- a/"+a+"\n+++ b/"+a+"\n"+
+		"@@ -1,3 +1,3 @@\n package a\n \n-func One() {}\n+func Uno() {}\n"+
+		"@@ -9,3 +9,3 @@\n func Two() {}\n \n-func Three() {}\n+func Tres() {}\n"+
+		"--- "+b+"\n+++ "+b+"\n@@ -3 +3 @@\n-var x = a.One()\n+var x = a.Uno()\n")
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "package a\n\nfunc Uno() {}\n\nfunc Two() {}\n\nfunc Tres() {}\n" {
+		t.Errorf("a.go = %q", got)
+	}
+	if got, _ := os.ReadFile(b); string(got) != "package b\n\nvar x = a.Uno()\n" {
+		t.Errorf("b.go = %q", got)
+	}
+	if info, _ := os.Stat(b); info.Mode().Perm() != 0600 {
+		t.Errorf("b.go mode = %v, want 0600", info.Mode().Perm())
+	}
+	if !strings.Contains(result.Output, "hunk 2 applied at line 5 (header said 9)") {
+		t.Errorf("output should note the moved hunk: %q", result.Output)
+	}
+}
+
+func TestApplyDiffFuzz(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.py")
+	os.WriteFile(path, []byte("def f():\n    a = 1  \n    return a\n"), 0644)
+
+	// Indentation lost and the first context line stale.
+	result := applyDiff(t, "--- "+path+"\n+++ "+path+"\n@@ -1,3 +1,3 @@\n def g():\n a = 1\n-return a\n+    return a + 1\n")
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "def f():\n    a = 1  \n    return a + 1\n" {
+		t.Errorf("file = %q", got)
+	}
+	if !strings.Contains(result.Output, "ignoring indentation with fuzz 1") {
+		t.Errorf("output should note the fuzzy match: %q", result.Output)
+	}
+}
+
+func TestApplyDiffCreateDeleteRename(t *testing.T) {
+	dir := t.TempDir()
+	created := filepath.Join(dir, "sub", "new.txt")
+	deleted := filepath.Join(dir, "old.txt")
+	from := filepath.Join(dir, "from.txt")
+	to := filepath.Join(dir, "to.txt")
+	os.WriteFile(deleted, []byte("bye\n"), 0644)
+	os.WriteFile(from, []byte("keep\nchange\n"), 0644)
+
+	result := applyDiff(t, "--- /dev/null\n+++ "+created+"\n@@ -0,0 +1,2 @@\n+hello\n+world\n"+
+		"--- "+deleted+"\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n"+
+		"--- "+from+"\n+++ "+to+"\n@@ -1,2 +1,2 @@\n keep\n-change\n+changed\n")
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if got, _ := os.ReadFile(created); string(got) != "hello\nworld\n" {
+		t.Errorf("new.txt = %q", got)
+	}
+	if _, err := os.Stat(deleted); !os.IsNotExist(err) {
+		t.Errorf("old.txt should be deleted, stat err = %v", err)
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Errorf("from.txt should be renamed away, stat err = %v", err)
+	}
+	if got, _ := os.ReadFile(to); string(got) != "keep\nchanged\n" {
+		t.Errorf("to.txt = %q", got)
+	}
+}
+
+func TestApplyDiffAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("one\n"), 0644)
+	os.WriteFile(b, []byte("two\n"), 0644)
+
+	result := applyDiff(t, "--- "+a+"\n+++ "+a+"\n@@ -1 +1 @@\n-one\n+uno\n"+
+		"--- "+b+"\n+++ "+b+"\n@@ -1 +1 @@\n-three\n+tres\n")
+	if !result.IsError {
+		t.Fatalf("expected an error, got %q", result.Output)
+	}
+	if !strings.Contains(result.Output, "hunk 1 does not match") || !strings.Contains(result.Output, "No files were changed") {
+		t.Errorf("output = %q", result.Output)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "one\n" {
+		t.Errorf("a.txt changed to %q", got)
+	}
+}
+
+func TestApplyDiffCRLF(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "win.txt")
+	os.WriteFile(path, []byte("a\r\nb\r\nc\r\n"), 0644)
+
+	result := applyDiff(t, "--- "+path+"\n+++ "+path+"\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n")
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "a\r\nB\r\nc\r\n" {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestApplyDiffInvalid(t *testing.T) {
+	for _, diff := range []string{
+		"just some text",
+		"@@ -1 +1 @@\n-a\n+b\n",
+	} {
+		if result := applyDiff(t, diff); !result.IsError || !strings.HasPrefix(result.Output, "invalid diff") {
+			t.Errorf("diff %q: got %q", diff, result.Output)
+		}
+	}
+}
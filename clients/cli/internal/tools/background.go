@@ -0,0 +1,466 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxProcessLog        = 256 * 1024 // output kept per background process
+	maxRunningProcesses  = 8
+	defaultProcessWait   = 2 * time.Second
+	defaultProcessWaitOn = 30 * time.Second // with wait_for
+	maxProcessWait       = 60 * time.Second
+	defaultLogLines      = 100
+	processStopGrace     = 5 * time.Second
+)
+
+// ProcessTable holds the background processes started during one agent
+// run. The agent loop attaches one per run and calls StopAll when the run
+// ends, so nothing the model started outlives its turn.
+type ProcessTable struct {
+	mu     sync.Mutex
+	procs  map[int]*bgProcess
+	nextID int
+	onStop []func()
+}
+
+// NewProcessTable returns an empty ProcessTable.
+func NewProcessTable() *ProcessTable {
+	return &ProcessTable{procs: make(map[int]*bgProcess)}
+}
+
+type processTableKey struct{}
+
+// WithProcessTable returns a context carrying pt.
+func WithProcessTable(ctx context.Context, pt *ProcessTable) context.Context {
+	return context.WithValue(ctx, processTableKey{}, pt)
+}
+
+// ProcessTableFrom returns the table carried by ctx, or nil.
+func ProcessTableFrom(ctx context.Context) *ProcessTable {
+	pt, _ := ctx.Value(processTableKey{}).(*ProcessTable)
+	return pt
+}
+
+// OnStop registers fn to run when StopAll is called, for other per-run
+// resources such as shell_session's shell.
+func (pt *ProcessTable) OnStop(fn func()) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.onStop = append(pt.onStop, fn)
+}
+
+// StopAll stops every running process, giving each the usual grace period
+// after SIGTERM, runs the OnStop functions and waits for them to finish.
+func (pt *ProcessTable) StopAll() {
+	pt.mu.Lock()
+	procs := make([]*bgProcess, 0, len(pt.procs))
+	for _, p := range pt.procs {
+		procs = append(procs, p)
+	}
+	onStop := pt.onStop
+	pt.onStop = nil
+	pt.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.stop()
+		}()
+	}
+	for _, fn := range onStop {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	wg.Wait()
+}
+
+func (pt *ProcessTable) get(id int) (*bgProcess, error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	p := pt.procs[id]
+	if p == nil {
+		return nil, fmt.Errorf("no background process %d; process_status lists them", id)
+	}
+	return p, nil
+}
+
+func (pt *ProcessTable) start(command, dir string) (*bgProcess, error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	running := 0
+	for _, p := range pt.procs {
+		if !p.exited() {
+			running++
+		}
+	}
+	if running >= maxRunningProcesses {
+		return nil, fmt.Errorf("%d background processes are already running; stop one with process_stop first", running)
+	}
+
+	pt.nextID++
+	p := &bgProcess{id: pt.nextID, command: command, done: make(chan struct{})}
+	p.cmd = exec.Command("sh", "-c", command)
+	p.cmd.Dir = dir
+	p.cmd.Stdout = &p.log
+	p.cmd.Stderr = &p.log
+	p.cmd.WaitDelay = time.Second
+	setProcessGroup(p.cmd)
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.started = time.Now()
+	go func() {
+		p.cmd.Wait()
+		p.ended = time.Now()
+		close(p.done)
+	}()
+	pt.procs[p.id] = p
+	return p, nil
+}
+
+// bgProcess is one background command and the tail of its output.
+type bgProcess struct {
+	id      int
+	command string
+	cmd     *exec.Cmd
+	log     tailBuffer
+	started time.Time
+	ended   time.Time     // set before done is closed
+	done    chan struct{} // closed when the process has exited
+}
+
+func (p *bgProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// state describes the process: "running for 12s" or how it ended.
+func (p *bgProcess) state() string {
+	if !p.exited() {
+		return "running for " + time.Since(p.started).Round(time.Second).String()
+	}
+	return fmt.Sprintf("exited (%s) after %s", p.cmd.ProcessState, p.ended.Sub(p.started).Round(100*time.Millisecond))
+}
+
+// stop sends SIGTERM to the process group, then SIGKILL if it has not
+// exited after processStopGrace.
+func (p *bgProcess) stop() {
+	if p.exited() {
+		return
+	}
+	terminateProcessGroup(p.cmd)
+	select {
+	case <-p.done:
+	case <-time.After(processStopGrace):
+		killProcessGroup(p.cmd)
+		<-p.done
+	}
+}
+
+// tailBuffer is an io.Writer that keeps the last maxProcessLog bytes
+// written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - maxProcessLog; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// tailLines returns the last n lines of s and how many lines it had.
+func tailLines(s string, n int) (string, int) {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return "", 0
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		return strings.Join(lines[len(lines)-n:], "\n"), len(lines)
+	}
+	return s, len(lines)
+}
+
+// processTable returns the run's table, or an error result explaining that
+// there is none.
+func processTable(ctx context.Context) (*ProcessTable, *ToolResult) {
+	pt := ProcessTableFrom(ctx)
+	if pt == nil {
+		return nil, ErrorResult("background processes are only available inside an agent run")
+	}
+	return pt, nil
+}
+
+// ProcessStartTool starts a command in the background, for servers and
+// watchers that run until stopped.
+type ProcessStartTool struct {
+	// Policy, if set, is checked before the command starts, and sets its
+	// working directory.
+	Policy *ShellPolicy
+}
+
+type processStartArgs struct {
+	Command     string `json:"command"`
+	WaitFor     string `json:"wait_for"`
+	WaitSeconds int    `json:"wait_seconds"`
+}
+
+func (t *ProcessStartTool) Name() string { return "process_start" }
+
+func (t *ProcessStartTool) Description() string {
+	return "Start a long-running command, such as a dev server or file watcher, in the background and return its id and first output. Use wait_for to wait until the output matches a pattern, e.g. \"Listening on\". Background processes are stopped when your turn ends. Check on them with process_status and process_logs, and stop them with process_stop."
+}
+
+func (t *ProcessStartTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"command":      {Type: "string", Description: "The shell command to run"},
+			"wait_for":     {Type: "string", Description: "Regular expression; return once the output matches it"},
+			"wait_seconds": {Type: "integer", Description: "How long to wait before returning (default 2, or 30 with wait_for; max 60)"},
+		},
+		Required: []string{"command"},
+	}.MustMarshal()
+}
+
+func (t *ProcessStartTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args processStartArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Command == "" {
+		return ErrorResult("command is required"), nil
+	}
+	var ready *regexp.Regexp
+	if args.WaitFor != "" {
+		var err error
+		if ready, err = regexp.Compile(args.WaitFor); err != nil {
+			return ErrorResult(fmt.Sprintf("invalid wait_for pattern: %v", err)), nil
+		}
+	}
+	pt, errResult := processTable(ctx)
+	if errResult != nil {
+		return errResult, nil
+	}
+	var dir string
+	if p := t.Policy; p != nil {
+		if reason := p.Check(args.Command); reason != "" {
+			return ErrorResult("process_start refused by policy: " + reason), nil
+		}
+		dir = p.root
+	}
+
+	wait := defaultProcessWait
+	if ready != nil {
+		wait = defaultProcessWaitOn
+	}
+	if args.WaitSeconds > 0 {
+		wait = min(time.Duration(args.WaitSeconds)*time.Second, maxProcessWait)
+	}
+
+	p, err := pt.start(args.Command, dir)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start: %v", err)), nil
+	}
+
+	// Wait for the process to exit, the pattern to match or the time to
+	// run out, whichever comes first.
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	matched := false
+wait:
+	for {
+		if ready != nil && ready.MatchString(p.log.String()) {
+			matched = true
+			break
+		}
+		select {
+		case <-p.done:
+			break wait
+		case <-deadline.C:
+			break wait
+		case <-poll.C:
+		case <-ctx.Done():
+			p.stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	output, _ := tailLines(p.log.String(), defaultLogLines)
+	if output == "" {
+		output = "(no output yet)"
+	}
+	header := fmt.Sprintf("Started process %d (pid %d), %s.", p.id, p.cmd.Process.Pid, p.state())
+	switch {
+	case p.exited():
+		return ErrorResult(fmt.Sprintf("Process %d %s:\n\n%s", p.id, p.state(), output)), nil
+	case matched:
+		header += fmt.Sprintf(" The output matched %q.", args.WaitFor)
+	case ready != nil:
+		header += fmt.Sprintf(" The output has not matched %q yet.", args.WaitFor)
+	}
+	return &ToolResult{Output: header + "\n\n" + output}, nil
+}
+
+// ProcessStatusTool lists the background processes and their state.
+type ProcessStatusTool struct{}
+
+func (t *ProcessStatusTool) Name() string { return "process_status" }
+
+func (t *ProcessStatusTool) Description() string {
+	return "List the background processes started with process_start, with their ids, state and commands."
+}
+
+func (t *ProcessStatusTool) Parameters() json.RawMessage {
+	return Schema{Type: "object", Properties: map[string]SchemaProperty{}}.MustMarshal()
+}
+
+func (t *ProcessStatusTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	pt, errResult := processTable(ctx)
+	if errResult != nil {
+		return errResult, nil
+	}
+	pt.mu.Lock()
+	procs := make([]*bgProcess, 0, len(pt.procs))
+	for _, p := range pt.procs {
+		procs = append(procs, p)
+	}
+	pt.mu.Unlock()
+	if len(procs) == 0 {
+		return &ToolResult{Output: "No background processes."}, nil
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].id < procs[j].id })
+
+	var b strings.Builder
+	for _, p := range procs {
+		fmt.Fprintf(&b, "%d\t%s\t%s\n", p.id, p.state(), p.command)
+	}
+	return &ToolResult{Output: strings.TrimSuffix(b.String(), "\n")}, nil
+}
+
+// ProcessLogsTool returns the recent output of a background process.
+type ProcessLogsTool struct{}
+
+type processIDArgs struct {
+	ID    int `json:"id"`
+	Lines int `json:"lines"`
+}
+
+func (t *ProcessLogsTool) Name() string { return "process_logs" }
+
+func (t *ProcessLogsTool) Description() string {
+	return fmt.Sprintf("Return the last lines of a background process's combined stdout and stderr (default %d).", defaultLogLines)
+}
+
+func (t *ProcessLogsTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"id":    {Type: "integer", Description: "Process id from process_start"},
+			"lines": {Type: "integer", Description: fmt.Sprintf("Number of lines from the end (default %d)", defaultLogLines)},
+		},
+		Required: []string{"id"},
+	}.MustMarshal()
+}
+
+func (t *ProcessLogsTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args processIDArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	pt, errResult := processTable(ctx)
+	if errResult != nil {
+		return errResult, nil
+	}
+	p, err := pt.get(args.ID)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	lines := args.Lines
+	if lines <= 0 {
+		lines = defaultLogLines
+	}
+
+	output, total := tailLines(p.log.String(), lines)
+	header := fmt.Sprintf("Process %d, %s", p.id, p.state())
+	switch {
+	case total == 0:
+		return &ToolResult{Output: header + ": no output yet."}, nil
+	case total > lines:
+		header += fmt.Sprintf(", last %d of %d lines", lines, total)
+	}
+	return &ToolResult{Output: header + ":\n\n" + output}, nil
+}
+
+// ProcessStopTool stops a background process.
+type ProcessStopTool struct{}
+
+func (t *ProcessStopTool) Name() string { return "process_stop" }
+
+func (t *ProcessStopTool) Description() string {
+	return "Stop a background process started with process_start: SIGTERM, then SIGKILL if it has not exited after 5 seconds. Returns how it ended and its last output."
+}
+
+func (t *ProcessStopTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"id": {Type: "integer", Description: "Process id from process_start"},
+		},
+		Required: []string{"id"},
+	}.MustMarshal()
+}
+
+func (t *ProcessStopTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args processIDArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	pt, errResult := processTable(ctx)
+	if errResult != nil {
+		return errResult, nil
+	}
+	p, err := pt.get(args.ID)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	p.stop()
+
+	output, _ := tailLines(p.log.String(), 20)
+	if output == "" {
+		output = "(no output)"
+	}
+	return &ToolResult{Output: fmt.Sprintf("Process %d %s. Last output:\n\n%s", p.id, p.state(), output)}, nil
+}
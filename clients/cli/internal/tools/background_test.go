@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func execInRun(t *testing.T, ctx context.Context, tool Tool, args any) *ToolResult {
+	t.Helper()
+	b, _ := json.Marshal(args)
+	result, err := tool.Execute(ctx, string(b))
+	if err != nil {
+		t.Fatalf("%s: %v", tool.Name(), err)
+	}
+	return result
+}
+
+func TestBackgroundProcessLifecycle(t *testing.T) {
+	procs := NewProcessTable()
+	defer procs.StopAll()
+	ctx := WithProcessTable(context.Background(), procs)
+
+	start := execInRun(t, ctx, &ProcessStartTool{}, map[string]any{
+		"command":  "echo booting; sleep 0.2; echo 'Listening on :8080'; exec sleep 60",
+		"wait_for": `Listening on :\d+`,
+	})
+	if start.IsError || !strings.HasPrefix(start.Output, "Started process 1 (pid ") ||
+		!strings.Contains(start.Output, `The output matched "Listening on :\\d+".`) ||
+		!strings.HasSuffix(start.Output, "booting\nListening on :8080") {
+		t.Fatalf("start = %+v", start)
+	}
+
+	status := execInRun(t, ctx, &ProcessStatusTool{}, map[string]any{})
+	if !strings.HasPrefix(status.Output, "1\trunning for ") {
+		t.Errorf("status = %q", status.Output)
+	}
+
+	logs := execInRun(t, ctx, &ProcessLogsTool{}, map[string]any{"id": 1, "lines": 1})
+	if !strings.HasSuffix(logs.Output, ", last 1 of 2 lines:\n\nListening on :8080") {
+		t.Errorf("logs = %q", logs.Output)
+	}
+
+	stop := execInRun(t, ctx, &ProcessStopTool{}, map[string]any{"id": 1})
+	if !strings.HasPrefix(stop.Output, "Process 1 exited (signal: terminated)") {
+		t.Errorf("stop = %q", stop.Output)
+	}
+}
+
+func TestBackgroundProcessExitsEarly(t *testing.T) {
+	procs := NewProcessTable()
+	defer procs.StopAll()
+	ctx := WithProcessTable(context.Background(), procs)
+
+	result := execInRun(t, ctx, &ProcessStartTool{}, map[string]any{"command": "echo 'port in use' >&2; exit 3"})
+	if !result.IsError || !strings.HasPrefix(result.Output, "Process 1 exited (exit status 3)") || !strings.HasSuffix(result.Output, "port in use") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestProcessTableStopAll(t *testing.T) {
+	procs := NewProcessTable()
+	ctx := WithProcessTable(context.Background(), procs)
+	// The trap makes the shell ignore SIGTERM, so StopAll has to escalate;
+	// the child sleep is in the same process group and goes too.
+	execInRun(t, ctx, &ProcessStartTool{}, map[string]any{"command": "trap '' TERM; sleep 60 & wait", "wait_seconds": 1})
+
+	p, _ := procs.get(1)
+	start := time.Now()
+	procs.StopAll()
+	if !p.exited() {
+		t.Fatal("process still running after StopAll")
+	}
+	if elapsed := time.Since(start); elapsed < processStopGrace {
+		t.Errorf("StopAll returned after %s, before the grace period", elapsed)
+	}
+}
+
+func TestBackgroundProcessNeedsRun(t *testing.T) {
+	result := execTool(t, &ProcessStartTool{}, map[string]any{"command": "sleep 1"})
+	if !result.IsError || !strings.Contains(result.Output, "only available inside an agent run") {
+		t.Errorf("result = %+v", result)
+	}
+	if result := execTool(t, &ProcessLogsTool{}, map[string]any{"id": 1}); !result.IsError {
+		t.Errorf("logs without a run = %+v", result)
+	}
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	maxSymbols         = 500
+	maxSignatureLength = 200
+)
+
+// CodeSymbolsTool lists the functions, types and classes in a source file
+// with their signatures and line ranges, so the agent can find its way
+// around a large file and then read just the part it needs.
+type CodeSymbolsTool struct{}
+
+type codeSymbolsArgs struct {
+	Path string `json:"path"`
+}
+
+// codeSymbol is one entry in a file's outline. Lines are 1-based and
+// inclusive.
+type codeSymbol struct {
+	signature string
+	start     int
+	end       int
+	depth     int // nesting level, set by nestSymbols
+}
+
+func (t *CodeSymbolsTool) Name() string { return "code_symbols" }
+
+func (t *CodeSymbolsTool) Description() string {
+	return "List the functions, methods, types and classes defined in a source file, with signatures and line ranges. Use it to navigate a large file before reading it; then file_read with offset to see a specific symbol. Supports Go (parsed exactly), Python, JavaScript/TypeScript, Rust and Java."
+}
+
+func (t *CodeSymbolsTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"path": {Type: "string", Description: "Path to the source file"},
+		},
+		Required: []string{"path"},
+	}.MustMarshal()
+}
+
+func (t *CodeSymbolsTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+	var args codeSymbolsArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Path == "" {
+		return ErrorResult("path is required"), nil
+	}
+
+	src, err := os.ReadFile(args.Path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err)), nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(args.Path))
+	var symbols []codeSymbol
+	var note string
+	if ext == ".go" {
+		symbols, err = goSymbols(args.Path, src)
+		if err != nil {
+			note = fmt.Sprintf("(the file has syntax errors, so the outline may be incomplete: %v)\n", err)
+		}
+	} else {
+		lang := outlineLanguages[ext]
+		if lang == nil {
+			return ErrorResult(fmt.Sprintf("code_symbols does not support %q files; use grep_search to find definitions", ext)), nil
+		}
+		symbols = lang.outline(strings.Split(string(src), "\n"))
+	}
+
+	return &ToolResult{Output: note + formatSymbols(args.Path, symbols)}, nil
+}
+
+func formatSymbols(path string, symbols []codeSymbol) string {
+	if len(symbols) == 0 {
+		return fmt.Sprintf("%s: no symbols found", path)
+	}
+	nestSymbols(symbols)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d symbols\n", path, len(symbols))
+	for i, s := range symbols {
+		if i == maxSymbols {
+			fmt.Fprintf(&b, "… %d more symbols", len(symbols)-maxSymbols)
+			break
+		}
+		lines := fmt.Sprintf("%d", s.start)
+		if s.end > s.start {
+			lines = fmt.Sprintf("%d-%d", s.start, s.end)
+		}
+		sig := s.signature
+		if len(sig) > maxSignatureLength {
+			sig = sig[:maxSignatureLength] + "…"
+		}
+		fmt.Fprintf(&b, "%-10s %s%s\n", lines, strings.Repeat("  ", s.depth), sig)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// nestSymbols sorts symbols by position and sets each one's depth from how
+// many others enclose it.
+func nestSymbols(symbols []codeSymbol) {
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].start < symbols[j].start })
+	var open []int // ends of the enclosing symbols
+	for i := range symbols {
+		for len(open) > 0 && symbols[i].start > open[len(open)-1] {
+			open = open[:len(open)-1]
+		}
+		symbols[i].depth = len(open)
+		if symbols[i].end > symbols[i].start {
+			open = append(open, symbols[i].end)
+		}
+	}
+}
+
+// goSymbols outlines a Go file from its syntax tree. Like go/parser, it
+// returns what it could parse along with any error.
+func goSymbols(path string, src []byte) ([]codeSymbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, err
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var symbols []codeSymbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sig := *d
+			sig.Doc, sig.Body = nil, nil
+			symbols = append(symbols, codeSymbol{signature: goNode(fset, &sig), start: line(d.Pos()), end: line(d.End())})
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, codeSymbol{signature: "type " + s.Name.Name + goTypeSummary(fset, s), start: line(s.Pos()), end: line(s.End())})
+					if iface, ok := s.Type.(*ast.InterfaceType); ok {
+						for _, m := range iface.Methods.List {
+							if len(m.Names) == 0 {
+								continue // embedded interface
+							}
+							symbols = append(symbols, codeSymbol{signature: m.Names[0].Name + strings.TrimPrefix(goNode(fset, m.Type), "func"), start: line(m.Pos()), end: line(m.End())})
+						}
+					}
+				case *ast.ValueSpec:
+					names := make([]string, len(s.Names))
+					for i, n := range s.Names {
+						names[i] = n.Name
+					}
+					sig := d.Tok.String() + " " + strings.Join(names, ", ")
+					if s.Type != nil {
+						sig += " " + goNode(fset, s.Type)
+					}
+					symbols = append(symbols, codeSymbol{signature: sig, start: line(s.Pos()), end: line(s.End())})
+				}
+			}
+		}
+	}
+	return symbols, err
+}
+
+// goTypeSummary describes a type's definition briefly: "struct" or
+// "interface" for those (their members are listed separately or not at
+// all), the full type otherwise.
+func goTypeSummary(fset *token.FileSet, s *ast.TypeSpec) string {
+	prefix := " "
+	if s.TypeParams != nil {
+		var params []string
+		for _, f := range s.TypeParams.List {
+			names := make([]string, len(f.Names))
+			for i, n := range f.Names {
+				names[i] = n.Name
+			}
+			params = append(params, strings.Join(names, ", ")+" "+goNode(fset, f.Type))
+		}
+		prefix = "[" + strings.Join(params, ", ") + "] "
+	}
+	if s.Assign.IsValid() {
+		prefix += "= "
+	}
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return prefix + "struct"
+	case *ast.InterfaceType:
+		return prefix + "interface"
+	}
+	return prefix + goNode(fset, s.Type)
+}
+
+func goNode(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
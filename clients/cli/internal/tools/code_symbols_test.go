@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func codeSymbols(t *testing.T, name, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(src), 0644)
+	result := execTool(t, &CodeSymbolsTool{}, map[string]any{"path": path})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	return result.Output
+}
+
+func assertOutline(t *testing.T, output string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(output, w) {
+			t.Errorf("outline missing %q:\n%s", w, output)
+		}
+	}
+}
+
+func TestCodeSymbolsGo(t *testing.T) {
+	out := codeSymbols(t, "a.go", `package a
+
+const (
+	A = iota
+	B
+)
+
+var Default Config
+
+type Config struct {
+	Name string
+}
+
+type Store[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	io.Closer
+}
+
+// Load reads c.
+func (c *Config) Load(path string) error {
+	return nil
+}
+
+func New() *Config { return &Config{} }
+`)
+	assertOutline(t, out,
+		"a.go: 8 symbols",
+		"4          const A\n",
+		"8          var Default Config\n",
+		"10-12      type Config struct\n",
+		"14-17      type Store[K comparable, V any] interface\n",
+		"15           Get(key K) (V, bool)\n",
+		"20-22      func (c *Config) Load(path string) error\n",
+		"24         func New() *Config",
+	)
+}
+
+func TestCodeSymbolsPython(t *testing.T) {
+	out := codeSymbols(t, "m.py", `import os
+
+
+class Store:
+    """Keeps things."""
+
+    def get(self,
+            key):
+        return self.items[key]
+
+    # helpers
+
+    async def close(self):
+        pass
+
+
+def main():
+    Store()
+`)
+	assertOutline(t, out,
+		"4-14       class Store\n",
+		"7-9          def get(self,\n",
+		"13-14        async def close(self)\n",
+		"17-18      def main()",
+	)
+}
+
+func TestCodeSymbolsTypeScript(t *testing.T) {
+	out := codeSymbols(t, "s.ts", `export interface Item {
+  id: string;
+}
+
+export class Cache {
+  private items = new Map<string, Item>();
+
+  get(id: string): Item | undefined {
+    if (id === "}") {
+      return undefined;
+    }
+    return this.items.get(id); // }
+  }
+}
+
+export const key = (item: Item): string => {
+  return item.id;
+};
+`)
+	assertOutline(t, out,
+		"1-3        export interface Item\n",
+		"5-14       export class Cache\n",
+		"8-13         get(id: string): Item | undefined\n",
+		"16-18      export const key = (item: Item): string =>",
+	)
+	if strings.Contains(out, "if (id") {
+		t.Errorf("control flow listed as a method:\n%s", out)
+	}
+}
+
+func TestCodeSymbolsRust(t *testing.T) {
+	out := codeSymbols(t, "lib.rs", `pub struct Parser<'a> {
+    input: &'a str,
+}
+
+impl<'a> Parser<'a> {
+    pub fn next(&mut self) -> Option<char> {
+        let c = '{';
+        None
+    }
+}
+`)
+	assertOutline(t, out,
+		"1-3        pub struct Parser<'a>\n",
+		"5-10       impl<'a> Parser<'a>\n",
+		"6-9          pub fn next(&mut self) -> Option<char>",
+	)
+}
+
+func TestCodeSymbolsUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0644)
+	result := execTool(t, &CodeSymbolsTool{}, map[string]any{"path": path})
+	if !result.IsError || !strings.Contains(result.Output, "does not support") {
+		t.Errorf("result = %+v", result)
+	}
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// SetCompact makes APITools send compact schemas: tool and parameter
+// descriptions cut to their first sentence, and examples and titles
+// dropped. The definitions go with every request, so this trades some
+// guidance for a smaller prompt on small context windows.
+func (r *Registry) SetCompact(on bool) {
+	r.compact = on
+}
+
+// ShortDescription returns the first sentence of desc, which for the
+// built-in tools says what the tool does; later sentences add detail and
+// examples.
+func ShortDescription(desc string) string {
+	desc = strings.TrimSpace(desc)
+	if i := strings.IndexByte(desc, '\n'); i >= 0 {
+		desc = strings.TrimSpace(desc[:i])
+	}
+	for i := 0; i+2 < len(desc); i++ {
+		// A sentence ends at ". " before a capital, which skips "e.g. x".
+		if desc[i] == '.' && desc[i+1] == ' ' && unicode.IsUpper(rune(desc[i+2])) {
+			return desc[:i+1]
+		}
+	}
+	return desc
+}
+
+// compactSchema shortens the descriptions in a JSON schema and drops its
+// examples and titles. params is returned unchanged if it does not parse.
+func compactSchema(params json.RawMessage) json.RawMessage {
+	var schema any
+	if json.Unmarshal(params, &schema) != nil {
+		return params
+	}
+	out, err := json.Marshal(compactValue(schema))
+	if err != nil {
+		return params
+	}
+	return out
+}
+
+func compactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, val := range v {
+			switch key {
+			case "properties":
+				// Keys here are parameter names, not keywords.
+				if props, ok := val.(map[string]any); ok {
+					for name, prop := range props {
+						props[name] = compactValue(prop)
+					}
+				}
+			case "examples", "example", "title":
+				delete(v, key)
+			case "description":
+				if s, ok := val.(string); ok {
+					v[key] = ShortDescription(s)
+				}
+			default:
+				v[key] = compactValue(val)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = compactValue(v[i])
+		}
+	}
+	return v
+}
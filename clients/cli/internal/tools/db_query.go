@@ -0,0 +1,274 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dbQueryTimeout     = 30 * time.Second
+	defaultDBQueryRows = 100
+	maxDBQueryRows     = 1000
+	maxDBCellWidth     = 80
+	// Field and record separators for the CLIs' unaligned output, chosen
+	// because they do not occur in ordinary data.
+	dbFieldSep  = "\x1f"
+	dbRecordSep = "\x1e"
+)
+
+// DBQueryTool runs read-only SQL against a SQLite file, through the
+// sqlite3 CLI in read-only safe mode, or a configured Postgres database,
+// through psql in a read-only transaction, and returns the rows as an
+// aligned table.
+type DBQueryTool struct {
+	// Connections maps names the model can use to Postgres connection
+	// strings (postgres://…), so credentials stay out of the conversation.
+	Connections map[string]string
+}
+
+type dbQueryArgs struct {
+	Database string `json:"database"`
+	Query    string `json:"query"`
+	MaxRows  int    `json:"max_rows"`
+}
+
+func (t *DBQueryTool) Name() string { return "db_query" }
+
+func (t *DBQueryTool) Description() string {
+	desc := fmt.Sprintf("Run a read-only SQL query (SELECT, WITH, EXPLAIN, PRAGMA or VALUES) and return the rows as a table, at most %d by default. database is the path to a SQLite file", defaultDBQueryRows)
+	if len(t.Connections) > 0 {
+		names := make([]string, 0, len(t.Connections))
+		for name := range t.Connections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		desc += " or one of these configured Postgres databases: " + strings.Join(names, ", ")
+	}
+	return desc + ". One statement per call. To see a SQLite schema, query sqlite_master."
+}
+
+func (t *DBQueryTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"database": {Type: "string", Description: "SQLite file path, or the name of a configured Postgres database"},
+			"query":    {Type: "string", Description: "A single read-only SQL statement"},
+			"max_rows": {Type: "integer", Description: fmt.Sprintf("Maximum rows to return (default %d, max %d)", defaultDBQueryRows, maxDBQueryRows)},
+		},
+		Required: []string{"database", "query"},
+	}.MustMarshal()
+}
+
+func (t *DBQueryTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args dbQueryArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Database == "" {
+		return ErrorResult("database is required"), nil
+	}
+	query, err := readOnlyQuery(args.Query)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	maxRows := args.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultDBQueryRows
+	}
+	maxRows = min(maxRows, maxDBQueryRows)
+
+	// Fetch one row more than asked for, to know whether there are more.
+	// The newline ends any trailing -- comment before the parenthesis.
+	if limitable(query) {
+		query = fmt.Sprintf("SELECT * FROM (%s\n) AS q LIMIT %d", query, maxRows+1)
+	}
+
+	var argv, env []string
+	if dsn, ok := t.Connections[args.Database]; ok {
+		argv = []string{"psql", dsn, "-X", "-q", "-A", "-F", dbFieldSep, "-R", dbRecordSep,
+			"-P", "footer=off", "-P", "null=NULL", "-v", "ON_ERROR_STOP=1", "-c", query}
+		env = append(os.Environ(), "PGOPTIONS=-c default_transaction_read_only=on")
+	} else {
+		if _, err := os.Stat(args.Database); err != nil {
+			return ErrorResult(fmt.Sprintf("database %q is not a SQLite file or a configured connection: %v", args.Database, err)), nil
+		}
+		argv = []string{"sqlite3", "-readonly", "-safe", "-bail", "-header", "-list",
+			"-separator", dbFieldSep, "-newline", dbRecordSep, "-nullvalue", "NULL", args.Database, query}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, dbQueryTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, argv[0], argv[1:]...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return ErrorResult(fmt.Sprintf("db_query needs the %s command, which is not installed", argv[0])), nil
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			return ErrorResult(fmt.Sprintf("query timed out after %s", dbQueryTimeout)), nil
+		}
+		return ErrorResult(fmt.Sprintf("query failed: %s", strings.TrimSpace(stderr.String()+" "+err.Error()))), nil
+	}
+
+	return &ToolResult{Output: formatRows(stdout.String(), maxRows)}, nil
+}
+
+// readOnlyQuery trims query and checks that it is a single statement of a
+// kind that only reads. The databases are also opened read-only; this
+// check gives a clearer error and keeps out CLI meta-commands.
+func readOnlyQuery(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	for strings.HasSuffix(query, ";") {
+		query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+	}
+	if query == "" {
+		return "", errors.New("query is required")
+	}
+	if hasStatementSeparator(query) {
+		return "", errors.New("run one statement per call")
+	}
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == ')'
+	})
+	if len(words) == 0 {
+		return "", errors.New("query is required")
+	}
+	first := strings.ToUpper(words[0])
+	switch first {
+	case "SELECT", "WITH", "EXPLAIN", "PRAGMA", "VALUES", "SHOW", "TABLE":
+		return query, nil
+	}
+	return "", fmt.Errorf("db_query only runs read-only statements (SELECT, WITH, EXPLAIN, PRAGMA, VALUES, SHOW, TABLE), not %s", first)
+}
+
+// hasStatementSeparator reports whether query has a ';' outside string
+// literals, quoted identifiers and comments.
+func hasStatementSeparator(query string) bool {
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				return false
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i:], "*/"); end >= 0 {
+				i += end + 1
+			} else {
+				return false
+			}
+		case c == ';':
+			return true
+		}
+	}
+	return false
+}
+
+// limitable reports whether query can be wrapped in a subquery to cap its
+// rows in the database rather than after fetching them all.
+func limitable(query string) bool {
+	upper := strings.ToUpper(query)
+	return strings.HasPrefix(upper, "SELECT") || strings.HasPrefix(upper, "WITH") || strings.HasPrefix(upper, "VALUES")
+}
+
+// formatRows renders header-first unaligned CLI output as an aligned table
+// of at most maxRows rows.
+func formatRows(output string, maxRows int) string {
+	output = strings.TrimSuffix(strings.TrimRight(output, "\n"), dbRecordSep)
+	if output == "" {
+		return "(no rows)"
+	}
+	records := strings.Split(output, dbRecordSep)
+	var rows [][]string
+	for _, r := range records {
+		fields := strings.Split(r, dbFieldSep)
+		for i, f := range fields {
+			fields[i] = dbCell(f)
+		}
+		rows = append(rows, fields)
+	}
+
+	header, data := rows[0], rows[1:]
+	more := len(data) > maxRows
+	if more {
+		data = data[:maxRows]
+	}
+
+	widths := make([]int, len(header))
+	for _, r := range append([][]string{header}, data...) {
+		for i, f := range r {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(f))
+			}
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(r []string) {
+		for i, f := range r {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(f)
+			if i < len(r)-1 && i < len(widths) {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(f)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	writeRow(header)
+	for i, w := range widths {
+		if i > 0 {
+			b.WriteString("-+-")
+		}
+		b.WriteString(strings.Repeat("-", w))
+	}
+	b.WriteString("\n")
+	for _, r := range data {
+		writeRow(r)
+	}
+
+	switch {
+	case more:
+		fmt.Fprintf(&b, "(first %d rows; there are more, narrow the query or raise max_rows)", maxRows)
+	case len(data) == 1:
+		b.WriteString("(1 row)")
+	default:
+		b.WriteString("(" + strconv.Itoa(len(data)) + " rows)")
+	}
+	return b.String()
+}
+
+// dbCell makes a value fit on one table line.
+func dbCell(s string) string {
+	s = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\t", `\t`).Replace(s)
+	if utf8.RuneCountInString(s) > maxDBCellWidth {
+		s = string([]rune(s)[:maxDBCellWidth-1]) + "…"
+	}
+	return s
+}
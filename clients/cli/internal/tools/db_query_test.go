@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sqliteDB(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	path := filepath.Join(t.TempDir(), "app.db")
+	setup := `CREATE TABLE users (id INTEGER, name TEXT, bio TEXT);
+INSERT INTO users VALUES (1, 'alice', 'likes
+newlines'), (2, 'bob', NULL), (3, 'carol', 'x');`
+	if out, err := exec.Command("sqlite3", path, setup).CombinedOutput(); err != nil {
+		t.Fatalf("sqlite3: %v\n%s", err, out)
+	}
+	return path
+}
+
+func TestDBQuerySQLite(t *testing.T) {
+	db := sqliteDB(t)
+
+	result := execTool(t, &DBQueryTool{}, map[string]any{"database": db, "query": "SELECT id, name, bio FROM users ORDER BY id;"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	want := `id | name  | bio
+---+-------+----------------
+1  | alice | likes\nnewlines
+2  | bob   | NULL
+3  | carol | x
+(3 rows)`
+	if result.Output != want {
+		t.Errorf("output =\n%s\nwant\n%s", result.Output, want)
+	}
+
+	capped := execTool(t, &DBQueryTool{}, map[string]any{"database": db, "query": "SELECT name FROM users", "max_rows": 2})
+	if !strings.Contains(capped.Output, "(first 2 rows; there are more") || strings.Contains(capped.Output, "carol") {
+		t.Errorf("capped output = %q", capped.Output)
+	}
+
+	empty := execTool(t, &DBQueryTool{}, map[string]any{"database": db, "query": "SELECT * FROM users WHERE id > 10"})
+	if empty.Output != "(no rows)" {
+		t.Errorf("empty output = %q", empty.Output)
+	}
+}
+
+func TestDBQueryReadOnly(t *testing.T) {
+	db := sqliteDB(t)
+
+	for _, query := range []string{
+		"DELETE FROM users",
+		"SELECT 1; DROP TABLE users",
+		".shell echo hi",
+		"SELECT writefile('/tmp/x', 'y')",
+	} {
+		result := execTool(t, &DBQueryTool{}, map[string]any{"database": db, "query": query})
+		if !result.IsError {
+			t.Errorf("%q was allowed: %s", query, result.Output)
+		}
+	}
+
+	// Semicolons inside literals and comments are not separators.
+	result := execTool(t, &DBQueryTool{}, map[string]any{"database": db, "query": "SELECT ';' AS s -- trailing; comment\n"})
+	if result.IsError {
+		t.Errorf("unexpected error: %s", result.Output)
+	}
+}
+
+func TestReadOnlyQueryWithoutWords(t *testing.T) {
+	for _, query := range []string{"(", "()", " ( ;"} {
+		if _, err := readOnlyQuery(query); err == nil || err.Error() != "query is required" {
+			t.Errorf("readOnlyQuery(%q) error = %v, want \"query is required\"", query, err)
+		}
+	}
+}
+
+func TestDBQueryUnknownDatabase(t *testing.T) {
+	result := execTool(t, &DBQueryTool{Connections: map[string]string{"app": "postgres://x"}}, map[string]any{"database": "missing.db", "query": "SELECT 1"})
+	if !result.IsError || !strings.Contains(result.Output, "not a SQLite file or a configured connection") {
+		t.Errorf("result = %+v", result)
+	}
+}
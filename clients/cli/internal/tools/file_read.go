@@ -7,7 +7,9 @@ import (
 	"os"
 )
 
-const maxFileReadBytes = 32 * 1024 // 32KB
+// maxFileReadBytes bounds one read. DefaultRegistry pages file_read's
+// output, so the model sees far less of a large file at a time.
+const maxFileReadBytes = 1 << 20 // 1MB
 
 // FileReadTool reads file contents.
 type FileReadTool struct{}
@@ -1,44 +1,56 @@
 package tools
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 const maxFindResults = 200
 
-// FindFilesTool finds files by name pattern.
+// FindFilesTool finds files by name or path glob, honouring .gitignore.
 type FindFilesTool struct{}
 
 type findFilesArgs struct {
 	Pattern    string `json:"pattern"`
 	Path       string `json:"path"`
 	MaxResults int    `json:"max_results"`
+	MaxDepth   int    `json:"max_depth"`
+}
+
+type foundFile struct {
+	rel     string
+	modTime time.Time
 }
 
 func (t *FindFilesTool) Name() string { return "find_files" }
 
 func (t *FindFilesTool) Description() string {
-	return "Find files by name pattern. Searches recursively from the given path. Pattern uses glob syntax (e.g. \"*.go\", \"*_test.go\", \"Makefile\"). Returns matching file paths."
+	return "Find files by glob pattern. Patterns without a slash match file names (e.g. \"*.go\", \"Makefile\"); patterns with a slash match paths relative to the search root and support ** (e.g. \"**/*_test.go\", \"cmd/**/main.go\"). Files ignored by .gitignore are skipped. Returns relative paths, most recently modified first."
 }
 
 func (t *FindFilesTool) Parameters() json.RawMessage {
 	return Schema{
 		Type: "object",
 		Properties: map[string]SchemaProperty{
-			"pattern":     {Type: "string", Description: "Glob pattern to match filenames (e.g. \"*.go\", \"*.py\", \"Dockerfile*\")"},
+			"pattern":     {Type: "string", Description: "Glob pattern (e.g. \"*.go\", \"**/*_test.go\", \"internal/**/*.py\")"},
 			"path":        {Type: "string", Description: "Directory to search in (default: \".\")"},
 			"max_results": {Type: "integer", Description: "Maximum number of results (default: 100)"},
+			"max_depth":   {Type: "integer", Description: "Maximum directory depth to descend, 1 = only the search root (default: unlimited)"},
 		},
 		Required: []string{"pattern"},
 	}.MustMarshal()
 }
 
-func (t *FindFilesTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+func (t *FindFilesTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
 	var args findFilesArgs
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
 		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
@@ -56,44 +68,217 @@ func (t *FindFilesTool) Execute(_ context.Context, arguments string) (*ToolResul
 		args.MaxResults = maxFindResults
 	}
 
-	var b strings.Builder
-	count := 0
+	pattern := strings.TrimPrefix(filepath.ToSlash(args.Pattern), "./")
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %v", err)), nil
+	}
+	matchPath := strings.Contains(pattern, "/")
+
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err)), nil
+	}
+	if !info.IsDir() {
+		return ErrorResult(fmt.Sprintf("%s is not a directory", args.Path)), nil
+	}
+
+	ignore := &gitignore{}
+	var found []foundFile
 
-	err := filepath.Walk(args.Path, func(path string, info os.FileInfo, err error) error {
+	err = filepath.WalkDir(args.Path, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
-		if count >= args.MaxResults {
-			return filepath.SkipAll
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, relErr := filepath.Rel(args.Path, p)
+		if relErr != nil {
+			return nil
 		}
-		if info.IsDir() {
-			name := info.Name()
-			if name == ".git" || name == "node_modules" || name == "vendor" || name == "__pycache__" || name == ".venv" || name == "venv" {
-				return filepath.SkipDir
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." {
+				if skipDirs[d.Name()] || ignore.Ignored(rel, true) {
+					return filepath.SkipDir
+				}
+				if args.MaxDepth > 0 && strings.Count(rel, "/")+1 >= args.MaxDepth {
+					return filepath.SkipDir
+				}
 			}
+			ignore.Load(p, rel)
+			return nil
+		}
+
+		if ignore.Ignored(rel, false) {
+			return nil
+		}
+
+		var matched bool
+		if matchPath {
+			matched = matchGlob(pattern, rel)
+		} else {
+			matched, _ = path.Match(pattern, d.Name())
+		}
+		if !matched {
 			return nil
 		}
 
-		matched, _ := filepath.Match(args.Pattern, info.Name())
-		if matched {
-			fmt.Fprintf(&b, "%s\n", path)
-			count++
+		fi, infoErr := d.Info()
+		if infoErr != nil {
+			return nil
 		}
+		found = append(found, foundFile{rel: rel, modTime: fi.ModTime()})
 		return nil
 	})
 
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("search failed: %v", err)), nil
 	}
 
-	if count == 0 {
+	if len(found) == 0 {
 		return &ToolResult{Output: fmt.Sprintf("No files found matching %q in %s", args.Pattern, args.Path)}, nil
 	}
 
-	output := b.String()
-	if count >= args.MaxResults {
-		output += fmt.Sprintf("[showing first %d results]", args.MaxResults)
+	sort.SliceStable(found, func(i, j int) bool {
+		if !found[i].modTime.Equal(found[j].modTime) {
+			return found[i].modTime.After(found[j].modTime)
+		}
+		return found[i].rel < found[j].rel
+	})
+
+	total := len(found)
+	if total > args.MaxResults {
+		found = found[:args.MaxResults]
+	}
+
+	var b strings.Builder
+	for _, f := range found {
+		fmt.Fprintf(&b, "%s\n", f.rel)
+	}
+	if total > args.MaxResults {
+		fmt.Fprintf(&b, "[showing %d of %d results]", args.MaxResults, total)
+	}
+
+	return &ToolResult{Output: b.String()}, nil
+}
+
+// skipDirs are never descended into, regardless of .gitignore.
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+	".venv":        true,
+	"venv":         true,
+}
+
+// matchGlob reports whether the slash-separated name matches pattern.
+// Each path segment is matched with path.Match; a "**" segment matches
+// zero or more whole segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// gitignore accumulates rules from the .gitignore files found while walking.
+// It covers the common subset of the format: comments, negation, anchored
+// patterns, directory-only patterns and ** globs.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	base    string // directory containing the .gitignore, relative to the search root
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// Load reads dir/.gitignore, if present. rel is dir relative to the search root.
+func (g *gitignore) Load(dir, rel string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: rel}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.HasPrefix(line, "/") {
+			line = line[1:]
+		} else if !strings.Contains(line, "/") {
+			// Unanchored patterns match at any depth below the .gitignore.
+			line = "**/" + line
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		g.rules = append(g.rules, rule)
 	}
+}
 
-	return &ToolResult{Output: output}, nil
+// Ignored reports whether rel (relative to the search root) is excluded.
+// Later rules override earlier ones, so negations can re-include paths.
+func (g *gitignore) Ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if r.base != "." {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if matchGlob(r.pattern, name) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
 }
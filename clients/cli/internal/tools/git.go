@@ -0,0 +1,475 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxGitOutput          = 32 * 1024 // 32KB
+	gitTimeout            = 15 * time.Second
+	defaultGitLogCount    = 20
+	maxGitLogCount        = 200
+	maxGitStatusEntries   = 300
+	defaultGitBlameLines  = 200
+	gitCommitSubjectWidth = 72
+)
+
+// runGit runs git with args in the working directory and returns its
+// stdout. A failure's error includes what git printed to stderr.
+func runGit(ctx context.Context, args ...string) (string, error) {
+	runCtx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, "git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// gitFailed turns a runGit error into the tool's result, or into ctx's
+// error if the call was cancelled.
+func gitFailed(ctx context.Context, subcommand string, err error) (*ToolResult, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return ErrorResult(fmt.Sprintf("git %s failed: %v", subcommand, err)), nil
+}
+
+// boundGitOutput cuts output to maxGitOutput at a line boundary, saying
+// how much was left out and how to narrow the request.
+func boundGitOutput(output, hint string) string {
+	if len(output) <= maxGitOutput {
+		return output
+	}
+	cut := output[:maxGitOutput]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i+1]
+	}
+	return fmt.Sprintf("%s[truncated: %d more bytes; %s]", cut, len(output)-len(cut), hint)
+}
+
+// checkRef rejects revisions that git would parse as options.
+func checkRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	return nil
+}
+
+func marshalIndent(v any) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+// GitStatusTool reports the branch and the working tree's changes as JSON.
+type GitStatusTool struct{}
+
+type gitStatusArgs struct {
+	Path string `json:"path"`
+}
+
+type gitFileStatus struct {
+	Status string `json:"status"`
+	Path   string `json:"path"`
+	From   string `json:"from,omitempty"`
+}
+
+type gitStatus struct {
+	Branch     string          `json:"branch"`
+	Upstream   string          `json:"upstream,omitempty"`
+	Ahead      int             `json:"ahead,omitempty"`
+	Behind     int             `json:"behind,omitempty"`
+	Staged     []gitFileStatus `json:"staged"`
+	Unstaged   []gitFileStatus `json:"unstaged"`
+	Untracked  []string        `json:"untracked"`
+	Conflicted []string        `json:"conflicted,omitempty"`
+	Omitted    int             `json:"omitted,omitempty"`
+}
+
+func (t *GitStatusTool) Name() string { return "git_status" }
+
+func (t *GitStatusTool) Description() string {
+	return "Show the current branch, its upstream and ahead/behind counts, and the staged, unstaged, untracked and conflicted files, as JSON. Status letters: M modified, A added, D deleted, R renamed, C copied, T type changed."
+}
+
+func (t *GitStatusTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"path": {Type: "string", Description: "Limit to this file or directory (default: whole repository)"},
+		},
+	}.MustMarshal()
+}
+
+func (t *GitStatusTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args gitStatusArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+
+	gitArgs := []string{"status", "--porcelain=v1", "--branch", "-z"}
+	if args.Path != "" {
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+	out, err := runGit(ctx, gitArgs...)
+	if err != nil {
+		return gitFailed(ctx, "status", err)
+	}
+	return &ToolResult{Output: marshalIndent(parseGitStatus(out))}, nil
+}
+
+// parseGitStatus parses `git status --porcelain=v1 --branch -z`.
+func parseGitStatus(out string) gitStatus {
+	s := gitStatus{Staged: []gitFileStatus{}, Unstaged: []gitFileStatus{}, Untracked: []string{}}
+	fields := strings.Split(out, "\x00")
+	entries := 0
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.HasPrefix(f, "## ") {
+			s.parseBranch(f[3:])
+			continue
+		}
+		if len(f) < 4 {
+			continue
+		}
+		x, y, path := f[0], f[1], f[3:]
+		var from string
+		if x == 'R' || x == 'C' {
+			// The source path follows as its own field.
+			if i+1 < len(fields) {
+				from = fields[i+1]
+				i++
+			}
+		}
+		if entries++; entries > maxGitStatusEntries {
+			s.Omitted++
+			continue
+		}
+		switch {
+		case x == '?' && y == '?':
+			s.Untracked = append(s.Untracked, path)
+		case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+			s.Conflicted = append(s.Conflicted, path)
+		default:
+			if x != ' ' {
+				s.Staged = append(s.Staged, gitFileStatus{Status: string(x), Path: path, From: from})
+			}
+			if y != ' ' {
+				s.Unstaged = append(s.Unstaged, gitFileStatus{Status: string(y), Path: path})
+			}
+		}
+	}
+	return s
+}
+
+// parseBranch parses a branch header such as
+// "main...origin/main [ahead 1, behind 2]" or "No commits yet on main".
+func (s *gitStatus) parseBranch(h string) {
+	if rest, ok := strings.CutPrefix(h, "No commits yet on "); ok {
+		s.Branch = rest
+		return
+	}
+	h, counts, _ := strings.Cut(h, " [")
+	s.Branch, s.Upstream, _ = strings.Cut(h, "...")
+	for _, c := range strings.Split(strings.TrimSuffix(counts, "]"), ", ") {
+		if n, ok := strings.CutPrefix(c, "ahead "); ok {
+			s.Ahead, _ = strconv.Atoi(n)
+		} else if n, ok := strings.CutPrefix(c, "behind "); ok {
+			s.Behind, _ = strconv.Atoi(n)
+		}
+	}
+}
+
+// GitDiffTool shows changes as a unified diff.
+type GitDiffTool struct{}
+
+type gitDiffArgs struct {
+	Path   string `json:"path"`
+	Staged bool   `json:"staged"`
+	Ref    string `json:"ref"`
+	Stat   bool   `json:"stat"`
+}
+
+func (t *GitDiffTool) Name() string { return "git_diff" }
+
+func (t *GitDiffTool) Description() string {
+	return "Show changes as a unified diff: unstaged changes by default, staged changes with staged=true, or the working tree against a commit or range (e.g. \"HEAD~3\" or \"main..feature\") with ref. Use stat=true for a per-file summary first when the diff may be large."
+}
+
+func (t *GitDiffTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"path":   {Type: "string", Description: "Limit the diff to this file or directory"},
+			"staged": {Type: "boolean", Description: "Show staged changes instead of unstaged ones"},
+			"ref":    {Type: "string", Description: "Commit or range to diff against"},
+			"stat":   {Type: "boolean", Description: "Only show a summary of changed files and line counts"},
+		},
+	}.MustMarshal()
+}
+
+func (t *GitDiffTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args gitDiffArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if err := checkRef(args.Ref); err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+
+	gitArgs := []string{"diff", "--no-color", "--no-ext-diff"}
+	if args.Staged {
+		gitArgs = append(gitArgs, "--cached")
+	}
+	if args.Stat {
+		gitArgs = append(gitArgs, "--stat")
+	}
+	if args.Ref != "" {
+		gitArgs = append(gitArgs, args.Ref)
+	}
+	if args.Path != "" {
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+	out, err := runGit(ctx, gitArgs...)
+	if err != nil {
+		return gitFailed(ctx, "diff", err)
+	}
+	if out == "" {
+		return &ToolResult{Output: "(no changes)"}, nil
+	}
+	return &ToolResult{Output: boundGitOutput(out, "use stat=true for a summary, then path to see one file")}, nil
+}
+
+// GitLogTool lists commits as JSON.
+type GitLogTool struct{}
+
+type gitLogArgs struct {
+	Count int    `json:"count"`
+	Ref   string `json:"ref"`
+	Path  string `json:"path"`
+}
+
+type gitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+func (t *GitLogTool) Name() string { return "git_log" }
+
+func (t *GitLogTool) Description() string {
+	return fmt.Sprintf("List recent commits, newest first, as JSON with hash, author, date and subject. Optionally start from a ref or range and only include commits touching a path. Returns %d commits by default, at most %d.", defaultGitLogCount, maxGitLogCount)
+}
+
+func (t *GitLogTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"count": {Type: "integer", Description: fmt.Sprintf("Number of commits (default %d)", defaultGitLogCount)},
+			"ref":   {Type: "string", Description: "Branch, commit or range to list (default HEAD)"},
+			"path":  {Type: "string", Description: "Only commits that touch this file or directory"},
+		},
+	}.MustMarshal()
+}
+
+func (t *GitLogTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args gitLogArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if err := checkRef(args.Ref); err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	count := args.Count
+	if count <= 0 {
+		count = defaultGitLogCount
+	}
+	count = min(count, maxGitLogCount)
+
+	gitArgs := []string{"log", "-n", strconv.Itoa(count), "--format=%h%x1f%an%x1f%as%x1f%s"}
+	if args.Ref != "" {
+		gitArgs = append(gitArgs, args.Ref)
+	}
+	if args.Path != "" {
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+	out, err := runGit(ctx, gitArgs...)
+	if err != nil {
+		return gitFailed(ctx, "log", err)
+	}
+
+	commits := []gitCommit{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) != 4 {
+			continue
+		}
+		commits = append(commits, gitCommit{Hash: f[0], Author: f[1], Date: f[2], Subject: f[3]})
+	}
+	return &ToolResult{Output: marshalIndent(commits)}, nil
+}
+
+// GitBlameTool shows who last changed each line of a file.
+type GitBlameTool struct{}
+
+type gitBlameArgs struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+func (t *GitBlameTool) Name() string { return "git_blame" }
+
+func (t *GitBlameTool) Description() string {
+	return fmt.Sprintf("Show the commit, author and date that last changed each line of a file, one tab-separated line per source line. Covers at most %d lines per call; use start_line and end_line to pick the range.", defaultGitBlameLines)
+}
+
+func (t *GitBlameTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"path":       {Type: "string", Description: "File to blame"},
+			"start_line": {Type: "integer", Description: "First line (1-based, default 1)"},
+			"end_line":   {Type: "integer", Description: "Last line (inclusive)"},
+		},
+		Required: []string{"path"},
+	}.MustMarshal()
+}
+
+func (t *GitBlameTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args gitBlameArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Path == "" {
+		return ErrorResult("path is required"), nil
+	}
+
+	// git blame rejects ranges past the end, so clamp to the file.
+	data, err := os.ReadFile(args.Path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err)), nil
+	}
+	total := strings.Count(string(data), "\n")
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		total++
+	}
+	if total == 0 {
+		return &ToolResult{Output: "(empty file)"}, nil
+	}
+	start := max(args.StartLine, 1)
+	if start > total {
+		return ErrorResult(fmt.Sprintf("start_line %d is past the end: the file has %d lines", start, total)), nil
+	}
+	end := args.EndLine
+	if end <= 0 || end > start+defaultGitBlameLines-1 {
+		end = start + defaultGitBlameLines - 1
+	}
+	end = min(end, total)
+
+	out, err := runGit(ctx, "blame", "--line-porcelain", "-L", fmt.Sprintf("%d,%d", start, end), "--", args.Path)
+	if err != nil {
+		return gitFailed(ctx, "blame", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("line\tcommit\tauthor\tdate\tcontent\n")
+	var hash, author, date string
+	line := start
+	for _, l := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(l, "\t"):
+			fmt.Fprintf(&b, "%d\t%s\t%s\t%s\t%s\n", line, hash, author, date, l[1:])
+			line++
+		case strings.HasPrefix(l, "author "):
+			author = l[len("author "):]
+		case strings.HasPrefix(l, "author-time "):
+			if sec, err := strconv.ParseInt(l[len("author-time "):], 10, 64); err == nil {
+				date = time.Unix(sec, 0).UTC().Format(time.DateOnly)
+			}
+		case len(l) >= 40 && !strings.Contains(l[:40], " "):
+			hash = l[:8]
+		}
+	}
+	if end < total {
+		fmt.Fprintf(&b, "[%d more lines; call again with start_line=%d]", total-end, end+1)
+	}
+	return &ToolResult{Output: boundGitOutput(b.String(), "use a smaller line range")}, nil
+}
+
+// GitCommitTool stages files and records a commit. It changes the
+// repository, so it is only registered when the user allows git writes.
+type GitCommitTool struct{}
+
+type gitCommitArgs struct {
+	Message string   `json:"message"`
+	Paths   []string `json:"paths"`
+	All     bool     `json:"all"`
+}
+
+func (t *GitCommitTool) Name() string { return "git_commit" }
+
+func (t *GitCommitTool) Description() string {
+	return "Commit changes. Stages the given paths first (or every tracked file's changes with all=true), then commits what is staged with the message. Check git_status and git_diff before committing."
+}
+
+func (t *GitCommitTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"message": {Type: "string", Description: fmt.Sprintf("Commit message: a subject line of at most %d characters, optionally followed by a blank line and a body", gitCommitSubjectWidth)},
+			"paths": {
+				Type:        "array",
+				Description: "Files to stage before committing",
+				Items:       &SchemaProperty{Type: "string"},
+			},
+			"all": {Type: "boolean", Description: "Stage changes to all tracked files before committing"},
+		},
+		Required: []string{"message"},
+	}.MustMarshal()
+}
+
+func (t *GitCommitTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args gitCommitArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if strings.TrimSpace(args.Message) == "" {
+		return ErrorResult("message is required"), nil
+	}
+
+	if len(args.Paths) > 0 {
+		if _, err := runGit(ctx, append([]string{"add", "--"}, args.Paths...)...); err != nil {
+			return gitFailed(ctx, "add", err)
+		}
+	}
+	gitArgs := []string{"commit", "-m", args.Message}
+	if args.All {
+		gitArgs = append(gitArgs, "--all")
+	}
+	if _, err := runGit(ctx, gitArgs...); err != nil {
+		return gitFailed(ctx, "commit", err)
+	}
+
+	out, err := runGit(ctx, "show", "--stat", "--no-color", "--format=Committed %h: %s", "HEAD")
+	if err != nil {
+		return &ToolResult{Output: "Committed."}, nil
+	}
+	return &ToolResult{Output: boundGitOutput(strings.TrimSpace(out), "the commit touched many files")}, nil
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo makes a temporary repository with one commit of a.txt and
+// changes into it.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "Ada")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ada@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Ada")
+	t.Setenv("GIT_COMMITTER_EMAIL", "ada@example.com")
+	git(t, "init", "-q", "-b", "main")
+	os.WriteFile("a.txt", []byte("one\ntwo\n"), 0644)
+	git(t, "add", "a.txt")
+	git(t, "commit", "-q", "-m", "Add a.txt")
+	return dir
+}
+
+func git(t *testing.T, args ...string) {
+	t.Helper()
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func execTool(t *testing.T, tool Tool, args any) *ToolResult {
+	t.Helper()
+	data, _ := json.Marshal(args)
+	result, err := tool.Execute(context.Background(), string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGitStatus(t *testing.T) {
+	gitRepo(t)
+	os.WriteFile("a.txt", []byte("one\n"), 0644)
+	os.WriteFile("b.txt", []byte("new\n"), 0644)
+	os.WriteFile("c.txt", []byte("staged\n"), 0644)
+	git(t, "add", "c.txt")
+
+	result := execTool(t, &GitStatusTool{}, map[string]any{})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	var status gitStatus
+	if err := json.Unmarshal([]byte(result.Output), &status); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, result.Output)
+	}
+	if status.Branch != "main" {
+		t.Errorf("branch = %q", status.Branch)
+	}
+	if len(status.Staged) != 1 || status.Staged[0] != (gitFileStatus{Status: "A", Path: "c.txt"}) {
+		t.Errorf("staged = %+v", status.Staged)
+	}
+	if len(status.Unstaged) != 1 || status.Unstaged[0] != (gitFileStatus{Status: "M", Path: "a.txt"}) {
+		t.Errorf("unstaged = %+v", status.Unstaged)
+	}
+	if len(status.Untracked) != 1 || status.Untracked[0] != "b.txt" {
+		t.Errorf("untracked = %v", status.Untracked)
+	}
+}
+
+func TestParseGitStatusBranch(t *testing.T) {
+	s := parseGitStatus("## main...origin/main [ahead 2, behind 1]\x00R  new.go\x00old.go\x00")
+	if s.Branch != "main" || s.Upstream != "origin/main" || s.Ahead != 2 || s.Behind != 1 {
+		t.Errorf("branch = %+v", s)
+	}
+	if len(s.Staged) != 1 || s.Staged[0] != (gitFileStatus{Status: "R", Path: "new.go", From: "old.go"}) {
+		t.Errorf("staged = %+v", s.Staged)
+	}
+}
+
+func TestGitDiffAndLog(t *testing.T) {
+	gitRepo(t)
+	os.WriteFile("a.txt", []byte("one\n2\n"), 0644)
+
+	diff := execTool(t, &GitDiffTool{}, map[string]any{})
+	if !strings.Contains(diff.Output, "-two\n+2") {
+		t.Errorf("diff = %q", diff.Output)
+	}
+	if staged := execTool(t, &GitDiffTool{}, map[string]any{"staged": true}); staged.Output != "(no changes)" {
+		t.Errorf("staged diff = %q", staged.Output)
+	}
+	if bad := execTool(t, &GitDiffTool{}, map[string]any{"ref": "--output=x"}); !bad.IsError {
+		t.Errorf("option-like ref accepted: %q", bad.Output)
+	}
+
+	result := execTool(t, &GitLogTool{}, map[string]any{"count": 5})
+	var commits []gitCommit
+	if err := json.Unmarshal([]byte(result.Output), &commits); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, result.Output)
+	}
+	if len(commits) != 1 || commits[0].Subject != "Add a.txt" || commits[0].Author != "Ada" {
+		t.Errorf("commits = %+v", commits)
+	}
+}
+
+func TestGitBlame(t *testing.T) {
+	gitRepo(t)
+
+	result := execTool(t, &GitBlameTool{}, map[string]any{"path": "a.txt", "start_line": 2, "end_line": 50})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	lines := strings.Split(strings.TrimSpace(result.Output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q", result.Output)
+	}
+	fields := strings.Split(lines[1], "\t")
+	if len(fields) != 5 || fields[0] != "2" || fields[2] != "Ada" || fields[4] != "two" || len(fields[1]) != 8 {
+		t.Errorf("blame line = %q", lines[1])
+	}
+}
+
+func TestGitCommit(t *testing.T) {
+	dir := gitRepo(t)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0644)
+
+	result := execTool(t, &GitCommitTool{}, map[string]any{"message": "Add b.txt", "paths": []string{"b.txt"}})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if !strings.HasPrefix(result.Output, "Committed ") || !strings.Contains(result.Output, "b.txt") {
+		t.Errorf("output = %q", result.Output)
+	}
+
+	if again := execTool(t, &GitCommitTool{}, map[string]any{"message": "Nothing"}); !again.IsError {
+		t.Errorf("empty commit succeeded: %q", again.Output)
+	}
+}
+
+func TestGitCommitNotRegisteredByDefault(t *testing.T) {
+	r := DefaultRegistry()
+	if r.Get("git_commit") != nil {
+		t.Error("git_commit should be opt-in")
+	}
+	for _, name := range []string{"git_status", "git_diff", "git_log", "git_blame"} {
+		if r.Get(name) == nil {
+			t.Errorf("%s not registered", name)
+		}
+	}
+}
@@ -45,7 +45,7 @@ func (t *GrepSearchTool) Parameters() json.RawMessage {
 	}.MustMarshal()
 }
 
-func (t *GrepSearchTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+func (t *GrepSearchTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
 	var args grepSearchArgs
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
 		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
@@ -75,6 +75,9 @@ func (t *GrepSearchTool) Execute(_ context.Context, arguments string) (*ToolResu
 		if err != nil {
 			return nil // skip unreadable entries
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if matches >= args.MaxResults {
 			return filepath.SkipAll
 		}
@@ -127,6 +130,9 @@ func (t *GrepSearchTool) Execute(_ context.Context, arguments string) (*ToolResu
 		return nil
 	})
 
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if walkErr != nil {
 		return ErrorResult(fmt.Sprintf("search failed: %v", walkErr)), nil
 	}
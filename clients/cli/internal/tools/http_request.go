@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	httpRequestTimeout     = 30 * time.Second
+	maxHTTPResponseBytes   = 64 * 1024 // 64KB
+	maxHTTPRequestRedirect = 10
+)
+
+// HTTPRequestTool makes an HTTP request and returns the status, headers and
+// body. Requests may only go to loopback addresses and the hosts in
+// AllowedHosts, including after redirects.
+type HTTPRequestTool struct {
+	// AllowedHosts lists hosts, optionally with a port, that requests may
+	// go to besides loopback. "*.example.com" matches any subdomain of
+	// example.com, and "*" matches every host.
+	AllowedHosts []string
+	// Client sends the requests; nil means a client with a 30 second
+	// timeout. Its CheckRedirect is replaced to enforce the allowlist.
+	Client *http.Client
+}
+
+type httpRequestArgs struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	JSON    json.RawMessage   `json:"json"`
+}
+
+func (t *HTTPRequestTool) Name() string { return "http_request" }
+
+func (t *HTTPRequestTool) Description() string {
+	hosts := "localhost only"
+	if len(t.AllowedHosts) > 0 {
+		hosts = "localhost and " + strings.Join(t.AllowedHosts, ", ")
+	}
+	return fmt.Sprintf("Send an HTTP request and return the status line, response headers and body (up to %dKB). Pass a JSON body as the json parameter, an object or array, rather than escaping it into a string; Content-Type is then set to application/json. Allowed hosts: %s.", maxHTTPResponseBytes/1024, hosts)
+}
+
+func (t *HTTPRequestTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"method":  {Type: "string", Description: "GET, POST, PUT, PATCH, DELETE, HEAD or OPTIONS (default GET)"},
+			"url":     {Type: "string", Description: "Full http or https URL, e.g. http://localhost:8080/api/items"},
+			"headers": {Type: "object", Description: "Request headers as name/value pairs"},
+			"body":    {Type: "string", Description: "Raw request body"},
+			"json":    {Type: "object", Description: "Request body to send as JSON"},
+		},
+		Required: []string{"url"},
+	}.MustMarshal()
+}
+
+func (t *HTTPRequestTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args httpRequestArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+
+	method := strings.ToUpper(args.Method)
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions:
+	default:
+		return ErrorResult(fmt.Sprintf("unsupported method %q", args.Method)), nil
+	}
+
+	u, err := url.Parse(args.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrorResult(fmt.Sprintf("invalid url %q: use a full http:// or https:// URL", args.URL)), nil
+	}
+	if err := t.checkHost(u); err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+
+	hasJSON := len(args.JSON) > 0 && string(args.JSON) != "null"
+	if hasJSON && args.Body != "" {
+		return ErrorResult("pass either body or json, not both"), nil
+	}
+	var body io.Reader
+	switch {
+	case hasJSON:
+		body = bytes.NewReader(args.JSON)
+	case args.Body != "":
+		body = strings.NewReader(args.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid request: %v", err)), nil
+	}
+	for name, value := range args.Headers {
+		req.Header.Set(name, value)
+	}
+	if hasJSON && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return ErrorResult(fmt.Sprintf("request failed: %v", err)), nil
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseBytes+1))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read response: %v", err)), nil
+	}
+	return &ToolResult{Output: formatHTTPResponse(resp, data)}, nil
+}
+
+func (t *HTTPRequestTool) client() *http.Client {
+	c := &http.Client{Timeout: httpRequestTimeout}
+	if t.Client != nil {
+		copied := *t.Client
+		c = &copied
+	}
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxHTTPRequestRedirect {
+			return fmt.Errorf("stopped after %d redirects", maxHTTPRequestRedirect)
+		}
+		return t.checkHost(req.URL)
+	}
+	return c
+}
+
+// checkHost returns an error unless u's host is loopback or allowed.
+func (t *HTTPRequestTool) checkHost(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	for _, allowed := range t.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*",
+			allowed == host,
+			allowed == strings.ToLower(u.Host),
+			strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]):
+			return nil
+		}
+	}
+	return errors.New("host " + u.Host + " is not allowed; http_request may only call localhost unless the user allows more hosts with --http-allow-host")
+}
+
+// formatHTTPResponse renders the status line, sorted headers and the body,
+// noting truncation and summarizing binary bodies.
+func formatHTTPResponse(resp *http.Response, data []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range resp.Header[name] {
+			fmt.Fprintf(&b, "%s: %s\n", name, v)
+		}
+	}
+	b.WriteString("\n")
+
+	truncated := len(data) > maxHTTPResponseBytes
+	if truncated {
+		data = data[:maxHTTPResponseBytes]
+	}
+	switch {
+	case len(data) == 0:
+		b.WriteString("(empty body)")
+	case !utf8.Valid(data) && !truncated || bytes.IndexByte(data, 0) >= 0:
+		fmt.Fprintf(&b, "(binary body, %s)", resp.Header.Get("Content-Type"))
+	default:
+		b.Write(data)
+		if truncated {
+			fmt.Fprintf(&b, "\n\n[truncated: showing the first %d bytes]", maxHTTPResponseBytes)
+		}
+	}
+	return b.String()
+}
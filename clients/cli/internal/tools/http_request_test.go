@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPRequestJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Token", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	result := execTool(t, &HTTPRequestTool{}, map[string]any{
+		"method":  "post",
+		"url":     srv.URL + "/items",
+		"headers": map[string]string{"Authorization": "Bearer t"},
+		"json":    map[string]any{"name": "a \"quoted\" value"},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	for _, want := range []string{
+		"HTTP/1.1 201 Created\n",
+		"X-Content-Type: application/json\n",
+		"X-Method: POST\n",
+		"X-Token: Bearer t\n",
+		"\n\n" + `{"name":"a \"quoted\" value"}`,
+	} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("output missing %q:\n%s", want, result.Output)
+		}
+	}
+}
+
+func TestHTTPRequestAllowlist(t *testing.T) {
+	tool := &HTTPRequestTool{AllowedHosts: []string{"api.example.com", "*.internal"}}
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://localhost:8080/", true},
+		{"http://127.0.0.1/", true},
+		{"http://[::1]:9000/", true},
+		{"https://api.example.com/v1", true},
+		{"http://db.svc.internal/", true},
+		{"https://example.com/", false},
+		{"https://evil.com/?api.example.com", false},
+	} {
+		u, _ := url.Parse(tc.url)
+		if err := tool.checkHost(u); (err == nil) != tc.allowed {
+			t.Errorf("%s: err = %v, want allowed = %v", tc.url, err, tc.allowed)
+		}
+	}
+}
+
+func TestHTTPRequestRedirectToDisallowedHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	result := execTool(t, &HTTPRequestTool{}, map[string]any{"url": srv.URL})
+	if !result.IsError || !strings.Contains(result.Output, "not allowed") {
+		t.Errorf("redirect was followed: %s", result.Output)
+	}
+}
+
+func TestHTTPRequestTruncatesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", maxHTTPResponseBytes+100)))
+	}))
+	defer srv.Close()
+
+	result := execTool(t, &HTTPRequestTool{}, map[string]any{"url": srv.URL})
+	if !strings.HasSuffix(result.Output, "[truncated: showing the first 65536 bytes]") {
+		t.Errorf("output tail = %q", result.Output[len(result.Output)-80:])
+	}
+}
+
+func TestHTTPRequestInvalid(t *testing.T) {
+	for _, args := range []map[string]any{
+		{"url": "localhost:8080/x"},
+		{"url": "ftp://localhost/"},
+		{"url": "http://localhost/", "method": "TRACE"},
+		{"url": "http://localhost/", "body": "a", "json": map[string]any{"b": 1}},
+	} {
+		if result := execTool(t, &HTTPRequestTool{}, args); !result.IsError {
+			t.Errorf("%v: expected an error, got %q", args, result.Output)
+		}
+	}
+}
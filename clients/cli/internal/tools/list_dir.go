@@ -35,7 +35,7 @@ func (t *ListDirTool) Parameters() json.RawMessage {
 	}.MustMarshal()
 }
 
-func (t *ListDirTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+func (t *ListDirTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
 	var args listDirArgs
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
 		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
@@ -66,7 +66,10 @@ func (t *ListDirTool) Execute(_ context.Context, arguments string) (*ToolResult,
 	}
 
 	var b strings.Builder
-	if err := listDirRecursive(&b, args.Path, "", depth); err != nil {
+	if err := listDirRecursive(ctx, &b, args.Path, "", depth); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return ErrorResult(fmt.Sprintf("failed to read directory: %v", err)), nil
 	}
 
@@ -78,7 +81,10 @@ func (t *ListDirTool) Execute(_ context.Context, arguments string) (*ToolResult,
 }
 
 // listDirRecursive writes directory entries to b, recursing up to maxDepth levels.
-func listDirRecursive(b *strings.Builder, root, prefix string, remainingDepth int) error {
+func listDirRecursive(ctx context.Context, b *strings.Builder, root, prefix string, remainingDepth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	entries, err := os.ReadDir(filepath.Join(root, prefix))
 	if err != nil {
 		return err
@@ -89,7 +95,10 @@ func listDirRecursive(b *strings.Builder, root, prefix string, remainingDepth in
 		if entry.IsDir() {
 			fmt.Fprintf(b, "[dir]  %s\n", rel)
 			if remainingDepth > 1 {
-				if err := listDirRecursive(b, root, rel, remainingDepth-1); err != nil {
+				if err := listDirRecursive(ctx, b, root, rel, remainingDepth-1); err != nil {
+					if ctx.Err() != nil {
+						return err
+					}
 					// Skip unreadable subdirectories
 					continue
 				}
@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// defaultMemoryImportance keeps deliberately saved facts well above ordinary
+// conversation turns without pinning them forever.
+const defaultMemoryImportance = 0.8
+
+// MemoryClient is the part of the backend memory API the memory tools use.
+// *apiclient.Client satisfies it.
+type MemoryClient interface {
+	MemoryStore(ctx context.Context, userMsg, assistMsg string, importance float32) (string, error)
+	MemorySearch(ctx context.Context, query string, limit int) (*api.MemorySearchResponse, error)
+	MemoryDelete(ctx context.Context, id string) error
+}
+
+// MemoryFactPrefix marks memories saved explicitly rather than recorded
+// from a conversation turn.
+const MemoryFactPrefix = "Remember: "
+
+// RegisterMemoryTools adds memory_store, memory_search and memory_forget.
+func RegisterMemoryTools(r *Registry, c MemoryClient) {
+	r.Register(&MemoryStoreTool{Client: c})
+	r.Register(&MemorySearchTool{Client: c})
+	r.Register(&MemoryForgetTool{Client: c})
+}
+
+// memoryToolError turns a backend failure into a tool error, unless the
+// turn itself was cancelled.
+func memoryToolError(ctx context.Context, action string, err error) (*ToolResult, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return ErrorResult(fmt.Sprintf("%s failed: %v", action, err)), nil
+}
+
+// MemoryStoreTool saves a fact to long-term memory with an importance score,
+// so it keeps ranking highly in later sessions instead of decaying with age.
+type MemoryStoreTool struct {
+	Client MemoryClient
+}
+
+type memoryStoreArgs struct {
+	Fact       string   `json:"fact"`
+	Importance *float32 `json:"importance,omitempty"`
+}
+
+func (t *MemoryStoreTool) Name() string { return "memory_store" }
+
+func (t *MemoryStoreTool) Description() string {
+	return "Save a fact, decision, or user preference to long-term memory so it is recalled in future conversations (e.g. \"the deploy script lives in ops/deploy.sh\"). Use for things worth keeping, not for transient details."
+}
+
+func (t *MemoryStoreTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"fact":       {Type: "string", Description: "The fact to remember, stated so it makes sense on its own"},
+			"importance": {Type: "number", Description: "How important the fact is, 0-1 (default: 0.8). 1 means it never goes stale."},
+		},
+		Required: []string{"fact"},
+	}.MustMarshal()
+}
+
+func (t *MemoryStoreTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args memoryStoreArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Fact == "" {
+		return ErrorResult("fact is required"), nil
+	}
+
+	importance := float32(defaultMemoryImportance)
+	if args.Importance != nil {
+		importance = *args.Importance
+	}
+	if importance < 0 || importance > 1 {
+		return ErrorResult("importance must be between 0 and 1"), nil
+	}
+
+	id, err := t.Client.MemoryStore(ctx, MemoryFactPrefix+args.Fact, args.Fact, importance)
+	if err != nil {
+		return memoryToolError(ctx, "memory store", err)
+	}
+	return &ToolResult{Output: fmt.Sprintf("Remembered as %s (importance %.2f): %s", id, importance, args.Fact)}, nil
+}
+
+// MemorySearchTool searches long-term memory.
+type MemorySearchTool struct {
+	Client MemoryClient
+}
+
+type memorySearchArgs struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+func (t *MemorySearchTool) Name() string { return "memory_search" }
+
+func (t *MemorySearchTool) Description() string {
+	return "Search long-term memory for facts and past conversations relevant to a query. Returns matching memories with their IDs, dates, and relevance scores."
+}
+
+func (t *MemorySearchTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"query": {Type: "string", Description: "What to look for"},
+			"limit": {Type: "integer", Description: "Maximum number of memories to return (default: 5)"},
+		},
+		Required: []string{"query"},
+	}.MustMarshal()
+}
+
+func (t *MemorySearchTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args memorySearchArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Query == "" {
+		return ErrorResult("query is required"), nil
+	}
+	if args.Limit <= 0 {
+		args.Limit = 5
+	}
+
+	resp, err := t.Client.MemorySearch(ctx, args.Query, args.Limit)
+	if err != nil {
+		return memoryToolError(ctx, "memory search", err)
+	}
+	if len(resp.Results) == 0 {
+		return &ToolResult{Output: fmt.Sprintf("No memories found for %q", args.Query)}, nil
+	}
+
+	var b strings.Builder
+	for _, r := range resp.Results {
+		e := r.Entry
+		fmt.Fprintf(&b, "[%s] %s (score %.2f)\n", e.ID, e.Timestamp.Format("2006-01-02"), r.CombinedScore)
+		if fact, ok := strings.CutPrefix(e.UserMsg, MemoryFactPrefix); ok {
+			fmt.Fprintf(&b, "  Fact: %s\n\n", fact)
+			continue
+		}
+		fmt.Fprintf(&b, "  User: %s\n  Assistant: %s\n\n", e.UserMsg, e.AssistMsg)
+	}
+	return &ToolResult{Output: strings.TrimRight(b.String(), "\n")}, nil
+}
+
+// MemoryForgetTool deletes a memory that is wrong or outdated.
+type MemoryForgetTool struct {
+	Client MemoryClient
+}
+
+type memoryForgetArgs struct {
+	ID string `json:"id"`
+}
+
+func (t *MemoryForgetTool) Name() string { return "memory_forget" }
+
+func (t *MemoryForgetTool) Description() string {
+	return "Delete a memory that is wrong or outdated. Find its ID with memory_search first."
+}
+
+func (t *MemoryForgetTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"id": {Type: "string", Description: "The full memory ID as shown by memory_search"},
+		},
+		Required: []string{"id"},
+	}.MustMarshal()
+}
+
+func (t *MemoryForgetTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args memoryForgetArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.ID == "" {
+		return ErrorResult("id is required"), nil
+	}
+
+	if err := t.Client.MemoryDelete(ctx, args.ID); err != nil {
+		return memoryToolError(ctx, "memory forget", err)
+	}
+	return &ToolResult{Output: fmt.Sprintf("Forgot memory %s", args.ID)}, nil
+}
@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MultiEditTool applies several find-and-replace edits, across one or more
+// files, as a unit: every edit is checked before any file is written, and
+// files already written are restored if a later write fails.
+type MultiEditTool struct{}
+
+type multiEditArgs struct {
+	Edits []patchFileArgs `json:"edits"`
+}
+
+func (t *MultiEditTool) Name() string { return "multi_edit" }
+
+func (t *MultiEditTool) Description() string {
+	return "Apply several edits at once, to one file or many. Each edit replaces old_string with new_string in path; old_string must match exactly one location. Edits to the same file apply in order, each to the result of the previous one. If any edit fails, no file is changed. Use file_read first to see the current content."
+}
+
+func (t *MultiEditTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"edits": {
+				Type:        "array",
+				Description: "The edits to apply, in order",
+				Items: &SchemaProperty{
+					Type: "object",
+					Properties: map[string]SchemaProperty{
+						"path":       {Type: "string", Description: "Path to the file to edit"},
+						"old_string": {Type: "string", Description: "The exact text to find (must match exactly once)"},
+						"new_string": {Type: "string", Description: "The text to replace old_string with"},
+					},
+					Required: []string{"path", "old_string", "new_string"},
+				},
+			},
+		},
+		Required: []string{"edits"},
+	}.MustMarshal()
+}
+
+// editedFile is a file's content before and after the edits.
+type editedFile struct {
+	path     string
+	mode     os.FileMode
+	original []byte
+	content  string
+}
+
+func (t *MultiEditTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+	var args multiEditArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if len(args.Edits) == 0 {
+		return ErrorResult("edits is required"), nil
+	}
+
+	// Apply every edit in memory first, so a bad one changes nothing.
+	var files []*editedFile
+	byPath := make(map[string]*editedFile)
+	for i, edit := range args.Edits {
+		fail := func(format string, a ...any) (*ToolResult, error) {
+			return ErrorResult(fmt.Sprintf("edit %d (%s): ", i+1, edit.Path) + fmt.Sprintf(format, a...) + ". No files were changed."), nil
+		}
+		switch {
+		case edit.Path == "":
+			return fail("path is required")
+		case edit.OldString == "":
+			return fail("old_string is required")
+		case edit.OldString == edit.NewString:
+			return fail("old_string and new_string are identical")
+		}
+
+		key := filepath.Clean(edit.Path)
+		f := byPath[key]
+		if f == nil {
+			info, err := os.Stat(edit.Path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return fail("file not found")
+				}
+				return fail("%v", err)
+			}
+			data, err := os.ReadFile(edit.Path)
+			if err != nil {
+				return fail("failed to read file: %v", err)
+			}
+			f = &editedFile{path: edit.Path, mode: info.Mode().Perm(), original: data, content: string(data)}
+			byPath[key] = f
+			files = append(files, f)
+		}
+
+		switch count := strings.Count(f.content, edit.OldString); count {
+		case 1:
+			f.content = strings.Replace(f.content, edit.OldString, edit.NewString, 1)
+		case 0:
+			return fail("old_string not found (earlier edits to the same file are already applied when it is matched)")
+		default:
+			return fail("old_string matches %d locations; include more surrounding context to make it unique", count)
+		}
+	}
+
+	for i, f := range files {
+		if err := writeFileAtomic(f.path, []byte(f.content), f.mode); err != nil {
+			for _, done := range files[:i] {
+				writeFileAtomic(done.path, done.original, done.mode)
+			}
+			return ErrorResult(fmt.Sprintf("failed to write %s: %v. Files already written were restored; no files were changed.", f.path, err)), nil
+		}
+	}
+
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return &ToolResult{Output: fmt.Sprintf("Applied %d edits to %d files: %s", len(args.Edits), len(files), strings.Join(paths, ", "))}, nil
+}
+
+// writeFileAtomic replaces path with data by renaming a temporary file over
+// it, so the file is never left half-written.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
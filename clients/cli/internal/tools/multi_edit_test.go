@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func multiEditArguments(t *testing.T, edits ...patchFileArgs) string {
+	t.Helper()
+	data, err := json.Marshal(multiEditArgs{Edits: edits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMultiEdit(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	os.WriteFile(a, []byte("func Old() {}\nOld()\n"), 0644)
+	os.WriteFile(b, []byte("x := Old()\n"), 0600)
+
+	result, err := (&MultiEditTool{}).Execute(context.Background(), multiEditArguments(t,
+		patchFileArgs{Path: a, OldString: "func Old()", NewString: "func New()"},
+		patchFileArgs{Path: a, OldString: "\nOld()", NewString: "\nNew()"},
+		patchFileArgs{Path: b, OldString: "Old()", NewString: "New()"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if !strings.HasPrefix(result.Output, "Applied 3 edits to 2 files") {
+		t.Errorf("output = %q", result.Output)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "func New() {}\nNew()\n" {
+		t.Errorf("a.go = %q", got)
+	}
+	if got, _ := os.ReadFile(b); string(got) != "x := New()\n" {
+		t.Errorf("b.go = %q", got)
+	}
+	if info, _ := os.Stat(b); info.Mode().Perm() != 0600 {
+		t.Errorf("b.go mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestMultiEditAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	os.WriteFile(a, []byte("one\n"), 0644)
+	os.WriteFile(b, []byte("dup dup\n"), 0644)
+
+	result, err := (&MultiEditTool{}).Execute(context.Background(), multiEditArguments(t,
+		patchFileArgs{Path: a, OldString: "one", NewString: "two"},
+		patchFileArgs{Path: b, OldString: "dup", NewString: "single"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || !strings.Contains(result.Output, "edit 2") || !strings.Contains(result.Output, "matches 2 locations") {
+		t.Errorf("result = %+v, want an error naming edit 2", result)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "one\n" {
+		t.Errorf("a.go was changed to %q", got)
+	}
+}
+
+func TestMultiEditRollsBackFailedWrite(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	os.WriteFile(a, []byte("one\n"), 0644)
+	locked := filepath.Join(dir, "locked")
+	os.Mkdir(locked, 0755)
+	b := filepath.Join(locked, "b.go")
+	os.WriteFile(b, []byte("two\n"), 0644)
+	os.Chmod(locked, 0555)
+	defer os.Chmod(locked, 0755)
+
+	result, err := (&MultiEditTool{}).Execute(context.Background(), multiEditArguments(t,
+		patchFileArgs{Path: a, OldString: "one", NewString: "1"},
+		patchFileArgs{Path: b, OldString: "two", NewString: "2"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatalf("expected a write error, got %q", result.Output)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "one\n" {
+		t.Errorf("a.go was not restored: %q", got)
+	}
+}
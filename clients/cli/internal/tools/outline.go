@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+)
+
+// outlineLanguage finds definitions in languages without a parser in the
+// standard library. Definitions are recognized line by line with regular
+// expressions, so unusual formatting can be missed, and their extent comes
+// from indentation (Python) or brace matching (everything else).
+type outlineLanguage struct {
+	patterns []outlinePattern
+	// indented marks languages whose blocks are delimited by indentation.
+	indented bool
+	// quoteStrings marks languages where '…' is a string of any length
+	// rather than a character literal (or a Rust lifetime).
+	quoteStrings bool
+}
+
+type outlinePattern struct {
+	re *regexp.Regexp
+	// name is the submatch holding the defined name when it must be
+	// checked against keywords; 0 means no check.
+	name int
+}
+
+// outlineKeywords are words that can sit where a method-like pattern
+// expects a name: control flow and calls, not definitions.
+var outlineKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"function": true, "new": true, "else": true, "throw": true, "do": true, "try": true,
+	"synchronized": true, "super": true, "this": true,
+}
+
+var (
+	pythonOutline = &outlineLanguage{
+		indented: true,
+		patterns: []outlinePattern{
+			{re: regexp.MustCompile(`^\s*class\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(async\s+)?def\s+\w+`)},
+		},
+	}
+	jsOutline = &outlineLanguage{
+		quoteStrings: true,
+		patterns: []outlinePattern{
+			{re: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(async\s+)?function\*?\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(abstract\s+)?class\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(export\s+)?interface\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(export\s+)?(const\s+)?enum\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(export\s+)?type\s+\w+[^=]*=`)},
+			{re: regexp.MustCompile(`^\s*(export\s+)?(const|let|var)\s+\w+\s*(:[^=]+)?=\s*(async\s+)?(\([^)]*\)|\w+)\s*(:\s*[^=]+)?=>`)},
+			{name: 2, re: regexp.MustCompile(`^\s+((?:public|private|protected|static|async|readonly|override|get|set)\s+)*\*?(\w+)\s*(<[^>]*>)?\s*\([^;]*\)\s*(:\s*[^{;]+)?\{\s*$`)},
+		},
+	}
+	rustOutline = &outlineLanguage{
+		patterns: []outlinePattern{
+			{re: regexp.MustCompile(`^\s*(pub(\([^)]*\))?\s+)?(const\s+)?(async\s+)?(unsafe\s+)?(extern\s+"[^"]*"\s+)?fn\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(pub(\([^)]*\))?\s+)?(struct|enum|trait|union|type|mod)\s+\w+`)},
+			{re: regexp.MustCompile(`^\s*(unsafe\s+)?impl\b`)},
+			{re: regexp.MustCompile(`^\s*macro_rules!\s*\w+`)},
+		},
+	}
+	javaOutline = &outlineLanguage{
+		patterns: []outlinePattern{
+			{re: regexp.MustCompile(`^\s*((public|private|protected|static|final|abstract|sealed|non-sealed)\s+)*(class|interface|enum|record|@interface)\s+\w+`)},
+			{name: 5, re: regexp.MustCompile(`^\s+((public|private|protected|static|final|abstract|synchronized|native|default)\s+)*(<[^>]+>\s+)?([\w<>\[\],.?]+(?:\s*<[^>]*>)?)\s+(\w+)\s*\([^;=]*$`)},
+		},
+	}
+)
+
+// outlineLanguages maps file extensions to their outliners.
+var outlineLanguages = map[string]*outlineLanguage{
+	".py":   pythonOutline,
+	".pyi":  pythonOutline,
+	".js":   jsOutline,
+	".jsx":  jsOutline,
+	".mjs":  jsOutline,
+	".cjs":  jsOutline,
+	".ts":   jsOutline,
+	".tsx":  jsOutline,
+	".mts":  jsOutline,
+	".cts":  jsOutline,
+	".rs":   rustOutline,
+	".java": javaOutline,
+}
+
+func (l *outlineLanguage) outline(lines []string) []codeSymbol {
+	var symbols []codeSymbol
+	for i, line := range lines {
+		for _, p := range l.patterns {
+			m := p.re.FindStringSubmatch(line)
+			if m == nil || (p.name > 0 && outlineKeywords[m[p.name]]) {
+				continue
+			}
+			var end int
+			if l.indented {
+				end = indentBlockEnd(lines, i)
+			} else {
+				end = braceBlockEnd(lines, i, l.quoteStrings)
+			}
+			sig := strings.TrimSpace(line)
+			sig = strings.TrimSpace(strings.TrimRight(sig, "{:"))
+			symbols = append(symbols, codeSymbol{signature: sig, start: i + 1, end: end + 1})
+			break
+		}
+	}
+	return symbols
+}
+
+// indentBlockEnd returns the index of the last line of the indented block
+// introduced by lines[start], whose header may span lines while
+// parentheses are open.
+func indentBlockEnd(lines []string, start int) int {
+	body := start
+	depth := strings.Count(lines[start], "(") - strings.Count(lines[start], ")")
+	for depth > 0 && body+1 < len(lines) {
+		body++
+		depth += strings.Count(lines[body], "(") - strings.Count(lines[body], ")")
+	}
+
+	base := indentWidth(lines[start])
+	end := body
+	for j := body + 1; j < len(lines); j++ {
+		trimmed := strings.TrimSpace(lines[j])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indentWidth(lines[j]) <= base {
+			break
+		}
+		end = j
+	}
+	return end
+}
+
+func indentWidth(line string) int {
+	w := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			w++
+		case '\t':
+			w += 4
+		default:
+			return w
+		}
+	}
+	return w
+}
+
+// braceLookahead is how many lines a definition's header may span before
+// its opening brace.
+const braceLookahead = 10
+
+// braceBlockEnd returns the index of the line holding the brace that closes
+// the block opened at or just after lines[start], skipping strings and
+// comments. A definition that ends with ';' before any brace (a prototype
+// or an abstract method) ends on that line.
+func braceBlockEnd(lines []string, start int, quoteStrings bool) int {
+	depth, opened := 0, false
+	inBlockComment := false
+	for j := start; j < len(lines); j++ {
+		if !opened && j-start > braceLookahead {
+			return start
+		}
+		line := lines[j]
+		var quote byte
+		for k := 0; k < len(line); k++ {
+			c := line[k]
+			switch {
+			case inBlockComment:
+				if c == '*' && k+1 < len(line) && line[k+1] == '/' {
+					inBlockComment = false
+					k++
+				}
+			case quote != 0:
+				if c == '\\' {
+					k++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '/' && k+1 < len(line) && line[k+1] == '/':
+				k = len(line)
+			case c == '/' && k+1 < len(line) && line[k+1] == '*':
+				inBlockComment = true
+				k++
+			case c == '"' || c == '`':
+				quote = c
+			case c == '\'':
+				// A character literal closes within a few bytes; a lone
+				// quote is a Rust lifetime.
+				if quoteStrings {
+					quote = c
+				} else if end := strings.IndexByte(line[k+1:], '\''); end >= 0 && end <= 2 {
+					k += end + 1
+				}
+			case c == '{':
+				depth++
+				opened = true
+			case c == '}':
+				depth--
+				if opened && depth == 0 {
+					return j
+				}
+			case c == ';' && !opened && depth == 0:
+				return j
+			}
+		}
+	}
+	if opened {
+		return len(lines) - 1
+	}
+	return start
+}
@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Defaults for DefaultRegistry's processors.
+const (
+	defaultPageLines = 400       // file_read page length
+	defaultPageBytes = 32 * 1024 // file_read page size
+	defaultHeadLines = 100       // shell_exec lines kept from the start
+	defaultTailLines = 100       // shell_exec lines kept from the end
+)
+
+// A ResultProcessor rewrites a tool's result before the model sees it, e.g.
+// to keep a large output from filling the context window. arguments are the
+// ones the tool was called with.
+type ResultProcessor interface {
+	Process(arguments string, result *ToolResult) *ToolResult
+}
+
+// ResultProcessorFunc adapts a function to ResultProcessor.
+type ResultProcessorFunc func(arguments string, result *ToolResult) *ToolResult
+
+func (f ResultProcessorFunc) Process(arguments string, result *ToolResult) *ToolResult {
+	return f(arguments, result)
+}
+
+// parameterAdder is implemented by processors that need arguments the tool
+// itself does not declare, such as Paginate's offset.
+type parameterAdder interface {
+	addedParameters() map[string]SchemaProperty
+}
+
+// ansiEscape matches CSI sequences (colors, cursor movement) and OSC
+// sequences (titles, hyperlinks).
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// StripANSI removes terminal escape sequences, which cost tokens and mean
+// nothing to the model.
+func StripANSI() ResultProcessor {
+	return ResultProcessorFunc(func(_ string, result *ToolResult) *ToolResult {
+		result.Output = ansiEscape.ReplaceAllString(result.Output, "")
+		return result
+	})
+}
+
+// HeadTail keeps the first head and last tail lines of a longer output,
+// where a log's command line and final errors usually are.
+func HeadTail(head, tail int) ResultProcessor {
+	return ResultProcessorFunc(func(_ string, result *ToolResult) *ToolResult {
+		lines := strings.Split(result.Output, "\n")
+		if len(lines) <= head+tail {
+			return result
+		}
+		omitted := len(lines) - head - tail
+		kept := append(lines[:head:head], fmt.Sprintf("… %d lines omitted …", omitted))
+		result.Output = strings.Join(append(kept, lines[len(lines)-tail:]...), "\n")
+		return result
+	})
+}
+
+// Paginate returns output one page at a time: at most lines lines and
+// maxBytes bytes (0 = no byte limit), starting at the line given by an
+// offset argument, with a note telling the model how to get the next page.
+// The tool is run again for each page, so it should not have side effects.
+// Error results are passed through whole.
+func Paginate(lines, maxBytes int) ResultProcessor {
+	return &paginator{lines: lines, maxBytes: maxBytes}
+}
+
+type paginator struct {
+	lines    int
+	maxBytes int
+}
+
+func (p *paginator) addedParameters() map[string]SchemaProperty {
+	return map[string]SchemaProperty{
+		"offset": {Type: "integer", Description: "Line to start from when the output is long (default 0); the output says what to pass for the next page"},
+	}
+}
+
+func (p *paginator) Process(arguments string, result *ToolResult) *ToolResult {
+	if result.IsError {
+		return result
+	}
+	var args struct {
+		Offset int `json:"offset"`
+	}
+	json.Unmarshal([]byte(arguments), &args)
+
+	lines := strings.SplitAfter(result.Output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if args.Offset <= 0 && len(lines) <= p.lines && (p.maxBytes <= 0 || len(result.Output) <= p.maxBytes) {
+		return result
+	}
+	if args.Offset >= len(lines) {
+		result.Output = fmt.Sprintf("[offset %d is past the end: the output has %d lines]", args.Offset, len(lines))
+		return result
+	}
+
+	start := max(args.Offset, 0)
+	end, size := start, 0
+	for end < len(lines) && end-start < p.lines {
+		if p.maxBytes > 0 && size+len(lines[end]) > p.maxBytes && end > start {
+			break
+		}
+		size += len(lines[end])
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		fmt.Fprintf(&b, "[lines %d-%d of %d]\n", start+1, end, len(lines))
+	}
+	page := strings.Join(lines[start:end], "")
+	if p.maxBytes > 0 && len(page) > p.maxBytes {
+		cut := p.maxBytes
+		for cut > 0 && !utf8.RuneStart(page[cut]) {
+			cut--
+		}
+		page = page[:cut] + "\n[line truncated]\n"
+	}
+	b.WriteString(page)
+	if end < len(lines) {
+		fmt.Fprintf(&b, "\n…%d more lines; call again with offset=%d", len(lines)-end, end)
+	}
+	result.Output = b.String()
+	return result
+}
+
+// withAddedParameters returns params with the properties the processors
+// add, or params unchanged if they add none or it is not an object schema.
+func withAddedParameters(params json.RawMessage, procs []ResultProcessor) json.RawMessage {
+	added := make(map[string]SchemaProperty)
+	for _, p := range procs {
+		if pa, ok := p.(parameterAdder); ok {
+			for name, prop := range pa.addedParameters() {
+				added[name] = prop
+			}
+		}
+	}
+	if len(added) == 0 {
+		return params
+	}
+
+	var schema map[string]any
+	if json.Unmarshal(params, &schema) != nil {
+		return params
+	}
+	props, _ := schema["properties"].(map[string]any)
+	if props == nil {
+		props = make(map[string]any)
+	}
+	for name, prop := range added {
+		if _, exists := props[name]; !exists {
+			props[name] = prop
+		}
+	}
+	schema["properties"] = props
+	out, err := json.Marshal(schema)
+	if err != nil {
+		return params
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestPaginate(t *testing.T) {
+	p := Paginate(10, 0)
+	out := p.Process(`{"path":"x"}`, &ToolResult{Output: numberedLines(25)}).Output
+	if !strings.HasPrefix(out, "line 1\n") || strings.Contains(out, "line 11\n") {
+		t.Errorf("first page = %q", out)
+	}
+	if !strings.HasSuffix(out, "…15 more lines; call again with offset=10") {
+		t.Errorf("first page missing next-page note: %q", out)
+	}
+
+	out = p.Process(`{"path":"x","offset":20}`, &ToolResult{Output: numberedLines(25)}).Output
+	if !strings.HasPrefix(out, "[lines 21-25 of 25]\nline 21\n") || strings.Contains(out, "more lines") {
+		t.Errorf("last page = %q", out)
+	}
+
+	out = p.Process(`{"offset":30}`, &ToolResult{Output: numberedLines(25)}).Output
+	if !strings.Contains(out, "past the end") {
+		t.Errorf("offset past the end = %q", out)
+	}
+
+	short := numberedLines(5)
+	if out := p.Process(`{}`, &ToolResult{Output: short}).Output; out != short {
+		t.Errorf("short output changed: %q", out)
+	}
+}
+
+func TestPaginateByteLimit(t *testing.T) {
+	out := Paginate(100, 30).Process(`{}`, &ToolResult{Output: numberedLines(20)}).Output
+	if !strings.HasPrefix(out, "line 1\nline 2\nline 3\nline 4\n\n…16 more lines; call again with offset=4") {
+		t.Errorf("page = %q", out)
+	}
+}
+
+func TestPaginateLongLineKeepsRunes(t *testing.T) {
+	// Each é is two bytes, so a 5-byte limit falls inside the third.
+	out := Paginate(100, 5).Process(`{}`, &ToolResult{Output: strings.Repeat("é", 10) + "\n"}).Output
+	if !strings.HasPrefix(out, "éé\n[line truncated]\n") || !utf8.ValidString(out) {
+		t.Errorf("page = %q", out)
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	out := HeadTail(2, 2).Process("", &ToolResult{Output: strings.TrimSuffix(numberedLines(10), "\n")}).Output
+	want := "line 1\nline 2\n… 6 lines omitted …\nline 9\nline 10"
+	if out != want {
+		t.Errorf("HeadTail = %q, want %q", out, want)
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	out := StripANSI().Process("", &ToolResult{Output: "\x1b[31mFAIL\x1b[0m \x1b]8;;http://x\x07link\x1b]8;;\x07"}).Output
+	if out != "FAIL link" {
+		t.Errorf("StripANSI = %q", out)
+	}
+}
+
+// outputTool returns its arguments' output field.
+type outputTool struct{}
+
+func (outputTool) Name() string                { return "output" }
+func (outputTool) Description() string         { return "output" }
+func (outputTool) Parameters() json.RawMessage { return Schema{Type: "object"}.MustMarshal() }
+func (outputTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+	var args struct{ Output string }
+	json.Unmarshal([]byte(arguments), &args)
+	return &ToolResult{Output: args.Output}, nil
+}
+
+func TestRegistryProcessors(t *testing.T) {
+	r := NewRegistry()
+	r.Register(outputTool{})
+	r.SetProcessors("output", StripANSI(), Paginate(1, 0))
+
+	result, err := r.Execute(context.Background(), "output", `{"output":"\u001b[1ma\u001b[0m\nb\n"}`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "a\n\n…1 more lines; call again with offset=1" {
+		t.Errorf("processed output = %q", result.Output)
+	}
+
+	params := string(r.APITools()[0].Function.Parameters)
+	if !strings.Contains(params, `"offset"`) {
+		t.Errorf("paginated tool's schema has no offset: %s", params)
+	}
+	if sub := r.Subset("output"); len(sub.processors["output"]) != 2 {
+		t.Error("Subset dropped the processors")
+	}
+}
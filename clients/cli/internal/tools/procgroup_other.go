@@ -0,0 +1,18 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// terminateProcessGroup kills cmd: there is no SIGTERM to send.
+func terminateProcessGroup(cmd *exec.Cmd) {
+	killProcessGroup(cmd)
+}
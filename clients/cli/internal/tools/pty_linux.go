@@ -0,0 +1,56 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal opens a pseudo-terminal for a shell's output and returns
+// the master, which the caller reads, and the slave, which the shell
+// writes to. Output processing is off, so lines end in "\n" as they would
+// through a pipe, and the window is wide enough that programs do not wrap.
+func openTerminal() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+			if slave != nil {
+				slave.Close()
+			}
+		}
+	}()
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		return nil, nil, fmt.Errorf("unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pty number: %w", err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sfd := int(slave.Fd())
+	termios, err := unix.IoctlGetTermios(sfd, unix.TCGETS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pty attributes: %w", err)
+	}
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO
+	if err = unix.IoctlSetTermios(sfd, unix.TCSETS, termios); err != nil {
+		return nil, nil, fmt.Errorf("pty attributes: %w", err)
+	}
+	if err = unix.IoctlSetWinsize(sfd, unix.TIOCSWINSZ, &unix.Winsize{Row: 50, Col: 200}); err != nil {
+		return nil, nil, fmt.Errorf("pty size: %w", err)
+	}
+	return master, slave, nil
+}
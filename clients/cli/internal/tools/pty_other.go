@@ -0,0 +1,11 @@
+//go:build !linux
+
+package tools
+
+import "os"
+
+// openTerminal returns a pipe on systems without the Linux pty interface,
+// so programs in the shell see a pipe rather than a terminal.
+func openTerminal() (master, slave *os.File, err error) {
+	return os.Pipe()
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ReadTracker records the files read during one agent run, for the
+// read-before-write policy (Registry.SetRequireReadBeforeWrite).
+type ReadTracker struct {
+	mu   sync.Mutex
+	read map[string]bool
+}
+
+// NewReadTracker returns an empty ReadTracker.
+func NewReadTracker() *ReadTracker {
+	return &ReadTracker{read: make(map[string]bool)}
+}
+
+func (t *ReadTracker) markRead(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.read[path] = true
+}
+
+func (t *ReadTracker) hasRead(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.read[path]
+}
+
+type readTrackerKey struct{}
+
+// WithReadTracker returns a context carrying t. The agent loop attaches one
+// per run, so "read this turn" means read during that run.
+func WithReadTracker(ctx context.Context, t *ReadTracker) context.Context {
+	return context.WithValue(ctx, readTrackerKey{}, t)
+}
+
+// ReadTrackerFrom returns the tracker carried by ctx, or nil.
+func ReadTrackerFrom(ctx context.Context) *ReadTracker {
+	t, _ := ctx.Value(readTrackerKey{}).(*ReadTracker)
+	return t
+}
+
+// writeTools are the tools that change existing files, which the
+// read-before-write policy guards.
+var writeTools = map[string]bool{"file_write": true, "patch_file": true, "multi_edit": true, "apply_unified_diff": true}
+
+// argPaths returns the paths a file tool call names, made absolute so
+// "./a.go" and "a.go" match: the path argument, each edit's for
+// multi_edit, or each file's in an apply_unified_diff diff.
+func argPaths(arguments string) []string {
+	var args struct {
+		Path  string `json:"path"`
+		Edits []struct {
+			Path string `json:"path"`
+		} `json:"edits"`
+		Diff string `json:"diff"`
+	}
+	if json.Unmarshal([]byte(arguments), &args) != nil {
+		return nil
+	}
+	names := []string{args.Path}
+	for _, e := range args.Edits {
+		names = append(names, e.Path)
+	}
+	if args.Diff != "" {
+		patches, _ := parseUnifiedDiff(args.Diff)
+		for _, p := range patches {
+			names = append(names, p.oldPath, p.newPath)
+		}
+	}
+	var paths []string
+	for _, p := range names {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		paths = append(paths, filepath.Clean(p))
+	}
+	return paths
+}
+
+// checkReadBeforeWrite returns an error result if the call would change an
+// existing file that has not been read during the run.
+func checkReadBeforeWrite(tracker *ReadTracker, name, arguments string) *ToolResult {
+	if !writeTools[name] {
+		return nil
+	}
+	for _, path := range argPaths(arguments) {
+		if tracker.hasRead(path) {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue // new files have nothing to read
+		}
+		return ErrorResult(fmt.Sprintf("%s refused: %s has not been read in this turn. Call file_read on it first, then make your change based on its current contents.", name, path))
+	}
+	return nil
+}
+
+// recordRead notes the file a successful call read or wrote; after writing
+// a file the agent knows its contents as well as after reading it.
+func recordRead(tracker *ReadTracker, name, arguments string) {
+	if name != "file_read" && !writeTools[name] {
+		return
+	}
+	for _, path := range argPaths(arguments) {
+		tracker.markRead(path)
+	}
+}
@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadBeforeWrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.txt")
+	os.WriteFile(existing, []byte("old\n"), 0644)
+	fresh := filepath.Join(dir, "b.txt")
+
+	r := DefaultRegistry()
+	r.SetRequireReadBeforeWrite(true)
+	ctx := WithReadTracker(context.Background(), NewReadTracker())
+	write := func(path string) *ToolResult {
+		t.Helper()
+		result, err := r.Execute(ctx, "file_write", `{"path":"`+path+`","content":"new\n"}`, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if result := write(existing); !result.IsError || !strings.Contains(result.Output, "file_read") {
+		t.Errorf("unread write = %+v, want a refusal pointing at file_read", result)
+	}
+	if result := write(fresh); result.IsError {
+		t.Errorf("writing a new file was refused: %s", result.Output)
+	}
+
+	if _, err := r.Execute(ctx, "file_read", `{"path":"`+existing+`"}`, 0); err != nil {
+		t.Fatal(err)
+	}
+	if result := write(existing); result.IsError {
+		t.Errorf("write after read was refused: %s", result.Output)
+	}
+
+	// Without a tracker, as outside an agent run, the policy does not apply.
+	other := filepath.Join(dir, "c.txt")
+	os.WriteFile(other, []byte("old\n"), 0644)
+	result, err := r.Execute(context.Background(), "file_write", `{"path":"`+other+`","content":"new\n"}`, 0)
+	if err != nil || result.IsError {
+		t.Errorf("write without a tracker = %+v, %v", result, err)
+	}
+}
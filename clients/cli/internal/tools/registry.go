@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
@@ -16,16 +18,122 @@ type Tool interface {
 	Execute(ctx context.Context, arguments string) (*ToolResult, error)
 }
 
+// DefaultToolTimeout bounds a single tool call in DefaultRegistry.
+const DefaultToolTimeout = 60 * time.Second
+
 // Registry holds a set of tools keyed by name.
 type Registry struct {
-	tools map[string]Tool
-	order []string
+	tools    map[string]Tool
+	order    []string
+	timeout  time.Duration            // applies to tools without an override; 0 = none
+	timeouts map[string]time.Duration // per-tool overrides
+	// processors rewrite each tool's results, in order, before they are
+	// returned.
+	processors map[string][]ResultProcessor
+	readFirst  bool // refuse changes to files not read this run
+	compact    bool // APITools sends shortened schemas
 }
 
-// NewRegistry creates an empty Registry.
+// NewRegistry creates an empty Registry with no timeouts.
 func NewRegistry() *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:      make(map[string]Tool),
+		timeouts:   make(map[string]time.Duration),
+		processors: make(map[string][]ResultProcessor),
+	}
+}
+
+// SetTimeout sets the default timeout for every tool call. 0 disables it.
+func (r *Registry) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// SetToolTimeout overrides the timeout for a single tool. 0 disables it for
+// that tool even when a default is set.
+func (r *Registry) SetToolTimeout(name string, d time.Duration) {
+	r.timeouts[name] = d
+}
+
+// Timeout returns the effective timeout for the named tool.
+func (r *Registry) Timeout(name string) time.Duration {
+	if d, ok := r.timeouts[name]; ok {
+		return d
+	}
+	return r.timeout
+}
+
+// SetProcessors replaces the chain of processors applied to the named
+// tool's results. No processors leaves its results as the tool returns them.
+func (r *Registry) SetProcessors(name string, procs ...ResultProcessor) {
+	if len(procs) == 0 {
+		delete(r.processors, name)
+		return
+	}
+	r.processors[name] = procs
+}
+
+// SetRequireReadBeforeWrite turns on a policy refusing file_write and
+// patch_file on an existing file that file_read has not read during the
+// current agent run, with an error telling the model to read it first. It
+// only applies when the context passed to Execute carries a ReadTracker.
+func (r *Registry) SetRequireReadBeforeWrite(on bool) {
+	r.readFirst = on
+}
+
+// Execute runs the named tool under the given timeout (0 = none).
+//
+// It returns as soon as ctx is cancelled, even if the tool is blocked in a
+// call that ignores ctx; the tool's goroutine then finishes in the
+// background and its result is discarded. Cancellation is reported as a Go
+// error, a timeout as an error result the model can react to.
+func (r *Registry) Execute(ctx context.Context, name, arguments string, timeout time.Duration) (*ToolResult, error) {
+	tool := r.tools[name]
+	if tool == nil {
+		return ErrorResult(fmt.Sprintf("unknown tool: %s", name)), nil
+	}
+	tracker := ReadTrackerFrom(ctx)
+	if r.readFirst && tracker != nil {
+		if refused := checkReadBeforeWrite(tracker, name, arguments); refused != nil {
+			return refused, nil
+		}
+	}
+
+	callCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result *ToolResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := tool.Execute(callCtx, arguments)
+		done <- outcome{res, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+			return ErrorResult(fmt.Sprintf("%s timed out after %s", name, timeout)), nil
+		}
+		if out.err == nil && out.result != nil {
+			if tracker != nil && !out.result.IsError {
+				recordRead(tracker, name, arguments)
+			}
+			for _, p := range r.processors[name] {
+				out.result = p.Process(arguments, out.result)
+			}
+		}
+		return out.result, out.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return ErrorResult(fmt.Sprintf("%s timed out after %s", name, timeout)), nil
 	}
 }
 
@@ -39,24 +147,72 @@ func (r *Registry) Register(t Tool) {
 	r.order = append(r.order, name)
 }
 
+// Replace swaps t in for the registered tool of the same name, keeping its
+// place, timeout and processors. Panics if there is no such tool.
+func (r *Registry) Replace(t Tool) {
+	name := t.Name()
+	if _, exists := r.tools[name]; !exists {
+		panic(fmt.Sprintf("tools: no tool named %q to replace", name))
+	}
+	r.tools[name] = t
+}
+
 // Get looks up a tool by name. Returns nil if not found.
 func (r *Registry) Get(name string) Tool {
 	return r.tools[name]
 }
 
+// Names returns the names of the registered tools, in registration order.
+func (r *Registry) Names() []string {
+	return slices.Clone(r.order)
+}
+
+// ReadOnlyToolNames lists the built-in tools that cannot modify the
+// filesystem or run commands.
+var ReadOnlyToolNames = []string{"file_read", "list_dir", "grep_search", "find_files", "memory_search"}
+
+// Subset returns a new registry holding only the named tools that are
+// registered here, in this registry's order, with the same timeouts, result
+// processors, read-before-write policy and compaction.
+func (r *Registry) Subset(names ...string) *Registry {
+	keep := make(map[string]bool, len(names))
+	for _, n := range names {
+		keep[n] = true
+	}
+
+	sub := NewRegistry()
+	sub.timeout = r.timeout
+	sub.readFirst = r.readFirst
+	sub.compact = r.compact
+	for _, name := range r.order {
+		if keep[name] {
+			sub.Register(r.tools[name])
+			if d, ok := r.timeouts[name]; ok {
+				sub.timeouts[name] = d
+			}
+			if procs, ok := r.processors[name]; ok {
+				sub.processors[name] = procs
+			}
+		}
+	}
+	return sub
+}
+
 // APITools returns the tools in OpenAI API format for inclusion in requests.
 func (r *Registry) APITools() []api.Tool {
 	out := make([]api.Tool, 0, len(r.order))
 	for _, name := range r.order {
 		t := r.tools[name]
-		out = append(out, api.Tool{
-			Type: "function",
-			Function: api.ToolFunction{
-				Name:        t.Name(),
-				Description: t.Description(),
-				Parameters:  t.Parameters(),
-			},
-		})
+		fn := api.ToolFunction{
+			Name:        t.Name(),
+			Description: t.Description(),
+			Parameters:  withAddedParameters(t.Parameters(), r.processors[name]),
+		}
+		if r.compact {
+			fn.Description = ShortDescription(fn.Description)
+			fn.Parameters = compactSchema(fn.Parameters)
+		}
+		out = append(out, api.Tool{Type: "function", Function: fn})
 	}
 	return out
 }
@@ -67,11 +223,37 @@ func DefaultRegistry() *Registry {
 	r.Register(&FileReadTool{})
 	r.Register(&FileWriteTool{})
 	r.Register(&PatchFileTool{})
+	r.Register(&MultiEditTool{})
+	r.Register(&ApplyDiffTool{})
 	r.Register(&ListDirTool{})
 	r.Register(&FindFilesTool{})
 	r.Register(&GrepSearchTool{})
-	r.Register(&GitInfoTool{})
+	r.Register(&CodeSymbolsTool{})
+	r.Register(&GitStatusTool{})
+	r.Register(&GitDiffTool{})
+	r.Register(&GitLogTool{})
+	r.Register(&GitBlameTool{})
+	r.Register(&RunTestsTool{})
 	r.Register(&ShellExecTool{})
+	r.Register(&ShellSessionTool{})
+	r.Register(&ProcessStartTool{})
+	r.Register(&ProcessStatusTool{})
+	r.Register(&ProcessLogsTool{})
+	r.Register(&ProcessStopTool{})
 	r.Register(&WebSearchTool{})
+
+	r.SetTimeout(DefaultToolTimeout)
+	// shell_exec, shell_session, process_start and run_tests enforce their
+	// own limits; leave them room to report.
+	r.SetToolTimeout("shell_exec", maxTimeout+10*time.Second)
+	r.SetToolTimeout("shell_session", maxTimeout+10*time.Second)
+	r.SetToolTimeout("process_start", maxProcessWait+10*time.Second)
+	r.SetToolTimeout("run_tests", maxTestTimeout+10*time.Second)
+
+	r.SetProcessors("file_read", Paginate(defaultPageLines, defaultPageBytes))
+	r.SetProcessors("shell_exec", StripANSI(), HeadTail(defaultHeadLines, defaultTailLines))
+	r.SetProcessors("shell_session", StripANSI(), HeadTail(defaultHeadLines, defaultTailLines))
+	r.SetProcessors("process_start", StripANSI())
+	r.SetProcessors("process_logs", StripANSI())
 	return r
 }
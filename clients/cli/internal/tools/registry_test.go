@@ -3,7 +3,9 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 )
 
 // mockTool is a minimal Tool implementation for testing.
@@ -18,6 +20,79 @@ func (m *mockTool) Execute(_ context.Context, _ string) (*ToolResult, error) {
 	return &ToolResult{Output: "ok"}, nil
 }
 
+// blockingTool ignores its context and blocks until released.
+type blockingTool struct {
+	release chan struct{}
+}
+
+func (b *blockingTool) Name() string                { return "blocking" }
+func (b *blockingTool) Description() string         { return "blocks" }
+func (b *blockingTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (b *blockingTool) Execute(_ context.Context, _ string) (*ToolResult, error) {
+	<-b.release
+	return &ToolResult{Output: "finished"}, nil
+}
+
+func TestRegistryTimeoutOverrides(t *testing.T) {
+	r := NewRegistry()
+	r.SetTimeout(time.Minute)
+	r.SetToolTimeout("slow", 5*time.Minute)
+	r.SetToolTimeout("unbounded", 0)
+
+	if got := r.Timeout("other"); got != time.Minute {
+		t.Errorf("default timeout = %v, want 1m", got)
+	}
+	if got := r.Timeout("slow"); got != 5*time.Minute {
+		t.Errorf("override = %v, want 5m", got)
+	}
+	if got := r.Timeout("unbounded"); got != 0 {
+		t.Errorf("disabled override = %v, want 0", got)
+	}
+}
+
+func TestRegistryExecuteTimeout(t *testing.T) {
+	tool := &blockingTool{release: make(chan struct{})}
+	defer close(tool.release)
+	r := NewRegistry()
+	r.Register(tool)
+
+	result, err := r.Execute(context.Background(), "blocking", "{}", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("timeout should be a tool result, got error %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("expected error result, got %q", result.Output)
+	}
+}
+
+func TestRegistryExecuteCancel(t *testing.T) {
+	tool := &blockingTool{release: make(chan struct{})}
+	defer close(tool.release)
+	r := NewRegistry()
+	r.Register(tool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := r.Execute(ctx, "blocking", "{}", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRegistryExecuteUnknown(t *testing.T) {
+	result, err := NewRegistry().Execute(context.Background(), "missing", "{}", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected error result for unknown tool")
+	}
+}
+
 func TestRegistryRegisterAndGet(t *testing.T) {
 	r := NewRegistry()
 	r.Register(&mockTool{name: "test_tool"})
@@ -74,10 +149,84 @@ func TestRegistryAPITools(t *testing.T) {
 
 func TestDefaultRegistryHasAllTools(t *testing.T) {
 	r := DefaultRegistry()
-	expected := []string{"file_read", "file_write", "list_dir", "shell_exec"}
+	expected := []string{"file_read", "file_write", "list_dir", "find_files", "shell_exec"}
 	for _, name := range expected {
 		if r.Get(name) == nil {
 			t.Errorf("DefaultRegistry missing tool %q", name)
 		}
 	}
 }
+
+func TestRegistrySubset(t *testing.T) {
+	r := DefaultRegistry()
+	RegisterMemoryTools(r, &fakeMemoryClient{})
+	r.SetToolTimeout("grep_search", time.Second)
+
+	sub := r.Subset(ReadOnlyToolNames...)
+	for _, name := range ReadOnlyToolNames {
+		if sub.Get(name) == nil {
+			t.Errorf("subset missing %s", name)
+		}
+	}
+	for _, name := range []string{"file_write", "patch_file", "shell_exec", "memory_store", "memory_forget"} {
+		if sub.Get(name) != nil {
+			t.Errorf("subset should not include %s", name)
+		}
+	}
+	if got := len(sub.APITools()); got != len(ReadOnlyToolNames) {
+		t.Errorf("subset has %d tools, want %d", got, len(ReadOnlyToolNames))
+	}
+	if got := sub.Timeout("grep_search"); got != time.Second {
+		t.Errorf("subset lost timeout override: %v", got)
+	}
+}
+
+func TestRegistryCompactAPITools(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&ShellExecTool{})
+	r.Register(&HTTPRequestTool{})
+	full := r.APITools()
+	r.SetCompact(true)
+	compact := r.APITools()
+
+	if got := compact[0].Function.Description; got != "Execute a shell command and return its output." {
+		t.Errorf("shell_exec description = %q", got)
+	}
+	for i := range compact {
+		if len(compact[i].Function.Parameters) > len(full[i].Function.Parameters) {
+			t.Errorf("%s: compact schema is larger", compact[i].Function.Name)
+		}
+	}
+	if sub := r.Subset("shell_exec").APITools(); sub[0].Function.Description != compact[0].Function.Description {
+		t.Error("Subset dropped compaction")
+	}
+}
+
+func TestCompactSchemaKeepsParameterNames(t *testing.T) {
+	in := json.RawMessage(`{"type":"object","title":"Args","properties":{"title":{"type":"string","description":"The title. Shown in bold.","examples":["Hi"]}}}`)
+	var got map[string]any
+	if err := json.Unmarshal(compactSchema(in), &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["title"]; ok {
+		t.Error("schema title kept")
+	}
+	prop, _ := got["properties"].(map[string]any)["title"].(map[string]any)
+	if prop == nil || prop["description"] != "The title." || prop["examples"] != nil {
+		t.Errorf("title parameter = %v", prop)
+	}
+}
+
+func TestShortDescription(t *testing.T) {
+	tests := map[string]string{
+		"Read a file. Supports offsets.":   "Read a file.",
+		"Search text, e.g. a regex. Fast.": "Search text, e.g. a regex.",
+		"One line only\nSecond line":       "One line only",
+		"No full stop":                     "No full stop",
+	}
+	for in, want := range tests {
+		if got := ShortDescription(in); got != want {
+			t.Errorf("ShortDescription(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
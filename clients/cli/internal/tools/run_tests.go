@@ -0,0 +1,517 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTestTimeout  = 300 * time.Second
+	maxTestTimeout      = 600 * time.Second
+	maxTestFailures     = 10 // failures listed in the summary
+	maxFailureLines     = 8  // message lines kept per failure
+	maxUnparsedTestTail = 60 // output lines shown when a run cannot be summarized
+)
+
+// RunTestsTool runs the project's test suite and returns a summary of the
+// results instead of the raw output: counts, and the first failures with
+// their file:line and message.
+type RunTestsTool struct{}
+
+type runTestsArgs struct {
+	Framework      string `json:"framework"`
+	Target         string `json:"target"`
+	Filter         string `json:"filter"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// testSummary is what a framework's parser extracts from a run.
+type testSummary struct {
+	passed, failed, skipped int
+	failures                []testFailure
+	errors                  []string // build or collection errors outside any test
+	parsed                  bool     // counts were found in the output
+}
+
+type testFailure struct {
+	name     string
+	location string // file:line, if known
+	message  []string
+}
+
+// testFramework knows how to run and summarize one kind of test suite.
+type testFramework struct {
+	name    string
+	detect  func() bool
+	command func(args runTestsArgs) []string
+	parse   func(stdout, stderr string) testSummary
+}
+
+var testFrameworks = []testFramework{
+	{name: "go", detect: func() bool { return fileExists("go.mod") }, command: goTestCommand, parse: parseGoTest},
+	{name: "npm", detect: hasNPMTestScript, command: npmTestCommand, parse: parseJSTest},
+	{name: "pytest", detect: detectPytest, command: pytestCommand, parse: parsePytest},
+}
+
+func (t *RunTestsTool) Name() string { return "run_tests" }
+
+func (t *RunTestsTool) Description() string {
+	return "Run the project's tests and return a condensed summary: pass/fail/skip counts and the first failures with file:line and message. Detects the framework (go test, npm test, pytest) from the files in the current directory. Prefer this over running the test command with shell_exec."
+}
+
+func (t *RunTestsTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"framework":       {Type: "string", Description: "go, npm or pytest (default: detected)"},
+			"target":          {Type: "string", Description: "Package, directory or test file to run (default: everything, e.g. ./... for Go)"},
+			"filter":          {Type: "string", Description: "Only run tests whose name matches (go -run, pytest -k, or a pattern passed to npm test)"},
+			"timeout_seconds": {Type: "integer", Description: fmt.Sprintf("Timeout in seconds (default %d, max %d)", int(defaultTestTimeout.Seconds()), int(maxTestTimeout.Seconds()))},
+		},
+	}.MustMarshal()
+}
+
+func (t *RunTestsTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args runTestsArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+
+	fw, err := pickTestFramework(args.Framework)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+
+	timeout := defaultTestTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(args.TimeoutSeconds)*time.Second, maxTestTimeout)
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	argv := fw.command(args)
+	cmd := exec.CommandContext(runCtx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "CI=1", "NO_COLOR=1", "FORCE_COLOR=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+	elapsed := time.Since(start).Round(100 * time.Millisecond)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	command := strings.Join(argv, " ")
+	if runCtx.Err() == context.DeadlineExceeded {
+		return ErrorResult(fmt.Sprintf("%s timed out after %s\n\n%s", command, timeout, outputTail(stdout.String()+stderr.String()))), nil
+	}
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return ErrorResult(fmt.Sprintf("could not run %s: %v", command, runErr)), nil
+	}
+
+	summary := fw.parse(stdout.String(), stderr.String())
+	output := formatTestSummary(command, elapsed, runErr == nil, summary, stdout.String()+stderr.String())
+	if runErr != nil {
+		return ErrorResult(output), nil
+	}
+	return &ToolResult{Output: output}, nil
+}
+
+func pickTestFramework(name string) (testFramework, error) {
+	for _, fw := range testFrameworks {
+		if name != "" && fw.name == name {
+			return fw, nil
+		}
+		if name == "" && fw.detect() {
+			return fw, nil
+		}
+	}
+	if name != "" {
+		return testFramework{}, fmt.Errorf("unknown framework %q: use go, npm or pytest", name)
+	}
+	return testFramework{}, fmt.Errorf("could not detect a test framework in the current directory (looked for go.mod, a package.json test script, and pytest config); pass framework or use shell_exec")
+}
+
+// formatTestSummary renders the result for the model. When nothing could be
+// parsed it falls back to the tail of the raw output.
+func formatTestSummary(command string, elapsed time.Duration, ok bool, s testSummary, raw string) string {
+	var b strings.Builder
+	status := "PASSED"
+	if !ok {
+		status = "FAILED"
+	}
+	fmt.Fprintf(&b, "%s: %s", command, status)
+	if s.parsed {
+		fmt.Fprintf(&b, " — %d passed, %d failed, %d skipped", s.passed, s.failed, s.skipped)
+	}
+	fmt.Fprintf(&b, " (%s)\n", elapsed)
+
+	if len(s.errors) > 0 {
+		b.WriteString("\nErrors:\n")
+		for _, e := range s.errors {
+			b.WriteString("  " + e + "\n")
+		}
+	}
+	if len(s.failures) > 0 {
+		shown := min(len(s.failures), maxTestFailures)
+		fmt.Fprintf(&b, "\nFailures (showing %d of %d):\n", shown, len(s.failures))
+		for i, f := range s.failures[:shown] {
+			fmt.Fprintf(&b, "%d. %s", i+1, f.name)
+			if f.location != "" {
+				fmt.Fprintf(&b, "  %s", f.location)
+			}
+			b.WriteString("\n")
+			msg := f.message
+			if len(msg) > maxFailureLines {
+				msg = append(msg[:maxFailureLines:maxFailureLines], fmt.Sprintf("… %d more lines", len(f.message)-maxFailureLines))
+			}
+			for _, l := range msg {
+				b.WriteString("   " + l + "\n")
+			}
+		}
+	}
+	if !ok && len(s.failures) == 0 && len(s.errors) == 0 {
+		b.WriteString("\nCould not summarize the output; last lines:\n" + outputTail(raw))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// outputTail returns the last maxUnparsedTestTail lines of output without
+// terminal escapes.
+func outputTail(output string) string {
+	lines := strings.Split(strings.TrimRight(ansiEscape.ReplaceAllString(output, ""), "\n"), "\n")
+	if len(lines) > maxUnparsedTestTail {
+		lines = append([]string{fmt.Sprintf("… %d lines omitted", len(lines)-maxUnparsedTestTail)}, lines[len(lines)-maxUnparsedTestTail:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Go
+
+func goTestCommand(args runTestsArgs) []string {
+	target := args.Target
+	if target == "" {
+		target = "./..."
+	}
+	argv := []string{"go", "test", "-json", target}
+	if args.Filter != "" {
+		argv = append(argv, "-run", args.Filter)
+	}
+	return argv
+}
+
+type goTestEvent struct {
+	Action     string
+	Package    string
+	ImportPath string
+	Test       string
+	Output     string
+}
+
+var goLocation = regexp.MustCompile(`^\s*(\S+\.go:\d+)(?::\d+)?: `)
+
+// parseGoTest summarizes `go test -json` output. Only the deepest failing
+// tests are listed, since a failed subtest also fails its parents.
+func parseGoTest(stdout, stderr string) testSummary {
+	var s testSummary
+	output := make(map[string][]string) // by package + test; "" test for the package
+	var failed []goTestEvent
+
+	sc := bufio.NewScanner(strings.NewReader(stdout))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var ev goTestEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				s.errors = append(s.errors, line)
+			}
+			continue
+		}
+		key := ev.Package + " " + ev.Test
+		switch ev.Action {
+		case "build-output":
+			if line := strings.TrimRight(ev.Output, "\n"); line != "" && !strings.HasPrefix(line, "# ") {
+				s.errors = append(s.errors, line)
+			}
+		case "output":
+			output[key] = append(output[key], strings.TrimRight(ev.Output, "\n"))
+		case "pass", "fail", "skip":
+			if ev.Test == "" {
+				if ev.Action == "fail" && !packageHasFailure(failed, ev.Package) {
+					s.errors = append(s.errors, packageErrors(ev.Package, output[key])...)
+				}
+				continue
+			}
+			s.parsed = true
+			switch ev.Action {
+			case "pass":
+				s.passed++
+			case "fail":
+				s.failed++
+				failed = append(failed, ev)
+			case "skip":
+				s.skipped++
+			}
+		}
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "# ") && !strings.HasPrefix(line, "go: downloading") {
+			s.errors = append(s.errors, line)
+		}
+	}
+
+	for _, ev := range failed {
+		if hasFailedSubtest(failed, ev) {
+			continue
+		}
+		f := testFailure{name: ev.Test + " (" + ev.Package + ")"}
+		for _, line := range output[ev.Package+" "+ev.Test] {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") || trimmed == "" {
+				continue
+			}
+			if m := goLocation.FindStringSubmatch(line); m != nil && f.location == "" {
+				f.location = m[1]
+			}
+			f.message = append(f.message, trimmed)
+		}
+		s.failures = append(s.failures, f)
+	}
+	return s
+}
+
+func packageHasFailure(failed []goTestEvent, pkg string) bool {
+	for _, ev := range failed {
+		if ev.Package == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// packageErrors returns what a package that failed outside any test
+// printed (a panic in TestMain, a failed build), without go test's own
+// FAIL lines.
+func packageErrors(pkg string, lines []string) []string {
+	var errs []string
+	for _, line := range lines {
+		if line == "FAIL" || strings.HasPrefix(line, "FAIL\t") || strings.HasPrefix(line, "ok  \t") || line == "" {
+			continue
+		}
+		errs = append(errs, pkg+": "+strings.TrimSpace(line))
+	}
+	return errs
+}
+
+func hasFailedSubtest(failed []goTestEvent, parent goTestEvent) bool {
+	for _, ev := range failed {
+		if ev.Package == parent.Package && strings.HasPrefix(ev.Test, parent.Test+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pytest
+
+func detectPytest() bool {
+	for _, f := range []string{"pytest.ini", "pyproject.toml", "setup.cfg", "tox.ini", "conftest.py", "setup.py"} {
+		if fileExists(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func pytestCommand(args runTestsArgs) []string {
+	argv := []string{"python3", "-m", "pytest"}
+	if _, err := exec.LookPath("pytest"); err == nil {
+		argv = []string{"pytest"}
+	}
+	argv = append(argv, "-q", "-rfE", "--tb=short", "--color=no")
+	if args.Filter != "" {
+		argv = append(argv, "-k", args.Filter)
+	}
+	if args.Target != "" {
+		argv = append(argv, args.Target)
+	}
+	return argv
+}
+
+var (
+	pytestCount    = regexp.MustCompile(`(\d+) (passed|failed|skipped|errors?|xfailed|xpassed)`)
+	pytestFinal    = regexp.MustCompile(`\d+ (passed|failed|skipped|errors?|deselected|xfailed|xpassed).* in [\d.]+s`)
+	pytestSection  = regexp.MustCompile(`^_{3,} (.+?) _{3,}$`)
+	pytestLocation = regexp.MustCompile(`^(\S+\.py:\d+): `)
+)
+
+// parsePytest summarizes `pytest -q -rfE --tb=short` output: counts from
+// the final line, failures from the short summary, and locations from the
+// tracebacks.
+func parsePytest(stdout, stderr string) testSummary {
+	var s testSummary
+	lines := strings.Split(stdout+"\n"+stderr, "\n")
+
+	// The last file:line in each traceback section is where it failed.
+	locations := make(map[string]string)
+	section := ""
+	for _, line := range lines {
+		if m := pytestSection.FindStringSubmatch(line); m != nil {
+			section = m[1]
+			continue
+		}
+		if m := pytestLocation.FindStringSubmatch(line); m != nil && section != "" {
+			locations[section] = m[1]
+		}
+	}
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "FAILED ") || strings.HasPrefix(line, "ERROR "):
+			kind, rest, _ := strings.Cut(line, " ")
+			id, msg, _ := strings.Cut(rest, " - ")
+			f := testFailure{name: id}
+			if kind == "ERROR" {
+				f.name += " (error)"
+			}
+			if msg != "" {
+				f.message = []string{msg}
+			}
+			// Sections are titled by the test's name within its file, e.g.
+			// "TestClass.test_x" for "file.py::TestClass::test_x".
+			if _, name, ok := strings.Cut(id, "::"); ok {
+				f.location = locations[strings.ReplaceAll(name, "::", ".")]
+			}
+			s.failures = append(s.failures, f)
+		case pytestFinal.MatchString(line):
+			s.parsed = true
+			s.passed, s.failed, s.skipped = 0, 0, 0
+			for _, m := range pytestCount.FindAllStringSubmatch(line, -1) {
+				n, _ := strconv.Atoi(m[1])
+				switch m[2] {
+				case "passed", "xpassed":
+					s.passed += n
+				case "failed", "error", "errors":
+					s.failed += n
+				case "skipped", "xfailed":
+					s.skipped += n
+				}
+			}
+		}
+	}
+	return s
+}
+
+// npm (Jest, Vitest and anything else behind "npm test")
+
+func hasNPMTestScript() bool {
+	data, err := os.ReadFile("package.json")
+	if err != nil {
+		return false
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return false
+	}
+	script := pkg.Scripts["test"]
+	return script != "" && !strings.Contains(script, "no test specified")
+}
+
+func npmTestCommand(args runTestsArgs) []string {
+	argv := []string{"npm", "test", "--silent"}
+	var extra []string
+	if args.Target != "" {
+		extra = append(extra, args.Target)
+	}
+	if args.Filter != "" {
+		extra = append(extra, "-t", args.Filter)
+	}
+	if len(extra) > 0 {
+		argv = append(append(argv, "--"), extra...)
+	}
+	return argv
+}
+
+var (
+	jsCountLine   = regexp.MustCompile(`^\s*Tests:?\s+(.*)$`)
+	jsCount       = regexp.MustCompile(`(\d+) (passed|failed|skipped|todo|pending)`)
+	jestFailure   = regexp.MustCompile(`^\s*● (.+)$`)
+	vitestFailure = regexp.MustCompile(`^\s*(?:FAIL|×|✕)\s+(.+)$`)
+	jsLocation    = regexp.MustCompile(`((?:[\w.\-]+/)*[\w.\-]+\.[cm]?[jt]sx?):(\d+)(?::\d+)?`)
+)
+
+// parseJSTest summarizes Jest or Vitest output: counts from the "Tests:"
+// line and failures from their "●" or "FAIL" headers, located by the first
+// stack frame outside node_modules.
+func parseJSTest(stdout, stderr string) testSummary {
+	var s testSummary
+	lines := strings.Split(ansiEscape.ReplaceAllString(stdout+"\n"+stderr, ""), "\n")
+
+	var cur *testFailure
+	for _, line := range lines {
+		if m := jsCountLine.FindStringSubmatch(line); m != nil && jsCount.MatchString(m[1]) {
+			s.parsed = true
+			for _, c := range jsCount.FindAllStringSubmatch(m[1], -1) {
+				n, _ := strconv.Atoi(c[1])
+				switch c[2] {
+				case "passed":
+					s.passed += n
+				case "failed":
+					s.failed += n
+				default:
+					s.skipped += n
+				}
+			}
+			cur = nil
+			continue
+		}
+		if m := jestFailure.FindStringSubmatch(line); m != nil {
+			s.failures = append(s.failures, testFailure{name: m[1]})
+			cur = &s.failures[len(s.failures)-1]
+			continue
+		}
+		if m := vitestFailure.FindStringSubmatch(line); m != nil && strings.Contains(m[1], " > ") {
+			s.failures = append(s.failures, testFailure{name: m[1]})
+			cur = &s.failures[len(s.failures)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if m := jsLocation.FindStringSubmatch(trimmed); m != nil && !strings.Contains(trimmed, "node_modules") &&
+			(strings.HasPrefix(trimmed, "at ") || strings.HasPrefix(trimmed, "❯ ")) {
+			if cur.location == "" {
+				cur.location = m[1] + ":" + m[2]
+			}
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "at ") && !strings.HasPrefix(trimmed, "❯ ") {
+			cur.message = append(cur.message, trimmed)
+		}
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunTestsGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not installed")
+	}
+	t.Chdir(t.TempDir())
+	os.WriteFile("go.mod", []byte("module example.com/x\n\ngo 1.21\n"), 0644)
+	os.WriteFile("x_test.go", []byte(`package x
+
+import "testing"
+
+func TestPass(t *testing.T) {}
+
+func TestParent(t *testing.T) {
+	t.Run("child", func(t *testing.T) {
+		t.Errorf("got %d, want %d", 1, 2)
+	})
+}
+
+func TestSkip(t *testing.T) { t.Skip("later") }
+`), 0644)
+
+	result := execTool(t, &RunTestsTool{}, map[string]any{})
+	if !result.IsError {
+		t.Fatalf("expected a failing run, got %q", result.Output)
+	}
+	for _, want := range []string{
+		"go test -json ./...: FAILED — 1 passed, 2 failed, 1 skipped",
+		"Failures (showing 1 of 1):",
+		"1. TestParent/child (example.com/x)  x_test.go:9",
+		"x_test.go:9: got 1, want 2",
+	} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("output missing %q:\n%s", want, result.Output)
+		}
+	}
+
+	passing := execTool(t, &RunTestsTool{}, map[string]any{"filter": "TestPass"})
+	if passing.IsError || !strings.Contains(passing.Output, "PASSED — 1 passed, 0 failed, 0 skipped") {
+		t.Errorf("filtered run = %q", passing.Output)
+	}
+}
+
+func TestParseGoTestBuildFailure(t *testing.T) {
+	stdout := `{"ImportPath":"x/y [x/y.test]","Action":"build-output","Output":"# x/y [x/y.test]\n"}
+{"ImportPath":"x/y [x/y.test]","Action":"build-output","Output":"y/y.go:2:12: undefined: missing\n"}
+{"ImportPath":"x/y [x/y.test]","Action":"build-fail"}
+{"Action":"start","Package":"x/y"}
+{"Action":"output","Package":"x/y","Output":"FAIL\tx/y [build failed]\n"}
+{"Action":"fail","Package":"x/y","FailedBuild":"x/y [x/y.test]"}
+`
+	s := parseGoTest(stdout, "")
+	if len(s.errors) != 1 || s.errors[0] != "y/y.go:2:12: undefined: missing" {
+		t.Errorf("errors = %q", s.errors)
+	}
+	if s.parsed || len(s.failures) != 0 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestParsePytest(t *testing.T) {
+	stdout := `..F.s
+=================================== FAILURES ===================================
+_____________________________ TestMath.test_add ______________________________
+tests/test_math.py:12: in test_add
+    assert add(1, 1) == 3
+E   assert 2 == 3
+=========================== short test summary info ============================
+FAILED tests/test_math.py::TestMath::test_add - assert 2 == 3
+1 failed, 3 passed, 1 skipped in 0.05s
+`
+	s := parsePytest(stdout, "")
+	if !s.parsed || s.passed != 3 || s.failed != 1 || s.skipped != 1 {
+		t.Errorf("counts = %+v", s)
+	}
+	if len(s.failures) != 1 {
+		t.Fatalf("failures = %+v", s.failures)
+	}
+	f := s.failures[0]
+	if f.name != "tests/test_math.py::TestMath::test_add" || f.location != "tests/test_math.py:12" || len(f.message) != 1 || f.message[0] != "assert 2 == 3" {
+		t.Errorf("failure = %+v", f)
+	}
+}
+
+func TestParseJest(t *testing.T) {
+	stdout := `FAIL src/sum.test.js
+  ● sum › adds numbers
+
+    expect(received).toBe(expected)
+
+    Expected: 4
+    Received: 3
+
+      at Object.<anonymous> (node_modules/expect/build/index.js:10:5)
+      at Object.<anonymous> (src/sum.test.js:5:17)
+
+Tests:       1 failed, 1 skipped, 4 passed, 6 total
+`
+	s := parseJSTest(stdout, "")
+	if !s.parsed || s.passed != 4 || s.failed != 1 || s.skipped != 1 {
+		t.Errorf("counts = %+v", s)
+	}
+	if len(s.failures) != 1 {
+		t.Fatalf("failures = %+v", s.failures)
+	}
+	f := s.failures[0]
+	if f.name != "sum › adds numbers" || f.location != "src/sum.test.js:5" || len(f.message) != 3 {
+		t.Errorf("failure = %+v", f)
+	}
+}
+
+func TestPickTestFramework(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if _, err := pickTestFramework(""); err == nil {
+		t.Error("expected no framework in an empty directory")
+	}
+
+	os.WriteFile("package.json", []byte(`{"scripts":{"test":"echo \"Error: no test specified\" && exit 1"}}`), 0644)
+	os.WriteFile("pyproject.toml", nil, 0644)
+	if fw, _ := pickTestFramework(""); fw.name != "pytest" {
+		t.Errorf("framework = %q, want pytest (npm placeholder script ignored)", fw.name)
+	}
+
+	os.WriteFile("package.json", []byte(`{"scripts":{"test":"jest"}}`), 0644)
+	if fw, _ := pickTestFramework(""); fw.name != "npm" {
+		t.Errorf("framework = %q, want npm", fw.name)
+	}
+	if fw, _ := pickTestFramework("go"); fw.name != "go" {
+		t.Errorf("explicit framework = %q, want go", fw.name)
+	}
+	if _, err := pickTestFramework("cargo"); err == nil {
+		t.Error("expected an error for an unknown framework")
+	}
+}
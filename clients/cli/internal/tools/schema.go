@@ -11,8 +11,13 @@ type Schema struct {
 
 // SchemaProperty describes a single property within a JSON Schema.
 type SchemaProperty struct {
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Items       *SchemaProperty `json:"items,omitempty"` // element schema for arrays
+	// Properties and Required describe the fields of an object, e.g. an
+	// array's items.
+	Properties map[string]SchemaProperty `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
 }
 
 // MustMarshal marshals the schema to json.RawMessage, panicking on error.
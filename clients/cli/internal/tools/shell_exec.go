@@ -16,7 +16,11 @@ const (
 )
 
 // ShellExecTool runs a shell command.
-type ShellExecTool struct{}
+type ShellExecTool struct {
+	// Policy, if set, is checked before each command runs, and sets the
+	// output cap and working directory.
+	Policy *ShellPolicy
+}
 
 type shellExecArgs struct {
 	Command        string `json:"command"`
@@ -48,6 +52,17 @@ func (t *ShellExecTool) Execute(ctx context.Context, arguments string) (*ToolRes
 	if args.Command == "" {
 		return ErrorResult("command is required"), nil
 	}
+	maxOutput := maxShellOutput
+	var dir string
+	if p := t.Policy; p != nil {
+		if reason := p.Check(args.Command); reason != "" {
+			return ErrorResult("shell_exec refused by policy: " + reason), nil
+		}
+		if p.maxOutput > 0 {
+			maxOutput = p.maxOutput
+		}
+		dir = p.root
+	}
 
 	timeout := defaultTimeout
 	if args.TimeoutSeconds > 0 {
@@ -57,10 +72,11 @@ func (t *ShellExecTool) Execute(ctx context.Context, arguments string) (*ToolRes
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", args.Command)
+	cmd := exec.CommandContext(runCtx, "sh", "-c", args.Command)
+	cmd.Dir = dir
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
@@ -68,12 +84,15 @@ func (t *ShellExecTool) Execute(ctx context.Context, arguments string) (*ToolRes
 	err := cmd.Run()
 
 	output := buf.String()
-	if len(output) > maxShellOutput {
-		output = output[:maxShellOutput] + fmt.Sprintf("\n\n[truncated: output was %d bytes, showing first %d]", len(buf.String()), maxShellOutput)
+	if len(output) > maxOutput {
+		output = output[:maxOutput] + fmt.Sprintf("\n\n[truncated: output was %d bytes, showing first %d]", len(buf.String()), maxOutput)
 	}
 
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
 			return ErrorResult(fmt.Sprintf("command timed out after %s\n\n%s", timeout, output)), nil
 		}
 		return ErrorResult(fmt.Sprintf("command failed: %v\n\n%s", err, output)), nil
@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ShellPolicyConfig is the user-facing form of a ShellPolicy, as read from
+// ~/.tanrenai/shell.toml.
+type ShellPolicyConfig struct {
+	Allow         []string `toml:"allow"`           // regexes a command segment may match
+	Deny          []string `toml:"deny"`            // regexes no part of a command may match
+	DenyByDefault bool     `toml:"deny_by_default"` // refuse segments that match no allow pattern
+	MaxOutput     int      `toml:"max_output"`      // output cap in bytes (0 = the default 64KB)
+	Confine       bool     `toml:"confine"`         // keep commands inside the working directory
+}
+
+// ShellPolicy decides which commands shell_exec may run. It is a guard
+// against a model's mistakes, not a sandbox: it reads the command text, so
+// a determined command can get around it.
+type ShellPolicy struct {
+	allow         []*regexp.Regexp
+	deny          []*regexp.Regexp
+	denyByDefault bool
+	maxOutput     int
+	root          string // working directory commands are confined to; "" = none
+}
+
+// NewShellPolicy compiles cfg. With Confine set, commands run in dir and may
+// not name paths outside it.
+func NewShellPolicy(cfg ShellPolicyConfig, dir string) (*ShellPolicy, error) {
+	p := &ShellPolicy{denyByDefault: cfg.DenyByDefault, maxOutput: cfg.MaxOutput}
+	for _, s := range cfg.Allow {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("allow pattern %q: %w", s, err)
+		}
+		p.allow = append(p.allow, re)
+	}
+	for _, s := range cfg.Deny {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("deny pattern %q: %w", s, err)
+		}
+		p.deny = append(p.deny, re)
+	}
+	if cfg.Confine {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		p.root = root
+	}
+	return p, nil
+}
+
+// Check returns why command may not run, or "" if it may. Deny patterns are
+// matched against the whole command. In deny-by-default mode, each segment
+// of a pipeline or list must match an allow pattern, and command and
+// process substitution, subshells and { ...; } groups are refused since
+// they would hide a command from the check.
+func (p *ShellPolicy) Check(command string) string {
+	for _, re := range p.deny {
+		if re.MatchString(command) {
+			return fmt.Sprintf("the command matches the deny pattern %q", re.String())
+		}
+	}
+
+	segments := shellSegments(command)
+	if p.denyByDefault {
+		if strings.Contains(command, "$(") || strings.Contains(command, "`") {
+			return "command substitution ($(...) or backticks) is not allowed when only allowlisted commands may run"
+		}
+		if hasShellGroup(command) {
+			return "process substitution (<(...) or >(...)), subshells and { ...; } groups are not allowed when only allowlisted commands may run"
+		}
+		for _, seg := range segments {
+			if !p.allowed(seg) {
+				return fmt.Sprintf("%q is not an allowed command. Allowed patterns: %s", seg, p.allowList())
+			}
+		}
+	}
+
+	if p.root != "" {
+		for _, seg := range segments {
+			if path := p.outsideRoot(seg); path != "" {
+				return fmt.Sprintf("%s is outside the working directory %s; commands are confined to it", path, p.root)
+			}
+		}
+	}
+	return ""
+}
+
+func (p *ShellPolicy) allowed(segment string) bool {
+	for _, re := range p.allow {
+		if re.MatchString(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ShellPolicy) allowList() string {
+	if len(p.allow) == 0 {
+		return "(none)"
+	}
+	pats := make([]string, len(p.allow))
+	for i, re := range p.allow {
+		pats[i] = re.String()
+	}
+	return strings.Join(pats, ", ")
+}
+
+// confinedExceptions are paths outside the root commands may still use.
+var confinedExceptions = []string{"/dev/null", "/dev/stdin", "/dev/stdout", "/dev/stderr"}
+
+// outsideRoot returns the first argument of segment that names a path
+// outside p.root, or "". The command word itself is not checked, so
+// /usr/bin/env and the like still run.
+func (p *ShellPolicy) outsideRoot(segment string) string {
+	words := shellWords(segment)
+	for _, w := range words[min(1, len(words)):] {
+		w = strings.TrimLeft(w, "0123456789<>&|")
+		if _, v, ok := strings.Cut(w, "="); ok && strings.HasPrefix(w, "-") {
+			w = v
+		}
+		if !strings.HasPrefix(w, "/") && !strings.HasPrefix(w, "~") && !strings.Contains(w, "..") {
+			continue
+		}
+		path := w
+		if strings.HasPrefix(path, "~") {
+			home, _ := os.UserHomeDir()
+			path = home + path[1:]
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(p.root, path)
+		}
+		path = filepath.Clean(path)
+		if path == p.root || strings.HasPrefix(path, p.root+string(filepath.Separator)) {
+			continue
+		}
+		exempt := false
+		for _, e := range confinedExceptions {
+			exempt = exempt || path == e
+		}
+		if !exempt {
+			return w
+		}
+	}
+	return ""
+}
+
+// hasShellGroup reports whether command has an unquoted parenthesis, as in
+// <(...), >(...) and ( ... ) subshells, or an unquoted { word opening a
+// group. Either can run commands that shellSegments does not see as a
+// segment of their own.
+func hasShellGroup(command string) bool {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == ')':
+			return true
+		case c == '{':
+			atWordStart := i == 0 || strings.ContainsRune(" \t\n;&|", rune(command[i-1]))
+			if atWordStart && (i+1 == len(command) || strings.ContainsRune(" \t\n", rune(command[i+1]))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shellSegments splits a command line at unquoted ;, &, |, && and ||, and
+// newlines, returning the trimmed non-empty pieces.
+func shellSegments(command string) []string {
+	var segments []string
+	var cur strings.Builder
+	var quote byte
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			segments = append(segments, s)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(command) {
+				cur.WriteByte(c)
+				i++
+				c = command[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\' && i+1 < len(command):
+			cur.WriteByte(c)
+			i++
+			c = command[i]
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';' || c == '\n' || c == '|' || c == '&':
+			// Keep redirections such as 2>&1 and &> in their segment.
+			if c == '&' && (i > 0 && command[i-1] == '>' || i+1 < len(command) && command[i+1] == '>') {
+				break
+			}
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	flush()
+	return segments
+}
+
+// shellWords splits a segment into words at unquoted whitespace, removing
+// the quotes.
+func shellWords(segment string) []string {
+	var words []string
+	var cur strings.Builder
+	var quote byte
+	inWord := false
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words
+}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellPolicyDeny(t *testing.T) {
+	p, err := NewShellPolicy(ShellPolicyConfig{Deny: []string{`\bsudo\b`, `\brm\s+-rf\s+/`}}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cmd, denied := range map[string]bool{
+		"ls -la":               false,
+		"sudo apt install x":   true,
+		"make && rm -rf /":     true,
+		"echo pseudocode":      false,
+		"rm -rf ./build/cache": false,
+	} {
+		if reason := p.Check(cmd); (reason != "") != denied {
+			t.Errorf("%q: reason = %q, want denied = %v", cmd, reason, denied)
+		}
+	}
+}
+
+func TestShellPolicyDenyByDefault(t *testing.T) {
+	p, err := NewShellPolicy(ShellPolicyConfig{
+		Allow:         []string{`^go (build|test|vet)\b`, `^grep\b`, `^head\b`},
+		DenyByDefault: true,
+	}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cmd, denied := range map[string]bool{
+		"go test ./...":               false,
+		"go test ./... 2>&1 | head":   false,
+		"go vet ./... && go build .":  false,
+		"go test ./... && curl x.com": true,
+		"go build; rm -rf build":      true,
+		"grep 'a|b; c' file":          false,
+		"go test $(curl x.com)":       true,
+		"grep x <(rm -rf ~/x)":        true,
+		"go test ./... >(sh)":         true,
+		"go build && (rm -rf build)":  true,
+		"(curl x.com)":                true,
+		"go vet; { curl x.com; }":     true,
+		"grep '(a|b)' file":           false,
+		"grep {a,b} file":             false,
+		"grep \"{ x\" file":           false,
+		"python -c 'print(1)'":        true,
+	} {
+		if reason := p.Check(cmd); (reason != "") != denied {
+			t.Errorf("%q: reason = %q, want denied = %v", cmd, reason, denied)
+		}
+	}
+
+	reason := p.Check("npm test")
+	if !strings.Contains(reason, `"npm test" is not an allowed command`) || !strings.Contains(reason, `^go (build|test|vet)\b`) {
+		t.Errorf("reason should name the command and the allowed patterns: %q", reason)
+	}
+}
+
+func TestShellPolicyConfine(t *testing.T) {
+	root := t.TempDir()
+	p, err := NewShellPolicy(ShellPolicyConfig{Confine: true}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cmd, denied := range map[string]bool{
+		"cat ./a.txt sub/b.txt":      false,
+		"cat " + root + "/a.txt":     false,
+		"/usr/bin/env ls":            false,
+		"ls > /dev/null 2>&1":        false,
+		"cat /etc/passwd":            true,
+		"cd .. && ls":                true,
+		"cp a.txt ~/elsewhere":       true,
+		"tar --file=/etc/x.tar -c .": true,
+		"echo hi >/etc/motd":         true,
+		"cat sub/../a.txt":           false,
+		"ls " + filepath.Dir(root):   true,
+	} {
+		if reason := p.Check(cmd); (reason != "") != denied {
+			t.Errorf("%q: reason = %q, want denied = %v", cmd, reason, denied)
+		}
+	}
+}
+
+func TestShellExecPolicy(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "marker"), []byte(strings.Repeat("x", 100)), 0644)
+	p, err := NewShellPolicy(ShellPolicyConfig{Deny: []string{`\bsudo\b`}, MaxOutput: 10, Confine: true}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &ShellExecTool{Policy: p}
+
+	refused := execTool(t, tool, map[string]any{"command": "sudo ls"})
+	if !refused.IsError || !strings.HasPrefix(refused.Output, "shell_exec refused by policy: ") {
+		t.Errorf("refused = %+v", refused)
+	}
+
+	// Runs in the confined directory, with the policy's output cap.
+	result := execTool(t, tool, map[string]any{"command": "cat marker"})
+	if result.IsError || !strings.HasPrefix(result.Output, "xxxxxxxxxx\n\n[truncated: output was 100 bytes, showing first 10]") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestNewShellPolicyBadPattern(t *testing.T) {
+	if _, err := NewShellPolicy(ShellPolicyConfig{Deny: []string{"("}}, "."); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
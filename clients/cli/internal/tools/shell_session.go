@@ -0,0 +1,366 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultShellIdleTimeout is how long an unused shell_session shell lives.
+const DefaultShellIdleTimeout = 10 * time.Minute
+
+// ShellSessionTool runs commands in a long-lived shell, so cd, exported
+// variables and activated virtualenvs carry over from one call to the
+// next. Each agent run (identified by its ReadTracker, which sub-agents
+// share) gets its own shell, closed when the run ends, on reset, on a
+// timeout, or after IdleTimeout without use.
+//
+// On Linux the shell's stdout and stderr are a pseudo-terminal, so
+// programs print what they would in a terminal (progress bars, tables
+// sized to the window) rather than their piped output. Commands still get
+// no stdin: an agent cannot answer a prompt, and a command waiting on one
+// would only hang until its timeout.
+type ShellSessionTool struct {
+	// Policy, if set, is checked before each command runs, and sets the
+	// output cap and the directory new shells start in.
+	Policy *ShellPolicy
+	// IdleTimeout closes a shell left unused this long; 0 means
+	// DefaultShellIdleTimeout.
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[*ReadTracker]*shellSession
+}
+
+type shellSessionArgs struct {
+	Command        string `json:"command"`
+	Action         string `json:"action"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+func (t *ShellSessionTool) Name() string { return "shell_session" }
+
+func (t *ShellSessionTool) Description() string {
+	return "Run a command in a persistent shell that keeps its working directory, exported variables and activated environments between calls, e.g. \"cd web && npm install\" then \"npm test\". Use action \"reset\" to start over with a fresh shell. Output goes to a terminal, but commands get no stdin, so interactive programs and prompts will not work; pagers are disabled."
+}
+
+func (t *ShellSessionTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"command":         {Type: "string", Description: "The shell command to run"},
+			"action":          {Type: "string", Description: "\"run\" (default) or \"reset\" to close the shell; the next command starts a new one"},
+			"timeout_seconds": {Type: "integer", Description: "Timeout in seconds (default 30, max 120). A timed-out command resets the shell."},
+		},
+	}.MustMarshal()
+}
+
+func (t *ShellSessionTool) Execute(ctx context.Context, arguments string) (*ToolResult, error) {
+	var args shellSessionArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	key := ReadTrackerFrom(ctx)
+
+	switch args.Action {
+	case "reset":
+		t.close(key)
+		return &ToolResult{Output: "Shell session reset. The next command starts in a new shell."}, nil
+	case "", "run":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q: use \"run\" or \"reset\"", args.Action)), nil
+	}
+	if args.Command == "" {
+		return ErrorResult("command is required"), nil
+	}
+	maxOutput := maxShellOutput
+	var dir string
+	if p := t.Policy; p != nil {
+		if reason := p.Check(args.Command); reason != "" {
+			return ErrorResult("shell_session refused by policy: " + reason), nil
+		}
+		if p.maxOutput > 0 {
+			maxOutput = p.maxOutput
+		}
+		dir = p.root
+	}
+
+	timeout := defaultTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(args.TimeoutSeconds)*time.Second, maxTimeout)
+	}
+
+	s, err := t.session(ctx, key, dir)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start shell: %v", err)), nil
+	}
+	output, status, cwd, err := s.run(ctx, args.Command, timeout)
+	if len(output) > maxOutput {
+		output = output[:maxOutput] + fmt.Sprintf("\n\n[truncated: output was %d bytes, showing first %d]", len(output), maxOutput)
+	}
+	if err != nil {
+		// The shell may still be running the command; start afresh.
+		t.close(key)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == errShellTimeout {
+			return ErrorResult(fmt.Sprintf("command timed out after %s; the shell was reset, so directory and environment changes are lost\n\n%s", timeout, output)), nil
+		}
+		return ErrorResult(fmt.Sprintf("shell exited (%v); the next command starts a new shell\n\n%s", err, output)), nil
+	}
+
+	s.touch()
+
+	if output == "" {
+		output = "(no output)"
+	}
+	if cwd != "" {
+		output += "\n\n[working directory is now " + cwd + "]"
+	}
+	if status != 0 {
+		return ErrorResult(fmt.Sprintf("command failed: exit status %d\n\n%s", status, output)), nil
+	}
+	return &ToolResult{Output: output}, nil
+}
+
+// session returns key's shell, starting one in dir if there is none or the
+// last one has exited. A new shell is closed when ctx's run ends.
+func (t *ShellSessionTool) session(ctx context.Context, key *ReadTracker, dir string) (*shellSession, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.sessions[key]; s != nil && !s.exited() {
+		s.touch()
+		return s, nil
+	}
+	idle := t.IdleTimeout
+	if idle <= 0 {
+		idle = DefaultShellIdleTimeout
+	}
+	s, err := startShellSession(dir, idle, func(s *shellSession) {
+		t.mu.Lock()
+		if t.sessions[key] == s {
+			delete(t.sessions, key)
+		}
+		t.mu.Unlock()
+		s.kill()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.sessions == nil {
+		t.sessions = make(map[*ReadTracker]*shellSession)
+	}
+	t.sessions[key] = s
+	if pt := ProcessTableFrom(ctx); pt != nil {
+		pt.OnStop(func() { t.close(key) })
+	}
+	return s, nil
+}
+
+// close kills key's shell, if it has one.
+func (t *ShellSessionTool) close(key *ReadTracker) {
+	t.mu.Lock()
+	s := t.sessions[key]
+	delete(t.sessions, key)
+	t.mu.Unlock()
+	if s != nil {
+		s.kill()
+	}
+}
+
+// Close kills every shell, for use when the program exits.
+func (t *ShellSessionTool) Close() {
+	t.mu.Lock()
+	sessions := t.sessions
+	t.sessions = nil
+	t.mu.Unlock()
+	for _, s := range sessions {
+		s.kill()
+	}
+}
+
+var errShellTimeout = errors.New("command timed out")
+
+// shellSession is one shell process. Commands are written to its stdin;
+// stdout and stderr share a terminal that a goroutine drains into out.
+type shellSession struct {
+	cmd   *exec.Cmd
+	stdin *os.File
+	idle  *time.Timer
+	wait  time.Duration
+
+	runMu sync.Mutex // one command at a time
+
+	mu     sync.Mutex
+	out    bytes.Buffer
+	cwd    string        // directory after the last command
+	notify chan struct{} // signalled when out grows
+	done   chan struct{} // closed when the output reaches EOF
+}
+
+func startShellSession(dir string, idle time.Duration, onIdle func(*shellSession)) (*shellSession, error) {
+	shell := "sh"
+	if _, err := exec.LookPath("bash"); err == nil {
+		shell = "bash"
+	}
+	args := []string{}
+	if shell == "bash" {
+		args = []string{"--noprofile", "--norc"}
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := openTerminal()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+	cmd := exec.Command(shell, args...)
+	cmd.Dir = dir
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = outW
+	cmd.Env = append(os.Environ(), "PAGER=cat", "GIT_PAGER=cat")
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, err
+	}
+
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	s := &shellSession{
+		cmd:    cmd,
+		cwd:    dir,
+		stdin:  inW,
+		wait:   idle,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.idle = time.AfterFunc(idle, func() { onIdle(s) })
+	go s.drain(outR)
+	go cmd.Wait()
+	return s, nil
+}
+
+// drain copies the shell's output into out until every writer has closed
+// it, which a terminal reports as an error rather than EOF.
+func (s *shellSession) drain(r *os.File) {
+	defer close(s.done)
+	defer r.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.out.Write(buf[:n])
+			s.mu.Unlock()
+			select {
+			case s.notify <- struct{}{}:
+			default:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *shellSession) touch() { s.idle.Reset(s.wait) }
+
+func (s *shellSession) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *shellSession) kill() {
+	s.idle.Stop()
+	s.stdin.Close()
+	killProcessGroup(s.cmd)
+}
+
+// run sends command to the shell and waits for the end marker that
+// follows it. It returns the output, the exit status and the working
+// directory if the command changed it. The command runs through eval so a
+// syntax error does not end the shell, with stdin from /dev/null so it
+// cannot read the commands that follow.
+func (s *shellSession) run(ctx context.Context, command string, timeout time.Duration) (string, int, string, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	marker := "__tanrenai_" + hex.EncodeToString(id) + "__"
+
+	s.mu.Lock()
+	s.out.Reset()
+	s.mu.Unlock()
+
+	script := fmt.Sprintf("eval %s </dev/null 2>&1\nprintf '\\n%s %%d %%s\\n' \"$?\" \"$PWD\"\n", shellQuote(command), marker)
+	if _, err := s.stdin.WriteString(script); err != nil {
+		return "", 0, "", err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		out := s.out.String()
+		s.mu.Unlock()
+		if i := strings.Index(out, "\n"+marker+" "); i >= 0 {
+			if rest, ok := strings.CutSuffix(out[i+len(marker)+2:], "\n"); ok {
+				statusText, cwd, _ := strings.Cut(rest, " ")
+				status, _ := strconv.Atoi(statusText)
+				s.mu.Lock()
+				changed := cwd != s.cwd
+				s.cwd = cwd
+				s.mu.Unlock()
+				if !changed {
+					cwd = ""
+				}
+				return out[:i], status, cwd, nil
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+			s.mu.Lock()
+			out = s.out.String()
+			s.mu.Unlock()
+			return out, 0, "", errors.New("the shell ended")
+		case <-timer.C:
+			return out, 0, "", errShellTimeout
+		case <-ctx.Done():
+			return out, 0, "", ctx.Err()
+		}
+	}
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,12 @@
+package tools
+
+import "testing"
+
+func TestShellSessionOutputIsTerminal(t *testing.T) {
+	tool := &ShellSessionTool{}
+	defer tool.Close()
+	result := execTool(t, tool, map[string]any{"command": "test -t 1 && test -t 2 && echo tty; test -t 0 || echo no stdin; echo $PAGER"})
+	if result.IsError || result.Output != "tty\nno stdin\ncat\n" {
+		t.Errorf("result = %+v", result)
+	}
+}
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShellSessionKeepsState(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	p, err := NewShellPolicy(ShellPolicyConfig{Confine: true}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &ShellSessionTool{Policy: p}
+	defer tool.Close()
+
+	cd := execTool(t, tool, map[string]any{"command": "cd sub && export GREETING=hello"})
+	if cd.IsError || !strings.HasSuffix(cd.Output, "[working directory is now "+filepath.Join(root, "sub")+"]") {
+		t.Fatalf("cd = %+v", cd)
+	}
+	result := execTool(t, tool, map[string]any{"command": "echo $GREETING; basename $PWD"})
+	if result.IsError || result.Output != "hello\nsub\n" {
+		t.Errorf("second command = %+v", result)
+	}
+
+	failed := execTool(t, tool, map[string]any{"command": "echo oops >&2; false"})
+	if !failed.IsError || failed.Output != "command failed: exit status 1\n\noops\n" {
+		t.Errorf("failed = %+v", failed)
+	}
+	// A syntax error fails the command, not the shell.
+	if bad := execTool(t, tool, map[string]any{"command": "if then"}); !bad.IsError {
+		t.Errorf("syntax error = %+v", bad)
+	}
+
+	execTool(t, tool, map[string]any{"action": "reset"})
+	fresh := execTool(t, tool, map[string]any{"command": "echo \"[$GREETING]\"; pwd"})
+	if fresh.Output != "[]\n"+root+"\n" {
+		t.Errorf("after reset = %+v", fresh)
+	}
+}
+
+func TestShellSessionTimeoutResets(t *testing.T) {
+	tool := &ShellSessionTool{}
+	defer tool.Close()
+	execTool(t, tool, map[string]any{"command": "export KEPT=1"})
+
+	result := execTool(t, tool, map[string]any{"command": "echo started; sleep 30", "timeout_seconds": 1})
+	if !result.IsError || !strings.HasPrefix(result.Output, "command timed out after 1s; the shell was reset") || !strings.HasSuffix(result.Output, "started\n") {
+		t.Errorf("result = %+v", result)
+	}
+	after := execTool(t, tool, map[string]any{"command": "echo \"[$KEPT]\""})
+	if after.Output != "[]\n" {
+		t.Errorf("after timeout = %+v", after)
+	}
+}
+
+func TestShellSessionPerRun(t *testing.T) {
+	tool := &ShellSessionTool{}
+	defer tool.Close()
+	run1 := WithReadTracker(context.Background(), NewReadTracker())
+	run2 := WithReadTracker(context.Background(), NewReadTracker())
+
+	if _, err := tool.Execute(run1, `{"command":"export RUN=one"}`); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := tool.Execute(run2, `{"command":"echo \"[$RUN]\""}`)
+	same, _ := tool.Execute(run1, `{"command":"echo \"[$RUN]\""}`)
+	if other.Output != "[]\n" || same.Output != "[one]\n" {
+		t.Errorf("other run = %q, same run = %q", other.Output, same.Output)
+	}
+}
+
+func TestShellSessionIdleCleanup(t *testing.T) {
+	tool := &ShellSessionTool{IdleTimeout: 50 * time.Millisecond}
+	defer tool.Close()
+	execTool(t, tool, map[string]any{"command": "export IDLE=1"})
+	time.Sleep(200 * time.Millisecond)
+
+	tool.mu.Lock()
+	open := len(tool.sessions)
+	tool.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d sessions still open after the idle timeout", open)
+	}
+	if result := execTool(t, tool, map[string]any{"command": "echo \"[$IDLE]\""}); result.Output != "[]\n" {
+		t.Errorf("after idle = %+v", result)
+	}
+}
+
+func TestShellSessionClosedWhenRunEnds(t *testing.T) {
+	tool := &ShellSessionTool{}
+	defer tool.Close()
+	pt := NewProcessTable()
+	ctx := WithProcessTable(WithReadTracker(context.Background(), NewReadTracker()), pt)
+
+	if _, err := tool.Execute(ctx, `{"command":"true"}`); err != nil {
+		t.Fatal(err)
+	}
+	pt.StopAll()
+
+	tool.mu.Lock()
+	open := len(tool.sessions)
+	tool.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d sessions still open after the run ended", open)
+	}
+}
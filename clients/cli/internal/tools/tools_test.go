@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
 )
 
 func TestFileReadValid(t *testing.T) {
@@ -41,7 +44,7 @@ func TestFileReadNotFound(t *testing.T) {
 func TestFileReadTruncation(t *testing.T) {
 	tmp := t.TempDir()
 	path := filepath.Join(tmp, "big.txt")
-	data := make([]byte, 64*1024) // 64KB, exceeds 32KB limit
+	data := make([]byte, maxFileReadBytes+1024)
 	for i := range data {
 		data[i] = 'A'
 	}
@@ -516,3 +519,204 @@ func TestIsRealPath(t *testing.T) {
 		}
 	}
 }
+
+func TestFindFilesDoublestar(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "pkg", "sub"), 0755)
+	os.WriteFile(filepath.Join(tmp, "main.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "main_test.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "pkg", "sub", "a_test.go"), []byte("x"), 0644)
+
+	tool := &FindFilesTool{}
+	result, err := tool.Execute(context.Background(), `{"pattern":"**/*_test.go","path":"`+tmp+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Output)
+	}
+	if !strings.Contains(result.Output, "main_test.go") || !strings.Contains(result.Output, "pkg/sub/a_test.go") {
+		t.Errorf("missing matches: %q", result.Output)
+	}
+	if strings.Contains(result.Output, "main.go\n") || strings.Contains(result.Output, tmp) {
+		t.Errorf("expected only relative test files: %q", result.Output)
+	}
+}
+
+func TestFindFilesMaxDepth(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(tmp, "top.txt"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "a", "mid.txt"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "a", "b", "deep.txt"), []byte("x"), 0644)
+
+	tool := &FindFilesTool{}
+	result, err := tool.Execute(context.Background(), `{"pattern":"*.txt","path":"`+tmp+`","max_depth":2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Output, "top.txt") || !strings.Contains(result.Output, "a/mid.txt") {
+		t.Errorf("missing shallow matches: %q", result.Output)
+	}
+	if strings.Contains(result.Output, "deep.txt") {
+		t.Errorf("max_depth not honoured: %q", result.Output)
+	}
+}
+
+func TestFindFilesGitignore(t *testing.T) {
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "build"), 0755)
+	os.WriteFile(filepath.Join(tmp, ".gitignore"), []byte("# comment\nbuild/\n*.log\n!keep.log\n"), 0644)
+	os.WriteFile(filepath.Join(tmp, "build", "out.txt"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "debug.log"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "keep.log"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "src.txt"), []byte("x"), 0644)
+
+	tool := &FindFilesTool{}
+	result, err := tool.Execute(context.Background(), `{"pattern":"*","path":"`+tmp+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"src.txt", "keep.log"} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("expected %s in output: %q", want, result.Output)
+		}
+	}
+	for _, unwanted := range []string{"out.txt", "debug.log"} {
+		if strings.Contains(result.Output, unwanted) {
+			t.Errorf("expected %s to be ignored: %q", unwanted, result.Output)
+		}
+	}
+}
+
+func TestFindFilesSortedByModTime(t *testing.T) {
+	tmp := t.TempDir()
+	old := filepath.Join(tmp, "old.go")
+	recent := filepath.Join(tmp, "new.go")
+	os.WriteFile(old, []byte("x"), 0644)
+	os.WriteFile(recent, []byte("x"), 0644)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(old, past, past)
+
+	tool := &FindFilesTool{}
+	result, err := tool.Execute(context.Background(), `{"pattern":"*.go","path":"`+tmp+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "new.go\nold.go\n" {
+		t.Errorf("got %q, want newest first", result.Output)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"cmd/**/main.go", "cmd/main.go", true},
+		{"cmd/**/main.go", "cmd/x/y/main.go", true},
+		{"cmd/*.go", "cmd/x/main.go", false},
+		{"docs/**", "docs/a/b.md", true},
+		{"*.go", "a/b.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+type fakeMemoryClient struct {
+	stored     []string
+	importance float32
+	results    []api.MemorySearchResult
+	deleted    []string
+}
+
+func (f *fakeMemoryClient) MemoryStore(ctx context.Context, userMsg, assistMsg string, importance float32) (string, error) {
+	f.stored = append(f.stored, assistMsg)
+	f.importance = importance
+	return "mem-1", nil
+}
+
+func (f *fakeMemoryClient) MemorySearch(ctx context.Context, query string, limit int) (*api.MemorySearchResponse, error) {
+	return &api.MemorySearchResponse{Results: f.results}, nil
+}
+
+func (f *fakeMemoryClient) MemoryDelete(ctx context.Context, id string) error {
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func TestMemoryStoreDefaultImportance(t *testing.T) {
+	client := &fakeMemoryClient{}
+	tool := &MemoryStoreTool{Client: client}
+
+	result, err := tool.Execute(context.Background(), `{"fact":"the deploy script lives in ops/deploy.sh"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Output)
+	}
+	if len(client.stored) != 1 || client.stored[0] != "the deploy script lives in ops/deploy.sh" {
+		t.Errorf("stored %v", client.stored)
+	}
+	if client.importance != defaultMemoryImportance {
+		t.Errorf("importance = %v, want %v", client.importance, defaultMemoryImportance)
+	}
+	if !strings.Contains(result.Output, "mem-1") {
+		t.Errorf("expected memory ID in output, got: %s", result.Output)
+	}
+}
+
+func TestMemoryStoreRejectsBadArgs(t *testing.T) {
+	client := &fakeMemoryClient{}
+	tool := &MemoryStoreTool{Client: client}
+
+	for _, args := range []string{`{"fact":""}`, `{"fact":"x","importance":1.5}`} {
+		result, err := tool.Execute(context.Background(), args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("expected tool error for %s", args)
+		}
+	}
+	if len(client.stored) != 0 {
+		t.Errorf("nothing should be stored, got %v", client.stored)
+	}
+}
+
+func TestMemorySearchFormatsFacts(t *testing.T) {
+	client := &fakeMemoryClient{results: []api.MemorySearchResult{
+		{Entry: api.MemoryEntry{ID: "abc", UserMsg: MemoryFactPrefix + "use make test", AssistMsg: "use make test"}, CombinedScore: 0.9},
+		{Entry: api.MemoryEntry{ID: "def", UserMsg: "how do I build?", AssistMsg: "run go build"}, CombinedScore: 0.5},
+	}}
+	tool := &MemorySearchTool{Client: client}
+
+	result, err := tool.Execute(context.Background(), `{"query":"tests"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"[abc]", "Fact: use make test", "[def]", "User: how do I build?", "Assistant: run go build"} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, result.Output)
+		}
+	}
+}
+
+func TestMemoryForget(t *testing.T) {
+	client := &fakeMemoryClient{}
+	tool := &MemoryForgetTool{Client: client}
+
+	result, err := tool.Execute(context.Background(), `{"id":"abc"}`)
+	if err != nil || result.IsError {
+		t.Fatalf("unexpected failure: %v %v", err, result)
+	}
+	if len(client.deleted) != 1 || client.deleted[0] != "abc" {
+		t.Errorf("deleted %v, want [abc]", client.deleted)
+	}
+}
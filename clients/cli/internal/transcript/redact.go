@@ -0,0 +1,64 @@
+package transcript
+
+import (
+	"regexp"
+
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// shellTools are the tools whose commands and output are redacted.
+var shellTools = map[string]bool{"shell_exec": true, "shell_session": true, "process_start": true, "process_logs": true}
+
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials commonly printed by shell commands (env,
+// cat .env, git remote -v, ...). Replacements keep the surrounding key so
+// the transcript still shows what was there.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), redacted},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), redacted},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{22,}`), redacted},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`), redacted},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`), redacted},
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}" + redacted},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`(?i)\b([A-Za-z0-9_.\-]*(?:password|passwd|secret|token|api[_\-]?key|access[_\-]?key|private[_\-]?key|credentials?)[A-Za-z0-9_.\-]*"?\s*[=:]\s*)("[^"\n]*"|'[^'\n]*'|[^\s"',;]+)`), "${1}" + redacted},
+}
+
+// Redact masks secrets in s.
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// redactShellMessages returns a copy of msgs with the shell tools' calls
+// and their results redacted.
+func redactShellMessages(msgs []api.Message) []api.Message {
+	out := make([]api.Message, len(msgs))
+	shellCalls := make(map[string]bool)
+	for i, msg := range msgs {
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]api.ToolCall, len(msg.ToolCalls))
+			for j, call := range msg.ToolCalls {
+				if shellTools[call.Function.Name] {
+					if call.ID != "" {
+						shellCalls[call.ID] = true
+					}
+					call.Function.Arguments = Redact(call.Function.Arguments)
+				}
+				calls[j] = call
+			}
+			msg.ToolCalls = calls
+		}
+		if msg.Role == "tool" && (shellTools[msg.Name] || shellCalls[msg.ToolCallID]) {
+			msg.Content = Redact(msg.Content)
+		}
+		out[i] = msg
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+// Package transcript records a chat session to disk for debugging: every
+// completion request and response, every tool call and result, and how long
+// each took, one JSON object per line.
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/client/internal/apiclient"
+	"github.com/ThatCatDev/tanrenai/client/pkg/api"
+)
+
+// Entry types.
+const (
+	TypeSession    = "session"
+	TypeRequest    = "request"
+	TypeResponse   = "response"
+	TypeToolCall   = "tool_call"
+	TypeToolResult = "tool_result"
+)
+
+// Entry is one line of a transcript. Requests and responses share an ID so
+// they can be paired even when sub-agents interleave their requests.
+type Entry struct {
+	Time       time.Time                   `json:"time"`
+	Type       string                      `json:"type"`
+	ID         int                         `json:"id,omitempty"`
+	Model      string                      `json:"model,omitempty"`
+	Agent      bool                        `json:"agent,omitempty"`
+	Request    *api.ChatCompletionRequest  `json:"request,omitempty"`
+	Tools      []string                    `json:"tools,omitempty"` // tool names offered with a request
+	Response   *api.ChatCompletionResponse `json:"response,omitempty"`
+	ToolCall   *api.ToolCall               `json:"tool_call,omitempty"`
+	Result     string                      `json:"result,omitempty"`
+	DurationMS int64                       `json:"duration_ms,omitempty"`
+	Error      string                      `json:"error,omitempty"`
+}
+
+// Logger appends entries to a session's JSONL file. A nil *Logger discards
+// everything, so callers need not check whether logging is enabled. It is
+// safe for concurrent use.
+type Logger struct {
+	path string
+
+	mu        sync.Mutex
+	f         *os.File
+	enc       *json.Encoder
+	nextID    int
+	toolStart map[string]time.Time // tool call ID -> when it started
+}
+
+// Open creates a new transcript file in dir, named after the current time.
+func Open(dir string) (*Logger, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	name := "session-" + time.Now().Format("20060102-150405") + ".jsonl"
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create transcript: %w", err)
+	}
+	return &Logger{
+		path:      path,
+		f:         f,
+		enc:       json.NewEncoder(f),
+		toolStart: make(map[string]time.Time),
+	}, nil
+}
+
+// Path returns the transcript file's path.
+func (l *Logger) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Close closes the transcript file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+func (l *Logger) write(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	// Transcripts are best-effort; a failed write must not break the chat.
+	_ = l.enc.Encode(e)
+}
+
+// Session records the session's starting parameters.
+func (l *Logger) Session(model string, agentMode bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(Entry{Type: TypeSession, Model: model, Agent: agentMode})
+}
+
+// Request records an outgoing completion request and returns the ID to
+// pass to Response. Tool schemas are reduced to their names, and output of
+// shell_exec calls in the history is redacted.
+func (l *Logger) Request(req *api.ChatCompletionRequest) int {
+	if l == nil {
+		return 0
+	}
+	logged := *req
+	logged.Tools = nil
+	logged.Messages = redactShellMessages(req.Messages)
+	var names []string
+	for _, tool := range req.Tools {
+		names = append(names, tool.Function.Name)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	l.write(Entry{Type: TypeRequest, ID: l.nextID, Request: &logged, Tools: names})
+	return l.nextID
+}
+
+// Response records the response to request id, or the error that ended it.
+func (l *Logger) Response(id int, resp *api.ChatCompletionResponse, err error, start time.Time) {
+	if l == nil {
+		return
+	}
+	e := Entry{Type: TypeResponse, ID: id, Response: resp, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(e)
+}
+
+// Stream records the response to request id as it streams by. The returned
+// channel carries the same events; when the stream ends they are assembled
+// into a single response entry, written before the channel is closed.
+func (l *Logger) Stream(id int, events <-chan apiclient.StreamEvent, start time.Time) <-chan apiclient.StreamEvent {
+	if l == nil {
+		return events
+	}
+	out := make(chan apiclient.StreamEvent)
+	go func() {
+		defer close(out)
+		var seen []apiclient.StreamEvent
+		for ev := range events {
+			seen = append(seen, ev)
+			out <- ev
+		}
+		replay := make(chan apiclient.StreamEvent, len(seen))
+		for _, ev := range seen {
+			replay <- ev
+		}
+		close(replay)
+		resp, err := apiclient.AccumulateResponse(replay)
+		l.Response(id, resp, err, start)
+	}()
+	return out
+}
+
+// ToolCall records a tool call the model made.
+func (l *Logger) ToolCall(call api.ToolCall) {
+	if l == nil {
+		return
+	}
+	if shellTools[call.Function.Name] {
+		call.Function.Arguments = Redact(call.Function.Arguments)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.toolStart[call.ID] = time.Now()
+	l.write(Entry{Type: TypeToolCall, ToolCall: &call})
+}
+
+// ToolResult records a tool's output and how long the call took.
+func (l *Logger) ToolResult(call api.ToolCall, result string) {
+	if l == nil {
+		return
+	}
+	if shellTools[call.Function.Name] {
+		call.Function.Arguments = Redact(call.Function.Arguments)
+		result = Redact(result)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := Entry{Type: TypeToolResult, ToolCall: &call, Result: result}
+	if start, ok := l.toolStart[call.ID]; ok {
+		e.DurationMS = time.Since(start).Milliseconds()
+		delete(l.toolStart, call.ID)
+	}
+	l.write(e)
+}
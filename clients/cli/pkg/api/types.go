@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -12,6 +13,86 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	Name       string     `json:"name,omitempty"`
+	// ReasoningContent is the thinking of reasoning models, kept apart from
+	// Content so that it is neither shown as the reply nor sent back.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Images are image URLs, usually base64 data URIs, sent along with
+	// Content to multimodal models. A message with images goes over the
+	// wire with its content as typed parts.
+	Images []string `json:"-"`
+}
+
+// ContentPart is one part of a multimodal message's content, as in the
+// OpenAI API: text or an image.
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL points to an image: an http(s) URL or a data URI such as
+// "data:image/png;base64,...".
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// Parts returns the message content as typed parts: the text, then the
+// images.
+func (m Message) Parts() []ContentPart {
+	var parts []ContentPart
+	if m.Content != "" {
+		parts = append(parts, ContentPart{Type: "text", Text: m.Content})
+	}
+	for _, url := range m.Images {
+		parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}})
+	}
+	return parts
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []ContentPart `json:"content"`
+	}{plain(m), m.Parts()})
+}
+
+// UnmarshalJSON accepts content as a string or as typed parts. Text parts
+// are joined into Content, image parts go to Images.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var msg struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = Message(msg.plain)
+	if len(msg.Content) == 0 || string(msg.Content) == "null" {
+		return nil
+	}
+	if msg.Content[0] == '"' {
+		return json.Unmarshal(msg.Content, &m.Content)
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(msg.Content, &parts); err != nil {
+		return err
+	}
+	var text []string
+	for _, p := range parts {
+		switch {
+		case p.Type == "text":
+			text = append(text, p.Text)
+		case p.Type == "image_url" && p.ImageURL != nil:
+			m.Images = append(m.Images, p.ImageURL.URL)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
 }
 
 // Tool represents a tool available for the model to call.
@@ -59,6 +140,30 @@ type ChatCompletionRequest struct {
 	Stop        []string  `json:"stop,omitempty"`
 	Tools       []Tool    `json:"tools,omitempty"`
 	ToolChoice  any       `json:"tool_choice,omitempty"`
+
+	// Sampling parameters llama-server accepts beyond OpenAI's. Unset ones
+	// use the model's defaults from the registry, or llama-server's.
+	TopK          *int     `json:"top_k,omitempty"`
+	MinP          *float64 `json:"min_p,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+
+	// LogitBias adds a bias to the logits of the given token IDs (as
+	// decimal strings); -100 bans a token, 100 forces it.
+	LogitBias map[string]float64 `json:"logit_bias,omitempty"`
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	// SessionID groups requests that resend a growing conversation, such as
+	// the iterations of an agent turn. The GPU server keeps a session on one
+	// llama-server slot so its prompt prefix stays in the KV cache.
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// StreamOptions controls optional fields in streamed responses.
+type StreamOptions struct {
+	// IncludeUsage asks the backend to send token usage in the final chunk.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatCompletionResponse matches the OpenAI chat completions response schema.
@@ -85,6 +190,7 @@ type ChatCompletionChunk struct {
 	Created int64         `json:"created"`
 	Model   string        `json:"model"`
 	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"` // set on the final chunk only
 }
 
 // ChunkChoice is a single choice within a streaming chunk.
@@ -99,6 +205,8 @@ type MessageDelta struct {
 	Role      string          `json:"role,omitempty"`
 	Content   string          `json:"content,omitempty"`
 	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+	// ReasoningContent is set when llama-server separates the reasoning.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // Usage contains token usage information.
@@ -108,12 +216,84 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// StreamStatusWarmingUp is reported while a model is loaded for a
+// streaming request, e.g. after it was unloaded for being idle.
+const StreamStatusWarmingUp = "warming_up"
+
+// StreamStatus is the data of a "status" event in a chat completion stream,
+// sent before the first chunk when the request has to wait for the model.
+type StreamStatus struct {
+	Status string `json:"status"` // warming_up
+	Model  string `json:"model,omitempty"`
+}
+
 // ModelInfo represents a model in the /v1/models response.
 type ModelInfo struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	Metadata *ModelMetadata `json:"metadata,omitempty"` // from the model registry
+}
+
+// ModelMetadata is a model's entry in the model registry, models.json in
+// the models directory.
+type ModelMetadata struct {
+	Aliases      []string        `json:"aliases,omitempty"`       // other names it resolves from, e.g. "coder"
+	CtxSize      int             `json:"ctx_size,omitempty"`      // context length to load it with
+	ChatTemplate string          `json:"chat_template,omitempty"` // chat template family, e.g. "qwen2.5"
+	Sampling     *SamplingParams `json:"sampling,omitempty"`      // recommended sampling defaults
+	Flags        []string        `json:"flags,omitempty"`         // extra llama-server flags
+	MMProj       string          `json:"mmproj,omitempty"`        // multimodal projector GGUF, enables image input
+}
+
+// SamplingParams are sampling defaults; requests can still override them.
+type SamplingParams struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	MinP          *float64 `json:"min_p,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+}
+
+// ServerInfo is the response for GET /api/info: the model the GPU server
+// has loaded and what the backend and GPU server can do, for clients to
+// size their context and pick features. The backend does not start the
+// GPU instance to answer; while it is not running only the backend's
+// fields are set.
+type ServerInfo struct {
+	Version    string `json:"version"`               // the backend's
+	GPUVersion string `json:"gpu_version,omitempty"` // the GPU server's
+	GPUState   string `json:"gpu_state"`             // as in InstanceStatus
+	// Model is the model loaded last, by name; Loaded is false once it
+	// has been unloaded when idle, and the next request reloads it.
+	Model      string   `json:"model,omitempty"`
+	Loaded     bool     `json:"loaded"`
+	CtxSize    int      `json:"ctx_size,omitempty"`    // context length Model runs with
+	ToolFormat string   `json:"tool_format,omitempty"` // as in LoadModelResponse
+	Features   []string `json:"features"`              // Feature* values
+}
+
+// Features reported in ServerInfo.
+const (
+	FeatureTools         = "tools"         // the model's chat template takes tools
+	FeatureVision        = "vision"        // the model takes images
+	FeatureEmbeddings    = "embeddings"    // the GPU server has an embedding model
+	FeatureTranscription = "transcription" // the GPU server has a whisper model
+	FeatureFinetune      = "finetune"      // the GPU server has a training sidecar
+	FeatureMemory        = "memory"        // the backend serves /v1/memory
+	FeatureAgent         = "agent"         // the backend serves /v1/agent/runs
+)
+
+// LoadModelResponse is the response for POST /api/load.
+type LoadModelResponse struct {
+	Status     string         `json:"status"`
+	Model      string         `json:"model"`                 // as requested, possibly an alias
+	Name       string         `json:"name"`                  // the model it resolved to
+	CtxSize    int            `json:"ctx_size"`              // context length it was loaded with
+	ToolFormat string         `json:"tool_format,omitempty"` // tool-calling format of its chat template: hermes, qwen, llama3 or mistral
+	Metadata   *ModelMetadata `json:"metadata,omitempty"`    // from the model registry
 }
 
 // ModelListResponse is the response for GET /v1/models.
@@ -143,6 +323,9 @@ type MemoryEntry struct {
 	AssistMsg string    `json:"assist_msg"`
 	Timestamp time.Time `json:"timestamp"`
 	SessionID string    `json:"session_id,omitempty"`
+	// Importance in [0, 1]; important memories are exempt from recency decay.
+	Importance float32 `json:"importance,omitempty"`
+	Rating     int     `json:"rating,omitempty"` // 1 thumbs up, -1 thumbs down
 }
 
 // MemorySearchResult is a memory entry with associated scores.
@@ -150,6 +333,7 @@ type MemorySearchResult struct {
 	Entry         MemoryEntry `json:"entry"`
 	SemanticScore float32     `json:"semantic_score"`
 	KeywordScore  float32     `json:"keyword_score"`
+	RecencyScore  float32     `json:"recency_score"`
 	CombinedScore float32     `json:"combined_score"`
 }
 
@@ -166,8 +350,14 @@ type MemorySearchResponse struct {
 
 // MemoryStoreRequest is the request for POST /v1/memory/store.
 type MemoryStoreRequest struct {
-	UserMsg   string `json:"user_msg"`
-	AssistMsg string `json:"assist_msg"`
+	UserMsg    string  `json:"user_msg"`
+	AssistMsg  string  `json:"assist_msg"`
+	Importance float32 `json:"importance,omitempty"`
+}
+
+// MemoryImportanceRequest is the request for POST /v1/memory/{id}/importance.
+type MemoryImportanceRequest struct {
+	Importance float32 `json:"importance"`
 }
 
 // MemoryStoreResponse is the response for POST /v1/memory/store.
@@ -186,6 +376,393 @@ type MemoryCountResponse struct {
 	Count int `json:"count"`
 }
 
+// MemoryRecord is one line of the JSONL stream produced by
+// GET /v1/memory/export and accepted by POST /v1/memory/import.
+type MemoryRecord struct {
+	MemoryEntry
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Embedding []float32         `json:"embedding,omitempty"`
+}
+
+// MemoryImportResponse is the response for POST /v1/memory/import.
+type MemoryImportResponse struct {
+	Imported int `json:"imported"`
+}
+
+// MemoryCompactRequest is the optional body for POST /v1/memory/compact.
+type MemoryCompactRequest struct {
+	Threshold float32 `json:"threshold,omitempty"` // 0 uses the server default
+}
+
+// MemoryCompactResponse is the response for POST /v1/memory/compact.
+type MemoryCompactResponse struct {
+	Clusters int `json:"clusters"`
+	Removed  int `json:"removed"`
+	Created  int `json:"created"`
+}
+
+// MemoryRatingRequest is the request for POST /v1/memory/{id}/rating.
+type MemoryRatingRequest struct {
+	Rating int `json:"rating"` // 1 thumbs up, -1 thumbs down, 0 clears
+}
+
+// Fine-tuning dataset types
+
+// DatasetFilter selects the memories that become fine-tuning samples.
+type DatasetFilter struct {
+	MinAssistantLen int        `json:"min_assistant_len,omitempty"` // characters
+	ExcludeErrors   bool       `json:"exclude_errors,omitempty"`    // drop replies that look like errors or refusals
+	Since           *time.Time `json:"since,omitempty"`
+	Until           *time.Time `json:"until,omitempty"`
+	Dedupe          bool       `json:"dedupe,omitempty"` // keep the newest of identical turns
+	// MinRating is the lowest rating kept: -1 keeps everything, 0 drops
+	// thumbs-down memories, 1 keeps only thumbs-up ones.
+	MinRating  int `json:"min_rating,omitempty"`
+	MaxSamples int `json:"max_samples,omitempty"` // keep the newest; 0 keeps all
+}
+
+// DatasetRequest is the request for POST /v1/finetune/dataset.
+type DatasetRequest struct {
+	DatasetFilter
+	Preview int `json:"preview,omitempty"` // kept memories to return, newest first
+}
+
+// DatasetStats describes the samples a DatasetFilter keeps.
+type DatasetStats struct {
+	Memories int `json:"memories"` // memories considered
+	Samples  int `json:"samples"`  // memories kept
+	// Dropped counts the rest by reason: short, error, date, duplicate,
+	// rating or max_samples.
+	Dropped           map[string]int `json:"dropped,omitempty"`
+	RatedUp           int            `json:"rated_up"`
+	RatedDown         int            `json:"rated_down"`
+	AvgUserChars      int            `json:"avg_user_chars"`
+	AvgAssistantChars int            `json:"avg_assistant_chars"`
+	Oldest            *time.Time     `json:"oldest,omitempty"`
+	Newest            *time.Time     `json:"newest,omitempty"`
+}
+
+// DatasetResponse is the response for POST /v1/finetune/dataset.
+type DatasetResponse struct {
+	Stats   DatasetStats  `json:"stats"`
+	Preview []MemoryEntry `json:"preview,omitempty"`
+}
+
+// DatasetSample is one fine-tuning sample, a line of the dataset JSONL.
+// Source and Ref say where it came from, e.g. "memory" and the memory's
+// ID, or "import:chats.jsonl" and "line 12". Tools are the tools a
+// function-calling sample's messages call.
+type DatasetSample struct {
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Ref      string    `json:"ref,omitempty"`
+}
+
+// Dataset modes of FinetunePrepareRequest: memory's user and assistant
+// text, or recorded agent trajectories with their tool calls.
+const (
+	DatasetModeChat  = "chat"
+	DatasetModeTools = "tools"
+)
+
+// TrajectoryRequest is the request for POST /v1/memory/trajectories, which
+// records an agent turn with its tool calls and results for fine-tuning.
+// Messages start at the user's message; Tools are the ones offered.
+type TrajectoryRequest struct {
+	Model     string    `json:"model,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Tools     []Tool    `json:"tools,omitempty"`
+	Messages  []Message `json:"messages"`
+}
+
+// TrajectoryResponse is the response for POST /v1/memory/trajectories.
+type TrajectoryResponse struct {
+	ID string `json:"id"`
+}
+
+// FinetunePrepareRequest is the request for POST /v1/finetune/prepare.
+// Without DatasetPath, Dataset or Pairs, a backend with memory builds the
+// dataset from the memories Filter keeps, or with Mode DatasetModeTools
+// from the recorded trajectories in its date range, and sends it to the
+// GPU server as Dataset.
+type FinetunePrepareRequest struct {
+	BaseModel   string          `json:"base_model"`
+	DatasetPath string          `json:"dataset_path,omitempty"`
+	SampleCount int             `json:"sample_count,omitempty"`
+	Config      json.RawMessage `json:"config,omitempty"`
+	Filter      *DatasetFilter  `json:"filter,omitempty"`
+	Mode        string          `json:"mode,omitempty"` // DatasetModeChat (default) or DatasetModeTools
+	Dataset     []DatasetSample `json:"dataset,omitempty"`
+	// Pairs makes the run a DPO run on these preference pairs.
+	Pairs []PreferencePair `json:"pairs,omitempty"`
+}
+
+// PreferencePair is a DPO training sample: a preferred and a rejected
+// reply to the same conversation, e.g. an answer the user regenerated and
+// the one they kept.
+type PreferencePair struct {
+	Prompt   []Message `json:"prompt"`
+	Chosen   string    `json:"chosen"`
+	Rejected string    `json:"rejected"`
+	Source   string    `json:"source,omitempty"`
+	Ref      string    `json:"ref,omitempty"`
+}
+
+// FinetuneRun is the part of a GPU server training run the client shows.
+type FinetuneRun struct {
+	ID          string           `json:"id"`
+	BaseModel   string           `json:"base_model"`
+	Status      string           `json:"status"`
+	DatasetPath string           `json:"dataset_path,omitempty"`
+	Metrics     FinetuneMetrics  `json:"metrics"`
+	Release     *FinetuneRelease `json:"release,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Sources     map[string]int   `json:"sources,omitempty"` // samples per DatasetSample.Source
+	CreatedAt   time.Time        `json:"created_at"`
+	DiskBytes   int64            `json:"disk_bytes,omitempty"` // set in GET /v1/finetune/runs
+}
+
+// FinetuneGCRequest is the request for POST /v1/finetune/gc, which removes
+// the training runs a retention policy does not keep: all but the newest
+// KeepLast, then the oldest until the rest fit in MaxBytes. With neither
+// set the GPU server's own policy applies.
+type FinetuneGCRequest struct {
+	KeepLast int   `json:"keep_last,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	DryRun   bool  `json:"dry_run,omitempty"`
+}
+
+// FinetuneGCResponse is what POST /v1/finetune/gc removed, or would
+// remove on a dry run. Used is what the kept runs take; OverQuota means
+// runs it may not remove, such as live models, still exceed MaxBytes.
+type FinetuneGCResponse struct {
+	Removed []struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		DiskBytes int64  `json:"disk_bytes"`
+		Reason    string `json:"reason"`
+	} `json:"removed"`
+	Freed     int64 `json:"freed"`
+	Kept      int   `json:"kept"`
+	Used      int64 `json:"used"`
+	OverQuota bool  `json:"over_quota,omitempty"`
+	DryRun    bool  `json:"dry_run,omitempty"`
+}
+
+// FinetuneReleaseRequest is the request for POST /v1/finetune/release,
+// which merges a trained run into the next version of a model family
+// (Name@v1, Name@v2, ...), loads it as Name and smoke-tests it, rolling
+// back to the previous version if it fails.
+type FinetuneReleaseRequest struct {
+	RunID  string       `json:"run_id"`
+	Name   string       `json:"name,omitempty"`
+	Checks []SmokeCheck `json:"checks,omitempty"`
+}
+
+// SmokeCheck is a prompt whose reply must contain Expected, ignoring case.
+type SmokeCheck struct {
+	Prompt   string `json:"prompt"`
+	Expected string `json:"expected"`
+}
+
+// FinetuneRelease is the outcome of releasing a run.
+type FinetuneRelease struct {
+	Model    string `json:"model"`
+	Family   string `json:"family"`
+	Version  int    `json:"version"`
+	Alias    string `json:"alias"`
+	Previous string `json:"previous,omitempty"`
+	Checks   []struct {
+		SmokeCheck
+		Answer string `json:"answer"`
+		Passed bool   `json:"passed"`
+	} `json:"checks,omitempty"`
+	Live       bool   `json:"live"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FinetuneMetrics is how far a training run has got.
+type FinetuneMetrics struct {
+	SamplesUsed int         `json:"samples_used,omitempty"`
+	TrainLoss   float64     `json:"train_loss,omitempty"`
+	Duration    string      `json:"duration,omitempty"`
+	Progress    float64     `json:"progress,omitempty"` // 0.0–1.0
+	Step        int         `json:"step,omitempty"`
+	MaxSteps    int         `json:"max_steps,omitempty"`
+	LossHistory []LossPoint `json:"loss_history,omitempty"`
+}
+
+// LossPoint is the training loss logged at a step.
+type LossPoint struct {
+	Step int     `json:"step"`
+	Loss float64 `json:"loss"`
+}
+
+// FinetuneProgress is an event of GET /v1/finetune/events/{run_id}. Losses
+// are the points logged since the previous event; an event with only an
+// Error ends a stream that failed.
+type FinetuneProgress struct {
+	RunID    string      `json:"run_id"`
+	Status   string      `json:"status"`
+	Step     int         `json:"step"`
+	MaxSteps int         `json:"max_steps"`
+	Progress float64     `json:"progress"`
+	Loss     float64     `json:"loss,omitempty"`
+	Losses   []LossPoint `json:"losses,omitempty"`
+	Elapsed  float64     `json:"elapsed_seconds"`
+	ETA      float64     `json:"eta_seconds,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Training runs are "pending" until trained and "training" while they
+// are; a trained run is "merging" until merged, then "done".
+const (
+	FinetunePending  = "pending"
+	FinetuneTraining = "training"
+	FinetuneFailed   = "failed"
+)
+
+// FinetuneTrainRequest is the request for POST /v1/finetune/train. Config
+// holds the run config fields to change before training; the others keep
+// the values the run was prepared with.
+type FinetuneTrainRequest struct {
+	RunID  string          `json:"run_id"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// FinetuneImportRequest is the request for POST /v1/finetune/import, which
+// adds an external dataset to a pending run. Content carries the file
+// inline and Name its file name; Format is "openai", "sharegpt" or "" to
+// detect it per sample.
+type FinetuneImportRequest struct {
+	RunID   string `json:"run_id"`
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Format  string `json:"format,omitempty"`
+}
+
+// FinetuneImportResponse is the response for POST /v1/finetune/import.
+type FinetuneImportResponse struct {
+	Source   string `json:"source"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+}
+
+// Session API types
+
+// SessionHeader names the session a request belongs to. Completions
+// without a session_id use it as theirs, memories stored under it are
+// tagged with it, and a stored session's Settings apply to the request.
+// Clients that share a backend each send their own.
+const SessionHeader = "X-Session-ID"
+
+// Memory scopes for SessionSettings.MemoryScope.
+const (
+	MemoryScopeGlobal  = "global"  // search every memory (the default)
+	MemoryScopeSession = "session" // search only the session's own memories
+)
+
+// SessionSettings are the per-session policies applied to requests that
+// carry the session's ID in SessionHeader.
+type SessionSettings struct {
+	MemoryScope string `json:"memory_scope,omitempty"` // global (default) or session
+	// Tools limits the tools agent runs in the session may use; empty
+	// allows every tool the backend offers.
+	Tools []string `json:"tools,omitempty"`
+	// ContextTokens, if set, has the backend manage the session's context:
+	// once the messages after Summarized pass this many tokens, appends
+	// fold the oldest of them into Summary, and GET
+	// /v1/sessions/{id}/context returns the window that fits.
+	ContextTokens int `json:"context_tokens,omitempty"`
+}
+
+// Session is a conversation stored on the backend, so several clients can
+// attach to it and continue where another left off. Messages is the full
+// history, including messages that no longer fit in a context window;
+// Summary and State condense the ones that were summarized.
+type Session struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Messages []Message `json:"messages"`
+	Summary  string    `json:"summary,omitempty"`
+	// Summarized is how many leading Messages the backend has folded into
+	// Summary; only sessions with Settings.ContextTokens set have any.
+	Summarized int             `json:"summarized,omitempty"`
+	State      SessionState    `json:"state"`
+	Settings   SessionSettings `json:"settings"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// SessionState is the structured state kept by structured summarization.
+type SessionState struct {
+	Files     []string `json:"files,omitempty"`
+	Commands  []string `json:"commands,omitempty"`
+	Decisions []string `json:"decisions,omitempty"`
+	TODOs     []string `json:"todos,omitempty"`
+}
+
+// SessionInfo describes a session without its messages.
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	MessageCount int       `json:"message_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SessionListResponse is the response for GET /v1/sessions, most recently
+// updated first.
+type SessionListResponse struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// SessionCreateRequest is the request for POST /v1/sessions.
+type SessionCreateRequest struct {
+	Title    string          `json:"title,omitempty"`
+	Model    string          `json:"model,omitempty"`
+	Messages []Message       `json:"messages,omitempty"`
+	Settings SessionSettings `json:"settings"`
+}
+
+// SessionUpdateRequest is the request for PATCH /v1/sessions/{id}. Only the
+// fields that are set change.
+type SessionUpdateRequest struct {
+	Title    *string          `json:"title,omitempty"`
+	Model    *string          `json:"model,omitempty"`
+	Summary  *string          `json:"summary,omitempty"`
+	State    *SessionState    `json:"state,omitempty"`
+	Settings *SessionSettings `json:"settings,omitempty"`
+}
+
+// SessionAppendRequest is the request for POST /v1/sessions/{id}/messages.
+// With ExpectedCount set, the append is refused with 409 unless the session
+// has exactly that many messages, so a client that missed another client's
+// messages does not interleave its own with them.
+type SessionAppendRequest struct {
+	Messages      []Message `json:"messages"`
+	ExpectedCount *int      `json:"expected_count,omitempty"`
+}
+
+// SessionAppendResponse is the response for POST /v1/sessions/{id}/messages.
+type SessionAppendResponse struct {
+	MessageCount int `json:"message_count"`
+}
+
+// SessionContextResponse is the response for GET /v1/sessions/{id}/context:
+// the summary as a system message, if there is one, then the most recent
+// messages that fit in the session's ContextTokens.
+type SessionContextResponse struct {
+	Messages   []Message `json:"messages"`
+	Summarized int       `json:"summarized"` // messages condensed into the summary
+	Tokens     int       `json:"tokens"`     // estimated size of Messages
+}
+
 // Instance management types
 
 // InstanceStatus represents the status of a GPU instance.
@@ -193,4 +770,122 @@ type InstanceStatus struct {
 	Status    string     `json:"status"` // running, stopped, starting
 	GPUURL    string     `json:"gpu_url,omitempty"`
 	IdleSince *time.Time `json:"idle_since,omitempty"`
+	// AutoStopAfter is the idle timeout after which the GPU instance is
+	// stopped, e.g. "30m0s"; "" when auto-stop is off.
+	AutoStopAfter string          `json:"auto_stop_after,omitempty"`
+	StopAt        *time.Time      `json:"stop_at,omitempty"` // when the idle instance will be stopped
+	Tunnel        *InstanceTunnel `json:"tunnel,omitempty"`  // set when the backend reaches the GPU server over SSH
+}
+
+// InstanceTunnel is the state of the backend's SSH tunnel to the GPU
+// server.
+type InstanceTunnel struct {
+	Endpoint  string     `json:"endpoint,omitempty"` // user@host:port
+	Local     string     `json:"local"`
+	Remote    string     `json:"remote"`
+	Connected bool       `json:"connected"`
+	Since     *time.Time `json:"since,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// InstanceAutostopRequest is the request for POST /api/instance/autostop.
+// After is a duration such as "30m"; "0" turns auto-stop off. The setting
+// lasts until the backend restarts.
+type InstanceAutostopRequest struct {
+	After string `json:"after"`
+}
+
+// Instance event types, sent on GET /api/instance/events.
+const (
+	InstanceIdleWarning = "idle_warning" // the idle instance will be stopped at StopAt
+	InstanceStopped     = "stopped"      // the idle instance was stopped
+	// The instance's spend passed 80% of a budget, or all of it, which
+	// stops requests from starting the instance.
+	InstanceBudgetWarning = "budget_warning"
+	InstanceBudgetReached = "budget_reached"
+)
+
+// InstanceEvent is an event on GET /api/instance/events.
+type InstanceEvent struct {
+	Type   string     `json:"type"`
+	StopAt *time.Time `json:"stop_at,omitempty"`
+	Idle   string     `json:"idle,omitempty"` // how long the instance has been idle, e.g. "25m0s"
+	// Period ("day" or "week"), Spent and Budget, in dollars, are set
+	// for budget events.
+	Period string  `json:"period,omitempty"`
+	Spent  float64 `json:"spent,omitempty"`
+	Budget float64 `json:"budget,omitempty"`
+}
+
+// InstanceCosts is the response for GET /api/instance/costs. Amounts are
+// dollars; Week counts from Monday.
+type InstanceCosts struct {
+	Provider     string            `json:"provider"`
+	Running      bool              `json:"running"`
+	RatePerHour  float64           `json:"rate_per_hour"`
+	Today        float64           `json:"today"`
+	Week         float64           `json:"week"`
+	DailyBudget  float64           `json:"daily_budget,omitempty"`
+	WeeklyBudget float64           `json:"weekly_budget,omitempty"`
+	Days         []InstanceDayCost `json:"days,omitempty"` // the last 30 days with spend, newest first
+}
+
+// InstanceDayCost is what the instance cost on one day.
+type InstanceDayCost struct {
+	Date    string  `json:"date"` // local to the backend, "2006-01-02"
+	Hours   float64 `json:"hours"`
+	Dollars float64 `json:"dollars"`
+}
+
+// Model download types
+
+// PullProgress is one SSE event emitted by POST /api/pull.
+type PullProgress struct {
+	Status     string `json:"status"` // resolving, downloading, downloaded, error
+	Downloaded int64  `json:"downloaded,omitempty"`
+	Total      int64  `json:"total,omitempty"`
+	Percent    int    `json:"percent,omitempty"`
+	Path       string `json:"path,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// LocalModel is a downloaded model file and what its GGUF metadata says
+// about it.
+type LocalModel struct {
+	Name          string         `json:"name"`
+	Size          int64          `json:"size"`
+	ModifiedAt    int64          `json:"modified_at"`
+	Architecture  string         `json:"architecture,omitempty"`
+	SizeLabel     string         `json:"size_label,omitempty"`     // parameter count, e.g. "7B"
+	Quant         string         `json:"quant,omitempty"`          // e.g. "Q4_K_M"
+	ContextLength int            `json:"context_length,omitempty"` // context length the model was trained for
+	ChatTemplate  string         `json:"chat_template,omitempty"`  // embedded template; only when inspecting one model
+	Loaded        bool           `json:"loaded,omitempty"`
+	Metadata      *ModelMetadata `json:"metadata,omitempty"` // from the model registry
+	Error         string         `json:"error,omitempty"`    // why the GGUF metadata could not be read
+}
+
+// LocalModelsResponse is the response for GET /api/models.
+type LocalModelsResponse struct {
+	Models []LocalModel `json:"models"`
+}
+
+// PartialDownload is an interrupted download that can be resumed.
+type PartialDownload struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+}
+
+// PartialDownloadsResponse is the response for GET /api/pull/partial, and
+// lists the removed downloads for DELETE /api/pull/partial.
+type PartialDownloadsResponse struct {
+	Partials []PartialDownload `json:"partials"`
+}
+
+// TranscriptionResponse is the response for POST /v1/audio/transcriptions,
+// which takes the audio as a multipart "file" field.
+type TranscriptionResponse struct {
+	Text string `json:"text"`
 }
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
+	"github.com/spf13/cobra"
+)
+
+// completeModels completes model names for shell completion (see
+// "tanrenai-gpu completion"): the GGUF files in the models directory and
+// their aliases from models.json.
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	dir, _ := cmd.Flags().GetString("models-dir")
+	if dir == "" {
+		dir = config.ModelsDir()
+	}
+	var names []string
+	for _, m := range models.NewStore(dir).List() {
+		names = append(names, m.Name)
+		if m.Metadata != nil {
+			names = append(names, m.Metadata.Aliases...)
+		}
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return !strings.HasPrefix(name, toComplete) })
+	slices.Sort(names)
+	return slices.Compact(names), cobra.ShellCompDirectiveNoFileComp
+}
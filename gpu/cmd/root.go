@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +13,11 @@ var rootCmd = &cobra.Command{
 	Use:   "tanrenai-gpu",
 	Short: "Tanrenai GPU server — inference + training",
 	Long:  "Tanrenai GPU server provides LLM inference (chat completions, embeddings) and fine-tuning endpoints.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		level, _ := cmd.Flags().GetString("log-level")
+		format, _ := cmd.Flags().GetString("log-format")
+		return logging.Setup(level, format)
+	},
 }
 
 func Execute() error {
@@ -19,9 +26,11 @@ func Execute() error {
 
 func init() {
 	rootCmd.PersistentFlags().StringP("models-dir", "m", "", "model storage directory")
+	rootCmd.PersistentFlags().String("log-level", "info", "log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", logging.FormatText, "log format: text or json")
 }
 
 func exitError(msg string, args ...any) {
-	fmt.Fprintf(os.Stderr, "Error: "+msg+"\n", args...)
+	slog.Error(fmt.Sprintf(msg, args...))
 	os.Exit(1)
 }
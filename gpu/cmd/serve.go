@@ -3,14 +3,20 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/server"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/training"
 )
 
 var serveCmd = &cobra.Command{
@@ -18,6 +24,7 @@ var serveCmd = &cobra.Command{
 	Short: "Start the tanrenai GPU API server",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := config.DefaultConfig()
+		cfg.Version = Version
 
 		if host, _ := cmd.Flags().GetString("host"); host != "" {
 			cfg.Host = host
@@ -39,24 +46,23 @@ var serveCmd = &cobra.Command{
 		}
 		// Named template shortcut
 		if name, _ := cmd.Flags().GetString("chat-template"); name != "" && cfg.ChatTemplateFile == "" {
-			switch name {
-			case "qwen2.5", "qwen2", "qwen":
-				path, err := runner.WriteQwen25Template()
-				if err != nil {
-					return fmt.Errorf("failed to write chat template: %w", err)
-				}
-				defer os.Remove(path)
-				cfg.ChatTemplateFile = path
-				fmt.Printf("Using Qwen2.5 native chat template\n")
-			default:
-				return fmt.Errorf("unknown chat template %q (available: qwen2.5)", name)
+			path, err := runner.WriteChatTemplate(name)
+			if err != nil {
+				return fmt.Errorf("failed to write chat template: %w", err)
 			}
+			defer os.Remove(path)
+			cfg.ChatTemplateFile = path
+			fmt.Printf("Using %s chat template\n", name)
 		}
 
 		if embModel, _ := cmd.Flags().GetString("embedding-model"); embModel != "" {
 			cfg.EmbeddingModel = embModel
 		}
 
+		if whisper, _ := cmd.Flags().GetString("whisper-model"); whisper != "" {
+			cfg.WhisperModel = whisper
+		}
+
 		if rf, _ := cmd.Flags().GetString("reasoning-format"); rf != "" {
 			cfg.ReasoningFormat = rf
 		}
@@ -65,22 +71,74 @@ var serveCmd = &cobra.Command{
 			cfg.FlashAttention = fa
 		}
 
+		if parallel, _ := cmd.Flags().GetInt("parallel"); parallel > 0 {
+			cfg.Parallel = parallel
+		}
+		cfg.ShutdownTimeout, _ = cmd.Flags().GetDuration("shutdown-timeout")
+		if idle, _ := cmd.Flags().GetDuration("idle-unload"); idle > 0 {
+			cfg.IdleUnload = idle
+		}
+		if keep, _ := cmd.Flags().GetInt("training-keep"); keep > 0 {
+			cfg.TrainingKeepLast = keep
+		}
+		if gb, _ := cmd.Flags().GetFloat64("training-max-gb"); gb > 0 {
+			cfg.TrainingMaxBytes = int64(gb * (1 << 30))
+		}
+		cfg.SidecarURL, _ = cmd.Flags().GetString("sidecar-url")
+		cfg.SidecarToken, _ = cmd.Flags().GetString("sidecar-token")
+		if cfg.SidecarToken == "" {
+			cfg.SidecarToken = os.Getenv("TANRENAI_SIDECAR_TOKEN")
+		}
+		cfg.SidecarCAFile, _ = cmd.Flags().GetString("sidecar-ca")
+		cfg.SidecarInsecure, _ = cmd.Flags().GetBool("sidecar-insecure")
+		if backend, _ := cmd.Flags().GetString("backend"); backend != "" {
+			if backend != config.BackendLlama && backend != config.BackendOllama {
+				return fmt.Errorf("invalid --backend %q: want %s or %s", backend, config.BackendLlama, config.BackendOllama)
+			}
+			cfg.Backend = backend
+		}
+		cfg.OllamaURL, _ = cmd.Flags().GetString("ollama-url")
+		if cfg.OllamaURL == "" {
+			cfg.OllamaURL = ollamaURL()
+		}
+
 		if err := config.EnsureDirs(); err != nil {
 			return err
 		}
 
 		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		defer stop()
+		// Once shutdown starts, a second signal kills the server at once.
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
 
 		srv := server.New(cfg)
+		if cfg.SidecarURL != "" {
+			client, err := training.NewRemoteSidecarClient(cfg.SidecarURL, training.SidecarOptions{
+				Token:    cfg.SidecarToken,
+				CAFile:   cfg.SidecarCAFile,
+				Insecure: cfg.SidecarInsecure,
+			})
+			if err != nil {
+				return err
+			}
+			srv.SetTrainingManager(training.NewManager(client))
+		}
 
-		// Start embedding subprocess if configured
+		// The embedding subprocess starts on the first /v1/embeddings
+		// request; check the model exists now so a typo fails fast.
 		if cfg.EmbeddingModel != "" {
-			er, err := srv.StartEmbeddingSubprocess(ctx, cfg.EmbeddingModel)
-			if err != nil {
-				return fmt.Errorf("embedding subprocess: %w", err)
+			if _, err := models.NewStore(cfg.ModelsDir).Resolve(cfg.EmbeddingModel); err != nil {
+				return fmt.Errorf("embedding model: %w", err)
+			}
+		}
+		// Likewise whisper-server starts on the first transcription.
+		if cfg.WhisperModel != "" {
+			if _, err := models.NewStore(cfg.ModelsDir).ResolveWhisper(cfg.WhisperModel); err != nil {
+				return err
 			}
-			srv.SetEmbeddingRunner(er)
 		}
 
 		return srv.Start(ctx)
@@ -90,12 +148,42 @@ var serveCmd = &cobra.Command{
 func init() {
 	serveCmd.Flags().String("host", "127.0.0.1", "bind address")
 	serveCmd.Flags().Int("port", 11435, "listen port")
-	serveCmd.Flags().Int("gpu-layers", -1, "GPU layers to offload (-1 = auto)")
-	serveCmd.Flags().Int("ctx-size", 4096, "context window size")
-	serveCmd.Flags().String("chat-template", "", "named chat template to use (e.g. qwen2.5)")
+	serveCmd.Flags().Int("gpu-layers", -1, "GPU layers to offload (-1 = as many as fit in VRAM, tuned once per model and cached)")
+	serveCmd.Flags().Int("ctx-size", 4096, "context window size for models without a ctx_size in models.json")
+	serveCmd.Flags().String("chat-template", "", "named chat template to use for all models (e.g. qwen2.5)")
 	serveCmd.Flags().String("chat-template-file", "", "path to custom Jinja chat template file")
 	serveCmd.Flags().String("embedding-model", "", "embedding model name (e.g. nomic-embed-text)")
+	serveCmd.RegisterFlagCompletionFunc("embedding-model", completeModels)
+	serveCmd.Flags().String("whisper-model", "", "whisper.cpp model for /v1/audio/transcriptions (e.g. base.en for ggml-base.en.bin); needs whisper-server in the bin dir")
 	serveCmd.Flags().String("reasoning-format", "", "reasoning format for thinking mode (e.g. deepseek)")
 	serveCmd.Flags().Bool("flash-attn", true, "enable flash attention")
+	serveCmd.Flags().Int("parallel", 1, "llama-server slots serving requests at once; the context size is shared between them")
+	serveCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "on SIGTERM or SIGINT, how long requests in flight may take to finish before they are cancelled and the model subprocesses stopped")
+	serveCmd.Flags().Duration("idle-unload", 0, "unload the model after this long without requests, freeing VRAM; the next request reloads it (0 = never)")
+	serveCmd.Flags().String("sidecar-url", "", "training sidecar to fine-tune with, e.g. http://127.0.0.1:18082 or https://gpu-box:18082; datasets are uploaded to one on another host (default: fine-tuning off)")
+	serveCmd.Flags().String("sidecar-token", "", "bearer token the training sidecar requires (default $TANRENAI_SIDECAR_TOKEN)")
+	serveCmd.Flags().String("sidecar-ca", "", "PEM file of certificates to verify an https sidecar with, e.g. its self-signed certificate")
+	serveCmd.Flags().Bool("sidecar-insecure", false, "skip TLS certificate verification of the training sidecar")
+	serveCmd.Flags().Int("training-keep", 0, "keep only the newest n fine-tuning runs, removing older ones hourly (0 = keep all)")
+	serveCmd.Flags().Float64("training-max-gb", 0, "remove the oldest fine-tuning runs hourly while all runs use more than this many GB (0 = no quota)")
+	serveCmd.Flags().String("backend", config.BackendLlama, "inference backend: llama-server, or ollama to serve chat from the models an Ollama daemon has pulled")
+	serveCmd.Flags().String("ollama-url", "", "Ollama daemon for --backend ollama (default $OLLAMA_HOST or "+runner.DefaultOllamaURL+")")
 	rootCmd.AddCommand(serveCmd)
 }
+
+// ollamaURL is the Ollama daemon address from OLLAMA_HOST, which Ollama
+// itself accepts without a scheme or port, or the default.
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return runner.DefaultOllamaURL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	if u, err := url.Parse(host); err == nil && u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "11434")
+		host = u.String()
+	}
+	return host
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Config holds the GPU server configuration.
 type Config struct {
 	Host             string
@@ -8,12 +10,31 @@ type Config struct {
 	BinDir           string
 	GPULayers        int
 	CtxSize          int
-	ChatTemplateFile string // optional Jinja chat template override
-	EmbeddingModel   string // optional embedding model name/path
-	ReasoningFormat  string // optional reasoning format (e.g. "deepseek" for Qwen3.5 thinking mode)
-	FlashAttention   bool   // enable flash attention (default true)
+	ChatTemplateFile string        // optional Jinja chat template override
+	EmbeddingModel   string        // optional embedding model name/path
+	WhisperModel     string        // optional whisper.cpp model name/path for transcription
+	ReasoningFormat  string        // optional reasoning format (e.g. "deepseek" for Qwen3.5 thinking mode)
+	FlashAttention   bool          // enable flash attention (default true)
+	Parallel         int           // llama-server slots, each with its own prompt cache
+	IdleUnload       time.Duration // stop the model subprocesses after this long without requests (0 = never)
+	ShutdownTimeout  time.Duration // how long requests in flight may take to finish on SIGTERM
+	Backend          string        // BackendLlama or BackendOllama
+	OllamaURL        string        // Ollama daemon used by BackendOllama
+	TrainingKeepLast int           // training runs always kept by the retention policy (0 = no limit)
+	TrainingMaxBytes int64         // disk quota of all training runs (0 = no limit)
+	SidecarURL       string        // training sidecar serving /v1/finetune ("" = fine-tuning off)
+	SidecarToken     string        // bearer token the sidecar requires
+	SidecarCAFile    string        // PEM certificates to verify an https sidecar with
+	SidecarInsecure  bool          // skip the sidecar's TLS certificate verification
+	Version          string        // reported by GET /api/info
 }
 
+// Inference backends.
+const (
+	BackendLlama  = "llama-server" // spawn llama-server with a model from ModelsDir
+	BackendOllama = "ollama"       // forward chat to an Ollama daemon and its pulled models
+)
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
@@ -24,5 +45,8 @@ func DefaultConfig() *Config {
 		GPULayers:      -1, // auto
 		CtxSize:        4096,
 		FlashAttention: true,
+		Parallel:       1,
+		Backend:        BackendLlama,
+		ShutdownTimeout: 30 * time.Second,
 	}
 }
@@ -53,6 +53,11 @@ func SidecarDir() string {
 	return filepath.Join(DataDir(), "sidecar")
 }
 
+// GPULayersCachePath returns the file that remembers tuned GPU layer counts.
+func GPULayersCachePath() string {
+	return filepath.Join(DataDir(), "gpu_layers.json")
+}
+
 // EnsureDirs creates the required directories if they don't exist.
 func EnsureDirs() error {
 	dirs := []string{DataDir(), ModelsDir(), BinDir(), TrainingDir(), TrainingDatasetsDir(), TrainingRunsDir()}
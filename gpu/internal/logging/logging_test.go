@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetupRejectsUnknownValues(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var buf bytes.Buffer
+	if err := setup(&buf, "loud", FormatText); err == nil {
+		t.Error("unknown level accepted")
+	}
+	if err := setup(&buf, "info", "xml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestForFollowsSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	log := For("runner").With("session", "s1") // created before setup
+
+	var buf bytes.Buffer
+	if err := setup(&buf, "warn", FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("dropped")
+	log.Warn("kept", "port", 8080)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d records, want 1: %q", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "kept" || rec["component"] != "runner" || rec["session"] != "s1" || rec["port"] != float64(8080) {
+		t.Errorf("record = %v", rec)
+	}
+}
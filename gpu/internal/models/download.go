@@ -1,22 +1,41 @@
 package models
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // DownloadProgress is called periodically during a download.
 type DownloadProgress func(downloaded, total int64)
 
+const (
+	maxDownloadAttempts = 5
+	retryBackoff        = 2 * time.Second
+)
+
+// errPermanent marks download failures that retrying will not fix.
+var errPermanent = errors.New("permanent download failure")
+
 // Download downloads a GGUF file from HuggingFace.
 // url should be a direct download URL like:
 //
 //	https://huggingface.co/<repo>/resolve/main/<filename>.gguf
-func Download(url, destDir string, progress DownloadProgress) (string, error) {
+//
+// Bytes are written to <filename>.partial and the transfer resumes from it,
+// both on a later call and within this call when the connection drops. If
+// expectedSHA256 is set the finished file must match it, otherwise the
+// partial file is discarded.
+func Download(ctx context.Context, url, destDir, expectedSHA256 string, progress DownloadProgress) (string, error) {
 	// Extract filename from URL
 	parts := strings.Split(url, "/")
 	filename := parts[len(parts)-1]
@@ -25,20 +44,69 @@ func Download(url, destDir string, progress DownloadProgress) (string, error) {
 	}
 
 	destPath := filepath.Join(destDir, filename)
+	partialPath := destPath + PartialSuffix
 
-	// Check for partial download (resume support)
-	var startByte int64
-	if info, err := os.Stat(destPath + ".partial"); err == nil {
-		startByte = info.Size()
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
 	}
+	defer f.Close()
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	// Re-hash what is already on disk so the checksum covers the whole file.
+	hasher := sha256.New()
+	downloaded, err := io.Copy(hasher, f)
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return "", fmt.Errorf("read partial file: %w", err)
+	}
+
+	var total int64
+	for attempt := 1; ; attempt++ {
+		downloaded, total, err = fetchRange(ctx, url, f, hasher, downloaded, progress)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errPermanent) || ctx.Err() != nil || attempt >= maxDownloadAttempts {
+			return "", err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(retryBackoff * time.Duration(attempt)):
+		}
+	}
+
+	if total > 0 && downloaded != total {
+		return "", fmt.Errorf("download incomplete: got %d of %d bytes", downloaded, total)
 	}
 
-	if startByte > 0 {
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startByte))
+	if expectedSHA256 != "" {
+		got := hex.EncodeToString(hasher.Sum(nil))
+		if !strings.EqualFold(got, expectedSHA256) {
+			f.Close()
+			os.Remove(partialPath)
+			return "", fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expectedSHA256, got)
+		}
+	}
+
+	// Rename partial to final
+	f.Close()
+	if err := os.Rename(partialPath, destPath); err != nil {
+		return "", fmt.Errorf("rename file: %w", err)
+	}
+
+	return destPath, nil
+}
+
+// fetchRange requests url from offset onwards and appends the body to f.
+// It returns the new file size and the total size reported by the server.
+func fetchRange(ctx context.Context, url string, f *os.File, hasher hash.Hash, offset int64, progress DownloadProgress) (int64, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return offset, 0, fmt.Errorf("create request: %w: %w", errPermanent, err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
 	// Use HF token if available
@@ -48,40 +116,45 @@ func Download(url, destDir string, progress DownloadProgress) (string, error) {
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("download request: %w", err)
+		return offset, 0, fmt.Errorf("download request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
-	}
-
-	totalSize := resp.ContentLength + startByte
-
-	// Open file for writing (append if resuming)
-	flags := os.O_CREATE | os.O_WRONLY
-	if startByte > 0 {
-		flags |= os.O_APPEND
-	} else {
-		flags |= os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file already holds every byte.
+		return offset, offset, nil
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		// Server ignored the Range header; start over.
+		if err := f.Truncate(0); err != nil {
+			return offset, 0, fmt.Errorf("truncate file: %w: %w", errPermanent, err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return offset, 0, fmt.Errorf("seek file: %w: %w", errPermanent, err)
+		}
+		hasher.Reset()
+		offset = 0
+	case resp.StatusCode >= 500:
+		return offset, 0, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		return offset, 0, fmt.Errorf("download failed with status %d: %w", resp.StatusCode, errPermanent)
 	}
 
-	partialPath := destPath + ".partial"
-	f, err := os.OpenFile(partialPath, flags, 0644)
-	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
+	totalSize := int64(-1)
+	if resp.ContentLength >= 0 {
+		totalSize = resp.ContentLength + offset
 	}
-	defer f.Close()
 
 	// Copy with progress tracking
+	w := io.MultiWriter(f, hasher)
 	buf := make([]byte, 32*1024)
-	downloaded := startByte
+	downloaded := offset
 
 	for {
 		n, readErr := resp.Body.Read(buf)
 		if n > 0 {
-			if _, writeErr := f.Write(buf[:n]); writeErr != nil {
-				return "", fmt.Errorf("write file: %w", writeErr)
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return downloaded, totalSize, fmt.Errorf("write file: %w: %w", errPermanent, writeErr)
 			}
 			downloaded += int64(n)
 			if progress != nil {
@@ -92,15 +165,12 @@ func Download(url, destDir string, progress DownloadProgress) (string, error) {
 			if readErr == io.EOF {
 				break
 			}
-			return "", fmt.Errorf("read body: %w", readErr)
+			return downloaded, totalSize, fmt.Errorf("read body: %w", readErr)
 		}
 	}
 
-	// Rename partial to final
-	f.Close()
-	if err := os.Rename(partialPath, destPath); err != nil {
-		return "", fmt.Errorf("rename file: %w", err)
+	if totalSize > 0 && downloaded < totalSize {
+		return downloaded, totalSize, fmt.Errorf("connection closed after %d of %d bytes", downloaded, totalSize)
 	}
-
-	return destPath, nil
+	return downloaded, totalSize, nil
 }
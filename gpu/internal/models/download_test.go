@@ -0,0 +1,111 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fileTime = time.Unix(1700000000, 0)
+
+func TestDownloadResumesPartial(t *testing.T) {
+	payload := bytes.Repeat([]byte("gguf"), 4096)
+	sum := sha256.Sum256(payload)
+
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		http.ServeContent(w, r, "model.gguf", fileTime, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "model.gguf"+PartialSuffix), payload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := Download(context.Background(), srv.URL+"/model.gguf", dir, hex.EncodeToString(sum[:]), nil)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if gotRange != "bytes=1000-" {
+		t.Errorf("Range header = %q, want bytes=1000-", gotRange)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Error("downloaded file does not match payload")
+	}
+	if _, err := os.Stat(path + PartialSuffix); !os.IsNotExist(err) {
+		t.Error("partial file should be renamed away")
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not the model you expected"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	_, err := Download(context.Background(), srv.URL+"/model.gguf", dir, strings.Repeat("0", 64), nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model.gguf"+PartialSuffix)); !os.IsNotExist(err) {
+		t.Error("corrupt partial file should be removed")
+	}
+}
+
+func TestDownloadRejectsNonGGUF(t *testing.T) {
+	if _, err := Download(context.Background(), "https://example.com/model.bin", t.TempDir(), "", nil); err == nil {
+		t.Error("expected error for non-gguf URL")
+	}
+}
+
+func TestStorePartials(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "done.gguf"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "half.gguf"+PartialSuffix), []byte("xyz"), 0644)
+
+	partials := NewStore(dir).Partials()
+	if len(partials) != 1 {
+		t.Fatalf("got %d partials, want 1", len(partials))
+	}
+	if partials[0].Name != "half" || partials[0].Size != 3 {
+		t.Errorf("unexpected partial entry: %+v", partials[0])
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"https://example.com/a.gguf", "https://example.com/a.gguf", false},
+		{"owner/repo/model-Q4_K_M.gguf", "https://huggingface.co/owner/repo/resolve/main/model-Q4_K_M.gguf", false},
+		{"owner/repo/sub/dir/m.gguf", "https://huggingface.co/owner/repo/resolve/main/sub/dir/m.gguf", false},
+		{"owner/repo", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveURL(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveURL(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveURL(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
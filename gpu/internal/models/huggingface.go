@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const huggingFaceBase = "https://huggingface.co"
+
+// ResolveURL turns a pull reference into a direct download URL. Full http(s)
+// URLs are returned unchanged; "<owner>/<repo>/<file>.gguf" is expanded to the
+// file on the repo's main branch.
+func ResolveURL(ref string) (string, error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref, nil
+	}
+
+	parts := strings.SplitN(strings.Trim(ref, "/"), "/", 3)
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid model reference %q: expected a URL or <owner>/<repo>/<file>.gguf", ref)
+	}
+	return fmt.Sprintf("%s/%s/%s/resolve/main/%s", huggingFaceBase, parts[0], parts[1], parts[2]), nil
+}
+
+// hfFile is one entry from the HuggingFace repo tree API.
+type hfFile struct {
+	Path string `json:"path"`
+	LFS  *struct {
+		OID  string `json:"oid"`
+		Size int64  `json:"size"`
+	} `json:"lfs"`
+}
+
+// LookupSHA256 asks the HuggingFace tree API for the SHA256 of the LFS file
+// behind a resolve URL. It returns "" without error for URLs that are not
+// HuggingFace resolve links.
+func LookupSHA256(ctx context.Context, url string) (string, error) {
+	rest, ok := strings.CutPrefix(url, huggingFaceBase+"/")
+	if !ok {
+		return "", nil
+	}
+	// <owner>/<repo>/resolve/<revision>/<path>
+	parts := strings.SplitN(rest, "/", 5)
+	if len(parts) < 5 || parts[2] != "resolve" {
+		return "", nil
+	}
+	repo, revision, filePath := parts[0]+"/"+parts[1], parts[3], parts[4]
+
+	treeURL := fmt.Sprintf("%s/api/models/%s/tree/%s", huggingFaceBase, repo, revision)
+	if dir := path.Dir(filePath); dir != "." {
+		treeURL += "/" + dir
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, treeURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	if token := os.Getenv("HF_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("manifest request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("manifest request returned %d", resp.StatusCode)
+	}
+
+	var files []hfFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return "", fmt.Errorf("decode manifest: %w", err)
+	}
+
+	for _, f := range files {
+		if f.Path == filePath && f.LFS != nil {
+			return f.LFS.OID, nil
+		}
+	}
+	return "", nil
+}
@@ -1,9 +1,16 @@
 package models
 
+import "github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+
+// PartialSuffix is appended to the filename of a download in progress.
+const PartialSuffix = ".partial"
+
 // ModelEntry represents a locally available model.
 type ModelEntry struct {
 	Name       string // display name (filename without .gguf)
 	Path       string // full path to the GGUF file
 	Size       int64  // file size in bytes
 	ModifiedAt int64  // unix timestamp
+
+	Metadata *api.ModelMetadata // registry entry, if any
 }
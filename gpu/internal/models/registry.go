@@ -0,0 +1,186 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// RegistryFile is the model registry in the models directory. It maps
+// model names (file names without .gguf) to their metadata:
+//
+//	{
+//	  "qwen2.5-coder-7b-q4": {
+//	    "aliases": ["coder"],
+//	    "ctx_size": 16384,
+//	    "chat_template": "qwen2.5",
+//	    "sampling": {"temperature": 0.7, "top_p": 0.8},
+//	    "flags": ["--no-context-shift"]
+//	  },
+//	  "qwen2.5-vl-7b-q4": {
+//	    "mmproj": "mmproj-qwen2.5-vl-7b-f16.gguf"
+//	  }
+//	}
+//
+// mmproj names the multimodal projector that lets a vision model take
+// images, relative to the models directory.
+const RegistryFile = "models.json"
+
+// Registry returns the model registry, empty if there is none.
+func (s *Store) Registry() (map[string]api.ModelMetadata, error) {
+	registry := make(map[string]api.ModelMetadata)
+	data, err := os.ReadFile(filepath.Join(s.dir, RegistryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", RegistryFile, err)
+	}
+	return registry, nil
+}
+
+// SaveRegistry replaces the model registry.
+func (s *Store) SaveRegistry(registry map[string]api.ModelMetadata) error {
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, RegistryFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SetAlias points alias at the model name, taking it from the model that
+// had it, and returns that model ("" if none). An empty name just removes
+// the alias.
+func (s *Store) SetAlias(alias, name string) (string, error) {
+	registry, err := s.Registry()
+	if err != nil {
+		return "", err
+	}
+	previous := ""
+	for model, meta := range registry {
+		i := slices.IndexFunc(meta.Aliases, func(a string) bool { return strings.EqualFold(a, alias) })
+		if i < 0 {
+			continue
+		}
+		previous = model
+		meta.Aliases = slices.Delete(meta.Aliases, i, i+1)
+		registry[model] = meta
+	}
+	if name != "" {
+		meta := registry[name]
+		meta.Aliases = append(meta.Aliases, alias)
+		registry[name] = meta
+	}
+	return previous, s.SaveRegistry(registry)
+}
+
+// NextVersion returns the version after the highest of family's versioned
+// aliases, family@v1, family@v2 and so on, or 1 if it has none.
+func (s *Store) NextVersion(family string) (int, error) {
+	registry, err := s.Registry()
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	prefix := strings.ToLower(family) + "@v"
+	for _, meta := range registry {
+		for _, a := range meta.Aliases {
+			if v, ok := strings.CutPrefix(strings.ToLower(a), prefix); ok {
+				if n, err := strconv.Atoi(v); err == nil && n > latest {
+					latest = n
+				}
+			}
+		}
+	}
+	return latest + 1, nil
+}
+
+// Metadata returns the registry entry of the model at path, or nil.
+func (s *Store) Metadata(path string) *api.ModelMetadata {
+	registry, err := s.Registry()
+	if err != nil {
+		return nil
+	}
+	if meta, ok := registry[ModelName(path)]; ok {
+		return &meta
+	}
+	return nil
+}
+
+// ResolveAlias returns the name of the model alias stands for, and whether
+// there is one.
+func (s *Store) ResolveAlias(alias string) (string, bool, error) {
+	registry, err := s.Registry()
+	if err != nil {
+		return "", false, err
+	}
+	for name, meta := range registry {
+		for _, a := range meta.Aliases {
+			if strings.EqualFold(a, alias) {
+				return name, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// LaunchArgs returns the llama-server flags for a model's recommended
+// sampling defaults and extra flags.
+func LaunchArgs(meta *api.ModelMetadata) []string {
+	if meta == nil {
+		return nil
+	}
+	var args []string
+	if p := meta.Sampling; p != nil {
+		addFloat := func(flag string, v *float64) {
+			if v != nil {
+				args = append(args, flag, strconv.FormatFloat(*v, 'g', -1, 64))
+			}
+		}
+		addFloat("--temp", p.Temperature)
+		addFloat("--top-p", p.TopP)
+		if p.TopK != nil {
+			args = append(args, "--top-k", strconv.Itoa(*p.TopK))
+		}
+		addFloat("--min-p", p.MinP)
+		addFloat("--repeat-penalty", p.RepeatPenalty)
+	}
+	return append(args, meta.Flags...)
+}
+
+// Projector returns the path of a model's multimodal projector, or "" if
+// it has none.
+func (s *Store) Projector(meta *api.ModelMetadata) (string, error) {
+	if meta == nil || meta.MMProj == "" {
+		return "", nil
+	}
+	path := meta.MMProj
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dir, path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("mmproj: %w", err)
+	}
+	return path, nil
+}
+
+// ModelName returns the name of the model at path, its registry key.
+func ModelName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
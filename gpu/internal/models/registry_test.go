@@ -0,0 +1,137 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+func writeStore(t *testing.T, registry string, models ...string) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	for _, m := range models {
+		if err := os.WriteFile(filepath.Join(dir, m), []byte("GGUF"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if registry != "" {
+		if err := os.WriteFile(filepath.Join(dir, RegistryFile), []byte(registry), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewStore(dir)
+}
+
+func TestResolveAlias(t *testing.T) {
+	s := writeStore(t, `{
+		"qwen2.5-coder-7b-q4": {"aliases": ["coder"], "ctx_size": 16384},
+		"gone": {"aliases": ["missing"]}
+	}`, "qwen2.5-coder-7b-q4.gguf", "coder-small.gguf")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"coder", "qwen2.5-coder-7b-q4.gguf"},
+		{"CODER", "qwen2.5-coder-7b-q4.gguf"},
+		{"coder-small", "coder-small.gguf"}, // a file name wins over an alias
+		{"small", "coder-small.gguf"},
+	}
+	for _, tt := range tests {
+		path, err := s.Resolve(tt.name)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tt.name, err)
+			continue
+		}
+		if got := filepath.Base(path); got != tt.want {
+			t.Errorf("Resolve(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := s.Resolve("missing"); err == nil {
+		t.Error("Resolve of an alias for a missing model should fail")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	s := writeStore(t, `{"a": {"ctx_size": 8192, "chat_template": "qwen2.5"}}`, "a.gguf", "b.gguf")
+
+	meta := s.Metadata(filepath.Join(s.Dir(), "a.gguf"))
+	if meta == nil || meta.CtxSize != 8192 || meta.ChatTemplate != "qwen2.5" {
+		t.Errorf("Metadata(a) = %+v", meta)
+	}
+	if meta := s.Metadata(filepath.Join(s.Dir(), "b.gguf")); meta != nil {
+		t.Errorf("Metadata(b) = %+v, want nil", meta)
+	}
+
+	for _, e := range s.List() {
+		if (e.Metadata != nil) != (e.Name == "a") {
+			t.Errorf("List entry %s has metadata %+v", e.Name, e.Metadata)
+		}
+	}
+}
+
+func TestRegistryMissingAndMalformed(t *testing.T) {
+	s := writeStore(t, "", "a.gguf")
+	if registry, err := s.Registry(); err != nil || len(registry) != 0 {
+		t.Errorf("Registry() = %v, %v; want empty", registry, err)
+	}
+
+	s = writeStore(t, "{not json", "a.gguf")
+	if _, err := s.Resolve("coder"); err == nil {
+		t.Error("Resolve should report a malformed registry")
+	}
+}
+
+func TestSetAliasAndNextVersion(t *testing.T) {
+	s := writeStore(t, `{"mine-v1": {"aliases": ["mine@v1", "mine"], "ctx_size": 8192}}`, "mine-v1.gguf", "mine-v2.gguf")
+
+	if v, err := s.NextVersion("mine"); err != nil || v != 2 {
+		t.Fatalf("NextVersion = %d, %v; want 2", v, err)
+	}
+	if _, err := s.SetAlias("mine@v2", "mine-v2"); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := s.SetAlias("MINE", "mine-v2")
+	if err != nil || previous != "mine-v1" {
+		t.Fatalf("SetAlias = %q, %v; want mine-v1", previous, err)
+	}
+
+	if path, err := s.Resolve("mine"); err != nil || filepath.Base(path) != "mine-v2.gguf" {
+		t.Errorf("Resolve(mine) = %s, %v", path, err)
+	}
+	if path, err := s.Resolve("mine@v1"); err != nil || filepath.Base(path) != "mine-v1.gguf" {
+		t.Errorf("Resolve(mine@v1) = %s, %v", path, err)
+	}
+	if meta := s.Metadata(filepath.Join(s.Dir(), "mine-v1.gguf")); meta == nil || meta.CtxSize != 8192 {
+		t.Errorf("moving an alias lost metadata: %+v", meta)
+	}
+	if v, _ := s.NextVersion("mine"); v != 3 {
+		t.Errorf("NextVersion = %d, want 3", v)
+	}
+
+	if _, err := s.SetAlias("mine", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.ResolveAlias("mine"); ok {
+		t.Error("alias still set after removing it")
+	}
+}
+
+func TestLaunchArgs(t *testing.T) {
+	temp, topK := 0.7, 20
+	got := LaunchArgs(&api.ModelMetadata{
+		Sampling: &api.SamplingParams{Temperature: &temp, TopK: &topK},
+		Flags:    []string{"--no-context-shift"},
+	})
+	want := []string{"--temp", "0.7", "--top-k", "20", "--no-context-shift"}
+	if !slices.Equal(got, want) {
+		t.Errorf("LaunchArgs = %v, want %v", got, want)
+	}
+	if got := LaunchArgs(nil); got != nil {
+		t.Errorf("LaunchArgs(nil) = %v, want nil", got)
+	}
+}
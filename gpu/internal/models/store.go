@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Store manages locally available GGUF model files.
@@ -22,9 +23,11 @@ func (s *Store) Dir() string {
 	return s.dir
 }
 
-// List returns all available models by scanning the models directory for .gguf files.
+// List returns all available models by scanning the models directory for
+// .gguf files, with their registry metadata.
 func (s *Store) List() []ModelEntry {
 	var entries []ModelEntry
+	registry, _ := s.Registry()
 
 	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -33,13 +36,17 @@ func (s *Store) List() []ModelEntry {
 		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".gguf") {
 			return nil
 		}
-		name := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
-		entries = append(entries, ModelEntry{
+		name := ModelName(path)
+		entry := ModelEntry{
 			Name:       name,
 			Path:       path,
 			Size:       info.Size(),
 			ModifiedAt: info.ModTime().Unix(),
-		})
+		}
+		if meta, ok := registry[name]; ok {
+			entry.Metadata = &meta
+		}
+		entries = append(entries, entry)
 		return nil
 	})
 	if err != nil {
@@ -49,9 +56,56 @@ func (s *Store) List() []ModelEntry {
 	return entries
 }
 
+// ResolveWhisper finds a whisper.cpp model: a path, or a ggml file in the
+// models directory named name, name.bin or ggml-name.bin, so "base.en"
+// finds ggml-base.en.bin as whisper.cpp's download script names it.
+func (s *Store) ResolveWhisper(name string) (string, error) {
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{
+			filepath.Join(s.dir, name),
+			filepath.Join(s.dir, name+".bin"),
+			filepath.Join(s.dir, "ggml-"+name+".bin"),
+			name,
+		}
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("whisper model %q not found in %s", name, s.dir)
+}
+
+// Partials returns downloads that were interrupted before completion. Each
+// entry's Size is the number of bytes fetched so far; pulling the same URL
+// again resumes from there.
+func (s *Store) Partials() []ModelEntry {
+	var entries []ModelEntry
+
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), PartialSuffix) {
+			return nil
+		}
+		file := strings.TrimSuffix(info.Name(), PartialSuffix)
+		entries = append(entries, ModelEntry{
+			Name:       strings.TrimSuffix(file, filepath.Ext(file)),
+			Path:       path,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().Unix(),
+		})
+		return nil
+	})
+
+	return entries
+}
+
 // Resolve finds a model by name and returns its full path.
 // It searches for an exact filename match (with or without .gguf extension),
-// or a partial name match.
+// an alias from the registry, or a partial name match.
 func (s *Store) Resolve(name string) (string, error) {
 	// Try exact path first
 	if filepath.IsAbs(name) {
@@ -70,6 +124,20 @@ func (s *Store) Resolve(name string) (string, error) {
 		return candidate, nil
 	}
 
+	// Try registry aliases
+	target, ok, err := s.ResolveAlias(name)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		for _, e := range s.List() {
+			if e.Name == target {
+				return e.Path, nil
+			}
+		}
+		return "", fmt.Errorf("alias %q: model %q not found in %s", name, target, s.dir)
+	}
+
 	// Search by partial name match
 	entries := s.List()
 	for _, e := range entries {
@@ -83,3 +151,33 @@ func (s *Store) Resolve(name string) (string, error) {
 
 	return "", fmt.Errorf("model %q not found in %s", name, s.dir)
 }
+
+// Delete removes the model file named exactly name (aliases and partial
+// names are not accepted, to avoid deleting the wrong file) and returns
+// its entry.
+func (s *Store) Delete(name string) (ModelEntry, error) {
+	name = strings.TrimSuffix(name, ".gguf")
+	for _, e := range s.List() {
+		if e.Name == name {
+			return e, os.Remove(e.Path)
+		}
+	}
+	return ModelEntry{}, fmt.Errorf("model %q not found in %s: %w", name, s.dir, os.ErrNotExist)
+}
+
+// PrunePartials removes interrupted downloads and returns them. Partial
+// files written to within minAge are kept, as their download may still be
+// running.
+func (s *Store) PrunePartials(minAge time.Duration) ([]ModelEntry, error) {
+	var removed []ModelEntry
+	for _, p := range s.Partials() {
+		if time.Since(time.Unix(p.ModifiedAt, 0)) < minAge {
+			continue
+		}
+		if err := os.Remove(p.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDelete(t *testing.T) {
+	s := writeStore(t, "", "qwen2.5-coder-7b-q4.gguf")
+
+	if _, err := s.Delete("coder"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Delete by partial name: err = %v, want not found", err)
+	}
+	e, err := s.Delete("qwen2.5-coder-7b-q4.gguf")
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(e.Path); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", e.Path)
+	}
+}
+
+func TestResolveWhisper(t *testing.T) {
+	s := writeStore(t, "", "ggml-base.en.bin", "small.bin")
+
+	for name, want := range map[string]string{
+		"base.en":          "ggml-base.en.bin",
+		"ggml-base.en.bin": "ggml-base.en.bin",
+		"small":            "small.bin",
+	} {
+		got, err := s.ResolveWhisper(name)
+		if err != nil || got != filepath.Join(s.Dir(), want) {
+			t.Errorf("ResolveWhisper(%q) = %q, %v; want %s", name, got, err, want)
+		}
+	}
+	if _, err := s.ResolveWhisper("large"); err == nil {
+		t.Error("ResolveWhisper(large) found a model that is not there")
+	}
+}
+
+func TestPrunePartials(t *testing.T) {
+	s := writeStore(t, "", "old.gguf"+PartialSuffix, "fresh.gguf"+PartialSuffix, "done.gguf")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(s.Dir(), "old.gguf"+PartialSuffix), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.PrunePartials(time.Minute)
+	if err != nil {
+		t.Fatalf("PrunePartials: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Name != "old" {
+		t.Errorf("removed %+v, want only old", removed)
+	}
+	if left := s.Partials(); len(left) != 1 || left[0].Name != "fresh" {
+		t.Errorf("partials left %+v, want only fresh", left)
+	}
+	if len(s.List()) != 1 {
+		t.Error("finished downloads must be kept")
+	}
+}
@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// CacheStats counts how much of the prompts sent to llama-server was served
+// from its KV cache instead of being evaluated again.
+type CacheStats struct {
+	Slots        int
+	Requests     int64
+	PromptTokens int64 // prompt tokens evaluated
+	CachedTokens int64 // prompt tokens reused from the cache
+}
+
+// HitRatio is the share of prompt tokens that came from the cache.
+func (s CacheStats) HitRatio() float64 {
+	total := s.PromptTokens + s.CachedTokens
+	if total == 0 {
+		return 0
+	}
+	return float64(s.CachedTokens) / float64(total)
+}
+
+// llamaTimings is the part of llama-server's "timings" object that
+// describes prompt processing.
+type llamaTimings struct {
+	CacheN  int `json:"cache_n"`  // prompt tokens taken from the cache
+	PromptN int `json:"prompt_n"` // prompt tokens evaluated
+}
+
+// promptCache pins sessions to llama-server slots. Each slot keeps the KV
+// cache of the last prompt it processed, so an agent that resends a growing
+// conversation only pays for the new messages as long as its requests keep
+// landing on the same slot. When there are more sessions than slots, the
+// least recently used slot is handed over.
+type promptCache struct {
+	mu        sync.Mutex
+	owner     []string    // session each slot belongs to
+	lastUse   []time.Time // when each slot was last given out
+	bySession map[string]int
+	stats     CacheStats
+}
+
+func newPromptCache(slots int) *promptCache {
+	if slots < 1 {
+		slots = 1
+	}
+	return &promptCache{
+		owner:     make([]string, slots),
+		lastUse:   make([]time.Time, slots),
+		bySession: make(map[string]int),
+		stats:     CacheStats{Slots: slots},
+	}
+}
+
+// slot returns the slot for session, or -1 to let llama-server pick an idle
+// one when the request does not belong to a session.
+func (c *promptCache) slot(session string) int {
+	if session == "" {
+		return -1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slot, ok := c.bySession[session]
+	if !ok {
+		slot = 0
+		for i, t := range c.lastUse {
+			if t.Before(c.lastUse[slot]) {
+				slot = i
+			}
+		}
+		delete(c.bySession, c.owner[slot])
+		c.owner[slot] = session
+		c.bySession[session] = slot
+	}
+	c.lastUse[slot] = time.Now()
+	return slot
+}
+
+// reset forgets slot assignments, e.g. after llama-server restarted with
+// empty caches. The counters are kept.
+func (c *promptCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.owner)
+	clear(c.lastUse)
+	clear(c.bySession)
+}
+
+func (c *promptCache) record(t *llamaTimings) {
+	if t == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Requests++
+	c.stats.PromptTokens += int64(t.PromptN)
+	c.stats.CachedTokens += int64(t.CacheN)
+}
+
+func (c *promptCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// timingsWriter passes an SSE stream through unchanged and keeps the
+// timings llama-server attaches to its final chunk.
+type timingsWriter struct {
+	w       io.Writer
+	line    []byte
+	timings *llamaTimings
+}
+
+func (t *timingsWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	rest := p[:n]
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			t.line = append(t.line, rest...)
+			break
+		}
+		t.line = append(t.line, rest[:i]...)
+		t.scan(t.line)
+		t.line = t.line[:0]
+		rest = rest[i+1:]
+	}
+	return n, err
+}
+
+func (t *timingsWriter) scan(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data: "))
+	if !ok || !bytes.Contains(data, []byte(`"timings"`)) {
+		return
+	}
+	var chunk struct {
+		Timings *llamaTimings `json:"timings"`
+	}
+	if json.Unmarshal(data, &chunk) == nil && chunk.Timings != nil {
+		t.timings = chunk.Timings
+	}
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPromptCacheSlotAffinity(t *testing.T) {
+	c := newPromptCache(2)
+
+	if got := c.slot(""); got != -1 {
+		t.Errorf("slot without session = %d, want -1", got)
+	}
+	a := c.slot("a")
+	b := c.slot("b")
+	if a == b {
+		t.Fatalf("sessions a and b share slot %d", a)
+	}
+	if got := c.slot("a"); got != a {
+		t.Errorf("session a moved from slot %d to %d", a, got)
+	}
+
+	// b is now the least recently used, so c takes its slot.
+	if got := c.slot("c"); got != b {
+		t.Errorf("session c got slot %d, want b's slot %d", got, b)
+	}
+	if got := c.slot("a"); got != a {
+		t.Errorf("session a moved from slot %d to %d", a, got)
+	}
+
+	c.reset()
+	if _, ok := c.bySession["a"]; ok {
+		t.Error("reset kept slot assignments")
+	}
+}
+
+func TestPromptCacheStats(t *testing.T) {
+	c := newPromptCache(1)
+	c.record(&llamaTimings{CacheN: 0, PromptN: 100})
+	c.record(&llamaTimings{CacheN: 90, PromptN: 10})
+	c.record(nil)
+
+	stats := c.snapshot()
+	if stats.Requests != 2 || stats.PromptTokens != 110 || stats.CachedTokens != 90 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if got := stats.HitRatio(); got != 0.45 {
+		t.Errorf("HitRatio = %v, want 0.45", got)
+	}
+}
+
+func TestTimingsWriter(t *testing.T) {
+	stream := "data: {\"choices\":[]}\n\n" +
+		"data: {\"choices\":[],\"timings\":{\"cache_n\":42,\"prompt_n\":8}}\n\n" +
+		"data: [DONE]\n\n"
+
+	var out bytes.Buffer
+	tw := &timingsWriter{w: &out}
+	// Write in small pieces so lines are split across writes.
+	for i := 0; i < len(stream); i += 7 {
+		end := min(i+7, len(stream))
+		if _, err := tw.Write([]byte(stream[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out.String() != stream {
+		t.Error("stream was not passed through unchanged")
+	}
+	if tw.timings == nil || tw.timings.CacheN != 42 || tw.timings.PromptN != 8 {
+		t.Errorf("timings = %+v", tw.timings)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
@@ -39,36 +40,81 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
-// ChatCompletion sends a non-streaming chat completion request.
-func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
-	body, err := json.Marshal(req)
+// llamaChatRequest adds llama-server's prompt cache fields to a request.
+type llamaChatRequest struct {
+	*api.ChatCompletionRequest
+	CachePrompt bool `json:"cache_prompt"`
+	IDSlot      int  `json:"id_slot"` // -1 = any idle slot
+}
+
+// ChatCompletion sends a non-streaming chat completion request to the given
+// slot (-1 = any), with prompt caching on. It also returns llama-server's
+// prompt timings, if it reported them.
+func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest, slot int) (*api.ChatCompletionResponse, *llamaTimings, error) {
+	body, err := json.Marshal(llamaChatRequest{ChatCompletionRequest: req, CachePrompt: true, IDSlot: slot})
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, nil, fmt.Errorf("marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, nil, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, nil, fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, nil, llamaError(resp)
 	}
 
-	var result api.ChatCompletionResponse
+	var result struct {
+		api.ChatCompletionResponse
+		Timings *llamaTimings `json:"timings"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return nil, nil, fmt.Errorf("decode response: %w", err)
 	}
 
-	return &result, nil
+	return &result.ChatCompletionResponse, result.Timings, nil
+}
+
+// loraScale sets the scale of the adapter at ID, its position in
+// llama-server's --lora arguments. Scale 0 disables it.
+type loraScale struct {
+	ID    int     `json:"id"`
+	Scale float64 `json:"scale"`
+}
+
+// SetLoraAdapters sets the scale of every adapter llama-server was started
+// with.
+func (c *Client) SetLoraAdapters(ctx context.Context, scales []loraScale) error {
+	body, err := json.Marshal(scales)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/lora-adapters", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("lora-adapters returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
 }
 
 // Tokenize sends text to the /tokenize endpoint and returns the token count.
@@ -109,32 +155,47 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 	return len(result.Tokens), nil
 }
 
-// ChatCompletionStream sends a streaming chat completion request and writes SSE chunks to the writer.
-func (c *Client) ChatCompletionStream(ctx context.Context, req *api.ChatCompletionRequest, w io.Writer) error {
-	body, err := json.Marshal(req)
+// ChatCompletionStream sends a streaming chat completion request to the
+// given slot (-1 = any), with prompt caching on, and writes SSE chunks to
+// the writer. It also returns the prompt timings from the final chunk.
+func (c *Client) ChatCompletionStream(ctx context.Context, req *api.ChatCompletionRequest, slot int, w io.Writer) (*llamaTimings, error) {
+	body, err := json.Marshal(llamaChatRequest{ChatCompletionRequest: req, CachePrompt: true, IDSlot: slot})
 	if err != nil {
-		return fmt.Errorf("marshal request: %w", err)
+		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("send request: %w", err)
+		return nil, fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, llamaError(resp)
 	}
 
 	// Pipe the SSE stream directly to the response writer.
 	// llama-server already formats it as proper SSE (data: {...}\n\n).
-	_, err = io.Copy(w, resp.Body)
-	return err
+	tw := &timingsWriter{w: w}
+	_, err = io.Copy(tw, resp.Body)
+	return tw.timings, err
+}
+
+// llamaError converts a llama-server error response into an *api.Error.
+// Prompts that do not fit the context window get CodeContextExceeded.
+func llamaError(resp *http.Response) error {
+	respBody, _ := io.ReadAll(resp.Body)
+	apiErr := api.DecodeError(resp.StatusCode, respBody)
+	if apiErr.Code == "exceed_context_size_error" || strings.Contains(apiErr.Message, "exceeds the available context size") {
+		apiErr.Code = api.CodeContextExceeded
+	} else {
+		apiErr.Code = api.CodeInferenceError
+	}
+	return apiErr
 }
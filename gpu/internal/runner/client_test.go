@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+func TestChatCompletionPassesSampling(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(api.ChatCompletionResponse{})
+	}))
+	defer server.Close()
+
+	topK := 20
+	req := &api.ChatCompletionRequest{
+		Messages:  []api.Message{{Role: "user", Content: "hi"}},
+		Stop:      []string{"</tool_call>"},
+		TopK:      &topK,
+		LogitBias: map[string]float64{"15043": -100},
+	}
+	if _, _, err := NewClient(server.URL).ChatCompletion(context.Background(), req, 2); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+
+	if stop, _ := got["stop"].([]any); !slices.Equal(stop, []any{"</tool_call>"}) {
+		t.Errorf("stop = %v", got["stop"])
+	}
+	if got["top_k"] != float64(20) {
+		t.Errorf("top_k = %v", got["top_k"])
+	}
+	if bias, _ := got["logit_bias"].(map[string]any); bias["15043"] != float64(-100) {
+		t.Errorf("logit_bias = %v", got["logit_bias"])
+	}
+	if got["id_slot"] != float64(2) || got["cache_prompt"] != true {
+		t.Errorf("cache fields = %v, %v", got["id_slot"], got["cache_prompt"])
+	}
+	if _, ok := got["min_p"]; ok {
+		t.Error("unset parameters must be left out")
+	}
+}
+
+func TestChatCompletionSendsImageParts(t *testing.T) {
+	var got struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(api.ChatCompletionResponse{})
+	}))
+	defer server.Close()
+
+	req := &api.ChatCompletionRequest{Messages: []api.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "what is this?", Images: []string{"data:image/png;base64,iVBORw0KGgo="}},
+	}}
+	if _, _, err := NewClient(server.URL).ChatCompletion(context.Background(), req, 0); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if len(got.Messages) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(got.Messages))
+	}
+
+	var plain struct{ Content string }
+	if err := json.Unmarshal(got.Messages[0], &plain); err != nil || plain.Content != "be brief" {
+		t.Errorf("message without images sent as %s, want plain content", got.Messages[0])
+	}
+	var parts struct{ Content []api.ContentPart }
+	if err := json.Unmarshal(got.Messages[1], &parts); err != nil {
+		t.Fatalf("message with images sent as %s: %v", got.Messages[1], err)
+	}
+	if c := parts.Content; len(c) != 2 || c[0].Type != "text" || c[0].Text != "what is this?" ||
+		c[1].Type != "image_url" || c[1].ImageURL == nil || c[1].ImageURL.URL != req.Messages[1].Images[0] {
+		t.Errorf("content = %s, want a text part and an image_url part", got.Messages[1])
+	}
+
+	var back api.Message
+	if err := json.Unmarshal(got.Messages[1], &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if back.Content != "what is this?" || !slices.Equal(back.Images, req.Messages[1].Images) {
+		t.Errorf("round trip = %+v", back)
+	}
+}
@@ -0,0 +1,248 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// GGUF metadata value types.
+const (
+	ggufTypeUint8 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// GGUFInfo is the metadata of a GGUF model worth showing to users.
+type GGUFInfo struct {
+	Architecture  string // e.g. "qwen2"
+	Name          string // model name given by its publisher
+	SizeLabel     string // parameter count, e.g. "7B"
+	FileType      string // quantization, e.g. "Q4_K_M"
+	BlockCount    int
+	ContextLength int    // context length the model was trained for
+	ChatTemplate  string // Jinja chat template embedded in the model
+}
+
+// ggufFileTypes names llama.cpp's general.file_type values.
+var ggufFileTypes = map[int]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M",
+	16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S",
+	22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0",
+}
+
+// errStopScan ends scanGGUF early without an error.
+var errStopScan = errors.New("stop scan")
+
+// ReadGGUFInfo reads the descriptive metadata of a GGUF model.
+func ReadGGUFInfo(path string) (*GGUFInfo, error) {
+	info := &GGUFInfo{}
+	err := scanGGUF(path, func(key string, typ uint32, r io.Reader) (bool, error) {
+		var err error
+		switch {
+		case key == "general.architecture":
+			info.Architecture, err = ggufStringValue(r, typ)
+		case key == "general.name":
+			info.Name, err = ggufStringValue(r, typ)
+		case key == "general.size_label":
+			info.SizeLabel, err = ggufStringValue(r, typ)
+		case key == "general.file_type":
+			var ft int
+			if ft, err = ggufInt(r, typ); err == nil {
+				info.FileType = ggufFileTypes[ft]
+				if info.FileType == "" {
+					info.FileType = fmt.Sprintf("type %d", ft)
+				}
+			}
+		case key == "tokenizer.chat_template":
+			info.ChatTemplate, err = ggufStringValue(r, typ)
+		case strings.HasSuffix(key, ".block_count"):
+			info.BlockCount, err = ggufInt(r, typ)
+		case strings.HasSuffix(key, ".context_length"):
+			info.ContextLength, err = ggufInt(r, typ)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// BlockCount returns the number of transformer blocks in a GGUF model, read
+// from its "<arch>.block_count" metadata. llama-server can offload one more
+// layer than this: the output layer.
+func BlockCount(path string) (int, error) {
+	n := -1
+	err := scanGGUF(path, func(key string, typ uint32, r io.Reader) (bool, error) {
+		if !strings.HasSuffix(key, ".block_count") {
+			return false, nil
+		}
+		var err error
+		if n, err = ggufInt(r, typ); err != nil {
+			return true, err
+		}
+		return true, errStopScan
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("gguf metadata has no block_count")
+	}
+	return n, nil
+}
+
+// scanGGUF calls visit for each metadata key of the GGUF file at path.
+// visit either reads the value and returns true, or returns false to have
+// it skipped. Returning errStopScan ends the scan successfully.
+func scanGGUF(path string, visit func(key string, typ uint32, r io.Reader) (bool, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Tensors uint64
+		KVs     uint64
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("read gguf header: %w", err)
+	}
+	if string(header.Magic[:]) != "GGUF" {
+		return errors.New("not a GGUF file")
+	}
+	if header.Version < 2 {
+		return fmt.Errorf("unsupported GGUF version %d", header.Version)
+	}
+
+	for i := uint64(0); i < header.KVs; i++ {
+		key, err := ggufString(r)
+		if err != nil {
+			return err
+		}
+		var typ uint32
+		if err := binary.Read(r, binary.LittleEndian, &typ); err != nil {
+			return err
+		}
+		read, err := visit(key, typ, r)
+		if errors.Is(err, errStopScan) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", key, err)
+		}
+		if read {
+			continue
+		}
+		if err := ggufSkip(r, typ); err != nil {
+			return fmt.Errorf("skip %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func ggufString(r io.Reader) (string, error) {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	if n > 1<<20 {
+		return "", fmt.Errorf("gguf string of %d bytes", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ggufStringValue reads a value that must be a string.
+func ggufStringValue(r io.Reader, typ uint32) (string, error) {
+	if typ != ggufTypeString {
+		return "", fmt.Errorf("value type %d is not a string", typ)
+	}
+	return ggufString(r)
+}
+
+// ggufInt reads an integer value of the given type.
+func ggufInt(r io.Reader, typ uint32) (int, error) {
+	switch typ {
+	case ggufTypeUint32, ggufTypeInt32:
+		var v uint32
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return int(v), err
+	case ggufTypeUint64, ggufTypeInt64:
+		var v uint64
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return int(v), err
+	case ggufTypeUint16, ggufTypeInt16:
+		var v uint16
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return int(v), err
+	case ggufTypeUint8, ggufTypeInt8:
+		var v uint8
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return int(v), err
+	}
+	return 0, fmt.Errorf("value type %d is not an integer", typ)
+}
+
+// ggufSkip reads past a value of the given type.
+func ggufSkip(r io.Reader, typ uint32) error {
+	var size int64
+	switch typ {
+	case ggufTypeUint8, ggufTypeInt8, ggufTypeBool:
+		size = 1
+	case ggufTypeUint16, ggufTypeInt16:
+		size = 2
+	case ggufTypeUint32, ggufTypeInt32, ggufTypeFloat32:
+		size = 4
+	case ggufTypeUint64, ggufTypeInt64, ggufTypeFloat64:
+		size = 8
+	case ggufTypeString:
+		_, err := ggufString(r)
+		return err
+	case ggufTypeArray:
+		var elemType uint32
+		var n uint64
+		if err := binary.Read(r, binary.LittleEndian, &elemType); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := ggufSkip(r, elemType); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown value type %d", typ)
+	}
+	_, err := io.CopyN(io.Discard, r, size)
+	return err
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGGUF writes a GGUF header with the given metadata and no tensors.
+func writeGGUF(t *testing.T, kvs func(w func(v any))) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var count uint64
+	var body []any
+	kvs(func(v any) { body = append(body, v) })
+	for _, v := range body {
+		if _, ok := v.(kvStart); ok {
+			count++
+		}
+	}
+
+	write := func(v any) {
+		if err := binary.Write(f, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.WriteString("GGUF")
+	write(uint32(3))
+	write(uint64(0))
+	write(count)
+	for _, v := range body {
+		switch v := v.(type) {
+		case kvStart:
+			write(uint64(len(v)))
+			f.WriteString(string(v))
+		case string:
+			write(uint64(len(v)))
+			f.WriteString(v)
+		default:
+			write(v)
+		}
+	}
+	return path
+}
+
+// kvStart marks the key that begins a metadata entry.
+type kvStart string
+
+func TestBlockCount(t *testing.T) {
+	path := writeGGUF(t, func(w func(v any)) {
+		w(kvStart("general.architecture"))
+		w(uint32(ggufTypeString))
+		w("llama")
+		w(kvStart("general.tags"))
+		w(uint32(ggufTypeArray))
+		w(uint32(ggufTypeString))
+		w(uint64(2))
+		w("a")
+		w("b")
+		w(kvStart("llama.context_length"))
+		w(uint32(ggufTypeUint64))
+		w(uint64(8192))
+		w(kvStart("llama.block_count"))
+		w(uint32(ggufTypeUint32))
+		w(uint32(32))
+	})
+
+	n, err := BlockCount(path)
+	if err != nil {
+		t.Fatalf("BlockCount: %v", err)
+	}
+	if n != 32 {
+		t.Errorf("BlockCount = %d, want 32", n)
+	}
+}
+
+func TestBlockCountMissing(t *testing.T) {
+	path := writeGGUF(t, func(w func(v any)) {
+		w(kvStart("general.architecture"))
+		w(uint32(ggufTypeString))
+		w("llama")
+	})
+	if _, err := BlockCount(path); err == nil {
+		t.Error("expected an error without block_count")
+	}
+
+	notGGUF := filepath.Join(t.TempDir(), "x.gguf")
+	os.WriteFile(notGGUF, []byte("not a model at all, just text"), 0644)
+	if _, err := BlockCount(notGGUF); err == nil {
+		t.Error("expected an error for a non-GGUF file")
+	}
+}
+
+func TestReadGGUFInfo(t *testing.T) {
+	path := writeGGUF(t, func(w func(v any)) {
+		w(kvStart("general.architecture"))
+		w(uint32(ggufTypeString))
+		w("qwen2")
+		w(kvStart("general.size_label"))
+		w(uint32(ggufTypeString))
+		w("7B")
+		w(kvStart("general.file_type"))
+		w(uint32(ggufTypeUint32))
+		w(uint32(15))
+		w(kvStart("qwen2.block_count"))
+		w(uint32(ggufTypeUint32))
+		w(uint32(28))
+		w(kvStart("qwen2.context_length"))
+		w(uint32(ggufTypeUint32))
+		w(uint32(32768))
+		w(kvStart("tokenizer.ggml.tokens"))
+		w(uint32(ggufTypeArray))
+		w(uint32(ggufTypeString))
+		w(uint64(1))
+		w("<|im_start|>")
+		w(kvStart("tokenizer.chat_template"))
+		w(uint32(ggufTypeString))
+		w("{{ messages }}")
+	})
+
+	info, err := ReadGGUFInfo(path)
+	if err != nil {
+		t.Fatalf("ReadGGUFInfo: %v", err)
+	}
+	want := GGUFInfo{
+		Architecture:  "qwen2",
+		SizeLabel:     "7B",
+		FileType:      "Q4_K_M",
+		BlockCount:    28,
+		ContextLength: 32768,
+		ChatTemplate:  "{{ messages }}",
+	}
+	if *info != want {
+		t.Errorf("ReadGGUFInfo = %+v, want %+v", *info, want)
+	}
+}
@@ -0,0 +1,438 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// DefaultOllamaURL is where the Ollama daemon listens unless told otherwise.
+const DefaultOllamaURL = "http://127.0.0.1:11434"
+
+// ErrNoTokenizer is returned by runners whose backend cannot count tokens.
+var ErrNoTokenizer = errors.New("the ollama backend has no tokenizer endpoint")
+
+// OllamaRunner serves completions from an existing Ollama daemon, using the
+// models it has pulled instead of starting llama-server. Requests and
+// responses are translated between the OpenAI format and Ollama's /api/chat.
+type OllamaRunner struct {
+	baseURL    string
+	httpClient *http.Client
+	model      string
+	ctxSize    int
+	vision     bool
+	tools      bool
+}
+
+// NewOllamaRunner creates a runner for the Ollama daemon at baseURL.
+func NewOllamaRunner(baseURL string) *OllamaRunner {
+	return &OllamaRunner{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: &http.Client{}}
+}
+
+// Load checks that the daemon has model, an Ollama model name such as
+// "qwen2.5-coder:7b", and has it load the model so the first request does
+// not wait. opts.CtxSize is sent with every request as num_ctx.
+func (r *OllamaRunner) Load(ctx context.Context, model string, opts Options) error {
+	var show struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := r.post(ctx, "/api/show", map[string]string{"model": model}, &show); err != nil {
+		return fmt.Errorf("ollama model %s: %w", model, err)
+	}
+	r.model = model
+	r.ctxSize = opts.CtxSize
+	r.vision = slices.Contains(show.Capabilities, "vision")
+	r.tools = slices.Contains(show.Capabilities, "tools")
+
+	// A chat request without messages loads the model.
+	return r.post(ctx, "/api/chat", ollamaChatRequest{Model: model, Messages: []ollamaMessage{}, Options: r.options(nil)}, nil)
+}
+
+// Vision reports whether the model accepts images.
+func (r *OllamaRunner) Vision() bool {
+	return r.vision
+}
+
+// Tools reports whether the model's template takes tool definitions.
+func (r *OllamaRunner) Tools() bool {
+	return r.tools
+}
+
+func (r *OllamaRunner) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama health check: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []api.Tool      `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// request translates req. Tool call arguments become JSON objects, image
+// data URIs become bare base64, and the sampling parameters go in options.
+func (r *OllamaRunner) request(req *api.ChatCompletionRequest) (*ollamaChatRequest, error) {
+	out := &ollamaChatRequest{Model: r.model, Tools: req.Tools, Stream: req.Stream, Options: r.options(req)}
+	names := make(map[string]string) // tool call ID -> function name
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content, ToolName: m.Name}
+		for _, url := range m.Images {
+			_, data, ok := strings.Cut(url, ";base64,")
+			if !strings.HasPrefix(url, "data:") || !ok {
+				return nil, api.NewError(http.StatusBadRequest, api.CodeInvalidRequest, "the ollama backend only accepts images as base64 data URIs")
+			}
+			msg.Images = append(msg.Images, data)
+		}
+		for _, tc := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			msg.ToolCalls = append(msg.ToolCalls, call)
+			names[tc.ID] = tc.Function.Name
+		}
+		if m.Role == "tool" && msg.ToolName == "" {
+			msg.ToolName = names[m.ToolCallID]
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+	return out, nil
+}
+
+// options returns the Ollama options for req's sampling parameters.
+func (r *OllamaRunner) options(req *api.ChatCompletionRequest) map[string]any {
+	opts := map[string]any{}
+	if r.ctxSize > 0 {
+		opts["num_ctx"] = r.ctxSize
+	}
+	if req == nil {
+		return opts
+	}
+	set := func(name string, v any, ok bool) {
+		if ok {
+			opts[name] = v
+		}
+	}
+	set("temperature", deref(req.Temperature), req.Temperature != nil)
+	set("top_p", deref(req.TopP), req.TopP != nil)
+	set("top_k", deref(req.TopK), req.TopK != nil)
+	set("min_p", deref(req.MinP), req.MinP != nil)
+	set("repeat_penalty", deref(req.RepeatPenalty), req.RepeatPenalty != nil)
+	set("seed", deref(req.Seed), req.Seed != nil)
+	set("num_predict", deref(req.MaxTokens), req.MaxTokens != nil)
+	set("stop", req.Stop, len(req.Stop) > 0)
+	return opts
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// toolCalls translates Ollama's tool calls, which carry no IDs, numbering
+// them from first.
+func toolCalls(calls []ollamaToolCall, first int) []api.ToolCall {
+	var out []api.ToolCall
+	for i, c := range calls {
+		out = append(out, api.ToolCall{
+			ID:       fmt.Sprintf("call_%d", first+i),
+			Type:     "function",
+			Function: api.ToolCallFunction{Name: c.Function.Name, Arguments: string(c.Function.Arguments)},
+		})
+	}
+	return out
+}
+
+// finishReason is the OpenAI finish reason for a finished Ollama response.
+func (resp *ollamaChatResponse) finishReason(calledTools bool) string {
+	switch {
+	case calledTools:
+		return "tool_calls"
+	case resp.DoneReason == "length":
+		return "length"
+	}
+	return "stop"
+}
+
+func (resp *ollamaChatResponse) usage() *api.Usage {
+	return &api.Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+func (r *OllamaRunner) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+	oreq, err := r.request(req)
+	if err != nil {
+		return nil, err
+	}
+	oreq.Stream = false
+	var resp ollamaChatResponse
+	if err := r.post(ctx, "/api/chat", oreq, &resp); err != nil {
+		return nil, err
+	}
+	calls := toolCalls(resp.Message.ToolCalls, 0)
+	return &api.ChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-%d", resp.CreatedAt.UnixNano()),
+		Object:  "chat.completion",
+		Created: resp.CreatedAt.Unix(),
+		Model:   r.model,
+		Choices: []api.Choice{{
+			Message: api.Message{
+				Role:             "assistant",
+				Content:          resp.Message.Content,
+				ReasoningContent: resp.Message.Thinking,
+				ToolCalls:        calls,
+			},
+			FinishReason: resp.finishReason(len(calls) > 0),
+		}},
+		Usage: resp.usage(),
+	}, nil
+}
+
+// ChatCompletionStream translates Ollama's stream of JSON lines into SSE
+// chunks. Ollama sends each tool call whole, so each becomes one chunk.
+func (r *OllamaRunner) ChatCompletionStream(ctx context.Context, req *api.ChatCompletionRequest, w io.Writer) error {
+	oreq, err := r.request(req)
+	if err != nil {
+		return err
+	}
+	oreq.Stream = true
+	body, err := r.open(ctx, "/api/chat", oreq)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	flush := func() {}
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rc := http.NewResponseController(rw)
+		flush = func() { rc.Flush() }
+	}
+	// The role goes with the first chunk, so an error before any output
+	// can still be reported as an error response.
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	role := "assistant"
+	send := func(chunk api.ChatCompletionChunk) error {
+		chunk.ID, chunk.Object, chunk.Model = id, "chat.completion.chunk", r.model
+		chunk.Choices[0].Delta.Role, role = role, ""
+		data, _ := json.Marshal(chunk)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flush()
+		return nil
+	}
+
+	calls := 0
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var resp ollamaChatResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			return fmt.Errorf("decode ollama stream: %w", err)
+		}
+		if resp.Error != "" {
+			return api.NewError(http.StatusInternalServerError, api.CodeInferenceError, resp.Error)
+		}
+
+		delta := api.MessageDelta{Content: resp.Message.Content, ReasoningContent: resp.Message.Thinking}
+		for i, tc := range toolCalls(resp.Message.ToolCalls, calls) {
+			fn := tc.Function
+			delta.ToolCalls = append(delta.ToolCalls, api.ToolCallDelta{Index: calls + i, ID: tc.ID, Type: "function", Function: &fn})
+		}
+		calls += len(resp.Message.ToolCalls)
+		if delta.Content != "" || delta.ReasoningContent != "" || len(delta.ToolCalls) > 0 {
+			if err := send(api.ChatCompletionChunk{Choices: []api.ChunkChoice{{Delta: delta}}}); err != nil {
+				return err
+			}
+		}
+
+		if resp.Done {
+			reason := resp.finishReason(calls > 0)
+			final := api.ChatCompletionChunk{Choices: []api.ChunkChoice{{FinishReason: &reason}}}
+			if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+				final.Usage = resp.usage()
+			}
+			if err := send(final); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "data: [DONE]\n\n")
+			flush()
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("ollama stream ended early")
+}
+
+func (r *OllamaRunner) Tokenize(ctx context.Context, text string) (int, error) {
+	return 0, ErrNoTokenizer
+}
+
+// CacheStats reports nothing: Ollama keeps its prompt cache to itself.
+func (r *OllamaRunner) CacheStats() CacheStats {
+	return CacheStats{}
+}
+
+func (r *OllamaRunner) ApplyLoraAdapters(ctx context.Context, adapters []api.LoraAdapter) error {
+	if len(adapters) == 0 {
+		return nil
+	}
+	return api.NewError(http.StatusBadRequest, api.CodeInvalidRequest, "LoRA adapters are not supported with the ollama backend; build an Ollama model with the ADAPTER instruction instead")
+}
+
+func (r *OllamaRunner) ModelName() string {
+	return r.model
+}
+
+// Close asks the daemon to unload the model, freeing its memory as closing
+// llama-server would.
+func (r *OllamaRunner) Close() error {
+	if r.model == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return r.post(ctx, "/api/chat", map[string]any{"model": r.model, "messages": []ollamaMessage{}, "keep_alive": 0}, nil)
+}
+
+// post sends body to path and decodes the response into result, if given.
+func (r *OllamaRunner) post(ctx context.Context, path string, body, result any) error {
+	respBody, err := r.open(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+	if result == nil {
+		io.Copy(io.Discard, respBody)
+		return nil
+	}
+	if err := json.NewDecoder(respBody).Decode(result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// open sends body to path and returns the response body if the status is
+// 200, or the daemon's error.
+func (r *OllamaRunner) open(ctx context.Context, path string, body any) (io.ReadCloser, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e struct {
+			Error string `json:"error"`
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		msg := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		code := api.CodeInferenceError
+		if resp.StatusCode == http.StatusNotFound {
+			code = api.CodeNotFound
+		}
+		return nil, api.NewError(resp.StatusCode, code, msg)
+	}
+	return resp.Body, nil
+}
+
+// OllamaModel is a model the Ollama daemon has pulled.
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// ListOllamaModels returns the models pulled into the daemon at baseURL.
+func ListOllamaModels(ctx context.Context, baseURL string) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list ollama models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list ollama models: status %d", resp.StatusCode)
+	}
+	var tags struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("decode ollama models: %w", err)
+	}
+	return tags.Models, nil
+}
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// fakeOllama serves /api/show and answers /api/chat with reply, recording
+// the last chat request that had messages.
+func fakeOllama(t *testing.T, reply string, got *ollamaChatRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			fmt.Fprint(w, `{"capabilities":["completion","tools","vision"]}`)
+		case "/api/chat":
+			var req ollamaChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if len(req.Messages) == 0 {
+				fmt.Fprint(w, `{"done":true}`) // preload
+				return
+			}
+			*got = req
+			fmt.Fprint(w, reply)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOllamaChatCompletionTranslates(t *testing.T) {
+	var got ollamaChatRequest
+	server := fakeOllama(t, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"file_read","arguments":{"path":"go.mod"}}}]},"done":true,"prompt_eval_count":30,"eval_count":5}`, &got)
+
+	r := NewOllamaRunner(server.URL)
+	if err := r.Load(context.Background(), "qwen2.5-coder:7b", Options{CtxSize: 8192}); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Vision() {
+		t.Error("vision capability not detected")
+	}
+
+	temp := 0.2
+	resp, err := r.ChatCompletion(context.Background(), &api.ChatCompletionRequest{
+		Messages: []api.Message{
+			{Role: "user", Content: "Look", Images: []string{"data:image/png;base64,AAAA"}},
+			{Role: "assistant", ToolCalls: []api.ToolCall{{ID: "c1", Function: api.ToolCallFunction{Name: "list_dir", Arguments: `{"path":"."}`}}}},
+			{Role: "tool", ToolCallID: "c1", Content: "go.mod"},
+		},
+		Temperature: &temp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "qwen2.5-coder:7b" || got.Options["num_ctx"] != float64(8192) || got.Options["temperature"] != 0.2 {
+		t.Errorf("request = %+v", got)
+	}
+	if imgs := got.Messages[0].Images; len(imgs) != 1 || imgs[0] != "AAAA" {
+		t.Errorf("images = %v", imgs)
+	}
+	if args := string(got.Messages[1].ToolCalls[0].Function.Arguments); args != `{"path":"."}` {
+		t.Errorf("tool call arguments = %s", args)
+	}
+	if got.Messages[2].ToolName != "list_dir" {
+		t.Errorf("tool result name = %q", got.Messages[2].ToolName)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v", choice)
+	}
+	if tc := choice.Message.ToolCalls[0]; tc.ID != "call_0" || tc.Function.Arguments != `{"path":"go.mod"}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.Usage.TotalTokens != 35 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaStreamWritesSSE(t *testing.T) {
+	var got ollamaChatRequest
+	lines := []string{
+		`{"message":{"role":"assistant","thinking":"hmm"},"done":false}`,
+		`{"message":{"role":"assistant","content":"Hello"},"done":false}`,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"git_info","arguments":{}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":3}`,
+	}
+	server := fakeOllama(t, strings.Join(lines, "\n")+"\n", &got)
+
+	r := NewOllamaRunner(server.URL)
+	if err := r.Load(context.Background(), "llama3.2:latest", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	req := &api.ChatCompletionRequest{
+		Messages:      []api.Message{{Role: "user", Content: "hi"}},
+		Stream:        true,
+		StreamOptions: &api.StreamOptions{IncludeUsage: true},
+	}
+	if err := r.ChatCompletionStream(context.Background(), req, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Stream {
+		t.Error("request was not streamed")
+	}
+
+	if !strings.Contains(out.String(), `"reasoning_content":"hmm"`) {
+		t.Errorf("thinking was not streamed: %s", out.String())
+	}
+	resp, err := AccumulateResponse(ParseSSEStream(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != "Hello" || choice.FinishReason != "tool_calls" {
+		t.Errorf("choice = %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != "{}" {
+		t.Errorf("tool calls = %+v", choice.Message.ToolCalls)
+	}
+	if resp.Usage == nil || resp.Usage.CompletionTokens != 3 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaStreamReportsEarlyEnd(t *testing.T) {
+	var got ollamaChatRequest
+	server := fakeOllama(t, `{"message":{"role":"assistant","content":"Hel"},"done":false}`+"\n", &got)
+
+	r := NewOllamaRunner(server.URL)
+	if err := r.Load(context.Background(), "llama3.2:latest", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	req := &api.ChatCompletionRequest{Messages: []api.Message{{Role: "user", Content: "hi"}}, Stream: true}
+	if err := r.ChatCompletionStream(context.Background(), req, &bytes.Buffer{}); err == nil {
+		t.Error("want an error for a stream without done")
+	}
+}
@@ -1,6 +1,10 @@
 package runner
 
-import "time"
+import (
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
 
 // Options configures how a runner loads and serves a model.
 type Options struct {
@@ -8,7 +12,7 @@ type Options struct {
 	// 0 means auto-allocate a free port.
 	Port int
 
-	// GPULayers is the number of layers to offload to GPU (-1 = auto/all).
+	// GPULayers is the number of layers to offload to GPU (-1 = all).
 	GPULayers int
 
 	// CtxSize is the context window size in tokens.
@@ -17,6 +21,11 @@ type Options struct {
 	// BinDir is the directory containing llama-server binaries.
 	BinDir string
 
+	// Parallel is the number of llama-server slots, each with its own
+	// prompt cache (0 = llama-server's default). Requests from the same
+	// session are kept on one slot.
+	Parallel int
+
 	// Threads is the number of CPU threads to use (0 = auto).
 	Threads int
 
@@ -31,6 +40,20 @@ type Options struct {
 	// (e.g. "deepseek" for Qwen3.5 thinking mode).
 	ReasoningFormat string
 
+	// MMProj is the multimodal projector of a vision model. Without one
+	// llama-server rejects image input.
+	MMProj string
+
+	// LoraAdapters are GGUF LoRA adapters applied on top of the model.
+	// Their scales can be changed later without a restart; adding one
+	// needs a restart.
+	LoraAdapters []api.LoraAdapter
+
+	// ExtraArgs are further llama-server flags, e.g. a model's sampling
+	// defaults from the registry. They come last, so they override the
+	// flags derived from the other options.
+	ExtraArgs []string
+
 	// Quiet suppresses subprocess stdout/stderr output.
 	Quiet bool
 
@@ -2,19 +2,27 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
 )
 
+var logger = logging.For("llama-server")
+
 const maxRestartAttempts = 3
 
+// ErrRestartRequired is returned when a change needs llama-server to be
+// started again, e.g. to load a LoRA adapter it was not started with.
+var ErrRestartRequired = errors.New("llama-server restart required")
+
 // ProcessRunner manages a llama-server subprocess for model inference.
 type ProcessRunner struct {
 	sub       *Subprocess
@@ -23,6 +31,7 @@ type ProcessRunner struct {
 	opts      Options
 	client    *Client
 	baseURL   string
+	cache     *promptCache
 
 	// Crash detection and auto-restart.
 	mu           sync.Mutex
@@ -50,6 +59,7 @@ func (r *ProcessRunner) Load(ctx context.Context, modelPath string, opts Options
 	r.modelPath = modelPath
 	r.modelName = filepath.Base(modelPath)
 	r.opts = opts
+	r.cache = newPromptCache(opts.Parallel)
 
 	if err := r.startSubprocess(ctx); err != nil {
 		return err
@@ -89,10 +99,11 @@ func (r *ProcessRunner) startSubprocess(ctx context.Context) error {
 	r.sub = sub
 	r.baseURL = sub.BaseURL()
 	r.client = NewClient(r.baseURL)
+	r.cache.reset() // a new process starts with empty slots
 	// Update opts.Port so restarts reuse the same allocated port.
 	r.opts.Port = sub.Port()
 
-	log.Printf("llama-server ready on port %d with model %s", sub.Port(), r.modelName)
+	logger.Info("model ready", "model", r.modelName, "port", sub.Port())
 	return nil
 }
 
@@ -109,6 +120,10 @@ func (r *ProcessRunner) buildArgs() []string {
 		args = append(args, "--n-gpu-layers", "999")
 	}
 
+	if r.opts.Parallel > 0 {
+		args = append(args, "--parallel", strconv.Itoa(r.opts.Parallel))
+	}
+
 	if r.opts.Threads > 0 {
 		args = append(args, "--threads", strconv.Itoa(r.opts.Threads))
 	}
@@ -127,6 +142,18 @@ func (r *ProcessRunner) buildArgs() []string {
 		args = append(args, "--reasoning-format", r.opts.ReasoningFormat)
 	}
 
+	if r.opts.MMProj != "" {
+		args = append(args, "--mmproj", r.opts.MMProj)
+	}
+
+	r.mu.Lock()
+	for _, a := range r.opts.LoraAdapters {
+		args = append(args, "--lora-scaled", a.Path, strconv.FormatFloat(a.Scale, 'g', -1, 64))
+	}
+	r.mu.Unlock()
+
+	args = append(args, r.opts.ExtraArgs...)
+
 	return args
 }
 
@@ -142,7 +169,7 @@ func (r *ProcessRunner) monitorCrashes() {
 			}
 
 			exitCode := r.sub.ExitCode()
-			log.Printf("[llama-server] process crashed (exit code %d)", exitCode)
+			logger.Error("process crashed", "model", r.modelName, "exit_code", exitCode)
 
 			r.mu.Lock()
 			r.restarts++
@@ -158,20 +185,20 @@ func (r *ProcessRunner) monitorCrashes() {
 			}
 
 			if attempt > maxRestartAttempts {
-				log.Printf("[llama-server] max restart attempts (%d) reached, giving up", maxRestartAttempts)
+				logger.Error("max restart attempts reached, giving up", "model", r.modelName, "attempts", maxRestartAttempts)
 				return
 			}
 
-			log.Printf("[llama-server] restarting (attempt %d/%d)...", attempt, maxRestartAttempts)
+			logger.Info("restarting", "model", r.modelName, "attempt", attempt, "max_attempts", maxRestartAttempts)
 			// Use a timeout context for restart health check.
 			restartCtx, cancel := context.WithTimeout(context.Background(), r.sub.healthTimeout)
 			if err := r.startSubprocess(restartCtx); err != nil {
-				log.Printf("[llama-server] restart failed: %v", err)
+				logger.Error("restart failed", "model", r.modelName, "err", err)
 				cancel()
 				return
 			}
 			cancel()
-			log.Printf("[llama-server] restart successful")
+			logger.Info("restart successful", "model", r.modelName)
 		}
 	}
 }
@@ -185,12 +212,74 @@ func (r *ProcessRunner) Health(ctx context.Context) error {
 
 func (r *ProcessRunner) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
 	req.Stream = false
-	return r.client.ChatCompletion(ctx, req)
+	slot := r.cache.slot(req.SessionID)
+	resp, timings, err := r.client.ChatCompletion(ctx, req, slot)
+	r.cache.record(timings)
+	r.logCompletion(req, slot, timings, err)
+	return resp, err
 }
 
 func (r *ProcessRunner) ChatCompletionStream(ctx context.Context, req *api.ChatCompletionRequest, w io.Writer) error {
 	req.Stream = true
-	return r.client.ChatCompletionStream(ctx, req, w)
+	slot := r.cache.slot(req.SessionID)
+	timings, err := r.client.ChatCompletionStream(ctx, req, slot, w)
+	r.cache.record(timings)
+	r.logCompletion(req, slot, timings, err)
+	return err
+}
+
+// logCompletion records a finished completion at debug level with the
+// session it ran for and how much of its prompt came from the slot cache.
+func (r *ProcessRunner) logCompletion(req *api.ChatCompletionRequest, slot int, t *llamaTimings, err error) {
+	attrs := []any{"model", r.modelName, "session", req.SessionID, "slot", slot, "stream", req.Stream}
+	if t != nil {
+		attrs = append(attrs, "prompt_tokens", t.PromptN, "cached_tokens", t.CacheN)
+	}
+	if err != nil {
+		attrs = append(attrs, "err", err)
+	}
+	logger.Debug("chat completion", attrs...)
+}
+
+func (r *ProcessRunner) CacheStats() CacheStats {
+	return r.cache.snapshot()
+}
+
+// ApplyLoraAdapters changes adapter scales through llama-server's
+// /lora-adapters endpoint. Adapters it was started with that are missing
+// from adapters are disabled, staying in memory until the next restart.
+func (r *ProcessRunner) ApplyLoraAdapters(ctx context.Context, adapters []api.LoraAdapter) error {
+	r.mu.Lock()
+	loaded := slices.Clone(r.opts.LoraAdapters)
+	r.mu.Unlock()
+
+	scales := make([]loraScale, len(loaded))
+	for i := range loaded {
+		scales[i] = loraScale{ID: i}
+	}
+	for _, a := range adapters {
+		i := slices.IndexFunc(loaded, func(l api.LoraAdapter) bool { return l.Path == a.Path })
+		if i < 0 {
+			return fmt.Errorf("%w: adapter %s", ErrRestartRequired, a.Path)
+		}
+		scales[i].Scale = a.Scale
+	}
+	if len(scales) == 0 {
+		return nil
+	}
+
+	if err := r.client.SetLoraAdapters(ctx, scales); err != nil {
+		return err
+	}
+
+	// Restarts after a crash keep the new scales.
+	r.mu.Lock()
+	for i := range loaded {
+		loaded[i].Scale = scales[i].Scale
+	}
+	r.opts.LoraAdapters = loaded
+	r.mu.Unlock()
+	return nil
 }
 
 func (r *ProcessRunner) Tokenize(ctx context.Context, text string) (int, error) {
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+func TestBuildArgsLoraAdapters(t *testing.T) {
+	r := &ProcessRunner{opts: Options{LoraAdapters: []api.LoraAdapter{
+		{Path: "/a.gguf", Scale: 1},
+		{Path: "/b.gguf", Scale: 0.5},
+	}}}
+	args := r.buildArgs()
+
+	want := []string{"--lora-scaled", "/a.gguf", "1", "--lora-scaled", "/b.gguf", "0.5"}
+	i := slices.Index(args, "--lora-scaled")
+	if i < 0 || !slices.Equal(args[i:i+len(want)], want) {
+		t.Errorf("args = %v, want them to contain %v", args, want)
+	}
+}
+
+func TestBuildArgsMMProj(t *testing.T) {
+	r := &ProcessRunner{opts: Options{MMProj: "/models/mmproj.gguf"}}
+	args := r.buildArgs()
+	i := slices.Index(args, "--mmproj")
+	if i < 0 || i+1 >= len(args) || args[i+1] != "/models/mmproj.gguf" {
+		t.Errorf("args = %v, want --mmproj /models/mmproj.gguf", args)
+	}
+
+	r = &ProcessRunner{}
+	if slices.Contains(r.buildArgs(), "--mmproj") {
+		t.Error("--mmproj passed without a projector")
+	}
+}
+
+func TestApplyLoraAdapters(t *testing.T) {
+	var got []loraScale
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/lora-adapters" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	r := &ProcessRunner{
+		client: NewClient(server.URL),
+		opts: Options{LoraAdapters: []api.LoraAdapter{
+			{Path: "/a.gguf", Scale: 1},
+			{Path: "/b.gguf", Scale: 1},
+		}},
+	}
+
+	// b is left out, so it is disabled.
+	if err := r.ApplyLoraAdapters(context.Background(), []api.LoraAdapter{{Path: "/a.gguf", Scale: 0.5}}); err != nil {
+		t.Fatalf("ApplyLoraAdapters: %v", err)
+	}
+	want := []loraScale{{ID: 0, Scale: 0.5}, {ID: 1, Scale: 0}}
+	if !slices.Equal(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+	if s := r.opts.LoraAdapters[0].Scale; s != 0.5 {
+		t.Errorf("kept scale %v for restarts, want 0.5", s)
+	}
+
+	err := r.ApplyLoraAdapters(context.Background(), []api.LoraAdapter{{Path: "/c.gguf", Scale: 1}})
+	if !errors.Is(err, ErrRestartRequired) {
+		t.Errorf("new adapter: err = %v, want ErrRestartRequired", err)
+	}
+}
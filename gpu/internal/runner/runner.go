@@ -26,6 +26,13 @@ type Runner interface {
 	// Tokenize returns the token count for the given text using the server's tokenizer.
 	Tokenize(ctx context.Context, text string) (int, error)
 
+	// CacheStats reports prompt cache usage since the model was loaded.
+	CacheStats() CacheStats
+
+	// ApplyLoraAdapters sets the LoRA adapters in use without restarting.
+	// It returns ErrRestartRequired if one was not loaded at startup.
+	ApplyLoraAdapters(ctx context.Context, adapters []api.LoraAdapter) error
+
 	// ModelName returns the name/ID of the loaded model.
 	ModelName() string
 
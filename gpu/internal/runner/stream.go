@@ -12,6 +12,7 @@ import (
 // StreamEvent represents a parsed SSE event from llama-server.
 type StreamEvent struct {
 	Chunk *api.ChatCompletionChunk
+	Usage *api.Usage // token usage, reported by the backend on the final chunk
 	Done  bool
 	Err   error
 }
@@ -41,7 +42,7 @@ func ParseSSEStream(r io.Reader) <-chan StreamEvent {
 				ch <- StreamEvent{Err: err}
 				return
 			}
-			ch <- StreamEvent{Chunk: &chunk}
+			ch <- StreamEvent{Chunk: &chunk, Usage: chunk.Usage}
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -62,6 +63,7 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 		finishReason string
 		toolCalls    []api.ToolCall
 		toolArgBuf   = make(map[int]*strings.Builder) // index -> accumulated arguments
+		usage        *api.Usage
 	)
 
 	for ev := range events {
@@ -71,6 +73,9 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 		if ev.Done {
 			break
 		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
 		if ev.Chunk == nil {
 			continue
 		}
@@ -158,5 +163,6 @@ func AccumulateResponse(events <-chan StreamEvent) (*api.ChatCompletionResponse,
 				FinishReason: finishReason,
 			},
 		},
+		Usage: usage,
 	}, nil
 }
@@ -5,7 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -16,9 +16,12 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 )
 
-// Subprocess manages the lifecycle of a llama-server child process.
+// Subprocess manages the lifecycle of a llama-server child process, or of
+// another server binary such as whisper-server.
 // It handles binary resolution, environment setup, process start/stop,
 // structured logging, health polling, and graceful shutdown.
 type Subprocess struct {
@@ -29,7 +32,7 @@ type Subprocess struct {
 	binPath   string
 	args      []string
 	env       []string
-	label     string // log prefix, e.g. "llama-server" or "embedding"
+	label     string // log component, e.g. "llama-server" or "embedding"
 	quiet     bool
 	baseURL   string
 	healthy   bool
@@ -43,7 +46,8 @@ type SubprocessConfig struct {
 	BinDir  string
 	Args    []string // args to pass after the binary path
 	Port    int      // 0 = auto-allocate
-	Label   string   // log prefix (default "llama-server")
+	Label   string   // log component (default "llama-server")
+	Binary  string   // executable in BinDir (default "llama-server")
 	Quiet   bool     // suppress subprocess stdout/stderr
 	HealthTimeout time.Duration // how long to wait for /health (default 120s)
 }
@@ -59,22 +63,29 @@ func allocatePort() (int, error) {
 	return port, nil
 }
 
-// resolveBinary returns the full path to llama-server in binDir.
-func resolveBinary(binDir string) (string, error) {
-	binName := "llama-server"
+// resolveBinary returns the full path to the named server binary in binDir.
+func resolveBinary(binDir, name string) (string, error) {
+	binName := name
 	if runtime.GOOS == "windows" {
-		binName = "llama-server.exe"
+		binName += ".exe"
 	}
 	binPath := filepath.Join(binDir, binName)
 	if _, err := os.Stat(binPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("llama-server not found at %s — download it with 'tanrenai setup'", binPath)
+		if name == "llama-server" {
+			return "", fmt.Errorf("llama-server not found at %s — download it with 'tanrenai setup'", binPath)
+		}
+		return "", fmt.Errorf("%s not found at %s", name, binPath)
 	}
 	return binPath, nil
 }
 
 // NewSubprocess creates a Subprocess but does not start it. Call Start() next.
 func NewSubprocess(cfg SubprocessConfig) (*Subprocess, error) {
-	binPath, err := resolveBinary(cfg.BinDir)
+	binary := cfg.Binary
+	if binary == "" {
+		binary = "llama-server"
+	}
+	binPath, err := resolveBinary(cfg.BinDir, binary)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +175,7 @@ func (s *Subprocess) Start(ctx context.Context) error {
 		s.pipeOutput()
 	}
 
-	log.Printf("[%s] starting: %s (port %d)", s.label, s.binPath, s.port)
+	s.logger().Info("starting", "binary", s.binPath, "port", s.port)
 
 	if err := s.cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start %s: %w", s.label, err)
@@ -185,7 +196,7 @@ func (s *Subprocess) Start(ctx context.Context) error {
 	s.healthy = true
 	s.mu.Unlock()
 
-	log.Printf("[%s] ready on port %d", s.label, s.port)
+	s.logger().Info("ready", "port", s.port)
 	return nil
 }
 
@@ -216,7 +227,7 @@ func (s *Subprocess) GracefulStop() error {
 	}
 
 	pid := s.cmd.Process.Pid
-	log.Printf("[%s] sending SIGTERM to PID %d", s.label, pid)
+	s.logger().Info("sending SIGTERM", "pid", pid)
 
 	// Send SIGTERM (SIGINT on Windows for graceful shutdown).
 	var sigErr error
@@ -228,17 +239,17 @@ func (s *Subprocess) GracefulStop() error {
 
 	if sigErr != nil {
 		// Process may already be dead.
-		log.Printf("[%s] signal failed (process may have exited): %v", s.label, sigErr)
+		s.logger().Warn("signal failed (process may have exited)", "err", sigErr)
 		return nil
 	}
 
 	// Wait up to 5 seconds for clean exit.
 	select {
 	case <-s.doneCh:
-		log.Printf("[%s] process exited cleanly", s.label)
+		s.logger().Info("process exited cleanly")
 		return nil
 	case <-time.After(5 * time.Second):
-		log.Printf("[%s] process did not exit after SIGTERM, sending SIGKILL to PID %d", s.label, pid)
+		s.logger().Warn("process did not exit after SIGTERM, sending SIGKILL", "pid", pid)
 		if err := s.cmd.Process.Kill(); err != nil {
 			return fmt.Errorf("failed to kill %s: %w", s.label, err)
 		}
@@ -272,7 +283,7 @@ func (s *Subprocess) waitForHealth(ctx context.Context) error {
 		case <-s.doneCh:
 			return fmt.Errorf("%s process exited during startup (exit code %d)", s.label, s.ExitCode())
 		case <-progressTicker.C:
-			log.Printf("[%s] still loading model... (%.0fs elapsed)", s.label, time.Since(start).Seconds())
+			s.logger().Info("still loading model", "elapsed", time.Since(start).Round(time.Second))
 		case <-ticker.C:
 			if time.Now().After(deadline) {
 				return fmt.Errorf("timeout waiting for %s to become ready after %s", s.label, s.healthTimeout)
@@ -300,25 +311,31 @@ func (s *Subprocess) healthCheck(ctx context.Context) error {
 	return nil
 }
 
-// pipeOutput connects subprocess stdout+stderr to Go's logger with a prefix.
+// logger returns the logger for the subprocess's output and lifecycle.
+func (s *Subprocess) logger() *slog.Logger {
+	return logging.For(s.label)
+}
+
+// pipeOutput logs each line of the subprocess's stdout and stderr under its
+// component.
 func (s *Subprocess) pipeOutput() {
-	prefix := fmt.Sprintf("[%s] ", s.label)
 
 	stdoutPipe, err := s.cmd.StdoutPipe()
 	if err == nil {
-		go s.scanLines(stdoutPipe, prefix)
+		go s.scanLines(stdoutPipe, "stdout")
 	}
 
 	stderrPipe, err := s.cmd.StderrPipe()
 	if err == nil {
-		go s.scanLines(stderrPipe, prefix)
+		go s.scanLines(stderrPipe, "stderr")
 	}
 }
 
-func (s *Subprocess) scanLines(r io.Reader, prefix string) {
+func (s *Subprocess) scanLines(r io.Reader, stream string) {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024)
+	log := s.logger().With("stream", stream)
 	for scanner.Scan() {
-		log.Printf("%s%s", prefix, scanner.Text())
+		log.Info(scanner.Text())
 	}
 }
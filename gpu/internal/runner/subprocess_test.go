@@ -33,7 +33,7 @@ func TestAllocatePort(t *testing.T) {
 
 func TestResolveBinaryMissing(t *testing.T) {
 	dir := t.TempDir()
-	_, err := resolveBinary(dir)
+	_, err := resolveBinary(dir, "llama-server")
 	if err == nil {
 		t.Fatal("expected error for missing binary")
 	}
@@ -49,7 +49,7 @@ func TestResolveBinaryExists(t *testing.T) {
 	if err := os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0755); err != nil {
 		t.Fatal(err)
 	}
-	got, err := resolveBinary(dir)
+	got, err := resolveBinary(dir, "llama-server")
 	if err != nil {
 		t.Fatalf("resolveBinary: %v", err)
 	}
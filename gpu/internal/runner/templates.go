@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -73,3 +74,13 @@ func WriteQwen25Template() (string, error) {
 	}
 	return path, nil
 }
+
+// WriteChatTemplate writes the named chat template family (e.g. "qwen2.5")
+// to a temp file and returns its path.
+func WriteChatTemplate(family string) (string, error) {
+	switch family {
+	case "qwen2.5", "qwen2", "qwen":
+		return WriteQwen25Template()
+	}
+	return "", fmt.Errorf("unknown chat template %q (available: qwen2.5)", family)
+}
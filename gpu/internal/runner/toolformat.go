@@ -0,0 +1,47 @@
+package runner
+
+import "strings"
+
+// Tool-calling formats, as reported in api.LoadModelResponse.ToolFormat.
+// They decide how tool definitions are written into the prompt and how
+// the model writes its calls.
+const (
+	ToolFormatHermes  = "hermes"  // <tools> JSON schemas, <tool_call> replies; llama-server's fallback
+	ToolFormatQwen    = "qwen"    // Qwen2.5's native Hermes variant with a "# Tools" section
+	ToolFormatLlama3  = "llama3"  // Llama 3.1+ JSON calls, with <|python_tag|> for built-in tools
+	ToolFormatMistral = "mistral" // [AVAILABLE_TOOLS] and [TOOL_CALLS]
+)
+
+// DetectToolFormat returns the tool-calling format of a chat template,
+// read from the markers in it. llama-server prompts with its Hermes 2 Pro
+// fallback when the template does not describe tools, so that is the
+// answer for those and for unknown families.
+func DetectToolFormat(template string) string {
+	if !strings.Contains(template, "tools") {
+		return ToolFormatHermes
+	}
+	switch {
+	case strings.Contains(template, "[AVAILABLE_TOOLS]") || strings.Contains(template, "[TOOL_CALLS]"):
+		return ToolFormatMistral
+	case strings.Contains(template, "<|start_header_id|>") || strings.Contains(template, "<|python_tag|>"):
+		return ToolFormatLlama3
+	case strings.Contains(template, "<tool_call>") && strings.Contains(template, "<|im_start|>"):
+		return ToolFormatQwen
+	}
+	return ToolFormatHermes
+}
+
+// NeedsToolTemplate reports whether a model of architecture arch with the
+// embedded chat template should get tanrenai's built-in template instead:
+// a Qwen model whose template does not describe tools, which llama-server
+// would otherwise prompt with the less reliable Hermes 2 Pro fallback. It
+// returns the template family for WriteChatTemplate, or "".
+func NeedsToolTemplate(template, arch string) string {
+	if strings.Contains(template, "tools") {
+		return ""
+	}
+	if strings.HasPrefix(arch, "qwen2") {
+		return "qwen2.5"
+	}
+	return ""
+}
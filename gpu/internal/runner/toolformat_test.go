@@ -0,0 +1,34 @@
+package runner
+
+import "testing"
+
+func TestDetectToolFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"qwen", qwen25ChatTemplate, ToolFormatQwen},
+		{"llama3", `{%- if tools %}<|start_header_id|>ipython<|end_header_id|>{%- endif %}`, ToolFormatLlama3},
+		{"mistral", `{%- if tools %}[AVAILABLE_TOOLS]{{ tools|tojson }}[/AVAILABLE_TOOLS]{%- endif %}`, ToolFormatMistral},
+		{"no tools", `<|im_start|>{{ message.role }}`, ToolFormatHermes},
+		{"hermes", `{%- if tools %}<tools>{{ tools }}</tools> <tool_call>{%- endif %}`, ToolFormatHermes},
+	}
+	for _, tt := range tests {
+		if got := DetectToolFormat(tt.template); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsToolTemplate(t *testing.T) {
+	if got := NeedsToolTemplate(`<|im_start|>{{ message.role }}`, "qwen2"); got != "qwen2.5" {
+		t.Errorf("qwen2 without tools: got %q", got)
+	}
+	if got := NeedsToolTemplate(qwen25ChatTemplate, "qwen2"); got != "" {
+		t.Errorf("qwen2 with tools: got %q", got)
+	}
+	if got := NeedsToolTemplate("", "llama"); got != "" {
+		t.Errorf("llama: got %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// GPUInfo describes the GPU memory available to llama-server. With several
+// NVIDIA GPUs the figures are summed, since llama-server splits layers
+// across all of them.
+type GPUInfo struct {
+	Name     string
+	TotalMiB int
+	FreeMiB  int
+}
+
+// DetectGPU reports the GPU memory via nvidia-smi, or the unified memory
+// Metal may use on macOS. It fails when neither is available.
+func DetectGPU(ctx context.Context) (*GPUInfo, error) {
+	if info, err := detectNvidia(ctx); err == nil {
+		return info, nil
+	}
+	if runtime.GOOS == "darwin" {
+		return detectMetal(ctx)
+	}
+	return nil, errors.New("no GPU detected (nvidia-smi not available)")
+}
+
+func detectNvidia(ctx context.Context) (*GPUInfo, error) {
+	out, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu=name,memory.total,memory.free", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, err
+	}
+	info := &GPUInfo{}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+		total, err1 := strconv.Atoi(strings.TrimSpace(fields[1]))
+		free, err2 := strconv.Atoi(strings.TrimSpace(fields[2]))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		names = append(names, strings.TrimSpace(fields[0]))
+		info.TotalMiB += total
+		info.FreeMiB += free
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("unexpected nvidia-smi output: %q", out)
+	}
+	info.Name = strings.Join(names, "+")
+	return info, nil
+}
+
+// detectMetal estimates the memory Metal lets llama.cpp use on Apple
+// silicon: about three quarters of the unified memory.
+func detectMetal(ctx context.Context) (*GPUInfo, error) {
+	out, err := exec.CommandContext(ctx, "sysctl", "-n", "hw.memsize").Output()
+	if err != nil {
+		return nil, fmt.Errorf("read memory size: %w", err)
+	}
+	bytes, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("read memory size: %w", err)
+	}
+	usable := int(bytes>>20) * 3 / 4
+	name := "Metal"
+	if out, err := exec.CommandContext(ctx, "sysctl", "-n", "machdep.cpu.brand_string").Output(); err == nil {
+		name = strings.TrimSpace(string(out))
+	}
+	return &GPUInfo{Name: name, TotalMiB: usable, FreeMiB: usable}, nil
+}
+
+// SearchGPULayers returns the largest layer count in [0, maxLayers] for
+// which fits reports true, or -1 if none does. It tries maxLayers first,
+// since a model that fits entirely needs a single attempt, then binary
+// searches starting at guess. fits must be monotonic: if n layers fit,
+// fewer do too.
+func SearchGPULayers(maxLayers, guess int, fits func(layers int) bool) int {
+	if fits(maxLayers) {
+		return maxLayers
+	}
+	lo, hi, best := 0, maxLayers-1, -1
+	mid := min(max(guess, lo), hi)
+	for lo <= hi {
+		if fits(mid) {
+			best, lo = mid, mid+1
+		} else {
+			hi = mid - 1
+		}
+		mid = lo + (hi-lo)/2
+	}
+	return best
+}
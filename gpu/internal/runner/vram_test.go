@@ -0,0 +1,36 @@
+package runner
+
+import "testing"
+
+func TestSearchGPULayers(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLayers int
+		guess     int
+		limit     int // most layers that fit
+		want      int
+		maxTries  int
+	}{
+		{"everything fits", 33, 10, 33, 33, 1},
+		{"partial", 33, 16, 20, 20, 7},
+		{"good guess", 33, 20, 20, 20, 7},
+		{"guess too high", 33, 40, 5, 5, 7},
+		{"nothing fits", 33, 16, -1, -1, 7},
+		{"only cpu", 33, 16, 0, 0, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tries := 0
+			got := SearchGPULayers(tt.maxLayers, tt.guess, func(n int) bool {
+				tries++
+				return n <= tt.limit
+			})
+			if got != tt.want {
+				t.Errorf("SearchGPULayers = %d, want %d", got, tt.want)
+			}
+			if tries > tt.maxTries {
+				t.Errorf("took %d tries, want at most %d", tries, tt.maxTries)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// Adapters returns the model the LoRA adapters belong to and the adapters.
+func (s *Server) Adapters() (string, []api.LoraAdapter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastModel, slices.Clone(s.adapters)
+}
+
+// LoadAdapter applies the GGUF LoRA adapter at path to model, or to the
+// loaded model when model is "", replacing the scale if it is applied
+// already. Loading a different model drops the adapters of the current one.
+func (s *Server) LoadAdapter(ctx context.Context, model, path string, scale float64) error {
+	if s.cfg.Backend == config.BackendOllama {
+		return api.NewError(http.StatusBadRequest, api.CodeInvalidRequest, "LoRA adapters are not supported with the ollama backend; build an Ollama model with the ADAPTER instruction instead")
+	}
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.mu.Lock()
+	current := s.lastModel
+	adapters := slices.Clone(s.adapters)
+	s.mu.Unlock()
+
+	if model == "" {
+		model = current
+	}
+	if model == "" {
+		return api.NewError(http.StatusBadRequest, api.CodeModelNotLoaded, "no model loaded; name the base model")
+	}
+	if !s.isCurrent(model) {
+		adapters = nil
+	}
+
+	i := slices.IndexFunc(adapters, func(a api.LoraAdapter) bool { return a.Path == path })
+	if i < 0 {
+		adapters = append(adapters, api.LoraAdapter{Path: path, Scale: scale})
+	} else {
+		adapters[i].Scale = scale
+	}
+	return s.applyAdapters(ctx, model, adapters)
+}
+
+// UnloadAdapter stops applying the adapter at path to the loaded model.
+func (s *Server) UnloadAdapter(ctx context.Context, path string) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.mu.Lock()
+	current := s.lastModel
+	adapters := slices.Clone(s.adapters)
+	s.mu.Unlock()
+
+	i := slices.IndexFunc(adapters, func(a api.LoraAdapter) bool { return a.Path == path })
+	if i < 0 {
+		return api.NewError(http.StatusNotFound, api.CodeNotFound, "adapter not loaded: "+path)
+	}
+	return s.applyAdapters(ctx, current, slices.Delete(adapters, i, i+1))
+}
+
+// applyAdapters makes adapters the ones applied to model. Scale changes
+// and removals use llama-server's hot-swap endpoint; a new adapter, or a
+// different model, restarts it. The caller holds loadMu.
+func (s *Server) applyAdapters(ctx context.Context, model string, adapters []api.LoraAdapter) error {
+	s.mu.Lock()
+	r := s.runner
+	s.mu.Unlock()
+
+	if s.isCurrent(model) {
+		if r == nil {
+			// Unloaded while idle; the next load applies them.
+			s.mu.Lock()
+			s.adapters = adapters
+			s.mu.Unlock()
+			return nil
+		}
+		err := r.ApplyLoraAdapters(ctx, adapters)
+		if err == nil {
+			s.mu.Lock()
+			s.adapters = adapters
+			s.mu.Unlock()
+			logger.Info("LoRA adapters updated in place", "model", model)
+			return nil
+		}
+		if !errors.Is(err, runner.ErrRestartRequired) {
+			return err
+		}
+		logger.Info("restarting llama-server to load LoRA adapters", "model", model, "reason", err)
+	}
+	return s.loadModelLocked(ctx, model, adapters)
+}
+
+// isCurrent reports whether model names the model loaded last, whether or
+// not it is still loaded.
+func (s *Server) isCurrent(model string) bool {
+	path, err := s.resolve(model)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return path == s.modelPath
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+)
+
+var layersLogger = logging.For("gpu-layers")
+
+// vramReserveMiB is kept free when estimating how many layers fit, for the
+// KV cache and compute buffers.
+const vramReserveMiB = 1024
+
+// gpuLayerCache remembers tuned GPU layer counts in a JSON file, keyed by
+// model, context size and GPU, so the search runs once per combination.
+type gpuLayerCache struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (c *gpuLayerCache) load() map[string]int {
+	entries := make(map[string]int)
+	if data, err := os.ReadFile(c.path); err == nil {
+		json.Unmarshal(data, &entries)
+	}
+	return entries
+}
+
+func (c *gpuLayerCache) get(key string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.load()[key]
+	return n, ok
+}
+
+// set stores n for key; n < 0 removes the entry.
+func (c *gpuLayerCache) set(key string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.load()
+	if n < 0 {
+		delete(entries, key)
+	} else {
+		entries[key] = n
+	}
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		layersLogger.Warn("failed to save GPU layer cache", "err", err)
+	}
+}
+
+// startWithAutoLayers starts a model with as many GPU layers as will load.
+// start launches it with the given number of layers and must clean up after
+// itself when that fails. A cached count is tried first; if it no longer
+// loads, e.g. because other work now holds part of the VRAM, the search
+// runs again.
+func startWithAutoLayers[T io.Closer](ctx context.Context, cache *gpuLayerCache, modelPath string, ctxSize int, start func(layers int) (T, error)) (T, error) {
+	var zero T
+	gpu, err := runner.DetectGPU(ctx)
+	if err != nil {
+		layersLogger.Warn("GPU detection failed", "err", err)
+	}
+	key := layerCacheKey(modelPath, ctxSize, gpu)
+
+	if n, ok := cache.get(key); ok {
+		t, err := start(n)
+		if err == nil {
+			layersLogger.Info("using cached layer count", "model", filepath.Base(modelPath), "layers", n)
+			return t, nil
+		}
+		layersLogger.Warn("cached layer count no longer loads, tuning again", "model", filepath.Base(modelPath), "layers", n, "err", err)
+		cache.set(key, -1)
+	}
+
+	maxLayers := 999 // llama-server caps it at the model's layer count
+	if blocks, err := runner.BlockCount(modelPath); err == nil {
+		maxLayers = blocks + 1 // the output layer is offloaded too
+	} else {
+		layersLogger.Warn("layer count unknown", "model", filepath.Base(modelPath), "err", err)
+	}
+	guess := estimateLayers(modelPath, maxLayers, gpu)
+
+	var kept T
+	var keptOK bool
+	var lastErr error
+	best := runner.SearchGPULayers(maxLayers, guess, func(layers int) bool {
+		layersLogger.Info("trying layers", "model", filepath.Base(modelPath), "layers", layers, "max", maxLayers)
+		t, err := start(layers)
+		if err != nil {
+			lastErr = err
+			return false
+		}
+		if layers == maxLayers {
+			// Everything fits; this is the final answer, keep it running.
+			kept, keptOK = t, true
+			return true
+		}
+		// Free the VRAM before trying more layers.
+		t.Close()
+		return true
+	})
+	if best < 0 {
+		return zero, lastErr
+	}
+
+	t := kept
+	if !keptOK {
+		if t, err = start(best); err != nil {
+			return zero, err
+		}
+	}
+	layersLogger.Info("using layers", "model", filepath.Base(modelPath), "layers", best, "max", maxLayers)
+	cache.set(key, best)
+	return t, nil
+}
+
+func layerCacheKey(modelPath string, ctxSize int, gpu *runner.GPUInfo) string {
+	gpuName := "no-gpu"
+	if gpu != nil {
+		gpuName = fmt.Sprintf("%s/%dMiB", gpu.Name, gpu.TotalMiB)
+	}
+	return fmt.Sprintf("%s|ctx=%d|%s", filepath.Base(modelPath), ctxSize, gpuName)
+}
+
+// estimateLayers guesses how many layers fit in free VRAM from the model's
+// file size, assuming layers are of equal size.
+func estimateLayers(modelPath string, maxLayers int, gpu *runner.GPUInfo) int {
+	info, err := os.Stat(modelPath)
+	if gpu == nil || err != nil || info.Size() == 0 {
+		return maxLayers / 2
+	}
+	sizeMiB := int(info.Size() >> 20)
+	return maxLayers * (gpu.FreeMiB - vramReserveMiB) / max(sizeMiB, 1)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// AdaptersHandler handles the LoRA adapter endpoints.
+type AdaptersHandler struct {
+	LoadFunc   func(ctx context.Context, model, path string, scale float64) error
+	UnloadFunc func(ctx context.Context, path string) error
+	ListFunc   func() (string, []api.LoraAdapter)
+}
+
+// Load handles POST /api/adapters/load.
+func (h *AdaptersHandler) Load(w http.ResponseWriter, r *http.Request) {
+	var req api.AdapterLoadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "path is required")
+		return
+	}
+	if _, err := os.Stat(req.Path); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "adapter: "+err.Error())
+		return
+	}
+	scale := 1.0
+	if req.Scale != nil {
+		scale = *req.Scale
+	}
+
+	if err := h.LoadFunc(r.Context(), req.Model, req.Path, scale); err != nil {
+		writeAdapterError(w, err)
+		return
+	}
+	h.writeAdapters(w)
+}
+
+// Unload handles POST /api/adapters/unload.
+func (h *AdaptersHandler) Unload(w http.ResponseWriter, r *http.Request) {
+	var req api.AdapterUnloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "path is required")
+		return
+	}
+
+	if err := h.UnloadFunc(r.Context(), req.Path); err != nil {
+		writeAdapterError(w, err)
+		return
+	}
+	h.writeAdapters(w)
+}
+
+func (h *AdaptersHandler) writeAdapters(w http.ResponseWriter) {
+	model, adapters := h.ListFunc()
+	if adapters == nil {
+		adapters = []api.LoraAdapter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.AdaptersResponse{Model: model, Adapters: adapters})
+}
+
+// writeAdapterError reports a failed adapter change; errors without a code
+// come from restarting llama-server.
+func writeAdapterError(w http.ResponseWriter, err error) {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = api.NewError(http.StatusInternalServerError, api.CodeModelError, err.Error())
+	}
+	writeAPIError(w, apiErr)
+}
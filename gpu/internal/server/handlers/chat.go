@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
@@ -13,45 +15,81 @@ import (
 type ChatHandler struct {
 	GetRunner func() runner.Runner
 	LoadFunc  func(ctx context.Context, model string) error
+	LastModel func() string           // model to reload when it was unloaded for being idle
+	IsLoaded  func(model string) bool // whether model, a name or alias, is the loaded one
+	// AcceptsImages reports whether the loaded model takes image input.
+	AcceptsImages func() bool
 }
 
 func (h *ChatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var req api.ChatCompletionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
 
 	if len(req.Messages) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "messages must not be empty")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "messages must not be empty")
 		return
 	}
 
+	// Headers go out with the first write, so a request that fails before
+	// then can still be answered with a proper error response.
+	sw := &countingWriter{ResponseWriter: w}
+
 	// Auto-load the model if not already loaded or if a different model is requested
 	currentRunner := h.GetRunner()
-	if currentRunner == nil || (req.Model != "" && normalizeModelName(currentRunner.ModelName()) != normalizeModelName(req.Model)) {
-		if req.Model == "" {
-			writeError(w, http.StatusBadRequest, "invalid_request", "no model specified and no model loaded")
+	if currentRunner == nil || (req.Model != "" && !h.IsLoaded(req.Model)) {
+		model := req.Model
+		if model == "" {
+			model = h.LastModel()
+		}
+		if model == "" {
+			writeError(w, http.StatusBadRequest, api.CodeModelNotLoaded, "no model specified and no model loaded")
+			return
+		}
+		if req.Stream {
+			// Loading can take a while; tell the client why nothing is
+			// happening yet.
+			openStream(sw)
+			writeSSEEvent(sw, "status", api.StreamStatus{Status: api.StreamStatusWarmingUp, Model: model})
+		}
+		if err := h.LoadFunc(r.Context(), model); err != nil {
+			writeStreamError(sw, api.NewError(http.StatusInternalServerError, api.CodeModelError, "failed to load model: "+err.Error()))
 			return
 		}
-		if err := h.LoadFunc(r.Context(), req.Model); err != nil {
-			writeError(w, http.StatusInternalServerError, "model_error", "failed to load model: "+err.Error())
+		if currentRunner = h.GetRunner(); currentRunner == nil {
+			writeStreamError(sw, api.NewError(http.StatusServiceUnavailable, api.CodeModelNotLoaded, "model was swapped out while loading"))
 			return
 		}
-		currentRunner = h.GetRunner()
+	}
+
+	if hasImages(req.Messages) && !h.AcceptsImages() {
+		writeStreamError(sw, api.NewError(http.StatusBadRequest, api.CodeInvalidRequest,
+			"the loaded model does not accept images; give it an mmproj in models.json"))
+		return
 	}
 
 	if req.Stream {
-		h.handleStream(w, r, &req, currentRunner)
+		h.handleStream(sw, r, &req, currentRunner)
 	} else {
 		h.handleComplete(w, r, &req, currentRunner)
 	}
 }
 
+func hasImages(msgs []api.Message) bool {
+	for _, m := range msgs {
+		if len(m.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *ChatHandler) handleComplete(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest, rn runner.Runner) {
 	resp, err := rn.ChatCompletion(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "inference_error", err.Error())
+		writeInferenceError(w, err)
 		return
 	}
 
@@ -59,17 +97,65 @@ func (h *ChatHandler) handleComplete(w http.ResponseWriter, r *http.Request, req
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *ChatHandler) handleStream(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest, rn runner.Runner) {
+func (h *ChatHandler) handleStream(sw *countingWriter, r *http.Request, req *api.ChatCompletionRequest, rn runner.Runner) {
+	openStream(sw)
+	before := sw.written
+	if err := rn.ChatCompletionStream(r.Context(), req, sw); err != nil && sw.written == before {
+		writeStreamError(sw, inferenceError(err))
+	}
+}
+
+// inferenceError describes a failed completion, keeping the code of errors
+// llama-server explained.
+func inferenceError(err error) *api.Error {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = api.NewError(http.StatusInternalServerError, api.CodeInferenceError, err.Error())
+	}
+	return apiErr
+}
+
+// writeInferenceError reports a failed completion.
+func writeInferenceError(w http.ResponseWriter, err error) {
+	writeAPIError(w, inferenceError(err))
+}
+
+// openStream sets the SSE response headers.
+func openStream(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+}
 
-	flusher, ok := w.(http.Flusher)
-	if ok {
-		flusher.Flush()
-	}
+// writeSSEEvent sends a named event and flushes it to the client.
+func writeSSEEvent(w http.ResponseWriter, event string, data any) {
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	http.NewResponseController(w).Flush()
+}
 
-	if err := rn.ChatCompletionStream(r.Context(), req, w); err != nil {
+// writeStreamError reports apiErr as an error response, or as an "error"
+// event once the stream has started.
+func writeStreamError(sw *countingWriter, apiErr *api.Error) {
+	if sw.written == 0 {
+		writeAPIError(sw.ResponseWriter, apiErr)
 		return
 	}
+	writeSSEEvent(sw.ResponseWriter, "error", apiErr.Response())
+}
+
+// countingWriter counts the bytes written.
+type countingWriter struct {
+	http.ResponseWriter
+	written int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += n
+	return n, err
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,43 +14,56 @@ import (
 // EmbeddingsHandler handles POST /v1/embeddings.
 // It proxies embedding requests to the embedding llama-server subprocess.
 type EmbeddingsHandler struct {
-	EmbeddingBaseURL string // base URL of the embedding subprocess
+	// EnsureRunner starts the embedding subprocess if needed and returns its
+	// base URL, or "" if no embedding model is configured.
+	EnsureRunner func(ctx context.Context) (string, error)
 }
 
 func (h *EmbeddingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.EmbeddingBaseURL == "" {
-		writeError(w, http.StatusServiceUnavailable, "no_embedding", "embedding server not configured")
+	var req api.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
 
-	var req api.EmbeddingRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+	if len(req.Input) == 0 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "input must not be empty")
 		return
 	}
+	for _, in := range req.Input {
+		if in == "" {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "input must not contain empty strings")
+			return
+		}
+	}
 
-	if req.Input == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "input must not be empty")
+	baseURL, err := h.EnsureRunner(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, api.CodeEmbeddingError, "failed to start embedding server: "+err.Error())
+		return
+	}
+	if baseURL == "" {
+		writeError(w, http.StatusServiceUnavailable, api.CodeNoEmbedding, "embedding server not configured")
 		return
 	}
 
 	// Forward to the embedding subprocess
 	body, err := json.Marshal(req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", "failed to marshal request")
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, "failed to marshal request")
 		return
 	}
 
-	resp, err := http.Post(h.EmbeddingBaseURL+"/v1/embeddings", "application/json", bytes.NewReader(body))
+	resp, err := http.Post(baseURL+"/v1/embeddings", "application/json", bytes.NewReader(body))
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "embedding_error", fmt.Sprintf("embedding server error: %v", err))
+		writeError(w, http.StatusBadGateway, api.CodeEmbeddingError, fmt.Sprintf("embedding server error: %v", err))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		writeError(w, resp.StatusCode, "embedding_error", string(respBody))
+		writeError(w, resp.StatusCode, api.CodeEmbeddingError, api.DecodeError(resp.StatusCode, respBody).Message)
 		return
 	}
 
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/gpu/internal/training"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
 )
 
 // FinetuneHandler handles fine-tuning API endpoints.
@@ -16,34 +19,51 @@ type FinetuneHandler struct {
 // Prepare handles POST /v1/finetune/prepare.
 func (h *FinetuneHandler) Prepare(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		BaseModel   string              `json:"base_model"`
-		DatasetPath string              `json:"dataset_path"`
-		SampleCount int                 `json:"sample_count"`
-		Config      *training.RunConfig `json:"config,omitempty"`
+		BaseModel   string          `json:"base_model"`
+		DatasetPath string          `json:"dataset_path"`
+		SampleCount int             `json:"sample_count"`
+		Config      json.RawMessage `json:"config,omitempty"` // fields that differ from DefaultRunConfig
+		// Dataset carries the samples inline, for a backend on another
+		// machine; it is saved under the datasets directory.
+		Dataset []training.DatasetEntry `json:"dataset,omitempty"`
+		// Pairs carries preference pairs inline instead, for a DPO run.
+		Pairs []training.PreferencePair `json:"pairs,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
 
 	if req.BaseModel == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "base_model is required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "base_model is required")
 		return
 	}
 
-	if req.DatasetPath == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "dataset_path is required")
+	if req.DatasetPath == "" && len(req.Dataset) == 0 && len(req.Pairs) == 0 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "dataset_path, dataset or pairs is required")
 		return
 	}
 
 	cfg := training.DefaultRunConfig()
-	if req.Config != nil {
-		cfg = *req.Config
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, &cfg); err != nil {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "invalid config: "+err.Error())
+			return
+		}
 	}
 
-	run, err := h.Manager.Prepare(r.Context(), req.BaseModel, req.DatasetPath, req.SampleCount, cfg)
+	var run *training.TrainingRun
+	var err error
+	switch {
+	case len(req.Pairs) > 0:
+		run, err = h.Manager.PreparePreferences(r.Context(), req.BaseModel, req.Pairs, cfg)
+	case req.DatasetPath == "":
+		run, err = h.Manager.PrepareDataset(r.Context(), req.BaseModel, req.Dataset, cfg)
+	default:
+		run, err = h.Manager.Prepare(r.Context(), req.BaseModel, req.DatasetPath, req.SampleCount, cfg)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "finetune_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
 		return
 	}
 
@@ -51,23 +71,79 @@ func (h *FinetuneHandler) Prepare(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(run)
 }
 
-// Train handles POST /v1/finetune/train.
+// Import handles POST /v1/finetune/import: add an external dataset, in
+// OpenAI-messages or ShareGPT form, to a pending run.
+func (h *FinetuneHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RunID  string `json:"run_id"`
+		Path   string `json:"path,omitempty"`
+		Format string `json:"format,omitempty"`
+		// Content carries the dataset inline, for a client on another
+		// machine; Name then stands in for its file name.
+		Content string `json:"content,omitempty"`
+		Name    string `json:"name,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.RunID == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
+		return
+	}
+
+	if req.Path == "" && req.Content == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "path or content is required")
+		return
+	}
+
+	var res training.ImportResult
+	var err error
+	if req.Path != "" {
+		res, err = h.Manager.ImportDataset(r.Context(), req.RunID, req.Path, req.Format)
+	} else {
+		name := req.Name
+		if name == "" {
+			name = "upload"
+		}
+		res, err = h.Manager.ImportDatasetFrom(r.Context(), req.RunID, strings.NewReader(req.Content), name, req.Format)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Train handles POST /v1/finetune/train. Config, if given, changes the
+// run's config first.
 func (h *FinetuneHandler) Train(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		RunID string `json:"run_id"`
+		RunID  string          `json:"run_id"`
+		Config json.RawMessage `json:"config,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
 
 	if req.RunID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "run_id is required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
 		return
 	}
 
+	if len(req.Config) > 0 {
+		if _, err := h.Manager.Configure(r.Context(), req.RunID, req.Config); err != nil {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
 	if err := h.Manager.Train(r.Context(), req.RunID); err != nil {
-		writeError(w, http.StatusInternalServerError, "finetune_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
 		return
 	}
 
@@ -79,14 +155,14 @@ func (h *FinetuneHandler) Train(w http.ResponseWriter, r *http.Request) {
 func (h *FinetuneHandler) Status(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 5 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "run_id is required in path")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required in path")
 		return
 	}
 	runID := parts[len(parts)-1]
 
 	run, err := h.Manager.Status(r.Context(), runID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "not_found", err.Error())
+		writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
 		return
 	}
 
@@ -94,6 +170,42 @@ func (h *FinetuneHandler) Status(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(run)
 }
 
+// followInterval is how often Events checks on a training run.
+const followInterval = 2 * time.Second
+
+// Events handles GET /v1/finetune/events/{run_id}: the run's progress as
+// server-sent events while it trains. The stream ends when the run stops
+// training; a failure to get its status is sent as a last event with only
+// an error.
+func (h *FinetuneHandler) Events(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("run_id")
+	if _, err := h.Manager.Status(r.Context(), runID); err != nil {
+		writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(p training.Progress) {
+		data, _ := json.Marshal(p)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	err := h.Manager.Follow(r.Context(), runID, followInterval, send)
+	if err != nil && r.Context().Err() == nil {
+		send(training.Progress{RunID: runID, Error: err.Error()})
+	}
+}
+
 // Merge handles POST /v1/finetune/merge.
 func (h *FinetuneHandler) Merge(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -101,18 +213,18 @@ func (h *FinetuneHandler) Merge(w http.ResponseWriter, r *http.Request) {
 		OutputName string `json:"output_name,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
 
 	if req.RunID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "run_id is required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
 		return
 	}
 
 	outputPath, err := h.Manager.Merge(r.Context(), req.RunID, req.OutputName)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "finetune_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
 		return
 	}
 
@@ -120,11 +232,94 @@ func (h *FinetuneHandler) Merge(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "done", "output_path": outputPath})
 }
 
+// Evaluate handles POST /v1/finetune/evaluate: compare a trained run's
+// adapter with its base model on the held-out slice and optional checks.
+func (h *FinetuneHandler) Evaluate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RunID  string               `json:"run_id"`
+		Checks []training.EvalCheck `json:"checks,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.RunID == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
+		return
+	}
+
+	run, err := h.Manager.Evaluate(r.Context(), req.RunID, req.Checks)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// Release handles POST /v1/finetune/release: merge a trained run, make it
+// the next version of a model family, load it and smoke-test it, rolling
+// back on failure. A rolled-back release is not an error; the run's
+// release says what happened.
+func (h *FinetuneHandler) Release(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RunID string `json:"run_id"`
+		training.ReleaseOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.RunID == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
+		return
+	}
+
+	run, err := h.Manager.Release(r.Context(), req.RunID, req.ReleaseOptions)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// Deploy handles POST /v1/finetune/deploy: load a run's adapter onto the
+// model without merging.
+func (h *FinetuneHandler) Deploy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RunID string `json:"run_id"`
+		Model string `json:"model,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.RunID == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required")
+		return
+	}
+
+	adapterPath, err := h.Manager.Deploy(r.Context(), req.RunID, req.Model)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deployed", "run_id": req.RunID, "adapter_path": adapterPath})
+}
+
 // ListRuns handles GET /v1/finetune/runs.
 func (h *FinetuneHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
 	runs, err := h.Manager.List(r.Context())
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "finetune_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
 		return
 	}
 
@@ -132,17 +327,48 @@ func (h *FinetuneHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"runs": runs})
 }
 
+// GC handles POST /v1/finetune/gc: remove the runs a retention policy
+// does not keep, the server's own when the request gives none.
+func (h *FinetuneHandler) GC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		training.RetentionPolicy
+		DryRun bool `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.KeepLast < 0 || req.MaxBytes < 0 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "keep_last and max_bytes must not be negative")
+		return
+	}
+	if !req.Enabled() && !h.Manager.Retention().Enabled() {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "keep_last or max_bytes is required: the server has no retention policy")
+		return
+	}
+
+	res, err := h.Manager.GC(r.Context(), req.RetentionPolicy, req.DryRun)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 // DeleteRun handles DELETE /v1/finetune/runs/{run_id}.
 func (h *FinetuneHandler) DeleteRun(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 5 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "run_id is required in path")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "run_id is required in path")
 		return
 	}
 	runID := parts[len(parts)-1]
 
 	if err := h.Manager.Delete(r.Context(), runID); err != nil {
-		writeError(w, http.StatusInternalServerError, "finetune_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeFinetuneError, err.Error())
 		return
 	}
 
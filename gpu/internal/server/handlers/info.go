@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// InfoHandler handles GET /api/info.
+type InfoHandler struct {
+	Info func() *api.ServerInfo
+}
+
+func (h *InfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Info())
+}
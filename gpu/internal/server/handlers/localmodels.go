@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// LocalModelsHandler handles the model file management endpoints.
+type LocalModelsHandler struct {
+	Store    *models.Store
+	IsLoaded func(model string) bool
+}
+
+// List handles GET /api/models.
+func (h *LocalModelsHandler) List(w http.ResponseWriter, r *http.Request) {
+	entries := h.Store.List()
+	resp := api.LocalModelsResponse{Models: make([]api.LocalModel, 0, len(entries))}
+	for _, e := range entries {
+		m := h.describe(e)
+		m.ChatTemplate = "" // templates are long; inspect shows them
+		resp.Models = append(resp.Models, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Inspect handles GET /api/models/{name}. The name may be an alias.
+func (h *LocalModelsHandler) Inspect(w http.ResponseWriter, r *http.Request) {
+	path, err := h.Store.Resolve(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+		return
+	}
+
+	m := h.describe(models.ModelEntry{
+		Name:       models.ModelName(path),
+		Path:       path,
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime().Unix(),
+		Metadata:   h.Store.Metadata(path),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// Delete handles DELETE /api/models/{name}. The name must match the file
+// exactly, and the loaded model cannot be deleted.
+func (h *LocalModelsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(r.PathValue("name"), ".gguf")
+	for _, e := range h.Store.List() {
+		if e.Name == name && h.IsLoaded(e.Path) {
+			writeError(w, http.StatusConflict, api.CodeConflict, name+" is loaded; load another model first")
+			return
+		}
+	}
+
+	if _, err := h.Store.Delete(name); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "name": name})
+}
+
+func (h *LocalModelsHandler) describe(e models.ModelEntry) api.LocalModel {
+	m := api.LocalModel{
+		Name:       e.Name,
+		Size:       e.Size,
+		ModifiedAt: e.ModifiedAt,
+		Loaded:     h.IsLoaded(e.Path),
+		Metadata:   e.Metadata,
+	}
+	info, err := runner.ReadGGUFInfo(e.Path)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+	m.Architecture = info.Architecture
+	m.SizeLabel = info.SizeLabel
+	m.Quant = info.FileType
+	m.ContextLength = info.ContextLength
+	m.ChatTemplate = info.ChatTemplate
+	return m
+}
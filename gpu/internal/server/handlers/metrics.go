@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// MetricsHandler handles GET /api/metrics.
+type MetricsHandler struct {
+	GetRunner func() runner.Runner
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp api.MetricsResponse
+	if rn := h.GetRunner(); rn != nil {
+		stats := rn.CacheStats()
+		resp.Model = rn.ModelName()
+		resp.PromptCache = api.PromptCacheStats{
+			Slots:        stats.Slots,
+			Requests:     stats.Requests,
+			PromptTokens: stats.PromptTokens,
+			CachedTokens: stats.CachedTokens,
+			HitRatio:     stats.HitRatio(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
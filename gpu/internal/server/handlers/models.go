@@ -3,29 +3,41 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
 	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
 )
 
-// ModelsHandler handles GET /v1/models.
+var logger = logging.For("handlers")
+
+// ModelsHandler handles GET /v1/models. With OllamaURL set it lists the
+// models that Ollama daemon has pulled instead of the local store.
 type ModelsHandler struct {
-	Store *models.Store
+	Store     *models.Store
+	OllamaURL string
 }
 
 func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.OllamaURL != "" {
+		h.serveOllama(w, r)
+		return
+	}
 	available := h.Store.List()
 
 	data := make([]api.ModelInfo, 0, len(available))
 	for _, m := range available {
 		data = append(data, api.ModelInfo{
-			ID:      m.Name,
-			Object:  "model",
-			Created: m.ModifiedAt,
-			OwnedBy: "local",
+			ID:       m.Name,
+			Object:   "model",
+			Created:  m.ModifiedAt,
+			OwnedBy:  "local",
+			Metadata: m.Metadata,
 		})
 	}
 
@@ -38,9 +50,33 @@ func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// LoadHandler handles POST /api/load.
+func (h *ModelsHandler) serveOllama(w http.ResponseWriter, r *http.Request) {
+	available, err := runner.ListOllamaModels(r.Context(), h.OllamaURL)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.CodeInternalError, err.Error())
+		return
+	}
+
+	data := make([]api.ModelInfo, 0, len(available))
+	for _, m := range available {
+		data = append(data, api.ModelInfo{
+			ID:      m.Name,
+			Object:  "model",
+			Created: m.ModifiedAt.Unix(),
+			OwnedBy: "ollama",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.ModelListResponse{Object: "list", Data: data})
+}
+
+// LoadHandler handles POST /api/load. The model may be named by alias; the
+// response says what it resolved to and the context size it was loaded
+// with.
 type LoadHandler struct {
-	LoadFunc func(ctx context.Context, model string) error
+	LoadFunc     func(ctx context.Context, model string) error
+	DescribeFunc func(model string) (*api.LoadModelResponse, error)
 }
 
 func (h *LoadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -48,25 +84,32 @@ func (h *LoadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Model string `json:"model"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body")
 		return
 	}
 
 	if req.Model == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "model field is required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "model field is required")
 		return
 	}
 
 	if err := h.LoadFunc(r.Context(), req.Model); err != nil {
-		writeError(w, http.StatusInternalServerError, "model_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeModelError, err.Error())
+		return
+	}
+	resp, err := h.DescribeFunc(req.Model)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeModelError, err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "loaded", "model": req.Model})
+	json.NewEncoder(w).Encode(resp)
 }
 
 // PullHandler handles POST /api/pull — download a model.
+// The url field accepts either a direct URL or an "<owner>/<repo>/<file>.gguf"
+// HuggingFace reference. Progress is streamed as api.PullProgress SSE events.
 type PullHandler struct {
 	Store *models.Store
 }
@@ -76,18 +119,24 @@ func (h *PullHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		URL string `json:"url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body")
 		return
 	}
 
 	if req.URL == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "url field is required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "url field is required")
+		return
+	}
+
+	url, err := models.ResolveURL(req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		writeError(w, http.StatusInternalServerError, "server_error", "streaming not supported")
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, "streaming not supported")
 		return
 	}
 
@@ -95,7 +144,22 @@ func (h *PullHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	var lastPercent int
+	send := func(evt api.PullProgress) {
+		data, _ := json.Marshal(evt)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	send(api.PullProgress{Status: "resolving"})
+
+	// Verification is best-effort: a manifest lookup failure should not
+	// block downloads from mirrors or private hosts.
+	sum, err := models.LookupSHA256(r.Context(), url)
+	if err != nil {
+		logger.Warn("pull: checksum lookup failed", "url", url, "err", err)
+	}
+
+	lastPercent := -1
 	progress := func(downloaded, total int64) {
 		if total <= 0 {
 			return
@@ -105,47 +169,74 @@ func (h *PullHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return // only send when percentage changes
 		}
 		lastPercent = percent
-		evt := map[string]any{
-			"status":     "downloading",
-			"downloaded": downloaded,
-			"total":      total,
-			"percent":    percent,
-		}
-		data, _ := json.Marshal(evt)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
+		send(api.PullProgress{
+			Status:     "downloading",
+			Downloaded: downloaded,
+			Total:      total,
+			Percent:    percent,
+		})
 	}
 
-	path, err := models.Download(req.URL, h.Store.Dir(), progress)
+	path, err := models.Download(r.Context(), url, h.Store.Dir(), sum, progress)
 	if err != nil {
-		evt := map[string]string{"status": "error", "error": err.Error()}
-		data, _ := json.Marshal(evt)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
+		send(api.PullProgress{Status: "error", Error: err.Error()})
+		return
+	}
+
+	send(api.PullProgress{Status: "downloaded", Path: path, SHA256: sum})
+}
+
+// PartialsHandler handles GET /api/pull/partial — list resumable downloads.
+type PartialsHandler struct {
+	Store *models.Store
+}
+
+func (h *PartialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writePartials(w, h.Store.Partials())
+}
+
+// pruneMinAge keeps partial downloads written to this recently, as they
+// may still be in progress.
+const pruneMinAge = time.Minute
+
+// Prune handles DELETE /api/pull/partial — remove interrupted downloads.
+func (h *PartialsHandler) Prune(w http.ResponseWriter, r *http.Request) {
+	removed, err := h.Store.PrunePartials(pruneMinAge)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
 		return
 	}
+	writePartials(w, removed)
+}
+
+func writePartials(w http.ResponseWriter, partials []models.ModelEntry) {
+	resp := api.PartialDownloadsResponse{Partials: make([]api.PartialDownload, 0, len(partials))}
+	for _, p := range partials {
+		resp.Partials = append(resp.Partials, api.PartialDownload{
+			Name:       p.Name,
+			Size:       p.Size,
+			ModifiedAt: p.ModifiedAt,
+		})
+	}
 
-	evt := map[string]string{"status": "downloaded", "path": path}
-	data, _ := json.Marshal(evt)
-	fmt.Fprintf(w, "data: %s\n\n", data)
-	flusher.Flush()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
-// normalizeModelName strips common extensions (.gguf, etc.) for comparison.
-func normalizeModelName(name string) string {
-	name = strings.TrimSuffix(name, ".gguf")
-	return name
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, api.NewError(status, code, message))
 }
 
-func writeError(w http.ResponseWriter, status int, errType, message string) {
+// writeAPIError writes err as an error response. Errors that are not an
+// *api.Error are reported as internal errors.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = api.NewError(http.StatusInternalServerError, api.CodeInternalError, err.Error())
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(api.ErrorResponse{
-		Error: api.ErrorDetail{
-			Message: message,
-			Type:    errType,
-		},
-	})
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(apiErr.Response())
 }
 
 // formatSize formats a byte count into human-readable form.
@@ -1,21 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
 )
 
 // TokenizeHandler handles POST /tokenize.
 type TokenizeHandler struct {
 	GetRunner func() runner.Runner
+	LoadFunc  func(ctx context.Context, model string) error
+	LastModel func() string // model to reload when it was unloaded for being idle
 }
 
 func (h *TokenizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rn := h.GetRunner()
+	if rn == nil && h.LastModel() != "" {
+		if err := h.LoadFunc(r.Context(), h.LastModel()); err != nil {
+			writeError(w, http.StatusInternalServerError, api.CodeModelError, "failed to load model: "+err.Error())
+			return
+		}
+		rn = h.GetRunner()
+	}
 	if rn == nil {
-		writeError(w, http.StatusServiceUnavailable, "no_model", "no model loaded")
+		writeError(w, http.StatusServiceUnavailable, api.CodeModelNotLoaded, "no model loaded")
 		return
 	}
 
@@ -23,13 +34,13 @@ func (h *TokenizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body")
 		return
 	}
 
 	count, err := rn.Tokenize(r.Context(), req.Content)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "tokenize_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeTokenizeError, err.Error())
 		return
 	}
 
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// maxAudioBytes caps uploaded audio, as the OpenAI API does.
+const maxAudioBytes = 25 << 20
+
+// TranscriptionsHandler handles POST /v1/audio/transcriptions.
+// It takes an OpenAI-style multipart upload and passes the audio to the
+// whisper-server subprocess.
+type TranscriptionsHandler struct {
+	// EnsureRunner starts whisper-server if needed and returns its base URL,
+	// or "" if no whisper model is configured.
+	EnsureRunner func(ctx context.Context) (string, error)
+}
+
+func (h *TranscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "expected audio in a multipart \"file\" field: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	baseURL, err := h.EnsureRunner(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, api.CodeTranscriptionError, "failed to start whisper server: "+err.Error())
+		return
+	}
+	if baseURL == "" {
+		writeError(w, http.StatusServiceUnavailable, api.CodeNoTranscription, "transcription not configured; start the GPU server with --whisper-model")
+		return
+	}
+
+	// whisper-server's /inference takes the same multipart fields.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", header.Filename)
+	if err == nil {
+		_, err = io.Copy(part, file)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to read audio: "+err.Error())
+		return
+	}
+	mw.WriteField("response_format", "json")
+	for _, field := range []string{"language", "prompt", "temperature"} {
+		if v := r.FormValue(field); v != "" {
+			mw.WriteField(field, v)
+		}
+	}
+	mw.Close()
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, baseURL+"/inference", &body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.CodeTranscriptionError, fmt.Sprintf("whisper server error: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		writeError(w, http.StatusBadGateway, api.CodeTranscriptionError, api.DecodeError(resp.StatusCode, respBody).Message)
+		return
+	}
+	// whisper-server reports some failures, such as unreadable audio, as
+	// {"error": ...} with a 200.
+	var result struct {
+		Text  string `json:"text"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		writeError(w, http.StatusBadGateway, api.CodeTranscriptionError, "unexpected whisper server response: "+err.Error())
+		return
+	}
+	if result.Error != "" {
+		writeError(w, http.StatusBadRequest, api.CodeTranscriptionError, result.Error)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.TranscriptionResponse{Text: strings.TrimSpace(result.Text)})
+}
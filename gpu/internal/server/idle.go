@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// idleCheckInterval is how often the idle timeout is checked. Shorter
+// timeouts are checked as often as they are long.
+const idleCheckInterval = 30 * time.Second
+
+// tracked marks requests to next as model activity, postponing the idle
+// unload until they finish.
+func (s *Server) tracked(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.active++
+		s.lastActivity = time.Now()
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			s.active--
+			s.lastActivity = time.Now()
+			s.mu.Unlock()
+		}()
+		next(w, r)
+	}
+}
+
+// unloadWhenIdle stops the model subprocesses once no request has used them
+// for cfg.IdleUnload, until ctx is cancelled.
+func (s *Server) unloadWhenIdle(ctx context.Context) {
+	ticker := time.NewTicker(min(s.cfg.IdleUnload, idleCheckInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.unloadIfIdle()
+		}
+	}
+}
+
+// unloadIfIdle stops llama-server, the embedding subprocess and
+// whisper-server to free their memory if nothing has used them for
+// cfg.IdleUnload. They start again on the next request: the chat model from
+// lastModel, the embedding and whisper models from the config.
+func (s *Server) unloadIfIdle() {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	s.embeddingMu.Lock()
+	defer s.embeddingMu.Unlock()
+	s.whisperMu.Lock()
+	defer s.whisperMu.Unlock()
+
+	// Requests mark themselves active before they look at the runners, so
+	// one arriving after this check finds them gone and reloads.
+	s.mu.Lock()
+	idle := s.active == 0 && time.Since(s.lastActivity) >= s.cfg.IdleUnload
+	r := s.runner
+	if idle {
+		s.runner = nil
+	}
+	s.mu.Unlock()
+	if !idle {
+		return
+	}
+
+	if r != nil {
+		logger.Info("idle, unloading model", "idle", s.cfg.IdleUnload, "model", r.ModelName())
+		r.Close()
+	}
+	if s.embeddingRunner != nil {
+		logger.Info("idle, stopping embedding server", "idle", s.cfg.IdleUnload)
+		s.embeddingRunner.Close()
+		s.embeddingRunner = nil
+	}
+	if s.whisperRunner != nil {
+		logger.Info("idle, stopping whisper server", "idle", s.cfg.IdleUnload)
+		s.whisperRunner.GracefulStop()
+		s.whisperRunner = nil
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// retentionInterval is how often the training retention policy is
+// enforced.
+const retentionInterval = time.Hour
+
+// enforceRetention removes the training runs the retention policy does
+// not keep, at startup and then every retentionInterval until ctx is
+// cancelled.
+func (s *Server) enforceRetention(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		res, err := s.trainingManager.GC(ctx, s.trainingManager.Retention(), false)
+		switch {
+		case err != nil:
+			logger.Error("training retention failed", "err", err)
+		case len(res.Removed) > 0:
+			logger.Info("removed old training runs", "runs", len(res.Removed), "freed_bytes", res.Freed, "used_bytes", res.Used)
+		}
+		if res != nil && res.OverQuota {
+			logger.Warn("training runs in use exceed the disk quota", "used_bytes", res.Used, "max_bytes", res.Policy.MaxBytes)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,49 +1,82 @@
 package server
 
 import (
-	"log"
 	"net/http"
 
-	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/server/handlers"
 )
 
+var httpLogger = logging.For("http")
+
 func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /health", handlers.Health)
 	mux.HandleFunc("GET /v1/models", s.handleModels)
-	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
-	mux.HandleFunc("POST /api/load", s.handleLoadModel)
+	mux.HandleFunc("POST /v1/chat/completions", s.tracked(s.handleChatCompletions))
+	mux.HandleFunc("POST /api/load", s.tracked(s.handleLoadModel))
 	mux.HandleFunc("POST /api/pull", s.handlePullModel)
-	mux.HandleFunc("POST /tokenize", s.handleTokenize)
-	mux.HandleFunc("POST /v1/embeddings", s.handleEmbeddings)
-
-	// Fine-tuning endpoints (only active if training manager is set)
-	if s.trainingManager != nil {
-		ft := &handlers.FinetuneHandler{Manager: s.trainingManager}
-		mux.HandleFunc("POST /v1/finetune/prepare", ft.Prepare)
-		mux.HandleFunc("POST /v1/finetune/train", ft.Train)
-		mux.HandleFunc("GET /v1/finetune/status/", ft.Status)
-		mux.HandleFunc("POST /v1/finetune/merge", ft.Merge)
-		mux.HandleFunc("GET /v1/finetune/runs", ft.ListRuns)
-		mux.HandleFunc("DELETE /v1/finetune/runs/", ft.DeleteRun)
+	mux.HandleFunc("GET /api/pull/partial", s.handlePartialDownloads)
+	mux.HandleFunc("DELETE /api/pull/partial", (&handlers.PartialsHandler{Store: s.store}).Prune)
+
+	files := &handlers.LocalModelsHandler{Store: s.store, IsLoaded: s.ModelLoaded}
+	mux.HandleFunc("GET /api/models", files.List)
+	mux.HandleFunc("GET /api/models/{name}", files.Inspect)
+	mux.HandleFunc("DELETE /api/models/{name}", files.Delete)
+	mux.HandleFunc("POST /tokenize", s.tracked(s.handleTokenize))
+	mux.HandleFunc("POST /v1/embeddings", s.tracked(s.handleEmbeddings))
+	mux.HandleFunc("POST /v1/audio/transcriptions", s.tracked(s.handleTranscriptions))
+	mux.HandleFunc("GET /api/metrics", s.handleMetrics)
+	mux.HandleFunc("GET /api/info", s.handleInfo)
+
+	adapters := &handlers.AdaptersHandler{
+		LoadFunc:   s.LoadAdapter,
+		UnloadFunc: s.UnloadAdapter,
+		ListFunc:   s.Adapters,
 	}
+	mux.HandleFunc("POST /api/adapters/load", s.tracked(adapters.Load))
+	mux.HandleFunc("POST /api/adapters/unload", s.tracked(adapters.Unload))
+}
+
+// registerFinetuneRoutes adds the fine-tuning endpoints, served by the
+// training manager.
+func (s *Server) registerFinetuneRoutes(mux *http.ServeMux) {
+	ft := &handlers.FinetuneHandler{Manager: s.trainingManager}
+	mux.HandleFunc("POST /v1/finetune/prepare", ft.Prepare)
+	mux.HandleFunc("POST /v1/finetune/import", ft.Import)
+	mux.HandleFunc("POST /v1/finetune/train", ft.Train)
+	mux.HandleFunc("GET /v1/finetune/status/", ft.Status)
+	mux.HandleFunc("GET /v1/finetune/events/{run_id}", ft.Events)
+	mux.HandleFunc("POST /v1/finetune/merge", ft.Merge)
+	mux.HandleFunc("POST /v1/finetune/evaluate", ft.Evaluate)
+	mux.HandleFunc("POST /v1/finetune/deploy", s.tracked(ft.Deploy))
+	mux.HandleFunc("POST /v1/finetune/release", s.tracked(ft.Release))
+	mux.HandleFunc("GET /v1/finetune/runs", ft.ListRuns)
+	mux.HandleFunc("POST /v1/finetune/gc", ft.GC)
+	mux.HandleFunc("DELETE /v1/finetune/runs/", ft.DeleteRun)
 }
 
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
 	h := &handlers.ModelsHandler{Store: s.store}
+	if s.cfg.Backend == config.BackendOllama {
+		h.OllamaURL = s.cfg.OllamaURL
+	}
 	h.ServeHTTP(w, r)
 }
 
 func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	h := &handlers.ChatHandler{
-		GetRunner: func() runner.Runner { return s.runner },
-		LoadFunc:  s.LoadModel,
+		GetRunner:     s.currentRunner,
+		LoadFunc:      s.LoadModel,
+		LastModel:     s.LastModel,
+		IsLoaded:      s.ModelLoaded,
+		AcceptsImages: s.AcceptsImages,
 	}
 	h.ServeHTTP(w, r)
 }
 
 func (s *Server) handleLoadModel(w http.ResponseWriter, r *http.Request) {
-	h := &handlers.LoadHandler{LoadFunc: s.LoadModel}
+	h := &handlers.LoadHandler{LoadFunc: s.LoadModel, DescribeFunc: s.DescribeModel}
 	h.ServeHTTP(w, r)
 }
 
@@ -52,25 +85,45 @@ func (s *Server) handlePullModel(w http.ResponseWriter, r *http.Request) {
 	h.ServeHTTP(w, r)
 }
 
+func (s *Server) handlePartialDownloads(w http.ResponseWriter, r *http.Request) {
+	h := &handlers.PartialsHandler{Store: s.store}
+	h.ServeHTTP(w, r)
+}
+
 func (s *Server) handleTokenize(w http.ResponseWriter, r *http.Request) {
 	h := &handlers.TokenizeHandler{
-		GetRunner: func() runner.Runner { return s.runner },
+		GetRunner: s.currentRunner,
+		LoadFunc:  s.LoadModel,
+		LastModel: s.LastModel,
 	}
 	h.ServeHTTP(w, r)
 }
 
-func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
-	var baseURL string
-	if s.embeddingRunner != nil {
-		baseURL = s.embeddingRunner.BaseURL
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	h := &handlers.MetricsHandler{
+		GetRunner: s.currentRunner,
 	}
-	h := &handlers.EmbeddingsHandler{EmbeddingBaseURL: baseURL}
+	h.ServeHTTP(w, r)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	h := &handlers.InfoHandler{Info: s.Info}
+	h.ServeHTTP(w, r)
+}
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	h := &handlers.EmbeddingsHandler{EnsureRunner: s.EnsureEmbeddingRunner}
+	h.ServeHTTP(w, r)
+}
+
+func (s *Server) handleTranscriptions(w http.ResponseWriter, r *http.Request) {
+	h := &handlers.TranscriptionsHandler{EnsureRunner: s.EnsureWhisperRunner}
 	h.ServeHTTP(w, r)
 }
 
 func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		httpLogger.Info("request", "method", r.Method, "path", r.URL.Path)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -3,25 +3,50 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/logging"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
 	"github.com/ThatCatDev/tanrenai/gpu/internal/training"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
 )
 
+var logger = logging.For("server")
+
 // Server is the tanrenai GPU server — pure inference + training API.
 type Server struct {
 	cfg             *config.Config
 	http            *http.Server
 	store           *models.Store
+	loadMu          sync.Mutex // serializes loading and unloading the model
+	mu              sync.Mutex // guards runner, lastModel, adapters and the activity fields
 	runner          runner.Runner
+	lastModel       string            // name the runner was last loaded with, kept while unloaded
+	modelPath       string            // file lastModel resolved to, or the Ollama model name
+	images          bool              // the loaded model takes image input
+	toolFormat      string            // tool-calling format of the loaded model's chat template
+	tools           bool              // the loaded model can call tools
+	loadedCtx       int               // context size lastModel was started with
+	adapters        []api.LoraAdapter // LoRA adapters applied to lastModel
+	active          int               // requests in progress that use a model
+	lastActivity    time.Time
+	embeddingMu     sync.Mutex // guards embeddingRunner
 	embeddingRunner *EmbeddingSubprocess
+	whisperMu       sync.Mutex // guards whisperRunner
+	whisperRunner   *runner.Subprocess
 	trainingManager *training.Manager
+	layerCache      *gpuLayerCache
+	mux             *http.ServeMux
+	cancelRequests  context.CancelFunc // cancels every request's context, at the drain deadline
 }
 
 // EmbeddingSubprocess wraps an embedding server subprocess.
@@ -33,16 +58,21 @@ type EmbeddingSubprocess struct {
 // New creates a new GPU Server.
 func New(cfg *config.Config) *Server {
 	s := &Server{
-		cfg:   cfg,
-		store: models.NewStore(cfg.ModelsDir),
+		cfg:          cfg,
+		store:        models.NewStore(cfg.ModelsDir),
+		lastActivity: time.Now(),
+		layerCache:   &gpuLayerCache{path: config.GPULayersCachePath()},
 	}
 
-	mux := http.NewServeMux()
-	s.registerRoutes(mux)
+	s.mux = http.NewServeMux()
+	s.registerRoutes(s.mux)
 
+	requestCtx, cancel := context.WithCancel(context.Background())
+	s.cancelRequests = cancel
 	s.http = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Handler: withLogging(withCORS(mux)),
+		Addr:        fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:     withLogging(withCORS(withCompression(s.mux))),
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
 	}
 
 	return s
@@ -55,43 +85,95 @@ func (s *Server) Start(ctx context.Context) error {
 		return fmt.Errorf("listen: %w", err)
 	}
 
-	log.Printf("Tanrenai GPU server listening on %s", s.http.Addr)
-	log.Printf("Models dir: %s", s.cfg.ModelsDir)
-	log.Printf("Bin dir: %s", s.cfg.BinDir)
+	logger.Info("Tanrenai GPU server listening", "addr", s.http.Addr, "models_dir", s.cfg.ModelsDir, "bin_dir", s.cfg.BinDir)
 
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- s.http.Serve(ln)
 	}()
 
+	if s.cfg.IdleUnload > 0 {
+		logger.Info("unloading models when idle", "after", s.cfg.IdleUnload)
+		go s.unloadWhenIdle(ctx)
+	}
+	if s.trainingManager != nil && s.trainingManager.Retention().Enabled() {
+		logger.Info("enforcing training retention", "keep_last", s.cfg.TrainingKeepLast, "max_bytes", s.cfg.TrainingMaxBytes)
+		go s.enforceRetention(ctx)
+	}
+
 	select {
 	case <-ctx.Done():
-		log.Println("Shutting down GPU server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		logger.Info("shutting down", "drain_timeout", s.cfg.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 		defer cancel()
 		if err := s.http.Shutdown(shutdownCtx); err != nil {
-			log.Printf("Server shutdown error: %v", err)
+			logger.Warn("requests still running at the drain deadline; cancelling them", "err", err)
 		}
-		if s.runner != nil {
-			s.runner.Close()
+		// Cancelling requests stops their completions; closing the
+		// connections then lets the subprocesses stop without clients.
+		s.cancelRequests()
+		s.http.Close()
+		if r := s.currentRunner(); r != nil {
+			r.Close()
 		}
+		s.embeddingMu.Lock()
 		if s.embeddingRunner != nil {
 			s.embeddingRunner.Sub.GracefulStop()
 		}
+		s.embeddingMu.Unlock()
+		s.whisperMu.Lock()
+		if s.whisperRunner != nil {
+			s.whisperRunner.GracefulStop()
+		}
+		s.whisperMu.Unlock()
+		logger.Info("shutdown complete")
 		return nil
 	case err := <-errCh:
 		return err
 	}
 }
 
-// SetTrainingManager sets the training manager for fine-tuning API endpoints.
+// SetTrainingManager sets the training manager and serves the fine-tuning
+// API endpoints with it; call it once, before Start. Deployed adapters are
+// loaded into this server's model, and released models replace it. The
+// retention policy comes from the config.
 func (s *Server) SetTrainingManager(m *training.Manager) {
+	m.SetAdapterLoader(s.LoadAdapter)
+	m.SetRetention(training.RetentionPolicy{KeepLast: s.cfg.TrainingKeepLast, MaxBytes: s.cfg.TrainingMaxBytes})
+	if s.cfg.Backend != config.BackendOllama {
+		m.SetModelHost(s)
+	}
 	s.trainingManager = m
+	s.registerFinetuneRoutes(s.mux)
 }
 
-// SetEmbeddingRunner sets the embedding subprocess for the /v1/embeddings endpoint.
-func (s *Server) SetEmbeddingRunner(er *EmbeddingSubprocess) {
+// EnsureEmbeddingRunner returns the base URL of the embedding subprocess,
+// starting it first if an embedding model is configured and the subprocess
+// has not been started yet or has exited. It returns "" when no embedding
+// model is configured.
+func (s *Server) EnsureEmbeddingRunner(ctx context.Context) (string, error) {
+	s.embeddingMu.Lock()
+	defer s.embeddingMu.Unlock()
+
+	if er := s.embeddingRunner; er != nil {
+		select {
+		case <-er.Sub.Done():
+			logger.Warn("embedding server exited, restarting", "exit_code", er.Sub.ExitCode())
+			s.embeddingRunner = nil
+		default:
+			return er.BaseURL, nil
+		}
+	}
+	if s.cfg.EmbeddingModel == "" {
+		return "", nil
+	}
+
+	er, err := s.StartEmbeddingSubprocess(ctx, s.cfg.EmbeddingModel)
+	if err != nil {
+		return "", err
+	}
 	s.embeddingRunner = er
+	return er.BaseURL, nil
 }
 
 // StartEmbeddingSubprocess resolves the model and spawns a llama-server in embedding mode.
@@ -101,58 +183,354 @@ func (s *Server) StartEmbeddingSubprocess(ctx context.Context, modelName string)
 		return nil, err
 	}
 
-	args := []string{
-		"--model", modelPath,
-		"--embedding",
-		"--ctx-size", "512",
-		"--host", "127.0.0.1",
-		"--n-gpu-layers", "999",
-	}
+	const ctxSize = 512
+	er, err := startWithAutoLayers(ctx, s.layerCache, modelPath, ctxSize, func(layers int) (*EmbeddingSubprocess, error) {
+		args := []string{
+			"--model", modelPath,
+			"--embedding",
+			"--ctx-size", strconv.Itoa(ctxSize),
+			"--host", "127.0.0.1",
+			"--n-gpu-layers", strconv.Itoa(layers),
+		}
 
-	sub, err := runner.NewSubprocess(runner.SubprocessConfig{
-		BinDir:        s.cfg.BinDir,
-		Args:          args,
-		Label:         "embedding",
-		HealthTimeout: 60 * time.Second,
+		sub, err := runner.NewSubprocess(runner.SubprocessConfig{
+			BinDir:        s.cfg.BinDir,
+			Args:          args,
+			Label:         "embedding",
+			HealthTimeout: 60 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := sub.Start(ctx); err != nil {
+			return nil, err
+		}
+		return &EmbeddingSubprocess{Sub: sub, BaseURL: sub.BaseURL()}, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := sub.Start(ctx); err != nil {
-		return nil, err
+	logger.Info("embedding server ready", "url", er.BaseURL, "model", modelName)
+	return er, nil
+}
+
+// Close stops the embedding subprocess.
+func (e *EmbeddingSubprocess) Close() error {
+	return e.Sub.GracefulStop()
+}
+
+// currentRunner returns the loaded runner, or nil.
+func (s *Server) currentRunner() runner.Runner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runner
+}
+
+// LastModel returns the name of the model loaded last, even if it has been
+// unloaded since, so a request that names no model can bring it back.
+func (s *Server) LastModel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastModel
+}
+
+// ModelLoaded reports whether modelName, a model name, alias or path,
+// refers to the loaded model.
+func (s *Server) ModelLoaded(modelName string) bool {
+	modelPath, err := s.resolve(modelName)
+	if err != nil {
+		return false
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runner != nil && s.modelPath == modelPath
+}
+
+// LoadedModel returns the path of the loaded model, or "" if none is.
+func (s *Server) LoadedModel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runner == nil {
+		return ""
+	}
+	return s.modelPath
+}
+
+// smokeMaxTokens bounds the replies of Ask, which only need to show the
+// model still answers sensibly.
+const smokeMaxTokens = 128
+
+// Ask returns the loaded model's greedy reply to prompt.
+func (s *Server) Ask(ctx context.Context, prompt string) (string, error) {
+	r := s.currentRunner()
+	if r == nil {
+		return "", fmt.Errorf("no model loaded")
+	}
+	temp, maxTokens := 0.0, smokeMaxTokens
+	resp, err := r.ChatCompletion(ctx, &api.ChatCompletionRequest{
+		Messages:    []api.Message{{Role: "user", Content: prompt}},
+		Temperature: &temp,
+		MaxTokens:   &maxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response from model")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// AcceptsImages reports whether the loaded model can take image input:
+// it has a multimodal projector, or Ollama reports vision support.
+func (s *Server) AcceptsImages() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runner != nil && s.images
+}
 
-	log.Printf("Embedding server ready on %s (model: %s)", sub.BaseURL(), modelName)
-	return &EmbeddingSubprocess{Sub: sub, BaseURL: sub.BaseURL()}, nil
+// Info reports the model loaded last, the context size it runs with and
+// the optional features this server has.
+func (s *Server) Info() *api.ServerInfo {
+	info := &api.ServerInfo{Version: s.cfg.Version, Features: []string{}}
+	s.mu.Lock()
+	if s.lastModel != "" {
+		info.Model = s.modelPath
+		if s.cfg.Backend != config.BackendOllama {
+			info.Model = models.ModelName(s.modelPath)
+		}
+		info.Loaded = s.runner != nil
+		info.CtxSize = s.loadedCtx
+		info.ToolFormat = s.toolFormat
+		if s.tools {
+			info.Features = append(info.Features, api.FeatureTools)
+		}
+		if s.images {
+			info.Features = append(info.Features, api.FeatureVision)
+		}
+	}
+	s.mu.Unlock()
+	if s.cfg.EmbeddingModel != "" {
+		info.Features = append(info.Features, api.FeatureEmbeddings)
+	}
+	if s.cfg.WhisperModel != "" {
+		info.Features = append(info.Features, api.FeatureTranscription)
+	}
+	if s.trainingManager != nil {
+		info.Features = append(info.Features, api.FeatureFinetune)
+	}
+	return info
+}
+
+// resolve returns what identifies modelName once loaded: the file it
+// resolves to, or under the ollama backend the Ollama model name with its
+// implied ":latest" tag.
+func (s *Server) resolve(modelName string) (string, error) {
+	if s.cfg.Backend != config.BackendOllama {
+		return s.store.Resolve(modelName)
+	}
+	if !strings.Contains(modelName, ":") {
+		modelName += ":latest"
+	}
+	return modelName, nil
 }
 
-// LoadModel loads a model by name into the runner.
+// LoadModel loads a model by name or alias into the runner. Concurrent
+// calls for the same model load it once. Reloading the same model keeps
+// its LoRA adapters; switching models drops them.
 func (s *Server) LoadModel(ctx context.Context, modelName string) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	modelPath, err := s.resolve(modelName)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	loaded := s.runner != nil && s.modelPath == modelPath
+	var adapters []api.LoraAdapter
+	if modelPath == s.modelPath {
+		adapters = s.adapters // reloading keeps the adapters
+	}
+	s.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	return s.loadModelLocked(ctx, modelName, adapters)
+}
+
+// DescribeModel returns what loading modelName does: the model it resolves
+// to, its registry metadata and the context size it is loaded with.
+func (s *Server) DescribeModel(modelName string) (*api.LoadModelResponse, error) {
+	if s.cfg.Backend == config.BackendOllama {
+		return &api.LoadModelResponse{Status: "loaded", Model: modelName, Name: modelName, CtxSize: s.cfg.CtxSize}, nil
+	}
+	modelPath, err := s.store.Resolve(modelName)
+	if err != nil {
+		return nil, err
+	}
+	meta := s.store.Metadata(modelPath)
+	s.mu.Lock()
+	var toolFormat string
+	if modelPath == s.modelPath {
+		toolFormat = s.toolFormat
+	}
+	s.mu.Unlock()
+	return &api.LoadModelResponse{
+		Status:     "loaded",
+		Model:      modelName,
+		Name:       models.ModelName(modelPath),
+		CtxSize:    s.ctxSize(meta),
+		ToolFormat: toolFormat,
+		Metadata:   meta,
+	}, nil
+}
+
+// chatTemplate picks the chat template for the model at modelPath when
+// opts names none, replacing an embedded template that does not describe
+// tools with a built-in one for its family, and returns the tool-calling
+// format of the template llama-server will use.
+func chatTemplate(modelPath string, opts *runner.Options) (string, error) {
+	if opts.ChatTemplateFile != "" {
+		data, err := os.ReadFile(opts.ChatTemplateFile)
+		if err != nil {
+			return "", err
+		}
+		return runner.DetectToolFormat(string(data)), nil
+	}
+	info, err := runner.ReadGGUFInfo(modelPath)
+	if err != nil {
+		// Not fatal: llama-server reports unreadable models itself.
+		return runner.ToolFormatHermes, nil
+	}
+	family := runner.NeedsToolTemplate(info.ChatTemplate, info.Architecture)
+	if family == "" {
+		return runner.DetectToolFormat(info.ChatTemplate), nil
+	}
+	if opts.ChatTemplateFile, err = runner.WriteChatTemplate(family); err != nil {
+		return "", err
+	}
+	logger.Info("model has no tool-calling template; using a built-in one", "model", models.ModelName(modelPath), "template", family)
+	return runner.ToolFormatQwen, nil
+}
+
+// ctxSize is the context size for a model: from the registry, or the
+// server default.
+func (s *Server) ctxSize(meta *api.ModelMetadata) int {
+	if meta != nil && meta.CtxSize > 0 {
+		return meta.CtxSize
+	}
+	return s.cfg.CtxSize
+}
+
+// loadModelLocked (re)starts llama-server with modelName and adapters,
+// applying the model's registry metadata. The caller holds loadMu.
+func (s *Server) loadModelLocked(ctx context.Context, modelName string, adapters []api.LoraAdapter) error {
+	if s.cfg.Backend == config.BackendOllama {
+		return s.loadOllamaLocked(ctx, modelName)
+	}
 	modelPath, err := s.store.Resolve(modelName)
 	if err != nil {
 		return err
 	}
+	meta := s.store.Metadata(modelPath)
 
 	// Close existing runner if any
-	if s.runner != nil {
-		s.runner.Close()
-		s.runner = nil
+	s.mu.Lock()
+	old := s.runner
+	s.runner = nil
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
 	}
 
-	r := runner.NewProcessRunner()
 	opts := runner.DefaultOptions()
 	opts.BinDir = s.cfg.BinDir
-	opts.GPULayers = s.cfg.GPULayers
-	opts.CtxSize = s.cfg.CtxSize
+	opts.CtxSize = s.ctxSize(meta)
 	opts.ChatTemplateFile = s.cfg.ChatTemplateFile
+	if opts.ChatTemplateFile == "" && meta != nil && meta.ChatTemplate != "" {
+		if opts.ChatTemplateFile, err = runner.WriteChatTemplate(meta.ChatTemplate); err != nil {
+			return fmt.Errorf("%s: %w", modelName, err)
+		}
+	}
+	toolFormat, err := chatTemplate(modelPath, &opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", modelName, err)
+	}
+	if opts.MMProj, err = s.store.Projector(meta); err != nil {
+		return fmt.Errorf("%s: %w", modelName, err)
+	}
+	opts.ExtraArgs = models.LaunchArgs(meta)
 	opts.FlashAttention = s.cfg.FlashAttention
 	opts.ReasoningFormat = s.cfg.ReasoningFormat
+	opts.Parallel = s.cfg.Parallel
+	opts.LoraAdapters = slices.Clone(adapters)
+
+	load := func(layers int) (*runner.ProcessRunner, error) {
+		r := runner.NewProcessRunner()
+		o := opts
+		o.GPULayers = layers
+		if err := r.Load(ctx, modelPath, o); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	var r *runner.ProcessRunner
+	if s.cfg.GPULayers < 0 {
+		r, err = startWithAutoLayers(ctx, s.layerCache, modelPath, opts.CtxSize, load)
+	} else {
+		r, err = load(s.cfg.GPULayers)
+	}
+	if err != nil {
+		return err
+	}
 
-	if err := r.Load(ctx, modelPath, opts); err != nil {
+	s.mu.Lock()
+	s.runner = r
+	s.lastModel = modelName
+	s.modelPath = modelPath
+	s.images = opts.MMProj != ""
+	s.toolFormat = toolFormat
+	s.tools = toolFormat != ""
+	s.loadedCtx = opts.CtxSize
+	s.adapters = adapters
+	s.mu.Unlock()
+	return nil
+}
+
+// loadOllamaLocked has the Ollama daemon load modelName in place of
+// starting llama-server. LoadAdapter refuses adapters under this backend,
+// so there are none to apply. The caller holds loadMu.
+func (s *Server) loadOllamaLocked(ctx context.Context, modelName string) error {
+	name, _ := s.resolve(modelName)
+
+	s.mu.Lock()
+	old := s.runner
+	s.runner = nil
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	r := runner.NewOllamaRunner(s.cfg.OllamaURL)
+	opts := runner.DefaultOptions()
+	opts.CtxSize = s.cfg.CtxSize
+	if err := r.Load(ctx, name, opts); err != nil {
 		return err
 	}
 
+	s.mu.Lock()
 	s.runner = r
+	s.lastModel = modelName
+	s.modelPath = name
+	s.images = r.Vision()
+	s.toolFormat = ""
+	s.tools = r.Tools()
+	s.loadedCtx = opts.CtxSize
+	s.adapters = nil
+	s.mu.Unlock()
 	return nil
 }
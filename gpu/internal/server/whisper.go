@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/runner"
+)
+
+// EnsureWhisperRunner returns the base URL of whisper-server, starting it
+// first if a whisper model is configured and the subprocess has not been
+// started yet or has exited. It returns "" when no whisper model is
+// configured.
+func (s *Server) EnsureWhisperRunner(ctx context.Context) (string, error) {
+	s.whisperMu.Lock()
+	defer s.whisperMu.Unlock()
+
+	if sub := s.whisperRunner; sub != nil {
+		select {
+		case <-sub.Done():
+			logger.Warn("whisper server exited, restarting", "exit_code", sub.ExitCode())
+			s.whisperRunner = nil
+		default:
+			return sub.BaseURL(), nil
+		}
+	}
+	if s.cfg.WhisperModel == "" {
+		return "", nil
+	}
+
+	modelPath, err := s.store.ResolveWhisper(s.cfg.WhisperModel)
+	if err != nil {
+		return "", err
+	}
+	sub, err := runner.NewSubprocess(runner.SubprocessConfig{
+		BinDir:        s.cfg.BinDir,
+		Binary:        "whisper-server",
+		Args:          []string{"--model", modelPath, "--host", "127.0.0.1"},
+		Label:         "whisper",
+		HealthTimeout: 60 * time.Second,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := sub.Start(ctx); err != nil {
+		return "", err
+	}
+
+	logger.Info("whisper server ready", "url", sub.BaseURL(), "model", s.cfg.WhisperModel)
+	s.whisperRunner = sub
+	return sub.BaseURL(), nil
+}
@@ -3,16 +3,24 @@ package training
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 )
 
 // SidecarClient is an HTTP client for the Python training sidecar.
 type SidecarClient struct {
 	baseURL string
 	http    *http.Client
+	token   string
+	upload  bool // send datasets over HTTP rather than by path
 }
 
 // NewSidecarClient creates a client pointing at the given sidecar URL.
@@ -23,6 +31,50 @@ func NewSidecarClient(baseURL string) *SidecarClient {
 	}
 }
 
+// SidecarOptions configures a client for a sidecar that may run on
+// another machine.
+type SidecarOptions struct {
+	Token    string // bearer token the sidecar requires (TANRENAI_SIDECAR_TOKEN on its side)
+	CAFile   string // PEM certificates to verify an https sidecar with, e.g. its self-signed one
+	Insecure bool   // skip TLS certificate verification
+}
+
+// NewRemoteSidecarClient creates a client for the sidecar at baseURL,
+// which may be https. Unless its host is a loopback address, datasets are
+// uploaded to it rather than passed by path, since it cannot read this
+// machine's files; the adapters, merged models and GGUFs it writes stay
+// at the same paths on its own machine.
+func NewRemoteSidecarClient(baseURL string, opts SidecarOptions) (*SidecarClient, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid sidecar URL %q: want http(s)://host:port", baseURL)
+	}
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: opts.Insecure}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read sidecar CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", opts.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return &SidecarClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Transport: transport},
+		token:   opts.Token,
+		upload:  host != "localhost" && (ip == nil || !ip.IsLoopback()),
+	}, nil
+}
+
 // TrainRequest is the request body for POST /train.
 type TrainRequest struct {
 	DatasetPath   string  `json:"dataset_path"`
@@ -34,6 +86,9 @@ type TrainRequest struct {
 	LoraRank      int     `json:"lora_rank"`
 	LoraAlpha     int     `json:"lora_alpha"`
 	BatchSize     int     `json:"batch_size"`
+	MaxSeqLength  int     `json:"max_seq_length,omitempty"`
+	Method        string  `json:"method,omitempty"` // MethodSFT or MethodDPO; "" is MethodSFT
+	DPOBeta       float64 `json:"dpo_beta,omitempty"`
 }
 
 // TrainResponse is returned from POST /train.
@@ -63,6 +118,37 @@ type ConvertRequest struct {
 	Quantization string `json:"quantization"`
 }
 
+// ConvertLoraRequest is the request body for POST /convert-lora.
+type ConvertLoraRequest struct {
+	AdapterDir    string `json:"adapter_dir"`
+	BaseModelPath string `json:"base_model_path"`
+	OutputPath    string `json:"output_path"`
+}
+
+// EvaluateRequest is the request body for POST /evaluate. DatasetPath,
+// when set, is JSONL to compute the losses over.
+type EvaluateRequest struct {
+	BaseModelPath string      `json:"base_model_path"`
+	AdapterDir    string      `json:"adapter_dir"`
+	DatasetPath   string      `json:"dataset_path,omitempty"`
+	Checks        []EvalCheck `json:"checks,omitempty"`
+}
+
+// EvaluateResponse is returned from POST /evaluate. Answers are in the
+// order of the request's checks.
+type EvaluateResponse struct {
+	Samples   int            `json:"samples"`
+	BaseLoss  float64        `json:"base_loss"`
+	TunedLoss float64        `json:"tuned_loss"`
+	Answers   []CheckAnswers `json:"answers"`
+}
+
+// CheckAnswers are the base and fine-tuned models' replies to a check.
+type CheckAnswers struct {
+	Base  string `json:"base"`
+	Tuned string `json:"tuned"`
+}
+
 // Train starts a training job on the sidecar.
 func (c *SidecarClient) Train(ctx context.Context, req TrainRequest) (string, error) {
 	var resp TrainResponse
@@ -93,6 +179,21 @@ func (c *SidecarClient) Convert(ctx context.Context, req ConvertRequest) error {
 	return c.post(ctx, "/convert", req, &resp)
 }
 
+// ConvertLora converts a LoRA adapter to a GGUF adapter for llama-server.
+func (c *SidecarClient) ConvertLora(ctx context.Context, req ConvertLoraRequest) error {
+	var resp map[string]any
+	return c.post(ctx, "/convert-lora", req, &resp)
+}
+
+// Evaluate scores an adapter against its base model.
+func (c *SidecarClient) Evaluate(ctx context.Context, req EvaluateRequest) (EvaluateResponse, error) {
+	var resp EvaluateResponse
+	if err := c.post(ctx, "/evaluate", req, &resp); err != nil {
+		return EvaluateResponse{}, err
+	}
+	return resp, nil
+}
+
 func (c *SidecarClient) post(ctx context.Context, path string, body any, result any) error {
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -105,7 +206,7 @@ func (c *SidecarClient) post(ctx context.Context, path string, body any, result
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -131,7 +232,7 @@ func (c *SidecarClient) get(ctx context.Context, path string, result any) error
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -150,3 +251,11 @@ func (c *SidecarClient) get(ctx context.Context, path string, result any) error
 
 	return nil
 }
+
+// do sends req with the client's bearer token.
+func (c *SidecarClient) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
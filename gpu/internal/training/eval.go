@@ -0,0 +1,140 @@
+package training
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// splitDataset writes the JSONL dataset at path to train.jsonl and
+// eval.jsonl in dir, holding out every entry whose index falls on a
+// multiple of 1/share so the slice spans the whole dataset. It returns ""
+// for the eval path when the dataset is too small to spare an entry.
+func splitDataset(path, dir string, share float64) (trainPath, evalPath string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("read dataset: %w", err)
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, bytes.Clone(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("read dataset: %w", err)
+	}
+
+	held := int(math.Round(float64(len(lines)) * share))
+	if held == 0 && len(lines) >= 2 {
+		held = 1
+	}
+	if held == 0 || held >= len(lines) {
+		return path, "", nil
+	}
+
+	var train, eval bytes.Buffer
+	step := float64(len(lines)) / float64(held)
+	next := 0.0
+	for i, line := range lines {
+		out := &train
+		if held > 0 && float64(i) >= next {
+			out = &eval
+			held--
+			next += step
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	trainPath = filepath.Join(dir, "train.jsonl")
+	evalPath = filepath.Join(dir, "eval.jsonl")
+	if err := os.WriteFile(trainPath, train.Bytes(), 0644); err != nil {
+		return "", "", fmt.Errorf("write training split: %w", err)
+	}
+	if err := os.WriteFile(evalPath, eval.Bytes(), 0644); err != nil {
+		return "", "", fmt.Errorf("write eval split: %w", err)
+	}
+	return trainPath, evalPath, nil
+}
+
+// Evaluate compares a trained run's adapter with its base model: loss and
+// perplexity on the slice held out by Train, if any, and the answers of
+// both to checks. The results are stored in the run's Metrics.Eval.
+func (m *Manager) Evaluate(ctx context.Context, runID string, checks []EvalCheck) (*TrainingRun, error) {
+	run, err := m.trainedRun(ctx, runID, "evaluation")
+	if err != nil {
+		return nil, err
+	}
+	if run.EvalPath == "" && len(checks) == 0 {
+		return nil, fmt.Errorf("run %s has no held-out data; pass checks to evaluate it", runID)
+	}
+
+	evalPath, err := m.client.stageDataset(ctx, runID+"-eval.jsonl", run.EvalPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Evaluate(ctx, EvaluateRequest{
+		BaseModelPath: run.BaseModel,
+		AdapterDir:    run.AdapterDir,
+		DatasetPath:   evalPath,
+		Checks:        checks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("evaluate: %w", err)
+	}
+
+	eval := &EvalMetrics{
+		Samples:     resp.Samples,
+		BaseLoss:    resp.BaseLoss,
+		TunedLoss:   resp.TunedLoss,
+		EvaluatedAt: time.Now(),
+	}
+	if resp.Samples > 0 {
+		eval.BasePerplexity = math.Exp(resp.BaseLoss)
+		eval.TunedPerplexity = math.Exp(resp.TunedLoss)
+	}
+	for i, check := range checks {
+		var answers CheckAnswers
+		if i < len(resp.Answers) {
+			answers = resp.Answers[i]
+		}
+		res := CheckResult{
+			EvalCheck:   check,
+			BaseAnswer:  answers.Base,
+			TunedAnswer: answers.Tuned,
+			BasePassed:  passes(answers.Base, check.Expected),
+			TunedPassed: passes(answers.Tuned, check.Expected),
+		}
+		if res.BasePassed {
+			eval.BasePassed++
+		}
+		if res.TunedPassed {
+			eval.TunedPassed++
+		}
+		eval.Checks = append(eval.Checks, res)
+	}
+
+	run.Metrics.Eval = eval
+	run.UpdatedAt = time.Now()
+	if err := m.runStore.Save(run); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	return run, nil
+}
+
+// passes reports whether answer contains expected, ignoring case.
+func passes(answer, expected string) bool {
+	return strings.Contains(strings.ToLower(answer), strings.ToLower(strings.TrimSpace(expected)))
+}
@@ -0,0 +1,230 @@
+package training
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
+)
+
+// Dataset formats ImportDataset reads. Both come as JSONL or as a JSON
+// array of samples.
+const (
+	FormatOpenAI   = "openai"   // {"messages": [{"role": ..., "content": ...}]}
+	FormatShareGPT = "sharegpt" // {"conversations": [{"from": ..., "value": ...}]}
+)
+
+// ImportResult is what an import added to a run.
+type ImportResult struct {
+	Source   string `json:"source"`   // the imported samples' DatasetEntry.Source
+	Imported int    `json:"imported"` // samples added
+	Skipped  int    `json:"skipped"`  // records that did not parse or had no assistant reply
+}
+
+// shareGPTRoles maps ShareGPT speakers to chat roles; turns by others,
+// such as function calls and observations, are left out.
+var shareGPTRoles = map[string]string{
+	"system":    "system",
+	"human":     "user",
+	"user":      "user",
+	"gpt":       "assistant",
+	"assistant": "assistant",
+	"chatgpt":   "assistant",
+	"model":     "assistant",
+}
+
+// ImportDataset adds the samples of the dataset file at path to a pending
+// run, after those it has. format is FormatOpenAI, FormatShareGPT or ""
+// to tell them apart per record. Each sample records the file as its
+// source and its position in the file.
+func (m *Manager) ImportDataset(ctx context.Context, runID, path, format string) (ImportResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("open dataset: %w", err)
+	}
+	defer f.Close()
+	return m.ImportDatasetFrom(ctx, runID, f, filepath.Base(path), format)
+}
+
+// ImportDatasetFrom is ImportDataset for a dataset read from r, such as one
+// uploaded by a client; name stands in for the file name.
+func (m *Manager) ImportDatasetFrom(ctx context.Context, runID string, r io.Reader, name, format string) (ImportResult, error) {
+	switch format {
+	case "", FormatOpenAI, FormatShareGPT:
+	default:
+		return ImportResult{}, fmt.Errorf("unknown dataset format %q: want %s or %s", format, FormatOpenAI, FormatShareGPT)
+	}
+
+	run, err := m.runStore.Load(runID)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("load run: %w", err)
+	}
+	if run.Status != StatusPending {
+		return ImportResult{}, fmt.Errorf("run %s has status %s, expected %s", runID, run.Status, StatusPending)
+	}
+	if run.Config.Method == MethodDPO {
+		return ImportResult{}, fmt.Errorf("run %s trains on preference pairs, not chat samples", runID)
+	}
+
+	records, err := readRecords(r)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	res := ImportResult{Source: "import:" + name}
+	var entries []DatasetEntry
+	for _, rec := range records {
+		messages, err := convertRecord(rec.data, format)
+		if err != nil {
+			res.Skipped++
+			continue
+		}
+		entries = append(entries, DatasetEntry{Messages: messages, Source: res.Source, Ref: rec.ref})
+	}
+	if len(entries) == 0 {
+		return res, fmt.Errorf("no usable samples in %s (%d skipped)", name, res.Skipped)
+	}
+
+	if err := m.appendDataset(run, entries); err != nil {
+		return res, err
+	}
+	res.Imported = len(entries)
+	return res, nil
+}
+
+// appendDataset adds entries to run's dataset and counts them. A dataset
+// outside the datasets directory was supplied by the user and is copied
+// there first rather than changed in place.
+func (m *Manager) appendDataset(run *TrainingRun, entries []DatasetEntry) error {
+	if run.Sources == nil && run.Metrics.SamplesUsed > 0 {
+		run.Sources = map[string]int{"dataset": run.Metrics.SamplesUsed}
+	}
+
+	dir := config.TrainingDatasetsDir()
+	if rel, err := filepath.Rel(dir, run.DatasetPath); err != nil || strings.HasPrefix(rel, "..") {
+		data, err := os.ReadFile(run.DatasetPath)
+		if err != nil {
+			return fmt.Errorf("read dataset: %w", err)
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("dataset-%d.jsonl", time.Now().UnixNano()))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("copy dataset: %w", err)
+		}
+		run.DatasetPath = path
+	}
+
+	f, err := os.OpenFile(run.DatasetPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open dataset: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return fmt.Errorf("write dataset: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write dataset: %w", err)
+	}
+
+	if run.Sources == nil {
+		run.Sources = make(map[string]int)
+	}
+	for source, n := range countSources(entries) {
+		run.Sources[source] += n
+	}
+	run.Metrics.SamplesUsed += len(entries)
+	run.UpdatedAt = time.Now()
+	return m.runStore.Save(run)
+}
+
+// record is one sample of a dataset file and where it was.
+type record struct {
+	data json.RawMessage
+	ref  string
+}
+
+// readRecords splits a dataset into its records: the elements of a JSON
+// array, or the non-blank lines of JSONL.
+func readRecords(r io.Reader) ([]record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read dataset: %w", err)
+	}
+	var records []record
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("parse dataset: %w", err)
+		}
+		for i, item := range items {
+			records = append(records, record{data: item, ref: fmt.Sprintf("item %d", i+1)})
+		}
+		return records, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			records = append(records, record{data: bytes.Clone(line), ref: fmt.Sprintf("line %d", n)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read dataset: %w", err)
+	}
+	return records, nil
+}
+
+// convertRecord turns a sample in format into chat messages. It fails for
+// samples without an assistant reply, which teach nothing.
+func convertRecord(data json.RawMessage, format string) ([]api.Message, error) {
+	var rec struct {
+		Messages      []api.Message `json:"messages"`
+		Conversations []struct {
+			From  string `json:"from"`
+			Value string `json:"value"`
+		} `json:"conversations"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+
+	var messages []api.Message
+	switch {
+	case format == FormatOpenAI || (format == "" && len(rec.Messages) > 0):
+		for _, msg := range rec.Messages {
+			if msg.Role == "system" || msg.Role == "user" || msg.Role == "assistant" {
+				messages = append(messages, api.Message{Role: msg.Role, Content: msg.Content})
+			}
+		}
+	case format == FormatShareGPT || (format == "" && len(rec.Conversations) > 0):
+		for _, turn := range rec.Conversations {
+			if role, ok := shareGPTRoles[strings.ToLower(turn.From)]; ok {
+				messages = append(messages, api.Message{Role: role, Content: turn.Value})
+			}
+		}
+	}
+
+	for _, msg := range messages {
+		if msg.Role == "assistant" && strings.TrimSpace(msg.Content) != "" {
+			return messages, nil
+		}
+	}
+	return nil, fmt.Errorf("no assistant reply")
+}
@@ -1,10 +1,13 @@
 package training
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
@@ -14,11 +17,18 @@ import (
 // Dataset preparation (export from memory) happens on the backend;
 // the GPU server receives pre-exported dataset paths.
 type Manager struct {
-	runStore  *RunStore
-	client    *SidecarClient
-	modelsDir string
+	runStore    *RunStore
+	client      *SidecarClient
+	modelsDir   string
+	loadAdapter AdapterLoader
+	host        ModelHost
+	retention   RetentionPolicy
 }
 
+// AdapterLoader applies a GGUF LoRA adapter to model, or to the loaded
+// model when model is "".
+type AdapterLoader func(ctx context.Context, model, path string, scale float64) error
+
 // NewManager creates a training Manager.
 func NewManager(client *SidecarClient) *Manager {
 	return &Manager{
@@ -37,9 +47,18 @@ func NewManagerWithStore(store *RunStore, client *SidecarClient, modelsDir strin
 	}
 }
 
+// SetAdapterLoader sets how Deploy loads adapters.
+func (m *Manager) SetAdapterLoader(fn AdapterLoader) {
+	m.loadAdapter = fn
+}
+
 // Prepare creates a pending training run with a pre-exported dataset.
 // The dataset file is provided by the caller (backend exports from memory).
 func (m *Manager) Prepare(ctx context.Context, baseModel, datasetPath string, sampleCount int, cfg RunConfig) (*TrainingRun, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	runID := fmt.Sprintf("%s-%d", "ft", time.Now().Unix())
 
 	now := time.Now()
@@ -63,6 +82,119 @@ func (m *Manager) Prepare(ctx context.Context, baseModel, datasetPath string, sa
 	return run, nil
 }
 
+// PrepareDataset creates a pending training run from samples sent with the
+// request, saving them as JSONL in the datasets directory.
+func (m *Manager) PrepareDataset(ctx context.Context, baseModel string, entries []DatasetEntry, cfg RunConfig) (*TrainingRun, error) {
+	path, err := writeDataset(entries)
+	if err != nil {
+		return nil, err
+	}
+	run, err := m.Prepare(ctx, baseModel, path, len(entries), cfg)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	run.Sources = countSources(entries)
+	if err := m.runStore.Save(run); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	return run, nil
+}
+
+// PreparePreferences creates a pending DPO run from preference pairs sent
+// with the request, saving them as JSONL in the datasets directory.
+func (m *Manager) PreparePreferences(ctx context.Context, baseModel string, pairs []PreferencePair, cfg RunConfig) (*TrainingRun, error) {
+	for i, p := range pairs {
+		if len(p.Prompt) == 0 || strings.TrimSpace(p.Chosen) == "" || strings.TrimSpace(p.Rejected) == "" {
+			return nil, fmt.Errorf("pair %d: prompt, chosen and rejected are required", i+1)
+		}
+		if p.Chosen == p.Rejected {
+			return nil, fmt.Errorf("pair %d: chosen and rejected are the same", i+1)
+		}
+	}
+	cfg.Method = MethodDPO
+
+	path, err := writeDataset(pairs)
+	if err != nil {
+		return nil, err
+	}
+	run, err := m.Prepare(ctx, baseModel, path, len(pairs), cfg)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	run.Sources = countSources(pairs)
+	if err := m.runStore.Save(run); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	return run, nil
+}
+
+// writeDataset saves entries as a new JSONL file in the datasets directory
+// and returns its path.
+func writeDataset[S any](entries []S) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return "", fmt.Errorf("encode dataset: %w", err)
+		}
+	}
+	dir := config.TrainingDatasetsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("dataset-%d.jsonl", time.Now().UnixNano()))
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write dataset: %w", err)
+	}
+	return path, nil
+}
+
+// countSources counts entries by Source; entries without one count as
+// "dataset".
+func countSources[S interface{ source() string }](entries []S) map[string]int {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		source := e.source()
+		if source == "" {
+			source = "dataset"
+		}
+		counts[source]++
+	}
+	return counts
+}
+
+// Configure changes the config of a pending run. patch is a JSON RunConfig
+// whose fields replace those of the run's config; fields it leaves out
+// keep their values.
+func (m *Manager) Configure(ctx context.Context, runID string, patch json.RawMessage) (*TrainingRun, error) {
+	run, err := m.runStore.Load(runID)
+	if err != nil {
+		return nil, fmt.Errorf("load run: %w", err)
+	}
+	if run.Status != StatusPending {
+		return nil, fmt.Errorf("run %s has status %s, expected %s", runID, run.Status, StatusPending)
+	}
+
+	cfg := run.Config
+	if err := json.Unmarshal(patch, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Method != run.Config.Method && (cfg.Method == MethodDPO || run.Config.Method == MethodDPO) {
+		return nil, fmt.Errorf("run %s cannot change method from %s to %s: the dataset is for the former", runID, run.Config.Method, cfg.Method)
+	}
+	run.Config = cfg
+	run.UpdatedAt = time.Now()
+	if err := m.runStore.Save(run); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	return run, nil
+}
+
 // Train starts a training job for the given run.
 func (m *Manager) Train(ctx context.Context, runID string) error {
 	run, err := m.runStore.Load(runID)
@@ -76,8 +208,18 @@ func (m *Manager) Train(ctx context.Context, runID string) error {
 
 	outputDir := filepath.Join(config.TrainingRunsDir(), runID)
 
+	datasetPath := run.DatasetPath
+	if run.Config.EvalSplit > 0 {
+		if datasetPath, run.EvalPath, err = splitDataset(run.DatasetPath, outputDir, run.Config.EvalSplit); err != nil {
+			return fmt.Errorf("split dataset: %w", err)
+		}
+	}
+	if datasetPath, err = m.client.stageDataset(ctx, runID+"-train.jsonl", datasetPath); err != nil {
+		return err
+	}
+
 	_, err = m.client.Train(ctx, TrainRequest{
-		DatasetPath:   run.DatasetPath,
+		DatasetPath:   datasetPath,
 		BaseModelPath: run.BaseModel,
 		OutputDir:     outputDir,
 		RunID:         runID,
@@ -86,6 +228,9 @@ func (m *Manager) Train(ctx context.Context, runID string) error {
 		LoraRank:      run.Config.LoraRank,
 		LoraAlpha:     run.Config.LoraAlpha,
 		BatchSize:     run.Config.BatchSize,
+		MaxSeqLength:  run.Config.MaxSeqLength,
+		Method:        run.Config.Method,
+		DPOBeta:       run.Config.DPOBeta,
 	})
 	if err != nil {
 		run.Status = StatusFailed
@@ -131,24 +276,34 @@ func (m *Manager) Status(ctx context.Context, runID string) (*TrainingRun, error
 	return run, nil
 }
 
-// Merge merges the LoRA adapter into the base model and converts to GGUF.
-func (m *Manager) Merge(ctx context.Context, runID string, outputName string) (string, error) {
+// trainedRun loads a run whose adapter has finished training, checking
+// with the sidecar if the run is still marked as training.
+func (m *Manager) trainedRun(ctx context.Context, runID, action string) (*TrainingRun, error) {
 	run, err := m.runStore.Load(runID)
 	if err != nil {
-		return "", fmt.Errorf("load run: %w", err)
+		return nil, fmt.Errorf("load run: %w", err)
 	}
 
 	if run.Status != StatusMerging && run.Status != StatusDone {
 		if run.Status == StatusTraining {
 			status, err := m.client.Status(ctx, runID)
 			if err != nil || status.Status != "done" {
-				return "", fmt.Errorf("run %s not ready for merge (status: %s)", runID, run.Status)
+				return nil, fmt.Errorf("run %s not ready for %s (status: %s)", runID, action, run.Status)
 			}
 			run.Status = StatusMerging
 		} else {
-			return "", fmt.Errorf("run %s has status %s, expected merging or done", runID, run.Status)
+			return nil, fmt.Errorf("run %s has status %s, expected merging or done", runID, run.Status)
 		}
 	}
+	return run, nil
+}
+
+// Merge merges the LoRA adapter into the base model and converts to GGUF.
+func (m *Manager) Merge(ctx context.Context, runID string, outputName string) (string, error) {
+	run, err := m.trainedRun(ctx, runID, "merge")
+	if err != nil {
+		return "", err
+	}
 
 	run.Status = StatusMerging
 	run.UpdatedAt = time.Now()
@@ -194,9 +349,46 @@ func (m *Manager) Merge(ctx context.Context, runID string, outputName string) (s
 	return ggufPath, nil
 }
 
-// List returns all training runs.
+// Deploy converts a run's LoRA adapter to GGUF, once, and loads it onto
+// model (the loaded model when ""), skipping the merge. It returns the path
+// of the GGUF adapter.
+func (m *Manager) Deploy(ctx context.Context, runID, model string) (string, error) {
+	if m.loadAdapter == nil {
+		return "", fmt.Errorf("no adapter loader configured")
+	}
+
+	run, err := m.trainedRun(ctx, runID, "deploy")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(run.AdapterGGUF); run.AdapterGGUF == "" || err != nil {
+		ggufPath := filepath.Join(config.TrainingRunsDir(), runID, "adapter.gguf")
+		if err := m.client.ConvertLora(ctx, ConvertLoraRequest{
+			AdapterDir:    run.AdapterDir,
+			BaseModelPath: run.BaseModel,
+			OutputPath:    ggufPath,
+		}); err != nil {
+			return "", fmt.Errorf("convert adapter: %w", err)
+		}
+		run.AdapterGGUF = ggufPath
+		run.UpdatedAt = time.Now()
+		m.runStore.Save(run)
+	}
+
+	if err := m.loadAdapter(ctx, model, run.AdapterGGUF, 1); err != nil {
+		return "", fmt.Errorf("load adapter: %w", err)
+	}
+	return run.AdapterGGUF, nil
+}
+
+// List returns all training runs with their disk usage.
 func (m *Manager) List(ctx context.Context) ([]*TrainingRun, error) {
-	return m.runStore.List()
+	runs, err := m.runStore.List()
+	for _, run := range runs {
+		run.DiskBytes = m.diskUsage(run)
+	}
+	return runs, err
 }
 
 // Delete removes a training run and its artifacts.
@@ -0,0 +1,71 @@
+package training
+
+import (
+	"context"
+	"time"
+)
+
+// Follow reports a run's progress to fn every interval while it waits to
+// train or trains, and once more when it stops. A report is only made when
+// the run has moved on; it carries the loss points logged since the
+// previous one, so the first has the whole curve so far.
+func (m *Manager) Follow(ctx context.Context, runID string, interval time.Duration, fn func(Progress)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last Progress
+	reported := false
+	for {
+		run, err := m.Status(ctx, runID)
+		if err != nil {
+			return err
+		}
+		p := progressOf(run, last)
+		if !reported || p.Step != last.Step || p.Status != last.Status {
+			fn(p)
+			last, reported = p, true
+		}
+		if run.Status != StatusPending && run.Status != StatusPreparing && run.Status != StatusTraining {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// progressOf describes run's progress after the report prev. A finished
+// run's final metrics lack step counts, so those of prev stand.
+func progressOf(run *TrainingRun, prev Progress) Progress {
+	mt := run.Metrics
+	p := Progress{
+		RunID:    run.ID,
+		Status:   run.Status,
+		Step:     mt.Step,
+		MaxSteps: mt.MaxSteps,
+		Progress: mt.Progress,
+		Loss:     mt.TrainLoss,
+		Error:    run.Error,
+	}
+	if p.Step == 0 && prev.Step > 0 {
+		p.Step, p.MaxSteps = prev.Step, prev.MaxSteps
+	}
+	if run.Status == StatusMerging || run.Status == StatusDone {
+		p.Progress = 1
+	}
+	for _, pt := range mt.LossHistory {
+		if pt.Step > prev.Step || prev.RunID == "" {
+			p.Losses = append(p.Losses, pt)
+		}
+	}
+	if d, err := time.ParseDuration(mt.Duration); err == nil {
+		p.Elapsed = d.Seconds()
+		if p.Progress > 0 && p.Progress < 1 {
+			p.ETA = p.Elapsed * (1 - p.Progress) / p.Progress
+		}
+	}
+	return p
+}
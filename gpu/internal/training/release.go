@@ -0,0 +1,219 @@
+package training
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/config"
+	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
+)
+
+// ModelHost is the model server Release puts a new model version on.
+type ModelHost interface {
+	// LoadModel loads a model by name, alias or path in place of the
+	// loaded one.
+	LoadModel(ctx context.Context, name string) error
+	// LoadedModel returns the path of the loaded model, or "" if none is.
+	LoadedModel() string
+	// Ask returns the loaded model's reply to a single user message.
+	Ask(ctx context.Context, prompt string) (string, error)
+}
+
+// SetModelHost sets where Release loads and checks new model versions.
+func (m *Manager) SetModelHost(host ModelHost) {
+	m.host = host
+}
+
+// SmokeChecksFile, in the training directory, holds the checks Release
+// runs when given none, as a JSON array of EvalCheck.
+const SmokeChecksFile = "smoke.json"
+
+// DefaultSmokeChecks are run when neither the request nor SmokeChecksFile
+// gives any: the model must still follow a trivial instruction.
+var DefaultSmokeChecks = []EvalCheck{{Prompt: "Reply with the single word OK.", Expected: "ok"}}
+
+// ReleaseOptions configures Release.
+type ReleaseOptions struct {
+	// Name is the model family: versions are aliased Name@v1, Name@v2 and
+	// so on, and Name points at the live one. It defaults to the base
+	// model's name with "-ft".
+	Name   string      `json:"name,omitempty"`
+	Checks []EvalCheck `json:"checks,omitempty"`
+}
+
+// Release records a run's release as a model version.
+type Release struct {
+	Model      string        `json:"model"`   // registry name of the merged GGUF
+	Family     string        `json:"family"`  // alias of the live version
+	Version    int           `json:"version"` // Alias is Family@vVersion
+	Alias      string        `json:"alias"`
+	Previous   string        `json:"previous,omitempty"` // model Family pointed at before
+	Checks     []SmokeResult `json:"checks,omitempty"`
+	Live       bool          `json:"live"`                  // loaded, passed its checks and now Family
+	RolledBack bool          `json:"rolled_back,omitempty"` // Family and the loaded model were restored
+	Error      string        `json:"error,omitempty"`
+	ReleasedAt time.Time     `json:"released_at"`
+}
+
+// SmokeResult is how a released model answered a smoke check.
+type SmokeResult struct {
+	EvalCheck
+	Answer string `json:"answer"`
+	Passed bool   `json:"passed"`
+}
+
+// Release makes a trained run the live version of a model family: it
+// merges the adapter into a GGUF (unless the run was merged already),
+// registers it under the next versioned alias with the previous version's
+// metadata, points the family alias at it, loads it and runs the smoke
+// checks. If it fails to load or a check fails, the family alias and the
+// previously loaded model are restored. Either way the outcome is stored
+// in the run's Release; an error is returned only when nothing was
+// changed or the rollback failed.
+func (m *Manager) Release(ctx context.Context, runID string, opts ReleaseOptions) (*TrainingRun, error) {
+	if m.host == nil {
+		return nil, fmt.Errorf("no model host configured; releases need the llama.cpp backend")
+	}
+	run, err := m.trainedRun(ctx, runID, "release")
+	if err != nil {
+		return nil, err
+	}
+	family := opts.Name
+	if family == "" {
+		family = strings.ToLower(filepath.Base(strings.TrimRight(run.BaseModel, "/"))) + "-ft"
+	}
+	if strings.ContainsAny(family, `@/\`) {
+		return nil, fmt.Errorf("invalid model name %q: it may not contain @, / or \\", family)
+	}
+	checks := opts.Checks
+	if len(checks) == 0 {
+		if checks, err = smokeChecks(); err != nil {
+			return nil, err
+		}
+	}
+	store := models.NewStore(m.modelsDir)
+	version, err := store.NextVersion(family)
+	if err != nil {
+		return nil, err
+	}
+	rel := &Release{Family: family, Version: version, Alias: fmt.Sprintf("%s@v%d", family, version)}
+
+	path := run.OutputModel
+	if _, err := os.Stat(path); path == "" || err != nil {
+		if path, err = m.Merge(ctx, runID, fmt.Sprintf("%s-v%d.gguf", family, version)); err != nil {
+			return nil, err
+		}
+		if run, err = m.runStore.Load(runID); err != nil {
+			return nil, fmt.Errorf("load run: %w", err)
+		}
+	}
+	rel.Model = models.ModelName(path)
+
+	if err := inheritMetadata(store, family, rel.Model); err != nil {
+		return nil, fmt.Errorf("register model: %w", err)
+	}
+	if _, err := store.SetAlias(rel.Alias, rel.Model); err != nil {
+		return nil, fmt.Errorf("register model: %w", err)
+	}
+	if rel.Previous, err = store.SetAlias(family, rel.Model); err != nil {
+		return nil, fmt.Errorf("register model: %w", err)
+	}
+
+	loaded := m.host.LoadedModel()
+	failure := ""
+	if err := m.host.LoadModel(ctx, rel.Alias); err != nil {
+		failure = fmt.Sprintf("load %s: %v", rel.Alias, err)
+	} else {
+		for _, c := range checks {
+			res := SmokeResult{EvalCheck: c}
+			answer, err := m.host.Ask(ctx, c.Prompt)
+			if err != nil {
+				res.Answer = "error: " + err.Error()
+			} else {
+				res.Answer = answer
+				res.Passed = strings.TrimSpace(answer) != "" && passes(answer, c.Expected)
+			}
+			if !res.Passed && failure == "" {
+				failure = fmt.Sprintf("smoke check %q failed", c.Prompt)
+			}
+			rel.Checks = append(rel.Checks, res)
+		}
+	}
+
+	var rollbackErr error
+	if failure == "" {
+		rel.Live = true
+	} else {
+		rel.Error = failure
+		rel.RolledBack = true
+		if _, err := store.SetAlias(family, rel.Previous); err != nil {
+			rollbackErr = fmt.Errorf("restore alias %s: %w", family, err)
+		}
+		if loaded != "" {
+			if err := m.host.LoadModel(ctx, loaded); err != nil {
+				rollbackErr = errors.Join(rollbackErr, fmt.Errorf("reload %s: %w", models.ModelName(loaded), err))
+			}
+		}
+		if rollbackErr != nil {
+			rel.Error += "; rollback failed: " + rollbackErr.Error()
+		}
+	}
+
+	rel.ReleasedAt = time.Now()
+	run.Release = rel
+	run.UpdatedAt = rel.ReleasedAt
+	if err := m.runStore.Save(run); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	if rollbackErr != nil {
+		return run, fmt.Errorf("%s", rel.Error)
+	}
+	return run, nil
+}
+
+// inheritMetadata gives the new model, if it has no registry entry yet,
+// the metadata of the model the family alias points at, so a new version
+// loads with the same context size, template and sampling.
+func inheritMetadata(store *models.Store, family, model string) error {
+	previous, ok, err := store.ResolveAlias(family)
+	if err != nil || !ok {
+		return err
+	}
+	registry, err := store.Registry()
+	if err != nil {
+		return err
+	}
+	if _, ok := registry[model]; ok {
+		return nil
+	}
+	meta := registry[previous]
+	meta.Aliases = nil
+	registry[model] = meta
+	return store.SaveRegistry(registry)
+}
+
+// smokeChecks returns the checks of SmokeChecksFile, or DefaultSmokeChecks
+// if there is no such file.
+func smokeChecks() ([]EvalCheck, error) {
+	data, err := os.ReadFile(filepath.Join(config.TrainingDir(), SmokeChecksFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultSmokeChecks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checks []EvalCheck
+	if err := json.Unmarshal(data, &checks); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", SmokeChecksFile, err)
+	}
+	if len(checks) == 0 {
+		return DefaultSmokeChecks, nil
+	}
+	return checks, nil
+}
@@ -0,0 +1,187 @@
+package training
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/gpu/internal/models"
+)
+
+// RetentionPolicy bounds how much the training runs keep on disk. Zero
+// fields are not enforced.
+type RetentionPolicy struct {
+	KeepLast int   `json:"keep_last,omitempty"` // newest runs always kept
+	MaxBytes int64 `json:"max_bytes,omitempty"` // disk quota of all runs together
+}
+
+// Enabled reports whether the policy limits anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepLast > 0 || p.MaxBytes > 0
+}
+
+// SetRetention sets the policy GC applies when given none.
+func (m *Manager) SetRetention(p RetentionPolicy) {
+	m.retention = p
+}
+
+// Retention returns the policy set by SetRetention.
+func (m *Manager) Retention() RetentionPolicy {
+	return m.retention
+}
+
+// GCResult is what GC removed, or would remove on a dry run.
+type GCResult struct {
+	Policy    RetentionPolicy `json:"policy"`
+	Removed   []RemovedRun    `json:"removed"`
+	Freed     int64           `json:"freed"`
+	Kept      int             `json:"kept"`
+	Used      int64           `json:"used"`                 // bytes the kept runs use
+	OverQuota bool            `json:"over_quota,omitempty"` // runs GC may not remove still exceed MaxBytes
+	DryRun    bool            `json:"dry_run,omitempty"`
+}
+
+// RemovedRun is a run GC removed.
+type RemovedRun struct {
+	ID        string    `json:"id"`
+	Status    RunStatus `json:"status"`
+	DiskBytes int64     `json:"disk_bytes"`
+	Reason    string    `json:"reason"` // "keep_last" or "max_bytes"
+}
+
+// diskUsage returns the bytes a run's artifacts take: its directory with
+// checkpoints and the merged model, its dataset and its output GGUF.
+func (m *Manager) diskUsage(run *TrainingRun) int64 {
+	dir := m.runStore.runDir(run.ID)
+	total := dirSize(dir)
+	for _, path := range []string{run.DatasetPath, run.OutputModel} {
+		if path == "" || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// GC removes the runs policy (the one set by SetRetention when zero) does
+// not keep, oldest first: all but the newest KeepLast, then more until the
+// rest fit in MaxBytes. Runs that are pending or training are never
+// removed, nor are runs whose model is loaded or is the live version of
+// its family. Removing a run deletes its directory, dataset and output
+// GGUF and drops its versioned alias. With dryRun nothing is deleted.
+func (m *Manager) GC(ctx context.Context, policy RetentionPolicy, dryRun bool) (*GCResult, error) {
+	if !policy.Enabled() {
+		policy = m.retention
+	}
+	if !policy.Enabled() {
+		return nil, fmt.Errorf("no retention policy: set keep_last or max_bytes")
+	}
+	runs, err := m.runStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	store := models.NewStore(m.modelsDir)
+	loaded := ""
+	if m.host != nil {
+		loaded = m.host.LoadedModel()
+	}
+	res := &GCResult{Policy: policy, Removed: []RemovedRun{}, DryRun: dryRun}
+	var candidates []*TrainingRun // oldest last, as runs is newest first
+	sizes := make(map[string]int64, len(runs))
+	for i, run := range runs {
+		sizes[run.ID] = m.diskUsage(run)
+		res.Used += sizes[run.ID]
+		if policy.KeepLast > 0 && i < policy.KeepLast || m.inUse(store, run, loaded) {
+			continue
+		}
+		candidates = append(candidates, run)
+	}
+
+	remove := func(run *TrainingRun, reason string) error {
+		if !dryRun {
+			if err := m.removeRun(store, run); err != nil {
+				return fmt.Errorf("remove run %s: %w", run.ID, err)
+			}
+		}
+		res.Removed = append(res.Removed, RemovedRun{ID: run.ID, Status: run.Status, DiskBytes: sizes[run.ID], Reason: reason})
+		res.Freed += sizes[run.ID]
+		res.Used -= sizes[run.ID]
+		return nil
+	}
+	if policy.KeepLast > 0 {
+		for _, run := range candidates {
+			if err := remove(run, "keep_last"); err != nil {
+				return res, err
+			}
+		}
+		candidates = nil
+	}
+	for i := len(candidates) - 1; i >= 0 && policy.MaxBytes > 0 && res.Used > policy.MaxBytes; i-- {
+		if err := remove(candidates[i], "max_bytes"); err != nil {
+			return res, err
+		}
+	}
+	res.Kept = len(runs) - len(res.Removed)
+	res.OverQuota = policy.MaxBytes > 0 && res.Used > policy.MaxBytes
+	return res, nil
+}
+
+// inUse reports whether GC must keep run: it has not finished training,
+// or its model is loaded or is the live version of its family.
+func (m *Manager) inUse(store *models.Store, run *TrainingRun, loaded string) bool {
+	if run.Status == StatusPending || run.Status == StatusTraining {
+		return true
+	}
+	if run.OutputModel == "" {
+		return false
+	}
+	if loaded != "" && filepath.Clean(loaded) == filepath.Clean(run.OutputModel) {
+		return true
+	}
+	if run.Release != nil {
+		live, ok, err := store.ResolveAlias(run.Release.Family)
+		if err != nil || ok && live == run.Release.Model {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRun deletes a run with its dataset and output GGUF, dropping the
+// versioned alias a release gave the GGUF.
+func (m *Manager) removeRun(store *models.Store, run *TrainingRun) error {
+	if run.Release != nil {
+		if _, err := store.SetAlias(run.Release.Alias, ""); err != nil {
+			return err
+		}
+	}
+	if run.OutputModel != "" {
+		if err := os.Remove(run.OutputModel); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if run.DatasetPath != "" {
+		os.Remove(run.DatasetPath)
+	}
+	return m.runStore.Delete(run.ID)
+}
@@ -1,6 +1,7 @@
 package training
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/ThatCatDev/tanrenai/gpu/pkg/api"
@@ -18,35 +19,129 @@ const (
 	StatusFailed    RunStatus = "failed"
 )
 
+// Training methods a run can use (RunConfig.Method).
+const (
+	MethodSFT = "sft" // supervised fine-tuning on chat samples (DatasetEntry)
+	MethodDPO = "dpo" // direct preference optimization on PreferencePair
+)
+
 // RunConfig configures a training run.
 type RunConfig struct {
+	Method       string  `json:"method,omitempty"` // MethodSFT or MethodDPO; "" is MethodSFT
 	Epochs       int     `json:"epochs"`
 	LearningRate float64 `json:"learning_rate"`
 	LoraRank     int     `json:"lora_rank"`
 	LoraAlpha    int     `json:"lora_alpha"`
 	BatchSize    int     `json:"batch_size"`
+	MaxSeqLength int     `json:"max_seq_length,omitempty"` // cutoff length in tokens; longer samples are truncated
 	MaxSamples   int     `json:"max_samples"`
+	EvalSplit    float64 `json:"eval_split"`         // share of the dataset held out for Evaluate; 0 trains on all of it
+	DPOBeta      float64 `json:"dpo_beta,omitempty"` // how far DPO may move from the base model; 0 uses the sidecar's default
 }
 
 // DefaultRunConfig returns sensible defaults for fine-tuning.
 func DefaultRunConfig() RunConfig {
 	return RunConfig{
+		Method:       MethodSFT,
 		Epochs:       3,
 		LearningRate: 2e-4,
 		LoraRank:     16,
 		LoraAlpha:    32,
 		BatchSize:    2,
+		MaxSeqLength: 2048,
 		MaxSamples:   0, // 0 = use all available
+		EvalSplit:    0.1,
+		DPOBeta:      0.1,
 	}
 }
 
+// validate rejects configs the sidecar cannot train with. Zero values
+// are left to the sidecar's defaults, apart from those it has none for.
+func (c RunConfig) validate() error {
+	switch c.Method {
+	case "", MethodSFT, MethodDPO:
+	default:
+		return fmt.Errorf("unknown training method %q: want %s or %s", c.Method, MethodSFT, MethodDPO)
+	}
+	switch {
+	case c.Epochs < 1:
+		return fmt.Errorf("epochs must be at least 1")
+	case c.LearningRate <= 0:
+		return fmt.Errorf("learning_rate must be positive")
+	case c.LoraRank < 1:
+		return fmt.Errorf("lora_rank must be at least 1")
+	case c.LoraAlpha < 1:
+		return fmt.Errorf("lora_alpha must be at least 1")
+	case c.BatchSize < 1:
+		return fmt.Errorf("batch_size must be at least 1")
+	case c.MaxSeqLength < 0, c.MaxSamples < 0, c.DPOBeta < 0:
+		return fmt.Errorf("max_seq_length, max_samples and dpo_beta must not be negative")
+	case c.EvalSplit < 0 || c.EvalSplit >= 1:
+		return fmt.Errorf("eval_split must be at least 0 and below 1")
+	}
+	return nil
+}
+
 // RunMetrics contains training metrics.
 type RunMetrics struct {
-	TrainLoss   float64 `json:"train_loss,omitempty"`
-	EvalLoss    float64 `json:"eval_loss,omitempty"`
-	Duration    string  `json:"duration,omitempty"`
-	SamplesUsed int     `json:"samples_used,omitempty"`
-	Progress    float64 `json:"progress,omitempty"` // 0.0–1.0
+	TrainLoss   float64      `json:"train_loss,omitempty"`
+	EvalLoss    float64      `json:"eval_loss,omitempty"`
+	Duration    string       `json:"duration,omitempty"`
+	SamplesUsed int          `json:"samples_used,omitempty"`
+	Progress    float64      `json:"progress,omitempty"` // 0.0–1.0
+	Step        int          `json:"step,omitempty"`
+	MaxSteps    int          `json:"max_steps,omitempty"`
+	LossHistory []LossPoint  `json:"loss_history,omitempty"` // training loss at each logged step
+	Eval        *EvalMetrics `json:"eval,omitempty"`         // set by Evaluate
+}
+
+// LossPoint is the training loss logged at a step.
+type LossPoint struct {
+	Step int     `json:"step"`
+	Loss float64 `json:"loss"`
+}
+
+// Progress is a training run's progress, as Follow reports it.
+type Progress struct {
+	RunID    string      `json:"run_id"`
+	Status   RunStatus   `json:"status"`
+	Step     int         `json:"step"`
+	MaxSteps int         `json:"max_steps"`
+	Progress float64     `json:"progress"` // 0.0–1.0
+	Loss     float64     `json:"loss,omitempty"`
+	Losses   []LossPoint `json:"losses,omitempty"` // points logged since the previous report
+	Elapsed  float64     `json:"elapsed_seconds"`
+	ETA      float64     `json:"eta_seconds,omitempty"` // 0 until a step has finished
+	Error    string      `json:"error,omitempty"`
+}
+
+// EvalMetrics compares a run's adapter with its base model, to tell
+// whether it is worth merging and deploying.
+type EvalMetrics struct {
+	Samples         int           `json:"samples,omitempty"` // held-out entries the losses are over
+	BaseLoss        float64       `json:"base_loss,omitempty"`
+	TunedLoss       float64       `json:"tuned_loss,omitempty"`
+	BasePerplexity  float64       `json:"base_perplexity,omitempty"`
+	TunedPerplexity float64       `json:"tuned_perplexity,omitempty"`
+	Checks          []CheckResult `json:"checks,omitempty"`
+	BasePassed      int           `json:"base_passed"` // checks the base model passed
+	TunedPassed     int           `json:"tuned_passed"`
+	EvaluatedAt     time.Time     `json:"evaluated_at"`
+}
+
+// EvalCheck is a prompt whose answer must contain Expected, ignoring case.
+type EvalCheck struct {
+	Prompt   string `json:"prompt"`
+	Expected string `json:"expected"`
+}
+
+// CheckResult is how the base and fine-tuned models answered an EvalCheck.
+type CheckResult struct {
+	EvalCheck
+	BaseAnswer  string `json:"base_answer"`
+	TunedAnswer string `json:"tuned_answer"`
+	BasePassed  bool   `json:"base_passed"`
+	TunedPassed bool   `json:"tuned_passed"`
 }
 
 // TrainingRun represents a single fine-tuning run.
@@ -59,12 +154,39 @@ type TrainingRun struct {
 	Config      RunConfig  `json:"config"`
 	Metrics     RunMetrics `json:"metrics"`
 	DatasetPath string     `json:"dataset_path,omitempty"`
-	AdapterDir  string     `json:"adapter_dir,omitempty"`
-	OutputModel string     `json:"output_model,omitempty"`
-	Error       string     `json:"error,omitempty"`
+	EvalPath    string     `json:"eval_path,omitempty"` // held-out slice of the dataset, split off by Train
+	// Sources counts the dataset's samples by DatasetEntry.Source.
+	Sources     map[string]int `json:"sources,omitempty"`
+	AdapterDir  string         `json:"adapter_dir,omitempty"`
+	AdapterGGUF string         `json:"adapter_gguf,omitempty"` // adapter converted for llama-server by Deploy
+	OutputModel string         `json:"output_model,omitempty"`
+	Release     *Release       `json:"release,omitempty"` // set by Release
+	Error       string         `json:"error,omitempty"`
+	DiskBytes   int64          `json:"disk_bytes,omitempty"` // filled in by List
 }
 
-// DatasetEntry is a single training sample in ChatML format.
+// DatasetEntry is a single training sample in ChatML format. Source and
+// Ref record where it came from, e.g. "memory" and the memory's ID, or
+// "import:chats.jsonl" and the line it was on. A function-calling sample,
+// such as a recorded agent trajectory, has the tools its assistant
+// messages call and the tool messages with their results.
 type DatasetEntry struct {
 	Messages []api.Message `json:"messages"`
+	Tools    []api.Tool    `json:"tools,omitempty"`
+	Source   string        `json:"source,omitempty"`
+	Ref      string        `json:"ref,omitempty"`
 }
+
+func (e DatasetEntry) source() string { return e.Source }
+
+// PreferencePair is a DPO training sample: two replies to the same
+// conversation, e.g. an answer the user regenerated and the one they kept.
+type PreferencePair struct {
+	Prompt   []api.Message `json:"prompt"` // the conversation up to the reply
+	Chosen   string        `json:"chosen"`
+	Rejected string        `json:"rejected"`
+	Source   string        `json:"source,omitempty"`
+	Ref      string        `json:"ref,omitempty"`
+}
+
+func (p PreferencePair) source() string { return p.Source }
@@ -0,0 +1,112 @@
+package training
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// uploadChunkSize is how much of a dataset each upload request carries.
+const uploadChunkSize = 4 << 20
+
+// uploadedDataset is the sidecar's reply to dataset upload requests.
+type uploadedDataset struct {
+	Size int64  `json:"size"`
+	Path string `json:"path,omitempty"`
+}
+
+// stageDataset returns the path the sidecar reads the dataset at path
+// from: path itself, or for a remote sidecar the path it was uploaded to
+// under name.
+func (c *SidecarClient) stageDataset(ctx context.Context, name, path string) (string, error) {
+	if !c.upload || path == "" {
+		return path, nil
+	}
+	remote, err := c.UploadDataset(ctx, name, path)
+	if err != nil {
+		return "", fmt.Errorf("upload %s: %w", name, err)
+	}
+	return remote, nil
+}
+
+// UploadDataset sends the file at path to the sidecar as name, in chunks
+// of uploadChunkSize. An upload that was cut off resumes where the sidecar
+// says it got to. The sidecar checks the size and SHA-256 of the whole
+// file before it keeps it, and returns the path it saved it at.
+func (c *SidecarClient) UploadDataset(ctx context.Context, name, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	var state uploadedDataset
+	if err := c.get(ctx, "/datasets/"+url.PathEscape(name), &state); err != nil {
+		return "", err
+	}
+	offset := state.Size
+	if offset > size {
+		offset = 0 // a different, larger file was left behind; start over
+	}
+	buf := make([]byte, uploadChunkSize)
+	for offset < size {
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if offset, err = c.putChunk(ctx, name, offset, buf[:n]); err != nil {
+			return "", err
+		}
+	}
+
+	var done uploadedDataset
+	if err := c.post(ctx, "/datasets/"+url.PathEscape(name)+"/complete", map[string]any{
+		"size":   size,
+		"sha256": hex.EncodeToString(h.Sum(nil)),
+	}, &done); err != nil {
+		return "", err
+	}
+	return done.Path, nil
+}
+
+// putChunk writes data at offset of the named upload and returns the size
+// the sidecar now has.
+func (c *SidecarClient) putChunk(ctx context.Context, name string, offset int64, data []byte) (int64, error) {
+	u := c.baseURL + "/datasets/" + url.PathEscape(name) + "?offset=" + strconv.FormatInt(offset, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, fmt.Errorf("send chunk: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("sidecar returned %d: %s", resp.StatusCode, string(body))
+	}
+	var state uploadedDataset
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	if state.Size != offset+int64(len(data)) {
+		return 0, fmt.Errorf("sidecar has %d bytes of %s after a chunk ending at %d", state.Size, name, offset+int64(len(data)))
+	}
+	return state.Size, nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Error codes carried in ErrorDetail.Code. Clients branch on these rather
+// than on message text.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict" // the resource changed since the client last read it
+	CodeForbidden          = "forbidden"
+	CodeModelNotLoaded     = "model_not_loaded"
+	CodeModelError         = "model_error" // a model failed to load
+	CodeContextExceeded    = "context_exceeded"
+	CodeInferenceError     = "inference_error"
+	CodeTokenizeError      = "tokenize_error"
+	CodeEmbeddingError     = "embedding_error"
+	CodeNoEmbedding        = "no_embedding" // no embedding model configured
+	CodeTranscriptionError = "transcription_error"
+	CodeNoTranscription    = "no_transcription" // no whisper model configured
+	CodeFinetuneError      = "finetune_error"
+	CodeGPUUnavailable     = "gpu_unavailable"
+	CodeGPUError           = "gpu_error" // the GPU server could not be reached or failed
+	CodeMemoryError        = "memory_error"
+	CodeInstanceError      = "instance_error"
+	CodeToolDenied         = "tool_denied"
+	CodeAgentError         = "agent_error"
+	CodeCancelled          = "cancelled"
+	CodeInternalError      = "internal_error"
+)
+
+// Error is an API error as a Go error. Servers send it as an ErrorResponse
+// and clients decode error responses back into it, so callers can use
+// errors.As or IsCode instead of matching message text.
+type Error struct {
+	Status  int // HTTP status; 0 for errors sent inside a stream
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError returns an Error with the given status, code and message.
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Response returns e in the wire format.
+func (e *Error) Response() ErrorResponse {
+	return ErrorResponse{Error: ErrorDetail{Message: e.Message, Type: errorType(e.Status), Code: e.Code}}
+}
+
+// IsCode reports whether err is, or wraps, an *Error with the given code.
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// DecodeError turns an error response body into an *Error. It accepts this
+// API's ErrorResponse as well as llama-server's variant, whose numeric code
+// leaves the machine-readable kind in "type". Bodies that are not JSON
+// become the message, with a code guessed from the status.
+func DecodeError(status int, body []byte) *Error {
+	var resp struct {
+		Error struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	e := &Error{Status: status}
+	if json.Unmarshal(body, &resp) == nil && resp.Error.Message != "" {
+		e.Message = resp.Error.Message
+		if json.Unmarshal(resp.Error.Code, &e.Code) != nil || e.Code == "" {
+			e.Code = resp.Error.Type
+		}
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+	}
+	if e.Code == "" || e.Code == "error" {
+		e.Code = codeForStatus(status)
+	}
+	return e
+}
+
+// errorType is the OpenAI-style error category for an HTTP status.
+func errorType(status int) string {
+	if status >= 400 && status < 500 {
+		return "invalid_request_error"
+	}
+	return "server_error"
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusConflict:
+		return CodeConflict
+	case status == http.StatusServiceUnavailable:
+		return CodeGPUUnavailable
+	case status >= 400 && status < 500:
+		return CodeInvalidRequest
+	}
+	return CodeInternalError
+}
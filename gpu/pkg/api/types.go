@@ -1,6 +1,9 @@
 package api
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 // Message represents a chat message.
 type Message struct {
@@ -9,6 +12,86 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	Name       string     `json:"name,omitempty"`
+	// ReasoningContent is the thinking of reasoning models, kept apart from
+	// Content so that it is neither shown as the reply nor sent back.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Images are image URLs, usually base64 data URIs, sent along with
+	// Content to multimodal models. A message with images goes over the
+	// wire with its content as typed parts.
+	Images []string `json:"-"`
+}
+
+// ContentPart is one part of a multimodal message's content, as in the
+// OpenAI API: text or an image.
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL points to an image: an http(s) URL or a data URI such as
+// "data:image/png;base64,...".
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// Parts returns the message content as typed parts: the text, then the
+// images.
+func (m Message) Parts() []ContentPart {
+	var parts []ContentPart
+	if m.Content != "" {
+		parts = append(parts, ContentPart{Type: "text", Text: m.Content})
+	}
+	for _, url := range m.Images {
+		parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}})
+	}
+	return parts
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []ContentPart `json:"content"`
+	}{plain(m), m.Parts()})
+}
+
+// UnmarshalJSON accepts content as a string or as typed parts. Text parts
+// are joined into Content, image parts go to Images.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var msg struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = Message(msg.plain)
+	if len(msg.Content) == 0 || string(msg.Content) == "null" {
+		return nil
+	}
+	if msg.Content[0] == '"' {
+		return json.Unmarshal(msg.Content, &m.Content)
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(msg.Content, &parts); err != nil {
+		return err
+	}
+	var text []string
+	for _, p := range parts {
+		switch {
+		case p.Type == "text":
+			text = append(text, p.Text)
+		case p.Type == "image_url" && p.ImageURL != nil:
+			m.Images = append(m.Images, p.ImageURL.URL)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
 }
 
 // Tool represents a tool available for the model to call.
@@ -56,6 +139,30 @@ type ChatCompletionRequest struct {
 	Stop        []string  `json:"stop,omitempty"`
 	Tools       []Tool    `json:"tools,omitempty"`
 	ToolChoice  any       `json:"tool_choice,omitempty"`
+
+	// Sampling parameters llama-server accepts beyond OpenAI's. Unset ones
+	// use the model's defaults from the registry, or llama-server's.
+	TopK          *int     `json:"top_k,omitempty"`
+	MinP          *float64 `json:"min_p,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+
+	// LogitBias adds a bias to the logits of the given token IDs (as
+	// decimal strings); -100 bans a token, 100 forces it.
+	LogitBias map[string]float64 `json:"logit_bias,omitempty"`
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	// SessionID groups requests that resend a growing conversation, such as
+	// the iterations of an agent turn. The GPU server keeps a session on one
+	// llama-server slot so its prompt prefix stays in the KV cache.
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// StreamOptions controls optional fields in streamed responses.
+type StreamOptions struct {
+	// IncludeUsage asks the backend to send token usage in the final chunk.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatCompletionResponse matches the OpenAI chat completions response schema.
@@ -82,6 +189,7 @@ type ChatCompletionChunk struct {
 	Created int64         `json:"created"`
 	Model   string        `json:"model"`
 	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"` // set on the final chunk only
 }
 
 // ChunkChoice is a single choice within a streaming chunk.
@@ -96,6 +204,8 @@ type MessageDelta struct {
 	Role      string          `json:"role,omitempty"`
 	Content   string          `json:"content,omitempty"`
 	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+	// ReasoningContent is set when llama-server separates the reasoning.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // Usage contains token usage information.
@@ -105,12 +215,77 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// StreamStatusWarmingUp is reported while a model is loaded for a
+// streaming request, e.g. after it was unloaded for being idle.
+const StreamStatusWarmingUp = "warming_up"
+
+// StreamStatus is the data of a "status" event in a chat completion stream,
+// sent before the first chunk when the request has to wait for the model.
+type StreamStatus struct {
+	Status string `json:"status"` // warming_up
+	Model  string `json:"model,omitempty"`
+}
+
 // ModelInfo represents a model in the /v1/models response.
 type ModelInfo struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	Metadata *ModelMetadata `json:"metadata,omitempty"` // from the model registry
+}
+
+// ModelMetadata is a model's entry in the model registry, models.json in
+// the models directory.
+type ModelMetadata struct {
+	Aliases      []string        `json:"aliases,omitempty"`       // other names it resolves from, e.g. "coder"
+	CtxSize      int             `json:"ctx_size,omitempty"`      // context length to load it with
+	ChatTemplate string          `json:"chat_template,omitempty"` // chat template family, e.g. "qwen2.5"
+	Sampling     *SamplingParams `json:"sampling,omitempty"`      // recommended sampling defaults
+	Flags        []string        `json:"flags,omitempty"`         // extra llama-server flags
+	MMProj       string          `json:"mmproj,omitempty"`        // multimodal projector GGUF, enables image input
+}
+
+// SamplingParams are sampling defaults; requests can still override them.
+type SamplingParams struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	MinP          *float64 `json:"min_p,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+}
+
+// ServerInfo is the response for GET /api/info: the loaded model and what
+// the server can do, for clients to size their context and pick features.
+type ServerInfo struct {
+	Version string `json:"version"`
+	// Model is the model loaded last, by name; Loaded is false once it
+	// has been unloaded when idle, and the next request reloads it.
+	Model      string   `json:"model,omitempty"`
+	Loaded     bool     `json:"loaded"`
+	CtxSize    int      `json:"ctx_size,omitempty"`    // context length Model runs with
+	ToolFormat string   `json:"tool_format,omitempty"` // as in LoadModelResponse
+	Features   []string `json:"features"`              // Feature* values
+}
+
+// Features a server reports in ServerInfo.
+const (
+	FeatureTools         = "tools"         // the model's chat template takes tools
+	FeatureVision        = "vision"        // the model takes images
+	FeatureEmbeddings    = "embeddings"    // an embedding model is configured
+	FeatureTranscription = "transcription" // a whisper model is configured
+	FeatureFinetune      = "finetune"      // a training sidecar is configured
+)
+
+// LoadModelResponse is the response for POST /api/load.
+type LoadModelResponse struct {
+	Status     string         `json:"status"`
+	Model      string         `json:"model"`                 // as requested, possibly an alias
+	Name       string         `json:"name"`                  // the model it resolved to
+	CtxSize    int            `json:"ctx_size"`              // context length it was loaded with
+	ToolFormat string         `json:"tool_format,omitempty"` // tool-calling format of its chat template: hermes, qwen, llama3 or mistral
+	Metadata   *ModelMetadata `json:"metadata,omitempty"`    // from the model registry
 }
 
 // ModelListResponse is the response for GET /v1/models.
@@ -119,6 +294,47 @@ type ModelListResponse struct {
 	Data   []ModelInfo `json:"data"`
 }
 
+// LoraAdapter is a GGUF LoRA adapter applied on top of the loaded model.
+type LoraAdapter struct {
+	Path  string  `json:"path"`
+	Scale float64 `json:"scale"`
+}
+
+// AdapterLoadRequest is the request for POST /api/adapters/load.
+type AdapterLoadRequest struct {
+	Path  string   `json:"path"`            // GGUF adapter file
+	Scale *float64 `json:"scale,omitempty"` // default 1
+	Model string   `json:"model,omitempty"` // base model to load first; default the loaded one
+}
+
+// AdapterUnloadRequest is the request for POST /api/adapters/unload.
+type AdapterUnloadRequest struct {
+	Path string `json:"path"`
+}
+
+// AdaptersResponse lists the adapters applied to the model after a load or
+// unload.
+type AdaptersResponse struct {
+	Model    string        `json:"model"`
+	Adapters []LoraAdapter `json:"adapters"`
+}
+
+// MetricsResponse is the response for GET /api/metrics.
+type MetricsResponse struct {
+	Model       string           `json:"model,omitempty"` // "" when no model is loaded
+	PromptCache PromptCacheStats `json:"prompt_cache"`
+}
+
+// PromptCacheStats describes how much of the prompts sent since the model
+// was loaded was served from llama-server's KV cache.
+type PromptCacheStats struct {
+	Slots        int     `json:"slots"`
+	Requests     int64   `json:"requests"`
+	PromptTokens int64   `json:"prompt_tokens"` // prompt tokens evaluated
+	CachedTokens int64   `json:"cached_tokens"` // prompt tokens reused from the cache
+	HitRatio     float64 `json:"hit_ratio"`
+}
+
 // ErrorResponse is the standard error response.
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
@@ -133,8 +349,40 @@ type ErrorDetail struct {
 
 // EmbeddingRequest is the request for POST /v1/embeddings.
 type EmbeddingRequest struct {
-	Input string `json:"input"`
-	Model string `json:"model"`
+	Input EmbeddingInput `json:"input"`
+	Model string         `json:"model"`
+}
+
+// EmbeddingInput is the "input" field of an embedding request. It accepts
+// either a single string or an array of strings, as the OpenAI API does, and
+// marshals a single input back to a plain string.
+type EmbeddingInput []string
+
+func (in *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*in = EmbeddingInput{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*in = many
+	return nil
+}
+
+func (in EmbeddingInput) MarshalJSON() ([]byte, error) {
+	if len(in) == 1 {
+		return json.Marshal(in[0])
+	}
+	return json.Marshal([]string(in))
+}
+
+// TranscriptionResponse is the response for POST /v1/audio/transcriptions,
+// which takes the audio as a multipart "file" field.
+type TranscriptionResponse struct {
+	Text string `json:"text"`
 }
 
 // EmbeddingResponse is the response for POST /v1/embeddings.
@@ -147,3 +395,50 @@ type EmbeddingData struct {
 	Embedding []float32 `json:"embedding"`
 	Index     int       `json:"index"`
 }
+
+// Model download types
+
+// PullProgress is one SSE event emitted by POST /api/pull.
+type PullProgress struct {
+	Status     string `json:"status"` // resolving, downloading, downloaded, error
+	Downloaded int64  `json:"downloaded,omitempty"`
+	Total      int64  `json:"total,omitempty"`
+	Percent    int    `json:"percent,omitempty"`
+	Path       string `json:"path,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// LocalModel is a downloaded model file and what its GGUF metadata says
+// about it.
+type LocalModel struct {
+	Name          string         `json:"name"`
+	Size          int64          `json:"size"`
+	ModifiedAt    int64          `json:"modified_at"`
+	Architecture  string         `json:"architecture,omitempty"`
+	SizeLabel     string         `json:"size_label,omitempty"`     // parameter count, e.g. "7B"
+	Quant         string         `json:"quant,omitempty"`          // e.g. "Q4_K_M"
+	ContextLength int            `json:"context_length,omitempty"` // context length the model was trained for
+	ChatTemplate  string         `json:"chat_template,omitempty"`  // embedded template; only when inspecting one model
+	Loaded        bool           `json:"loaded,omitempty"`
+	Metadata      *ModelMetadata `json:"metadata,omitempty"` // from the model registry
+	Error         string         `json:"error,omitempty"`    // why the GGUF metadata could not be read
+}
+
+// LocalModelsResponse is the response for GET /api/models.
+type LocalModelsResponse struct {
+	Models []LocalModel `json:"models"`
+}
+
+// PartialDownload is an interrupted download that can be resumed.
+type PartialDownload struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+}
+
+// PartialDownloadsResponse is the response for GET /api/pull/partial, and
+// lists the removed downloads for DELETE /api/pull/partial.
+type PartialDownloadsResponse struct {
+	Partials []PartialDownload `json:"partials"`
+}
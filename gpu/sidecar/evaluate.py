@@ -0,0 +1,79 @@
+"""Evaluation of a LoRA adapter against its base model."""
+
+import math
+
+import torch
+from unsloth import FastLanguageModel
+from peft import PeftModel
+
+from train import load_dataset_from_jsonl
+
+
+def _mean_loss(model, tokenizer, texts: list[str]) -> float:
+    """Average per-token loss of model over texts."""
+    total, tokens = 0.0, 0
+    for text in texts:
+        enc = tokenizer(text, return_tensors="pt", truncation=True, max_length=2048).to(model.device)
+        n = enc["input_ids"].shape[1] - 1
+        if n <= 0:
+            continue
+        with torch.no_grad():
+            out = model(**enc, labels=enc["input_ids"])
+        total += out.loss.item() * n
+        tokens += n
+    return total / tokens if tokens else math.nan
+
+
+def _answer(model, tokenizer, prompt: str, max_new_tokens: int) -> str:
+    """Greedy reply to prompt, in the chat format the adapter was trained on."""
+    text = f"<|user|>\n{prompt}</s>\n<|assistant|>\n"
+    enc = tokenizer(text, return_tensors="pt").to(model.device)
+    with torch.no_grad():
+        out = model.generate(**enc, max_new_tokens=max_new_tokens, do_sample=False)
+    return tokenizer.decode(out[0][enc["input_ids"].shape[1]:], skip_special_tokens=True).strip()
+
+
+def run_evaluation(
+    base_model: str,
+    adapter_dir: str,
+    dataset_path: str = "",
+    checks: list[dict] | None = None,
+    max_new_tokens: int = 256,
+) -> dict:
+    """Score a LoRA adapter against its base model.
+
+    Args:
+        base_model: Path to base model (HF format or local path).
+        adapter_dir: Directory of the trained LoRA adapter.
+        dataset_path: Held-out JSONL to compute the losses over; optional.
+        checks: Prompts ({"prompt", "expected"}) both models answer.
+        max_new_tokens: Length limit of each answer.
+
+    Returns:
+        Dictionary with the sample count, base and tuned losses, and the
+        answers to checks in order.
+    """
+    model, tokenizer = FastLanguageModel.from_pretrained(
+        model_name=base_model,
+        max_seq_length=2048,
+        load_in_4bit=True,
+    )
+    model = PeftModel.from_pretrained(model, adapter_dir)
+    FastLanguageModel.for_inference(model)
+
+    result = {"samples": 0, "base_loss": 0.0, "tuned_loss": 0.0, "answers": []}
+
+    if dataset_path:
+        texts = load_dataset_from_jsonl(dataset_path)["text"]
+        result["samples"] = len(texts)
+        with model.disable_adapter():
+            result["base_loss"] = _mean_loss(model, tokenizer, texts)
+        result["tuned_loss"] = _mean_loss(model, tokenizer, texts)
+
+    for check in checks or []:
+        with model.disable_adapter():
+            base = _answer(model, tokenizer, check["prompt"], max_new_tokens)
+        tuned = _answer(model, tokenizer, check["prompt"], max_new_tokens)
+        result["answers"].append({"base": base, "tuned": tuned})
+
+    return result
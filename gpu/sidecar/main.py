@@ -1,19 +1,39 @@
-"""FastAPI sidecar for fine-tuning via Unsloth."""
+"""FastAPI sidecar for fine-tuning via Unsloth.
 
+Run on another machine than the GPU server, set TANRENAI_SIDECAR_TOKEN so
+that every request but /health needs it as a bearer token, and serve it
+over TLS with uvicorn's --ssl-certfile and --ssl-keyfile. Such a GPU
+server uploads datasets to /datasets rather than passing their paths.
+"""
+
+import hashlib
+import hmac
 import json
 import os
+import re
 import threading
 import uuid
 from pathlib import Path
 from typing import Optional
 
-from fastapi import FastAPI, HTTPException
+from fastapi import FastAPI, HTTPException, Request
+from fastapi.responses import JSONResponse
 from pydantic import BaseModel
 
+from evaluate import run_evaluation
 from train import run_training
 
 app = FastAPI(title="Tanrenai Training Sidecar")
 
+_token = os.environ.get("TANRENAI_SIDECAR_TOKEN", "")
+
+# Uploaded datasets live here, as <name>.part until complete.
+_datasets_dir = Path(
+    os.environ.get("TANRENAI_SIDECAR_DATA")
+    or Path.home() / ".local" / "share" / "tanrenai" / "sidecar"
+) / "datasets"
+_dataset_name = re.compile(r"^[A-Za-z0-9][A-Za-z0-9._-]*$")
+
 # Global state: only one training job at a time.
 _current_run: Optional[str] = None
 _lock = threading.Lock()
@@ -30,6 +50,9 @@ class TrainRequest(BaseModel):
     lora_rank: int = 16
     lora_alpha: int = 32
     batch_size: int = 4
+    max_seq_length: int = 2048
+    method: str = "sft"  # "sft" or "dpo"
+    dpo_beta: float = 0.1
 
 
 class MergeRequest(BaseModel):
@@ -44,11 +67,108 @@ class ConvertRequest(BaseModel):
     quantization: str = "Q4_K_M"
 
 
+class ConvertLoraRequest(BaseModel):
+    adapter_dir: str
+    base_model_path: str
+    output_path: str
+
+
+class EvalCheck(BaseModel):
+    prompt: str
+    expected: str = ""
+
+
+class EvaluateRequest(BaseModel):
+    base_model_path: str
+    adapter_dir: str
+    dataset_path: str = ""
+    checks: list[EvalCheck] = []
+
+
+def _find_llama_script(name: str) -> str:
+    """Find one of llama.cpp's conversion scripts in common locations."""
+    search_paths = [
+        Path.home() / ".local" / "share" / "tanrenai" / "bin" / name,
+        Path("/usr/local/bin") / name,
+        Path(name),
+    ]
+    for p in search_paths:
+        if p.exists():
+            return str(p)
+    raise FileNotFoundError(
+        f"{name} not found. "
+        "Place it in ~/.local/share/tanrenai/bin/"
+    )
+
+
 @app.get("/health")
 def health():
     return {"status": "ok"}
 
 
+@app.middleware("http")
+async def require_token(request: Request, call_next):
+    """Reject requests without the bearer token, when one is set."""
+    if _token and request.url.path != "/health":
+        expected = f"Bearer {_token}".encode()
+        if not hmac.compare_digest(request.headers.get("authorization", "").encode(), expected):
+            return JSONResponse(status_code=401, content={"detail": "missing or invalid bearer token"})
+    return await call_next(request)
+
+
+class CompleteUploadRequest(BaseModel):
+    size: int
+    sha256: str
+
+
+def _upload_path(name: str) -> Path:
+    if not _dataset_name.match(name):
+        raise HTTPException(status_code=400, detail=f"invalid dataset name {name!r}")
+    _datasets_dir.mkdir(parents=True, exist_ok=True)
+    return _datasets_dir / f"{name}.part"
+
+
+@app.get("/datasets/{name}")
+def upload_state(name: str):
+    """How much of an upload has arrived, so a cut-off one can resume."""
+    part = _upload_path(name)
+    return {"size": part.stat().st_size if part.exists() else 0}
+
+
+@app.put("/datasets/{name}")
+async def upload_chunk(name: str, offset: int, request: Request):
+    """Write a chunk of a dataset at offset; offset 0 starts over."""
+    part = _upload_path(name)
+    size = part.stat().st_size if part.exists() else 0
+    if offset != 0 and offset != size:
+        raise HTTPException(status_code=409, detail=f"offset {offset} does not match the {size} bytes received")
+    data = await request.body()
+    with open(part, "wb" if offset == 0 else "ab") as f:
+        f.write(data)
+    return {"size": offset + len(data)}
+
+
+@app.post("/datasets/{name}/complete")
+def complete_upload(name: str, req: CompleteUploadRequest):
+    """Check an upload's size and hash and keep it under its name."""
+    part = _upload_path(name)
+    if req.size == 0 and not part.exists():
+        part.touch()
+    if not part.exists():
+        raise HTTPException(status_code=404, detail=f"no upload named {name}")
+    h = hashlib.sha256()
+    with open(part, "rb") as f:
+        for block in iter(lambda: f.read(1 << 20), b""):
+            h.update(block)
+    size = part.stat().st_size
+    if size != req.size or h.hexdigest() != req.sha256.lower():
+        part.unlink()
+        raise HTTPException(status_code=422, detail=f"upload of {name} is corrupt ({size} bytes, expected {req.size}); send it again")
+    final = _datasets_dir / name
+    part.replace(final)
+    return {"size": size, "path": str(final)}
+
+
 @app.post("/train")
 def start_training(req: TrainRequest):
     global _current_run
@@ -75,6 +195,9 @@ def start_training(req: TrainRequest):
                 lora_rank=req.lora_rank,
                 lora_alpha=req.lora_alpha,
                 batch_size=req.batch_size,
+                max_seq_length=req.max_seq_length or 2048,
+                method=req.method or "sft",
+                dpo_beta=req.dpo_beta,
             )
             _runs[run_id] = {"status": "done", "metrics": metrics}
         except Exception as e:
@@ -132,29 +255,33 @@ def merge_adapter(req: MergeRequest):
         raise HTTPException(status_code=500, detail=str(e))
 
 
+@app.post("/evaluate")
+def evaluate_adapter(req: EvaluateRequest):
+    """Compare a LoRA adapter with its base model on held-out data and checks."""
+    with _lock:
+        if _current_run is not None:
+            raise HTTPException(
+                status_code=409,
+                detail=f"Training in progress: {_current_run}",
+            )
+    try:
+        return run_evaluation(
+            base_model=req.base_model_path,
+            adapter_dir=req.adapter_dir,
+            dataset_path=req.dataset_path,
+            checks=[c.model_dump() for c in req.checks],
+        )
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+
+
 @app.post("/convert")
 def convert_to_gguf(req: ConvertRequest):
     """Convert a merged model to GGUF format using llama.cpp's convert script."""
     import subprocess
 
     try:
-        # Try to find convert_hf_to_gguf.py in common locations
-        convert_script = None
-        search_paths = [
-            Path.home() / ".local" / "share" / "tanrenai" / "bin" / "convert_hf_to_gguf.py",
-            Path("/usr/local/bin/convert_hf_to_gguf.py"),
-            Path("convert_hf_to_gguf.py"),
-        ]
-        for p in search_paths:
-            if p.exists():
-                convert_script = str(p)
-                break
-
-        if convert_script is None:
-            raise FileNotFoundError(
-                "convert_hf_to_gguf.py not found. "
-                "Place it in ~/.local/share/tanrenai/bin/"
-            )
+        convert_script = _find_llama_script("convert_hf_to_gguf.py")
 
         os.makedirs(os.path.dirname(req.output_path), exist_ok=True)
 
@@ -172,3 +299,36 @@ def convert_to_gguf(req: ConvertRequest):
         return {"status": "ok", "output_path": req.output_path}
     except Exception as e:
         raise HTTPException(status_code=500, detail=str(e))
+
+
+@app.post("/convert-lora")
+def convert_lora_to_gguf(req: ConvertLoraRequest):
+    """Convert a LoRA adapter to a GGUF adapter llama-server can load with --lora."""
+    import subprocess
+
+    try:
+        convert_script = _find_llama_script("convert_lora_to_gguf.py")
+
+        os.makedirs(os.path.dirname(req.output_path), exist_ok=True)
+
+        # The base model supplies the architecture; it is either a local
+        # directory or a HuggingFace model ID.
+        if os.path.isdir(req.base_model_path):
+            base_args = ["--base", req.base_model_path]
+        else:
+            base_args = ["--base-model-id", req.base_model_path]
+
+        cmd = [
+            "python3", convert_script,
+            req.adapter_dir,
+            *base_args,
+            "--outfile", req.output_path,
+        ]
+
+        result = subprocess.run(cmd, capture_output=True, text=True, timeout=600)
+        if result.returncode != 0:
+            raise RuntimeError(f"Conversion failed: {result.stderr}")
+
+        return {"status": "ok", "output_path": req.output_path}
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
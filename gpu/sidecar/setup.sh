@@ -63,3 +63,6 @@ echo ""
 echo "=== Setup complete ==="
 echo "To activate: source ${VENV_DIR}/bin/activate"
 echo "To start:    cd ${SCRIPT_DIR} && uvicorn main:app --host 127.0.0.1 --port 18082"
+echo "Remotely:    TANRENAI_SIDECAR_TOKEN=<secret> uvicorn main:app --host 0.0.0.0 --port 18082 \\"
+echo "               --ssl-certfile cert.pem --ssl-keyfile key.pem"
+echo "             then: tanrenai-gpu serve --sidecar-url https://<host>:18082 --sidecar-token <secret>"
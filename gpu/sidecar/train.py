@@ -5,33 +5,81 @@ import os
 import time
 from pathlib import Path
 
-from unsloth import FastLanguageModel
-from trl import SFTTrainer
+from unsloth import FastLanguageModel, PatchDPOTrainer
+from trl import DPOConfig, DPOTrainer, SFTTrainer
 from transformers import TrainingArguments
 from datasets import Dataset
 
 
+def format_messages(messages: list[dict], tools: list[dict] | None = None) -> str:
+    """Convert ChatML messages to a single text string.
+
+    Function-calling samples list their tools in a system turn, as in the
+    Hermes format: the assistant's tool calls become <tool_call> blocks and
+    tool results <tool_response> blocks in a tool turn.
+    """
+    text = ""
+    if tools:
+        listed = "\n".join(json.dumps(t.get("function", t)) for t in tools)
+        text += f"<|system|>\nYou may call these tools:\n<tools>\n{listed}\n</tools></s>\n"
+    for msg in messages:
+        role = msg["role"]
+        content = msg.get("content") or ""
+        if role == "system":
+            text += f"<|system|>\n{content}</s>\n"
+        elif role == "user":
+            text += f"<|user|>\n{content}</s>\n"
+        elif role == "assistant":
+            for call in msg.get("tool_calls") or []:
+                fn = call.get("function", {})
+                try:
+                    arguments = json.loads(fn.get("arguments") or "{}")
+                except json.JSONDecodeError:
+                    arguments = fn.get("arguments")
+                block = json.dumps({"name": fn.get("name"), "arguments": arguments})
+                content += f"\n<tool_call>\n{block}\n</tool_call>"
+            text += f"<|assistant|>\n{content.strip()}</s>\n"
+        elif role == "tool":
+            text += f"<|tool|>\n<tool_response>\n{content}\n</tool_response></s>\n"
+    return text
+
+
 def load_dataset_from_jsonl(dataset_path: str) -> Dataset:
-    """Load a JSONL dataset and format it for SFTTrainer."""
+    """Load a JSONL dataset and format it for SFTTrainer.
+
+    Preference pairs are read as their prompt followed by the chosen reply,
+    so a DPO run's held-out slice can be scored like any other.
+    """
     samples = []
     with open(dataset_path) as f:
         for line in f:
+            if not line.strip():
+                continue
             entry = json.loads(line.strip())
-            # Convert ChatML messages to a single text string
-            text = ""
-            for msg in entry["messages"]:
-                role = msg["role"]
-                content = msg["content"]
-                if role == "system":
-                    text += f"<|system|>\n{content}</s>\n"
-                elif role == "user":
-                    text += f"<|user|>\n{content}</s>\n"
-                elif role == "assistant":
-                    text += f"<|assistant|>\n{content}</s>\n"
+            if "messages" in entry:
+                text = format_messages(entry["messages"], entry.get("tools"))
+            else:
+                text = format_messages(entry["prompt"] + [{"role": "assistant", "content": entry["chosen"]}])
             samples.append({"text": text})
     return Dataset.from_list(samples)
 
 
+def load_preferences_from_jsonl(dataset_path: str) -> Dataset:
+    """Load JSONL preference pairs and format them for DPOTrainer."""
+    samples = []
+    with open(dataset_path) as f:
+        for line in f:
+            if not line.strip():
+                continue
+            entry = json.loads(line.strip())
+            samples.append({
+                "prompt": format_messages(entry["prompt"]) + "<|assistant|>\n",
+                "chosen": f"{entry['chosen']}</s>\n",
+                "rejected": f"{entry['rejected']}</s>\n",
+            })
+    return Dataset.from_list(samples)
+
+
 class MetricsCallback:
     """Writes metrics to a JSON file during training."""
 
@@ -39,12 +87,15 @@ class MetricsCallback:
         self.metrics_path = metrics_path
         self.status_path = status_path
         self.start_time = time.time()
+        self.loss_history: list[dict] = []
 
     def on_log(self, args, state, control, logs=None, **kwargs):
         if logs is None:
             return
         elapsed = time.time() - self.start_time
         progress = state.global_step / state.max_steps if state.max_steps > 0 else 0
+        if "loss" in logs:
+            self.loss_history.append({"step": state.global_step, "loss": logs["loss"]})
         metrics = {
             "train_loss": logs.get("loss", 0),
             "eval_loss": logs.get("eval_loss", 0),
@@ -52,6 +103,7 @@ class MetricsCallback:
             "progress": round(progress, 4),
             "step": state.global_step,
             "max_steps": state.max_steps,
+            "loss_history": self.loss_history,
         }
         with open(self.metrics_path, "w") as f:
             json.dump(metrics, f)
@@ -73,6 +125,9 @@ def run_training(
     lora_rank: int = 16,
     lora_alpha: int = 32,
     batch_size: int = 4,
+    max_seq_length: int = 2048,
+    method: str = "sft",
+    dpo_beta: float = 0.1,
 ) -> dict:
     """Run LoRA fine-tuning using Unsloth.
 
@@ -85,10 +140,18 @@ def run_training(
         lora_rank: LoRA rank.
         lora_alpha: LoRA alpha.
         batch_size: Training batch size.
+        max_seq_length: Cutoff length in tokens; longer samples are
+            truncated.
+        method: "sft" to train on chat samples, or "dpo" to train on
+            preference pairs ({"prompt", "chosen", "rejected"}).
+        dpo_beta: DPO's beta; higher keeps the model closer to the base.
 
     Returns:
         Dictionary with training metrics.
     """
+    if method not in ("sft", "dpo"):
+        raise ValueError(f"unknown training method {method!r}")
+
     os.makedirs(output_dir, exist_ok=True)
     metrics_path = os.path.join(output_dir, "metrics.json")
     status_path = os.path.join(output_dir, "status.json")
@@ -102,7 +165,7 @@ def run_training(
     # Load model with Unsloth (4-bit quantization)
     model, tokenizer = FastLanguageModel.from_pretrained(
         model_name=base_model,
-        max_seq_length=2048,
+        max_seq_length=max_seq_length,
         load_in_4bit=True,
     )
 
@@ -120,12 +183,9 @@ def run_training(
         use_gradient_checkpointing="unsloth",
     )
 
-    # Load dataset
-    dataset = load_dataset_from_jsonl(dataset_path)
-
     # Set up training
     adapter_dir = os.path.join(output_dir, "adapter")
-    training_args = TrainingArguments(
+    common_args = dict(
         output_dir=adapter_dir,
         num_train_epochs=epochs,
         per_device_train_batch_size=batch_size,
@@ -140,15 +200,35 @@ def run_training(
 
     callback = MetricsCallback(metrics_path, status_path)
 
-    trainer = SFTTrainer(
-        model=model,
-        tokenizer=tokenizer,
-        train_dataset=dataset,
-        dataset_text_field="text",
-        max_seq_length=2048,
-        args=training_args,
-        callbacks=[callback],
-    )
+    if method == "dpo":
+        # With a LoRA model, DPOTrainer uses the model with its adapter
+        # disabled as the reference, so no second copy is loaded.
+        PatchDPOTrainer()
+        dataset = load_preferences_from_jsonl(dataset_path)
+        trainer = DPOTrainer(
+            model=model,
+            ref_model=None,
+            tokenizer=tokenizer,
+            train_dataset=dataset,
+            args=DPOConfig(
+                beta=dpo_beta,
+                max_length=max_seq_length,
+                max_prompt_length=max_seq_length * 3 // 4,
+                **common_args,
+            ),
+            callbacks=[callback],
+        )
+    else:
+        dataset = load_dataset_from_jsonl(dataset_path)
+        trainer = SFTTrainer(
+            model=model,
+            tokenizer=tokenizer,
+            train_dataset=dataset,
+            dataset_text_field="text",
+            max_seq_length=max_seq_length,
+            args=TrainingArguments(**common_args),
+            callbacks=[callback],
+        )
 
     # Train
     train_result = trainer.train()
@@ -163,6 +243,9 @@ def run_training(
         "duration": f"{elapsed:.1f}s",
         "samples_used": len(dataset),
         "progress": 1.0,
+        "step": trainer.state.global_step,
+        "max_steps": trainer.state.max_steps,
+        "loss_history": callback.loss_history,
     }
 
     with open(metrics_path, "w") as f:
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -11,13 +13,23 @@ var rootCmd = &cobra.Command{
 	Use:   "tanrenai-server",
 	Short: "Tanrenai backend server",
 	Long:  "Tanrenai (鍛錬AI) backend — orchestration layer with memory, GPU proxy, and instance management.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		level, _ := cmd.Flags().GetString("log-level")
+		format, _ := cmd.Flags().GetString("log-format")
+		return logging.Setup(level, format)
+	},
 }
 
 func Execute() error {
 	return rootCmd.Execute()
 }
 
+func init() {
+	rootCmd.PersistentFlags().String("log-level", "info", "log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", logging.FormatText, "log format: text or json")
+}
+
 func exitError(msg string, args ...any) {
-	fmt.Fprintf(os.Stderr, "Error: "+msg+"\n", args...)
+	slog.Error(fmt.Sprintf(msg, args...))
 	os.Exit(1)
 }
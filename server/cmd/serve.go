@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -12,16 +16,25 @@ import (
 	"github.com/ThatCatDev/tanrenai/server/internal/config"
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuprovider"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
 	"github.com/ThatCatDev/tanrenai/server/internal/memory"
+	"github.com/ThatCatDev/tanrenai/server/internal/runpod"
 	"github.com/ThatCatDev/tanrenai/server/internal/server"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
+	"github.com/ThatCatDev/tanrenai/server/internal/tools"
+	"github.com/ThatCatDev/tanrenai/server/internal/training"
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
 	"github.com/ThatCatDev/tanrenai/server/internal/vastai"
 )
 
+var logger = logging.For("serve")
+
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the tanrenai backend server",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := config.DefaultConfig()
+		cfg.Version = version
 
 		if host, _ := cmd.Flags().GetString("host"); host != "" {
 			cfg.Host = host
@@ -38,15 +51,162 @@ var serveCmd = &cobra.Command{
 		if memDir, _ := cmd.Flags().GetString("memory-dir"); memDir != "" {
 			cfg.MemoryDir = memDir
 		}
+		if cmd.Flags().Changed("memory-keyword-weight") {
+			weight, _ := cmd.Flags().GetFloat64("memory-keyword-weight")
+			if weight < 0 || weight > 1 {
+				return fmt.Errorf("--memory-keyword-weight must be between 0 and 1, got %v", weight)
+			}
+			cfg.MemoryKeywordWeight = weight
+		}
+		if cmd.Flags().Changed("memory-dedup-threshold") {
+			threshold, _ := cmd.Flags().GetFloat64("memory-dedup-threshold")
+			if threshold <= 0 || threshold > 1 {
+				return fmt.Errorf("--memory-dedup-threshold must be in (0, 1], got %v", threshold)
+			}
+			cfg.MemoryDedupThreshold = threshold
+		}
+		if interval, _ := cmd.Flags().GetString("memory-compact-interval"); interval != "" {
+			if _, err := time.ParseDuration(interval); err != nil {
+				return fmt.Errorf("invalid --memory-compact-interval: %w", err)
+			}
+			cfg.MemoryCompactInterval = interval
+		}
+		if halfLife, _ := cmd.Flags().GetString("memory-recency-half-life"); halfLife != "" {
+			if _, err := time.ParseDuration(halfLife); err != nil {
+				return fmt.Errorf("invalid --memory-recency-half-life: %w", err)
+			}
+			cfg.MemoryRecencyHalfLife = halfLife
+		}
+		if schedule, _ := cmd.Flags().GetString("finetune-schedule"); schedule != "" {
+			if _, err := training.ParseSchedule(schedule); err != nil {
+				return fmt.Errorf("invalid --finetune-schedule: %w", err)
+			}
+			cfg.FinetuneSchedule = schedule
+			cfg.FinetuneModel, _ = cmd.Flags().GetString("finetune-model")
+			if cfg.FinetuneModel == "" {
+				return fmt.Errorf("--finetune-schedule needs --finetune-model")
+			}
+			if !cfg.MemoryEnabled {
+				return fmt.Errorf("--finetune-schedule needs --memory: scheduled fine-tunes train on memories")
+			}
+		}
+		cfg.FinetuneMinNew, _ = cmd.Flags().GetInt("finetune-min-new")
+		if quiet, _ := cmd.Flags().GetString("finetune-quiet-hours"); quiet != "" {
+			if _, err := training.ParseQuietHours(quiet); err != nil {
+				return fmt.Errorf("invalid --finetune-quiet-hours: %w", err)
+			}
+			cfg.FinetuneQuietHours = quiet
+		}
+		if sessionsDir, _ := cmd.Flags().GetString("sessions-dir"); sessionsDir != "" {
+			cfg.SessionsDir = sessionsDir
+		}
 		if apiKey, _ := cmd.Flags().GetString("vastai-api-key"); apiKey != "" {
 			cfg.VastaiAPIKey = apiKey
 		}
 		if instanceID, _ := cmd.Flags().GetString("vastai-instance-id"); instanceID != "" {
 			cfg.VastaiInstance = instanceID
 		}
+		cfg.RunPodAPIKey, _ = cmd.Flags().GetString("runpod-api-key")
+		cfg.RunPodPodID, _ = cmd.Flags().GetString("runpod-pod-id")
+		cfg.SSHHost, _ = cmd.Flags().GetString("ssh-host")
+		if unit, _ := cmd.Flags().GetString("ssh-unit"); unit != "" {
+			cfg.SSHUnit = unit
+		}
+		cfg.SSHWakeMAC, _ = cmd.Flags().GetString("ssh-wake-mac")
+		cfg.SSHCostPerHour, _ = cmd.Flags().GetFloat64("ssh-cost-per-hour")
+		if provider, _ := cmd.Flags().GetString("gpu-provider"); provider != "" {
+			cfg.GPUProvider = provider
+		} else if cfg.VastaiAPIKey != "" && cfg.VastaiInstance != "" {
+			cfg.GPUProvider = "vastai"
+		}
+		switch cfg.GPUProvider {
+		case "local":
+		case "vastai":
+			if cfg.VastaiAPIKey == "" || cfg.VastaiInstance == "" {
+				return fmt.Errorf("--gpu-provider vastai needs --vastai-api-key and --vastai-instance-id")
+			}
+		case "runpod":
+			if cfg.RunPodAPIKey == "" || cfg.RunPodPodID == "" {
+				return fmt.Errorf("--gpu-provider runpod needs --runpod-api-key and --runpod-pod-id")
+			}
+		case "ssh":
+			if cfg.SSHHost == "" {
+				return fmt.Errorf("--gpu-provider ssh needs --ssh-host")
+			}
+		default:
+			return fmt.Errorf("invalid --gpu-provider %q: use local, vastai, runpod or ssh", cfg.GPUProvider)
+		}
+		cfg.Tunnel, _ = cmd.Flags().GetString("tunnel")
+		cfg.TunnelRemote, _ = cmd.Flags().GetString("tunnel-remote")
+		cfg.TunnelKey, _ = cmd.Flags().GetString("tunnel-key")
+		cfg.TunnelKnownHosts, _ = cmd.Flags().GetString("tunnel-known-hosts")
+		cfg.TunnelInsecure, _ = cmd.Flags().GetBool("tunnel-insecure-host-key")
+		if cfg.Tunnel == "instance" && cfg.GPUProvider == "local" {
+			return fmt.Errorf("--tunnel instance needs --gpu-provider vastai, runpod or ssh")
+		}
 		if timeout, _ := cmd.Flags().GetString("idle-timeout"); timeout != "" {
 			cfg.IdleTimeout = timeout
 		}
+		if timeout, _ := cmd.Flags().GetString("shutdown-timeout"); timeout != "" {
+			if d, err := time.ParseDuration(timeout); err != nil || d < 0 {
+				return fmt.Errorf("invalid --shutdown-timeout %q: want a duration such as 30s", timeout)
+			}
+			cfg.ShutdownTimeout = timeout
+		}
+		cfg.DailyBudget, _ = cmd.Flags().GetFloat64("budget-daily")
+		cfg.WeeklyBudget, _ = cmd.Flags().GetFloat64("budget-weekly")
+		if cfg.DailyBudget < 0 || cfg.WeeklyBudget < 0 {
+			return fmt.Errorf("--budget-daily and --budget-weekly must not be negative")
+		}
+		if slots, _ := cmd.Flags().GetInt("chat-slots"); slots > 0 {
+			cfg.ChatSlots = slots
+		}
+		if agentEnabled, _ := cmd.Flags().GetBool("agent"); agentEnabled {
+			cfg.AgentEnabled = true
+		}
+		cfg.WebUI, _ = cmd.Flags().GetBool("web-ui")
+		if cmd.Flags().Changed("agent-tools") {
+			cfg.AgentTools, _ = cmd.Flags().GetStringSlice("agent-tools")
+			builtin := tools.DefaultRegistry()
+			for _, name := range cfg.AgentTools {
+				if builtin.Get(name) == nil {
+					return fmt.Errorf("invalid --agent-tools: unknown tool %q", name)
+				}
+			}
+		}
+		if cmd.Flags().Changed("agent-max-iterations") {
+			cfg.AgentMaxIterations, _ = cmd.Flags().GetInt("agent-max-iterations")
+		}
+		if specs, _ := cmd.Flags().GetStringSlice("remote-model"); len(specs) > 0 {
+			models, err := config.ParseRemoteModels(specs)
+			if err != nil {
+				return fmt.Errorf("invalid --remote-model: %w", err)
+			}
+			for alias, m := range models {
+				if os.Getenv(m.KeyEnv) == "" {
+					return fmt.Errorf("--remote-model %s: %s is not set", alias, m.KeyEnv)
+				}
+			}
+			cfg.RemoteModels = models
+		}
+		cfg.TLSCert, _ = cmd.Flags().GetString("tls-cert")
+		cfg.TLSKey, _ = cmd.Flags().GetString("tls-key")
+		if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+			return fmt.Errorf("--tls-cert and --tls-key must be set together")
+		}
+		if proxies, _ := cmd.Flags().GetStringSlice("trusted-proxies"); len(proxies) > 0 {
+			nets, err := config.ParseCIDRs(proxies)
+			if err != nil {
+				return fmt.Errorf("invalid --trusted-proxies: %w", err)
+			}
+			cfg.TrustedProxies = nets
+		}
+		if cmd.Flags().Changed("cors-origins") {
+			cfg.CORSOrigins, _ = cmd.Flags().GetStringSlice("cors-origins")
+		}
+		if cmd.Flags().Changed("cors-headers") {
+			cfg.CORSHeaders, _ = cmd.Flags().GetStringSlice("cors-headers")
+		}
 
 		if err := config.EnsureDirs(cfg); err != nil {
 			return err
@@ -58,46 +218,186 @@ var serveCmd = &cobra.Command{
 		// Create memory store if enabled
 		var memStore memory.Store
 		if cfg.MemoryEnabled {
-			embedFunc := memory.NewRemoteEmbedFunc(gpu)
-			store, err := memory.NewChromemStore(cfg.MemoryDir, embedFunc)
+			embedFunc := memory.NewRemoteBatchEmbedFunc(gpu)
+			memCfg := memory.DefaultConfig()
+			memCfg.KeywordWeight = float32(cfg.MemoryKeywordWeight)
+			if halfLife, err := time.ParseDuration(cfg.MemoryRecencyHalfLife); err == nil {
+				memCfg.RecencyHalfLife = halfLife
+			}
+			store, err := memory.NewChromemStore(cfg.MemoryDir, embedFunc, memCfg)
 			if err != nil {
 				return err
 			}
 			memStore = store
-			log.Printf("Memory store initialized at %s", cfg.MemoryDir)
+			logger.Info("memory store initialized", "dir", cfg.MemoryDir)
 		}
 
-		// Create GPU provider
-		var provider gpuprovider.Provider
-		if cfg.VastaiAPIKey != "" && cfg.VastaiInstance != "" {
-			idleTimeout, err := time.ParseDuration(cfg.IdleTimeout)
-			if err != nil {
-				idleTimeout = 20 * time.Minute
-			}
-			vastClient := vastai.NewClient(cfg.VastaiAPIKey)
-			provider = gpuprovider.NewVastAIProvider(vastClient, gpu, cfg.VastaiInstance, cfg.GPUURL, idleTimeout)
-			log.Printf("GPU provider: vastai (instance: %s, idle timeout: %v)", cfg.VastaiInstance, idleTimeout)
-		} else {
-			provider = gpuprovider.NewLocalProvider(gpu)
-			log.Printf("GPU provider: local (%s)", cfg.GPUURL)
+		sessionStore, err := sessions.NewStore(cfg.SessionsDir)
+		if err != nil {
+			return err
+		}
+
+		provider, err := newGPUProvider(cfg, gpu)
+		if err != nil {
+			return err
 		}
 
 		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		defer stop()
+		// Once shutdown starts, a second signal kills the server at once.
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
 
-		srv := server.New(cfg, gpu, memStore, provider)
+		srv := server.New(cfg, gpu, memStore, sessionStore, provider)
+		if cfg.Tunnel != "" {
+			tun, err := newTunnel(cfg, provider)
+			if err != nil {
+				return fmt.Errorf("tunnel: %w", err)
+			}
+			// The tunnel outlives the signal so that requests draining
+			// during shutdown can still reach the GPU server.
+			tunCtx, stopTunnel := context.WithCancel(context.Background())
+			defer stopTunnel()
+			if err := tun.Listen(tunCtx); err != nil {
+				return err
+			}
+			srv.SetTunnel(tun)
+		}
 		return srv.Start(ctx)
 	},
 }
 
+// newGPUProvider returns the provider cfg.GPUProvider names. Instance
+// providers track their costs in the data directory.
+func newGPUProvider(cfg *config.Config, gpu *gpuclient.Client) (gpuprovider.Provider, error) {
+	var machine gpuprovider.Machine
+	switch cfg.GPUProvider {
+	case "vastai":
+		machine = gpuprovider.NewVastAIMachine(vastai.NewClient(cfg.VastaiAPIKey), cfg.VastaiInstance)
+	case "runpod":
+		machine = gpuprovider.NewRunPodMachine(runpod.NewClient(cfg.RunPodAPIKey), cfg.RunPodPodID)
+	case "ssh":
+		m, err := gpuprovider.NewSSHMachine(cfg.SSHHost, cfg.SSHUnit, cfg.SSHWakeMAC, cfg.SSHCostPerHour)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --ssh-wake-mac: %w", err)
+		}
+		machine = m
+	default:
+		logger.Info("GPU provider: local", "gpu_url", cfg.GPUURL)
+		return gpuprovider.NewLocalProvider(gpu), nil
+	}
+
+	idleTimeout, err := time.ParseDuration(cfg.IdleTimeout)
+	if err != nil {
+		idleTimeout = 20 * time.Minute
+	}
+	provider := gpuprovider.NewInstanceProvider(machine, gpu, cfg.GPUURL, idleTimeout)
+	budget := gpuprovider.Budget{Daily: cfg.DailyBudget, Weekly: cfg.WeeklyBudget}
+	if err := provider.TrackCosts(filepath.Join(config.DataDir(), "instance-costs.json"), budget); err != nil {
+		return nil, fmt.Errorf("instance costs: %w", err)
+	}
+	logger.Info("GPU provider: "+machine.Kind(), "instance", machine.ID(), "idle_timeout", idleTimeout)
+	return provider, nil
+}
+
+// newTunnel returns the SSH tunnel cfg.Tunnel asks for. It listens on
+// --gpu-url's address, which must be local, so the GPU client reaches the
+// GPU server through it.
+func newTunnel(cfg *config.Config, provider gpuprovider.Provider) (*tunnel.Tunnel, error) {
+	u, err := url.Parse(cfg.GPUURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --gpu-url: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("--gpu-url must be on localhost to be tunnelled, got %s", host)
+	}
+	remote := cfg.TunnelRemote
+	if remote == "" {
+		remote = net.JoinHostPort("localhost", port)
+	}
+
+	var resolve tunnel.ResolveFunc
+	if cfg.Tunnel == "instance" {
+		inst, ok := provider.(*gpuprovider.InstanceProvider)
+		if !ok {
+			return nil, fmt.Errorf("--tunnel instance needs a GPU instance provider")
+		}
+		machine, ok := inst.Machine().(gpuprovider.SSHReachable)
+		if !ok {
+			return nil, fmt.Errorf("%s machines have no SSH address; give --tunnel [user@]host[:port]", inst.Name())
+		}
+		resolve = machine.SSHEndpoint
+	} else {
+		endpoint, err := tunnel.ParseEndpoint(cfg.Tunnel, os.Getenv("USER"))
+		if err != nil {
+			return nil, err
+		}
+		resolve = tunnel.Static(endpoint)
+	}
+
+	return tunnel.New(tunnel.Config{
+		Resolve:         resolve,
+		LocalAddr:       net.JoinHostPort(host, port),
+		RemoteAddr:      remote,
+		KeyFile:         cfg.TunnelKey,
+		KnownHosts:      cfg.TunnelKnownHosts,
+		InsecureHostKey: cfg.TunnelInsecure,
+	})
+}
+
 func init() {
 	serveCmd.Flags().String("host", "0.0.0.0", "bind address")
 	serveCmd.Flags().Int("port", 8080, "listen port")
 	serveCmd.Flags().String("gpu-url", "http://localhost:11435", "GPU server URL")
 	serveCmd.Flags().Bool("memory", false, "enable memory/RAG")
 	serveCmd.Flags().String("memory-dir", "", "memory storage directory")
+	serveCmd.Flags().Float64("memory-dedup-threshold", 0.92, "embedding similarity at which memories are consolidated")
+	serveCmd.Flags().String("memory-compact-interval", "", "run memory consolidation on this interval, e.g. \"24h\" (default: manual only)")
+	serveCmd.Flags().String("memory-recency-half-life", "", "age at which memory relevance has decayed halfway, e.g. \"720h\"; \"0\" disables decay (default 720h)")
+	serveCmd.Flags().Float64("memory-keyword-weight", 0.3, "weight of BM25 keyword score in memory search (0 = pure semantic, 1 = pure keyword)")
+	serveCmd.Flags().String("finetune-schedule", "", "fine-tune on the memories on this schedule: a cron expression such as \"0 3 * * *\", @daily/@weekly, or an interval such as \"24h\" (needs --memory and --finetune-model)")
+	serveCmd.Flags().String("finetune-model", "", "base model of scheduled fine-tunes")
+	serveCmd.Flags().Int("finetune-min-new", 50, "memories that must be added since the last scheduled fine-tune before the next one starts")
+	serveCmd.Flags().String("finetune-quiet-hours", "", "daily window in which scheduled fine-tunes wait, e.g. \"09:00-18:00\" (local time)")
+	serveCmd.Flags().String("sessions-dir", "", "chat session storage directory")
+	serveCmd.Flags().String("gpu-provider", "", "what runs the GPU server: local (always up at --gpu-url), vastai, runpod or ssh (default vastai when its flags are set, else local)")
 	serveCmd.Flags().String("vastai-api-key", "", "vast.ai API key")
 	serveCmd.Flags().String("vastai-instance-id", "", "vast.ai instance ID to manage")
+	serveCmd.Flags().String("runpod-api-key", "", "RunPod API key")
+	serveCmd.Flags().String("runpod-pod-id", "", "RunPod pod ID to manage")
+	serveCmd.Flags().String("ssh-host", "", "[user@]host running the GPU server, reached with ssh (keys from ~/.ssh/config)")
+	serveCmd.Flags().String("ssh-unit", "tanrenai-gpu", "systemd unit of the GPU server on --ssh-host")
+	serveCmd.Flags().String("ssh-wake-mac", "", "MAC address to wake --ssh-host with Wake-on-LAN; with it, an idle host is shut down rather than only its unit stopped")
+	serveCmd.Flags().Float64("ssh-cost-per-hour", 0, "dollars an hour of --ssh-host costs, e.g. in power, for --budget-daily/--budget-weekly")
+	serveCmd.Flags().String("tunnel", "", "reach the GPU server through an SSH port-forward of --gpu-url's port (which must be on localhost) to [user@]host[:port], or to the instance's own SSH server with \"instance\"; reconnects when it drops")
+	serveCmd.Flags().String("tunnel-remote", "", "address the SSH server forwards the tunnel to (default localhost at --gpu-url's port)")
+	serveCmd.Flags().String("tunnel-key", "", "private key for the tunnel (default: the SSH agent and ~/.ssh/id_ed25519, id_ecdsa, id_rsa)")
+	serveCmd.Flags().String("tunnel-known-hosts", "", "known_hosts file the tunnel's host key is checked against (default ~/.ssh/known_hosts)")
+	serveCmd.Flags().Bool("tunnel-insecure-host-key", false, "do not check the tunnel's host key, e.g. for marketplace instances whose keys change with every rental")
 	serveCmd.Flags().String("idle-timeout", "20m", "auto-stop after inactivity")
+	serveCmd.Flags().String("shutdown-timeout", "30s", "on SIGTERM or SIGINT, how long requests in flight may take to finish before they are cancelled")
+	serveCmd.Flags().Float64("budget-daily", 0, "dollars the GPU instance may cost per day; past it requests no longer start it (0 = no budget)")
+	serveCmd.Flags().Float64("budget-weekly", 0, "dollars the GPU instance may cost per week, from Monday; past it requests no longer start it (0 = no budget)")
+	serveCmd.Flags().Int("chat-slots", 1, "chat completions to run at once; match llama-server's --parallel (more requests queue)")
+	serveCmd.Flags().Bool("agent", false, "serve /v1/agent/runs; read-only tools run on this machine and may only read under the server's working directory")
+	serveCmd.Flags().StringSlice("agent-tools", []string{"file_read", "list_dir", "grep_search", "find_files"}, "tools agent runs may use; all of them are read-only")
+	serveCmd.Flags().Int("agent-max-iterations", 200, "maximum tool-call iterations per agent run (0 = unlimited)")
+	serveCmd.Flags().Bool("web-ui", true, "serve a browser chat UI at /ui (--web-ui=false turns it off)")
+	serveCmd.Flags().StringSlice("remote-model", nil, "agent run model served by a cloud API, as alias=provider:model with provider openai or openrouter (key from OPENAI_API_KEY or OPENROUTER_API_KEY)")
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate file (PEM); serves HTTPS together with --tls-key")
+	serveCmd.Flags().String("tls-key", "", "TLS private key file (PEM)")
+	serveCmd.Flags().StringSlice("trusted-proxies", nil, "reverse proxy IPs or CIDRs whose X-Forwarded-For header is trusted")
+	serveCmd.Flags().StringSlice("cors-origins", []string{"*"}, "origins allowed to call the API from a browser (empty = none)")
+	serveCmd.Flags().StringSlice("cors-headers", []string{"Content-Type", "Authorization", "X-Priority", "X-Session-ID"}, "request headers allowed in CORS requests")
 	rootCmd.AddCommand(serveCmd)
 }
@@ -0,0 +1,384 @@
+// Package agent runs the tool-calling loop on the backend, for clients that
+// do not implement it themselves, with the tools executing on the server's
+// filesystem. It is a separate, smaller loop than the CLI's rather than a
+// shared one: the modules share no code, and the backend needs none of the
+// CLI's context windowing, planning, sub-agents, tool approval or
+// background processes, since a run's history comes from its client and
+// its tools are read-only. It keeps the parts every run needs: streaming,
+// cancellation, nudging replies that guess instead of using tools, and
+// stopping on repeated identical failing calls.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/tools"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// StreamingCompletionFunc sends a streaming chat completion request.
+type StreamingCompletionFunc func(ctx context.Context, req *api.ChatCompletionRequest) (<-chan gpuclient.StreamEvent, error)
+
+// Hooks are optional callbacks invoked during the agent loop for observability.
+type Hooks struct {
+	OnIterationStart func(iteration, maxIterations int)
+	OnContentDelta   func(delta string)
+	OnToolCall       func(call api.ToolCall)
+	OnToolResult     func(call api.ToolCall, result string)
+}
+
+// Config configures the agent loop.
+type Config struct {
+	Model             string
+	SessionID         string // keeps the run's requests on one prompt cache slot
+	MaxIterations     int
+	MaxResponseTokens int // max tokens per generation (0 = default 4096)
+	Tools             *tools.Registry
+
+	Hooks Hooks
+}
+
+const (
+	// maxRepeatedErrors is how many times an identical tool call may fail
+	// before the model is told to stop retrying it; failing again after
+	// that stops the run as stuck.
+	maxRepeatedErrors        = 3
+	defaultMaxResponseTokens = 4096
+	// maxNudges caps how many replies per run are sent back with a nudge
+	// to use tools.
+	maxNudges = 3
+)
+
+// executeTool runs a tool call through the registry under the tool's
+// timeout. Cancelling ctx aborts the call immediately.
+func executeTool(ctx context.Context, cfg *Config, tc api.ToolCall) (*tools.ToolResult, error) {
+	name := tc.Function.Name
+	return cfg.Tools.Execute(ctx, name, tc.Function.Arguments, cfg.Tools.Timeout(name))
+}
+
+// ErrCancelled is returned when a run stops because its context was
+// cancelled. It wraps the underlying error, so errors.Is(err,
+// context.Canceled) still holds.
+var ErrCancelled = errors.New("agent run cancelled")
+
+// cancelled wraps err in ErrCancelled if ctx has been cancelled.
+func cancelled(ctx context.Context, err error) error {
+	if ctx.Err() == nil || errors.Is(err, ErrCancelled) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrCancelled, err)
+}
+
+// cancelledToolResults answers the tool calls a cancelled run never made, so
+// the history stays valid to send again.
+func cancelledToolResults(calls []api.ToolCall) []api.Message {
+	msgs := make([]api.Message, len(calls))
+	for i, tc := range calls {
+		msgs[i] = api.Message{
+			Role:       "tool",
+			Content:    "Not run: the user cancelled the request.",
+			ToolCallID: tc.ID,
+			Name:       tc.Function.Name,
+		}
+	}
+	return msgs
+}
+
+func toolCallKey(tc api.ToolCall) string {
+	return tc.Function.Name + ":" + tc.Function.Arguments
+}
+
+// RunStreaming executes the agentic loop: stream a completion, execute any
+// tool calls it makes, feed the results back, and repeat until the model
+// stops calling tools or the iteration limit is reached. It returns the
+// conversation including everything the loop added. Cancelling ctx stops the
+// loop before the next request or tool call with an error wrapping
+// ErrCancelled.
+func RunStreaming(ctx context.Context, complete StreamingCompletionFunc, messages []api.Message, cfg Config) ([]api.Message, error) {
+	if cfg.MaxIterations <= 0 {
+		cfg.MaxIterations = 1<<31 - 1
+	}
+	if cfg.MaxResponseTokens <= 0 {
+		cfg.MaxResponseTokens = defaultMaxResponseTokens
+	}
+
+	apiTools := cfg.Tools.APITools()
+	errorCounts := make(map[string]int)
+	nudgeCount := 0
+
+	for i := 0; i < cfg.MaxIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return messages, cancelled(ctx, err)
+		}
+		if cfg.Hooks.OnIterationStart != nil {
+			cfg.Hooks.OnIterationStart(i+1, cfg.MaxIterations)
+		}
+
+		maxTokens := cfg.MaxResponseTokens
+		req := &api.ChatCompletionRequest{
+			Model:     cfg.Model,
+			SessionID: cfg.SessionID,
+			Messages:  messages,
+			Stream:    true,
+			Tools:     apiTools,
+			MaxTokens: &maxTokens,
+		}
+
+		events, err := complete(ctx, req)
+		if err != nil {
+			return messages, cancelled(ctx, fmt.Errorf("completion request failed: %w", err))
+		}
+
+		resp, err := accumulateWithCallbacks(events, &cfg)
+		if err == nil {
+			// A cancelled stream ends early without an error event.
+			err = ctx.Err()
+		}
+		if err != nil {
+			return messages, cancelled(ctx, fmt.Errorf("stream accumulation failed: %w", err))
+		}
+
+		if len(resp.Choices) == 0 {
+			return messages, fmt.Errorf("empty response from model")
+		}
+
+		choice := resp.Choices[0]
+		stripNarration(&choice.Message)
+		messages = append(messages, choice.Message)
+
+		if choice.FinishReason == "length" && len(choice.Message.ToolCalls) == 0 {
+			continue
+		}
+
+		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) == 0 {
+			if nudgeCount < maxNudges && looksLikeContinuation(choice.Message.Content) {
+				nudgeCount++
+				messages = append(messages, api.Message{
+					Role:    "user",
+					Content: "Do not guess or speculate. Use your tools to gather the actual information, then answer.",
+				})
+				continue
+			}
+			return messages, nil
+		}
+
+		stuck := true
+		for j, tc := range choice.Message.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
+				return messages, cancelled(ctx, err)
+			}
+			if cfg.Hooks.OnToolCall != nil {
+				cfg.Hooks.OnToolCall(tc)
+			}
+
+			result, execErr := executeTool(ctx, &cfg, tc)
+			if execErr != nil {
+				if ctx.Err() != nil {
+					messages = append(messages, cancelledToolResults(choice.Message.ToolCalls[j:])...)
+				}
+				return messages, cancelled(ctx, fmt.Errorf("tool %q execution error: %w", tc.Function.Name, execErr))
+			}
+
+			key := toolCallKey(tc)
+			if result.IsError {
+				errorCounts[key]++
+				if errorCounts[key] >= maxRepeatedErrors {
+					result.Output += "\n\nYou have repeated this exact failing call multiple times. Do NOT retry it. Either try different arguments or respond to the user explaining what went wrong."
+				}
+			} else {
+				delete(errorCounts, key)
+				stuck = false
+			}
+
+			if cfg.Hooks.OnToolResult != nil {
+				cfg.Hooks.OnToolResult(tc, result.Output)
+			}
+
+			messages = append(messages, api.Message{
+				Role:       "tool",
+				Content:    result.Output,
+				ToolCallID: tc.ID,
+				Name:       tc.Function.Name,
+			})
+		}
+
+		allRepeats := true
+		for _, tc := range choice.Message.ToolCalls {
+			if errorCounts[toolCallKey(tc)] < maxRepeatedErrors {
+				allRepeats = false
+				break
+			}
+		}
+		if stuck && allRepeats {
+			anyOverLimit := false
+			for _, tc := range choice.Message.ToolCalls {
+				if errorCounts[toolCallKey(tc)] > maxRepeatedErrors {
+					anyOverLimit = true
+					break
+				}
+			}
+			if anyOverLimit {
+				return messages, fmt.Errorf("agent stuck: repeated identical failing tool calls")
+			}
+		}
+	}
+
+	return messages, fmt.Errorf("agent loop reached maximum iterations (%d)", cfg.MaxIterations)
+}
+
+func accumulateWithCallbacks(events <-chan gpuclient.StreamEvent, cfg *Config) (*api.ChatCompletionResponse, error) {
+	var (
+		content      strings.Builder
+		role         string
+		model        string
+		id           string
+		finishReason string
+		toolCalls    []api.ToolCall
+		toolArgBuf   = make(map[int]*strings.Builder)
+		usage        *api.Usage
+	)
+
+	for ev := range events {
+		if ev.Err != nil {
+			return nil, ev.Err
+		}
+		if ev.Done {
+			break
+		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
+		if ev.Chunk == nil {
+			continue
+		}
+
+		if id == "" {
+			id = ev.Chunk.ID
+		}
+		if model == "" {
+			model = ev.Chunk.Model
+		}
+
+		for _, choice := range ev.Chunk.Choices {
+			if choice.Delta.Role != "" {
+				role = choice.Delta.Role
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				if cfg.Hooks.OnContentDelta != nil {
+					cfg.Hooks.OnContentDelta(choice.Delta.Content)
+				}
+			}
+
+			for _, tcd := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= tcd.Index {
+					toolCalls = append(toolCalls, api.ToolCall{})
+				}
+				if tcd.ID != "" {
+					toolCalls[tcd.Index].ID = tcd.ID
+				}
+				if tcd.Type != "" {
+					toolCalls[tcd.Index].Type = tcd.Type
+				}
+				if tcd.Function != nil {
+					if tcd.Function.Name != "" {
+						toolCalls[tcd.Index].Function.Name = tcd.Function.Name
+					}
+					if tcd.Function.Arguments != "" {
+						if toolArgBuf[tcd.Index] == nil {
+							toolArgBuf[tcd.Index] = &strings.Builder{}
+						}
+						toolArgBuf[tcd.Index].WriteString(tcd.Function.Arguments)
+					}
+				}
+			}
+		}
+	}
+
+	for idx, buf := range toolArgBuf {
+		if idx < len(toolCalls) {
+			toolCalls[idx].Function.Arguments = buf.String()
+		}
+	}
+
+	if role == "" {
+		role = "assistant"
+	}
+
+	msg := api.Message{
+		Role:    role,
+		Content: content.String(),
+	}
+	if len(toolCalls) > 0 {
+		msg.ToolCalls = toolCalls
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+		if len(toolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+
+	return &api.ChatCompletionResponse{
+		ID:     id,
+		Object: "chat.completion",
+		Model:  model,
+		Choices: []api.Choice{
+			{
+				Index:        0,
+				Message:      msg,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}, nil
+}
+
+// looksLikeContinuation reports whether a reply that calls no tools is
+// guessing or announcing work it has not done. It matches English phrases
+// announcing further work ("let me", "next,") and replies hedged with two
+// or more speculation words ("probably", "might be").
+func looksLikeContinuation(text string) bool {
+	lower := strings.ToLower(text)
+
+	intentPrefixes := []string{
+		"let's ", "let me ", "i'll ", "i will ", "i'm going to ",
+		"next,", "next ", "now,", "now ", "please wait",
+		"here are the function calls", "here are the tool calls",
+	}
+	for _, sig := range intentPrefixes {
+		if strings.Contains(lower, sig) {
+			return true
+		}
+	}
+
+	specSignals := []string{
+		"typically", "likely", "might be", "might contain",
+		"may be", "may contain", "could be", "could contain",
+		"probably", "presumably", "unknown", "unclear",
+		"further investigation", "further exploration",
+		"would need to", "need to check", "need to verify",
+	}
+	specCount := 0
+	for _, sig := range specSignals {
+		if strings.Contains(lower, sig) {
+			specCount++
+		}
+	}
+	return specCount >= 2
+}
+
+func stripNarration(msg *api.Message) {
+	if len(msg.ToolCalls) > 0 && msg.Content != "" {
+		msg.Content = ""
+	}
+}
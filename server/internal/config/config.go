@@ -1,35 +1,153 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 // Config holds the backend server configuration.
 type Config struct {
-	Host           string
-	Port           int
-	GPUURL         string // URL of the GPU server
-	MemoryEnabled  bool
-	MemoryDir      string
-	VastaiAPIKey   string
-	VastaiInstance string
-	IdleTimeout    string // duration string, e.g. "20m"
+	Host                  string
+	Port                  int
+	GPUURL                string // URL of the GPU server
+	MemoryEnabled         bool
+	MemoryDir             string
+	MemoryKeywordWeight   float64 // share of memory search score given to BM25 (0-1)
+	MemoryDedupThreshold  float64 // cosine similarity at which memories are merged
+	MemoryCompactInterval string  // duration string; "" disables scheduled consolidation
+	MemoryRecencyHalfLife string  // duration string; "0" disables recency decay
+	FinetuneSchedule      string  // cron expression or interval; "" disables scheduled fine-tunes
+	FinetuneModel         string  // base model of scheduled fine-tunes
+	FinetuneMinNew        int     // memories added since the last scheduled fine-tune before the next starts
+	FinetuneQuietHours    string  // "HH:MM-HH:MM" in which scheduled fine-tunes wait; "" has none
+	SessionsDir           string  // where /v1/sessions keeps chat sessions
+	GPUProvider           string  // "local", "vastai", "runpod" or "ssh": what runs the GPU server
+	VastaiAPIKey          string
+	VastaiInstance        string
+	RunPodAPIKey          string
+	RunPodPodID           string
+	SSHHost               string                 // [user@]host running the GPU server as SSHUnit
+	SSHUnit               string                 // systemd unit of the GPU server
+	SSHWakeMAC            string                 // MAC address to wake SSHHost with; "" never shuts it down
+	SSHCostPerHour        float64                // dollars an hour of SSHHost costs, e.g. in power
+	Tunnel                string                 // "[user@]host[:port]" to forward GPUURL's port through over SSH, or "instance"; "" has no tunnel
+	TunnelRemote          string                 // where the SSH server sends the tunnel; "" is localhost at GPUURL's port
+	TunnelKey             string                 // private key file; "" uses the SSH agent and ~/.ssh keys
+	TunnelKnownHosts      string                 // "" uses ~/.ssh/known_hosts
+	TunnelInsecure        bool                   // skip host key checks
+	IdleTimeout           string                 // duration string, e.g. "20m"
+	ShutdownTimeout       string                 // duration string; how long requests in flight may take to finish on SIGTERM
+	DailyBudget           float64                // dollars the GPU instance may cost per day before it is no longer started on demand; 0 = none
+	WeeklyBudget          float64                // the same from Monday
+	ChatSlots             int                    // chat completions run on the GPU at once; the rest queue
+	AgentEnabled          bool                   // serve /v1/agent/runs
+	WebUI                 bool                   // serve the browser chat UI at /ui
+	AgentTools            []string               // tools agent runs may use
+	AgentMaxIterations    int                    // per-run iteration cap; 0 = unlimited
+	RemoteModels          map[string]RemoteModel // agent run model aliases served by cloud APIs
+	TLSCert               string                 // PEM certificate; with TLSKey, serve HTTPS
+	TLSKey                string
+	TrustedProxies        []*net.IPNet // peers whose X-Forwarded-For is believed
+	CORSOrigins           []string     // allowed origins; "*" allows any
+	CORSHeaders           []string     // allowed request headers
+	Version               string       // reported by GET /api/info
 }
 
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		Host:          "0.0.0.0",
-		Port:          8080,
-		GPUURL:        "http://localhost:11435",
-		MemoryEnabled: false,
-		MemoryDir:     MemoryDir(),
-		IdleTimeout:   "20m",
+		Host:                  "0.0.0.0",
+		Port:                  8080,
+		GPUURL:                "http://localhost:11435",
+		MemoryEnabled:         false,
+		MemoryDir:             MemoryDir(),
+		MemoryKeywordWeight:   0.3,
+		MemoryDedupThreshold:  0.92,
+		MemoryRecencyHalfLife: "720h",
+		FinetuneMinNew:        50,
+		SessionsDir:           SessionsDir(),
+		GPUProvider:           "local",
+		SSHUnit:               "tanrenai-gpu",
+		IdleTimeout:           "20m",
+		ShutdownTimeout:       "30s",
+		ChatSlots:             1,
+		AgentTools:            []string{"file_read", "list_dir", "grep_search", "find_files"},
+		AgentMaxIterations:    200,
+		WebUI:                 true,
+		CORSOrigins:           []string{"*"},
+		CORSHeaders:           []string{"Content-Type", "Authorization", "X-Priority", "X-Session-ID"},
 	}
 }
 
+// RemoteModel is a model served by an OpenAI-compatible cloud API instead
+// of the GPU server.
+type RemoteModel struct {
+	BaseURL string // the API's URL, without the /v1 suffix
+	Model   string // the provider's model ID
+	KeyEnv  string // the environment variable holding the API key
+}
+
+// remoteProviders are the providers --remote-model accepts.
+var remoteProviders = map[string]RemoteModel{
+	"openai":     {BaseURL: "https://api.openai.com", KeyEnv: "OPENAI_API_KEY"},
+	"openrouter": {BaseURL: "https://openrouter.ai/api", KeyEnv: "OPENROUTER_API_KEY"},
+}
+
+// ParseRemoteModels parses model aliases given as alias=provider:model,
+// e.g. "gpt=openai:gpt-4o-mini" or
+// "claude=openrouter:anthropic/claude-sonnet-4.5".
+func ParseRemoteModels(specs []string) (map[string]RemoteModel, error) {
+	models := make(map[string]RemoteModel, len(specs))
+	for _, spec := range specs {
+		alias, target, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		provider, model, ok2 := strings.Cut(target, ":")
+		if !ok || !ok2 || alias == "" || model == "" {
+			return nil, fmt.Errorf("invalid remote model %q: want alias=provider:model", spec)
+		}
+		remote, known := remoteProviders[provider]
+		if !known {
+			return nil, fmt.Errorf("invalid remote model %q: unknown provider %q (use openai or openrouter)", spec, provider)
+		}
+		remote.Model = model
+		models[alias] = remote
+	}
+	return models, nil
+}
+
+// ParseCIDRs parses IP networks in CIDR notation. A bare IP address is
+// treated as a single-host network.
+func ParseCIDRs(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", spec)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", spec, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 // DataDir returns the default data directory for tanrenai.
 func DataDir() string {
 	if dir := os.Getenv("TANRENAI_DATA_DIR"); dir != "" {
@@ -47,9 +165,14 @@ func MemoryDir() string {
 	return filepath.Join(DataDir(), "memory")
 }
 
+// SessionsDir returns the directory where chat sessions are stored.
+func SessionsDir() string {
+	return filepath.Join(DataDir(), "sessions")
+}
+
 // EnsureDirs creates the required directories if they don't exist.
 func EnsureDirs(cfg *Config) error {
-	dirs := []string{DataDir()}
+	dirs := []string{DataDir(), cfg.SessionsDir}
 	if cfg.MemoryEnabled {
 		dirs = append(dirs, cfg.MemoryDir)
 	}
@@ -2,6 +2,7 @@ package gpuclient
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,7 +16,9 @@ import (
 // Client is a typed HTTP client for communicating with the GPU server.
 type Client struct {
 	baseURL    string
+	apiKey     string // sent as a bearer token when set
 	httpClient *http.Client
+	gzip       bool // gzip large request bodies; cloud APIs may not accept them
 }
 
 // New creates a new GPU Client.
@@ -23,14 +26,29 @@ func New(baseURL string) *Client {
 	return &Client{
 		baseURL:    baseURL,
 		httpClient: &http.Client{},
+		gzip:       true,
 	}
 }
 
+// NewRemote creates a Client for an OpenAI-compatible cloud API, which
+// serves the same chat completions endpoint given an API key.
+func NewRemote(baseURL, apiKey string) *Client {
+	c := New(baseURL)
+	c.apiKey = apiKey
+	c.gzip = false
+	return c
+}
+
 // BaseURL returns the GPU server base URL.
 func (c *Client) BaseURL() string {
 	return c.baseURL
 }
 
+// CompletionFunc sends a non-streaming chat completion request, like
+// ChatCompletion. The backend's own jobs get one that also waits for the
+// GPU and a scheduler slot.
+type CompletionFunc func(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error)
+
 // ChatCompletion sends a non-streaming chat completion request.
 func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
 	body, err := json.Marshal(req)
@@ -38,11 +56,12 @@ func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequ
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+"/v1/chat/completions", body)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	c.authorize(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -52,7 +71,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *api.ChatCompletionRequ
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GPU server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	var result api.ChatCompletionResponse
@@ -71,11 +90,12 @@ func (c *Client) StreamCompletionRaw(ctx context.Context, req *api.ChatCompletio
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/chat/completions", bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+"/v1/chat/completions", body)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	c.authorize(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -85,12 +105,41 @@ func (c *Client) StreamCompletionRaw(ctx context.Context, req *api.ChatCompletio
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("GPU server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	return resp.Body, nil
 }
 
+// gzipMin is the smallest request body worth compressing.
+const gzipMin = 1024
+
+// newPost creates a JSON POST of body to url, gzipped when it is large:
+// agent iterations resend the whole conversation, which over a tunnel to
+// a remote GPU server is most of a request's time.
+func (c *Client) newPost(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	if !c.gzip || len(body) < gzipMin {
+		return http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	zw.Write(body)
+	zw.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	return req, nil
+}
+
+// authorize adds the API key, if the client has one.
+func (c *Client) authorize(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
 // Tokenize sends text to the GPU server's /tokenize endpoint.
 func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 	payload := struct {
@@ -98,7 +147,7 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 	}{Content: text}
 	body, _ := json.Marshal(payload)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/tokenize", bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+"/tokenize", body)
 	if err != nil {
 		return 0, err
 	}
@@ -112,7 +161,7 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("tokenize returned %d: %s", resp.StatusCode, string(respBody))
+		return 0, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	var result struct {
@@ -126,10 +175,20 @@ func (c *Client) Tokenize(ctx context.Context, text string) (int, error) {
 
 // Embed calls the GPU server's /v1/embeddings endpoint.
 func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
-	req := api.EmbeddingRequest{Input: text, Model: "embedding"}
+	vecs, err := c.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch embeds several texts with a single /v1/embeddings request.
+// The returned vectors are normalized and in the same order as texts.
+func (c *Client) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	req := api.EmbeddingRequest{Input: texts, Model: "embedding"}
 	body, _ := json.Marshal(req)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/embeddings", bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+"/v1/embeddings", body)
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +202,7 @@ func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("embedding server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	var result api.EmbeddingResponse
@@ -151,19 +210,29 @@ func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 		return nil, fmt.Errorf("decode embedding response: %w", err)
 	}
 
-	if len(result.Data) == 0 {
-		return nil, fmt.Errorf("embedding response contained no data")
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding response contained %d vectors for %d inputs", len(result.Data), len(texts))
 	}
 
-	vec := result.Data[0].Embedding
-	normalizeVector(vec)
-	return vec, nil
+	vecs := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) || vecs[d.Index] != nil {
+			return nil, fmt.Errorf("embedding response has invalid index %d", d.Index)
+		}
+		normalizeVector(d.Embedding)
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
 }
 
-// LoadModel loads a model on the GPU server.
-func (c *Client) LoadModel(ctx context.Context, model string) error {
+// LoadModel loads a model, named directly or by alias, on the GPU server.
+func (c *Client) LoadModel(ctx context.Context, model string) (*api.LoadModelResponse, error) {
 	body, _ := json.Marshal(map[string]string{"model": model})
-	return c.postJSON(ctx, "/api/load", body, nil)
+	var result api.LoadModelResponse
+	if err := c.postJSON(ctx, "/api/load", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 // ListModels lists models available on the GPU server.
@@ -175,11 +244,20 @@ func (c *Client) ListModels(ctx context.Context) (*api.ModelListResponse, error)
 	return &result, nil
 }
 
+// Info returns the GPU server's loaded model and features.
+func (c *Client) Info(ctx context.Context) (*api.ServerInfo, error) {
+	var result api.ServerInfo
+	if err := c.getJSON(ctx, c.baseURL+"/api/info", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // PullModelStream sends a pull request to the GPU server and returns the raw
 // SSE response body. The caller is responsible for closing it.
 func (c *Client) PullModelStream(ctx context.Context, url string) (io.ReadCloser, error) {
 	body, _ := json.Marshal(map[string]string{"url": url})
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/pull", bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+"/api/pull", body)
 	if err != nil {
 		return nil, err
 	}
@@ -194,12 +272,42 @@ func (c *Client) PullModelStream(ctx context.Context, url string) (io.ReadCloser
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("GPU server returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	return resp.Body, nil
 }
 
+// FinetunePrepare creates a pending training run on the GPU server.
+func (c *Client) FinetunePrepare(ctx context.Context, req *api.FinetunePrepareRequest) (*api.FinetuneRun, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var run api.FinetuneRun
+	if err := c.postJSON(ctx, "/v1/finetune/prepare", body, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// FinetuneTrain starts training a pending run.
+func (c *Client) FinetuneTrain(ctx context.Context, runID string) error {
+	body, _ := json.Marshal(api.FinetuneTrainRequest{RunID: runID})
+	return c.postJSON(ctx, "/v1/finetune/train", body, nil)
+}
+
+// FinetuneRuns lists the GPU server's training runs, newest first.
+func (c *Client) FinetuneRuns(ctx context.Context) ([]api.FinetuneRun, error) {
+	var result struct {
+		Runs []api.FinetuneRun `json:"runs"`
+	}
+	if err := c.getJSON(ctx, c.baseURL+"/v1/finetune/runs", &result); err != nil {
+		return nil, err
+	}
+	return result.Runs, nil
+}
+
 // Health checks if the GPU server is healthy.
 func (c *Client) Health(ctx context.Context) error {
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
@@ -218,7 +326,7 @@ func (c *Client) Health(ctx context.Context) error {
 }
 
 func (c *Client) postJSON(ctx context.Context, path string, body []byte, result any) error {
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	httpReq, err := c.newPost(ctx, c.baseURL+path, body)
 	if err != nil {
 		return err
 	}
@@ -232,7 +340,7 @@ func (c *Client) postJSON(ctx context.Context, path string, body []byte, result
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("GPU server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	if result != nil {
@@ -254,7 +362,7 @@ func (c *Client) getJSON(ctx context.Context, url string, result any) error {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+		return api.DecodeError(resp.StatusCode, respBody)
 	}
 
 	return json.NewDecoder(resp.Body).Decode(result)
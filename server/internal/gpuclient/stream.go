@@ -0,0 +1,99 @@
+package gpuclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// StreamEvent is a parsed SSE event from the GPU server.
+type StreamEvent struct {
+	Chunk *api.ChatCompletionChunk
+	Usage *api.Usage // token usage, reported on the final chunk
+	Done  bool
+	Err   error
+}
+
+// StreamCompletion sends a streaming request and returns the parsed chunks.
+// The channel is closed, and the response body released, when the stream
+// ends or an error occurs.
+func (c *Client) StreamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan StreamEvent, error) {
+	body, err := c.StreamCompletionRaw(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return parseSSEStream(ctx, body), nil
+}
+
+// parseSSEStream reads an SSE stream into a channel of events and closes r
+// once the stream is finished. It stops early when ctx is cancelled, so a
+// reader that gives up does not leave it blocked. Named events other than
+// "error", such as the GPU server's "status" while a model warms up, are
+// skipped.
+func parseSSEStream(ctx context.Context, r io.ReadCloser) <-chan StreamEvent {
+	ch := make(chan StreamEvent)
+	go func() {
+		defer close(ch)
+		defer r.Close()
+		send := func(ev StreamEvent) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				event = ""
+				continue
+			}
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+				continue
+			}
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+
+			switch event {
+			case "":
+			case "error":
+				send(StreamEvent{Err: api.DecodeError(0, []byte(data))})
+				return
+			default:
+				continue
+			}
+
+			if data == "[DONE]" {
+				send(StreamEvent{Done: true})
+				return
+			}
+
+			var chunk api.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				send(StreamEvent{Err: err})
+				return
+			}
+			if !send(StreamEvent{Chunk: &chunk, Usage: chunk.Usage}) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			send(StreamEvent{Err: err})
+		}
+	}()
+	return ch
+}
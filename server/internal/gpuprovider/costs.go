@@ -0,0 +1,225 @@
+package gpuprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// costSampleInterval is how often a machine's price and state are read
+// to add up its spend.
+const costSampleInterval = time.Minute
+
+// costHistoryDays is how many days of spend the ledger keeps.
+const costHistoryDays = 90
+
+// budgetWarnShare is the share of a budget at which clients are warned.
+const budgetWarnShare = 0.8
+
+// Budget caps what the GPU instance may cost, in dollars; zero fields are
+// not enforced. A budget that is used up stops the instance from being
+// started on demand; starting it explicitly still works.
+type Budget struct {
+	Daily  float64
+	Weekly float64 // from Monday
+}
+
+// Costs is what the GPU instance has cost.
+type Costs struct {
+	Provider     string    `json:"provider"`
+	Running      bool      `json:"running"`
+	RatePerHour  float64   `json:"rate_per_hour"` // dollars, as the provider prices the instance
+	Today        float64   `json:"today"`
+	Week         float64   `json:"week"`
+	DailyBudget  float64   `json:"daily_budget,omitempty"`
+	WeeklyBudget float64   `json:"weekly_budget,omitempty"`
+	Days         []DayCost `json:"days,omitempty"` // newest first
+}
+
+// DayCost is what the instance cost on one day.
+type DayCost struct {
+	Date    string  `json:"date"` // local, "2006-01-02"
+	Hours   float64 `json:"hours"`
+	Dollars float64 `json:"dollars"`
+}
+
+// costLedger adds up the instance's spend per day and keeps it in a JSON
+// file, so budgets hold across restarts.
+type costLedger struct {
+	path   string
+	budget Budget
+
+	mu       sync.Mutex
+	days     map[string]*DayCost
+	rate     float64
+	running  bool
+	lastSeen time.Time       // last sample of the instance running
+	alerted  map[string]bool // budget alerts sent, by period and level
+}
+
+func newCostLedger(path string, budget Budget) (*costLedger, error) {
+	l := &costLedger{path: path, budget: budget, days: make(map[string]*DayCost), alerted: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var days []*DayCost
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, d := range days {
+		l.days[d.Date] = d
+	}
+	return l, nil
+}
+
+// sample records the instance's state at now, charging rate for the time
+// since the last sample if it was running then too. A gap longer than two
+// intervals, such as the backend being down, is charged as one interval.
+func (l *costLedger) sample(now time.Time, rate float64, running bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.running = rate, running
+	if !running {
+		l.lastSeen = time.Time{}
+		return nil
+	}
+	last := l.lastSeen
+	l.lastSeen = now
+	if last.IsZero() {
+		return nil
+	}
+	elapsed := now.Sub(last)
+	if elapsed > 2*costSampleInterval {
+		elapsed = costSampleInterval
+	}
+	day := l.dayLocked(now)
+	day.Hours += elapsed.Hours()
+	day.Dollars += rate * elapsed.Hours()
+	return l.saveLocked(now)
+}
+
+func (l *costLedger) dayLocked(t time.Time) *DayCost {
+	date := t.Local().Format(time.DateOnly)
+	d := l.days[date]
+	if d == nil {
+		d = &DayCost{Date: date}
+		l.days[date] = d
+	}
+	return d
+}
+
+// saveLocked writes the ledger, dropping days older than costHistoryDays.
+func (l *costLedger) saveLocked(now time.Time) error {
+	cutoff := now.Local().AddDate(0, 0, -costHistoryDays).Format(time.DateOnly)
+	days := make([]*DayCost, 0, len(l.days))
+	for date, d := range l.days {
+		if date < cutoff {
+			delete(l.days, date)
+			continue
+		}
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date > days[j].Date })
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// spentLocked returns the spend of now's day and of its week, from Monday.
+func (l *costLedger) spentLocked(now time.Time) (today, week float64) {
+	now = now.Local()
+	monday := now.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	for t := monday; !t.After(now); t = t.AddDate(0, 0, 1) {
+		if d := l.days[t.Format(time.DateOnly)]; d != nil {
+			week += d.Dollars
+		}
+	}
+	if d := l.days[now.Format(time.DateOnly)]; d != nil {
+		today = d.Dollars
+	}
+	return today, week
+}
+
+// costs reports the spend, with the last days days.
+func (l *costLedger) costs(now time.Time, days int) *Costs {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := &Costs{
+		Running:      l.running,
+		RatePerHour:  l.rate,
+		DailyBudget:  l.budget.Daily,
+		WeeklyBudget: l.budget.Weekly,
+	}
+	c.Today, c.Week = l.spentLocked(now)
+	for i := range days {
+		if d := l.days[now.Local().AddDate(0, 0, -i).Format(time.DateOnly)]; d != nil {
+			c.Days = append(c.Days, *d)
+		}
+	}
+	return c
+}
+
+// overBudget returns an error naming the budget that is used up, or nil.
+func (l *costLedger) overBudget(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	today, week := l.spentLocked(now)
+	if l.budget.Daily > 0 && today >= l.budget.Daily {
+		return fmt.Errorf("daily GPU budget of $%.2f is used up ($%.2f spent today); start the instance explicitly to go over it", l.budget.Daily, today)
+	}
+	if l.budget.Weekly > 0 && week >= l.budget.Weekly {
+		return fmt.Errorf("weekly GPU budget of $%.2f is used up ($%.2f spent since Monday); start the instance explicitly to go over it", l.budget.Weekly, week)
+	}
+	return nil
+}
+
+// alerts returns the budget events due at now: one when a period's spend
+// passes budgetWarnShare of its budget and one when it passes the budget,
+// each sent once per period.
+func (l *costLedger) alerts(now time.Time) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	today, week := l.spentLocked(now)
+	local := now.Local()
+	year, isoWeek := local.ISOWeek()
+	var events []Event
+	for _, p := range []struct {
+		period, key   string
+		spent, budget float64
+	}{
+		{"day", local.Format(time.DateOnly), today, l.budget.Daily},
+		{"week", fmt.Sprintf("%d-W%02d", year, isoWeek), week, l.budget.Weekly},
+	} {
+		if p.budget <= 0 {
+			continue
+		}
+		for _, level := range []struct {
+			typ   string
+			share float64
+		}{{EventBudgetReached, 1}, {EventBudgetWarning, budgetWarnShare}} {
+			key := p.period + ":" + p.key + ":" + level.typ
+			if p.spent < p.budget*level.share || l.alerted[key] {
+				continue
+			}
+			l.alerted[key] = true
+			// Passing both levels at once sends only the higher.
+			l.alerted[p.period+":"+p.key+":"+EventBudgetWarning] = true
+			events = append(events, Event{Type: level.typ, Period: p.period, Spent: p.spent, Budget: p.budget})
+			break
+		}
+	}
+	return events
+}
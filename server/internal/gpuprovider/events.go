@@ -0,0 +1,40 @@
+package gpuprovider
+
+import "sync"
+
+// broadcaster fans events out to subscribers. A subscriber that falls
+// behind misses events rather than blocking the provider.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func (b *broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 8)
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *broadcaster) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package gpuprovider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+var logger = logging.For("gpuprovider")
+
+// idleWarning is how long before stopping an idle instance clients are
+// warned, or half the idle timeout if that is shorter.
+const idleWarning = 5 * time.Minute
+
+// InstanceProvider runs the GPU server on a Machine it starts on demand
+// and stops when idle, adding up what the machine costs.
+type InstanceProvider struct {
+	machine   Machine
+	gpuClient *gpuclient.Client
+	gpuURL    string
+	events    broadcaster
+	costs     *costLedger // nil unless TrackCosts was called
+
+	mu           sync.Mutex
+	idleTimeout  time.Duration
+	lastActivity time.Time
+	warned       bool // EventIdleWarning was sent in this idle period
+	idleStopped  bool // nothing to stop until the next activity
+	stopCh       chan struct{}
+	starting     bool
+}
+
+// NewInstanceProvider creates a provider for the GPU server at gpuURL,
+// which runs on machine.
+func NewInstanceProvider(machine Machine, gpuClient *gpuclient.Client, gpuURL string, idleTimeout time.Duration) *InstanceProvider {
+	return &InstanceProvider{
+		machine:      machine,
+		gpuClient:    gpuClient,
+		gpuURL:       gpuURL,
+		idleTimeout:  idleTimeout,
+		lastActivity: time.Now(),
+	}
+}
+
+// Machine returns the machine the GPU server runs on.
+func (p *InstanceProvider) Machine() Machine { return p.machine }
+
+// Name returns the machine's kind, e.g. "vastai".
+func (p *InstanceProvider) Name() string { return p.machine.Kind() }
+
+// RecordActivity resets the idle timer.
+func (p *InstanceProvider) RecordActivity() {
+	p.mu.Lock()
+	p.lastActivity = time.Now()
+	p.warned, p.idleStopped = false, false
+	p.mu.Unlock()
+}
+
+// SetIdleTimeout changes the idle timeout; the idle period so far counts
+// towards the new one.
+func (p *InstanceProvider) SetIdleTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("idle timeout must not be negative")
+	}
+	p.mu.Lock()
+	p.idleTimeout = d
+	p.warned = false
+	p.mu.Unlock()
+	logger.Info("idle timeout changed", "instance", p.machine.ID(), "idle_timeout", d)
+	return nil
+}
+
+// Subscribe returns the provider's idle warnings and stops.
+func (p *InstanceProvider) Subscribe() (<-chan Event, func()) {
+	return p.events.Subscribe()
+}
+
+// TrackCosts adds up the instance's spend in the JSON file at path and
+// enforces budget. Call it before StartIdleTimer.
+func (p *InstanceProvider) TrackCosts(path string, budget Budget) error {
+	ledger, err := newCostLedger(path, budget)
+	if err != nil {
+		return err
+	}
+	p.costs = ledger
+	return nil
+}
+
+// EnsureRunning starts the instance if stopped, unless the budget is used
+// up, and waits until the GPU server is healthy.
+func (p *InstanceProvider) EnsureRunning(ctx context.Context) error {
+	return p.start(ctx, true)
+}
+
+// Start starts the instance if stopped, over budget or not, and waits
+// until the GPU server is healthy.
+func (p *InstanceProvider) Start(ctx context.Context) error {
+	return p.start(ctx, false)
+}
+
+func (p *InstanceProvider) start(ctx context.Context, checkBudget bool) error {
+	p.mu.Lock()
+	if p.starting {
+		p.mu.Unlock()
+		return p.waitForHealthy(ctx)
+	}
+	p.mu.Unlock()
+
+	if err := p.gpuClient.Health(ctx); err == nil {
+		return nil
+	}
+	if checkBudget && p.costs != nil {
+		if err := p.costs.overBudget(time.Now()); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.starting = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.starting = false
+		p.mu.Unlock()
+	}()
+
+	logger.Info("starting GPU instance", "provider", p.Name(), "instance", p.machine.ID())
+	if err := p.machine.Start(ctx); err != nil {
+		return fmt.Errorf("start instance: %w", err)
+	}
+
+	if err := p.waitForHealthy(ctx); err != nil {
+		return err
+	}
+	// The idle timeout runs from when the instance came up.
+	p.RecordActivity()
+	return nil
+}
+
+func (p *InstanceProvider) waitForHealthy(ctx context.Context) error {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	timeout := time.After(5 * time.Minute)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for GPU server to become healthy")
+		case <-ticker.C:
+			if err := p.gpuClient.Health(ctx); err == nil {
+				logger.Info("GPU server is healthy", "instance", p.machine.ID())
+				return nil
+			}
+		}
+	}
+}
+
+// Status returns the current instance status.
+func (p *InstanceProvider) Status(ctx context.Context) (*Status, error) {
+	if err := p.gpuClient.Health(ctx); err == nil {
+		p.mu.Lock()
+		idle, timeout := p.lastActivity, p.idleTimeout
+		p.mu.Unlock()
+		status := &Status{
+			State:     "running",
+			Provider:  p.Name(),
+			GPUURL:    p.gpuURL,
+			IdleSince: &idle,
+		}
+		if timeout > 0 {
+			stopAt := idle.Add(timeout)
+			status.AutoStopAfter, status.StopAt = timeout.String(), &stopAt
+		}
+		return status, nil
+	}
+
+	if state, err := p.machine.State(ctx); err == nil {
+		return &Status{
+			State:    state.Status,
+			Provider: p.Name(),
+			GPUURL:   p.gpuURL,
+		}, nil
+	}
+
+	return &Status{State: "stopped", Provider: p.Name()}, nil
+}
+
+// Stop stops the GPU instance.
+func (p *InstanceProvider) Stop(ctx context.Context) error {
+	logger.Info("stopping GPU instance", "provider", p.Name(), "instance", p.machine.ID())
+	return p.machine.Stop(ctx)
+}
+
+// StartIdleTimer starts a goroutine that stops the instance after
+// idleTimeout of no requests, warning subscribers first. Once stopped,
+// the instance is stopped again after the next idle period.
+func (p *InstanceProvider) StartIdleTimer() {
+	p.mu.Lock()
+	if p.stopCh != nil {
+		close(p.stopCh)
+	}
+	p.stopCh = make(chan struct{})
+	stopCh := p.stopCh
+	p.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		costTicker := time.NewTicker(costSampleInterval)
+		defer costTicker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				p.checkIdle()
+			case <-costTicker.C:
+				p.sampleCost()
+			}
+		}
+	}()
+}
+
+// sampleCost adds the time since the last sample to the spend if the
+// instance is running, and sends the budget alerts that are due.
+func (p *InstanceProvider) sampleCost() {
+	if p.costs == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	state, err := p.machine.State(ctx)
+	if err != nil {
+		logger.Debug("reading instance price failed", "instance", p.machine.ID(), "err", err)
+		return
+	}
+	now := time.Now()
+	if err := p.costs.sample(now, state.CostPerHr, state.Status == "running"); err != nil {
+		logger.Error("saving instance costs failed", "err", err)
+	}
+	for _, e := range p.costs.alerts(now) {
+		logger.Warn("GPU budget", "event", e.Type, "period", e.Period, "spent", fmt.Sprintf("%.2f", e.Spent), "budget", fmt.Sprintf("%.2f", e.Budget))
+		p.events.publish(e)
+	}
+}
+
+// Costs reports the instance's spend; without TrackCosts only its price
+// is known.
+func (p *InstanceProvider) Costs(ctx context.Context) (*Costs, error) {
+	if p.costs == nil {
+		c := &Costs{Provider: p.Name()}
+		if state, err := p.machine.State(ctx); err == nil {
+			c.Running, c.RatePerHour = state.Status == "running", state.CostPerHr
+		}
+		return c, nil
+	}
+	c := p.costs.costs(time.Now(), 30)
+	c.Provider = p.Name()
+	return c, nil
+}
+
+// checkIdle warns about or stops an idle running instance. An instance
+// training a fine-tune is not idle, and one that is already down has
+// nothing to stop until requests start it again.
+func (p *InstanceProvider) checkIdle() {
+	p.mu.Lock()
+	timeout, last, warned, done := p.idleTimeout, p.lastActivity, p.warned, p.idleStopped
+	p.mu.Unlock()
+	idle := time.Since(last)
+	if timeout <= 0 || done || idle < timeout-min(idleWarning, timeout/2) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.gpuClient.Health(ctx); err != nil {
+		p.mu.Lock()
+		p.idleStopped = p.lastActivity.Equal(last)
+		p.mu.Unlock()
+		return
+	}
+	if runs, err := p.gpuClient.FinetuneRuns(ctx); err == nil && slices.ContainsFunc(runs, func(r api.FinetuneRun) bool {
+		return r.Status == api.FinetuneTraining
+	}) {
+		p.RecordActivity()
+		return
+	}
+
+	if idle < timeout {
+		if !warned {
+			stopAt := last.Add(timeout)
+			p.mu.Lock()
+			p.warned = true
+			p.mu.Unlock()
+			logger.Info("instance idle, stopping soon", "instance", p.machine.ID(), "stop_at", stopAt.Format(time.Kitchen))
+			p.events.publish(Event{Type: EventIdleWarning, StopAt: &stopAt, Idle: idle.Round(time.Second).String()})
+		}
+		return
+	}
+
+	logger.Info("instance idle, stopping", "instance", p.machine.ID(), "idle", idle.Round(time.Second))
+	if err := p.Stop(ctx); err != nil {
+		logger.Error("failed to stop idle instance", "instance", p.machine.ID(), "err", err)
+		return
+	}
+	p.mu.Lock()
+	p.idleStopped = p.lastActivity.Equal(last)
+	p.mu.Unlock()
+	p.events.publish(Event{Type: EventStopped, Idle: idle.Round(time.Second).String()})
+}
+
+// Close stops the idle timer.
+func (p *InstanceProvider) Close() {
+	p.mu.Lock()
+	if p.stopCh != nil {
+		close(p.stopCh)
+		p.stopCh = nil
+	}
+	p.mu.Unlock()
+}
@@ -2,6 +2,8 @@ package gpuprovider
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
 )
@@ -23,6 +25,10 @@ func (p *LocalProvider) EnsureRunning(ctx context.Context) error {
 	return p.gpuClient.Health(ctx)
 }
 
+func (p *LocalProvider) Start(ctx context.Context) error {
+	return p.EnsureRunning(ctx)
+}
+
 func (p *LocalProvider) RecordActivity() {}
 
 func (p *LocalProvider) Status(ctx context.Context) (*Status, error) {
@@ -40,3 +46,19 @@ func (p *LocalProvider) Status(ctx context.Context) (*Status, error) {
 func (p *LocalProvider) Stop(ctx context.Context) error { return nil }
 func (p *LocalProvider) StartIdleTimer()                {}
 func (p *LocalProvider) Close()                         {}
+
+// SetIdleTimeout fails: a local GPU server is not stopped when idle.
+func (p *LocalProvider) SetIdleTimeout(time.Duration) error {
+	return errors.New("auto-stop needs a GPU instance (--gpu-provider); the local GPU server keeps running")
+}
+
+// Subscribe returns a channel that never receives: a local GPU server
+// has no events.
+func (p *LocalProvider) Subscribe() (<-chan Event, func()) {
+	return make(chan Event), func() {}
+}
+
+// Costs reports nothing: a local GPU is not billed by the hour.
+func (p *LocalProvider) Costs(ctx context.Context) (*Costs, error) {
+	return &Costs{Provider: "local"}, nil
+}
@@ -3,24 +3,98 @@ package gpuprovider
 import (
 	"context"
 	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
 )
 
 // Provider abstracts GPU backend lifecycle management.
-// Implementations include LocalProvider (static GPU URL) and VastAIProvider (vast.ai instance).
+// Implementations include LocalProvider (static GPU URL) and InstanceProvider
+// (a Machine started on demand: vast.ai, RunPod or an SSH host).
 type Provider interface {
 	Name() string
+	// EnsureRunning starts the GPU on demand, unless its budget is used
+	// up, and waits until it serves requests.
 	EnsureRunning(ctx context.Context) error
+	// Start is EnsureRunning for an explicit request, which may go over
+	// the budget.
+	Start(ctx context.Context) error
 	RecordActivity()
 	Status(ctx context.Context) (*Status, error)
 	Stop(ctx context.Context) error
 	StartIdleTimer()
+	// SetIdleTimeout changes how long the GPU may go without requests
+	// before it is stopped; 0 turns auto-stop off.
+	SetIdleTimeout(d time.Duration) error
+	// Subscribe returns a channel of the provider's events and a function
+	// that ends the subscription.
+	Subscribe() (<-chan Event, func())
+	// Costs reports what the GPU has cost against its budget.
+	Costs(ctx context.Context) (*Costs, error)
 	Close()
 }
 
+// Machine is a host the GPU server runs on that InstanceProvider starts
+// and stops: a marketplace instance or a server of one's own.
+type Machine interface {
+	// Kind names the provider, e.g. "vastai"; it is Status.Provider.
+	Kind() string
+	// ID identifies the machine in logs.
+	ID() string
+	// Start asks for the machine to run the GPU server; it need not wait
+	// until the server is up.
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// State reports whether the machine is running and what it costs.
+	State(ctx context.Context) (*MachineState, error)
+}
+
+// SSHReachable is a Machine whose SSH server is known, so the backend can
+// tunnel to the GPU server through it (serve --tunnel instance).
+type SSHReachable interface {
+	SSHEndpoint(ctx context.Context) (tunnel.Endpoint, error)
+}
+
+// MachineState is a Machine's state as its provider reports it.
+type MachineState struct {
+	Status    string  // "running", "stopped", or the provider's word, e.g. "loading"
+	CostPerHr float64 // dollars
+}
+
 // Status represents the current GPU provider status.
 type Status struct {
-	State    string     `json:"status"`
-	Provider string     `json:"provider"`
-	GPUURL   string     `json:"gpu_url,omitempty"`
+	State     string     `json:"status"`
+	Provider  string     `json:"provider"`
+	GPUURL    string     `json:"gpu_url,omitempty"`
 	IdleSince *time.Time `json:"idle_since,omitempty"`
+	// AutoStopAfter is the idle timeout, e.g. "30m0s"; "" when auto-stop
+	// is off.
+	AutoStopAfter string         `json:"auto_stop_after,omitempty"`
+	StopAt        *time.Time     `json:"stop_at,omitempty"` // when an idle running instance will be stopped
+	Tunnel        *tunnel.Status `json:"tunnel,omitempty"`  // the SSH tunnel to the GPU server, if there is one
+}
+
+// Event types.
+const (
+	// EventIdleWarning is sent once per idle period, idleWarning before an
+	// idle instance is stopped.
+	EventIdleWarning = "idle_warning"
+	// EventStopped is sent when an idle instance has been stopped.
+	EventStopped = "stopped"
+	// EventBudgetWarning is sent once per period when the instance's
+	// spend passes budgetWarnShare of the period's budget, and
+	// EventBudgetReached when it passes the budget.
+	EventBudgetWarning = "budget_warning"
+	EventBudgetReached = "budget_reached"
+)
+
+// Event is a change in the GPU's state that clients are told about.
+type Event struct {
+	Type   string     `json:"type"`
+	StopAt *time.Time `json:"stop_at,omitempty"` // for EventIdleWarning
+	Idle   string     `json:"idle,omitempty"`    // how long the GPU has been idle, e.g. "25m0s"
+	// Period ("day" or "week"), Spent and Budget, in dollars, are set
+	// for budget events.
+	Period string  `json:"period,omitempty"`
+	Spent  float64 `json:"spent,omitempty"`
+	Budget float64 `json:"budget,omitempty"`
 }
@@ -0,0 +1,63 @@
+package gpuprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/runpod"
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
+)
+
+// RunPodMachine is a RunPod pod. Stopping it keeps its volume, so the
+// models on it survive until the next start.
+type RunPodMachine struct {
+	client *runpod.Client
+	podID  string
+}
+
+// NewRunPodMachine returns the RunPod pod podID.
+func NewRunPodMachine(client *runpod.Client, podID string) *RunPodMachine {
+	return &RunPodMachine{client: client, podID: podID}
+}
+
+func (m *RunPodMachine) Kind() string { return "runpod" }
+func (m *RunPodMachine) ID() string   { return m.podID }
+
+func (m *RunPodMachine) Start(ctx context.Context) error {
+	return m.client.StartPod(ctx, m.podID)
+}
+
+func (m *RunPodMachine) Stop(ctx context.Context) error {
+	return m.client.StopPod(ctx, m.podID)
+}
+
+// State reports the pod's desiredStatus, "exited" as "stopped", and its
+// costPerHr.
+func (m *RunPodMachine) State(ctx context.Context) (*MachineState, error) {
+	pod, err := m.client.GetPod(ctx, m.podID)
+	if err != nil {
+		return nil, err
+	}
+	status := strings.ToLower(pod.DesiredStatus)
+	if pod.DesiredStatus == runpod.StatusExited {
+		status = "stopped"
+	}
+	return &MachineState{Status: status, CostPerHr: pod.CostPerHr}, nil
+}
+
+// SSHEndpoint returns the pod's public IP and the port its SSH port 22 is
+// mapped to; the pod must expose 22/tcp.
+func (m *RunPodMachine) SSHEndpoint(ctx context.Context) (tunnel.Endpoint, error) {
+	pod, err := m.client.GetPod(ctx, m.podID)
+	if err != nil {
+		return tunnel.Endpoint{}, err
+	}
+	port := pod.PortMappings["22"]
+	if pod.PublicIP == "" || port == 0 {
+		return tunnel.Endpoint{}, fmt.Errorf("pod %s has no public SSH port; expose 22/tcp", m.podID)
+	}
+	return tunnel.Endpoint{User: "root", Addr: net.JoinHostPort(pod.PublicIP, strconv.Itoa(port))}, nil
+}
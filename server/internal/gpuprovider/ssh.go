@@ -0,0 +1,162 @@
+package gpuprovider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
+)
+
+// sshWakeTimeout is how long Start waits for a woken host to accept SSH.
+const sshWakeTimeout = 3 * time.Minute
+
+// SSHMachine is a server of one's own, reached with the system's ssh. Start
+// wakes it with a Wake-on-LAN packet, if given a MAC address, and starts
+// the systemd unit running the GPU server; Stop shuts the host down. The
+// SSH user needs passwordless sudo for systemctl and shutdown, and keys and
+// ports come from ~/.ssh/config.
+type SSHMachine struct {
+	host    string // [user@]host, as ssh takes it
+	unit    string
+	wakeMAC net.HardwareAddr // nil: the host is never shut down remotely
+	rate    float64          // dollars per hour, e.g. for power
+}
+
+// NewSSHMachine returns the host running the GPU server as unit. wakeMAC,
+// the MAC address to send Wake-on-LAN packets to, may be empty; without it
+// Stop only stops the unit, since nothing could bring the host back.
+func NewSSHMachine(host, unit, wakeMAC string, costPerHr float64) (*SSHMachine, error) {
+	if host == "" || unit == "" {
+		return nil, errors.New("SSH host and unit must be set")
+	}
+	m := &SSHMachine{host: host, unit: unit, rate: costPerHr}
+	if wakeMAC != "" {
+		mac, err := net.ParseMAC(wakeMAC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wake MAC address: %w", err)
+		}
+		m.wakeMAC = mac
+	}
+	return m, nil
+}
+
+func (m *SSHMachine) Kind() string { return "ssh" }
+func (m *SSHMachine) ID() string   { return m.host }
+
+// Start wakes the host if it is down and starts the unit.
+func (m *SSHMachine) Start(ctx context.Context) error {
+	if m.wakeMAC != nil {
+		if _, err := m.ssh(ctx, "true"); err != nil {
+			if err := m.wake(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := m.ssh(ctx, "sudo", "-n", "systemctl", "start", m.unit); err != nil {
+		return fmt.Errorf("start %s: %w", m.unit, err)
+	}
+	return nil
+}
+
+// wake sends Wake-on-LAN packets until the host accepts SSH or
+// sshWakeTimeout passes.
+func (m *SSHMachine) wake(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sshWakeTimeout)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := sendMagicPacket(m.wakeMAC); err != nil {
+			return fmt.Errorf("wake %s: %w", m.host, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wake %s: host did not come up", m.host)
+		case <-ticker.C:
+		}
+		if _, err := m.ssh(ctx, "true"); err == nil {
+			logger.Info("SSH host woke up", "host", m.host)
+			return nil
+		}
+	}
+}
+
+// Stop shuts the host down, or only stops the unit when it could not be
+// woken again. The connection dropping as the host goes down is not an
+// error.
+func (m *SSHMachine) Stop(ctx context.Context) error {
+	if m.wakeMAC == nil {
+		if _, err := m.ssh(ctx, "sudo", "-n", "systemctl", "stop", m.unit); err != nil {
+			return fmt.Errorf("stop %s: %w", m.unit, err)
+		}
+		return nil
+	}
+	_, err := m.ssh(ctx, "sudo", "-n", "shutdown", "-h", "now")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 255 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("shut down %s: %w", m.host, err)
+	}
+	return nil
+}
+
+// State reports the unit as running or activating ("loading"), and the
+// host as stopped when it is unreachable or the unit is not running.
+func (m *SSHMachine) State(ctx context.Context) (*MachineState, error) {
+	state := &MachineState{Status: "stopped", CostPerHr: m.rate}
+	// is-active exits non-zero for inactive units; the output says why.
+	out, _ := m.ssh(ctx, "systemctl", "is-active", m.unit)
+	switch strings.TrimSpace(out) {
+	case "active":
+		state.Status = "running"
+	case "activating", "reloading":
+		state.Status = "loading"
+	}
+	return state, nil
+}
+
+// SSHEndpoint returns the host as an address to dial, logging in as the
+// host's user or the local one. Aliases from ~/.ssh/config are not
+// resolved here.
+func (m *SSHMachine) SSHEndpoint(context.Context) (tunnel.Endpoint, error) {
+	return tunnel.ParseEndpoint(m.host, os.Getenv("USER"))
+}
+
+// ssh runs a command on the host and returns its output. Exit status 255
+// means ssh itself failed, e.g. the host is down.
+func (m *SSHMachine) ssh(ctx context.Context, command ...string) (string, error) {
+	args := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", m.host, "--"}, command...)
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return string(out), fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), err
+}
+
+// sendMagicPacket broadcasts a Wake-on-LAN packet for mac: six 0xff bytes
+// followed by the address sixteen times.
+func sendMagicPacket(mac net.HardwareAddr) error {
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	conn, err := net.Dial("udp4", "255.255.255.255:9")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
@@ -0,0 +1,85 @@
+// Package logging configures the process-wide slog logger and hands out
+// loggers tagged with the component that logs.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats accepted by Setup.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Setup makes slog's default logger write to stderr at level ("debug",
+// "info", "warn" or "error") in format (FormatText or FormatJSON). Loggers
+// from For follow it even when they were created first.
+func Setup(level, format string) error {
+	return setup(os.Stderr, level, format)
+}
+
+func setup(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: want debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: want %s or %s", format, FormatText, FormatJSON)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// For returns a logger whose records carry component=name. It is safe to
+// keep in a package variable: records go to whatever handler slog's
+// default logger has when they are logged.
+func For(name string) *slog.Logger {
+	return slog.New(deferred{}).With("component", name)
+}
+
+// deferred is a slog.Handler that resolves the default handler per record,
+// replaying the attributes and groups added to it.
+type deferred struct {
+	steps []func(slog.Handler) slog.Handler
+}
+
+func (d deferred) handler() slog.Handler {
+	h := slog.Default().Handler()
+	for _, step := range d.steps {
+		h = step(h)
+	}
+	return h
+}
+
+func (d deferred) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (d deferred) Handle(ctx context.Context, r slog.Record) error {
+	return d.handler().Handle(ctx, r)
+}
+
+func (d deferred) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return d.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (d deferred) WithGroup(name string) slog.Handler {
+	return d.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (d deferred) with(step func(slog.Handler) slog.Handler) deferred {
+	return deferred{steps: append(d.steps[:len(d.steps):len(d.steps)], step)}
+}
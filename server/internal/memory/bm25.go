@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 defaults from the literature; they work well for short documents.
+const (
+	defaultBM25K1 = 1.2
+	defaultBM25B  = 0.75
+)
+
+// bm25Index is an inverted index over entry content scored with Okapi BM25.
+// It is not safe for concurrent use; ChromemStore guards it with its mutex.
+type bm25Index struct {
+	Postings map[string]map[string]int `json:"postings"` // term -> entry ID -> term frequency
+	DocLens  map[string]int            `json:"doc_lens"` // entry ID -> token count
+	TotalLen int                       `json:"total_len"`
+
+	k1, b float64
+}
+
+type bm25Hit struct {
+	id    string
+	score float64
+}
+
+func newBM25Index(k1, b float64) *bm25Index {
+	return &bm25Index{
+		Postings: make(map[string]map[string]int),
+		DocLens:  make(map[string]int),
+		k1:       k1,
+		b:        b,
+	}
+}
+
+// add indexes text under id, replacing any previous version.
+func (ix *bm25Index) add(id, text string) {
+	if _, ok := ix.DocLens[id]; ok {
+		ix.remove(id)
+	}
+	terms := tokenize(text)
+	for _, t := range terms {
+		docs := ix.Postings[t]
+		if docs == nil {
+			docs = make(map[string]int)
+			ix.Postings[t] = docs
+		}
+		docs[id]++
+	}
+	ix.DocLens[id] = len(terms)
+	ix.TotalLen += len(terms)
+}
+
+// remove drops id from the index. It walks every posting list, which is fine
+// for deletes but keeps the on-disk format free of per-document term lists.
+func (ix *bm25Index) remove(id string) {
+	n, ok := ix.DocLens[id]
+	if !ok {
+		return
+	}
+	for term, docs := range ix.Postings {
+		if _, ok := docs[id]; ok {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(ix.Postings, term)
+			}
+		}
+	}
+	delete(ix.DocLens, id)
+	ix.TotalLen -= n
+}
+
+// search returns up to limit entries ranked by BM25 score against query.
+func (ix *bm25Index) search(query string, limit int) []bm25Hit {
+	n := len(ix.DocLens)
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(ix.TotalLen) / float64(n)
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		docs := ix.Postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for id, tf := range docs {
+			f := float64(tf)
+			norm := ix.k1 * (1 - ix.b + ix.b*float64(ix.DocLens[id])/avgLen)
+			scores[id] += idf * f * (ix.k1 + 1) / (f + norm)
+		}
+	}
+
+	hits := make([]bm25Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, bm25Hit{id: id, score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func (ix *bm25Index) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	loaded := newBM25Index(ix.k1, ix.b)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return err
+	}
+	*ix = *loaded
+	return nil
+}
+
+// tokenize lowercases text and splits it on anything that is not a letter
+// or digit, dropping tokens shorter than three characters.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if len(f) >= 3 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -15,23 +15,29 @@ import (
 	"github.com/philippgille/chromem-go"
 )
 
-// ChromemStore implements Store using chromem-go for vector storage with hybrid search.
+// ChromemStore implements Store using chromem-go for vector storage and a
+// BM25 inverted index for keyword scoring.
 type ChromemStore struct {
 	db         *chromem.DB
 	collection *chromem.Collection
 	entries    map[string]Entry
+	keywords   *bm25Index
+	embedder   *cachingEmbedder
+	cfg        Config
 	mu         sync.RWMutex
-	persistDir string // empty for in-memory
+	saveMu     sync.Mutex // serializes saveIndex
+	persistDir string     // empty for in-memory
 }
 
 // NewChromemStore creates a persistent ChromemStore backed by chromem-go.
-func NewChromemStore(persistDir string, embedFunc EmbedFunc) (*ChromemStore, error) {
+func NewChromemStore(persistDir string, embed BatchEmbedFunc, cfg Config) (*ChromemStore, error) {
 	db, err := chromem.NewPersistentDB(persistDir, false)
 	if err != nil {
 		return nil, fmt.Errorf("create persistent DB: %w", err)
 	}
 
-	col, err := db.GetOrCreateCollection("memories", nil, chromem.EmbeddingFunc(embedFunc))
+	embedder := newCachingEmbedder(embed, filepath.Join(persistDir, "embedding_cache.json"), cfg)
+	col, err := db.GetOrCreateCollection("memories", nil, embedder.embedOne)
 	if err != nil {
 		return nil, fmt.Errorf("get or create collection: %w", err)
 	}
@@ -40,6 +46,9 @@ func NewChromemStore(persistDir string, embedFunc EmbedFunc) (*ChromemStore, err
 		db:         db,
 		collection: col,
 		entries:    make(map[string]Entry),
+		keywords:   newBM25Index(cfg.BM25K1, cfg.BM25B),
+		embedder:   embedder,
+		cfg:        cfg,
 		persistDir: persistDir,
 	}
 
@@ -49,13 +58,25 @@ func NewChromemStore(persistDir string, embedFunc EmbedFunc) (*ChromemStore, err
 		_ = err
 	}
 
+	// Stores created before the keyword index existed have no index file;
+	// rebuild it from the entries.
+	if err := s.keywords.load(s.keywordIndexPath()); err != nil {
+		s.mu.Lock()
+		for id, e := range s.entries {
+			s.keywords.add(id, e.Content())
+		}
+		s.mu.Unlock()
+		s.saveIndex()
+	}
+
 	return s, nil
 }
 
 // NewChromemStoreInMemory creates an in-memory ChromemStore for testing.
-func NewChromemStoreInMemory(embedFunc EmbedFunc) (*ChromemStore, error) {
+func NewChromemStoreInMemory(embed BatchEmbedFunc, cfg Config) (*ChromemStore, error) {
 	db := chromem.NewDB()
-	col, err := db.GetOrCreateCollection("memories", nil, chromem.EmbeddingFunc(embedFunc))
+	embedder := newCachingEmbedder(embed, "", cfg)
+	col, err := db.GetOrCreateCollection("memories", nil, embedder.embedOne)
 	if err != nil {
 		return nil, fmt.Errorf("get or create collection: %w", err)
 	}
@@ -64,34 +85,63 @@ func NewChromemStoreInMemory(embedFunc EmbedFunc) (*ChromemStore, error) {
 		db:         db,
 		collection: col,
 		entries:    make(map[string]Entry),
+		keywords:   newBM25Index(cfg.BM25K1, cfg.BM25B),
+		embedder:   embedder,
+		cfg:        cfg,
 	}, nil
 }
 
 func (s *ChromemStore) Add(ctx context.Context, entry Entry) error {
-	if entry.ID == "" {
-		entry.ID = uuid.New().String()
+	return s.AddBatch(ctx, []Entry{entry})
+}
+
+// AddBatch embeds all entries with as few embedding requests as possible,
+// reusing cached vectors for content that has been embedded before.
+func (s *ChromemStore) AddBatch(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
 	}
-	if entry.Timestamp.IsZero() {
-		entry.Timestamp = time.Now()
+
+	texts := make([]string, len(entries))
+	for i := range entries {
+		if entries[i].ID == "" {
+			entries[i].ID = uuid.New().String()
+		}
+		if entries[i].Timestamp.IsZero() {
+			entries[i].Timestamp = time.Now()
+		}
+		texts[i] = entries[i].Content()
+	}
+
+	vecs, err := s.embedder.embedBatch(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embed entries: %w", err)
 	}
 
-	doc := chromem.Document{
-		ID:      entry.ID,
-		Content: entry.Content(),
-		Metadata: map[string]string{
-			"user_msg":   entry.UserMsg,
-			"assist_msg": entry.AssistMsg,
-			"timestamp":  entry.Timestamp.Format(time.RFC3339),
-			"session_id": entry.SessionID,
-		},
+	docs := make([]chromem.Document, len(entries))
+	for i, entry := range entries {
+		docs[i] = chromem.Document{
+			ID:        entry.ID,
+			Content:   texts[i],
+			Embedding: vecs[i],
+			Metadata: map[string]string{
+				"user_msg":   entry.UserMsg,
+				"assist_msg": entry.AssistMsg,
+				"timestamp":  entry.Timestamp.Format(time.RFC3339),
+				"session_id": entry.SessionID,
+			},
+		}
 	}
 
-	if err := s.collection.AddDocument(ctx, doc); err != nil {
-		return fmt.Errorf("add document: %w", err)
+	if err := s.collection.AddDocuments(ctx, docs, runtime.NumCPU()); err != nil {
+		return fmt.Errorf("add documents: %w", err)
 	}
 
 	s.mu.Lock()
-	s.entries[entry.ID] = entry
+	for i, entry := range entries {
+		s.entries[entry.ID] = entry
+		s.keywords.add(entry.ID, texts[i])
+	}
 	s.mu.Unlock()
 
 	s.saveIndex()
@@ -99,6 +149,19 @@ func (s *ChromemStore) Add(ctx context.Context, entry Entry) error {
 }
 
 func (s *ChromemStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return s.search(ctx, query, limit, "")
+}
+
+func (s *ChromemStore) SearchSession(ctx context.Context, sessionID, query string, limit int) ([]SearchResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session ID must not be empty")
+	}
+	return s.search(ctx, query, limit, sessionID)
+}
+
+// search ranks the entries matching query, only those of sessionID unless
+// it is empty.
+func (s *ChromemStore) search(ctx context.Context, query string, limit int, sessionID string) ([]SearchResult, error) {
 	if limit <= 0 {
 		limit = 5
 	}
@@ -108,32 +171,85 @@ func (s *ChromemStore) Search(ctx context.Context, query string, limit int) ([]S
 		return nil, nil
 	}
 
-	// Query up to limit results (but not more than count)
-	nResults := limit
+	// Pull a wider candidate pool from each index so entries that rank
+	// highly on only one signal can still surface in the combined ranking.
+	nCandidates := limit * 4
+	if nCandidates < 20 {
+		nCandidates = 20
+	}
+	nResults := nCandidates
 	if nResults > count {
 		nResults = count
 	}
 
-	results, err := s.collection.Query(ctx, query, nResults, nil, nil)
+	var where map[string]string
+	if sessionID != "" {
+		where = map[string]string{"session_id": sessionID}
+	}
+	results, err := s.collection.Query(ctx, query, nResults, where, nil)
 	if err != nil {
 		return nil, fmt.Errorf("query collection: %w", err)
 	}
 
-	// Compute hybrid scores: 70% semantic + 30% keyword
-	queryWords := extractWords(query)
-	searchResults := make([]SearchResult, 0, len(results))
+	s.mu.RLock()
+	hits := s.keywords.search(query, nCandidates)
+	s.mu.RUnlock()
 
-	for _, r := range results {
-		entry := s.entryFromResult(r)
-		kwScore := keywordScore(queryWords, r.Content)
+	var maxKeyword float64
+	keyword := make(map[string]float64, len(hits))
+	for _, h := range hits {
+		keyword[h.id] = h.score
+		if h.score > maxKeyword {
+			maxKeyword = h.score
+		}
+	}
+	normKeyword := func(id string) float32 {
+		if maxKeyword == 0 {
+			return 0
+		}
+		return float32(keyword[id] / maxKeyword)
+	}
 
-		sr := SearchResult{
-			Entry:         entry,
+	w := s.cfg.KeywordWeight
+	searchResults := make([]SearchResult, 0, len(results)+len(hits))
+	seen := make(map[string]bool, len(results))
+
+	for _, r := range results {
+		seen[r.ID] = true
+		kwScore := normKeyword(r.ID)
+		searchResults = append(searchResults, SearchResult{
+			Entry:         s.entryFromResult(r),
 			SemanticScore: r.Similarity,
 			KeywordScore:  kwScore,
-			CombinedScore: 0.7*r.Similarity + 0.3*kwScore,
+			CombinedScore: (1-w)*r.Similarity + w*kwScore,
+		})
+	}
+
+	// Keyword-only candidates fell outside the semantic top-N, so they get no
+	// semantic credit.
+	s.mu.RLock()
+	for _, h := range hits {
+		if seen[h.id] {
+			continue
+		}
+		entry, ok := s.entries[h.id]
+		if !ok || sessionID != "" && entry.SessionID != sessionID {
+			continue
 		}
-		searchResults = append(searchResults, sr)
+		kwScore := normKeyword(h.id)
+		searchResults = append(searchResults, SearchResult{
+			Entry:         entry,
+			KeywordScore:  kwScore,
+			CombinedScore: w * kwScore,
+		})
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	for i := range searchResults {
+		r := &searchResults[i]
+		r.RecencyScore = freshness(r.Entry, now, s.cfg.RecencyHalfLife)
+		r.CombinedScore *= recencyFloor + (1-recencyFloor)*r.RecencyScore
 	}
 
 	// Sort by combined score descending
@@ -141,6 +257,9 @@ func (s *ChromemStore) Search(ctx context.Context, query string, limit int) ([]S
 		return searchResults[i].CombinedScore > searchResults[j].CombinedScore
 	})
 
+	if len(searchResults) > limit {
+		searchResults = searchResults[:limit]
+	}
 	return searchResults, nil
 }
 
@@ -165,6 +284,76 @@ func (s *ChromemStore) List(ctx context.Context, limit int) ([]Entry, error) {
 	return entries, nil
 }
 
+func (s *ChromemStore) Export(ctx context.Context) ([]ExportedEntry, error) {
+	entries, err := s.List(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ExportedEntry, len(entries))
+	for i, e := range entries {
+		doc, err := s.collection.GetByID(ctx, e.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get document %s: %w", e.ID, err)
+		}
+		// List is newest first; exports read better oldest first.
+		out[len(entries)-1-i] = ExportedEntry{Entry: e, Embedding: doc.Embedding}
+	}
+	return out, nil
+}
+
+func (s *ChromemStore) Import(ctx context.Context, entries []ExportedEntry) error {
+	plain := make([]Entry, len(entries))
+	for i, e := range entries {
+		plain[i] = e.Entry
+		// Seeding the cache lets AddBatch reuse the exported vectors.
+		if len(e.Embedding) > 0 {
+			s.embedder.cache.put(e.Content(), e.Embedding)
+		}
+	}
+	return s.AddBatch(ctx, plain)
+}
+
+func (s *ChromemStore) SetImportance(ctx context.Context, id string, importance float32) error {
+	if importance < 0 || importance > 1 {
+		return fmt.Errorf("importance must be between 0 and 1, got %v", importance)
+	}
+
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	if ok {
+		e.Importance = importance
+		s.entries[id] = e
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("memory %s not found", id)
+	}
+	s.saveIndex()
+	return nil
+}
+
+func (s *ChromemStore) SetRating(ctx context.Context, id string, rating int) error {
+	if rating < -1 || rating > 1 {
+		return fmt.Errorf("rating must be -1, 0 or 1, got %d", rating)
+	}
+
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	if ok {
+		e.Rating = rating
+		s.entries[id] = e
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("memory %s not found", id)
+	}
+	s.saveIndex()
+	return nil
+}
+
 func (s *ChromemStore) Delete(ctx context.Context, id string) error {
 	if err := s.collection.Delete(ctx, nil, nil, id); err != nil {
 		return fmt.Errorf("delete document: %w", err)
@@ -172,6 +361,7 @@ func (s *ChromemStore) Delete(ctx context.Context, id string) error {
 
 	s.mu.Lock()
 	delete(s.entries, id)
+	s.keywords.remove(id)
 	s.mu.Unlock()
 
 	s.saveIndex()
@@ -185,6 +375,7 @@ func (s *ChromemStore) Clear(ctx context.Context) error {
 		ids = append(ids, id)
 	}
 	s.entries = make(map[string]Entry)
+	s.keywords = newBM25Index(s.cfg.BM25K1, s.cfg.BM25B)
 	s.mu.Unlock()
 
 	if len(ids) > 0 {
@@ -203,8 +394,10 @@ func (s *ChromemStore) Count() int {
 	return len(s.entries)
 }
 
+// Close writes the entry and keyword indexes and the embedding cache, which
+// saveIndex flushes along with them.
 func (s *ChromemStore) Close() error {
-	return nil
+	return s.saveIndex()
 }
 
 // entryFromResult reconstructs an Entry from a chromem-go Result.
@@ -236,20 +429,50 @@ func (s *ChromemStore) indexPath() string {
 	return filepath.Join(s.persistDir, "entries_index.json")
 }
 
-func (s *ChromemStore) saveIndex() {
+func (s *ChromemStore) keywordIndexPath() string {
+	if s.persistDir == "" {
+		return ""
+	}
+	return filepath.Join(s.persistDir, "bm25_index.json")
+}
+
+// saveIndex writes the entry and keyword indexes, each to a temporary file
+// renamed over the old one, so a crash mid-write leaves the previous index.
+func (s *ChromemStore) saveIndex() error {
 	path := s.indexPath()
 	if path == "" {
-		return
+		return nil
 	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
 
 	s.mu.RLock()
-	data, err := json.Marshal(s.entries)
+	entries, err := json.Marshal(s.entries)
+	var keywords []byte
+	if err == nil {
+		keywords, err = json.Marshal(s.keywords)
+	}
 	s.mu.RUnlock()
-
 	if err != nil {
-		return
+		return fmt.Errorf("marshal memory index: %w", err)
+	}
+
+	if err := writeFileAtomic(path, entries); err != nil {
+		return fmt.Errorf("write memory index: %w", err)
 	}
-	os.WriteFile(path, data, 0644)
+	if err := writeFileAtomic(s.keywordIndexPath(), keywords); err != nil {
+		return fmt.Errorf("write keyword index: %w", err)
+	}
+	return s.embedder.cache.flush()
+}
+
+// writeFileAtomic replaces path with data through a temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
 func (s *ChromemStore) loadIndex() error {
@@ -267,32 +490,3 @@ func (s *ChromemStore) loadIndex() error {
 	defer s.mu.Unlock()
 	return json.Unmarshal(data, &s.entries)
 }
-
-// Keyword scoring helpers.
-
-// extractWords returns lowercased words from text with length >= 3.
-func extractWords(text string) []string {
-	fields := strings.Fields(strings.ToLower(text))
-	words := make([]string, 0, len(fields))
-	for _, w := range fields {
-		if len(w) >= 3 {
-			words = append(words, w)
-		}
-	}
-	return words
-}
-
-// keywordScore computes the fraction of query words found in the content.
-func keywordScore(queryWords []string, content string) float32 {
-	if len(queryWords) == 0 {
-		return 0
-	}
-	lower := strings.ToLower(content)
-	matches := 0
-	for _, w := range queryWords {
-		if strings.Contains(lower, w) {
-			matches++
-		}
-	}
-	return float32(matches) / float32(len(queryWords))
-}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// DefaultDedupThreshold is the cosine similarity above which two memories
+// are treated as near-duplicates.
+const DefaultDedupThreshold = 0.92
+
+// MergeFunc combines a cluster of near-duplicate entries into one canonical
+// entry. Only UserMsg and AssistMsg of the result are used.
+type MergeFunc func(ctx context.Context, entries []Entry) (Entry, error)
+
+// ConsolidateResult summarizes a consolidation pass.
+type ConsolidateResult struct {
+	Clusters int // clusters of two or more entries found
+	Removed  int // original entries deleted
+	Created  int // merged entries added
+}
+
+// Consolidate clusters near-duplicate entries by embedding similarity,
+// replaces each cluster with a single merged entry and deletes the
+// originals. Clusters are seeded greedily, oldest entry first, and only
+// take entries similar to the seed itself so chains of loosely related
+// memories are not collapsed together.
+func Consolidate(ctx context.Context, store Store, threshold float32, merge MergeFunc) (ConsolidateResult, error) {
+	var res ConsolidateResult
+
+	all, err := store.Export(ctx)
+	if err != nil {
+		return res, fmt.Errorf("export entries: %w", err)
+	}
+
+	assigned := make([]bool, len(all))
+	for i := range all {
+		if assigned[i] || len(all[i].Embedding) == 0 {
+			continue
+		}
+		cluster := []Entry{all[i].Entry}
+		for j := i + 1; j < len(all); j++ {
+			if assigned[j] || len(all[j].Embedding) != len(all[i].Embedding) {
+				continue
+			}
+			if dot(all[i].Embedding, all[j].Embedding) >= threshold {
+				assigned[j] = true
+				cluster = append(cluster, all[j].Entry)
+			}
+		}
+		if len(cluster) < 2 {
+			continue
+		}
+		res.Clusters++
+
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		merged, err := merge(ctx, cluster)
+		if err != nil {
+			return res, fmt.Errorf("merge cluster of %d: %w", len(cluster), err)
+		}
+
+		// Add before deleting so a failure never loses the memory outright.
+		entry := Entry{
+			UserMsg:   merged.UserMsg,
+			AssistMsg: merged.AssistMsg,
+			Timestamp: cluster[len(cluster)-1].Timestamp,
+			Metadata:  map[string]string{"consolidated_from": strconv.Itoa(len(cluster))},
+		}
+		for _, e := range cluster {
+			entry.Importance = max(entry.Importance, e.Importance)
+			// A thumbs down on any of the originals outweighs a thumbs up.
+			if e.Rating < 0 || entry.Rating == 0 {
+				entry.Rating = e.Rating
+			}
+		}
+		if err := store.Add(ctx, entry); err != nil {
+			return res, fmt.Errorf("add merged entry: %w", err)
+		}
+		res.Created++
+
+		for _, e := range cluster {
+			if err := store.Delete(ctx, e.ID); err != nil {
+				return res, fmt.Errorf("delete %s: %w", e.ID, err)
+			}
+			res.Removed++
+		}
+	}
+	return res, nil
+}
+
+// dot is the cosine similarity of two normalized vectors.
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+const mergePrompt = `The following memories are near-duplicates recorded from past conversations. Merge them into ONE canonical memory that keeps every distinct, still-useful fact and drops repetition. Prefer the most recent information when memories disagree (they are listed oldest first).
+
+Reply in exactly this format and nothing else:
+QUESTION: <a single representative user question>
+ANSWER: <the merged assistant answer>`
+
+// NewLLMMergeFunc returns a MergeFunc that asks the currently loaded model
+// on the GPU server to merge a cluster through complete.
+func NewLLMMergeFunc(complete gpuclient.CompletionFunc) MergeFunc {
+	return func(ctx context.Context, entries []Entry) (Entry, error) {
+		var b strings.Builder
+		temp := 0.2
+		for i, e := range entries {
+			fmt.Fprintf(&b, "--- Memory %d ---\n%s\n\n", i+1, e.Content())
+		}
+
+		resp, err := complete(ctx, &api.ChatCompletionRequest{
+			Messages: []api.Message{
+				{Role: "system", Content: mergePrompt},
+				{Role: "user", Content: b.String()},
+			},
+			Temperature: &temp,
+		})
+		if err != nil {
+			return Entry{}, err
+		}
+		if len(resp.Choices) == 0 {
+			return Entry{}, fmt.Errorf("model returned no choices")
+		}
+		return parseMerged(resp.Choices[0].Message.Content)
+	}
+}
+
+// parseMerged extracts the QUESTION/ANSWER pair from the model's reply.
+func parseMerged(text string) (Entry, error) {
+	q := strings.Index(text, "QUESTION:")
+	a := strings.Index(text, "ANSWER:")
+	if q < 0 || a < q {
+		return Entry{}, fmt.Errorf("unexpected merge reply format")
+	}
+	entry := Entry{
+		UserMsg:   strings.TrimSpace(text[q+len("QUESTION:") : a]),
+		AssistMsg: strings.TrimSpace(text[a+len("ANSWER:"):]),
+	}
+	if entry.UserMsg == "" || entry.AssistMsg == "" {
+		return Entry{}, fmt.Errorf("merge reply is missing a question or answer")
+	}
+	return entry, nil
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// DatasetFilter selects the memories that become fine-tuning samples.
+type DatasetFilter struct {
+	MinAssistantLen int       // drop replies shorter than this many characters; empty ones always go
+	ExcludeErrors   bool      // drop replies that look like errors or refusals
+	Since, Until    time.Time // zero is unbounded
+	Dedupe          bool      // keep only the newest of entries with the same user message and reply
+	// MinRating is the lowest Rating kept: -1 keeps everything, 0 drops
+	// thumbs-down entries, 1 keeps only thumbs-up ones.
+	MinRating  int
+	MaxSamples int // keep the newest; 0 keeps all
+}
+
+// Reasons DatasetStats.Dropped counts entries under.
+const (
+	DropShort      = "short"
+	DropError      = "error"
+	DropDate       = "date"
+	DropDuplicate  = "duplicate"
+	DropRating     = "rating"
+	DropMaxSamples = "max_samples"
+)
+
+// DatasetStats describes what a DatasetFilter kept.
+type DatasetStats struct {
+	Memories          int // entries considered
+	Samples           int // entries kept
+	Dropped           map[string]int
+	RatedUp           int
+	RatedDown         int
+	AvgUserChars      int
+	AvgAssistantChars int
+	Oldest, Newest    time.Time
+}
+
+// errorMarkers are lowercase phrases of replies that make poor training
+// targets: failed tool runs, stack traces and refusals.
+var errorMarkers = []string{
+	"error:", "failed to", "traceback (most recent call last)", "panic:",
+	"exception:", "i'm sorry", "i am sorry", "i can't", "i cannot", "i'm unable", "i am unable",
+	"as an ai",
+}
+
+// looksLikeError reports whether reply contains one of errorMarkers.
+func looksLikeError(reply string) bool {
+	reply = strings.ToLower(reply)
+	for _, m := range errorMarkers {
+		if strings.Contains(reply, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterDataset returns the entries of f's dataset, newest first, with
+// statistics on what was kept and why the rest was dropped. entries may be
+// in any order.
+func FilterDataset(entries []Entry, f DatasetFilter) ([]Entry, DatasetStats) {
+	sorted := slices.Clone(entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.After(sorted[j].Timestamp)
+	})
+
+	stats := DatasetStats{Memories: len(entries), Dropped: make(map[string]int)}
+	seen := make(map[string]bool)
+	var kept []Entry
+	for _, e := range sorted {
+		reason := ""
+		switch {
+		case e.Rating < f.MinRating:
+			reason = DropRating
+		case !f.Since.IsZero() && e.Timestamp.Before(f.Since), !f.Until.IsZero() && e.Timestamp.After(f.Until):
+			reason = DropDate
+		case len(strings.TrimSpace(e.AssistMsg)) < max(f.MinAssistantLen, 1):
+			reason = DropShort
+		case f.ExcludeErrors && looksLikeError(e.AssistMsg):
+			reason = DropError
+		case f.Dedupe && seen[e.UserMsg+"\x00"+e.AssistMsg]:
+			reason = DropDuplicate
+		case f.MaxSamples > 0 && len(kept) >= f.MaxSamples:
+			reason = DropMaxSamples
+		}
+		if reason != "" {
+			stats.Dropped[reason]++
+			continue
+		}
+		seen[e.UserMsg+"\x00"+e.AssistMsg] = true
+		kept = append(kept, e)
+	}
+
+	var userChars, assistantChars int
+	for _, e := range kept {
+		userChars += len(e.UserMsg)
+		assistantChars += len(e.AssistMsg)
+		switch {
+		case e.Rating > 0:
+			stats.RatedUp++
+		case e.Rating < 0:
+			stats.RatedDown++
+		}
+	}
+	if stats.Samples = len(kept); stats.Samples > 0 {
+		stats.AvgUserChars = userChars / stats.Samples
+		stats.AvgAssistantChars = assistantChars / stats.Samples
+		stats.Newest = kept[0].Timestamp
+		stats.Oldest = kept[len(kept)-1].Timestamp
+	}
+	return kept, stats
+}
+
+// ChatSamples turns entries into fine-tuning samples of a user message and
+// the assistant's reply.
+func ChatSamples(entries []Entry) []api.DatasetSample {
+	samples := make([]api.DatasetSample, 0, len(entries))
+	for _, e := range entries {
+		samples = append(samples, api.DatasetSample{Messages: []api.Message{
+			{Role: "user", Content: e.UserMsg},
+			{Role: "assistant", Content: e.AssistMsg},
+		}, Source: "memory", Ref: e.ID})
+	}
+	return samples
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const defaultEmbedBatchSize = 32
+
+// embeddingCache maps a content hash to its embedding so re-adding the same
+// text (imports, re-indexing) never goes back to the embedding server. It is
+// persisted as JSON next to the store; an empty path keeps it in memory only.
+type embeddingCache struct {
+	path string
+
+	mu    sync.Mutex
+	vecs  map[string][]float32
+	dirty bool
+
+	flushMu sync.Mutex // serializes writers of the cache file
+}
+
+func newEmbeddingCache(path string) *embeddingCache {
+	c := &embeddingCache{path: path, vecs: make(map[string][]float32)}
+	if path == "" {
+		return c
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		// A corrupt cache is only a performance problem; start empty.
+		if json.Unmarshal(data, &c.vecs) != nil {
+			c.vecs = make(map[string][]float32)
+		}
+	}
+	return c
+}
+
+func contentKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *embeddingCache) get(text string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.vecs[contentKey(text)]
+	return v, ok
+}
+
+func (c *embeddingCache) put(text string, vec []float32) {
+	c.mu.Lock()
+	c.vecs[contentKey(text)] = vec
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// flush writes the cache to disk if it changed since the last flush. The
+// snapshot is taken under the lock and written via a temp file so
+// concurrent adds never see a half-written cache.
+func (c *embeddingCache) flush() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.vecs)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshal embedding cache: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		c.markDirty()
+		return fmt.Errorf("write embedding cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		c.markDirty()
+		return fmt.Errorf("rename embedding cache: %w", err)
+	}
+	return nil
+}
+
+func (c *embeddingCache) markDirty() {
+	c.mu.Lock()
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// cachingEmbedder puts an embeddingCache in front of a BatchEmbedFunc and
+// splits large batches into requests of at most batchSize inputs.
+type cachingEmbedder struct {
+	embed     BatchEmbedFunc
+	cache     *embeddingCache
+	batchSize int
+}
+
+func newCachingEmbedder(embed BatchEmbedFunc, cachePath string, cfg Config) *cachingEmbedder {
+	batchSize := cfg.EmbedBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultEmbedBatchSize
+	}
+	return &cachingEmbedder{
+		embed:     embed,
+		cache:     newEmbeddingCache(cachePath),
+		batchSize: batchSize,
+	}
+}
+
+// embedOne is the EmbedFunc handed to chromem-go for queries and for
+// documents added without a precomputed embedding.
+func (e *cachingEmbedder) embedOne(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := e.embedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+func (e *cachingEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+
+	// Collect unique cache misses, remembering every position they fill.
+	var missing []string
+	positions := make(map[string][]int)
+	for i, t := range texts {
+		if v, ok := e.cache.get(t); ok {
+			vecs[i] = v
+			continue
+		}
+		if _, seen := positions[t]; !seen {
+			missing = append(missing, t)
+		}
+		positions[t] = append(positions[t], i)
+	}
+
+	for start := 0; start < len(missing); start += e.batchSize {
+		end := min(start+e.batchSize, len(missing))
+		chunk := missing[start:end]
+		got, err := e.embed(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		if len(got) != len(chunk) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d inputs", len(got), len(chunk))
+		}
+		for j, t := range chunk {
+			e.cache.put(t, got[j])
+			for _, i := range positions[t] {
+				vecs[i] = got[j]
+			}
+		}
+	}
+	return vecs, nil
+}
@@ -9,6 +9,10 @@ import (
 // EmbedFunc is a function that produces a float32 embedding vector from text.
 type EmbedFunc func(ctx context.Context, text string) ([]float32, error)
 
+// BatchEmbedFunc embeds several texts at once. The returned vectors must be
+// in the same order as texts.
+type BatchEmbedFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
 // NewRemoteEmbedFunc returns an EmbedFunc that calls the GPU server's /v1/embeddings
 // endpoint via the gpuclient. This replaces the old NewLlamaEmbedFunc which spawned
 // a local llama-server subprocess.
@@ -17,3 +21,9 @@ func NewRemoteEmbedFunc(gpu *gpuclient.Client) EmbedFunc {
 		return gpu.Embed(ctx, text)
 	}
 }
+
+// NewRemoteBatchEmbedFunc returns a BatchEmbedFunc that sends all texts to
+// the GPU server's /v1/embeddings endpoint in one request.
+func NewRemoteBatchEmbedFunc(gpu *gpuclient.Client) BatchEmbedFunc {
+	return gpu.EmbedBatch
+}
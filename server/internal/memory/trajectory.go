@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+	"github.com/google/uuid"
+)
+
+// TrajectoriesFile, in the memory directory, holds the recorded agent
+// trajectories, one JSON object per line.
+const TrajectoriesFile = "trajectories.jsonl"
+
+// Trajectory is an agent turn as the model saw it: the user's message, the
+// assistant's tool calls, the tool results and the final reply, with the
+// tools it was offered. Memory keeps only the user and assistant text of a
+// turn; trajectories are what teaches a fine-tune to call tools.
+type Trajectory struct {
+	ID        string        `json:"id"`
+	Timestamp time.Time     `json:"timestamp"`
+	Model     string        `json:"model,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+	Tools     []api.Tool    `json:"tools,omitempty"`
+	Messages  []api.Message `json:"messages"`
+}
+
+// ToolCalls returns how many tool calls the trajectory's assistant made.
+func (t *Trajectory) ToolCalls() int {
+	n := 0
+	for _, m := range t.Messages {
+		n += len(m.ToolCalls)
+	}
+	return n
+}
+
+// TrajectoryLog is an append-only file of trajectories. It is safe for
+// concurrent use.
+type TrajectoryLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewTrajectoryLog opens the log in dir; the file is created on the first
+// Append.
+func NewTrajectoryLog(dir string) *TrajectoryLog {
+	return &TrajectoryLog{path: filepath.Join(dir, TrajectoriesFile)}
+}
+
+// Append records t, filling in its ID and timestamp if unset, and returns
+// the ID.
+func (l *TrajectoryLog) Append(t Trajectory) (string, error) {
+	if len(t.Messages) == 0 {
+		return "", fmt.Errorf("trajectory has no messages")
+	}
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	if t.Timestamp.IsZero() {
+		t.Timestamp = time.Now().UTC()
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("open trajectories: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return "", fmt.Errorf("write trajectory: %w", err)
+	}
+	return t.ID, nil
+}
+
+// List returns the recorded trajectories, newest first. Lines that do not
+// parse, such as one cut short by a crash, are skipped.
+func (l *TrajectoryLog) List() ([]Trajectory, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open trajectories: %w", err)
+	}
+	defer f.Close()
+
+	var out []Trajectory
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var t Trajectory
+		if json.Unmarshal(sc.Bytes(), &t) == nil && len(t.Messages) > 0 {
+			out = append(out, t)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read trajectories: %w", err)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.After(out[j].Timestamp) })
+	return out, nil
+}
+
+// maxToolResultChars caps a tool result in a training sample. File reads
+// and command output can run to megabytes; the model learns from how it
+// used the result, not from all of it.
+const maxToolResultChars = 4000
+
+// TrainingMessages returns t's messages as a function-calling sample: tool
+// results over maxToolResultChars are cut short, and reasoning and images
+// are dropped.
+func (t *Trajectory) TrainingMessages() []api.Message {
+	out := make([]api.Message, 0, len(t.Messages))
+	for _, m := range t.Messages {
+		m.ReasoningContent, m.Images = "", nil
+		if m.Role == "tool" && len(m.Content) > maxToolResultChars {
+			cut := maxToolResultChars
+			for cut > 0 && !utf8.RuneStart(m.Content[cut]) {
+				cut--
+			}
+			m.Content = m.Content[:cut] + fmt.Sprintf("\n[... %d more characters]", utf8.RuneCountInString(m.Content[cut:]))
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// FilterTrajectories keeps the trajectories in which the assistant called
+// a tool, recorded within f's date range, newest first and at most
+// f.MaxSamples of them. The other fields of f apply to memories only.
+func FilterTrajectories(trajectories []Trajectory, f DatasetFilter) []Trajectory {
+	var kept []Trajectory
+	for _, t := range trajectories {
+		if t.ToolCalls() == 0 {
+			continue
+		}
+		if !f.Since.IsZero() && t.Timestamp.Before(f.Since) || !f.Until.IsZero() && t.Timestamp.After(f.Until) {
+			continue
+		}
+		if f.MaxSamples > 0 && len(kept) == f.MaxSamples {
+			break
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"context"
+	"math"
 	"time"
 )
 
@@ -13,6 +14,12 @@ type Entry struct {
 	Timestamp time.Time
 	SessionID string
 	Metadata  map[string]string
+	// Importance in [0, 1] shields an entry from recency decay; 1 means it
+	// never goes stale. Set via the remember tool or /memory importance.
+	Importance float32
+	// Rating is the user's verdict on the reply for fine-tuning: 1 thumbs
+	// up, -1 thumbs down, 0 unrated. Set via /memory rate.
+	Rating int
 }
 
 // Content returns the combined text of the entry for embedding and search.
@@ -27,21 +34,86 @@ func (e *Entry) Content() string {
 	return content
 }
 
+// ExportedEntry is an Entry together with its embedding vector, the unit
+// of Store.Export and Store.Import.
+type ExportedEntry struct {
+	Entry
+	Embedding []float32
+}
+
+// Config tunes how the memory store ranks search results.
+type Config struct {
+	// KeywordWeight is the share of the combined score given to the BM25
+	// keyword score; the rest goes to semantic similarity. 0 = pure vector
+	// search, 1 = pure keyword search.
+	KeywordWeight float32
+	BM25K1        float64 // term frequency saturation
+	BM25B         float64 // document length normalization
+
+	// EmbedBatchSize caps the number of inputs sent in one embedding request.
+	EmbedBatchSize int
+
+	// RecencyHalfLife is the age at which an unimportant entry's relevance
+	// has decayed halfway to its floor. 0 disables recency decay.
+	RecencyHalfLife time.Duration
+}
+
+// DefaultConfig returns the ranking used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		KeywordWeight:   0.3,
+		BM25K1:          defaultBM25K1,
+		BM25B:           defaultBM25B,
+		EmbedBatchSize:  defaultEmbedBatchSize,
+		RecencyHalfLife: 30 * 24 * time.Hour,
+	}
+}
+
+// recencyFloor is the share of relevance a completely stale entry keeps, so
+// an old memory that is by far the best match can still surface.
+const recencyFloor = 0.5
+
+// freshness returns how fresh e is at now, in [0, 1]: exponential decay with
+// the given half-life, lifted towards 1 by the entry's importance.
+func freshness(e Entry, now time.Time, halfLife time.Duration) float32 {
+	if halfLife <= 0 {
+		return 1
+	}
+	age := now.Sub(e.Timestamp)
+	if age < 0 {
+		age = 0
+	}
+	decay := float32(math.Exp2(-float64(age) / float64(halfLife)))
+	return e.Importance + (1-e.Importance)*decay
+}
+
 // SearchResult is a memory entry with associated scores from hybrid search.
 type SearchResult struct {
 	Entry         Entry
 	SemanticScore float32
 	KeywordScore  float32
+	RecencyScore  float32 // freshness after decay and importance, 1 = fully fresh
 	CombinedScore float32
 }
 
 // Store is the interface for persistent memory storage with hybrid search.
 type Store interface {
 	Add(ctx context.Context, entry Entry) error
+	AddBatch(ctx context.Context, entries []Entry) error
 	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	// SearchSession is Search over the entries stored with sessionID only.
+	SearchSession(ctx context.Context, sessionID, query string, limit int) ([]SearchResult, error)
 	List(ctx context.Context, limit int) ([]Entry, error)
 	Delete(ctx context.Context, id string) error
 	Clear(ctx context.Context) error
+	// Export returns every entry with its embedding, oldest first.
+	Export(ctx context.Context) ([]ExportedEntry, error)
+	// Import adds exported entries, keeping their IDs. Entries that carry an
+	// embedding are not re-embedded; existing entries with the same ID are
+	// replaced.
+	Import(ctx context.Context, entries []ExportedEntry) error
+	SetImportance(ctx context.Context, id string, importance float32) error
+	SetRating(ctx context.Context, id string, rating int) error
 	Count() int
 	Close() error
 }
@@ -0,0 +1,90 @@
+// Package runpod is a client for the parts of the RunPod REST API that
+// start and stop a pod.
+package runpod
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const baseURL = "https://rest.runpod.io/v1"
+
+// Pod statuses, as desiredStatus reports them.
+const (
+	StatusRunning    = "RUNNING"
+	StatusExited     = "EXITED"
+	StatusTerminated = "TERMINATED"
+)
+
+// Pod represents a RunPod pod.
+type Pod struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	DesiredStatus string  `json:"desiredStatus"`
+	CostPerHr     float64 `json:"costPerHr"`
+	GPUCount      int     `json:"gpuCount"`
+	PublicIP      string  `json:"publicIp"`
+	// PortMappings maps the pod's exposed TCP ports, e.g. "22", to their
+	// public ports.
+	PortMappings map[string]int `json:"portMappings"`
+}
+
+// Client is a typed HTTP client for the RunPod REST API.
+type Client struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient creates a new RunPod API client.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey:     apiKey,
+		httpClient: &http.Client{},
+	}
+}
+
+// GetPod returns a single pod by ID.
+func (c *Client) GetPod(ctx context.Context, id string) (*Pod, error) {
+	var pod Pod
+	if err := c.do(ctx, http.MethodGet, "/pods/"+url.PathEscape(id), &pod); err != nil {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+// StartPod starts (resumes) a stopped pod.
+func (c *Client) StartPod(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/pods/"+url.PathEscape(id)+"/start", nil)
+}
+
+// StopPod stops a running pod, keeping its volume.
+func (c *Client) StopPod(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/pods/"+url.PathEscape(id)+"/stop", nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("runpod request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("runpod returned %d: %s", resp.StatusCode, string(body))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
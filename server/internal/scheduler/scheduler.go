@@ -0,0 +1,199 @@
+// Package scheduler limits how many chat completions run on the GPU at once.
+// Requests beyond the limit wait in a queue; interactive requests go ahead of
+// batch ones, but a waiting batch request is still let through regularly so
+// background work is never starved.
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders queued requests.
+type Priority int
+
+const (
+	Interactive Priority = iota
+	Batch
+)
+
+// ParsePriority maps an X-Priority header value to a Priority. Anything
+// other than "batch" or "background" is interactive.
+func ParsePriority(s string) Priority {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "batch", "background":
+		return Batch
+	}
+	return Interactive
+}
+
+func (p Priority) String() string {
+	if p == Batch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// batchEvery is how many interactive requests may be started in a row while
+// a batch request waits before the batch request gets the next slot.
+const batchEvery = 4
+
+type waiter struct {
+	priority Priority
+	ready    chan struct{}
+	granted  bool
+}
+
+// Scheduler hands out a fixed number of slots.
+type Scheduler struct {
+	slots int
+
+	mu      sync.Mutex
+	running int
+	queues  [2][]*waiter  // indexed by Priority
+	streak  int           // interactive grants in a row while batch requests waited
+	changed chan struct{} // closed and replaced whenever the queue changes
+	// lastInteractive is when an interactive request last finished.
+	lastInteractive time.Time
+}
+
+// New returns a Scheduler that runs at most slots requests at once.
+func New(slots int) *Scheduler {
+	return &Scheduler{slots: max(slots, 1), changed: make(chan struct{})}
+}
+
+// Acquire waits for a free slot. While the request is queued, onWait (if
+// non-nil) is called with its 1-based queue position whenever it changes.
+// The returned release function frees the slot and must be called once the
+// request is done; it is safe to call more than once.
+func (s *Scheduler) Acquire(ctx context.Context, p Priority, onWait func(position int)) (func(), error) {
+	s.mu.Lock()
+	if s.running < s.slots && len(s.queues[Interactive]) == 0 && len(s.queues[Batch]) == 0 {
+		s.running++
+		s.mu.Unlock()
+		return s.releaseFunc(p), nil
+	}
+	w := &waiter{priority: p, ready: make(chan struct{})}
+	s.queues[p] = append(s.queues[p], w)
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	lastPos := 0
+	for {
+		s.mu.Lock()
+		pos := s.positionLocked(w)
+		changed := s.changed
+		s.mu.Unlock()
+		if pos > 0 && pos != lastPos && onWait != nil {
+			onWait(pos)
+			lastPos = pos
+		}
+
+		select {
+		case <-w.ready:
+			return s.releaseFunc(p), nil
+		case <-changed:
+		case <-ctx.Done():
+			s.mu.Lock()
+			if w.granted {
+				// The slot arrived as the caller gave up; pass it on.
+				s.mu.Unlock()
+				s.releaseFunc(p)()
+				return nil, ctx.Err()
+			}
+			s.queues[p] = slices.DeleteFunc(s.queues[p], func(x *waiter) bool { return x == w })
+			s.notifyLocked()
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Stats reports the number of running and queued requests.
+func (s *Scheduler) Stats() (running, queued int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, len(s.queues[Interactive]) + len(s.queues[Batch])
+}
+
+// LastInteractive returns when an interactive request last finished, or
+// the zero time if none has.
+func (s *Scheduler) LastInteractive() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastInteractive
+}
+
+func (s *Scheduler) releaseFunc(p Priority) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			if p == Interactive {
+				s.lastInteractive = time.Now()
+			}
+			s.grantLocked()
+		})
+	}
+}
+
+// grantLocked starts queued requests while slots are free.
+func (s *Scheduler) grantLocked() {
+	for s.running < s.slots {
+		w := s.nextLocked()
+		if w == nil {
+			break
+		}
+		w.granted = true
+		s.running++
+		close(w.ready)
+	}
+	s.notifyLocked()
+}
+
+// nextLocked removes and returns the request that should run next.
+func (s *Scheduler) nextLocked() *waiter {
+	interactive, batch := s.queues[Interactive], s.queues[Batch]
+	pick := Interactive
+	switch {
+	case len(interactive) == 0 && len(batch) == 0:
+		return nil
+	case len(interactive) == 0:
+		pick = Batch
+	case len(batch) > 0 && s.streak >= batchEvery:
+		pick = Batch
+	}
+
+	if pick == Batch {
+		s.streak = 0
+	} else if len(batch) > 0 {
+		s.streak++
+	}
+	w := s.queues[pick][0]
+	s.queues[pick] = s.queues[pick][1:]
+	return w
+}
+
+// positionLocked estimates w's place in line: interactive requests ahead of
+// batch ones, first come first served within each. It returns 0 once w is
+// no longer queued.
+func (s *Scheduler) positionLocked(w *waiter) int {
+	i := slices.Index(s.queues[w.priority], w)
+	if i < 0 {
+		return 0
+	}
+	if w.priority == Batch {
+		return len(s.queues[Interactive]) + i + 1
+	}
+	return i + 1
+}
+
+func (s *Scheduler) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
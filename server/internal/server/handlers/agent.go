@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/agent"
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/internal/scheduler"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
+	"github.com/ThatCatDev/tanrenai/server/internal/tools"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+	"github.com/google/uuid"
+)
+
+var agentLogger = logging.For("agent")
+
+// defaultAgentSystemPrompt is used for runs that do not bring their own
+// system message.
+const defaultAgentSystemPrompt = `You are a helpful assistant with read-only access to files through tools.
+
+Important rules:
+1. Gather information with tools BEFORE answering. Do not guess or speculate when you can look it up.
+2. Call tools directly — do not narrate what you plan to do. Just do it.
+3. Use multiple tool calls in one response when possible.
+4. Complete multi-step tasks automatically without stopping for confirmation.
+5. Use "." for the current directory. Never use placeholder names.
+6. If a tool call fails, try different arguments. Never repeat an identical failing call.`
+
+// AgentHandler runs the agent loop server-side for thin clients. Tools run
+// on the server, in its working directory, and only read files.
+type AgentHandler struct {
+	Proxy         *ProxyHandler   // completions go through its GPU client and scheduler
+	Tools         *tools.Registry // every tool runs may use
+	MaxIterations int             // upper bound for a run's max_iterations
+	Sessions      *sessions.Store // settings of the session named in api.SessionHeader
+	// Remotes are model aliases served by cloud APIs; runs using them
+	// neither start the GPU nor wait for a scheduler slot.
+	Remotes map[string]RemoteModel
+
+	mu   sync.Mutex
+	runs map[string]context.CancelFunc
+}
+
+// Start handles POST /v1/agent/runs. The run streams as server-sent events:
+// "run" with its ID, then "iteration", "content", "tool_call" and
+// "tool_result" as the loop progresses, and finally "done" with the added
+// messages or "error". The run stops if the client disconnects. A run in a
+// stored session may only use the tools its settings allow.
+func (h *AgentHandler) Start(w http.ResponseWriter, r *http.Request) {
+	var req api.AgentRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Task) == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "task must not be empty")
+		return
+	}
+
+	session, settings := requestSession(r, h.Sessions)
+	allowed := h.Tools
+	if len(settings.Tools) > 0 {
+		allowed = h.Tools.Subset(settings.Tools...)
+	}
+	registry := allowed
+	if len(req.Tools) > 0 {
+		for _, name := range req.Tools {
+			if allowed.Get(name) == nil {
+				writeError(w, http.StatusForbidden, api.CodeToolDenied, fmt.Sprintf("tool %q is not available", name))
+				return
+			}
+		}
+		registry = allowed.Subset(req.Tools...)
+	}
+
+	maxIterations := h.MaxIterations
+	if req.MaxIterations > 0 && (maxIterations <= 0 || req.MaxIterations < maxIterations) {
+		maxIterations = req.MaxIterations
+	}
+
+	remote, isRemote := h.Remotes[req.Model]
+	if !isRemote && !h.Proxy.ensureGPU(w, r) {
+		return
+	}
+
+	messages := slices.Clone(req.Messages)
+	if !slices.ContainsFunc(messages, func(m api.Message) bool { return m.Role == "system" }) {
+		messages = append([]api.Message{{Role: "system", Content: defaultAgentSystemPrompt}}, messages...)
+	}
+	messages = append(messages, api.Message{Role: "user", Content: req.Task})
+
+	id := uuid.New().String()
+	cacheID := session
+	if cacheID == "" {
+		cacheID = id
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	h.track(id, cancel)
+	defer h.untrack(id)
+	log := agentLogger.With("run", id, "session", session, "model", req.Model)
+	log.Info("agent run started", "max_iterations", maxIterations)
+
+	// Keepalives cover long tool calls and quiet stretches of generation.
+	sw := newSSEWriter(w)
+	defer sw.keepalive()()
+	send := func(event string, data any) {
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(sw, "event: %s\ndata: %s\n\n", event, b)
+	}
+	send("run", api.AgentRunEvent{ID: id})
+
+	priority := scheduler.ParsePriority(r.Header.Get("X-Priority"))
+	complete := func(ctx context.Context, creq *api.ChatCompletionRequest) (<-chan gpuclient.StreamEvent, error) {
+		if isRemote {
+			return remote.streamCompletion(ctx, creq)
+		}
+		h.Proxy.Provider.RecordActivity()
+		return h.Proxy.streamCompletion(ctx, creq, priority)
+	}
+
+	result, err := agent.RunStreaming(ctx, complete, messages, agent.Config{
+		Model:         req.Model,
+		SessionID:     cacheID,
+		MaxIterations: maxIterations,
+		Tools:         registry,
+		Hooks: agent.Hooks{
+			OnIterationStart: func(iteration, limit int) {
+				send("iteration", api.AgentIterationEvent{Iteration: iteration, MaxIterations: limit})
+			},
+			OnContentDelta: func(delta string) {
+				send("content", api.AgentContentEvent{Delta: delta})
+			},
+			OnToolCall: func(call api.ToolCall) {
+				send("tool_call", call)
+			},
+			OnToolResult: func(call api.ToolCall, output string) {
+				send("tool_result", api.AgentToolResultEvent{ToolCallID: call.ID, Name: call.Function.Name, Output: output})
+			},
+		},
+	})
+	if err != nil {
+		apiErr := gpuError(err)
+		switch {
+		case errors.Is(err, agent.ErrCancelled):
+			apiErr = api.NewError(0, api.CodeCancelled, err.Error())
+		case apiErr.Code == api.CodeGPUError:
+			apiErr = api.NewError(0, api.CodeAgentError, err.Error())
+		}
+		if apiErr.Code == api.CodeCancelled {
+			log.Info("agent run cancelled")
+		} else {
+			log.Warn("agent run failed", "err", err)
+		}
+		send("error", apiErr.Response())
+		return
+	}
+	log.Info("agent run finished", "messages", len(result)-len(messages))
+	send("done", api.AgentRunEvent{ID: id, Messages: result[len(messages):]})
+}
+
+// Cancel handles DELETE /v1/agent/runs/{id}.
+func (h *AgentHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	h.mu.Lock()
+	cancel, ok := h.runs[id]
+	h.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, api.CodeNotFound, "no active agent run with id "+id)
+		return
+	}
+	cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "cancelled"})
+}
+
+func (h *AgentHandler) track(id string, cancel context.CancelFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.runs == nil {
+		h.runs = make(map[string]context.CancelFunc)
+	}
+	h.runs[id] = cancel
+}
+
+func (h *AgentHandler) untrack(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.runs, id)
+}
+
+// RemoteModel is an agent run model served by an OpenAI-compatible cloud
+// API.
+type RemoteModel struct {
+	Client *gpuclient.Client
+	Model  string // the provider's model ID
+}
+
+// streamCompletion sends req to the cloud API as the provider's model,
+// without the fields only llama-server understands, which cloud APIs
+// reject.
+func (m RemoteModel) streamCompletion(ctx context.Context, req *api.ChatCompletionRequest) (<-chan gpuclient.StreamEvent, error) {
+	out := *req
+	out.Model = m.Model
+	out.TopK, out.MinP, out.RepeatPenalty = nil, nil, nil
+	out.SessionID = ""
+	out.Messages = make([]api.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.ReasoningContent = ""
+		out.Messages[i] = msg
+	}
+	return m.Client.StreamCompletion(ctx, &out)
+}
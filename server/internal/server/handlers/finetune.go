@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/memory"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// FinetuneHandler builds fine-tuning datasets from memory. The rest of the
+// fine-tuning API is proxied to the GPU server as is.
+type FinetuneHandler struct {
+	MemStore     memory.Store
+	Trajectories *memory.TrajectoryLog // the dataset of DatasetModeTools
+	Proxy        *ProxyHandler         // forwards prepare requests
+}
+
+// Dataset handles POST /v1/finetune/dataset: the statistics of the dataset
+// a filter would produce, and optionally a preview of its memories.
+func (h *FinetuneHandler) Dataset(w http.ResponseWriter, r *http.Request) {
+	var req api.DatasetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	kept, stats, err := h.filter(r, req.DatasetFilter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	resp := api.DatasetResponse{Stats: stats}
+	for _, e := range kept[:min(max(req.Preview, 0), len(kept))] {
+		resp.Preview = append(resp.Preview, toAPIEntry(e))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Prepare handles POST /v1/finetune/prepare. A request naming a dataset
+// file on the GPU server or carrying its samples or preference pairs is
+// forwarded unchanged; otherwise the memories its filter keeps, or in
+// DatasetModeTools the recorded trajectories, are sent along as the
+// dataset.
+func (h *FinetuneHandler) Prepare(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	var req api.FinetunePrepareRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if req.DatasetPath == "" && len(req.Dataset) == 0 && len(req.Pairs) == 0 {
+		var filter api.DatasetFilter
+		if req.Filter != nil {
+			filter = *req.Filter
+		}
+		switch req.Mode {
+		case "", api.DatasetModeChat:
+			kept, _, err := h.filter(r, filter)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+				return
+			}
+			if len(kept) == 0 {
+				writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "no memories match the dataset filter")
+				return
+			}
+			req.Dataset = memory.ChatSamples(kept)
+		case api.DatasetModeTools:
+			all, err := h.Trajectories.List()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+				return
+			}
+			kept := memory.FilterTrajectories(all, toMemoryFilter(filter))
+			if len(kept) == 0 {
+				writeError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+					fmt.Sprintf("no recorded trajectories with tool calls match the filter (%d recorded); record them with --record-trajectories", len(all)))
+				return
+			}
+			for _, t := range kept {
+				req.Dataset = append(req.Dataset, api.DatasetSample{
+					Messages: t.TrainingMessages(),
+					Tools:    t.Tools,
+					Source:   "trajectory",
+					Ref:      t.ID,
+				})
+			}
+		default:
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, fmt.Sprintf("unknown dataset mode %q: want %s or %s", req.Mode, api.DatasetModeChat, api.DatasetModeTools))
+			return
+		}
+		req.SampleCount = len(req.Dataset)
+		req.Filter = nil
+		req.Mode = ""
+		if body, err = json.Marshal(req); err != nil {
+			writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
+			return
+		}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	h.Proxy.RawProxy(w, r)
+}
+
+// filter applies f to every memory.
+func (h *FinetuneHandler) filter(r *http.Request, f api.DatasetFilter) ([]memory.Entry, api.DatasetStats, error) {
+	entries, err := h.MemStore.List(r.Context(), 0)
+	if err != nil {
+		return nil, api.DatasetStats{}, err
+	}
+	kept, s := memory.FilterDataset(entries, toMemoryFilter(f))
+	stats := api.DatasetStats{
+		Memories:          s.Memories,
+		Samples:           s.Samples,
+		Dropped:           s.Dropped,
+		RatedUp:           s.RatedUp,
+		RatedDown:         s.RatedDown,
+		AvgUserChars:      s.AvgUserChars,
+		AvgAssistantChars: s.AvgAssistantChars,
+	}
+	if s.Samples > 0 {
+		stats.Oldest, stats.Newest = timePtr(s.Oldest), timePtr(s.Newest)
+	}
+	return kept, stats, nil
+}
+
+// toMemoryFilter converts an API dataset filter to memory's.
+func toMemoryFilter(f api.DatasetFilter) memory.DatasetFilter {
+	mf := memory.DatasetFilter{
+		MinAssistantLen: f.MinAssistantLen,
+		ExcludeErrors:   f.ExcludeErrors,
+		Dedupe:          f.Dedupe,
+		MinRating:       f.MinRating,
+		MaxSamples:      f.MaxSamples,
+	}
+	if f.Since != nil {
+		mf.Since = *f.Since
+	}
+	if f.Until != nil {
+		mf.Until = *f.Until
+	}
+	return mf
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuprovider"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// InfoHandler handles GET /api/info, adding the backend's version and
+// features to the GPU server's answer.
+type InfoHandler struct {
+	GPUClient *gpuclient.Client
+	Provider  gpuprovider.Provider
+	Version   string
+	Features  []string // the backend's own, e.g. api.FeatureMemory
+}
+
+// ServeHTTP asks the GPU server only when it is running, so that asking
+// neither starts a billed instance nor counts as activity.
+func (h *InfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Provider.Status(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeInstanceError, err.Error())
+		return
+	}
+	info := &api.ServerInfo{}
+	if status.State == "running" {
+		gpu, err := h.GPUClient.Info(r.Context())
+		if err != nil {
+			// An older GPU server has no /api/info; the backend's part is
+			// still worth answering with.
+			logger.Debug("GPU server info unavailable", "err", err)
+		} else {
+			info = gpu
+		}
+	}
+	info.GPUVersion, info.Version = info.Version, h.Version
+	info.GPUState = status.State
+	info.Features = append(info.Features, h.Features...)
+	if info.Features == nil {
+		info.Features = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
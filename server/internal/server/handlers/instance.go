@@ -2,32 +2,42 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuprovider"
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
 )
 
 // InstanceHandler handles GPU instance management endpoints.
 type InstanceHandler struct {
 	Provider gpuprovider.Provider
+	Tunnel   func() *tunnel.Status // nil, or returning nil, without a tunnel
+	Shutdown <-chan struct{}       // closed when the server shuts down, ending event streams
 }
 
 // Status handles GET /api/instance/status.
 func (h *InstanceHandler) Status(w http.ResponseWriter, r *http.Request) {
 	status, err := h.Provider.Status(r.Context())
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "instance_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeInstanceError, err.Error())
 		return
 	}
+	if h.Tunnel != nil {
+		status.Tunnel = h.Tunnel()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
 
-// Start handles POST /api/instance/start.
+// Start handles POST /api/instance/start. An explicit start may go over
+// the budget that stops requests from starting the instance.
 func (h *InstanceHandler) Start(w http.ResponseWriter, r *http.Request) {
-	if err := h.Provider.EnsureRunning(r.Context()); err != nil {
-		writeError(w, http.StatusInternalServerError, "instance_error", err.Error())
+	if err := h.Provider.Start(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeInstanceError, err.Error())
 		return
 	}
 
@@ -38,10 +48,83 @@ func (h *InstanceHandler) Start(w http.ResponseWriter, r *http.Request) {
 // Stop handles POST /api/instance/stop.
 func (h *InstanceHandler) Stop(w http.ResponseWriter, r *http.Request) {
 	if err := h.Provider.Stop(r.Context()); err != nil {
-		writeError(w, http.StatusInternalServerError, "instance_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeInstanceError, err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
 }
+
+// Costs handles GET /api/instance/costs: the instance's price and spend
+// per day against its budget.
+func (h *InstanceHandler) Costs(w http.ResponseWriter, r *http.Request) {
+	costs, err := h.Provider.Costs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeInstanceError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(costs)
+}
+
+// Autostop handles POST /api/instance/autostop: change how long the GPU
+// may be idle before it is stopped, until the backend restarts.
+func (h *InstanceHandler) Autostop(w http.ResponseWriter, r *http.Request) {
+	var req api.InstanceAutostopRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+	after, err := time.ParseDuration(req.After)
+	if err != nil || after < 0 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, fmt.Sprintf("invalid after %q: want a duration such as 30m, or 0 to turn auto-stop off", req.After))
+		return
+	}
+	if after > 0 && after < time.Minute {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "after must be at least a minute")
+		return
+	}
+	if err := h.Provider.SetIdleTimeout(after); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInstanceError, err.Error())
+		return
+	}
+	h.Status(w, r)
+}
+
+// Events handles GET /api/instance/events: a stream of the GPU's idle
+// warnings and stops, as SSE, until the client disconnects.
+func (h *InstanceHandler) Events(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := h.Provider.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	// Comments keep proxies from closing a quiet stream.
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.Shutdown:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-events:
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "data: %s\n\n", b)
+		}
+		flush()
+	}
+}
@@ -2,35 +2,50 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/ThatCatDev/tanrenai/server/internal/memory"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
 	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+	"github.com/google/uuid"
 )
 
 // MemoryHandler handles memory CRUD endpoints.
 type MemoryHandler struct {
-	MemStore memory.Store
+	MemStore       memory.Store
+	Merge          memory.MergeFunc // merges near-duplicates for Compact
+	DedupThreshold float32
+	Trajectories   *memory.TrajectoryLog // agent turns recorded for tool-calling fine-tunes
+	Sessions       *sessions.Store       // settings of the session named in api.SessionHeader
 }
 
 // Search handles POST /v1/memory/search.
 func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
 	var req api.MemorySearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	if req.Query == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "query must not be empty")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "query must not be empty")
 		return
 	}
 
-	results, err := h.MemStore.Search(r.Context(), req.Query, req.Limit)
+	// A session scoped to its own memories does not see other clients'.
+	var results []memory.SearchResult
+	var err error
+	if session, settings := requestSession(r, h.Sessions); session != "" && settings.MemoryScope == api.MemoryScopeSession {
+		results, err = h.MemStore.SearchSession(r.Context(), session, req.Query, req.Limit)
+	} else {
+		results, err = h.MemStore.Search(r.Context(), req.Query, req.Limit)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "memory_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
 		return
 	}
 
@@ -38,15 +53,10 @@ func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
 	apiResults := make([]api.MemorySearchResult, len(results))
 	for i, sr := range results {
 		apiResults[i] = api.MemorySearchResult{
-			Entry: api.MemoryEntry{
-				ID:        sr.Entry.ID,
-				UserMsg:   sr.Entry.UserMsg,
-				AssistMsg: sr.Entry.AssistMsg,
-				Timestamp: sr.Entry.Timestamp,
-				SessionID: sr.Entry.SessionID,
-			},
+			Entry:         toAPIEntry(sr.Entry),
 			SemanticScore: sr.SemanticScore,
 			KeywordScore:  sr.KeywordScore,
+			RecencyScore:  sr.RecencyScore,
 			CombinedScore: sr.CombinedScore,
 		}
 	}
@@ -59,17 +69,26 @@ func (h *MemoryHandler) Search(w http.ResponseWriter, r *http.Request) {
 func (h *MemoryHandler) Store(w http.ResponseWriter, r *http.Request) {
 	var req api.MemoryStoreRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	if req.Importance < 0 || req.Importance > 1 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "importance must be between 0 and 1")
 		return
 	}
 
+	// Assign the ID here so it can be returned; Add fills it in on its own copy.
 	entry := memory.Entry{
-		UserMsg:   req.UserMsg,
-		AssistMsg: req.AssistMsg,
+		ID:         uuid.New().String(),
+		UserMsg:    req.UserMsg,
+		AssistMsg:  req.AssistMsg,
+		SessionID:  r.Header.Get(api.SessionHeader),
+		Importance: req.Importance,
 	}
 
 	if err := h.MemStore.Add(r.Context(), entry); err != nil {
-		writeError(w, http.StatusInternalServerError, "memory_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
 		return
 	}
 
@@ -77,6 +96,38 @@ func (h *MemoryHandler) Store(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(api.MemoryStoreResponse{ID: entry.ID})
 }
 
+// StoreTrajectory handles POST /v1/memory/trajectories: record an agent
+// turn with its tool calls and results.
+func (h *MemoryHandler) StoreTrajectory(w http.ResponseWriter, r *http.Request) {
+	var req api.TrajectoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "messages must not be empty")
+		return
+	}
+
+	if req.SessionID == "" {
+		req.SessionID = r.Header.Get(api.SessionHeader)
+	}
+	id, err := h.Trajectories.Append(memory.Trajectory{
+		Model:     req.Model,
+		SessionID: req.SessionID,
+		Tools:     req.Tools,
+		Messages:  req.Messages,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.TrajectoryResponse{ID: id})
+}
+
 // List handles GET /v1/memory/list.
 func (h *MemoryHandler) List(w http.ResponseWriter, r *http.Request) {
 	limit := 0
@@ -86,19 +137,13 @@ func (h *MemoryHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	entries, err := h.MemStore.List(r.Context(), limit)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "memory_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
 		return
 	}
 
 	apiEntries := make([]api.MemoryEntry, len(entries))
 	for i, e := range entries {
-		apiEntries[i] = api.MemoryEntry{
-			ID:        e.ID,
-			UserMsg:   e.UserMsg,
-			AssistMsg: e.AssistMsg,
-			Timestamp: e.Timestamp,
-			SessionID: e.SessionID,
-		}
+		apiEntries[i] = toAPIEntry(e)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -114,13 +159,13 @@ func (h *MemoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	parts := strings.Split(strings.TrimPrefix(path, "/v1/memory/"), "/")
 	if len(parts) == 0 || parts[0] == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "memory ID required")
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "memory ID required")
 		return
 	}
 	id := parts[0]
 
 	if err := h.MemStore.Delete(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "memory_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
 		return
 	}
 
@@ -128,10 +173,64 @@ func (h *MemoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
+// SetImportance handles POST /v1/memory/{id}/importance.
+func (h *MemoryHandler) SetImportance(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "memory ID required")
+		return
+	}
+
+	var req api.MemoryImportanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Importance < 0 || req.Importance > 1 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "importance must be between 0 and 1")
+		return
+	}
+
+	if err := h.MemStore.SetImportance(r.Context(), id, req.Importance); err != nil {
+		writeError(w, http.StatusNotFound, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+}
+
+// SetRating handles POST /v1/memory/{id}/rating.
+func (h *MemoryHandler) SetRating(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "memory ID required")
+		return
+	}
+
+	var req api.MemoryRatingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Rating < -1 || req.Rating > 1 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "rating must be -1, 0 or 1")
+		return
+	}
+
+	if err := h.MemStore.SetRating(r.Context(), id, req.Rating); err != nil {
+		writeError(w, http.StatusNotFound, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+}
+
 // Clear handles DELETE /v1/memory.
 func (h *MemoryHandler) Clear(w http.ResponseWriter, r *http.Request) {
 	if err := h.MemStore.Clear(r.Context()); err != nil {
-		writeError(w, http.StatusInternalServerError, "memory_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
 		return
 	}
 
@@ -144,3 +243,112 @@ func (h *MemoryHandler) Count(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(api.MemoryCountResponse{Count: h.MemStore.Count()})
 }
+
+// Export handles GET /v1/memory/export. It streams every entry, including
+// its embedding, as one JSON object per line.
+func (h *MemoryHandler) Export(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.MemStore.Export(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		enc.Encode(api.MemoryRecord{
+			MemoryEntry: toAPIEntry(e.Entry),
+			Metadata:    e.Metadata,
+			Embedding:   e.Embedding,
+		})
+	}
+}
+
+// Import handles POST /v1/memory/import. The body is JSONL in the format
+// written by Export; records are imported in one batch so a malformed line
+// leaves the store untouched.
+func (h *MemoryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var entries []memory.ExportedEntry
+	dec := json.NewDecoder(r.Body)
+	for line := 1; ; line++ {
+		var rec api.MemoryRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, fmt.Sprintf("record %d: %v", line, err))
+			return
+		}
+		if rec.UserMsg == "" && rec.AssistMsg == "" {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, fmt.Sprintf("record %d: empty memory", line))
+			return
+		}
+		entries = append(entries, memory.ExportedEntry{
+			Entry: memory.Entry{
+				ID:         rec.ID,
+				UserMsg:    rec.UserMsg,
+				AssistMsg:  rec.AssistMsg,
+				Timestamp:  rec.Timestamp,
+				SessionID:  rec.SessionID,
+				Metadata:   rec.Metadata,
+				Importance: rec.Importance,
+				Rating:     rec.Rating,
+			},
+			Embedding: rec.Embedding,
+		})
+	}
+
+	if err := h.MemStore.Import(r.Context(), entries); err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.MemoryImportResponse{Imported: len(entries)})
+}
+
+// Compact handles POST /v1/memory/compact. It merges near-duplicate
+// memories through the loaded model; the body may override the similarity
+// threshold.
+func (h *MemoryHandler) Compact(w http.ResponseWriter, r *http.Request) {
+	var req api.MemoryCompactRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	threshold := h.DedupThreshold
+	if req.Threshold > 0 {
+		threshold = req.Threshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "threshold must be in (0, 1]")
+		return
+	}
+
+	res, err := memory.Consolidate(r.Context(), h.MemStore, threshold, h.Merge)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.CodeMemoryError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.MemoryCompactResponse{
+		Clusters: res.Clusters,
+		Removed:  res.Removed,
+		Created:  res.Created,
+	})
+}
+
+func toAPIEntry(e memory.Entry) api.MemoryEntry {
+	return api.MemoryEntry{
+		ID:         e.ID,
+		UserMsg:    e.UserMsg,
+		AssistMsg:  e.AssistMsg,
+		Timestamp:  e.Timestamp,
+		SessionID:  e.SessionID,
+		Importance: e.Importance,
+		Rating:     e.Rating,
+	}
+}
@@ -1,32 +1,52 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuprovider"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/internal/scheduler"
 	"github.com/ThatCatDev/tanrenai/server/pkg/api"
 )
 
+var logger = logging.For("proxy")
+
 // ProxyHandler transparently proxies requests to the GPU server.
 type ProxyHandler struct {
 	GPUClient *gpuclient.Client
 	Provider  gpuprovider.Provider
+	Scheduler *scheduler.Scheduler // limits concurrent chat completions
+	Origins   []string             // browser origins allowed to open WebSockets; "*" allows any
+	Shutdown  <-chan struct{}      // closed when the server shuts down, ending idle WebSockets
 }
 
+// queueKeepalive is how often a queued streaming request is reminded of its
+// position, so proxies do not drop the idle connection.
+const queueKeepalive = 15 * time.Second
+
 // ensureGPU ensures the GPU is running and records activity.
 func (h *ProxyHandler) ensureGPU(w http.ResponseWriter, r *http.Request) bool {
 	h.Provider.RecordActivity()
 	if err := h.Provider.EnsureRunning(r.Context()); err != nil {
-		writeError(w, http.StatusServiceUnavailable, "gpu_unavailable", "GPU server not available: "+err.Error())
+		writeError(w, http.StatusServiceUnavailable, api.CodeGPUUnavailable, "GPU server not available: "+err.Error())
 		return false
 	}
 	return true
 }
 
 // ChatCompletions proxies POST /v1/chat/completions to the GPU server.
+// Requests wait for a free slot in the scheduler first; the X-Priority
+// header ("interactive" or "batch") decides their place in the queue.
+// Requests without a session_id take the api.SessionHeader, keeping each
+// client's conversation on its own prompt cache slot.
 func (h *ProxyHandler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
 	if !h.ensureGPU(w, r) {
 		return
@@ -34,21 +54,31 @@ func (h *ProxyHandler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
 
 	var req api.ChatCompletionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "failed to parse request body: "+err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
 		return
 	}
+	if req.SessionID == "" {
+		req.SessionID = r.Header.Get(api.SessionHeader)
+	}
 
+	priority := scheduler.ParsePriority(r.Header.Get("X-Priority"))
 	if req.Stream {
-		h.streamProxy(w, r, &req)
+		h.streamProxy(w, r, &req, priority)
 	} else {
-		h.completeProxy(w, r, &req)
+		h.completeProxy(w, r, &req, priority)
 	}
 }
 
-func (h *ProxyHandler) completeProxy(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest) {
+func (h *ProxyHandler) completeProxy(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest, priority scheduler.Priority) {
+	release, err := h.Scheduler.Acquire(r.Context(), priority, nil)
+	if err != nil {
+		return // client went away while queued
+	}
+	defer release()
+
 	resp, err := h.GPUClient.ChatCompletion(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		writeAPIError(w, gpuError(err))
 		return
 	}
 
@@ -56,32 +86,36 @@ func (h *ProxyHandler) completeProxy(w http.ResponseWriter, r *http.Request, req
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *ProxyHandler) streamProxy(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest) {
+func (h *ProxyHandler) streamProxy(w http.ResponseWriter, r *http.Request, req *api.ChatCompletionRequest, priority scheduler.Priority) {
+	// While queued, the stream is opened early and carries "queue" events
+	// with the request's position; a request that waits long for the GPU
+	// server's first chunk gets keepalive comments. Once opened, errors can
+	// no longer change the status code and are sent as an "error" event.
+	sw := newSSEWriter(w)
+	defer sw.keepalive()()
+
+	release, err := h.acquireStreaming(r, priority, req.SessionID, func(position int) {
+		fmt.Fprintf(sw, "event: queue\ndata: {\"position\":%d}\n\n", position)
+	})
+	if err != nil {
+		return // client went away while queued
+	}
+	defer release()
+
 	body, err := h.GPUClient.StreamCompletionRaw(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		sw.fail(gpuError(err))
 		return
 	}
 	defer body.Close()
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	flusher, ok := w.(http.Flusher)
-	if ok {
-		flusher.Flush()
-	}
-
+	sw.open()
 	// Stream the raw SSE data through
 	buf := make([]byte, 4096)
 	for {
 		n, err := body.Read(buf)
 		if n > 0 {
-			w.Write(buf[:n])
-			if ok {
-				flusher.Flush()
-			}
+			sw.Write(buf[:n])
 		}
 		if err != nil {
 			break
@@ -89,6 +123,77 @@ func (h *ProxyHandler) streamProxy(w http.ResponseWriter, r *http.Request, req *
 	}
 }
 
+// acquireStreaming waits for a scheduler slot, calling report with the
+// queue position whenever it changes and again every queueKeepalive.
+// session identifies the request in the log.
+func (h *ProxyHandler) acquireStreaming(r *http.Request, priority scheduler.Priority, session string, report func(position int)) (func(), error) {
+	positions := make(chan int, 1)
+	type result struct {
+		release func()
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		release, err := h.Scheduler.Acquire(r.Context(), priority, func(position int) {
+			select {
+			case <-positions:
+			default:
+			}
+			positions <- position
+		})
+		done <- result{release, err}
+	}()
+
+	ticker := time.NewTicker(queueKeepalive)
+	defer ticker.Stop()
+	position := 0
+	for {
+		select {
+		case res := <-done:
+			return res.release, res.err
+		case p := <-positions:
+			if position == 0 {
+				running, queued := h.Scheduler.Stats()
+				logger.Info("chat request queued", "session", session, "priority", priority, "running", running, "queued", queued)
+			}
+			position = p
+			report(position)
+		case <-ticker.C:
+			if position > 0 {
+				report(position)
+			}
+		}
+	}
+}
+
+// streamCompletion starts a streaming completion once the scheduler has a
+// free slot, holding the slot until the stream ends.
+func (h *ProxyHandler) streamCompletion(ctx context.Context, req *api.ChatCompletionRequest, priority scheduler.Priority) (<-chan gpuclient.StreamEvent, error) {
+	release, err := h.Scheduler.Acquire(ctx, priority, nil)
+	if err != nil {
+		return nil, err
+	}
+	events, err := h.GPUClient.StreamCompletion(ctx, req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	out := make(chan gpuclient.StreamEvent)
+	go func() {
+		defer close(out)
+		defer release()
+		for ev := range events {
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
 // Tokenize proxies POST /tokenize to the GPU server.
 func (h *ProxyHandler) Tokenize(w http.ResponseWriter, r *http.Request) {
 	if !h.ensureGPU(w, r) {
@@ -99,13 +204,13 @@ func (h *ProxyHandler) Tokenize(w http.ResponseWriter, r *http.Request) {
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	count, err := h.GPUClient.Tokenize(r.Context(), req.Content)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		writeAPIError(w, gpuError(err))
 		return
 	}
 
@@ -121,7 +226,7 @@ func (h *ProxyHandler) ListModels(w http.ResponseWriter, r *http.Request) {
 
 	result, err := h.GPUClient.ListModels(r.Context())
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		writeAPIError(w, gpuError(err))
 		return
 	}
 
@@ -139,17 +244,18 @@ func (h *ProxyHandler) LoadModel(w http.ResponseWriter, r *http.Request) {
 		Model string `json:"model"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
 		return
 	}
 
-	if err := h.GPUClient.LoadModel(r.Context(), req.Model); err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+	result, err := h.GPUClient.LoadModel(r.Context(), req.Model)
+	if err != nil {
+		writeAPIError(w, gpuError(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(result)
 }
 
 // PullModel proxies POST /api/pull to the GPU server, streaming SSE progress.
@@ -162,34 +268,25 @@ func (h *ProxyHandler) PullModel(w http.ResponseWriter, r *http.Request) {
 		URL string `json:"url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	body, err := h.GPUClient.PullModelStream(r.Context(), req.URL)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		writeAPIError(w, gpuError(err))
 		return
 	}
 	defer body.Close()
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	flusher, ok := w.(http.Flusher)
-	if ok {
-		flusher.Flush()
-	}
-
+	sw := newSSEWriter(w)
+	defer sw.keepalive()()
+	sw.open()
 	buf := make([]byte, 4096)
 	for {
 		n, readErr := body.Read(buf)
 		if n > 0 {
-			w.Write(buf[:n])
-			if ok {
-				flusher.Flush()
-			}
+			sw.Write(buf[:n])
 		}
 		if readErr != nil {
 			break
@@ -202,37 +299,89 @@ func (h *ProxyHandler) RawProxy(w http.ResponseWriter, r *http.Request) {
 	if !h.ensureGPU(w, r) {
 		return
 	}
+	h.forward(w, r)
+}
+
+// Metrics proxies GET /api/metrics. Unlike other requests it neither starts
+// the GPU nor counts as activity, so monitoring cannot keep an idle
+// instance alive.
+func (h *ProxyHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Provider.Status(r.Context())
+	if err != nil || status.State != "running" {
+		writeError(w, http.StatusServiceUnavailable, api.CodeGPUUnavailable, "GPU server is not running")
+		return
+	}
+	h.forward(w, r)
+}
 
+// forward relays r to the same path on the GPU server.
+func (h *ProxyHandler) forward(w http.ResponseWriter, r *http.Request) {
 	gpuURL := h.GPUClient.BaseURL() + r.URL.Path
 	gpuReq, err := http.NewRequestWithContext(r.Context(), r.Method, gpuURL, r.Body)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "proxy_error", err.Error())
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
 		return
 	}
-	gpuReq.Header.Set("Content-Type", "application/json")
+	// Multipart uploads need their boundary.
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	gpuReq.Header.Set("Content-Type", contentType)
 
 	resp, err := http.DefaultClient.Do(gpuReq)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "gpu_error", err.Error())
+		writeAPIError(w, gpuError(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	// Relay events as they come rather than when a buffer fills.
+	sw := newSSEWriter(w)
+	defer sw.keepalive()()
+	sw.open()
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			sw.Write(buf[:n])
+		}
+		if readErr != nil {
+			return
+		}
+	}
 }
 
 func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, api.NewError(status, code, message))
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr *api.Error) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(api.ErrorResponse{
-		Error: api.ErrorDetail{
-			Message: message,
-			Type:    "error",
-			Code:    code,
-		},
-	})
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(apiErr.Response())
+}
+
+// writeSSEError sends apiErr as an "error" event on an open SSE stream.
+func writeSSEError(w io.Writer, apiErr *api.Error) {
+	data, _ := json.Marshal(apiErr.Response())
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+}
+
+// gpuError keeps the status and code of errors the GPU server reported;
+// anything else means the GPU server could not be reached.
+func gpuError(err error) *api.Error {
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return api.NewError(http.StatusBadGateway, api.CodeGPUError, err.Error())
 }
 
 // readBody is a helper for reading and discarding a request body.
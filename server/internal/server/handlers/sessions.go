@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+var sessionLogger = logging.For("sessions")
+
+// summaryTimeout bounds a summary run after an append, which may have to
+// wait for the GPU to start and for a free slot.
+const summaryTimeout = 10 * time.Minute
+
+// SessionHandler handles the chat session endpoints. Sessions hold the whole
+// history plus the summary and state of its summarized part; clients build
+// their context window from them the same way they do for a local chat,
+// unless the session's ContextTokens has the backend manage it.
+type SessionHandler struct {
+	Store *sessions.Store
+	// Summarize condenses the oldest messages of sessions with
+	// ContextTokens set; without it their windows just drop them.
+	Summarize sessions.SummarizeFunc
+	// Go runs a summary in the background once an append has been
+	// answered, with a context that ends when the server shuts down.
+	Go func(fn func(ctx context.Context))
+
+	mu         sync.Mutex
+	compacting map[string]bool // sessions with a summary running
+}
+
+// Create handles POST /v1/sessions.
+func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req api.SessionCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	if err := validateSessionSettings(req.Settings); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	sess, err := h.Store.Create(api.Session{Title: req.Title, Model: req.Model, Messages: req.Messages, Settings: req.Settings})
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// List handles GET /v1/sessions.
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	infos, err := h.Store.List()
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.SessionListResponse{Sessions: infos})
+}
+
+// Get handles GET /v1/sessions/{id}.
+func (h *SessionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r.PathValue("id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// Update handles PATCH /v1/sessions/{id}.
+func (h *SessionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req api.SessionUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+	if req.Settings != nil {
+		if err := validateSessionSettings(*req.Settings); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+	}
+
+	sess, err := h.Store.Update(r.PathValue("id"), func(s *api.Session) error {
+		if req.Title != nil {
+			s.Title = *req.Title
+		}
+		if req.Model != nil {
+			s.Model = *req.Model
+		}
+		if req.Summary != nil {
+			s.Summary = *req.Summary
+		}
+		if req.State != nil {
+			s.State = *req.State
+		}
+		if req.Settings != nil {
+			s.Settings = *req.Settings
+		}
+		return nil
+	})
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// Append handles POST /v1/sessions/{id}/messages.
+func (h *SessionHandler) Append(w http.ResponseWriter, r *http.Request) {
+	var req api.SessionAppendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "failed to parse request body: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	sess, err := h.Store.Update(id, func(s *api.Session) error {
+		if req.ExpectedCount != nil && *req.ExpectedCount != len(s.Messages) {
+			return api.NewError(http.StatusConflict, api.CodeConflict,
+				fmt.Sprintf("session has %d messages, expected %d", len(s.Messages), *req.ExpectedCount))
+		}
+		s.Messages = append(s.Messages, req.Messages...)
+		return nil
+	})
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if sess.Settings.ContextTokens > 0 && h.Summarize != nil && h.start(id) {
+		h.Go(func(ctx context.Context) {
+			defer h.finish(id)
+			ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+			defer cancel()
+			h.compact(ctx, id)
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.SessionAppendResponse{MessageCount: len(sess.Messages)})
+}
+
+// Context handles GET /v1/sessions/{id}/context, the session's context
+// window as the backend manages it. A session over its ContextTokens is
+// summarized first, unless an append is already summarizing it.
+func (h *SessionHandler) Context(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var sess *api.Session
+	if h.Summarize != nil && h.start(id) {
+		sess = h.compact(r.Context(), id)
+		h.finish(id)
+	}
+	if sess == nil {
+		var err error
+		if sess, err = h.Store.Get(id); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+	}
+
+	messages := sessions.Window(sess, sess.Settings.ContextTokens)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.SessionContextResponse{
+		Messages:   messages,
+		Summarized: sess.Summarized,
+		Tokens:     sessions.EstimateTokens(messages),
+	})
+}
+
+// start claims session id for a summary run, reporting false if one is
+// already running; finish releases it.
+func (h *SessionHandler) start(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.compacting[id] {
+		return false
+	}
+	if h.compacting == nil {
+		h.compacting = make(map[string]bool)
+	}
+	h.compacting[id] = true
+	return true
+}
+
+func (h *SessionHandler) finish(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.compacting, id)
+}
+
+// compact summarizes session id if it has outgrown its ContextTokens and
+// returns it, or nil if it could not be read. A failed summary is logged
+// rather than failing the request: the window then drops the messages
+// that do not fit, and the next append or fetch tries again.
+func (h *SessionHandler) compact(ctx context.Context, id string) *api.Session {
+	sess, err := h.Store.Compact(ctx, id, h.Summarize)
+	if err != nil {
+		sessionLogger.Warn("session summary failed", "session", id, "err", err)
+	}
+	return sess
+}
+
+// Delete handles DELETE /v1/sessions/{id}.
+func (h *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.Delete(r.PathValue("id")); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func validateSessionSettings(settings api.SessionSettings) error {
+	if settings.ContextTokens < 0 {
+		return api.NewError(http.StatusBadRequest, api.CodeInvalidRequest, "context_tokens must not be negative")
+	}
+	switch settings.MemoryScope {
+	case "", api.MemoryScopeGlobal, api.MemoryScopeSession:
+		return nil
+	}
+	return api.NewError(http.StatusBadRequest, api.CodeInvalidRequest,
+		fmt.Sprintf("memory_scope must be %q or %q", api.MemoryScopeGlobal, api.MemoryScopeSession))
+}
+
+// requestSession returns the session named by r's api.SessionHeader and,
+// if it is a stored session, its settings. Other IDs still identify the
+// client's conversation, with default settings.
+func requestSession(r *http.Request, store *sessions.Store) (string, api.SessionSettings) {
+	id := r.Header.Get(api.SessionHeader)
+	if id == "" || store == nil {
+		return id, api.SessionSettings{}
+	}
+	settings, _ := store.Settings(id)
+	return id, settings
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	var apiErr *api.Error
+	switch {
+	case errors.As(err, &apiErr):
+		writeAPIError(w, apiErr)
+	case errors.Is(err, sessions.ErrNotFound):
+		writeError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, api.CodeInternalError, err.Error())
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// sseKeepalive is how long an SSE stream may go without sending anything
+// before it gets a comment, so proxies do not drop the connection while a
+// slow model works through a long prompt or generation.
+const sseKeepalive = 15 * time.Second
+
+// sseWriter writes an SSE stream that several goroutines may write to,
+// flushing every write. The stream is opened, with its headers, on the
+// first write, so errors before then can still set the status code.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+
+	mu     sync.Mutex
+	opened bool
+	last   time.Time // of the last write
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	flusher, _ := w.(http.Flusher)
+	return &sseWriter{w: w, flusher: flusher, last: time.Now()}
+}
+
+// open sends the stream's headers now.
+func (s *sseWriter) open() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openLocked()
+	s.flushLocked()
+}
+
+func (s *sseWriter) openLocked() {
+	if s.opened {
+		return
+	}
+	s.opened = true
+	h := s.w.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/event-stream")
+	}
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+}
+
+func (s *sseWriter) flushLocked() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// Write sends p, opening the stream if needed.
+func (s *sseWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openLocked()
+	n, err := s.w.Write(p)
+	s.flushLocked()
+	s.last = time.Now()
+	return n, err
+}
+
+// fail reports apiErr: with its status code if the stream is not open
+// yet, else as an "error" event.
+func (s *sseWriter) fail(apiErr *api.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = time.Now()
+	if !s.opened {
+		s.opened = true
+		writeAPIError(s.w, apiErr)
+		return
+	}
+	writeSSEError(s.w, apiErr)
+	s.flushLocked()
+}
+
+// keepalive sends a comment whenever the stream has been quiet for
+// sseKeepalive, opening it if need be, until the returned function is
+// called; the handler must call it before returning.
+func (s *sseWriter) keepalive() (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(sseKeepalive / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			s.mu.Lock()
+			if time.Since(s.last) >= sseKeepalive {
+				s.openLocked()
+				s.w.Write([]byte(": keepalive\n\n"))
+				s.flushLocked()
+				s.last = time.Now()
+			}
+			s.mu.Unlock()
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/scheduler"
+	"github.com/ThatCatDev/tanrenai/server/internal/websocket"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+const (
+	wsPingInterval   = 30 * time.Second
+	wsReadTimeout    = 2 * wsPingInterval // a ping and its pong must fit in this
+	wsMaxMessageSize = 32 << 20           // long conversations make large requests
+)
+
+// ChatCompletionsWS serves GET /v1/chat/completions upgraded to a
+// WebSocket, for networks whose proxies buffer SSE. Each text message from
+// the client is a chat completion request; the reply is the same chunks the
+// SSE stream carries, one per message, ending with a "[DONE]" message. The
+// connection then takes the next request.
+//
+// Problems close the connection: 1007 for an invalid request, 1013 when the
+// GPU is unavailable and 1011 when it fails, each preceded by an error
+// message. Priority comes from X-Priority or, for browsers, ?priority=,
+// and the session from api.SessionHeader or ?session=.
+func (h *ProxyHandler) ChatCompletionsWS(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsUpgrade(r) {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "GET /v1/chat/completions requires a WebSocket upgrade; use POST otherwise")
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !slices.Contains(h.Origins, "*") && !slices.Contains(h.Origins, origin) {
+		writeError(w, http.StatusForbidden, api.CodeForbidden, "origin not allowed")
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r, wsMaxMessageSize)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	priority := scheduler.ParsePriority(r.Header.Get("X-Priority"))
+	if p := r.URL.Query().Get("priority"); p != "" {
+		priority = scheduler.ParsePriority(p)
+	}
+	session := r.Header.Get(api.SessionHeader)
+	if s := r.URL.Query().Get("session"); s != "" {
+		session = s
+	}
+
+	// Hijacked connections outlive the request context, so the connection
+	// gets its own, cancelled when the client goes away or when the server
+	// cancels requests at its shutdown deadline.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer context.AfterFunc(r.Context(), cancel)()
+
+	requests := make(chan []byte)
+	go func() {
+		defer cancel()
+		for {
+			msg, err := conn.ReadMessage(wsReadTimeout)
+			if err != nil {
+				var ce *websocket.CloseError
+				if !errors.As(err, &ce) && ctx.Err() == nil {
+					conn.Close(websocket.CloseGoingAway, "read failed")
+				}
+				return
+			}
+			select {
+			case requests <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	go func() {
+		for {
+			select {
+			case <-ping.C:
+				if conn.Ping() != nil {
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg []byte
+		select {
+		case msg = <-requests:
+		case <-ctx.Done():
+			return
+		case <-h.Shutdown:
+			// Between completions; one in progress is left to finish.
+			conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+
+		var req api.ChatCompletionRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			closeWS(conn, websocket.CloseInvalidPayload, api.NewError(0, api.CodeInvalidRequest, "failed to parse request: "+err.Error()))
+			return
+		}
+		if req.SessionID == "" {
+			req.SessionID = session
+		}
+
+		h.Provider.RecordActivity()
+		if err := h.Provider.EnsureRunning(ctx); err != nil {
+			closeWS(conn, websocket.CloseTryAgainLater, api.NewError(0, api.CodeGPUUnavailable, "GPU server not available: "+err.Error()))
+			return
+		}
+		if err := h.streamWS(ctx, conn, &req, priority); err != nil {
+			if ctx.Err() == nil {
+				closeWS(conn, websocket.CloseInternalError, gpuError(err))
+			}
+			return
+		}
+	}
+}
+
+// streamWS relays one completion's SSE payloads as WebSocket messages.
+func (h *ProxyHandler) streamWS(ctx context.Context, conn *websocket.Conn, req *api.ChatCompletionRequest, priority scheduler.Priority) error {
+	release, err := h.Scheduler.Acquire(ctx, priority, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	body, err := h.GPUClient.StreamCompletionRaw(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			event = ""
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		switch event {
+		case "":
+		case "error":
+			return api.DecodeError(0, []byte(data))
+		default:
+			continue // e.g. the GPU server's "status" while a model warms up
+		}
+		if err := conn.WriteText([]byte(data)); err != nil {
+			return err
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return conn.WriteText([]byte("[DONE]"))
+}
+
+// closeWS sends apiErr in the usual error schema, then closes the
+// connection with code.
+func closeWS(conn *websocket.Conn, code int, apiErr *api.Error) {
+	data, _ := json.Marshal(apiErr.Response())
+	conn.WriteText(data)
+	conn.Close(code, apiErr.Code)
+}
@@ -1,12 +1,24 @@
 package server
 
 import (
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/internal/memory"
 	"github.com/ThatCatDev/tanrenai/server/internal/server/handlers"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
+	"github.com/ThatCatDev/tanrenai/server/internal/tools"
+	"github.com/ThatCatDev/tanrenai/server/internal/webui"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
 )
 
+var httpLogger = logging.For("http")
+
 func (s *Server) registerRoutes(mux *http.ServeMux) {
 	// Health
 	mux.HandleFunc("GET /health", handlers.Health)
@@ -15,51 +27,157 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	proxy := &handlers.ProxyHandler{
 		GPUClient: s.gpuClient,
 		Provider:  s.provider,
+		Scheduler: s.chats,
+		Origins:   s.cfg.CORSOrigins,
+		Shutdown:  s.draining.Done(),
 	}
 	mux.HandleFunc("POST /v1/chat/completions", proxy.ChatCompletions)
+	mux.HandleFunc("GET /v1/chat/completions", proxy.ChatCompletionsWS)
 	mux.HandleFunc("POST /tokenize", proxy.Tokenize)
 	mux.HandleFunc("GET /v1/models", proxy.ListModels)
 	mux.HandleFunc("POST /api/load", proxy.LoadModel)
 	mux.HandleFunc("POST /api/pull", proxy.PullModel)
+	mux.HandleFunc("GET /api/pull/partial", proxy.RawProxy)
+	mux.HandleFunc("DELETE /api/pull/partial", proxy.RawProxy)
+	mux.HandleFunc("GET /api/models", proxy.RawProxy)
+	mux.HandleFunc("GET /api/models/{name}", proxy.RawProxy)
+	mux.HandleFunc("DELETE /api/models/{name}", proxy.RawProxy)
+	mux.HandleFunc("GET /api/metrics", proxy.Metrics)
+	info := &handlers.InfoHandler{GPUClient: s.gpuClient, Provider: s.provider, Version: s.cfg.Version}
+	if s.memStore != nil {
+		info.Features = append(info.Features, api.FeatureMemory)
+	}
+	if s.cfg.AgentEnabled {
+		info.Features = append(info.Features, api.FeatureAgent)
+	}
+	mux.HandleFunc("GET /api/info", info.ServeHTTP)
+	mux.HandleFunc("POST /api/adapters/load", proxy.RawProxy)
+	mux.HandleFunc("POST /api/adapters/unload", proxy.RawProxy)
+
+	// Server-side agent loop (opt-in: its tools run on this machine)
+	if s.cfg.AgentEnabled {
+		ag := &handlers.AgentHandler{
+			Proxy:         proxy,
+			Tools:         tools.DefaultRegistry().Subset(s.cfg.AgentTools...),
+			MaxIterations: s.cfg.AgentMaxIterations,
+			Sessions:      s.sessions,
+			Remotes:       make(map[string]handlers.RemoteModel),
+		}
+		for alias, m := range s.cfg.RemoteModels {
+			ag.Remotes[alias] = handlers.RemoteModel{
+				Client: gpuclient.NewRemote(m.BaseURL, os.Getenv(m.KeyEnv)),
+				Model:  m.Model,
+			}
+		}
+		mux.HandleFunc("POST /v1/agent/runs", ag.Start)
+		mux.HandleFunc("DELETE /v1/agent/runs/{id}", ag.Cancel)
+	}
 
-	// Finetune proxy to GPU server
-	mux.HandleFunc("POST /v1/finetune/prepare", proxy.RawProxy)
+	// OpenAI-compatible embeddings, served by the GPU server's embedding
+	// model (the same one memory uses), which starts it on first use.
+	mux.HandleFunc("POST /v1/embeddings", proxy.RawProxy)
+	// Speech to text, served by the GPU server's whisper-server.
+	mux.HandleFunc("POST /v1/audio/transcriptions", proxy.RawProxy)
+
+	// Finetune proxy to GPU server; with memory, prepare can build the
+	// dataset from it.
+	if s.memStore != nil {
+		ft := &handlers.FinetuneHandler{MemStore: s.memStore, Trajectories: s.trajectories, Proxy: proxy}
+		mux.HandleFunc("POST /v1/finetune/dataset", ft.Dataset)
+		mux.HandleFunc("POST /v1/finetune/prepare", ft.Prepare)
+	} else {
+		mux.HandleFunc("POST /v1/finetune/prepare", proxy.RawProxy)
+	}
+	mux.HandleFunc("POST /v1/finetune/import", proxy.RawProxy)
 	mux.HandleFunc("POST /v1/finetune/train", proxy.RawProxy)
 	mux.HandleFunc("GET /v1/finetune/status/", proxy.RawProxy)
+	mux.HandleFunc("GET /v1/finetune/events/{run_id}", proxy.RawProxy)
 	mux.HandleFunc("POST /v1/finetune/merge", proxy.RawProxy)
+	mux.HandleFunc("POST /v1/finetune/evaluate", proxy.RawProxy)
+	mux.HandleFunc("POST /v1/finetune/deploy", proxy.RawProxy)
+	mux.HandleFunc("POST /v1/finetune/release", proxy.RawProxy)
 	mux.HandleFunc("GET /v1/finetune/runs", proxy.RawProxy)
+	mux.HandleFunc("POST /v1/finetune/gc", proxy.RawProxy)
 	mux.HandleFunc("DELETE /v1/finetune/runs/", proxy.RawProxy)
 
 	// Memory endpoints (only active if memory store is set)
 	if s.memStore != nil {
-		mem := &handlers.MemoryHandler{MemStore: s.memStore}
+		mem := &handlers.MemoryHandler{
+			MemStore:       s.memStore,
+			Merge:          memory.NewLLMMergeFunc(s.backgroundCompletion),
+			DedupThreshold: float32(s.cfg.MemoryDedupThreshold),
+			Trajectories:   s.trajectories,
+			Sessions:       s.sessions,
+		}
 		mux.HandleFunc("POST /v1/memory/search", mem.Search)
 		mux.HandleFunc("POST /v1/memory/store", mem.Store)
 		mux.HandleFunc("GET /v1/memory/list", mem.List)
 		mux.HandleFunc("DELETE /v1/memory/{id}", mem.Delete)
+		mux.HandleFunc("POST /v1/memory/{id}/importance", mem.SetImportance)
+		mux.HandleFunc("POST /v1/memory/{id}/rating", mem.SetRating)
 		mux.HandleFunc("DELETE /v1/memory", mem.Clear)
 		mux.HandleFunc("GET /v1/memory/count", mem.Count)
+		mux.HandleFunc("GET /v1/memory/export", mem.Export)
+		mux.HandleFunc("POST /v1/memory/import", mem.Import)
+		mux.HandleFunc("POST /v1/memory/compact", mem.Compact)
+		mux.HandleFunc("POST /v1/memory/trajectories", mem.StoreTrajectory)
 	}
 
-	// Instance management (always registered — provider handles local vs vastai)
-	inst := &handlers.InstanceHandler{Provider: s.provider}
+	// Chat sessions shared between clients
+	sess := &handlers.SessionHandler{
+		Store:     s.sessions,
+		Summarize: sessions.NewLLMSummarizeFunc(s.backgroundCompletion),
+		Go:        s.goBackground,
+	}
+	mux.HandleFunc("POST /v1/sessions", sess.Create)
+	mux.HandleFunc("GET /v1/sessions", sess.List)
+	mux.HandleFunc("GET /v1/sessions/{id}", sess.Get)
+	mux.HandleFunc("PATCH /v1/sessions/{id}", sess.Update)
+	mux.HandleFunc("DELETE /v1/sessions/{id}", sess.Delete)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", sess.Append)
+	mux.HandleFunc("GET /v1/sessions/{id}/context", sess.Context)
+
+	// Instance management (always registered — provider handles local vs remote)
+	inst := &handlers.InstanceHandler{Provider: s.provider, Tunnel: s.tunnelStatus, Shutdown: s.draining.Done()}
 	mux.HandleFunc("GET /api/instance/status", inst.Status)
 	mux.HandleFunc("POST /api/instance/start", inst.Start)
 	mux.HandleFunc("POST /api/instance/stop", inst.Stop)
+	mux.HandleFunc("POST /api/instance/autostop", inst.Autostop)
+	mux.HandleFunc("GET /api/instance/events", inst.Events)
+	mux.HandleFunc("GET /api/instance/costs", inst.Costs)
+
+	// Browser chat UI, built on the endpoints above
+	if s.cfg.WebUI {
+		mux.Handle("GET "+webui.Prefix, webui.Handler())
+		mux.Handle("GET /ui", http.RedirectHandler(webui.Prefix, http.StatusMovedPermanently))
+	}
 }
 
 func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		httpLogger.Info("request", "client", clientIP(r), "method", r.Method, "path", r.URL.Path)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func withCORS(next http.Handler) http.Handler {
+// withCORS allows browser calls from origins; "*" allows any origin.
+// Requests from other origins get no CORS headers, so browsers block them.
+func withCORS(origins, headers []string, next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(origins, "*")
+	allowHeaders := strings.Join(headers, ", ")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		origin := r.Header.Get("Origin")
+		switch {
+		case anyOrigin:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && slices.Contains(origins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+		}
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -67,3 +185,44 @@ func withCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// withForwardedFor replaces r.RemoteAddr with the client address from
+// X-Forwarded-For when the request comes from a trusted proxy. The header is
+// read right to left, skipping trusted hops, so a client cannot spoof its
+// address by sending the header itself. Without trusted proxies the header
+// is ignored.
+func withForwardedFor(trusted []*net.IPNet, next http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		return next
+	}
+	isTrusted := func(ip net.IP) bool {
+		return ip != nil && slices.ContainsFunc(trusted, func(n *net.IPNet) bool { return n.Contains(ip) })
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isTrusted(net.ParseIP(clientIP(r))) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			if !isTrusted(ip) {
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the host part of r.RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -3,15 +3,27 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ThatCatDev/tanrenai/server/internal/config"
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
 	"github.com/ThatCatDev/tanrenai/server/internal/gpuprovider"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
 	"github.com/ThatCatDev/tanrenai/server/internal/memory"
+	"github.com/ThatCatDev/tanrenai/server/internal/scheduler"
+	"github.com/ThatCatDev/tanrenai/server/internal/sessions"
+	"github.com/ThatCatDev/tanrenai/server/internal/training"
+	"github.com/ThatCatDev/tanrenai/server/internal/tunnel"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+var (
+	logger       = logging.For("server")
+	memoryLogger = logging.For("memory")
 )
 
 // Server is the tanrenai backend HTTP API server.
@@ -20,64 +32,291 @@ type Server struct {
 	http      *http.Server
 	gpuClient *gpuclient.Client
 	memStore  memory.Store
+	sessions  *sessions.Store
 	provider  gpuprovider.Provider
+	chats     *scheduler.Scheduler // limits concurrent chat completions
+	// trajectories, kept next to memory, records agent turns for
+	// tool-calling fine-tunes.
+	trajectories *memory.TrajectoryLog
+	tunnel       *tunnel.Tunnel // nil unless the GPU server is reached over SSH
+
+	// On shutdown, draining is cancelled as the server stops accepting
+	// requests, ending event streams, and requestCtx, the base of every
+	// request's context, once the drain deadline passes.
+	draining      context.Context
+	stopDraining  context.CancelFunc
+	requestCtx    context.Context
+	cancelRequest context.CancelFunc
+	inflight      sync.WaitGroup // requests being handled
+	background    sync.WaitGroup // scheduled jobs and summaries using the stores
 }
 
 // New creates a new backend Server.
-func New(cfg *config.Config, gpuClient *gpuclient.Client, memStore memory.Store, provider gpuprovider.Provider) *Server {
+func New(cfg *config.Config, gpuClient *gpuclient.Client, memStore memory.Store, sessionStore *sessions.Store, provider gpuprovider.Provider) *Server {
 	s := &Server{
 		cfg:       cfg,
 		gpuClient: gpuClient,
 		memStore:  memStore,
+		sessions:  sessionStore,
 		provider:  provider,
+		chats:     scheduler.New(cfg.ChatSlots),
 	}
+	if memStore != nil {
+		s.trajectories = memory.NewTrajectoryLog(cfg.MemoryDir)
+	}
+	s.draining, s.stopDraining = context.WithCancel(context.Background())
+	s.requestCtx, s.cancelRequest = context.WithCancel(context.Background())
 
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
 
 	s.http = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Handler: withLogging(withCORS(mux)),
+		Addr:        fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:     withForwardedFor(cfg.TrustedProxies, withLogging(withCORS(cfg.CORSOrigins, cfg.CORSHeaders, withCompression(s.tracked(mux))))),
+		BaseContext: func(net.Listener) context.Context { return s.requestCtx },
 	}
 
 	return s
 }
 
 // Start starts the server and blocks until the context is cancelled.
+// SetTunnel reports t's state in the instance status. Call it before
+// Start.
+func (s *Server) SetTunnel(t *tunnel.Tunnel) {
+	s.tunnel = t
+}
+
+func (s *Server) tunnelStatus() *tunnel.Status {
+	if s.tunnel == nil {
+		return nil
+	}
+	return s.tunnel.Status()
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	ln, err := net.Listen("tcp", s.http.Addr)
 	if err != nil {
 		return fmt.Errorf("listen: %w", err)
 	}
 
-	log.Printf("Tanrenai backend listening on %s", s.http.Addr)
-	log.Printf("GPU server: %s", s.cfg.GPUURL)
-	log.Printf("GPU provider: %s", s.provider.Name())
+	scheme := "http"
+	if s.cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	logger.Info("Tanrenai backend listening", "addr", scheme+"://"+s.http.Addr,
+		"gpu_url", s.cfg.GPUURL, "gpu_provider", s.provider.Name(), "sessions_dir", s.cfg.SessionsDir)
 	if s.memStore != nil {
-		log.Printf("Memory enabled (dir: %s)", s.cfg.MemoryDir)
+		logger.Info("memory enabled", "dir", s.cfg.MemoryDir)
+	}
+	if s.cfg.AgentEnabled {
+		logger.Info("agent runs enabled", "tools", strings.Join(s.cfg.AgentTools, ","))
 	}
 
 	s.provider.StartIdleTimer()
 
+	if s.memStore != nil && s.cfg.MemoryCompactInterval != "" {
+		if interval, err := time.ParseDuration(s.cfg.MemoryCompactInterval); err == nil && interval > 0 {
+			s.background.Add(1)
+			go func() {
+				defer s.background.Done()
+				s.runMemoryCompaction(ctx, interval)
+			}()
+			memoryLogger.Info("consolidation scheduled", "every", interval)
+		}
+	}
+
+	if s.memStore != nil && s.cfg.FinetuneSchedule != "" {
+		s.startFinetuneSchedule(ctx)
+	}
+
 	errCh := make(chan error, 1)
 	go func() {
+		if s.cfg.TLSCert != "" {
+			errCh <- s.http.ServeTLS(ln, s.cfg.TLSCert, s.cfg.TLSKey)
+			return
+		}
 		errCh <- s.http.Serve(ln)
 	}()
 
 	select {
 	case <-ctx.Done():
-		log.Println("Shutting down server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := s.http.Shutdown(shutdownCtx); err != nil {
-			log.Printf("Server shutdown error: %v", err)
-		}
-		s.provider.Close()
-		if s.memStore != nil {
-			s.memStore.Close()
-		}
+		s.shutdown()
 		return nil
 	case err := <-errCh:
 		return err
 	}
 }
+
+// cancelGrace is how long requests get to return once cancelled at the
+// drain deadline.
+const cancelGrace = 10 * time.Second
+
+// shutdown stops accepting requests and lets those in flight finish for
+// up to ShutdownTimeout, then cancels the rest. Once no request or
+// scheduled job can touch the memory store any more, it is flushed and
+// closed, so a restart never finds its index files half written.
+func (s *Server) shutdown() {
+	timeout, err := time.ParseDuration(s.cfg.ShutdownTimeout)
+	if err != nil || timeout < 0 {
+		timeout = 30 * time.Second
+	}
+	logger.Info("shutting down", "drain_timeout", timeout)
+	s.stopDraining()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.http.Shutdown(drainCtx); err != nil {
+		logger.Warn("requests still running at the drain deadline; cancelling them", "err", err)
+	}
+	s.cancelRequest()
+	if !waitFor(&s.inflight, cancelGrace) {
+		logger.Warn("requests did not return after being cancelled")
+	}
+	s.http.Close()
+
+	// Scheduled compaction and fine-tunes stop with the signal's context.
+	s.background.Wait()
+	s.provider.Close()
+	if s.memStore != nil {
+		if err := s.memStore.Close(); err != nil {
+			memoryLogger.Error("flushing memory failed", "err", err)
+		}
+	}
+	logger.Info("shutdown complete")
+}
+
+// tracked counts the requests being handled, for shutdown to wait on.
+func (s *Server) tracked(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inflight.Add(1)
+		defer s.inflight.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitFor waits for wg up to timeout and reports whether it finished.
+func waitFor(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// backgroundCompletion runs a chat completion for the backend's own work,
+// such as session summaries and memory merges, the way the proxy runs a client's: it starts
+// the GPU if needed, waits for a batch slot so interactive requests go
+// first, and records activity before and after so the idle timer does not
+// stop the instance under it.
+func (s *Server) backgroundCompletion(ctx context.Context, req *api.ChatCompletionRequest) (*api.ChatCompletionResponse, error) {
+	s.provider.RecordActivity()
+	if err := s.provider.EnsureRunning(ctx); err != nil {
+		return nil, fmt.Errorf("GPU server not available: %w", err)
+	}
+	release, err := s.chats.Acquire(ctx, scheduler.Batch, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer s.provider.RecordActivity()
+	return s.gpuClient.ChatCompletion(ctx, req)
+}
+
+// goBackground runs fn outside of any request, such as a session summary
+// after the append that triggered it has been answered. Shutdown waits for
+// it after cancelling its context along with the requests'.
+func (s *Server) goBackground(fn func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn(s.requestCtx)
+	}()
+}
+
+// runMemoryCompaction periodically merges near-duplicate memories. Runs are
+// skipped while the GPU is not running so the job never wakes a stopped
+// instance on its own.
+func (s *Server) runMemoryCompaction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	merge := memory.NewLLMMergeFunc(s.backgroundCompletion)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err := s.provider.Status(ctx)
+		if err != nil || status.State != "running" {
+			continue
+		}
+
+		res, err := memory.Consolidate(ctx, s.memStore, float32(s.cfg.MemoryDedupThreshold), merge)
+		if err != nil {
+			memoryLogger.Error("consolidation failed", "err", err)
+			continue
+		}
+		if res.Clusters > 0 {
+			memoryLogger.Info("consolidation merged entries", "removed", res.Removed, "created", res.Created)
+		}
+	}
+}
+
+// finetuneIdleWait is how long after the last interactive chat a scheduled
+// fine-tune waits, so it does not take the GPU from someone mid-session.
+const finetuneIdleWait = 15 * time.Minute
+
+// startFinetuneSchedule runs the fine-tune scheduler in the background.
+// The config was validated by serve.
+func (s *Server) startFinetuneSchedule(ctx context.Context) {
+	schedule, err := training.ParseSchedule(s.cfg.FinetuneSchedule)
+	if err != nil {
+		logger.Error("fine-tune schedule disabled", "err", err)
+		return
+	}
+	cfg := training.ScheduleConfig{
+		Schedule:      schedule,
+		BaseModel:     s.cfg.FinetuneModel,
+		MinNewSamples: s.cfg.FinetuneMinNew,
+		Filter:        memory.DatasetFilter{ExcludeErrors: true, Dedupe: true},
+	}
+	if s.cfg.FinetuneQuietHours != "" {
+		if cfg.Quiet, err = training.ParseQuietHours(s.cfg.FinetuneQuietHours); err != nil {
+			logger.Error("fine-tune schedule disabled", "err", err)
+			return
+		}
+	}
+	sched := training.NewScheduler(cfg, s.gpuClient, s.memStore, s.cfg.MemoryDir, s.finetuneBusy)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		sched.Run(ctx)
+	}()
+	logger.Info("fine-tunes scheduled", "schedule", schedule, "base_model", cfg.BaseModel,
+		"min_new", cfg.MinNewSamples, "quiet_hours", s.cfg.FinetuneQuietHours)
+}
+
+// finetuneBusy reports why a scheduled fine-tune should wait: chats are
+// running or queued, one finished less than finetuneIdleWait ago, or the
+// GPU is not running, which the scheduler never changes on its own.
+func (s *Server) finetuneBusy(ctx context.Context) string {
+	if running, queued := s.chats.Stats(); running+queued > 0 {
+		return fmt.Sprintf("%d chat completions running, %d queued", running, queued)
+	}
+	if last := s.chats.LastInteractive(); time.Since(last) < finetuneIdleWait {
+		return "interactive use in the last " + finetuneIdleWait.String()
+	}
+	status, err := s.provider.Status(ctx)
+	if err != nil || status.State != "running" {
+		return "GPU is not running"
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// charsPerToken and messageOverhead give a rough token count without a
+// round trip to the GPU server's tokenizer; windows leave room for the
+// error.
+const (
+	charsPerToken   = 3.5
+	messageOverhead = 4 // role and template tokens per message
+)
+
+// SummarizeFunc condenses messages into a new summary that also keeps
+// what previous, the summary so far, says.
+type SummarizeFunc func(ctx context.Context, previous string, messages []api.Message) (string, error)
+
+// EstimateTokens estimates how many tokens msgs take in a prompt.
+func EstimateTokens(msgs []api.Message) int {
+	total := 0
+	for _, m := range msgs {
+		total += estimateMessage(m)
+	}
+	return total
+}
+
+func estimateMessage(m api.Message) int {
+	chars := len(m.Content)
+	for _, tc := range m.ToolCalls {
+		chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+	}
+	return messageOverhead + int(float64(chars)/charsPerToken+0.5)
+}
+
+// Window returns sess's context within budget tokens: its summary as a
+// system message, then the most recent messages after the summarized ones
+// that fit. A budget of 0 keeps every unsummarized message.
+func Window(sess *api.Session, budget int) []api.Message {
+	var out []api.Message
+	if sess.Summary != "" {
+		out = append(out, summaryMessage(sess.Summary))
+	}
+	msgs := sess.Messages[min(sess.Summarized, len(sess.Messages)):]
+	if budget <= 0 {
+		return append(out, msgs...)
+	}
+	return append(out, msgs[keepFrom(msgs, budget-EstimateTokens(out)):]...)
+}
+
+func summaryMessage(summary string) api.Message {
+	return api.Message{Role: "system", Content: "[Summary of earlier conversation]\n" + summary}
+}
+
+// keepFrom returns the index of the first of msgs that, with all after it,
+// fits in budget tokens. The window never starts on a tool result, whose
+// call would be missing.
+func keepFrom(msgs []api.Message, budget int) int {
+	start, used := len(msgs), 0
+	for start > 0 {
+		tokens := estimateMessage(msgs[start-1])
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		start--
+	}
+	for start < len(msgs) && msgs[start].Role == "tool" {
+		start++
+	}
+	return start
+}
+
+// summarizeCutoff returns how many leading messages of sess should be
+// summarized: none more than now while the rest fit in budget, otherwise
+// enough that what is left fills half of it, so that the next few appends
+// do not summarize again.
+func summarizeCutoff(sess *api.Session, budget int) int {
+	done := min(sess.Summarized, len(sess.Messages))
+	msgs := sess.Messages[done:]
+	if budget <= 0 || EstimateTokens(msgs) <= budget {
+		return done
+	}
+	return done + keepFrom(msgs, budget/2)
+}
+
+const summarizePrompt = `You maintain the running summary of a long conversation between a user and an AI assistant. You are given the summary so far and the messages that follow it. Write a new summary that keeps everything from the old one that still matters and adds what the new messages establish: the user's goals, decisions made, files and commands involved, facts learned and open tasks. Be concise and factual. Reply with the summary only.`
+
+// NewLLMSummarizeFunc returns a SummarizeFunc that asks the currently
+// loaded model on the GPU server for the summary through complete.
+func NewLLMSummarizeFunc(complete gpuclient.CompletionFunc) SummarizeFunc {
+	return func(ctx context.Context, previous string, messages []api.Message) (string, error) {
+		var b strings.Builder
+		if previous != "" {
+			fmt.Fprintf(&b, "Summary so far:\n%s\n\n", previous)
+		}
+		b.WriteString("New messages:\n")
+		for _, m := range messages {
+			fmt.Fprintf(&b, "\n[%s]", m.Role)
+			if m.Content != "" {
+				b.WriteString(" " + m.Content)
+			}
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, " (called %s %s)", tc.Function.Name, tc.Function.Arguments)
+			}
+			b.WriteString("\n")
+		}
+
+		temp := 0.2
+		resp, err := complete(ctx, &api.ChatCompletionRequest{
+			Messages: []api.Message{
+				{Role: "system", Content: summarizePrompt},
+				{Role: "user", Content: b.String()},
+			},
+			Temperature: &temp,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("model returned no choices")
+		}
+		summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+		if summary == "" {
+			return "", fmt.Errorf("model returned an empty summary")
+		}
+		return summary, nil
+	}
+}
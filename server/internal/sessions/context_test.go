@@ -0,0 +1,140 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+	"github.com/google/uuid"
+)
+
+// turn returns a user message and a reply of about 30 tokens each.
+func turn(n string) []api.Message {
+	return []api.Message{
+		{Role: "user", Content: "question " + n + strings.Repeat(" padding", 12)},
+		{Role: "assistant", Content: "answer " + n + strings.Repeat(" padding", 12)},
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var msgs []api.Message
+	for _, n := range []string{"1", "2", "3"} {
+		msgs = append(msgs, turn(n)...)
+	}
+	msgs = append(msgs,
+		api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "file_read", Arguments: `{"path":"a.go"}`}}}},
+		api.Message{Role: "tool", Content: strings.Repeat("x", 60)},
+	)
+	sess := &api.Session{Messages: msgs, Summary: "earlier", Summarized: 2}
+
+	all := Window(sess, 0)
+	if len(all) != 7 || all[0].Role != "system" || !strings.HasSuffix(all[0].Content, "earlier") || all[1].Content != msgs[2].Content {
+		t.Fatalf("unlimited window = %+v", all)
+	}
+
+	// Room for the summary, the tool exchange and one more message: the
+	// window starts after the summary at the latest messages that fit.
+	budget := EstimateTokens(all[:1]) + EstimateTokens(msgs[5:])
+	got := Window(sess, budget)
+	if len(got) != 4 || got[1].Content != msgs[5].Content {
+		t.Errorf("window = %+v", got)
+	}
+
+	// Too little room for the call leaves out its result too.
+	got = Window(sess, EstimateTokens(all[:1])+EstimateTokens(msgs[7:]))
+	if len(got) != 1 {
+		t.Errorf("window split a tool exchange: %+v", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.Create(api.Session{Settings: api.SessionSettings{ContextTokens: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls [][]api.Message
+	summarize := func(ctx context.Context, previous string, msgs []api.Message) (string, error) {
+		calls = append(calls, msgs)
+		return previous + "+" + msgs[0].Content[:10], nil
+	}
+	appendTurn := func(n string) *api.Session {
+		t.Helper()
+		if _, err := store.Update(sess.ID, func(s *api.Session) error {
+			s.Messages = append(s.Messages, turn(n)...)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Compact(context.Background(), sess.ID, summarize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := appendTurn("1"); got.Summarized != 0 || len(calls) != 0 {
+		t.Fatalf("summarized a session within its budget: %+v", got)
+	}
+	got := appendTurn("2")
+	if len(calls) != 1 || got.Summarized == 0 || got.Summary != "+question 1" {
+		t.Fatalf("after going over: summarized %d, summary %q, %d calls", got.Summarized, got.Summary, len(calls))
+	}
+	if tokens := EstimateTokens(got.Messages[got.Summarized:]); tokens > 50 {
+		t.Errorf("%d tokens left unsummarized, want at most half the budget", tokens)
+	}
+	if stored, _ := store.Get(sess.ID); stored.Summarized != got.Summarized || stored.Summary != got.Summary {
+		t.Errorf("stored session = %+v", stored)
+	}
+
+	appendTurn("3")
+	if len(calls) != 2 || calls[1][0].Content != got.Messages[got.Summarized].Content {
+		t.Errorf("second summary was given %+v", calls[1])
+	}
+
+	failing := func(context.Context, string, []api.Message) (string, error) { return "", errors.New("gpu down") }
+	store.Update(sess.ID, func(s *api.Session) error {
+		s.Messages = append(s.Messages, turn("4")...)
+		s.Messages = append(s.Messages, turn("5")...)
+		return nil
+	})
+	before, _ := store.Get(sess.ID)
+	after, err := store.Compact(context.Background(), sess.ID, failing)
+	if err == nil || after == nil || after.Summarized != before.Summarized {
+		t.Errorf("failed summary: session %+v, err %v", after, err)
+	}
+}
+
+func TestSettingsCachesMisses(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := uuid.New().String()
+	if _, ok := store.Settings(missing); ok {
+		t.Fatal("found a session that does not exist")
+	}
+	if settings, ok := store.settings[missing]; !ok || settings != nil {
+		t.Errorf("miss was not cached: %v %v", settings, ok)
+	}
+
+	sess, err := store.Create(api.Session{Settings: api.SessionSettings{MemoryScope: api.MemoryScopeSession}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings, ok := store.Settings(sess.ID); !ok || settings.MemoryScope != api.MemoryScopeSession {
+		t.Errorf("settings = %+v, %v", settings, ok)
+	}
+	if err := store.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Settings(sess.ID); ok {
+		t.Error("deleted session still has settings")
+	}
+}
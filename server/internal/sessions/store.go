@@ -0,0 +1,256 @@
+// Package sessions stores chat sessions on disk, one JSON file per session,
+// so clients can share a conversation through the backend.
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned for a session ID that is not in the store.
+var ErrNotFound = errors.New("session not found")
+
+// Store is a directory of sessions. It is safe for concurrent use.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+	// settings caches each session's Settings, which are read for every
+	// request that names the session in api.SessionHeader. A nil entry
+	// records that there is no such session, since most of those IDs are
+	// clients' own conversations that are never stored.
+	settings map[string]*api.SessionSettings
+}
+
+// NewStore opens the store in dir, creating the directory if needed.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create sessions dir: %w", err)
+	}
+	return &Store{dir: dir, settings: make(map[string]*api.SessionSettings)}, nil
+}
+
+// Create stores sess under a new ID and returns it with the ID and
+// timestamps filled in.
+func (s *Store) Create(sess api.Session) (*api.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	sess.ID = uuid.New().String()
+	sess.CreatedAt = now
+	sess.UpdatedAt = now
+	if sess.Messages == nil {
+		sess.Messages = []api.Message{}
+	}
+	if err := s.save(&sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Get returns the session with the given ID.
+func (s *Store) Get(id string) (*api.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+// Settings returns the settings of the session with the given ID, and
+// false if there is no such session. Unknown IDs are remembered too, so a
+// session file copied into the directory by hand is only seen after a
+// restart.
+func (s *Store) Settings(id string) (api.SessionSettings, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings, ok := s.settings[id]; ok {
+		if settings == nil {
+			return api.SessionSettings{}, false
+		}
+		return *settings, true
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return api.SessionSettings{}, false // never stored, and not worth caching
+	}
+	sess, err := s.load(id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			s.settings[id] = nil
+		}
+		return api.SessionSettings{}, false
+	}
+	s.settings[id] = &sess.Settings
+	return sess.Settings, true
+}
+
+// List returns every session without its messages, most recently updated
+// first.
+func (s *Store) List() ([]api.SessionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := []api.SessionInfo{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		sess, err := s.load(id)
+		if err != nil {
+			continue // skip unreadable or foreign files
+		}
+		infos = append(infos, api.SessionInfo{
+			ID:           sess.ID,
+			Title:        sess.Title,
+			Model:        sess.Model,
+			MessageCount: len(sess.Messages),
+			CreatedAt:    sess.CreatedAt,
+			UpdatedAt:    sess.UpdatedAt,
+		})
+	}
+	slices.SortFunc(infos, func(a, b api.SessionInfo) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	return infos, nil
+}
+
+// Update loads the session, applies fn and saves the result. If fn returns
+// an error nothing is saved and the error is returned as is.
+func (s *Store) Update(id string, fn func(*api.Session) error) (*api.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(sess); err != nil {
+		return nil, err
+	}
+	sess.UpdatedAt = time.Now().UTC()
+	if err := s.save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Compact folds the oldest messages of session id into its summary when
+// the unsummarized ones pass its Settings.ContextTokens, and returns the
+// session. The store is not locked while summarize runs; if another
+// request summarizes the session first, this result is dropped. A failed
+// summary is returned as an error along with the unchanged session.
+func (s *Store) Compact(ctx context.Context, id string, summarize SummarizeFunc) (*api.Session, error) {
+	sess, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := summarizeCutoff(sess, sess.Settings.ContextTokens)
+	if cutoff <= sess.Summarized {
+		return sess, nil
+	}
+	summary, err := summarize(ctx, sess.Summary, sess.Messages[sess.Summarized:cutoff])
+	if err != nil {
+		return sess, fmt.Errorf("summarize session %s: %w", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Summarized != sess.Summarized || latest.Summary != sess.Summary {
+		return latest, nil
+	}
+	latest.Summary = summary
+	latest.Summarized = cutoff
+	latest.UpdatedAt = time.Now().UTC()
+	if err := s.save(latest); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// Delete removes the session with the given ID.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	s.settings[id] = nil
+	return nil
+}
+
+// path returns the file for id. IDs are UUIDs, which also keeps a
+// client-supplied ID from escaping the directory.
+func (s *Store) path(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *Store) load(id string) (*api.Session, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var sess api.Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("read session %s: %w", id, err)
+	}
+	return &sess, nil
+}
+
+// save writes sess to a temporary file and renames it into place, so a
+// crash never leaves a half-written session behind.
+func (s *Store) save(sess *api.Session) error {
+	path, err := s.path(sess.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write session: %w", err)
+	}
+	settings := sess.Settings
+	s.settings[sess.ID] = &settings
+	return nil
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath resolves path, relative or absolute, against the server's
+// working directory and returns it relative to that directory. Paths that
+// leave it, directly, through "..", or through a symlink, are refused: the
+// agent endpoint has no authentication, so its tools must not become a way
+// to read the rest of the machine.
+func resolvePath(path string) (string, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(root, abs)
+	}
+	abs = filepath.Clean(abs)
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", path)
+	}
+	return rel, nil
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolsStayInWorkingDirectory(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	secret := filepath.Join(base, "secret")
+	os.Mkdir(root, 0755)
+	os.Mkdir(secret, 0755)
+	os.WriteFile(filepath.Join(secret, "key"), []byte("TOKEN=hunter2\n"), 0644)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("TOKEN=fine\n"), 0644)
+	os.Symlink(filepath.Join(secret, "key"), filepath.Join(root, "key-link"))
+	os.Symlink(secret, filepath.Join(root, "secret-link"))
+	t.Chdir(root)
+
+	run := func(tool Tool, args map[string]any) *ToolResult {
+		t.Helper()
+		raw, _ := json.Marshal(args)
+		result, err := tool.Execute(context.Background(), string(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	outside := []string{"../secret/key", filepath.Join(secret, "key"), "key-link", "secret-link/key", "/etc/passwd"}
+	for _, path := range outside {
+		if result := run(&FileReadTool{}, map[string]any{"path": path}); !result.IsError || strings.Contains(result.Output, "hunter2") {
+			t.Errorf("file_read %s = %+v", path, result)
+		}
+	}
+	for _, path := range []string{"..", "../secret", secret, "secret-link", "/"} {
+		if result := run(&ListDirTool{}, map[string]any{"path": path}); !result.IsError {
+			t.Errorf("list_dir %s = %+v", path, result)
+		}
+		if result := run(&FindFilesTool{}, map[string]any{"pattern": "*", "path": path}); !result.IsError {
+			t.Errorf("find_files %s = %+v", path, result)
+		}
+		if result := run(&GrepSearchTool{}, map[string]any{"pattern": "TOKEN", "path": path}); !result.IsError {
+			t.Errorf("grep_search %s = %+v", path, result)
+		}
+	}
+
+	// Inside the directory the tools work, by relative or absolute path,
+	// and a search does not follow symlinks out of it.
+	if result := run(&FileReadTool{}, map[string]any{"path": filepath.Join(root, "notes.txt")}); result.IsError || result.Output != "TOKEN=fine\n" {
+		t.Errorf("file_read inside = %+v", result)
+	}
+	grep := run(&GrepSearchTool{}, map[string]any{"pattern": "TOKEN"})
+	if grep.IsError || !strings.Contains(grep.Output, "fine") || strings.Contains(grep.Output, "hunter2") {
+		t.Errorf("grep_search . = %+v", grep)
+	}
+	if list := run(&ListDirTool{}, map[string]any{"path": "."}); list.IsError || strings.Contains(list.Output, "secret-link/key") {
+		t.Errorf("list_dir . = %+v", list)
+	}
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const maxFileReadBytes = 32 * 1024 // 32KB
+
+// FileReadTool reads file contents.
+type FileReadTool struct{}
+
+type fileReadArgs struct {
+	Path string `json:"path"`
+}
+
+func (t *FileReadTool) Name() string { return "file_read" }
+
+func (t *FileReadTool) Description() string {
+	return "Read the contents of a file at the given path. Returns the file content as text. Paths are relative to the working directory, and files outside it cannot be read."
+}
+
+func (t *FileReadTool) Parameters() json.RawMessage {
+	return Schema{
+		Type: "object",
+		Properties: map[string]SchemaProperty{
+			"path": {Type: "string", Description: "Path to the file, relative to the working directory"},
+		},
+		Required: []string{"path"},
+	}.MustMarshal()
+}
+
+func (t *FileReadTool) Execute(_ context.Context, arguments string) (*ToolResult, error) {
+	var args fileReadArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+	}
+	if args.Path == "" {
+		return ErrorResult("path is required"), nil
+	}
+
+	path, err := resolvePath(args.Path)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err)), nil
+	}
+
+	output := string(data)
+	if len(data) > maxFileReadBytes {
+		output = string(data[:maxFileReadBytes]) + fmt.Sprintf("\n\n[truncated: file is %d bytes, showing first %d]", len(data), maxFileReadBytes)
+	}
+
+	return &ToolResult{Output: output}, nil
+}
@@ -0,0 +1,172 @@
+// Package tools holds the tools the backend's agent runs may call. They
+// are the read-only file tools only (file_read, list_dir, grep_search and
+// find_files): any client that can reach the backend can start a run, and
+// the server has none of the CLI's shell policy, confinement or approval
+// prompts, so tools that write files, run commands or reach the network
+// would hand every API client those powers on the backend host. The CLI's
+// fuller tool set lives in its own module, which the backend does not
+// import, since the modules share no code and speak only JSON over HTTP.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+// Tool is the interface that all built-in tools implement.
+type Tool interface {
+	Name() string
+	Description() string
+	Parameters() json.RawMessage
+	Execute(ctx context.Context, arguments string) (*ToolResult, error)
+}
+
+// DefaultToolTimeout bounds a single tool call in DefaultRegistry.
+const DefaultToolTimeout = 60 * time.Second
+
+// Registry holds a set of tools keyed by name.
+type Registry struct {
+	tools    map[string]Tool
+	order    []string
+	timeout  time.Duration            // applies to tools without an override; 0 = none
+	timeouts map[string]time.Duration // per-tool overrides
+}
+
+// NewRegistry creates an empty Registry with no timeouts.
+func NewRegistry() *Registry {
+	return &Registry{
+		tools:    make(map[string]Tool),
+		timeouts: make(map[string]time.Duration),
+	}
+}
+
+// SetTimeout sets the default timeout for every tool call. 0 disables it.
+func (r *Registry) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// SetToolTimeout overrides the timeout for a single tool. 0 disables it for
+// that tool even when a default is set.
+func (r *Registry) SetToolTimeout(name string, d time.Duration) {
+	r.timeouts[name] = d
+}
+
+// Timeout returns the effective timeout for the named tool.
+func (r *Registry) Timeout(name string) time.Duration {
+	if d, ok := r.timeouts[name]; ok {
+		return d
+	}
+	return r.timeout
+}
+
+// Execute runs the named tool under the given timeout (0 = none).
+//
+// It returns as soon as ctx is cancelled, even if the tool is blocked in a
+// call that ignores ctx; the tool's goroutine then finishes in the
+// background and its result is discarded. Cancellation is reported as a Go
+// error, a timeout as an error result the model can react to.
+func (r *Registry) Execute(ctx context.Context, name, arguments string, timeout time.Duration) (*ToolResult, error) {
+	tool := r.tools[name]
+	if tool == nil {
+		return ErrorResult(fmt.Sprintf("unknown tool: %s", name)), nil
+	}
+
+	callCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result *ToolResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := tool.Execute(callCtx, arguments)
+		done <- outcome{res, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+			return ErrorResult(fmt.Sprintf("%s timed out after %s", name, timeout)), nil
+		}
+		return out.result, out.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return ErrorResult(fmt.Sprintf("%s timed out after %s", name, timeout)), nil
+	}
+}
+
+// Register adds a tool to the registry. Panics on duplicate names.
+func (r *Registry) Register(t Tool) {
+	name := t.Name()
+	if _, exists := r.tools[name]; exists {
+		panic(fmt.Sprintf("tools: duplicate tool name %q", name))
+	}
+	r.tools[name] = t
+	r.order = append(r.order, name)
+}
+
+// Get looks up a tool by name. Returns nil if not found.
+func (r *Registry) Get(name string) Tool {
+	return r.tools[name]
+}
+
+// Subset returns a new registry holding only the named tools that are
+// registered here, in this registry's order, with the same timeouts.
+func (r *Registry) Subset(names ...string) *Registry {
+	keep := make(map[string]bool, len(names))
+	for _, n := range names {
+		keep[n] = true
+	}
+
+	sub := NewRegistry()
+	sub.timeout = r.timeout
+	for _, name := range r.order {
+		if keep[name] {
+			sub.Register(r.tools[name])
+			if d, ok := r.timeouts[name]; ok {
+				sub.timeouts[name] = d
+			}
+		}
+	}
+	return sub
+}
+
+// APITools returns the tools in OpenAI API format for inclusion in requests.
+func (r *Registry) APITools() []api.Tool {
+	out := make([]api.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		t := r.tools[name]
+		out = append(out, api.Tool{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+	return out
+}
+
+// DefaultRegistry returns a registry pre-loaded with all built-in tools.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(&FileReadTool{})
+	r.Register(&ListDirTool{})
+	r.Register(&FindFilesTool{})
+	r.Register(&GrepSearchTool{})
+
+	r.SetTimeout(DefaultToolTimeout)
+	return r
+}
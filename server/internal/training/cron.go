@@ -0,0 +1,238 @@
+// Package training starts fine-tunes on the GPU server on a schedule,
+// building their datasets from memory.
+package training
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when scheduled fine-tunes are due.
+type Schedule interface {
+	// Next returns the first time the schedule fires after t.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a cron expression of five fields (minute, hour,
+// day of month, month, day of week), e.g. "0 3 * * *" for 03:00 every
+// day; one of @hourly, @daily, @weekly and @monthly; or an interval such
+// as "24h". Cron times are local.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval %s is shorter than a minute", d)
+		}
+		return every(d), nil
+	}
+	return parseCron(spec)
+}
+
+// every fires a fixed interval after the time it is asked about.
+type every time.Duration
+
+func (d every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+func (d every) String() string {
+	return "every " + time.Duration(d).String()
+}
+
+// cron fires at the minutes whose fields are all set in its bit sets.
+type cron struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	// With both days restricted, a day matching either fires, as in
+	// Vixie cron.
+	domAny, dowAny bool
+}
+
+// cronField is the range of a cron field and the names it accepts.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] stands for min+i
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+func parseCron(spec string) (*cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want an interval or a cron expression of 5 fields", spec)
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := cronFields[i].parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cron{
+		spec:   spec,
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parse parses a comma-separated list of "*", values and ranges, each
+// optionally with a "/step", into a bit set of the values.
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepStr, f.name)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loStr); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiStr); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q in %s field", rng, f.name)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a number or name of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q: want %d-%d", f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Next returns the first whole minute after t the expression matches, or
+// the zero time if none does in the next five years, as with "0 0 30 2 *".
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *cron) String() string {
+	return c.spec
+}
+
+// QuietHours is a daily window, in local time, in which scheduled
+// fine-tunes do not start. It may span midnight.
+type QuietHours struct {
+	start, end int // minutes since midnight
+	spec       string
+}
+
+// ParseQuietHours parses a window written "HH:MM-HH:MM", e.g.
+// "09:00-18:00" or "22:00-07:00".
+func ParseQuietHours(spec string) (*QuietHours, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q: want HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid quiet hours %q: window is empty", spec)
+	}
+	return &QuietHours{start: start, end: end, spec: strings.TrimSpace(spec)}, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls in the window.
+func (q *QuietHours) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+func (q *QuietHours) String() string {
+	return q.spec
+}
@@ -0,0 +1,205 @@
+package training
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/gpuclient"
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+	"github.com/ThatCatDev/tanrenai/server/internal/memory"
+	"github.com/ThatCatDev/tanrenai/server/pkg/api"
+)
+
+var logger = logging.For("finetune")
+
+// StateFile, in the memory directory, records the last scheduled run.
+const StateFile = "finetune-schedule.json"
+
+// retryInterval is how often a due run that had to wait, for quiet hours
+// to end or the GPU to be free, is tried again.
+const retryInterval = time.Minute
+
+// ScheduleConfig says when Scheduler starts fine-tunes and on what.
+type ScheduleConfig struct {
+	Schedule  Schedule
+	BaseModel string
+	// MinNewSamples is how many memories must have been added since the
+	// last scheduled run for the next one to start.
+	MinNewSamples int
+	Quiet         *QuietHours // nil has no quiet hours
+	Filter        memory.DatasetFilter
+}
+
+// BusyFunc reports why the GPU should not train now, such as chats in
+// progress, or "" when it is free.
+type BusyFunc func(ctx context.Context) string
+
+// Scheduler starts fine-tunes of the memories on a schedule. A due run
+// waits out quiet hours and interactive use of the GPU, and is skipped
+// when too few new memories have been added since the last one.
+type Scheduler struct {
+	cfg      ScheduleConfig
+	gpu      *gpuclient.Client
+	memStore memory.Store
+	busy     BusyFunc
+	path     string
+	state    scheduleState
+}
+
+// scheduleState is what StateFile holds.
+type scheduleState struct {
+	LastRunAt time.Time `json:"last_run_at,omitzero"`
+	LastRunID string    `json:"last_run_id,omitempty"`
+}
+
+// NewScheduler returns a Scheduler that keeps its state in memoryDir.
+// busy may be nil.
+func NewScheduler(cfg ScheduleConfig, gpu *gpuclient.Client, memStore memory.Store, memoryDir string, busy BusyFunc) *Scheduler {
+	s := &Scheduler{
+		cfg:      cfg,
+		gpu:      gpu,
+		memStore: memStore,
+		busy:     busy,
+		path:     filepath.Join(memoryDir, StateFile),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			logger.Warn("ignoring unreadable schedule state", "path", s.path, "err", err)
+		}
+	}
+	return s
+}
+
+// Run starts fine-tunes as they fall due until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	next := s.cfg.Schedule.Next(time.Now())
+	due := false
+	for {
+		if next.IsZero() && !due {
+			logger.Warn("schedule never fires again", "schedule", s.cfg.Schedule)
+			return
+		}
+		wait := time.Until(next)
+		if due && (next.IsZero() || wait > retryInterval) {
+			wait = retryInterval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		if !next.IsZero() && !now.Before(next) {
+			due = true
+			next = s.cfg.Schedule.Next(now)
+		}
+		if due {
+			due = s.tick(ctx, now)
+		}
+	}
+}
+
+// tick starts a run if one may start now, reporting whether it should be
+// tried again shortly.
+func (s *Scheduler) tick(ctx context.Context, now time.Time) (retry bool) {
+	if s.cfg.Quiet != nil && s.cfg.Quiet.Contains(now) {
+		logger.Debug("scheduled fine-tune waits for quiet hours to end", "quiet_hours", s.cfg.Quiet)
+		return true
+	}
+	if s.busy != nil {
+		if reason := s.busy(ctx); reason != "" {
+			logger.Debug("scheduled fine-tune waits", "reason", reason)
+			return true
+		}
+	}
+	if running, err := s.training(ctx); err != nil {
+		logger.Debug("scheduled fine-tune waits for the GPU server", "err", err)
+		return true
+	} else if running != "" {
+		logger.Debug("scheduled fine-tune waits for a run in progress", "run_id", running)
+		return true
+	}
+
+	run, err := s.start(ctx)
+	if err != nil {
+		logger.Error("scheduled fine-tune failed", "err", err)
+		return false
+	}
+	if run != nil {
+		logger.Info("scheduled fine-tune started", "run_id", run.ID, "base_model", run.BaseModel)
+	}
+	return false
+}
+
+// training returns the ID of a GPU server run that is training, or ""
+// when none is.
+func (s *Scheduler) training(ctx context.Context) (string, error) {
+	runs, err := s.gpu.FinetuneRuns(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, run := range runs {
+		if run.Status == api.FinetuneTraining {
+			return run.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// start prepares a run on the memories the filter keeps and trains it,
+// or returns nil when fewer than MinNewSamples of them are new.
+func (s *Scheduler) start(ctx context.Context) (*api.FinetuneRun, error) {
+	entries, err := s.memStore.List(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list memories: %w", err)
+	}
+	kept, _ := memory.FilterDataset(entries, s.cfg.Filter)
+	fresh := 0
+	for _, e := range kept {
+		if e.Timestamp.After(s.state.LastRunAt) {
+			fresh++
+		}
+	}
+	if fresh == 0 || fresh < s.cfg.MinNewSamples {
+		logger.Info("scheduled fine-tune skipped: too few new memories", "new", fresh, "min", s.cfg.MinNewSamples)
+		return nil, nil
+	}
+
+	samples := memory.ChatSamples(kept)
+	run, err := s.gpu.FinetunePrepare(ctx, &api.FinetunePrepareRequest{
+		BaseModel:   s.cfg.BaseModel,
+		SampleCount: len(samples),
+		Dataset:     samples,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("prepare: %w", err)
+	}
+	if err := s.gpu.FinetuneTrain(ctx, run.ID); err != nil {
+		return nil, fmt.Errorf("train run %s: %w", run.ID, err)
+	}
+
+	s.state = scheduleState{LastRunAt: kept[0].Timestamp, LastRunID: run.ID}
+	if err := s.save(); err != nil {
+		logger.Warn("saving schedule state failed", "path", s.path, "err", err)
+	}
+	return run, nil
+}
+
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,377 @@
+// Package tunnel forwards a local port to the GPU host over SSH, as
+// "ssh -L" does, keeping the connection alive and reconnecting when it
+// drops.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ThatCatDev/tanrenai/server/internal/logging"
+)
+
+var logger = logging.For("tunnel")
+
+const (
+	dialTimeout = 15 * time.Second
+	// keepaliveInterval is how often a connection is checked; one that
+	// does not answer within keepaliveTimeout is dropped.
+	keepaliveInterval = 30 * time.Second
+	keepaliveTimeout  = 15 * time.Second
+	// reconnectFor is how long a dropped connection is redialled in the
+	// background; after that the next forwarded connection dials.
+	reconnectFor = 2 * time.Minute
+)
+
+// Endpoint is an SSH server to log in to.
+type Endpoint struct {
+	User string
+	Addr string // host:port
+}
+
+func (e Endpoint) String() string {
+	return e.User + "@" + e.Addr
+}
+
+// ResolveFunc returns the SSH server to connect to. It is called on every
+// connect, so an instance whose address changes across restarts is found.
+type ResolveFunc func(ctx context.Context) (Endpoint, error)
+
+// Static returns a ResolveFunc for a fixed endpoint.
+func Static(e Endpoint) ResolveFunc {
+	return func(context.Context) (Endpoint, error) { return e, nil }
+}
+
+// ParseEndpoint parses "[user@]host[:port]"; the user defaults to
+// defaultUser and the port to 22.
+func ParseEndpoint(s, defaultUser string) (Endpoint, error) {
+	e := Endpoint{User: defaultUser}
+	host := s
+	if at := strings.LastIndexByte(host, '@'); at >= 0 {
+		e.User, host = host[:at], host[at+1:]
+	}
+	if host == "" || e.User == "" {
+		return Endpoint{}, fmt.Errorf("invalid SSH address %q: want [user@]host[:port]", s)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	e.Addr = host
+	return e, nil
+}
+
+// Config configures a Tunnel.
+type Config struct {
+	Resolve    ResolveFunc
+	LocalAddr  string // where to listen, e.g. "127.0.0.1:11435"
+	RemoteAddr string // where the SSH server connects to, e.g. "localhost:11435"
+	// KeyFile is the private key to log in with; "" uses the SSH agent
+	// and the default keys in ~/.ssh. Encrypted keys need the agent.
+	KeyFile string
+	// KnownHosts is the known_hosts file host keys are checked against;
+	// "" uses ~/.ssh/known_hosts. InsecureHostKey skips the check, for
+	// marketplace instances whose keys change with every rental.
+	KnownHosts      string
+	InsecureHostKey bool
+}
+
+// Status is the tunnel's state, as GET /api/instance/status reports it.
+type Status struct {
+	Endpoint  string     `json:"endpoint,omitempty"` // user@host:port of the last connect
+	Local     string     `json:"local"`
+	Remote    string     `json:"remote"`
+	Connected bool       `json:"connected"`
+	Since     *time.Time `json:"since,omitempty"`      // when it connected
+	LastError string     `json:"last_error,omitempty"` // why the last connect failed or the connection dropped
+}
+
+// Tunnel forwards connections to LocalAddr to RemoteAddr through an SSH
+// connection it dials on first use and redials when it drops.
+type Tunnel struct {
+	cfg     Config
+	auth    []ssh.AuthMethod
+	hostKey ssh.HostKeyCallback
+	ctx     context.Context // Listen's; done when the tunnel shuts down
+	// agentConn is the SSH agent connection, kept open for the tunnel's
+	// lifetime because the agent's signers sign over it.
+	agentConn net.Conn
+
+	mu       sync.Mutex
+	client   *ssh.Client
+	endpoint Endpoint
+	since    time.Time
+	lastErr  error
+}
+
+// New checks cfg and loads the keys and known hosts.
+func New(cfg Config) (*Tunnel, error) {
+	if cfg.Resolve == nil || cfg.LocalAddr == "" || cfg.RemoteAddr == "" {
+		return nil, errors.New("tunnel needs an SSH server, a local and a remote address")
+	}
+	t := &Tunnel{cfg: cfg}
+	home, _ := os.UserHomeDir()
+
+	if cfg.InsecureHostKey {
+		t.hostKey = ssh.InsecureIgnoreHostKey()
+	} else {
+		path := cfg.KnownHosts
+		if path == "" {
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		cb, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("known hosts: %w", err)
+		}
+		t.hostKey = cb
+	}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" && cfg.KeyFile == "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			logger.Warn("SSH agent unavailable", "socket", sock, "err", err)
+		} else {
+			t.agentConn = conn
+			t.auth = append(t.auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	keyFiles := []string{cfg.KeyFile}
+	if cfg.KeyFile == "" {
+		keyFiles = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	var signers []ssh.Signer
+	for _, path := range keyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if cfg.KeyFile != "" {
+				return nil, fmt.Errorf("read key: %w", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			if cfg.KeyFile != "" {
+				return nil, fmt.Errorf("parse key %s: %w", path, err)
+			}
+			logger.Debug("skipping SSH key", "path", path, "err", err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		t.auth = append(t.auth, ssh.PublicKeys(signers...))
+	}
+	if len(t.auth) == 0 {
+		return nil, errors.New("no SSH key: set a key file or run an SSH agent")
+	}
+	return t, nil
+}
+
+// closeAgent closes the SSH agent connection, if there is one.
+func (t *Tunnel) closeAgent() {
+	if t.agentConn != nil {
+		t.agentConn.Close()
+	}
+}
+
+// Listen starts listening on LocalAddr, returning once it does, and
+// forwards connections until ctx is cancelled.
+func (t *Tunnel) Listen(ctx context.Context) error {
+	ln, err := net.Listen("tcp", t.cfg.LocalAddr)
+	if err != nil {
+		t.closeAgent()
+		return fmt.Errorf("tunnel: %w", err)
+	}
+	t.ctx = ctx
+	logger.Info("tunnel listening", "local", t.cfg.LocalAddr, "remote", t.cfg.RemoteAddr)
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		t.mu.Lock()
+		if t.client != nil {
+			t.client.Close()
+		}
+		t.mu.Unlock()
+		t.closeAgent()
+	}()
+	go t.keepalive(ctx)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("tunnel stopped accepting", "err", err)
+				}
+				return
+			}
+			go t.forward(ctx, conn)
+		}
+	}()
+	return nil
+}
+
+// Status reports whether the tunnel is connected.
+func (t *Tunnel) Status() *Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &Status{Local: t.cfg.LocalAddr, Remote: t.cfg.RemoteAddr, Connected: t.client != nil}
+	if t.endpoint.Addr != "" {
+		s.Endpoint = t.endpoint.String()
+	}
+	if t.client != nil {
+		since := t.since
+		s.Since = &since
+	}
+	if t.lastErr != nil {
+		s.LastError = t.lastErr.Error()
+	}
+	return s
+}
+
+func (t *Tunnel) forward(ctx context.Context, local net.Conn) {
+	defer local.Close()
+	client, err := t.connect(ctx)
+	if err != nil {
+		logger.Debug("tunnel connect failed", "err", err)
+		return
+	}
+	remote, err := client.Dial("tcp", t.cfg.RemoteAddr)
+	if err != nil {
+		// The server refusing the channel, e.g. because nothing listens on
+		// RemoteAddr yet, leaves the connection usable.
+		var chanErr *ssh.OpenChannelError
+		if !errors.As(err, &chanErr) {
+			client.Close()
+		}
+		logger.Debug("tunnel dial failed", "remote", t.cfg.RemoteAddr, "err", err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(remote, local); done <- struct{}{} }()
+	go func() { io.Copy(local, remote); done <- struct{}{} }()
+	<-done
+}
+
+// connect returns the SSH connection, dialling it if there is none.
+func (t *Tunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	endpoint, err := t.cfg.Resolve(ctx)
+	if err != nil {
+		t.lastErr = fmt.Errorf("resolve SSH server: %w", err)
+		return nil, t.lastErr
+	}
+	t.endpoint = endpoint
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", endpoint.Addr)
+	if err != nil {
+		t.lastErr = err
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, endpoint.Addr, &ssh.ClientConfig{
+		User:            endpoint.User,
+		Auth:            t.auth,
+		HostKeyCallback: t.hostKey,
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		t.lastErr = err
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	t.client, t.since, t.lastErr = client, time.Now(), nil
+	logger.Info("tunnel connected", "endpoint", endpoint, "local", t.cfg.LocalAddr, "remote", t.cfg.RemoteAddr)
+	go t.watch(client, endpoint)
+	return client, nil
+}
+
+// watch waits for client to close and then redials for reconnectFor,
+// unless the tunnel is shutting down.
+func (t *Tunnel) watch(client *ssh.Client, endpoint Endpoint) {
+	err := client.Wait()
+	t.mu.Lock()
+	if t.client == client {
+		t.client = nil
+		if err != nil {
+			t.lastErr = err
+		}
+	}
+	t.mu.Unlock()
+	if t.ctx.Err() != nil {
+		return
+	}
+	logger.Warn("tunnel dropped, reconnecting", "endpoint", endpoint, "err", err)
+
+	deadline := time.Now().Add(reconnectFor)
+	for backoff := time.Second; time.Now().Before(deadline); backoff = min(2*backoff, 30*time.Second) {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if _, err := t.connect(t.ctx); err == nil {
+			return
+		}
+	}
+	logger.Warn("tunnel still down; reconnecting on the next request", "endpoint", endpoint)
+}
+
+// keepalive checks the connection every keepaliveInterval and closes it
+// when the server does not answer, which makes watch reconnect.
+func (t *Tunnel) keepalive(ctx context.Context) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		t.mu.Lock()
+		client, endpoint := t.client, t.endpoint
+		t.mu.Unlock()
+		if client == nil {
+			continue
+		}
+		answered := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			answered <- err
+		}()
+		select {
+		case err := <-answered:
+			if err == nil {
+				continue
+			}
+		case <-time.After(keepaliveTimeout):
+		}
+		logger.Debug("tunnel keepalive failed", "endpoint", endpoint)
+		client.Close()
+	}
+}
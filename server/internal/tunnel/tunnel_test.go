@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serveAgent serves keyring on a Unix socket and points SSH_AUTH_SOCK at
+// it.
+func serveAgent(t *testing.T, keyring agent.Agent) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	t.Setenv("HOME", t.TempDir()) // no key files to fall back on
+}
+
+// serveSSH accepts SSH logins by key only from authorized, and returns
+// its address.
+func serveSSH(t *testing.T, authorized ssh.PublicKey) string {
+	t.Helper()
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestAgentAuth(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	serveAgent(t, keyring)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	addr := serveSSH(t, signer.PublicKey())
+
+	tun, err := New(Config{
+		Resolve:         Static(Endpoint{User: "test", Addr: addr}),
+		LocalAddr:       "127.0.0.1:0",
+		RemoteAddr:      "localhost:1",
+		InsecureHostKey: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.closeAgent()
+	// A shut-down tunnel: dropped connections are not redialled.
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	tun.ctx = done
+
+	// Log in twice: the agent connection must outlive the first login.
+	for i := range 2 {
+		client, err := tun.connect(context.Background())
+		if err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+		client.Close()
+		tun.mu.Lock()
+		tun.client = nil
+		tun.mu.Unlock()
+	}
+}
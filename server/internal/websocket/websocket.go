@@ -0,0 +1,293 @@
+// Package websocket is a minimal server-side WebSocket (RFC 6455)
+// implementation: the handshake, text messages, ping/pong and close frames.
+// Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Close codes used by the server.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseTryAgainLater   = 1013
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// acceptGUID is appended to the client's key to form Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// ErrMessageTooBig is returned by ReadMessage for messages over the limit.
+var ErrMessageTooBig = errors.New("websocket message too big")
+
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Conn is a server-side WebSocket connection. ReadMessage must be called
+// from one goroutine at a time; the write methods are safe for concurrent
+// use.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	maxBytes int64
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// Upgrade completes the handshake for r, allowing messages up to maxBytes.
+// On failure it has already written an HTTP error response.
+func Upgrade(w http.ResponseWriter, r *http.Request, maxBytes int64) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !IsUpgrade(r) || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "expected a WebSocket version 13 upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: bad handshake")
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket upgrade not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+	// The server's deadlines do not apply once hijacked.
+	netConn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: handshake: %w", err)
+	}
+	return &Conn{conn: netConn, br: rw.Reader, maxBytes: maxBytes}, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for a client's
+// Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// automatically. A close frame from the peer is acknowledged and returned as
+// a *CloseError. Each frame must arrive within timeout (0 = no limit), so a
+// peer that stops answering pings is noticed. Frames that break the
+// protocol fail the connection with CloseProtocolError.
+func (c *Conn) ReadMessage(timeout time.Duration) ([]byte, error) {
+	var msg []byte
+	started := false // a fragmented message is in progress
+	for {
+		if timeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		fin, op, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ce := &CloseError{Code: 1005} // no status received
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			c.Close(CloseNormal, "")
+			return nil, ce
+		case opText, opBinary, opContinuation:
+			if started != (op == opContinuation) {
+				if started {
+					return nil, c.fail("new message before the last one finished")
+				}
+				return nil, c.fail("continuation frame with no message started")
+			}
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+			started = true
+		default:
+			return nil, c.fail(fmt.Sprintf("unknown opcode %#x", op))
+		}
+	}
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping; the peer's pong is consumed by ReadMessage.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with code and reason and closes the connection.
+// Calls after the first do nothing.
+func (c *Conn) Close(code int, reason string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	if len(reason) > 123 { // control frame payloads are limited to 125 bytes
+		cut := 123
+		for cut > 0 && !utf8.RuneStart(reason[cut]) {
+			cut--
+		}
+		reason = reason[:cut]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrameLocked(opClose, append(payload, reason...))
+	c.closed = true
+	return c.conn.Close()
+}
+
+// fail closes the connection with CloseProtocolError and returns the
+// matching error.
+func (c *Conn) fail(reason string) error {
+	c.Close(CloseProtocolError, reason)
+	return errors.New("websocket: " + reason)
+}
+
+// readFrame reads one frame and unmasks its payload. read is the size of
+// the message so far, counted with a data frame against the limit.
+func (c *Conn) readFrame(read int64) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	size := int64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+
+	switch {
+	case !masked:
+		// Clients must mask every frame.
+		return false, 0, nil, c.fail("frames must be masked")
+	case head[0]&0x70 != 0:
+		// No extension is negotiated to give the reserved bits a meaning.
+		return false, 0, nil, c.fail("reserved bits set")
+	case op&0x8 != 0 && (!fin || size > 125):
+		return false, 0, nil, c.fail("control frames must be whole and at most 125 bytes")
+	}
+	if c.maxBytes > 0 && op&0x8 == 0 && read+size > c.maxBytes {
+		c.Close(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.writeFrameLocked(op, payload)
+}
+
+// writeFrameLocked writes a single unfragmented, unmasked frame.
+func (c *Conn) writeFrameLocked(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey = %q", got)
+	}
+}
+
+// clientFrame encodes a frame as a client sends it, masked unless told
+// otherwise.
+func clientFrame(fin bool, op byte, payload []byte, masked bool) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// serverFrame is a frame the server wrote.
+type serverFrame struct {
+	op      byte
+	payload []byte
+}
+
+// parseServerFrames decodes the server's unmasked, unfragmented frames.
+func parseServerFrames(t *testing.T, data []byte) []serverFrame {
+	t.Helper()
+	var frames []serverFrame
+	for len(data) > 0 {
+		if len(data) < 2 || data[0]&0x80 == 0 || data[1]&0x80 != 0 {
+			t.Fatalf("bad server frame header % x", data)
+		}
+		op, size, rest := data[0]&0x0F, int(data[1]&0x7F), data[2:]
+		switch size {
+		case 126:
+			size, rest = int(binary.BigEndian.Uint16(rest)), rest[2:]
+		case 127:
+			size, rest = int(binary.BigEndian.Uint64(rest)), rest[8:]
+		}
+		frames = append(frames, serverFrame{op: op, payload: rest[:size]})
+		data = rest[size:]
+	}
+	return frames
+}
+
+// readFrom sends input to a Conn over an in-memory pipe, reads one
+// message and closes the connection. It returns the message, the frames
+// the server wrote and ReadMessage's error.
+func readFrom(t *testing.T, input []byte, maxBytes int64) ([]byte, []serverFrame, error) {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+	c := &Conn{conn: server, br: bufio.NewReader(server), maxBytes: maxBytes}
+
+	go client.Write(input)
+	written := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(client)
+		written <- out
+	}()
+
+	msg, err := c.ReadMessage(time.Second)
+	c.Close(CloseNormal, "")
+	return msg, parseServerFrames(t, <-written), err
+}
+
+func closeCode(frames []serverFrame) int {
+	for _, f := range frames {
+		if f.op == opClose && len(f.payload) >= 2 {
+			return int(binary.BigEndian.Uint16(f.payload))
+		}
+	}
+	return 0
+}
+
+func TestReadMessage(t *testing.T) {
+	concat := func(frames ...[]byte) []byte { return bytes.Join(frames, nil) }
+	medium := bytes.Repeat([]byte("m"), 300)
+	large := bytes.Repeat([]byte("l"), 70000)
+
+	tests := []struct {
+		name      string
+		input     []byte
+		maxBytes  int64
+		want      []byte
+		wantErr   error // matched with errors.Is; nil = any error when wantClose != CloseNormal
+		wantClose int
+	}{
+		{
+			name:      "masked text",
+			input:     clientFrame(true, opText, []byte("hello"), true),
+			want:      []byte("hello"),
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "16-bit length",
+			input:     clientFrame(true, opBinary, medium, true),
+			want:      medium,
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "64-bit length",
+			input:     clientFrame(true, opText, large, true),
+			want:      large,
+			wantClose: CloseNormal,
+		},
+		{
+			name: "fragmented with a ping between",
+			input: concat(
+				clientFrame(false, opText, []byte("hel"), true),
+				clientFrame(true, opPing, []byte("p"), true),
+				clientFrame(false, opContinuation, []byte("lo "), true),
+				clientFrame(true, opContinuation, []byte("world"), true),
+			),
+			want:      []byte("hello world"),
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "unmasked",
+			input:     clientFrame(true, opText, []byte("hello"), false),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "over the size limit",
+			input:     clientFrame(true, opText, bytes.Repeat([]byte("x"), 20), true),
+			maxBytes:  10,
+			wantErr:   ErrMessageTooBig,
+			wantClose: CloseMessageTooBig,
+		},
+		{
+			name: "over the size limit across fragments",
+			input: concat(
+				clientFrame(false, opText, bytes.Repeat([]byte("x"), 8), true),
+				clientFrame(true, opContinuation, bytes.Repeat([]byte("x"), 8), true),
+			),
+			maxBytes:  10,
+			wantErr:   ErrMessageTooBig,
+			wantClose: CloseMessageTooBig,
+		},
+		{
+			name:      "control frame over 125 bytes",
+			input:     clientFrame(true, opPing, bytes.Repeat([]byte("p"), 126), true),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "fragmented control frame",
+			input:     clientFrame(false, opPing, []byte("p"), true),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "continuation with no message started",
+			input:     clientFrame(true, opContinuation, []byte("x"), true),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name: "new message inside a fragmented one",
+			input: concat(
+				clientFrame(false, opText, []byte("a"), true),
+				clientFrame(true, opText, []byte("b"), true),
+			),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			input:     append([]byte{0x80 | 0x40 | opText}, clientFrame(true, opText, []byte("x"), true)[1:]...),
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			input:     clientFrame(true, 0x3, []byte("x"), true),
+			wantClose: CloseProtocolError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, frames, err := readFrom(t, tt.input, tt.maxBytes)
+			switch {
+			case tt.wantClose == CloseNormal && err != nil:
+				t.Fatalf("ReadMessage: %v", err)
+			case tt.wantClose != CloseNormal && err == nil:
+				t.Fatalf("ReadMessage returned %q, want an error", msg)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(msg, tt.want) {
+				t.Errorf("message = %.40q (%d bytes), want %.40q (%d bytes)", msg, len(msg), tt.want, len(tt.want))
+			}
+			if got := closeCode(frames); got != tt.wantClose {
+				t.Errorf("close code = %d, want %d", got, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestPingIsAnswered(t *testing.T) {
+	input := append(clientFrame(true, opPing, []byte("are you there"), true), clientFrame(true, opText, []byte("x"), true)...)
+	_, frames, err := readFrom(t, input, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) == 0 || frames[0].op != opPong || string(frames[0].payload) != "are you there" {
+		t.Errorf("frames = %+v, want a pong echoing the ping first", frames)
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	payload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+	_, frames, err := readFrom(t, clientFrame(true, opClose, append(payload, "bye"...), true), 0)
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != CloseGoingAway || ce.Reason != "bye" {
+		t.Fatalf("err = %v, want CloseError 1001 bye", err)
+	}
+	// The server acknowledges with a close frame of its own, and only one.
+	closes := 0
+	for _, f := range frames {
+		if f.op == opClose {
+			closes++
+		}
+	}
+	if closes != 1 || closeCode(frames) != CloseNormal {
+		t.Errorf("frames = %+v, want one close frame with 1000", frames)
+	}
+}
+
+func TestCloseReasonIsCutAtRuneBoundary(t *testing.T) {
+	server, client := net.Pipe()
+	c := &Conn{conn: server, br: bufio.NewReader(server)}
+	written := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(client)
+		written <- out
+	}()
+
+	// The 123-byte limit falls in the middle of the 61st é.
+	c.Close(CloseGoingAway, "xx"+strings.Repeat("é", 80))
+	frames := parseServerFrames(t, <-written)
+	client.Close()
+	if len(frames) != 1 || frames[0].op != opClose {
+		t.Fatalf("frames = %+v, want one close frame", frames)
+	}
+	reason := frames[0].payload[2:]
+	if len(reason) != 122 || !utf8.Valid(reason) {
+		t.Errorf("reason is %d bytes, valid UTF-8 %v; want the 122 bytes before the split rune", len(reason), utf8.Valid(reason))
+	}
+}
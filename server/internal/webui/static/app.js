@@ -0,0 +1,418 @@
+"use strict";
+
+// The tanrenai web UI: a chat client for the backend's own API. Chats are
+// stored as sessions (/v1/sessions), replies stream from
+// /v1/chat/completions, and with memory on each turn is given related past
+// exchanges (/v1/memory/search) and stored afterwards (/v1/memory/store),
+// as the CLI does.
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  info: null,        // GET /api/info
+  session: null,     // the open session, with its messages
+  controller: null,  // aborts the running reply
+};
+
+const memoryResults = 3;    // memories given to each turn, as in the TUI
+const historyShare = 0.75;  // of the context window the history may fill
+
+// request calls the backend and returns its decoded JSON body, throwing the
+// API's error message on failure.
+async function request(method, path, body) {
+  const headers = {};
+  if (state.session) headers["X-Session-ID"] = state.session.id;
+  const opts = { method, headers };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, opts);
+  if (!resp.ok) throw await responseError(resp);
+  const text = await resp.text();
+  return text ? JSON.parse(text) : null;
+}
+
+async function responseError(resp) {
+  const text = await resp.text();
+  try {
+    const err = new Error(JSON.parse(text).error.message);
+    err.status = resp.status;
+    return err;
+  } catch {
+    const err = new Error(text.trim() || `${resp.status} ${resp.statusText}`);
+    err.status = resp.status;
+    return err;
+  }
+}
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+function hasFeature(name) {
+  return state.info?.features?.includes(name) ?? false;
+}
+
+// ── Models and server state ───────────────────────────────────────────
+
+async function loadInfo() {
+  try {
+    state.info = await request("GET", "/api/info");
+    $("memory-toggle").hidden = !hasFeature("memory");
+    const model = state.info.model ? `${state.info.model}${state.info.loaded ? "" : " (unloaded)"}` : "no model loaded";
+    setStatus(`${model} · GPU ${state.info.gpu_state}`);
+  } catch (err) {
+    setStatus(`backend unavailable: ${err.message}`);
+  }
+}
+
+async function loadModels() {
+  const select = $("model");
+  let models = [];
+  try {
+    models = (await request("GET", "/v1/models")).data.map((m) => m.id);
+  } catch (err) {
+    setStatus(`cannot list models: ${err.message}`);
+  }
+  const current = state.session?.model || localStorage.getItem("model") || state.info?.model || "";
+  if (current && !models.includes(current)) models.unshift(current);
+  select.replaceChildren(...models.map((id) => new Option(id, id, false, id === current)));
+}
+
+$("model").addEventListener("change", async () => {
+  const model = $("model").value;
+  localStorage.setItem("model", model);
+  if (state.session) {
+    state.session.model = model;
+    await request("PATCH", `/v1/sessions/${state.session.id}`, { model }).catch(showError);
+  }
+});
+
+// ── Sessions ──────────────────────────────────────────────────────────
+
+async function loadSessions() {
+  const list = $("sessions");
+  let sessions = [];
+  try {
+    sessions = (await request("GET", "/v1/sessions")).sessions;
+  } catch (err) {
+    showError(err);
+  }
+  list.replaceChildren(...sessions.map((s) => {
+    const item = document.createElement("li");
+    item.classList.toggle("active", s.id === state.session?.id);
+    const title = document.createElement("span");
+    title.className = "title";
+    title.textContent = s.title || s.id;
+    title.title = `${s.message_count} messages, ${new Date(s.updated_at).toLocaleString()}`;
+    const del = document.createElement("button");
+    del.className = "delete";
+    del.type = "button";
+    del.title = "Delete";
+    del.textContent = "✕";
+    del.addEventListener("click", (ev) => {
+      ev.stopPropagation();
+      deleteSession(s);
+    });
+    item.append(title, del);
+    item.addEventListener("click", () => openSession(s.id));
+    return item;
+  }));
+}
+
+async function openSession(id) {
+  if (state.controller) return;
+  try {
+    state.session = await request("GET", `/v1/sessions/${id}`);
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  location.hash = id;
+  if (state.session.model) $("model").value = state.session.model;
+  renderMessages();
+  loadSessions();
+}
+
+function newChat() {
+  if (state.controller) return;
+  state.session = null;
+  history.replaceState(null, "", location.pathname);
+  renderMessages();
+  loadSessions();
+  $("input").focus();
+}
+
+async function deleteSession(s) {
+  if (!confirm(`Delete "${s.title || s.id}"?`)) return;
+  try {
+    await request("DELETE", `/v1/sessions/${s.id}`);
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  if (state.session?.id === s.id) newChat();
+  else loadSessions();
+}
+
+// ── Rendering ─────────────────────────────────────────────────────────
+
+function renderMessages() {
+  const box = $("messages");
+  box.replaceChildren();
+  for (const msg of state.session?.messages ?? []) {
+    if (msg.role === "user" || (msg.role === "assistant" && msg.content)) {
+      box.append(messageElement(msg.role, msg.content));
+    }
+  }
+  box.scrollTop = box.scrollHeight;
+}
+
+function messageElement(role, content) {
+  const el = document.createElement("div");
+  el.className = `message ${role}`;
+  if (role === "assistant") renderMarkdown(el, content);
+  else el.textContent = content;
+  return el;
+}
+
+// renderMarkdown shows fenced code blocks, paragraphs and inline code. It
+// only ever sets textContent, so model output cannot inject markup.
+function renderMarkdown(el, text) {
+  el.replaceChildren();
+  const parts = text.split(/^```[^\n]*\n?/m);
+  parts.forEach((part, i) => {
+    if (i % 2 === 1) {
+      const pre = document.createElement("pre");
+      const code = document.createElement("code");
+      code.textContent = part.replace(/\n$/, "");
+      pre.append(code);
+      el.append(pre);
+      return;
+    }
+    for (const para of part.split(/\n{2,}/)) {
+      if (!para.trim()) continue;
+      const p = document.createElement("p");
+      para.split("`").forEach((piece, j) => {
+        if (j % 2 === 1) {
+          const code = document.createElement("code");
+          code.textContent = piece;
+          p.append(code);
+        } else {
+          p.append(piece);
+        }
+      });
+      el.append(p);
+    }
+  });
+}
+
+function showError(err) {
+  const el = document.createElement("div");
+  el.className = "message error";
+  el.textContent = err.message;
+  $("messages").append(el);
+  $("messages").scrollTop = $("messages").scrollHeight;
+}
+
+// ── Sending ───────────────────────────────────────────────────────────
+
+// memoryMessages returns system messages with the memories related to
+// input, in the TUI's format.
+async function memoryMessages(input) {
+  if (!hasFeature("memory") || !$("memory").checked) return [];
+  try {
+    const resp = await request("POST", "/v1/memory/search", { query: input, limit: memoryResults });
+    return resp.results.map((r) => ({
+      role: "system",
+      content: `[Memory from ${r.entry.timestamp.slice(0, 10)}] User asked: ${truncate(r.entry.user_msg, 200)}\n` +
+        `Assistant replied: ${truncate(r.entry.assist_msg, 500)}`,
+    }));
+  } catch {
+    return [];
+  }
+}
+
+function truncate(s, max) {
+  return s.length <= max ? s : s.slice(0, max - 3) + "...";
+}
+
+// windowed returns the latest messages that fit in the context window,
+// estimating four characters a token.
+function windowed(messages) {
+  const budget = (state.info?.ctx_size || 4096) * historyShare * 4;
+  let used = 0;
+  let start = messages.length;
+  while (start > 0) {
+    used += (messages[start - 1].content || "").length;
+    if (used > budget && start < messages.length) break;
+    start--;
+  }
+  return messages.slice(start);
+}
+
+async function send(input) {
+  state.controller = new AbortController();
+  setBusy(true);
+  const model = $("model").value;
+  const userMsg = { role: "user", content: input };
+  const box = $("messages");
+  box.append(messageElement("user", input));
+  const replyEl = messageElement("assistant", "");
+  box.append(replyEl);
+
+  // A stopped reply keeps what had arrived.
+  const out = { reply: "" };
+  let session;
+  try {
+    if (!state.session) {
+      state.session = await request("POST", "/v1/sessions", {
+        title: truncate(input.replace(/\s+/g, " ").trim(), 60),
+        model,
+        settings: {},
+      });
+      location.hash = state.session.id;
+      loadSessions();
+    }
+    session = state.session;
+    const past = session.messages.filter((m) => m.role === "user" || m.role === "assistant");
+    const messages = [...(await memoryMessages(input)), ...windowed([...past, userMsg])];
+    await stream(model, messages, replyEl, out, state.controller.signal);
+  } catch (err) {
+    if (err.name !== "AbortError") {
+      replyEl.remove();
+      showError(err);
+      return;
+    }
+  } finally {
+    state.controller = null;
+    setBusy(false);
+    loadInfo();
+  }
+  const reply = out.reply;
+  if (!reply) {
+    replyEl.remove();
+    return;
+  }
+
+  const assistMsg = { role: "assistant", content: reply };
+  try {
+    await request("POST", `/v1/sessions/${session.id}/messages`, {
+      messages: [userMsg, assistMsg],
+      expected_count: session.messages.length,
+    });
+    session.messages.push(userMsg, assistMsg);
+  } catch (err) {
+    // Another client added to the session meanwhile; show what it holds.
+    showError(err);
+    if (err.status === 409) openSession(session.id);
+  }
+  if (hasFeature("memory") && $("memory").checked) {
+    request("POST", "/v1/memory/store", { user_msg: input, assist_msg: reply }).catch(() => {});
+  }
+  loadSessions();
+}
+
+// stream sends a streaming chat completion, rendering the reply into el and
+// collecting its text in out.reply as it arrives.
+async function stream(model, messages, el, out, signal) {
+  const resp = await fetch("/v1/chat/completions", {
+    method: "POST",
+    headers: { "Content-Type": "application/json", "X-Session-ID": state.session.id },
+    body: JSON.stringify({ model, messages, stream: true }),
+    signal,
+  });
+  if (!resp.ok) throw await responseError(resp);
+
+  let reasoning = "";
+  let thought = null;
+  const reader = resp.body.getReader();
+  const decoder = new TextDecoder();
+  let buf = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buf += decoder.decode(value, { stream: true }).replace(/\r/g, "");
+    let end;
+    while ((end = buf.indexOf("\n\n")) >= 0) {
+      const event = parseEvent(buf.slice(0, end));
+      buf = buf.slice(end + 2);
+      if (event.data === "" || event.data === "[DONE]") continue;
+      const data = JSON.parse(event.data);
+      switch (event.name) {
+        case "queue":
+          setStatus(`queued (position ${data.position})`);
+          continue;
+        case "status":
+          setStatus(`loading ${data.model}…`);
+          continue;
+        case "error":
+          throw new Error(data.error.message);
+      }
+      const delta = data.choices?.[0]?.delta ?? {};
+      if (delta.reasoning_content) {
+        if (!thought) {
+          thought = document.createElement("details");
+          thought.append(Object.assign(document.createElement("summary"), { textContent: "Thinking" }));
+          thought.append(document.createElement("div"));
+        }
+        reasoning += delta.reasoning_content;
+        thought.lastChild.textContent = reasoning;
+      }
+      if (delta.content) out.reply += delta.content;
+      renderMarkdown(el, out.reply);
+      if (thought) el.prepend(thought);
+      setStatus("replying…");
+      const box = $("messages");
+      if (box.scrollHeight - box.scrollTop - box.clientHeight < 80) box.scrollTop = box.scrollHeight;
+    }
+  }
+}
+
+// parseEvent splits a server-sent event into its name and data; comments
+// such as keepalives have neither.
+function parseEvent(block) {
+  let name = "";
+  const data = [];
+  for (const line of block.split("\n")) {
+    if (line.startsWith("event:")) name = line.slice(6).trim();
+    else if (line.startsWith("data:")) data.push(line.slice(5).replace(/^ /, ""));
+  }
+  return { name, data: data.join("\n") };
+}
+
+function setBusy(busy) {
+  $("send").hidden = busy;
+  $("stop").hidden = !busy;
+  $("model").disabled = busy;
+}
+
+// ── Wiring ────────────────────────────────────────────────────────────
+
+$("composer").addEventListener("submit", (ev) => {
+  ev.preventDefault();
+  const input = $("input").value.trim();
+  if (!input || state.controller) return;
+  $("input").value = "";
+  send(input);
+});
+
+$("input").addEventListener("keydown", (ev) => {
+  if (ev.key === "Enter" && !ev.shiftKey && !ev.isComposing) {
+    ev.preventDefault();
+    $("composer").requestSubmit();
+  }
+});
+
+$("stop").addEventListener("click", () => state.controller?.abort());
+$("new-chat").addEventListener("click", newChat);
+$("toggle-sidebar").addEventListener("click", () => $("sidebar").classList.toggle("hidden"));
+
+(async () => {
+  await loadInfo();
+  await loadModels();
+  await loadSessions();
+  if (location.hash.length > 1) await openSession(location.hash.slice(1));
+  setInterval(loadInfo, 30000);
+})();
@@ -0,0 +1,31 @@
+// Package webui is the browser chat UI the backend serves at /ui: static
+// files embedded in the binary that talk to the same endpoints as the CLI —
+// streaming chat completions, sessions and memory.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Prefix is where the UI is served.
+const Prefix = "/ui/"
+
+// Handler serves the UI's files under Prefix. They are revalidated on every
+// load, so a new backend version is picked up without a hard refresh.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded directory is always there
+	}
+	fileServer := http.StripPrefix(Prefix, http.FileServerFS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	})
+}